@@ -0,0 +1,281 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+// Package bench implements the standard benchmark workloads, such as YCSB and TPC-C, driven
+// through the database/sql driver, so that the performance changes of kayak and storage are
+// measured with the same yardstick.
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// DefaultDuration is the duration of the measured run if neither Duration nor Operations is
+	// configured.
+	DefaultDuration = time.Minute
+	// loadBatchSize is the rows written in a transaction while loading the initial records.
+	loadBatchSize = 500
+)
+
+// Workload defines a benchmark workload.
+type Workload interface {
+	// Name returns the name of the workload reported in the result.
+	Name() string
+	// Setup creates the tables and loads the initial records of the workload.
+	Setup(ctx context.Context, db *sql.DB) error
+	// NewWorker returns the worker of the id-th concurrent client, each worker owns its random
+	// source and is never called concurrently.
+	NewWorker(id int, rnd *rand.Rand) Worker
+}
+
+// Worker runs the operations of a workload.
+type Worker interface {
+	// Next runs the next operation and returns its name.
+	Next(ctx context.Context, db *sql.DB) (op string, err error)
+}
+
+// NewWorkload returns the built-in workload of the name with the default parameters, see
+// Workloads.
+func NewWorkload(name string) (w Workload, err error) {
+	if name == TPCCName {
+		return NewTPCC(TPCCConfig{}), nil
+	}
+	var cfg YCSBConfig
+	if cfg, err = YCSBPreset(name); err != nil {
+		return
+	}
+	return NewYCSB(name, cfg), nil
+}
+
+// Workloads returns the names of the built-in workloads.
+func Workloads() (names []string) {
+	for name := range ycsbPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(names, TPCCName)
+}
+
+// Config defines a benchmark run.
+type Config struct {
+	// Concurrency is the number of concurrent clients, defaults to 1.
+	Concurrency int
+	// Duration is the duration of the measured run.
+	Duration time.Duration
+	// Operations is the total operations of the measured run, the run ends when either Duration
+	// or Operations is reached, DefaultDuration is used if none is set.
+	Operations int64
+	// Warmup is the duration to run the workload before measuring.
+	Warmup time.Duration
+	// Seed is the seed of the random sources of the workers, the current time is used if 0.
+	Seed int64
+	// SkipSetup runs the workload on the records loaded by a previous run.
+	SkipSetup bool
+}
+
+// Run sets up the workload and measures it with the concurrent clients of db.
+func Run(ctx context.Context, db *sql.DB, w Workload, cfg Config) (res *Result, err error) {
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.Duration <= 0 && cfg.Operations <= 0 {
+		cfg.Duration = DefaultDuration
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+
+	if !cfg.SkipSetup {
+		if err = w.Setup(ctx, db); err != nil {
+			return nil, errors.Wrapf(err, "setup workload %s failed", w.Name())
+		}
+	}
+
+	var workers = make([]Worker, cfg.Concurrency)
+	for i := range workers {
+		workers[i] = w.NewWorker(i, rand.New(rand.NewSource(cfg.Seed+int64(i))))
+	}
+
+	if cfg.Warmup > 0 {
+		wctx, cancel := context.WithTimeout(ctx, cfg.Warmup)
+		runWorkers(wctx, db, workers, 0)
+		cancel()
+		if err = ctx.Err(); err != nil {
+			return
+		}
+	}
+
+	var (
+		rctx   = ctx
+		cancel context.CancelFunc
+	)
+	if cfg.Duration > 0 {
+		rctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+	var (
+		start     = time.Now()
+		recorders = runWorkers(rctx, db, workers, cfg.Operations)
+		elapsed   = time.Since(start)
+	)
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	return newResult(w.Name(), cfg.Concurrency, start, elapsed, recorders), nil
+}
+
+// runWorkers runs the workers until ctx is done or the total operations are reached if ops is
+// positive, the operations interrupted by ctx are not recorded.
+func runWorkers(ctx context.Context, db *sql.DB, workers []Worker, ops int64) []*recorder {
+	var (
+		wg        sync.WaitGroup
+		started   int64
+		recorders = make([]*recorder, len(workers))
+	)
+	for i, w := range workers {
+		recorders[i] = newRecorder()
+		wg.Add(1)
+		go func(w Worker, r *recorder) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if ops > 0 && atomic.AddInt64(&started, 1) > ops {
+					return
+				}
+				begin := time.Now()
+				op, err := w.Next(ctx, db)
+				if err != nil && ctx.Err() != nil {
+					return
+				}
+				r.record(op, time.Since(begin), err)
+			}
+		}(w, recorders[i])
+	}
+	wg.Wait()
+	return recorders
+}
+
+// batchWriter writes the statements in the transactions of at most size statements, it is used
+// to load the initial records.
+type batchWriter struct {
+	ctx  context.Context
+	db   *sql.DB
+	size int
+	tx   *sql.Tx
+	n    int
+}
+
+func newBatchWriter(ctx context.Context, db *sql.DB) *batchWriter {
+	return &batchWriter{ctx: ctx, db: db, size: loadBatchSize}
+}
+
+func (b *batchWriter) exec(query string, args ...interface{}) (err error) {
+	if b.tx == nil {
+		if b.tx, err = b.db.BeginTx(b.ctx, nil); err != nil {
+			return
+		}
+	}
+	if _, err = b.tx.ExecContext(b.ctx, query, args...); err != nil {
+		_ = b.tx.Rollback()
+		b.tx, b.n = nil, 0
+		return
+	}
+	if b.n++; b.n >= b.size {
+		return b.flush()
+	}
+	return
+}
+
+func (b *batchWriter) flush() (err error) {
+	if b.tx == nil {
+		return
+	}
+	err = b.tx.Commit()
+	b.tx, b.n = nil, 0
+	return
+}
+
+// writeTx runs the write statements in a transaction, the reads should be done before since the
+// SQLess transactions accept writes only.
+func writeTx(ctx context.Context, db *sql.DB, f func(tx *sql.Tx) error) (err error) {
+	var tx *sql.Tx
+	if tx, err = db.BeginTx(ctx, nil); err != nil {
+		return
+	}
+	if err = f(tx); err != nil {
+		_ = tx.Rollback()
+		return
+	}
+	return tx.Commit()
+}
+
+// execAll executes the statements in the transaction.
+func execAll(ctx context.Context, tx *sql.Tx, stmts []stmt) (err error) {
+	for _, s := range stmts {
+		if _, err = tx.ExecContext(ctx, s.query, s.args...); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// stmt defines a statement with its arguments.
+type stmt struct {
+	query string
+	args  []interface{}
+}
+
+// drainRows reads all the rows of the query result and returns the row count.
+func drainRows(rows *sql.Rows) (n int, err error) {
+	defer func() { _ = rows.Close() }()
+	var cols []string
+	if cols, err = rows.Columns(); err != nil {
+		return
+	}
+	var (
+		values = make([]sql.RawBytes, len(cols))
+		dest   = make([]interface{}, len(cols))
+	)
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		n++
+	}
+	err = rows.Err()
+	return
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// randString returns a random alphanumeric string of length n.
+func randString(rnd *rand.Rand, n int) string {
+	var b = make([]byte, n)
+	for i := range b {
+		b[i] = letters[rnd.Intn(len(letters))]
+	}
+	return string(b)
+}
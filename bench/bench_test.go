@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package bench
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/SQLess/go-sqlite3-cipher"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRun(t *testing.T) {
+	Convey("test benchmark workloads on sqlite", t, func() {
+		dir, err := ioutil.TempDir("", "bench")
+		So(err, ShouldBeNil)
+		defer func() { _ = os.RemoveAll(dir) }()
+		db, err := sql.Open("sqlite3", filepath.Join(dir, "bench.db")+"?_busy_timeout=10000")
+		So(err, ShouldBeNil)
+		defer func() { _ = db.Close() }()
+		db.SetMaxOpenConns(1)
+
+		for _, name := range Workloads() {
+			w, err := NewWorkload(name)
+			So(err, ShouldBeNil)
+			switch w := w.(type) {
+			case *YCSB:
+				w.RecordCount = 100
+			case *TPCC:
+				w.Items = 100
+				w.Customers = 10
+			}
+			res, err := Run(context.Background(), db, w, Config{Concurrency: 2, Operations: 200, Seed: 1})
+			So(err, ShouldBeNil)
+			So(res.Workload, ShouldEqual, name)
+			So(res.Total.Errors, ShouldEqual, 0)
+			So(res.Total.Count, ShouldEqual, 200)
+			So(res.Total.P50, ShouldBeLessThanOrEqualTo, res.Total.P99)
+			So(res.Total.P99, ShouldBeLessThanOrEqualTo, res.Total.Max)
+
+			var buf bytes.Buffer
+			So(res.WriteText(&buf), ShouldBeNil)
+			So(buf.String(), ShouldContainSubstring, TotalOp)
+		}
+
+		_, err = NewWorkload("ycsb-z")
+		So(errors.Cause(err), ShouldEqual, ErrUnknownWorkload)
+	})
+}
+
+func TestCompare(t *testing.T) {
+	Convey("test result regression comparison", t, func() {
+		baseline := &Result{
+			Workload: "ycsb-a",
+			Total:    OpStats{OpsPerSec: 100, P95: 10 * time.Millisecond, P99: 20 * time.Millisecond},
+			Ops: map[string]*OpStats{
+				"read":   {OpsPerSec: 50, P95: 5 * time.Millisecond, P99: 10 * time.Millisecond},
+				"update": {OpsPerSec: 50, P95: 15 * time.Millisecond, P99: 30 * time.Millisecond},
+			},
+		}
+		path := filepath.Join(os.TempDir(), "bench_baseline.json")
+		defer func() { _ = os.Remove(path) }()
+		So(SaveResult(path, baseline), ShouldBeNil)
+		loaded, err := LoadResult(path)
+		So(err, ShouldBeNil)
+		So(loaded, ShouldResemble, baseline)
+
+		current := &Result{
+			Workload: "ycsb-a",
+			Total:    OpStats{OpsPerSec: 95, P95: 10 * time.Millisecond, P99: 20 * time.Millisecond},
+			Ops: map[string]*OpStats{
+				"read":   {OpsPerSec: 45, P95: 5 * time.Millisecond, P99: 13 * time.Millisecond},
+				"update": {OpsPerSec: 50, P95: 15 * time.Millisecond, P99: 30 * time.Millisecond},
+				"insert": {OpsPerSec: 10, P95: 15 * time.Millisecond, P99: 30 * time.Millisecond},
+			},
+		}
+		regs, err := Compare(loaded, current, 0)
+		So(err, ShouldBeNil)
+		So(regs, ShouldHaveLength, 1)
+		So(regs[0].Op, ShouldEqual, "read")
+		So(regs[0].Metric, ShouldEqual, "p99(ms)")
+		So(regs[0].Change, ShouldAlmostEqual, 0.3)
+
+		regs, err = Compare(loaded, current, 0.05)
+		So(err, ShouldBeNil)
+		So(regs, ShouldHaveLength, 2)
+
+		current.Workload = "tpcc"
+		_, err = Compare(loaded, current, 0)
+		So(errors.Cause(err), ShouldEqual, ErrWorkloadMismatch)
+	})
+}
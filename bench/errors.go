@@ -0,0 +1,25 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package bench
+
+import "github.com/pkg/errors"
+
+var (
+	// ErrUnknownWorkload indicates the workload name is not one of the built-in workloads.
+	ErrUnknownWorkload = errors.New("unknown workload")
+	// ErrWorkloadMismatch indicates the results of different workloads are compared.
+	ErrWorkloadMismatch = errors.New("workload mismatch")
+)
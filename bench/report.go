@@ -0,0 +1,142 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRegressionThreshold is the relative change of the throughput or the tail latencies
+// reported as a regression.
+const DefaultRegressionThreshold = 0.1
+
+// WriteText writes the human readable report of the result.
+func (r *Result) WriteText(w io.Writer) (err error) {
+	if _, err = fmt.Fprintf(w, "workload: %s, concurrency: %d, elapsed: %s\n\n",
+		r.Workload, r.Concurrency, r.Elapsed.Round(time.Millisecond)); err != nil {
+		return
+	}
+	var tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tcount\terrors\tops/s\tmean\tp50\tp95\tp99\tmax\t")
+	var row = func(op string, s *OpStats) {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t%s\t\n", op, s.Count, s.Errors, s.OpsPerSec,
+			fmtLatency(s.Mean), fmtLatency(s.P50), fmtLatency(s.P95), fmtLatency(s.P99), fmtLatency(s.Max))
+	}
+	for _, op := range r.opNames() {
+		row(op, r.Ops[op])
+	}
+	row(TotalOp, &r.Total)
+	return tw.Flush()
+}
+
+func fmtLatency(d time.Duration) string {
+	return d.Round(10 * time.Microsecond).String()
+}
+
+// SaveResult saves the result as JSON to the file, which could be loaded as the baseline of the
+// later runs.
+func SaveResult(path string, r *Result) (err error) {
+	var data []byte
+	if data, err = json.MarshalIndent(r, "", "  "); err != nil {
+		return
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// LoadResult loads the result saved by SaveResult.
+func LoadResult(path string) (r *Result, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(path); err != nil {
+		return
+	}
+	r = &Result{}
+	if err = json.Unmarshal(data, r); err != nil {
+		return nil, errors.Wrapf(err, "decode result %s failed", path)
+	}
+	return
+}
+
+// Regression defines a metric of an operation which is worse than the baseline.
+type Regression struct {
+	Op       string
+	Metric   string
+	Baseline float64
+	Current  float64
+	// Change is the relative change to the baseline, positive for increases.
+	Change float64
+}
+
+func (r *Regression) String() string {
+	return fmt.Sprintf("%s %s: %.4g -> %.4g (%+.1f%%)", r.Op, r.Metric, r.Baseline, r.Current, r.Change*100)
+}
+
+// Compare compares the result with the baseline of the same workload, the operations missing
+// in either result are skipped. A regression is reported if the throughput drops or the p95/p99
+// latency rises more than threshold relative to the baseline, DefaultRegressionThreshold is used
+// if threshold is not positive.
+func Compare(baseline, current *Result, threshold float64) (regs []*Regression, err error) {
+	if baseline.Workload != current.Workload {
+		return nil, errors.Wrapf(ErrWorkloadMismatch, "baseline %s, current %s",
+			baseline.Workload, current.Workload)
+	}
+	if threshold <= 0 {
+		threshold = DefaultRegressionThreshold
+	}
+	for _, op := range append(current.opNames(), TotalOp) {
+		b, ok := baseline.opStats(op)
+		if !ok {
+			continue
+		}
+		c, _ := current.opStats(op)
+		if reg := compareMetric(op, "ops/s", b.OpsPerSec, c.OpsPerSec); reg != nil && -reg.Change > threshold {
+			regs = append(regs, reg)
+		}
+		for _, m := range []struct {
+			name string
+			b, c time.Duration
+		}{{"p95", b.P95, c.P95}, {"p99", b.P99, c.P99}} {
+			reg := compareMetric(op, m.name+"(ms)", durationMillis(m.b), durationMillis(m.c))
+			if reg != nil && reg.Change > threshold {
+				regs = append(regs, reg)
+			}
+		}
+	}
+	return
+}
+
+func compareMetric(op, metric string, baseline, current float64) *Regression {
+	if baseline <= 0 {
+		return nil
+	}
+	return &Regression{
+		Op:       op,
+		Metric:   metric,
+		Baseline: baseline,
+		Current:  current,
+		Change:   (current - baseline) / baseline,
+	}
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
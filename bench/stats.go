@@ -0,0 +1,162 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package bench
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// TotalOp is the name of the aggregated stats of all operations in comparisons.
+const TotalOp = "total"
+
+// OpStats defines the measured stats of an operation.
+type OpStats struct {
+	Count     int64         `json:"count"`
+	Errors    int64         `json:"errors"`
+	OpsPerSec float64       `json:"ops_per_sec"`
+	Mean      time.Duration `json:"mean"`
+	P50       time.Duration `json:"p50"`
+	P95       time.Duration `json:"p95"`
+	P99       time.Duration `json:"p99"`
+	Max       time.Duration `json:"max"`
+}
+
+// Result defines the result of a benchmark run.
+type Result struct {
+	Workload    string              `json:"workload"`
+	Concurrency int                 `json:"concurrency"`
+	StartedAt   time.Time           `json:"started_at"`
+	Elapsed     time.Duration       `json:"elapsed"`
+	Total       OpStats             `json:"total"`
+	Ops         map[string]*OpStats `json:"ops"`
+}
+
+// opStats returns the stats of the operation, TotalOp returns the aggregated stats.
+func (r *Result) opStats(op string) (stats *OpStats, ok bool) {
+	if op == TotalOp {
+		return &r.Total, true
+	}
+	stats, ok = r.Ops[op]
+	return
+}
+
+// opNames returns the sorted operation names of the result.
+func (r *Result) opNames() (names []string) {
+	for op := range r.Ops {
+		names = append(names, op)
+	}
+	sort.Strings(names)
+	return
+}
+
+// opRecord records the latencies of the succeeded operations and the failure count.
+type opRecord struct {
+	latencies []time.Duration
+	errors    int64
+}
+
+// recorder records the operations of a worker.
+type recorder struct {
+	ops map[string]*opRecord
+}
+
+func newRecorder() *recorder {
+	return &recorder{ops: make(map[string]*opRecord)}
+}
+
+func (r *recorder) record(op string, latency time.Duration, err error) {
+	rec, ok := r.ops[op]
+	if !ok {
+		rec = &opRecord{}
+		r.ops[op] = rec
+	}
+	if err != nil {
+		rec.errors++
+		return
+	}
+	rec.latencies = append(rec.latencies, latency)
+}
+
+// newResult merges the records of the workers to the result.
+func newResult(
+	workload string, concurrency int, start time.Time, elapsed time.Duration, recorders []*recorder,
+) *Result {
+	var (
+		merged = make(map[string]*opRecord)
+		total  = &opRecord{}
+	)
+	for _, r := range recorders {
+		for op, rec := range r.ops {
+			m, ok := merged[op]
+			if !ok {
+				m = &opRecord{}
+				merged[op] = m
+			}
+			m.latencies = append(m.latencies, rec.latencies...)
+			m.errors += rec.errors
+			total.latencies = append(total.latencies, rec.latencies...)
+			total.errors += rec.errors
+		}
+	}
+	var res = &Result{
+		Workload:    workload,
+		Concurrency: concurrency,
+		StartedAt:   start.UTC(),
+		Elapsed:     elapsed,
+		Total:       *newOpStats(total, elapsed),
+		Ops:         make(map[string]*OpStats, len(merged)),
+	}
+	for op, rec := range merged {
+		res.Ops[op] = newOpStats(rec, elapsed)
+	}
+	return res
+}
+
+func newOpStats(rec *opRecord, elapsed time.Duration) (stats *OpStats) {
+	var lats = rec.latencies
+	stats = &OpStats{
+		Count:  int64(len(lats)),
+		Errors: rec.errors,
+	}
+	if len(lats) == 0 {
+		return
+	}
+	if elapsed > 0 {
+		stats.OpsPerSec = float64(len(lats)) / elapsed.Seconds()
+	}
+	sort.Slice(lats, func(i, j int) bool { return lats[i] < lats[j] })
+	var sum time.Duration
+	for _, l := range lats {
+		sum += l
+	}
+	stats.Mean = sum / time.Duration(len(lats))
+	stats.P50 = percentile(lats, 0.50)
+	stats.P95 = percentile(lats, 0.95)
+	stats.P99 = percentile(lats, 0.99)
+	stats.Max = lats[len(lats)-1]
+	return
+}
+
+// percentile returns the p-th percentile of the sorted latencies with the nearest rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	var i = int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
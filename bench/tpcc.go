@@ -0,0 +1,401 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"time"
+)
+
+// TPCCName is the name of the TPC-C workload.
+const TPCCName = "tpcc"
+
+const (
+	tpccDistricts = 10
+	// tpccMaxQuantity is the stock quantity restocked to once it runs low.
+	tpccMaxQuantity = 100
+)
+
+var tpccSchema = []string{
+	`CREATE TABLE "warehouse" ("w_id" INTEGER PRIMARY KEY, "w_name" TEXT, "w_tax" REAL, "w_ytd" REAL)`,
+	`CREATE TABLE "district" ("d_w_id" INTEGER, "d_id" INTEGER, "d_name" TEXT, "d_tax" REAL, "d_ytd" REAL,
+		"d_next_o_id" INTEGER, PRIMARY KEY ("d_w_id", "d_id"))`,
+	`CREATE TABLE "customer" ("c_w_id" INTEGER, "c_d_id" INTEGER, "c_id" INTEGER, "c_last" TEXT,
+		"c_credit" TEXT, "c_discount" REAL, "c_balance" REAL, "c_ytd_payment" REAL, "c_payment_cnt" INTEGER,
+		"c_delivery_cnt" INTEGER, PRIMARY KEY ("c_w_id", "c_d_id", "c_id"))`,
+	`CREATE INDEX "customer_last" ON "customer" ("c_w_id", "c_d_id", "c_last")`,
+	`CREATE TABLE "history" ("h_c_id" INTEGER, "h_c_d_id" INTEGER, "h_c_w_id" INTEGER, "h_d_id" INTEGER,
+		"h_w_id" INTEGER, "h_date" INTEGER, "h_amount" REAL)`,
+	`CREATE TABLE "item" ("i_id" INTEGER PRIMARY KEY, "i_name" TEXT, "i_price" REAL)`,
+	`CREATE TABLE "stock" ("s_w_id" INTEGER, "s_i_id" INTEGER, "s_quantity" INTEGER, "s_ytd" INTEGER,
+		"s_order_cnt" INTEGER, PRIMARY KEY ("s_w_id", "s_i_id"))`,
+	`CREATE TABLE "orders" ("o_w_id" INTEGER, "o_d_id" INTEGER, "o_id" INTEGER, "o_c_id" INTEGER,
+		"o_entry_d" INTEGER, "o_carrier_id" INTEGER, "o_ol_cnt" INTEGER, PRIMARY KEY ("o_w_id", "o_d_id", "o_id"))`,
+	`CREATE INDEX "orders_customer" ON "orders" ("o_w_id", "o_d_id", "o_c_id", "o_id")`,
+	`CREATE TABLE "new_order" ("no_w_id" INTEGER, "no_d_id" INTEGER, "no_o_id" INTEGER,
+		PRIMARY KEY ("no_w_id", "no_d_id", "no_o_id"))`,
+	`CREATE TABLE "order_line" ("ol_w_id" INTEGER, "ol_d_id" INTEGER, "ol_o_id" INTEGER, "ol_number" INTEGER,
+		"ol_i_id" INTEGER, "ol_quantity" INTEGER, "ol_amount" REAL, "ol_delivery_d" INTEGER,
+		PRIMARY KEY ("ol_w_id", "ol_d_id", "ol_o_id", "ol_number"))`,
+}
+
+var tpccTables = []string{
+	"warehouse", "district", "customer", "history", "item", "stock", "orders", "new_order", "order_line",
+}
+
+// TPCCConfig defines the scale of the TPC-C workload.
+type TPCCConfig struct {
+	// Warehouses is the number of warehouses, defaults to 1.
+	Warehouses int
+	// Customers is the customers of a district, defaults to 100.
+	Customers int
+	// Items is the items in stock of each warehouse, defaults to 1000.
+	Items int
+}
+
+// TPCC implements a TPC-C style workload with the five standard transactions in the standard mix.
+// It is scaled down and simplified to fit the SQLess transactions, which accept writes only: the
+// reads of a transaction are done before its writes, and the initial orders are not loaded.
+//
+// Each worker is bound to a home district, the transactions of the workers sharing a district may
+// conflict and are counted as errors, so the concurrency should not exceed Warehouses*10.
+type TPCC struct {
+	TPCCConfig
+}
+
+// NewTPCC returns the TPC-C workload of the config.
+func NewTPCC(cfg TPCCConfig) *TPCC {
+	if cfg.Warehouses <= 0 {
+		cfg.Warehouses = 1
+	}
+	if cfg.Customers <= 0 {
+		cfg.Customers = 100
+	}
+	if cfg.Items <= 0 {
+		cfg.Items = 1000
+	}
+	return &TPCC{TPCCConfig: cfg}
+}
+
+// Name implements Workload.Name.
+func (t *TPCC) Name() string {
+	return TPCCName
+}
+
+// Setup implements Workload.Setup.
+func (t *TPCC) Setup(ctx context.Context, db *sql.DB) (err error) {
+	for _, table := range tpccTables {
+		if _, err = db.ExecContext(ctx, `DROP TABLE IF EXISTS "`+table+`"`); err != nil {
+			return
+		}
+	}
+	for _, q := range tpccSchema {
+		if _, err = db.ExecContext(ctx, q); err != nil {
+			return
+		}
+	}
+
+	var (
+		rnd   = rand.New(rand.NewSource(int64(t.Warehouses)))
+		batch = newBatchWriter(ctx, db)
+	)
+	for i := 1; i <= t.Items; i++ {
+		if err = batch.exec(`INSERT INTO "item" VALUES (?, ?, ?)`,
+			i, randString(rnd, 14+rnd.Intn(11)), float64(100+rnd.Intn(9901))/100); err != nil {
+			return
+		}
+	}
+	for w := 1; w <= t.Warehouses; w++ {
+		if err = batch.exec(`INSERT INTO "warehouse" VALUES (?, ?, ?, ?)`,
+			w, randString(rnd, 10), tax(rnd), 300000.0); err != nil {
+			return
+		}
+		for i := 1; i <= t.Items; i++ {
+			if err = batch.exec(`INSERT INTO "stock" VALUES (?, ?, ?, 0, 0)`,
+				w, i, 10+rnd.Intn(91)); err != nil {
+				return
+			}
+		}
+		for d := 1; d <= tpccDistricts; d++ {
+			if err = batch.exec(`INSERT INTO "district" VALUES (?, ?, ?, ?, ?, 1)`,
+				w, d, randString(rnd, 10), tax(rnd), 30000.0); err != nil {
+				return
+			}
+			for c := 1; c <= t.Customers; c++ {
+				var credit = "GC"
+				if rnd.Intn(10) == 0 {
+					credit = "BC"
+				}
+				if err = batch.exec(`INSERT INTO "customer" VALUES (?, ?, ?, ?, ?, ?, -10.0, 10.0, 1, 0)`,
+					w, d, c, lastName((c-1)%1000), credit, float64(rnd.Intn(5001))/10000); err != nil {
+					return
+				}
+			}
+		}
+	}
+	return batch.flush()
+}
+
+// NewWorker implements Workload.NewWorker.
+func (t *TPCC) NewWorker(id int, rnd *rand.Rand) Worker {
+	return &tpccWorker{
+		t:         t,
+		rnd:       rnd,
+		warehouse: id/tpccDistricts%t.Warehouses + 1,
+		district:  id%tpccDistricts + 1,
+	}
+}
+
+func tax(rnd *rand.Rand) float64 {
+	return float64(rnd.Intn(2001)) / 10000
+}
+
+var lastNameSyllables = []string{"BAR", "OUGHT", "ABLE", "PRI", "PRES", "ESE", "ANTI", "CALLY", "ATION", "EING"}
+
+// lastName returns the customer last name of the number in 0-999 as the TPC-C specification.
+func lastName(n int) string {
+	return lastNameSyllables[n/100] + lastNameSyllables[n/10%10] + lastNameSyllables[n%10]
+}
+
+type tpccWorker struct {
+	t         *TPCC
+	rnd       *rand.Rand
+	warehouse int
+	district  int
+}
+
+func (w *tpccWorker) Next(ctx context.Context, db *sql.DB) (op string, err error) {
+	switch p := w.rnd.Intn(100); {
+	case p < 45:
+		return "new-order", w.newOrder(ctx, db)
+	case p < 88:
+		return "payment", w.payment(ctx, db)
+	case p < 92:
+		return "order-status", w.orderStatus(ctx, db)
+	case p < 96:
+		return "delivery", w.delivery(ctx, db)
+	default:
+		return "stock-level", w.stockLevel(ctx, db)
+	}
+}
+
+func (w *tpccWorker) customer() int {
+	return 1 + w.rnd.Intn(w.t.Customers)
+}
+
+// customerByLastName picks the customer of the home district by a random last name as the
+// TPC-C specification, a random customer is picked if the last name is not found.
+func (w *tpccWorker) customerByLastName(ctx context.Context, db *sql.DB) (c int, err error) {
+	var n = w.t.Customers
+	if n > 1000 {
+		n = 1000
+	}
+	var rows *sql.Rows
+	if rows, err = db.QueryContext(ctx,
+		`SELECT "c_id" FROM "customer" WHERE "c_w_id" = ? AND "c_d_id" = ? AND "c_last" = ? ORDER BY "c_id"`,
+		w.warehouse, w.district, lastName(w.rnd.Intn(n)),
+	); err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	if len(ids) == 0 {
+		return w.customer(), nil
+	}
+	return ids[len(ids)/2], nil
+}
+
+func (w *tpccWorker) newOrder(ctx context.Context, db *sql.DB) (err error) {
+	var (
+		c      = w.customer()
+		olCnt  = 5 + w.rnd.Intn(11)
+		nextID int
+	)
+	if err = db.QueryRowContext(ctx,
+		`SELECT "d_next_o_id" FROM "district" WHERE "d_w_id" = ? AND "d_id" = ?`,
+		w.warehouse, w.district).Scan(&nextID); err != nil {
+		return
+	}
+	var stmts = []stmt{
+		{`UPDATE "district" SET "d_next_o_id" = "d_next_o_id" + 1 WHERE "d_w_id" = ? AND "d_id" = ?`,
+			[]interface{}{w.warehouse, w.district}},
+		{`INSERT INTO "orders" VALUES (?, ?, ?, ?, ?, NULL, ?)`,
+			[]interface{}{w.warehouse, w.district, nextID, c, time.Now().Unix(), olCnt}},
+		{`INSERT INTO "new_order" VALUES (?, ?, ?)`, []interface{}{w.warehouse, w.district, nextID}},
+	}
+	for ol := 1; ol <= olCnt; ol++ {
+		var (
+			item     = 1 + w.rnd.Intn(w.t.Items)
+			quantity = 1 + w.rnd.Intn(10)
+			price    float64
+			stock    int
+		)
+		if err = db.QueryRowContext(ctx, `SELECT "i_price" FROM "item" WHERE "i_id" = ?`, item).Scan(&price); err != nil {
+			return
+		}
+		if err = db.QueryRowContext(ctx,
+			`SELECT "s_quantity" FROM "stock" WHERE "s_w_id" = ? AND "s_i_id" = ?`,
+			w.warehouse, item).Scan(&stock); err != nil {
+			return
+		}
+		if stock -= quantity; stock < 10 {
+			stock += tpccMaxQuantity - 9
+		}
+		stmts = append(stmts,
+			stmt{`UPDATE "stock" SET "s_quantity" = ?, "s_ytd" = "s_ytd" + ?, "s_order_cnt" = "s_order_cnt" + 1
+				WHERE "s_w_id" = ? AND "s_i_id" = ?`, []interface{}{stock, quantity, w.warehouse, item}},
+			stmt{`INSERT INTO "order_line" VALUES (?, ?, ?, ?, ?, ?, ?, NULL)`,
+				[]interface{}{w.warehouse, w.district, nextID, ol, item, quantity, price * float64(quantity)}},
+		)
+	}
+	return writeTx(ctx, db, func(tx *sql.Tx) error { return execAll(ctx, tx, stmts) })
+}
+
+func (w *tpccWorker) payment(ctx context.Context, db *sql.DB) (err error) {
+	var (
+		amount = float64(100+w.rnd.Intn(499901)) / 100
+		c      int
+	)
+	if w.rnd.Intn(100) < 60 {
+		if c, err = w.customerByLastName(ctx, db); err != nil {
+			return
+		}
+	} else {
+		c = w.customer()
+	}
+	return writeTx(ctx, db, func(tx *sql.Tx) error {
+		return execAll(ctx, tx, []stmt{
+			{`UPDATE "warehouse" SET "w_ytd" = "w_ytd" + ? WHERE "w_id" = ?`, []interface{}{amount, w.warehouse}},
+			{`UPDATE "district" SET "d_ytd" = "d_ytd" + ? WHERE "d_w_id" = ? AND "d_id" = ?`,
+				[]interface{}{amount, w.warehouse, w.district}},
+			{`UPDATE "customer" SET "c_balance" = "c_balance" - ?, "c_ytd_payment" = "c_ytd_payment" + ?,
+				"c_payment_cnt" = "c_payment_cnt" + 1 WHERE "c_w_id" = ? AND "c_d_id" = ? AND "c_id" = ?`,
+				[]interface{}{amount, amount, w.warehouse, w.district, c}},
+			{`INSERT INTO "history" VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				[]interface{}{c, w.district, w.warehouse, w.district, w.warehouse, time.Now().Unix(), amount}},
+		})
+	})
+}
+
+func (w *tpccWorker) orderStatus(ctx context.Context, db *sql.DB) (err error) {
+	var c int
+	if w.rnd.Intn(100) < 60 {
+		if c, err = w.customerByLastName(ctx, db); err != nil {
+			return
+		}
+	} else {
+		c = w.customer()
+	}
+	var rows *sql.Rows
+	if rows, err = db.QueryContext(ctx,
+		`SELECT "c_balance", "c_last" FROM "customer" WHERE "c_w_id" = ? AND "c_d_id" = ? AND "c_id" = ?`,
+		w.warehouse, w.district, c); err != nil {
+		return
+	}
+	if _, err = drainRows(rows); err != nil {
+		return
+	}
+	var order sql.NullInt64
+	if err = db.QueryRowContext(ctx,
+		`SELECT MAX("o_id") FROM "orders" WHERE "o_w_id" = ? AND "o_d_id" = ? AND "o_c_id" = ?`,
+		w.warehouse, w.district, c).Scan(&order); err != nil || !order.Valid {
+		return
+	}
+	if rows, err = db.QueryContext(ctx,
+		`SELECT "ol_i_id", "ol_quantity", "ol_amount", "ol_delivery_d" FROM "order_line"
+			WHERE "ol_w_id" = ? AND "ol_d_id" = ? AND "ol_o_id" = ?`,
+		w.warehouse, w.district, order.Int64); err != nil {
+		return
+	}
+	_, err = drainRows(rows)
+	return
+}
+
+// delivery delivers the oldest new order of each district of the home warehouse.
+func (w *tpccWorker) delivery(ctx context.Context, db *sql.DB) (err error) {
+	var (
+		carrier = 1 + w.rnd.Intn(10)
+		now     = time.Now().Unix()
+		stmts   []stmt
+	)
+	for d := 1; d <= tpccDistricts; d++ {
+		var order sql.NullInt64
+		if err = db.QueryRowContext(ctx,
+			`SELECT MIN("no_o_id") FROM "new_order" WHERE "no_w_id" = ? AND "no_d_id" = ?`,
+			w.warehouse, d).Scan(&order); err != nil {
+			return
+		}
+		if !order.Valid {
+			continue
+		}
+		var (
+			c     int
+			total sql.NullFloat64
+		)
+		if err = db.QueryRowContext(ctx,
+			`SELECT "o_c_id" FROM "orders" WHERE "o_w_id" = ? AND "o_d_id" = ? AND "o_id" = ?`,
+			w.warehouse, d, order.Int64).Scan(&c); err != nil {
+			return
+		}
+		if err = db.QueryRowContext(ctx,
+			`SELECT SUM("ol_amount") FROM "order_line" WHERE "ol_w_id" = ? AND "ol_d_id" = ? AND "ol_o_id" = ?`,
+			w.warehouse, d, order.Int64).Scan(&total); err != nil {
+			return
+		}
+		stmts = append(stmts,
+			stmt{`DELETE FROM "new_order" WHERE "no_w_id" = ? AND "no_d_id" = ? AND "no_o_id" = ?`,
+				[]interface{}{w.warehouse, d, order.Int64}},
+			stmt{`UPDATE "orders" SET "o_carrier_id" = ? WHERE "o_w_id" = ? AND "o_d_id" = ? AND "o_id" = ?`,
+				[]interface{}{carrier, w.warehouse, d, order.Int64}},
+			stmt{`UPDATE "order_line" SET "ol_delivery_d" = ? WHERE "ol_w_id" = ? AND "ol_d_id" = ? AND "ol_o_id" = ?`,
+				[]interface{}{now, w.warehouse, d, order.Int64}},
+			stmt{`UPDATE "customer" SET "c_balance" = "c_balance" + ?, "c_delivery_cnt" = "c_delivery_cnt" + 1
+				WHERE "c_w_id" = ? AND "c_d_id" = ? AND "c_id" = ?`,
+				[]interface{}{total.Float64, w.warehouse, d, c}},
+		)
+	}
+	if len(stmts) == 0 {
+		return
+	}
+	return writeTx(ctx, db, func(tx *sql.Tx) error { return execAll(ctx, tx, stmts) })
+}
+
+// stockLevel counts the recently sold items of the home district below a random threshold.
+func (w *tpccWorker) stockLevel(ctx context.Context, db *sql.DB) (err error) {
+	var nextID, count int
+	if err = db.QueryRowContext(ctx,
+		`SELECT "d_next_o_id" FROM "district" WHERE "d_w_id" = ? AND "d_id" = ?`,
+		w.warehouse, w.district).Scan(&nextID); err != nil {
+		return
+	}
+	return db.QueryRowContext(ctx,
+		`SELECT COUNT(DISTINCT "s_i_id") FROM "order_line", "stock"
+			WHERE "ol_w_id" = ? AND "ol_d_id" = ? AND "ol_o_id" < ? AND "ol_o_id" >= ?
+			AND "s_w_id" = "ol_w_id" AND "s_i_id" = "ol_i_id" AND "s_quantity" < ?`,
+		w.warehouse, w.district, nextID, nextID-20, 10+w.rnd.Intn(11)).Scan(&count)
+}
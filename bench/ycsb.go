@@ -0,0 +1,266 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+// The request distributions of the YCSB workloads.
+const (
+	DistUniform = "uniform"
+	DistZipfian = "zipfian"
+	DistLatest  = "latest"
+)
+
+const (
+	ycsbTable = "usertable"
+	// zipfianSkew is the skew of the zipfian distribution, math/rand requires it larger than 1.
+	zipfianSkew = 1.01
+)
+
+// YCSBConfig defines the parameters of a YCSB core workload, the operation proportions should
+// sum up to 1.
+type YCSBConfig struct {
+	// RecordCount is the initial records loaded, defaults to 1000.
+	RecordCount int
+	// FieldCount is the fields of a record, defaults to 10.
+	FieldCount int
+	// FieldLength is the length of a field value, defaults to 100.
+	FieldLength int
+	// MaxScanLength is the max records of a scan, defaults to 100.
+	MaxScanLength int
+	// RequestDistribution picks the records of the operations, one of DistUniform, DistZipfian
+	// and DistLatest, defaults to DistUniform.
+	RequestDistribution string
+
+	ReadProportion            float64
+	UpdateProportion          float64
+	InsertProportion          float64
+	ScanProportion            float64
+	ReadModifyWriteProportion float64
+}
+
+var ycsbPresets = map[string]YCSBConfig{
+	// update heavy
+	"ycsb-a": {ReadProportion: 0.5, UpdateProportion: 0.5, RequestDistribution: DistZipfian},
+	// read mostly
+	"ycsb-b": {ReadProportion: 0.95, UpdateProportion: 0.05, RequestDistribution: DistZipfian},
+	// read only
+	"ycsb-c": {ReadProportion: 1, RequestDistribution: DistZipfian},
+	// read latest
+	"ycsb-d": {ReadProportion: 0.95, InsertProportion: 0.05, RequestDistribution: DistLatest},
+	// short ranges
+	"ycsb-e": {ScanProportion: 0.95, InsertProportion: 0.05, RequestDistribution: DistZipfian},
+	// read-modify-write
+	"ycsb-f": {ReadProportion: 0.5, ReadModifyWriteProportion: 0.5, RequestDistribution: DistZipfian},
+}
+
+// YCSBPreset returns the config of the YCSB core workload preset, ycsb-a to ycsb-f.
+func YCSBPreset(name string) (cfg YCSBConfig, err error) {
+	var ok bool
+	if cfg, ok = ycsbPresets[strings.ToLower(name)]; !ok {
+		err = errors.Wrap(ErrUnknownWorkload, name)
+	}
+	return
+}
+
+// YCSB implements the YCSB core workloads on a single table, the records are keyed by the hash of
+// their insertion order.
+type YCSB struct {
+	YCSBConfig
+	name string
+	// inserted is the records inserted by the workers after the initial records.
+	inserted int64
+}
+
+// NewYCSB returns the YCSB workload of the config.
+func NewYCSB(name string, cfg YCSBConfig) *YCSB {
+	if cfg.RecordCount <= 0 {
+		cfg.RecordCount = 1000
+	}
+	if cfg.FieldCount <= 0 {
+		cfg.FieldCount = 10
+	}
+	if cfg.FieldLength <= 0 {
+		cfg.FieldLength = 100
+	}
+	if cfg.MaxScanLength <= 0 {
+		cfg.MaxScanLength = 100
+	}
+	return &YCSB{YCSBConfig: cfg, name: name}
+}
+
+// Name implements Workload.Name.
+func (y *YCSB) Name() string {
+	return y.name
+}
+
+// Setup implements Workload.Setup.
+func (y *YCSB) Setup(ctx context.Context, db *sql.DB) (err error) {
+	var cols = make([]string, y.FieldCount)
+	for i := range cols {
+		cols[i] = fmt.Sprintf(`"field%d" TEXT`, i)
+	}
+	if _, err = db.ExecContext(ctx, `DROP TABLE IF EXISTS "`+ycsbTable+`"`); err != nil {
+		return
+	}
+	if _, err = db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE "%s" ("ycsb_key" TEXT PRIMARY KEY, %s)`,
+		ycsbTable, strings.Join(cols, ", "))); err != nil {
+		return
+	}
+	atomic.StoreInt64(&y.inserted, 0)
+
+	var (
+		rnd   = rand.New(rand.NewSource(int64(y.RecordCount)))
+		batch = newBatchWriter(ctx, db)
+	)
+	for i := 0; i < y.RecordCount; i++ {
+		query, args := y.insert(rnd, int64(i))
+		if err = batch.exec(query, args...); err != nil {
+			return errors.Wrapf(err, "load record %d failed", i)
+		}
+	}
+	return batch.flush()
+}
+
+// NewWorker implements Workload.NewWorker.
+func (y *YCSB) NewWorker(id int, rnd *rand.Rand) Worker {
+	return &ycsbWorker{
+		y:    y,
+		rnd:  rnd,
+		zipf: rand.NewZipf(rnd, zipfianSkew, 1, uint64(y.RecordCount-1)),
+	}
+}
+
+// recordCount returns the records inserted so far, some of which may be inserting.
+func (y *YCSB) recordCount() int64 {
+	return int64(y.RecordCount) + atomic.LoadInt64(&y.inserted)
+}
+
+// key returns the key of the i-th inserted record.
+func (y *YCSB) key(i int64) string {
+	var (
+		h   = fnv.New64a()
+		buf [8]byte
+	)
+	binary.LittleEndian.PutUint64(buf[:], uint64(i))
+	_, _ = h.Write(buf[:])
+	return "user" + strconv.FormatUint(h.Sum64(), 10)
+}
+
+func (y *YCSB) insert(rnd *rand.Rand, i int64) (query string, args []interface{}) {
+	var (
+		cols         = make([]string, y.FieldCount)
+		placeholders = make([]string, y.FieldCount+1)
+	)
+	args = make([]interface{}, 0, y.FieldCount+1)
+	args = append(args, y.key(i))
+	placeholders[0] = "?"
+	for f := range cols {
+		cols[f] = fmt.Sprintf(`"field%d"`, f)
+		placeholders[f+1] = "?"
+		args = append(args, randString(rnd, y.FieldLength))
+	}
+	query = fmt.Sprintf(`INSERT INTO "%s" ("ycsb_key", %s) VALUES (%s)`,
+		ycsbTable, strings.Join(cols, ", "), strings.Join(placeholders, ", "))
+	return
+}
+
+type ycsbWorker struct {
+	y    *YCSB
+	rnd  *rand.Rand
+	zipf *rand.Zipf
+}
+
+// nextKey picks the key of an existing record with the request distribution.
+func (w *ycsbWorker) nextKey() string {
+	var (
+		n = w.y.recordCount()
+		i int64
+	)
+	switch w.y.RequestDistribution {
+	case DistZipfian:
+		i = int64(w.zipf.Uint64())
+	case DistLatest:
+		if i = n - 1 - int64(w.zipf.Uint64()); i < 0 {
+			i = 0
+		}
+	default:
+		i = w.rnd.Int63n(n)
+	}
+	return w.y.key(i)
+}
+
+func (w *ycsbWorker) Next(ctx context.Context, db *sql.DB) (op string, err error) {
+	var (
+		y = w.y
+		p = w.rnd.Float64()
+	)
+	switch {
+	case p < y.ReadProportion:
+		return "read", w.read(ctx, db, w.nextKey())
+	case p < y.ReadProportion+y.UpdateProportion:
+		return "update", w.update(ctx, db, w.nextKey())
+	case p < y.ReadProportion+y.UpdateProportion+y.InsertProportion:
+		query, args := y.insert(w.rnd, int64(y.RecordCount)+atomic.AddInt64(&y.inserted, 1)-1)
+		_, err = db.ExecContext(ctx, query, args...)
+		return "insert", err
+	case p < y.ReadProportion+y.UpdateProportion+y.InsertProportion+y.ScanProportion:
+		var rows *sql.Rows
+		if rows, err = db.QueryContext(ctx, fmt.Sprintf(
+			`SELECT * FROM "%s" WHERE "ycsb_key" >= ? ORDER BY "ycsb_key" LIMIT ?`, ycsbTable),
+			w.nextKey(), 1+w.rnd.Intn(y.MaxScanLength),
+		); err != nil {
+			return "scan", err
+		}
+		_, err = drainRows(rows)
+		return "scan", err
+	default:
+		var key = w.nextKey()
+		if err = w.read(ctx, db, key); err != nil {
+			return "read-modify-write", err
+		}
+		return "read-modify-write", w.update(ctx, db, key)
+	}
+}
+
+func (w *ycsbWorker) read(ctx context.Context, db *sql.DB, key string) (err error) {
+	var rows *sql.Rows
+	if rows, err = db.QueryContext(ctx,
+		fmt.Sprintf(`SELECT * FROM "%s" WHERE "ycsb_key" = ?`, ycsbTable), key); err != nil {
+		return
+	}
+	// the latest records may be inserting, the missing records are not failures
+	_, err = drainRows(rows)
+	return
+}
+
+func (w *ycsbWorker) update(ctx context.Context, db *sql.DB, key string) (err error) {
+	_, err = db.ExecContext(ctx, fmt.Sprintf(`UPDATE "%s" SET "field%d" = ? WHERE "ycsb_key" = ?`,
+		ycsbTable, w.rnd.Intn(w.y.FieldCount)), randString(w.rnd, w.y.FieldLength), key)
+	return
+}
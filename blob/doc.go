@@ -0,0 +1,30 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+Package blob implements a content-addressed chunk store for large BLOB values.
+
+Large values are split into fixed size chunks which are stored outside the SQLite main file and
+addressed by their hashes. A manifest listing the chunk hashes is stored as a chunk as well, and
+the hash of the manifest is used as the reference of the value. The reference string is stored in
+the database instead of the value itself, so multi-megabyte values don't bloat sqlchain blocks and
+kayak logs.
+
+Chunks are garbage collected by reachability: the caller collects the references still stored
+in the database, and the chunks which are neither reachable from them nor recently written are
+removed from disk.
+*/
+package blob
@@ -0,0 +1,32 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blob
+
+import "errors"
+
+var (
+	// ErrInvalidRef indicates that the blob reference is malformed.
+	ErrInvalidRef = errors.New("invalid blob reference")
+	// ErrChunkNotFound indicates that the chunk is not found in local store.
+	ErrChunkNotFound = errors.New("blob chunk not found")
+	// ErrChunkHashNotMatch indicates that the chunk data does not match its hash.
+	ErrChunkHashNotMatch = errors.New("blob chunk hash not match")
+	// ErrInvalidManifest indicates that the manifest is malformed.
+	ErrInvalidManifest = errors.New("invalid blob manifest")
+	// ErrStoreClosed indicates that the store is already closed.
+	ErrStoreClosed = errors.New("blob store closed")
+)
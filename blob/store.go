@@ -0,0 +1,331 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blob
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/utils"
+)
+
+const (
+	// DefaultChunkSize defines the default chunk size of blob values.
+	DefaultChunkSize = 256 << 10
+
+	// RefPrefix defines the prefix of blob reference strings stored in database.
+	RefPrefix = "cqlblob:"
+
+	chunkDirName = "chunks"
+)
+
+// Manifest defines the chunk list of a blob value.
+type Manifest struct {
+	Size   uint64
+	Chunks []hash.Hash
+}
+
+// EncodeRef returns the reference string of a blob manifest hash.
+func EncodeRef(h hash.Hash) string {
+	return RefPrefix + h.String()
+}
+
+// ParseRef parses the blob manifest hash from a reference string.
+func ParseRef(ref string) (h hash.Hash, err error) {
+	if !IsRef(ref) {
+		err = ErrInvalidRef
+		return
+	}
+	var p *hash.Hash
+	if p, err = hash.NewHashFromStr(strings.TrimPrefix(ref, RefPrefix)); err != nil {
+		err = errors.Wrap(ErrInvalidRef, err.Error())
+		return
+	}
+	h = *p
+	return
+}
+
+// IsRef returns whether the value is a blob reference string.
+func IsRef(v interface{}) bool {
+	var s string
+	switch t := v.(type) {
+	case string:
+		s = t
+	case []byte:
+		s = string(t)
+	default:
+		return false
+	}
+	return strings.HasPrefix(s, RefPrefix) && len(s) == len(RefPrefix)+hash.MaxHashStringSize
+}
+
+// Split splits data into chunks of chunkSize and builds the manifest.
+func Split(data []byte, chunkSize int) (m *Manifest, chunks [][]byte) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	m = &Manifest{
+		Size: uint64(len(data)),
+	}
+	for offset := 0; offset < len(data); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[offset:end]
+		chunks = append(chunks, chunk)
+		m.Chunks = append(m.Chunks, hash.THashH(chunk))
+	}
+	return
+}
+
+// EncodeManifest encodes the manifest to bytes which is stored as a chunk.
+func EncodeManifest(m *Manifest) (data []byte, err error) {
+	buf, err := utils.EncodeMsgPack(m)
+	if err != nil {
+		return
+	}
+	data = buf.Bytes()
+	return
+}
+
+// DecodeManifest decodes the manifest from chunk data.
+func DecodeManifest(data []byte) (m *Manifest, err error) {
+	m = &Manifest{}
+	if err = utils.DecodeMsgPack(data, m); err != nil {
+		err = errors.Wrap(ErrInvalidManifest, err.Error())
+		return
+	}
+	if len(m.Chunks) == 0 && m.Size != 0 {
+		err = ErrInvalidManifest
+	}
+	return
+}
+
+// Store defines a content-addressed chunk store on local disk.
+type Store struct {
+	sync.Mutex
+	root   string
+	closed bool
+}
+
+// NewStore opens or creates a chunk store at the root directory.
+func NewStore(root string) (s *Store, err error) {
+	if err = os.MkdirAll(filepath.Join(root, chunkDirName), 0755); err != nil {
+		return
+	}
+	s = &Store{
+		root: root,
+	}
+	return
+}
+
+func (s *Store) chunkPath(h hash.Hash) string {
+	hs := h.String()
+	return filepath.Join(s.root, chunkDirName, hs[:2], hs)
+}
+
+// HasChunk returns whether the chunk exists in local store.
+func (s *Store) HasChunk(h hash.Hash) bool {
+	return utils.Exist(s.chunkPath(h))
+}
+
+// PutChunk stores a chunk and returns its hash.
+func (s *Store) PutChunk(data []byte) (h hash.Hash, err error) {
+	h = hash.THashH(data)
+	err = s.PutChunkWithHash(h, data)
+	return
+}
+
+// PutChunkWithHash verifies the chunk data against the hash and stores it.
+func (s *Store) PutChunkWithHash(h hash.Hash, data []byte) (err error) {
+	if actual := hash.THashH(data); !actual.IsEqual(&h) {
+		return ErrChunkHashNotMatch
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	path := s.chunkPath(h)
+	if utils.Exist(path) {
+		// refresh the chunk so it's not collected before the value referring to it is committed
+		now := time.Now()
+		return os.Chtimes(path, now, now)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	// write to temp file and rename to make chunk creation atomic
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, path)
+}
+
+// GetChunk reads a chunk from local store and verifies it.
+func (s *Store) GetChunk(h hash.Hash) (data []byte, err error) {
+	if data, err = ioutil.ReadFile(s.chunkPath(h)); err != nil {
+		if os.IsNotExist(err) {
+			err = errors.Wrapf(ErrChunkNotFound, "chunk %s", h.String())
+		}
+		return
+	}
+	if actual := hash.THashH(data); !actual.IsEqual(&h) {
+		err = errors.Wrapf(ErrChunkHashNotMatch, "chunk %s", h.String())
+		data = nil
+	}
+	return
+}
+
+// Put splits the data into chunks, stores all the chunks and the manifest, and returns the
+// reference string of the value.
+func (s *Store) Put(data []byte) (ref string, err error) {
+	var (
+		m, chunks = Split(data, DefaultChunkSize)
+		mdata     []byte
+		mh        hash.Hash
+	)
+	for i, c := range chunks {
+		if err = s.PutChunkWithHash(m.Chunks[i], c); err != nil {
+			return
+		}
+	}
+	if mdata, err = EncodeManifest(m); err != nil {
+		return
+	}
+	if mh, err = s.PutChunk(mdata); err != nil {
+		return
+	}
+	ref = EncodeRef(mh)
+	return
+}
+
+// Manifest loads the manifest of the blob value.
+func (s *Store) Manifest(h hash.Hash) (m *Manifest, err error) {
+	var data []byte
+	if data, err = s.GetChunk(h); err != nil {
+		return
+	}
+	return DecodeManifest(data)
+}
+
+// Missing returns the chunk hashes of the blob value which are not present in local store,
+// including the manifest itself.
+func (s *Store) Missing(h hash.Hash) (missing []hash.Hash, err error) {
+	if !s.HasChunk(h) {
+		missing = append(missing, h)
+		return
+	}
+	var m *Manifest
+	if m, err = s.Manifest(h); err != nil {
+		return
+	}
+	for _, c := range m.Chunks {
+		if !s.HasChunk(c) {
+			missing = append(missing, c)
+		}
+	}
+	return
+}
+
+// Get reads the whole blob value of the reference string.
+func (s *Store) Get(ref string) (data []byte, err error) {
+	var (
+		h hash.Hash
+		m *Manifest
+	)
+	if h, err = ParseRef(ref); err != nil {
+		return
+	}
+	if m, err = s.Manifest(h); err != nil {
+		return
+	}
+	data = make([]byte, 0, m.Size)
+	for _, c := range m.Chunks {
+		var chunk []byte
+		if chunk, err = s.GetChunk(c); err != nil {
+			data = nil
+			return
+		}
+		data = append(data, chunk...)
+	}
+	if uint64(len(data)) != m.Size {
+		err = ErrInvalidManifest
+		data = nil
+	}
+	return
+}
+
+// Collect removes the chunks which are not reachable from the live blob values, chunks written
+// or refreshed within grace are kept since they may belong to a value not committed yet. The
+// manifests of the live values must be present in local store, otherwise nothing is removed.
+func (s *Store) Collect(live []hash.Hash, grace time.Duration) (removed int, err error) {
+	var reachable = make(map[string]struct{})
+	for _, h := range live {
+		var m *Manifest
+		if m, err = s.Manifest(h); err != nil {
+			return
+		}
+		reachable[h.String()] = struct{}{}
+		for _, c := range m.Chunks {
+			reachable[c.String()] = struct{}{}
+		}
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		err = ErrStoreClosed
+		return
+	}
+	var deadline = time.Now().Add(-grace)
+	err = filepath.Walk(filepath.Join(s.root, chunkDirName), func(
+		path string, info os.FileInfo, err error,
+	) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if _, ok := reachable[info.Name()]; ok || info.ModTime().After(deadline) {
+			return nil
+		}
+		if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		removed++
+		return nil
+	})
+	return
+}
+
+// Close closes the chunk store.
+func (s *Store) Close() (err error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	return
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blob
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+)
+
+func TestStore(t *testing.T) {
+	Convey("Given a new blob store", t, func() {
+		dir, err := ioutil.TempDir("", "blob")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		s, err := NewStore(dir)
+		So(err, ShouldBeNil)
+		defer s.Close()
+
+		var data = make([]byte, DefaultChunkSize*2+100)
+		rand.Read(data)
+		// duplicated chunk
+		copy(data[DefaultChunkSize:], data[:DefaultChunkSize])
+
+		Convey("The value should be stored and read by reference", func() {
+			ref, err := s.Put(data)
+			So(err, ShouldBeNil)
+			So(IsRef(ref), ShouldBeTrue)
+			So(IsRef([]byte(ref)), ShouldBeTrue)
+			So(IsRef("plain text"), ShouldBeFalse)
+			out, err := s.Get(ref)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(out, data), ShouldBeTrue)
+
+			h, err := ParseRef(ref)
+			So(err, ShouldBeNil)
+			missing, err := s.Missing(h)
+			So(err, ShouldBeNil)
+			So(missing, ShouldBeEmpty)
+			m, err := s.Manifest(h)
+			So(err, ShouldBeNil)
+			So(len(m.Chunks), ShouldEqual, 3)
+
+			Convey("The unreachable chunks should be collected", func() {
+				other, err := s.PutChunk([]byte("orphan"))
+				So(err, ShouldBeNil)
+				removed, err := s.Collect([]hash.Hash{h}, time.Hour)
+				So(err, ShouldBeNil)
+				So(removed, ShouldEqual, 0)
+				So(s.HasChunk(other), ShouldBeTrue)
+
+				removed, err = s.Collect([]hash.Hash{h}, 0)
+				So(err, ShouldBeNil)
+				So(removed, ShouldEqual, 1)
+				So(s.HasChunk(other), ShouldBeFalse)
+				So(s.HasChunk(m.Chunks[0]), ShouldBeTrue)
+				out, err := s.Get(ref)
+				So(err, ShouldBeNil)
+				So(bytes.Equal(out, data), ShouldBeTrue)
+
+				removed, err = s.Collect(nil, 0)
+				So(err, ShouldBeNil)
+				So(removed, ShouldEqual, 3)
+				So(s.HasChunk(h), ShouldBeFalse)
+				_, err = s.Get(ref)
+				So(errors.Cause(err), ShouldEqual, ErrChunkNotFound)
+			})
+			Convey("The live values with missing manifests should stop collection", func() {
+				missing := hash.THashH([]byte("missing"))
+				_, err := s.Collect([]hash.Hash{h, missing}, 0)
+				So(errors.Cause(err), ShouldEqual, ErrChunkNotFound)
+				So(s.HasChunk(h), ShouldBeTrue)
+			})
+		})
+		Convey("Corrupted chunks should be rejected", func() {
+			h, err := s.PutChunk([]byte("chunk"))
+			So(err, ShouldBeNil)
+			err = s.PutChunkWithHash(h, []byte("corrupted"))
+			So(err, ShouldEqual, ErrChunkHashNotMatch)
+			So(ioutil.WriteFile(s.chunkPath(h), []byte("corrupted"), 0644), ShouldBeNil)
+			_, err = s.GetChunk(h)
+			So(errors.Cause(err), ShouldEqual, ErrChunkHashNotMatch)
+		})
+		Convey("Invalid references should be rejected", func() {
+			_, err := ParseRef("cqlblob:xyz")
+			So(err, ShouldEqual, ErrInvalidRef)
+			_, err = s.Get(RefPrefix + "zz")
+			So(err, ShouldEqual, ErrInvalidRef)
+		})
+	})
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package blockproducer
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+const (
+	// DefaultActivityPageSize is the activity count returned if the request sets no limit.
+	DefaultActivityPageSize = 50
+	// MaxActivityPageSize is the max activity count returned in a page.
+	MaxActivityPageSize = 500
+)
+
+// txActivities returns the activities of the accounts involved in the transaction.
+func txActivities(t pi.Transaction) (acts []*types.Activity) {
+	switch tx := t.(type) {
+	case *types.Transfer:
+		acts = append(acts, &types.Activity{
+			Kind:         types.ActivityTransferOut,
+			Account:      tx.Sender,
+			Counterparty: tx.Receiver,
+			Amount:       tx.Amount,
+			TokenType:    tx.TokenType,
+		}, &types.Activity{
+			Kind:         types.ActivityTransferIn,
+			Account:      tx.Receiver,
+			Counterparty: tx.Sender,
+			Amount:       tx.Amount,
+			TokenType:    tx.TokenType,
+		})
+	case *types.TransferBatch:
+		for _, r := range tx.Receivers {
+			acts = append(acts, &types.Activity{
+				Kind:         types.ActivityTransferOut,
+				Account:      tx.Sender,
+				Counterparty: r.Receiver,
+				Amount:       r.Amount,
+				TokenType:    tx.TokenType,
+			}, &types.Activity{
+				Kind:         types.ActivityTransferIn,
+				Account:      r.Receiver,
+				Counterparty: tx.Sender,
+				Amount:       r.Amount,
+				TokenType:    tx.TokenType,
+			})
+		}
+	case *types.CreateDatabase:
+		acts = append(acts, &types.Activity{
+			Kind:       types.ActivityCreateDatabase,
+			Account:    tx.Owner,
+			DatabaseID: proto.FromAccountAndNonce(tx.Owner, uint32(tx.Nonce)),
+			Amount:     tx.AdvancePayment,
+			TokenType:  tx.TokenType,
+		})
+	case *types.UpdatePermission:
+		var (
+			sender = tx.GetAccountAddress()
+			dbID   = tx.TargetSQLChain.DatabaseID()
+			role   types.UserPermissionRole
+		)
+		if tx.Permission != nil {
+			role = tx.Permission.Role
+		}
+		acts = append(acts, &types.Activity{
+			Kind:         types.ActivityPermissionGranted,
+			Account:      sender,
+			Counterparty: tx.TargetUser,
+			DatabaseID:   dbID,
+			Role:         role,
+		}, &types.Activity{
+			Kind:         types.ActivityPermissionReceived,
+			Account:      tx.TargetUser,
+			Counterparty: sender,
+			DatabaseID:   dbID,
+			Role:         role,
+		})
+	case *types.MultiSig:
+		// the inner transaction is sent on behalf of the multi-signature account
+		var addr = tx.GetAccountAddress()
+		if tx.Tx.Transaction == nil {
+			return
+		}
+		for _, act := range txActivities(tx.Tx.Unwrap()) {
+			if act.Account == (proto.AccountAddress{}) {
+				act.Account = addr
+			}
+			if act.Counterparty == (proto.AccountAddress{}) {
+				act.Counterparty = addr
+			}
+			acts = append(acts, act)
+		}
+	case *types.UpdateBilling:
+		var dbID = tx.Receiver.DatabaseID()
+		for _, user := range tx.Users {
+			acts = append(acts, &types.Activity{
+				Kind:         types.ActivityBillingCharge,
+				Account:      user.User,
+				Counterparty: tx.Receiver,
+				DatabaseID:   dbID,
+				Amount:       user.Cost,
+			})
+			for _, miner := range user.Miners {
+				acts = append(acts, &types.Activity{
+					Kind:         types.ActivityBillingIncome,
+					Account:      miner.Miner,
+					Counterparty: user.User,
+					DatabaseID:   dbID,
+					Amount:       miner.Income,
+				})
+			}
+		}
+	}
+	return
+}
+
+func indexActivities(tx *sql.Tx, height uint32, txIndex int, t pi.Transaction) (err error) {
+	// a transaction may produce several activities of the same kind for an account, e.g. the
+	// billing income of a miner serving several users, so they are keyed by the ordinal
+	for i, act := range txActivities(t) {
+		var counterparty string
+		if act.Counterparty != (proto.AccountAddress{}) {
+			counterparty = act.Counterparty.String()
+		}
+		if _, err = tx.Exec(`INSERT OR REPLACE INTO "indexed_activities"
+			("block_height", "tx_index", "ordinal", "account", "kind", "counterparty", "db_id",
+			"amount", "token_type", "role", "hash", "timestamp") VALUES (?,?,?,?,?,?,?,?,?,?,?,?)`,
+			height,
+			txIndex,
+			i,
+			act.Account.String(),
+			string(act.Kind),
+			counterparty,
+			string(act.DatabaseID),
+			int64(act.Amount),
+			int32(act.TokenType),
+			int32(act.Role),
+			t.Hash().String(),
+			t.GetTimestamp().UnixNano(),
+		); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (c *Chain) queryAccountActivities(req *types.QueryAccountActivitiesReq) (
+	acts []*types.Activity, next uint64, err error,
+) {
+	var (
+		limit    = req.Limit
+		conds    = []string{`"account" = ?`}
+		args     = []interface{}{req.Addr.String()}
+		querySQL string
+		rows     *sql.Rows
+	)
+	if limit <= 0 {
+		limit = DefaultActivityPageSize
+	}
+	if limit > MaxActivityPageSize {
+		limit = MaxActivityPageSize
+	}
+	if req.Before > 0 {
+		conds = append(conds, `"id" < ?`)
+		args = append(args, int64(req.Before))
+	}
+	if len(req.Kinds) > 0 {
+		conds = append(conds, `"kind" IN (?`+strings.Repeat(`, ?`, len(req.Kinds)-1)+`)`)
+		for _, k := range req.Kinds {
+			args = append(args, string(k))
+		}
+	}
+	querySQL = `SELECT "id", "block_height", "kind", "counterparty", "db_id", "amount",
+	"token_type", "role", "hash", "timestamp" FROM "indexed_activities" WHERE ` +
+		strings.Join(conds, " AND ") + ` ORDER BY "id" DESC LIMIT ?`
+	args = append(args, limit)
+
+	c.RLock()
+	defer c.RUnlock()
+	if rows, err = c.storage.Reader().Query(querySQL, args...); err != nil {
+		err = errors.Wrap(err, "query account activities failed")
+		return
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var (
+			act                              = &types.Activity{Account: req.Addr}
+			id, amount, ts                   int64
+			kind, counterparty, dbID, txHash string
+			tokenType, role                  int32
+		)
+		if err = rows.Scan(&id, &act.Height, &kind, &counterparty, &dbID, &amount,
+			&tokenType, &role, &txHash, &ts,
+		); err != nil {
+			return
+		}
+		if counterparty != "" {
+			var h hash.Hash
+			if err = hash.Decode(&h, counterparty); err != nil {
+				return
+			}
+			act.Counterparty = proto.AccountAddress(h)
+		}
+		if err = hash.Decode(&act.TxHash, txHash); err != nil {
+			return
+		}
+		act.ID = uint64(id)
+		act.Kind = types.ActivityKind(kind)
+		act.DatabaseID = proto.DatabaseID(dbID)
+		act.Amount = uint64(amount)
+		act.TokenType = types.TokenType(tokenType)
+		act.Role = types.UserPermissionRole(role)
+		act.Timestamp = time.Unix(0, ts).UTC()
+		acts = append(acts, act)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	if len(acts) == limit {
+		next = acts[len(acts)-1].ID
+	}
+	return
+}
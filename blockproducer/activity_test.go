@@ -0,0 +1,150 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package blockproducer
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestAccountActivities(t *testing.T) {
+	Convey("Given an activity index with transfers and permission grants", t, func() {
+		dir, err := ioutil.TempDir("", "bp_activities")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		st, err := openStorage(filepath.Join(dir, "chain.db"))
+		So(err, ShouldBeNil)
+		defer st.Close()
+
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		addr1, err := crypto.PubKeyHash(priv.PubKey())
+		So(err, ShouldBeNil)
+		var (
+			addr2 = proto.AccountAddress{0x02}
+			db    = proto.AccountAddress{0x03}
+			chain = &Chain{storage: st}
+			txs   []pi.Transaction
+		)
+		for i := 0; i < 3; i++ {
+			txs = append(txs, types.NewTransfer(&types.TransferHeader{
+				Sender:   addr1,
+				Receiver: addr2,
+				Nonce:    pi.AccountNonce(i),
+				Amount:   uint64(i + 1),
+			}))
+		}
+		up := types.NewUpdatePermission(&types.UpdatePermissionHeader{
+			TargetSQLChain: db,
+			TargetUser:     addr2,
+			Permission:     types.UserPermissionFromRole(types.Read),
+			Nonce:          3,
+		})
+		So(up.Sign(priv), ShouldBeNil)
+		txs = append(txs, up)
+		So(store(st, []storageProcedure{func(tx *sql.Tx) error {
+			for i, t := range txs {
+				if err := indexActivities(tx, 1, i, t); err != nil {
+					return err
+				}
+			}
+			return nil
+		}}, nil), ShouldBeNil)
+
+		Convey("The feed should list both sides of the transactions newest first", func() {
+			acts, next, err := chain.queryAccountActivities(
+				&types.QueryAccountActivitiesReq{Addr: addr2})
+			So(err, ShouldBeNil)
+			So(next, ShouldEqual, 0)
+			So(acts, ShouldHaveLength, 4)
+			So(acts[0].Kind, ShouldEqual, types.ActivityPermissionReceived)
+			So(acts[0].Counterparty, ShouldResemble, addr1)
+			So(acts[0].DatabaseID, ShouldEqual, db.DatabaseID())
+			So(acts[0].Role, ShouldEqual, types.Read)
+			So(acts[0].TxHash, ShouldResemble, up.Hash())
+			So(acts[1].Kind, ShouldEqual, types.ActivityTransferIn)
+			So(acts[1].Amount, ShouldEqual, 3)
+			So(acts[1].Height, ShouldEqual, 1)
+		})
+		Convey("The feed should be filtered by kinds and paged by cursor", func() {
+			req := &types.QueryAccountActivitiesReq{
+				Addr:  addr1,
+				Kinds: []types.ActivityKind{types.ActivityTransferOut},
+				Limit: 2,
+			}
+			acts, next, err := chain.queryAccountActivities(req)
+			So(err, ShouldBeNil)
+			So(acts, ShouldHaveLength, 2)
+			So(acts[0].Amount, ShouldEqual, 3)
+			So(acts[1].Amount, ShouldEqual, 2)
+			So(next, ShouldEqual, acts[1].ID)
+
+			req.Before = next
+			acts, next, err = chain.queryAccountActivities(req)
+			So(err, ShouldBeNil)
+			So(acts, ShouldHaveLength, 1)
+			So(acts[0].Kind, ShouldEqual, types.ActivityTransferOut)
+			So(acts[0].Counterparty, ShouldResemble, addr2)
+			So(acts[0].Amount, ShouldEqual, 1)
+			So(next, ShouldEqual, 0)
+		})
+		Convey("The activities of the same kind in a transaction should all be kept", func() {
+			batch := types.NewTransferBatch(&types.TransferBatchHeader{
+				Sender: addr1,
+				Receivers: []types.TransferReceiver{
+					{Receiver: addr2, Amount: 4},
+					{Receiver: db, Amount: 5},
+				},
+				Nonce: 4,
+			})
+			So(store(st, []storageProcedure{func(tx *sql.Tx) error {
+				return indexActivities(tx, 2, 0, batch)
+			}}, nil), ShouldBeNil)
+			acts, _, err := chain.queryAccountActivities(&types.QueryAccountActivitiesReq{
+				Addr:  addr1,
+				Kinds: []types.ActivityKind{types.ActivityTransferOut},
+			})
+			So(err, ShouldBeNil)
+			So(acts, ShouldHaveLength, 5)
+			So(acts[0].Height, ShouldEqual, 2)
+			So(acts[0].Counterparty, ShouldResemble, db)
+			So(acts[1].Height, ShouldEqual, 2)
+			So(acts[1].Counterparty, ShouldResemble, addr2)
+
+			// indexing the block again should not duplicate the activities
+			So(store(st, []storageProcedure{func(tx *sql.Tx) error {
+				return indexActivities(tx, 2, 0, batch)
+			}}, nil), ShouldBeNil)
+			acts, _, err = chain.queryAccountActivities(&types.QueryAccountActivitiesReq{
+				Addr:  addr1,
+				Kinds: []types.ActivityKind{types.ActivityTransferOut},
+			})
+			So(err, ShouldBeNil)
+			So(acts, ShouldHaveLength, 5)
+		})
+	})
+}
@@ -0,0 +1,469 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"bytes"
+	"database/sql"
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	mw "github.com/zserge/metric"
+
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+	"github.com/SQLess/SQLess/utils/log"
+	xi "github.com/SQLess/SQLess/xenomint/interfaces"
+)
+
+const (
+	// MaxAuditedBillingRanges defines the max count of recent billing periods audited per database.
+	MaxAuditedBillingRanges = 8
+	// MaxBillingMismatches defines the max count of mismatches kept per database.
+	MaxBillingMismatches = 128
+
+	mwKeyBillingMismatch = "service:bp:billing:mismatch"
+)
+
+func init() {
+	expvar.Publish(mwKeyBillingMismatch, mw.NewCounter("5m1m"))
+}
+
+// auditedCosts defines the per-user costs of a billing period reported by an account.
+type auditedCosts struct {
+	Account proto.AccountAddress
+	Users   []*types.UserCost // ordered by user address
+	Checked bool
+}
+
+// billingRound defines the statements and the billed costs of a billing period, it's persisted
+// in the "billing_rounds" table of the block producer storage.
+type billingRound struct {
+	Owner      proto.AccountAddress
+	Statements []*auditedCosts // ordered by miner address
+	Billed     *auditedCosts   // nil if not billed yet
+	BilledTx   hash.Hash
+	BilledAt   uint32 // height of the block of the UpdateBilling transaction
+}
+
+func userCosts(users []*types.UserCost) (costs []*types.UserCost) {
+	var m = make(map[proto.AccountAddress]uint64)
+	for _, u := range users {
+		m[u.User] += u.Cost
+	}
+	for u, c := range m {
+		costs = append(costs, &types.UserCost{User: u, Cost: c})
+	}
+	sort.Slice(costs, func(i, j int) bool { return bytes.Compare(costs[i].User[:], costs[j].User[:]) < 0 })
+	return
+}
+
+func costOf(costs []*types.UserCost, user proto.AccountAddress) uint64 {
+	for _, c := range costs {
+		if c.User == user {
+			return c.Cost
+		}
+	}
+	return 0
+}
+
+// billingAudit validates the miner signed billing statements against the UpdateBilling
+// transactions of the same billing period confirmed by the chain. The rounds and the mismatches
+// are persisted, and each mismatch is added to the activity feed of the database owner.
+type billingAudit struct {
+	sync.Mutex
+	st         xi.Storage // nil to keep the audit in memory only
+	rounds     map[proto.DatabaseID]map[types.Range]*billingRound
+	mismatches map[proto.DatabaseID][]*types.BillingMismatch
+	now        func() time.Time
+}
+
+func newBillingAudit(st xi.Storage) (a *billingAudit, err error) {
+	a = &billingAudit{
+		st:         st,
+		rounds:     make(map[proto.DatabaseID]map[types.Range]*billingRound),
+		mismatches: make(map[proto.DatabaseID][]*types.BillingMismatch),
+		now:        time.Now,
+	}
+	if st != nil {
+		err = a.load()
+	}
+	return
+}
+
+func (a *billingAudit) load() (err error) {
+	var rows *sql.Rows
+	if rows, err = a.st.Reader().Query(
+		`SELECT "db_id", "from", "to", "encoded" FROM "billing_rounds"`); err != nil {
+		return
+	}
+	for rows.Next() {
+		var (
+			dbID string
+			r    types.Range
+			enc  []byte
+			br   = new(billingRound)
+		)
+		if err = rows.Scan(&dbID, &r.From, &r.To, &enc); err != nil {
+			_ = rows.Close()
+			return
+		}
+		if err = utils.DecodeMsgPack(enc, br); err != nil {
+			_ = rows.Close()
+			return
+		}
+		rounds, ok := a.rounds[proto.DatabaseID(dbID)]
+		if !ok {
+			rounds = make(map[types.Range]*billingRound)
+			a.rounds[proto.DatabaseID(dbID)] = rounds
+		}
+		rounds[r] = br
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	_ = rows.Close()
+	if rows, err = a.st.Reader().Query(
+		`SELECT "db_id", "encoded" FROM "billing_mismatches" ORDER BY "id"`); err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var (
+			dbID string
+			enc  []byte
+			m    = new(types.BillingMismatch)
+		)
+		if err = rows.Scan(&dbID, &enc); err != nil {
+			return
+		}
+		if err = utils.DecodeMsgPack(enc, m); err != nil {
+			return
+		}
+		a.mismatches[proto.DatabaseID(dbID)] = append(a.mismatches[proto.DatabaseID(dbID)], m)
+	}
+	return rows.Err()
+}
+
+func (a *billingAudit) round(
+	dbID proto.DatabaseID, r types.Range, sps []storageProcedure) (br *billingRound, _ []storageProcedure,
+) {
+	rounds, ok := a.rounds[dbID]
+	if !ok {
+		rounds = make(map[types.Range]*billingRound)
+		a.rounds[dbID] = rounds
+	}
+	if br, ok = rounds[r]; !ok {
+		br = &billingRound{}
+		rounds[r] = br
+		// evict the oldest rounds
+		if len(rounds) > MaxAuditedBillingRanges {
+			var oldest = r
+			for k := range rounds {
+				if k.To < oldest.To {
+					oldest = k
+				}
+			}
+			delete(rounds, oldest)
+			sps = append(sps, deleteBillingRound(dbID, oldest))
+		}
+	}
+	return br, sps
+}
+
+// addStatement records the statement signed by miner of the database owned by owner.
+func (a *billingAudit) addStatement(
+	owner, miner proto.AccountAddress, s *types.SignedBillingStatement) (err error,
+) {
+	a.Lock()
+	defer a.Unlock()
+	var (
+		sps []storageProcedure
+		br  *billingRound
+	)
+	br, sps = a.round(s.DatabaseID, s.Range, sps)
+	br.Owner = owner
+	var costs = &auditedCosts{Account: miner, Users: userCosts(s.Users)}
+	var i = sort.Search(len(br.Statements), func(i int) bool {
+		return bytes.Compare(br.Statements[i].Account[:], miner[:]) >= 0
+	})
+	if i < len(br.Statements) && br.Statements[i].Account == miner {
+		br.Statements[i] = costs
+	} else {
+		br.Statements = append(br.Statements, nil)
+		copy(br.Statements[i+1:], br.Statements[i:])
+		br.Statements[i] = costs
+	}
+	sps = a.check(s.DatabaseID, s.Range, br, sps)
+	return a.store(append(sps, updateBillingRound(s.DatabaseID, s.Range, br)))
+}
+
+// addBilling records the costs of the UpdateBilling transaction confirmed at height.
+func (a *billingAudit) addBilling(
+	owner proto.AccountAddress, height uint32, ub *types.UpdateBilling) (err error,
+) {
+	a.Lock()
+	defer a.Unlock()
+	var (
+		dbID = ub.Receiver.DatabaseID()
+		sps  []storageProcedure
+		br   *billingRound
+	)
+	br, sps = a.round(dbID, ub.Range, sps)
+	if br.Billed != nil && br.BilledTx == ub.Hash() {
+		return
+	}
+	br.Owner = owner
+	br.Billed = &auditedCosts{Account: ub.GetAccountAddress(), Users: userCosts(ub.Users)}
+	br.BilledTx = ub.Hash()
+	br.BilledAt = height
+	for _, s := range br.Statements {
+		s.Checked = false
+	}
+	sps = a.check(dbID, ub.Range, br, sps)
+	return a.store(append(sps, updateBillingRound(dbID, ub.Range, br)))
+}
+
+func (a *billingAudit) store(sps []storageProcedure) error {
+	if a.st == nil {
+		return nil
+	}
+	return store(a.st, sps, nil)
+}
+
+// check compares the unchecked statements of the round with the billed costs.
+func (a *billingAudit) check(
+	dbID proto.DatabaseID, r types.Range, br *billingRound, sps []storageProcedure,
+) []storageProcedure {
+	if br.Billed == nil {
+		return sps
+	}
+	for _, s := range br.Statements {
+		if s.Checked {
+			continue
+		}
+		s.Checked = true
+		var users = make(map[proto.AccountAddress]bool)
+		for _, u := range s.Users {
+			users[u.User] = true
+		}
+		for _, u := range br.Billed.Users {
+			users[u.User] = true
+		}
+		var sorted []proto.AccountAddress
+		for u := range users {
+			sorted = append(sorted, u)
+		}
+		sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i][:], sorted[j][:]) < 0 })
+		for _, u := range sorted {
+			if sc, bc := costOf(s.Users, u), costOf(br.Billed.Users, u); sc != bc {
+				sps = a.addMismatch(br, &types.BillingMismatch{
+					DatabaseID:    dbID,
+					Range:         r,
+					Miner:         s.Account,
+					Biller:        br.Billed.Account,
+					User:          u,
+					StatementCost: sc,
+					BilledCost:    bc,
+					Detected:      a.now().UTC(),
+				}, sps)
+			}
+		}
+	}
+	return sps
+}
+
+func (a *billingAudit) addMismatch(
+	br *billingRound, m *types.BillingMismatch, sps []storageProcedure,
+) []storageProcedure {
+	log.WithFields(log.Fields{
+		"db":             m.DatabaseID,
+		"from":           m.Range.From,
+		"to":             m.Range.To,
+		"miner":          m.Miner,
+		"biller":         m.Biller,
+		"user":           m.User,
+		"statement_cost": m.StatementCost,
+		"billed_cost":    m.BilledCost,
+	}).Warning("billing statement mismatch detected")
+	expvar.Get(mwKeyBillingMismatch).(mw.Metric).Add(1)
+	list := append(a.mismatches[m.DatabaseID], m)
+	if len(list) > MaxBillingMismatches {
+		list = list[len(list)-MaxBillingMismatches:]
+	}
+	a.mismatches[m.DatabaseID] = list
+	return append(sps, addBillingMismatch(br, m))
+}
+
+func (a *billingAudit) getMismatches(dbID proto.DatabaseID) (list []*types.BillingMismatch) {
+	a.Lock()
+	defer a.Unlock()
+	return append(list, a.mismatches[dbID]...)
+}
+
+func updateBillingRound(dbID proto.DatabaseID, r types.Range, br *billingRound) storageProcedure {
+	var (
+		enc *bytes.Buffer
+		err error
+	)
+	if enc, err = utils.EncodeMsgPack(br); err != nil {
+		return errPass(err)
+	}
+	return func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(`INSERT OR REPLACE INTO "billing_rounds" ("db_id", "from", "to", "encoded")
+	VALUES (?, ?, ?, ?)`, string(dbID), r.From, r.To, enc.Bytes())
+		return
+	}
+}
+
+func deleteBillingRound(dbID proto.DatabaseID, r types.Range) storageProcedure {
+	return func(tx *sql.Tx) (err error) {
+		_, err = tx.Exec(`DELETE FROM "billing_rounds" WHERE "db_id"=? AND "from"=? AND "to"=?`,
+			string(dbID), r.From, r.To)
+		return
+	}
+}
+
+// addBillingMismatch persists the mismatch and adds it to the activity feed of the database
+// owner, keyed by the mismatch id as it is not a transaction of the block.
+func addBillingMismatch(br *billingRound, m *types.BillingMismatch) storageProcedure {
+	var (
+		enc *bytes.Buffer
+		err error
+	)
+	if enc, err = utils.EncodeMsgPack(m); err != nil {
+		return errPass(err)
+	}
+	return func(tx *sql.Tx) (err error) {
+		var (
+			res sql.Result
+			id  int64
+		)
+		if res, err = tx.Exec(`INSERT INTO "billing_mismatches" ("db_id", "encoded") VALUES (?, ?)`,
+			string(m.DatabaseID), enc.Bytes()); err != nil {
+			return
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return
+		}
+		if _, err = tx.Exec(`DELETE FROM "billing_mismatches" WHERE "db_id"=? AND "id" NOT IN (
+	SELECT "id" FROM "billing_mismatches" WHERE "db_id"=? ORDER BY "id" DESC LIMIT ?)`,
+			string(m.DatabaseID), string(m.DatabaseID), MaxBillingMismatches); err != nil {
+			return
+		}
+		if br.Owner == (proto.AccountAddress{}) {
+			return
+		}
+		_, err = tx.Exec(`INSERT OR REPLACE INTO "indexed_activities"
+			("block_height", "tx_index", "ordinal", "account", "kind", "counterparty", "db_id",
+			"amount", "token_type", "role", "hash", "timestamp") VALUES (?,?,?,?,?,?,?,?,?,?,?,?)`,
+			br.BilledAt,
+			-1,
+			id,
+			br.Owner.String(),
+			string(types.ActivityBillingMismatch),
+			m.Miner.String(),
+			string(m.DatabaseID),
+			int64(m.BilledCost),
+			0,
+			0,
+			br.BilledTx.String(),
+			m.Detected.UnixNano(),
+		)
+		return
+	}
+}
+
+// submitBillingStatement verifies the statement signed by a miner of the database.
+func (c *Chain) submitBillingStatement(s *types.SignedBillingStatement) (err error) {
+	var miner proto.AccountAddress
+	if err = s.Verify(); err != nil {
+		return
+	}
+	if miner, err = crypto.PubKeyHash(s.Signee); err != nil {
+		return
+	}
+	profile, ok := c.loadSQLChainProfile(s.DatabaseID)
+	if !ok {
+		return ErrDatabaseNotFound
+	}
+	var isMiner bool
+	for _, m := range profile.Miners {
+		isMiner = isMiner || m.Address == miner
+	}
+	if !isMiner {
+		return ErrInvalidSender
+	}
+	return c.billingAudit.addStatement(profile.Owner, miner, s)
+}
+
+// auditBilling audits the UpdateBilling transactions of the new irreversible blocks, it's called
+// with the chain locked.
+func (c *Chain) auditBilling(blocks []*blockNode) {
+	for _, b := range blocks {
+		for _, tx := range b.load().Transactions {
+			ub, ok := tx.(*types.UpdateBilling)
+			if !ok {
+				continue
+			}
+			var owner proto.AccountAddress
+			if profile, ok := c.immutable.loadSQLChainObject(ub.Receiver.DatabaseID()); ok {
+				owner = profile.Owner
+			}
+			if err := c.billingAudit.addBilling(owner, b.height, ub); err != nil {
+				log.WithError(err).WithField("tx", ub.Hash()).Error("failed to audit billing")
+			}
+		}
+	}
+}
+
+// queryBillingMismatches returns the mismatches of the database to its owner or miners.
+func (c *Chain) queryBillingMismatches(
+	caller proto.NodeID, dbID proto.DatabaseID) (list []*types.BillingMismatch, err error,
+) {
+	var (
+		pub  *asymmetric.PublicKey
+		addr proto.AccountAddress
+	)
+	if pub, err = kms.GetPublicKey(caller); err != nil {
+		return nil, errors.Wrapf(ErrAccountPermissionDeny, "unknown node %s", caller)
+	}
+	if addr, err = crypto.PubKeyHash(pub); err != nil {
+		return
+	}
+	profile, ok := c.loadSQLChainProfile(dbID)
+	if !ok {
+		return nil, ErrDatabaseNotFound
+	}
+	var allowed = profile.Owner == addr
+	for _, m := range profile.Miners {
+		allowed = allowed || m.Address == addr
+	}
+	if !allowed {
+		return nil, errors.Wrapf(ErrAccountPermissionDeny,
+			"%s is neither the owner nor a miner of database %s", addr, dbID)
+	}
+	return c.billingAudit.getMismatches(dbID), nil
+}
@@ -0,0 +1,125 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestBillingAudit(t *testing.T) {
+	Convey("Given a persisted billing audit of a database", t, func() {
+		dir, err := ioutil.TempDir("", "bp_billing_audit")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		st, err := openStorage(filepath.Join(dir, "chain.db"))
+		So(err, ShouldBeNil)
+		defer st.Close()
+		audit, err := newBillingAudit(st)
+		So(err, ShouldBeNil)
+
+		minerKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		miner, err := crypto.PubKeyHash(minerKey.PubKey())
+		So(err, ShouldBeNil)
+		var (
+			owner = proto.AccountAddress{0x01}
+			user  = proto.AccountAddress{0x02}
+			db    = proto.AccountAddress{0x03}
+			dbID  = db.DatabaseID()
+			r     = types.Range{From: 0, To: 10}
+			ub    = types.NewUpdateBilling(&types.UpdateBillingHeader{
+				Receiver: db,
+				Users:    []*types.UserCost{{User: user, Cost: 100}},
+				Range:    r,
+			})
+			statement = func(cost uint64) *types.SignedBillingStatement {
+				s := &types.SignedBillingStatement{BillingStatementHeader: types.BillingStatementHeader{
+					DatabaseID: dbID,
+					Range:      r,
+					Users:      []*types.UserCost{{User: user, Cost: cost}},
+				}}
+				So(s.Sign(minerKey), ShouldBeNil)
+				return s
+			}
+		)
+		So(ub.Sign(minerKey), ShouldBeNil)
+
+		Convey("The matching statement should not be reported", func() {
+			So(audit.addStatement(owner, miner, statement(100)), ShouldBeNil)
+			So(audit.addBilling(owner, 5, ub), ShouldBeNil)
+			So(audit.getMismatches(dbID), ShouldBeEmpty)
+		})
+		Convey("The mismatch should be reported once whatever comes first", func() {
+			So(audit.addBilling(owner, 5, ub), ShouldBeNil)
+			So(audit.addStatement(owner, miner, statement(90)), ShouldBeNil)
+			// the confirmed billing may be audited again, e.g. after a restart
+			So(audit.addBilling(owner, 5, ub), ShouldBeNil)
+			list := audit.getMismatches(dbID)
+			So(list, ShouldHaveLength, 1)
+			So(list[0].Miner, ShouldResemble, miner)
+			So(list[0].User, ShouldResemble, user)
+			So(list[0].StatementCost, ShouldEqual, 90)
+			So(list[0].BilledCost, ShouldEqual, 100)
+
+			Convey("The audit should survive a restart", func() {
+				reloaded, err := newBillingAudit(st)
+				So(err, ShouldBeNil)
+				So(reloaded.getMismatches(dbID), ShouldHaveLength, 1)
+				So(reloaded.getMismatches(dbID)[0].StatementCost, ShouldEqual, 90)
+				So(reloaded.addBilling(owner, 5, ub), ShouldBeNil)
+				So(reloaded.getMismatches(dbID), ShouldHaveLength, 1)
+				// a corrected statement matches the billed costs
+				So(reloaded.addStatement(owner, miner, statement(100)), ShouldBeNil)
+				So(reloaded.getMismatches(dbID), ShouldHaveLength, 1)
+			})
+			Convey("The mismatch should be in the activity feed of the owner", func() {
+				acts, _, err := (&Chain{storage: st}).queryAccountActivities(
+					&types.QueryAccountActivitiesReq{Addr: owner})
+				So(err, ShouldBeNil)
+				So(acts, ShouldHaveLength, 1)
+				So(acts[0].Kind, ShouldEqual, types.ActivityBillingMismatch)
+				So(acts[0].Counterparty, ShouldResemble, miner)
+				So(acts[0].DatabaseID, ShouldEqual, dbID)
+				So(acts[0].Amount, ShouldEqual, 100)
+				So(acts[0].TxHash, ShouldResemble, ub.Hash())
+				So(acts[0].Height, ShouldEqual, 5)
+			})
+		})
+		Convey("The audited rounds and mismatches should be bounded", func() {
+			for i := 0; i < MaxAuditedBillingRanges+2; i++ {
+				var s = statement(1)
+				s.Range = types.Range{From: uint32(i * 10), To: uint32(i*10 + 10)}
+				So(s.Sign(minerKey), ShouldBeNil)
+				So(audit.addStatement(owner, miner, s), ShouldBeNil)
+			}
+			So(audit.rounds[dbID], ShouldHaveLength, MaxAuditedBillingRanges)
+			var count int
+			So(st.Reader().QueryRow(`SELECT COUNT(*) FROM "billing_rounds"`).Scan(&count), ShouldBeNil)
+			So(count, ShouldEqual, MaxAuditedBillingRanges)
+		})
+	})
+}
@@ -111,8 +111,9 @@ func (b *branch) makeArena() *branch {
 	return &branch{
 		head: b.head,
 		preview: &metaState{
-			dirty:    newMetaIndex(),
-			readonly: b.preview.readonly,
+			dirty:     newMetaIndex(),
+			readonly:  b.preview.readonly,
+			producers: b.preview.producers,
 		},
 		packed:   p,
 		unpacked: u,
@@ -256,6 +257,22 @@ func (b *branch) queryTxState(hash hash.Hash) (state pi.TransactionState, ok boo
 	return
 }
 
+// packedHeight returns the height of the block packing the transaction within this branch.
+func (b *branch) packedHeight(hash hash.Hash) (height uint32, ok bool) {
+	for iter := b.head; iter != nil; iter = iter.parent {
+		var blk = iter.load()
+		if blk == nil {
+			return
+		}
+		for _, v := range blk.Transactions {
+			if v.Hash() == hash {
+				return iter.height, true
+			}
+		}
+	}
+	return
+}
+
 func (b *branch) sprint(from uint32) (buff string) {
 	var nodes = b.head.fetchNodeList(from)
 	for i, v := range nodes {
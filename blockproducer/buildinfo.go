@@ -0,0 +1,61 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"sort"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+)
+
+// mergeBuildInfos merges the build info announced in provider profiles into the build info
+// reported by pings. The pinged build info is fresher, e.g. an upgraded node pings before it
+// provides service again, so the profile only fills the nodes not pinging this block producer.
+func mergeBuildInfos(
+	pinged []*proto.NodeBuildInfo, providers map[proto.AccountAddress]*types.ProviderProfile,
+) (infos []*proto.NodeBuildInfo) {
+	var known = make(map[proto.NodeID]struct{}, len(pinged))
+	infos = make([]*proto.NodeBuildInfo, 0, len(pinged)+len(providers))
+	for _, v := range pinged {
+		known[v.NodeID] = struct{}{}
+		infos = append(infos, v)
+	}
+	for _, v := range providers {
+		if v == nil || v.Build.Version == "" {
+			continue
+		}
+		if _, ok := known[v.NodeID]; ok {
+			continue
+		}
+		infos = append(infos, &proto.NodeBuildInfo{
+			NodeID: v.NodeID,
+			Build:  v.Build,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].NodeID < infos[j].NodeID })
+	return
+}
+
+// queryBuildInfos returns the build info of the network nodes.
+func (c *Chain) queryBuildInfos() []*proto.NodeBuildInfo {
+	var pinged = route.GetBuildInfos()
+	c.RLock()
+	defer c.RUnlock()
+	return mergeBuildInfos(pinged, c.immutable.readonly.provider)
+}
@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestBuildInfos(t *testing.T) {
+	Convey("Given a metaState with a provider announcing its build", t, func() {
+		var (
+			ms     = newMetaState()
+			node1  = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000001")
+			node2  = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000002")
+			build1 = proto.BuildInfo{Version: "v1.0.0", BuildHash: "a"}
+		)
+		origConf := conf.GConf
+		defer func() { conf.GConf = origConf }()
+		conf.GConf = &conf.Config{}
+
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		addr, err := crypto.PubKeyHash(priv.PubKey())
+		So(err, ShouldBeNil)
+		ms.loadOrStoreAccountObject(addr, &types.Account{Address: addr})
+		ms.commit()
+
+		tx := types.NewProvideService(&types.ProvideServiceHeader{
+			NodeID: node1,
+			Build:  build1,
+		})
+		So(tx.Sign(priv), ShouldBeNil)
+		So(ms.updateProviderList(tx, 1), ShouldBeNil)
+		ms.commit()
+
+		po, loaded := ms.loadProviderObject(addr)
+		So(loaded, ShouldBeTrue)
+		So(po.Build, ShouldResemble, build1)
+
+		Convey("The profile should fill the nodes not pinging", func() {
+			infos := mergeBuildInfos(nil, ms.readonly.provider)
+			So(infos, ShouldHaveLength, 1)
+			So(infos[0].NodeID, ShouldEqual, node1)
+			So(infos[0].Build, ShouldResemble, build1)
+			So(infos[0].LastSeen.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("The pinged build info should override the profile", func() {
+			pinged := []*proto.NodeBuildInfo{
+				{NodeID: node2, Build: proto.BuildInfo{Version: "v1.0.0"}},
+				{NodeID: node1, Build: proto.BuildInfo{Version: "v1.1.0"}},
+			}
+			infos := mergeBuildInfos(pinged, ms.readonly.provider)
+			So(infos, ShouldHaveLength, 2)
+			So(infos[0].NodeID, ShouldEqual, node1)
+			So(infos[0].Build.Version, ShouldEqual, "v1.1.0")
+			So(infos[1].NodeID, ShouldEqual, node2)
+		})
+	})
+}
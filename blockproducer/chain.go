@@ -39,6 +39,7 @@ import (
 	"github.com/SQLess/SQLess/route"
 	rpc "github.com/SQLess/SQLess/rpc/mux"
 	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/clock"
 	"github.com/SQLess/SQLess/utils/log"
 	xi "github.com/SQLess/SQLess/xenomint/interfaces"
 )
@@ -71,6 +72,7 @@ type Chain struct {
 	// NOTE(leventeliu): this LRU object is only used for block cache control,
 	// do NOT read it in any case.
 	blockCache *lru.Cache
+	rpcCache   *rpcCache
 
 	// Channels for incoming blocks and transactions
 	pendingBlocks    chan *types.BPBlock
@@ -96,6 +98,14 @@ type Chain struct {
 	headBranch   *branch
 	branches     []*branch
 	txPool       map[hash.Hash]pi.Transaction
+
+	clockSkew    *clock.SkewDetector
+	billingAudit *billingAudit
+	costAnomaly  *costAnomalyDetector
+
+	provisionLock sync.Mutex // serializes the provisioning records signed by local node
+	stopRoute     func()
+	stopProbe     func()
 }
 
 // NewChain creates a new blockchain.
@@ -114,6 +124,7 @@ func NewChainWithContext(ctx context.Context, cfg *Config) (c *Chain, err error)
 		heads     []*blockNode
 		immutable *metaState
 		txPool    map[hash.Hash]pi.Transaction
+		audit     *billingAudit
 
 		branches   []*branch
 		headBranch *branch
@@ -164,9 +175,15 @@ func NewChainWithContext(ctx context.Context, cfg *Config) (c *Chain, err error)
 		return
 	}
 
+	var rpcCacheTTL = cfg.RPCCacheTTL
+	if rpcCacheTTL == 0 {
+		rpcCacheTTL = DefaultRPCCacheTTL
+	}
+
 	// Create initial state from genesis block and store
 	if !existed {
 		var init = newMetaState()
+		init.setBlockProducers(cfg.Genesis)
 		for _, v := range cfg.Genesis.Transactions {
 			if ierr = init.apply(v, 0); ierr != nil {
 				err = errors.Wrap(ierr, "failed to initialize immutable state")
@@ -187,6 +204,11 @@ func NewChainWithContext(ctx context.Context, cfg *Config) (c *Chain, err error)
 		err = errors.Wrap(ierr, "failed to load data from storage")
 		return
 	}
+	immutable.setBlockProducers(cfg.Genesis)
+	if audit, ierr = newBillingAudit(st); ierr != nil {
+		err = errors.Wrap(ierr, "failed to load billing audit from storage")
+		return
+	}
 
 	// Check genesis block
 	if persistedGenesis := lastIrre.ancestorByCount(0); persistedGenesis == nil ||
@@ -269,6 +291,13 @@ func NewChainWithContext(ctx context.Context, cfg *Config) (c *Chain, err error)
 		needConfirms = l
 	}
 
+	// Start routing services before the peers are looked up
+	var stopRoute func()
+	if stopRoute, err = route.StartServices(); err != nil {
+		err = errors.Wrap(err, "failed to start routing services")
+		return
+	}
+
 	// create chain
 	var cld, ccl = context.WithCancel(ctx)
 	c = &Chain{
@@ -281,6 +310,7 @@ func NewChainWithContext(ctx context.Context, cfg *Config) (c *Chain, err error)
 
 		storage:    st,
 		blockCache: cache,
+		rpcCache:   newRPCCache(rpcCacheTTL),
 
 		pendingBlocks:    make(chan *types.BPBlock),
 		pendingAddTxReqs: make(chan *types.AddTxReq),
@@ -303,6 +333,11 @@ func NewChainWithContext(ctx context.Context, cfg *Config) (c *Chain, err error)
 		headBranch:  headBranch,
 		branches:    branches,
 		txPool:      txPool,
+
+		clockSkew:    clock.NewSkewDetector(clock.MaxSkew()),
+		billingAudit: audit,
+		costAnomaly:  newCostAnomalyDetector(costAnomalyConfig()),
+		stopRoute:    stopRoute,
 	}
 
 	// NOTE(leventeliu): this implies that BP chain is a singleton, otherwise we will need
@@ -312,6 +347,11 @@ func NewChainWithContext(ctx context.Context, cfg *Config) (c *Chain, err error)
 	}
 	expvar.Get(mwKeyHeight).(mw.Metric).Add(float64(c.head().height))
 
+	// Publish revoked node identities to route layer
+	route.SetRevokedNodes(immutable.loadRevokedNodes())
+	// Record used provisioning tokens on chain
+	route.SetProvisionLedger(c)
+
 	log.WithFields(log.Fields{
 		"local":  c.getLocalBPInfo(),
 		"period": c.period,
@@ -335,7 +375,10 @@ func (c *Chain) Start() {
 	// ...
 	// Start main cycle and service
 	c.goFunc(c.mainCycle)
+	c.goFunc(c.checkClockSkew)
 	c.startService(c)
+	// Probe the known nodes and evict the stale ones from routing table
+	c.stopProbe = rpc.StartLivenessProbe(nil)
 }
 
 // Stop stops the main process of the sql-chain.
@@ -347,6 +390,11 @@ func (c *Chain) Stop() (err error) {
 	le.Debug("stopping chain")
 	c.stop()
 	le.Debug("chain service stopped")
+	if c.stopProbe != nil {
+		c.stopProbe()
+	}
+	c.stopRoute()
+	le.Debug("routing services stopped")
 	c.storage.Close()
 	le.Debug("chain database closed")
 
@@ -429,6 +477,14 @@ func (c *Chain) advanceNextHeight(now time.Time, d time.Duration) {
 		}).Warn("too much time elapsed in the new period, skip this block")
 		return
 	}
+	// Refuse to produce block if local clock is not trustworthy
+	if conf.GConf != nil && conf.GConf.RefuseLeadOnClockSkew && c.clockSkew.Exceeded() {
+		log.WithFields(log.Fields{
+			"advanced_height": c.getNextHeight(),
+			"clock_skew":      c.clockSkew.Skew().String(),
+		}).Warn("local clock skew exceeds the threshold, skip this block")
+		return
+	}
 	log.WithField("height", c.getNextHeight()).Info("producing a new block")
 	if err := c.produceBlock(now); err != nil {
 		log.WithField("now", now.Format(time.RFC3339Nano)).WithError(err).Errorln(
@@ -563,6 +619,14 @@ func (c *Chain) processAddTxReq(addTxReq *types.AddTxReq) {
 		return
 	}
 	expvar.Get(mwKeyTxPooled).(mw.Metric).Add(1)
+
+	if ub, ok := tx.(*types.UpdateBilling); ok {
+		var cost uint64
+		for _, u := range ub.Users {
+			cost += u.Cost
+		}
+		c.costAnomaly.observe(ub.Receiver.DatabaseID(), cost, time.Now())
+	}
 }
 
 func (c *Chain) processTxs(ctx context.Context) {
@@ -766,6 +830,8 @@ func (c *Chain) replaceAndSwitchToBranch(
 		c.lastIrre = lastIrre
 		// Apply irreversible blocks to immutable database
 		c.immutable.commit()
+		c.rpcCache.invalidate()
+		route.SetRevokedNodes(c.immutable.loadRevokedNodes())
 		// Prune branches
 		var (
 			idx int
@@ -818,6 +884,8 @@ func (c *Chain) replaceAndSwitchToBranch(
 		c.immutable.clean()
 		return
 	}
+	// Audit the confirmed billing against miner statements
+	c.auditBilling(newIrres)
 	expvar.Get(mwKeyTxConfirmed).(mw.Metric).Add(float64(txCount))
 	// TODO(leventeliu): trigger ChainBus.Publish.
 	// ...
@@ -855,6 +923,12 @@ func (c *Chain) applyBlock(bl *types.BPBlock) (err error) {
 	c.Lock()
 	defer c.Unlock()
 
+	// Reject blocks produced by revoked node identity
+	if c.immutable.isAccountRevoked(bl.Producer()) {
+		err = errors.Wrapf(ErrNodeRevoked, "block producer %s", bl.Producer())
+		return
+	}
+
 	for i, v := range c.branches {
 		// Grow a branch
 		if v.head.hash.IsEqual(bl.ParentHash()) {
@@ -919,6 +993,12 @@ func (c *Chain) produceAndStoreBlock(
 	c.Lock()
 	defer c.Unlock()
 
+	// Do not produce blocks with revoked node identity, they are rejected by the peers
+	if c.immutable.isAccountRevoked(c.address) {
+		err = errors.Wrapf(ErrNodeRevoked, "block producer %s", c.address)
+		return
+	}
+
 	// Try to produce new block
 	if br, bl, ierr = c.headBranch.produceBlock(
 		c.heightOfTime(now), now, c.address, priv,
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// clockSkewCheckInterval defines the interval of clock skew checking against remote peers.
+	clockSkewCheckInterval = time.Minute
+)
+
+// checkClockSkew periodically samples the local time of remote block producers to detect the
+// local clock skew.
+func (c *Chain) checkClockSkew(ctx context.Context) {
+	var ticker = time.NewTicker(clockSkewCheckInterval)
+	defer ticker.Stop()
+	for {
+		c.sampleRemoteTime(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Chain) sampleRemoteTime(ctx context.Context) {
+	var (
+		cld, ccl = context.WithTimeout(ctx, c.tick)
+		wg       = &sync.WaitGroup{}
+	)
+	defer func() {
+		wg.Wait()
+		ccl()
+	}()
+	for _, info := range c.getRemoteBPInfos() {
+		wg.Add(1)
+		go func(remote *blockProducerInfo) {
+			defer wg.Done()
+			var (
+				req  = &types.QueryTimeReq{}
+				resp = &types.QueryTimeResp{}
+				sent = time.Now()
+			)
+			if err := c.caller.CallNodeWithContext(
+				cld, remote.nodeID, route.MCCQueryTime.String(), req, resp,
+			); err != nil {
+				log.WithFields(log.Fields{
+					"local":  c.getLocalBPInfo(),
+					"remote": remote,
+				}).WithError(err).Debug("failed to query remote time")
+				return
+			}
+			c.clockSkew.AddSample(remote.nodeID, sent, resp.Time, time.Now())
+		}(info)
+	}
+}
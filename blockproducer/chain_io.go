@@ -120,28 +120,60 @@ func (c *Chain) loadSQLChainProfiles(addr proto.AccountAddress) []*types.SQLChai
 	return c.immutable.loadROSQLChains(addr)
 }
 
-func (c *Chain) queryTxState(hash hash.Hash) (state pi.TransactionState, err error) {
+func (c *Chain) loadRevokedNodes() []proto.NodeID {
+	c.RLock()
+	defer c.RUnlock()
+	return c.immutable.loadRevokedNodes()
+}
+
+func (c *Chain) loadDataset(databaseID proto.DatabaseID) (profile *types.DatasetProfile, ok bool) {
+	c.RLock()
+	defer c.RUnlock()
+	return c.immutable.loadDatasetObject(databaseID)
+}
+
+func (c *Chain) loadName(name string) (record *types.NameRecord, ok bool) {
+	c.RLock()
+	defer c.RUnlock()
+	return c.immutable.loadNameObject(name)
+}
+
+func (c *Chain) queryTxState(hash hash.Hash) (state pi.TransactionState, height uint32, err error) {
 	c.RLock()
 	defer c.RUnlock()
 	var ok bool
 
 	if state, ok = c.headBranch.queryTxState(hash); ok {
+		if state == pi.TransactionStatePacked {
+			height, _ = c.headBranch.packedHeight(hash)
+		}
 		return
 	}
 
 	var (
-		count    int
-		querySQL = `SELECT COUNT(*) FROM "indexed_transactions" WHERE "hash" = ?`
+		rows     *sql.Rows
+		querySQL = `SELECT "block_height" FROM "indexed_transactions" WHERE "hash" = ? LIMIT 1`
 	)
-	if err = c.storage.Reader().QueryRow(querySQL, hash.String()).Scan(&count); err != nil {
-		return pi.TransactionStateNotFound, err
+	if rows, err = c.storage.Reader().Query(querySQL, hash.String()); err != nil {
+		return pi.TransactionStateNotFound, 0, err
 	}
+	defer func() { _ = rows.Close() }()
 
-	if count > 0 {
-		return pi.TransactionStateConfirmed, nil
+	if rows.Next() {
+		if err = rows.Scan(&height); err != nil {
+			return pi.TransactionStateNotFound, 0, err
+		}
+		return pi.TransactionStateConfirmed, height, nil
 	}
 
-	return pi.TransactionStateNotFound, nil
+	return pi.TransactionStateNotFound, 0, rows.Err()
+}
+
+// headHeight returns the height of the current head block.
+func (c *Chain) headHeight() uint32 {
+	c.RLock()
+	defer c.RUnlock()
+	return c.headBranch.head.height
 }
 
 func (c *Chain) queryAccountSQLChainProfiles(account proto.AccountAddress) (profiles []*types.SQLChainProfile, err error) {
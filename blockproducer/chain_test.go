@@ -302,9 +302,24 @@ func TestChain(t *testing.T) {
 				err = rpcService.QueryTxState(req, resp)
 				So(err, ShouldBeNil)
 				So(resp.State, ShouldEqual, pi.TransactionStateConfirmed)
+				So(resp.Height, ShouldEqual, 1)
 			})
 		})
 
+		Convey("The chain should produce blocks until the local account is revoked", func() {
+			err = chain.produceBlock(begin.Add(chain.period).UTC())
+			So(err, ShouldBeNil)
+			So(chain.head().height, ShouldEqual, 1)
+
+			chain.immutable.readonly.revoked[leader] = &types.NodeRevocation{
+				NodeID:  leader,
+				Account: addr1,
+			}
+			err = chain.produceBlock(begin.Add(2 * chain.period).UTC())
+			So(errors.Cause(err), ShouldEqual, ErrNodeRevoked)
+			So(chain.head().height, ShouldEqual, 1)
+		})
+
 		Convey("Multiple provide service", func() {
 			var (
 				nonce            pi.AccountNonce
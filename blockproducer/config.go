@@ -53,4 +53,7 @@ type Config struct {
 	Tick   time.Duration
 
 	BlockCacheSize int
+	// RPCCacheTTL is the lifetime of the cached hot RPC responses, defaults to DefaultRPCCacheTTL,
+	// set a negative value to disable the cache.
+	RPCCacheTTL time.Duration
 }
@@ -0,0 +1,211 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sync"
+	"time"
+
+	mw "github.com/zserge/metric"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultCostAnomalyThreshold defines the default ratio of hourly cost to baseline which
+	// fires an alert.
+	DefaultCostAnomalyThreshold = 3.0
+	// DefaultCostAnomalyBaseline defines the default window of the rolling cost baseline.
+	DefaultCostAnomalyBaseline = 24 * time.Hour
+	// MinCostAnomalyBaselineHours defines the min count of hours with billing history before the
+	// baseline is considered valid.
+	MinCostAnomalyBaselineHours = 3
+
+	costAnomalyWebhookTimeout = 10 * time.Second
+
+	mwKeyCostAnomaly = "service:bp:billing:anomaly"
+)
+
+func init() {
+	expvar.Publish(mwKeyCostAnomaly, mw.NewCounter("5m1m"))
+}
+
+// CostAnomaly defines a cost spike alert of a database, posted as JSON to the webhooks.
+type CostAnomaly struct {
+	DatabaseID proto.DatabaseID `json:"database_id"`
+	Hour       time.Time        `json:"hour"`
+	Cost       uint64           `json:"cost"`
+	Baseline   float64          `json:"baseline"`
+	Ratio      float64          `json:"ratio"`
+	Detected   time.Time        `json:"detected"`
+}
+
+// costSeries defines the hourly billed costs of a database.
+type costSeries struct {
+	hours   map[int64]uint64 // unix hour -> cost
+	alerted int64            // the last alerted unix hour
+}
+
+// costAnomalyDetector compares the billed cost of the current hour of each database with the
+// average hourly cost of the rolling baseline window.
+type costAnomalyDetector struct {
+	sync.Mutex
+	threshold float64
+	minCost   uint64
+	window    int64 // in hours
+	webhooks  []string
+	series    map[proto.DatabaseID]*costSeries
+	notify    func(a *CostAnomaly)
+}
+
+// newCostAnomalyDetector returns a new detector of the config, or nil if cost anomaly detection
+// is not configured.
+func newCostAnomalyDetector(cfg *conf.CostAnomalyConfig) (d *costAnomalyDetector) {
+	if cfg == nil {
+		return
+	}
+	d = &costAnomalyDetector{
+		threshold: cfg.Threshold,
+		minCost:   cfg.MinCost,
+		window:    int64(cfg.Baseline / time.Hour),
+		webhooks:  cfg.Webhooks,
+		series:    make(map[proto.DatabaseID]*costSeries),
+	}
+	if d.threshold <= 1 {
+		d.threshold = DefaultCostAnomalyThreshold
+	}
+	if d.window < MinCostAnomalyBaselineHours {
+		d.window = int64(DefaultCostAnomalyBaseline / time.Hour)
+	}
+	d.notify = d.fire
+	return
+}
+
+func costAnomalyConfig() *conf.CostAnomalyConfig {
+	if conf.GConf == nil {
+		return nil
+	}
+	return conf.GConf.CostAnomaly
+}
+
+// observe adds the billed cost of the database at the time and checks for cost spike.
+func (d *costAnomalyDetector) observe(dbID proto.DatabaseID, cost uint64, at time.Time) {
+	if d == nil || cost == 0 {
+		return
+	}
+	d.Lock()
+	defer d.Unlock()
+	var (
+		hour  = at.Unix() / 3600
+		s, ok = d.series[dbID]
+	)
+	if !ok {
+		s = &costSeries{hours: make(map[int64]uint64)}
+		d.series[dbID] = s
+	}
+	s.hours[hour] += cost
+	// evict hours out of the baseline window
+	for h := range s.hours {
+		if h < hour-d.window {
+			delete(s.hours, h)
+		}
+	}
+	if s.alerted == hour || s.hours[hour] < d.minCost {
+		return
+	}
+	var (
+		total uint64
+		count int64
+	)
+	for h, c := range s.hours {
+		if h < hour {
+			total += c
+			count++
+		}
+	}
+	if count < MinCostAnomalyBaselineHours {
+		return
+	}
+	// hours without billing in the window count as zero cost
+	var (
+		baseline = float64(total) / float64(d.window)
+		ratio    = float64(s.hours[hour]) / baseline
+	)
+	if ratio < d.threshold {
+		return
+	}
+	s.alerted = hour
+	d.notify(&CostAnomaly{
+		DatabaseID: dbID,
+		Hour:       time.Unix(hour*3600, 0).UTC(),
+		Cost:       s.hours[hour],
+		Baseline:   baseline,
+		Ratio:      ratio,
+		Detected:   at.UTC(),
+	})
+}
+
+// fire logs the anomaly and posts it to the webhooks asynchronously.
+func (d *costAnomalyDetector) fire(a *CostAnomaly) {
+	log.WithFields(log.Fields{
+		"db":       a.DatabaseID,
+		"hour":     a.Hour,
+		"cost":     a.Cost,
+		"baseline": a.Baseline,
+		"ratio":    a.Ratio,
+	}).Warning("database cost anomaly detected")
+	expvar.Get(mwKeyCostAnomaly).(mw.Metric).Add(1)
+	if len(d.webhooks) == 0 {
+		return
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		log.WithError(err).Error("marshal cost anomaly failed")
+		return
+	}
+	for _, url := range d.webhooks {
+		go postCostAnomaly(url, data)
+	}
+}
+
+func postCostAnomaly(url string, data []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), costAnomalyWebhookTimeout)
+	defer cancel()
+	le := log.WithField("webhook", url)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		le.WithError(err).Error("build cost anomaly webhook request failed")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		le.WithError(err).Error("post cost anomaly webhook failed")
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		le.WithField("status", resp.StatusCode).Error("cost anomaly webhook rejected")
+	}
+}
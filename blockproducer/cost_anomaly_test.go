@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestCostAnomalyDetector(t *testing.T) {
+	Convey("Given a cost anomaly detector with a 6 hours baseline", t, func() {
+		var (
+			d = newCostAnomalyDetector(&conf.CostAnomalyConfig{
+				Threshold: 3,
+				MinCost:   10,
+				Baseline:  6 * time.Hour,
+			})
+			alerts []*CostAnomaly
+			dbID   = proto.DatabaseID("db")
+			start  = time.Unix(1000*3600, 0)
+		)
+		d.notify = func(a *CostAnomaly) { alerts = append(alerts, a) }
+		for i := 0; i < 6; i++ {
+			d.observe(dbID, 100, start.Add(time.Duration(i)*time.Hour))
+		}
+		So(alerts, ShouldBeEmpty)
+		Convey("A regular hourly cost should not fire alert", func() {
+			d.observe(dbID, 150, start.Add(6*time.Hour))
+			So(alerts, ShouldBeEmpty)
+		})
+		Convey("A cost spike should fire alert only once in the hour", func() {
+			var now = start.Add(6 * time.Hour)
+			d.observe(dbID, 200, now)
+			So(alerts, ShouldBeEmpty)
+			d.observe(dbID, 200, now.Add(time.Minute))
+			So(alerts, ShouldHaveLength, 1)
+			So(alerts[0].DatabaseID, ShouldEqual, dbID)
+			So(alerts[0].Cost, ShouldEqual, 400)
+			So(alerts[0].Baseline, ShouldEqual, 100)
+			d.observe(dbID, 200, now.Add(2*time.Minute))
+			So(alerts, ShouldHaveLength, 1)
+		})
+		Convey("Costs of other databases should not be mixed", func() {
+			d.observe(proto.DatabaseID("other"), 1000, start.Add(6*time.Hour))
+			So(alerts, ShouldBeEmpty)
+		})
+	})
+	Convey("Given no cost anomaly config", t, func() {
+		d := newCostAnomalyDetector(nil)
+		So(d, ShouldBeNil)
+		So(func() { d.observe(proto.DatabaseID("db"), 100, time.Now()) }, ShouldNotPanic)
+	})
+}
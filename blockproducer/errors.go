@@ -87,4 +87,40 @@ var (
 	ErrNoAvailableBranch = errors.New("no available branch from state storage")
 	// ErrWrongTokenType indicates that token type in transfer is wrong.
 	ErrWrongTokenType = errors.New("wrong token type")
+	// ErrNodeRevoked indicates that the node identity is revoked.
+	ErrNodeRevoked = errors.New("node identity is revoked")
+	// ErrNotNodeOwner indicates that the transaction sender does not own the node.
+	ErrNotNodeOwner = errors.New("sender is not the owner of the node")
+	// ErrEmptyTransaction indicates that the request carries no transaction.
+	ErrEmptyTransaction = errors.New("empty transaction")
+	// ErrInvalidDataset indicates that the published dataset is invalid.
+	ErrInvalidDataset = errors.New("invalid dataset")
+	// ErrDatasetPublished indicates that the dataset content is already published as the latest version.
+	ErrDatasetPublished = errors.New("dataset already published")
+	// ErrNameRegistered indicates that the name is registered by another account and not expired.
+	ErrNameRegistered = errors.New("name already registered")
+	// ErrNameNotFound indicates that the name is not registered or expired.
+	ErrNameNotFound = errors.New("name not found")
+	// ErrInvalidNamePeriods indicates that the registration periods of the name are invalid.
+	ErrInvalidNamePeriods = errors.New("invalid name registration periods")
+	// ErrInsufficientFee indicates that the fee paid by the transaction is insufficient.
+	ErrInsufficientFee = errors.New("insufficient fee")
+	// ErrInvalidReservation indicates that the capacity reservation is malformed.
+	ErrInvalidReservation = errors.New("invalid capacity reservation")
+	// ErrMinerNotReservable indicates that the provider does not offer reservable capacity.
+	ErrMinerNotReservable = errors.New("miner capacity is not reservable")
+	// ErrCapacityReserved indicates that the provider capacity is reserved by another owner.
+	ErrCapacityReserved = errors.New("miner capacity reserved by another owner")
+	// ErrMinerNotDecommissioning indicates that the miner has not announced its decommission.
+	ErrMinerNotDecommissioning = errors.New("miner is not decommissioning")
+	// ErrBillingNotSettled indicates that the database billing is not updated since the miner
+	// announced its decommission.
+	ErrBillingNotSettled = errors.New("database billing not settled")
+	// ErrInvalidTransferBatch indicates that the batch transfer is empty, oversized or has an
+	// invalid receiver.
+	ErrInvalidTransferBatch = errors.New("invalid transfer batch")
+	// ErrProvisionTokenUsed indicates that the provisioning token is already used.
+	ErrProvisionTokenUsed = errors.New("provisioning token already used")
+	// ErrNotBlockProducer indicates that the transaction sender is not a block producer.
+	ErrNotBlockProducer = errors.New("sender is not a block producer")
 )
@@ -18,8 +18,11 @@ package interfaces
 
 import (
 	"encoding/binary"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/SQLess/SQLess/crypto/asymmetric"
 	"github.com/SQLess/SQLess/crypto/hash"
 	"github.com/SQLess/SQLess/proto"
@@ -72,6 +75,22 @@ const (
 	TransactionTypeIssueKeys
 	// TransactionTypeUpdateBilling defines SQLChain update billing information.
 	TransactionTypeUpdateBilling
+	// TransactionTypeRevokeNode defines compromised node identity revocation type.
+	TransactionTypeRevokeNode
+	// TransactionTypePublishDataset defines read-only dataset publishing type.
+	TransactionTypePublishDataset
+	// TransactionTypeRegisterName defines human-readable name registration type.
+	TransactionTypeRegisterName
+	// TransactionTypeMultiSig defines multi-signature account transaction type.
+	TransactionTypeMultiSig
+	// TransactionTypeReserveCapacity defines provider capacity reservation type.
+	TransactionTypeReserveCapacity
+	// TransactionTypeDecommissionMiner defines miner decommission type.
+	TransactionTypeDecommissionMiner
+	// TransactionTypeTransferBatch defines batch transfer transaction type.
+	TransactionTypeTransferBatch
+	// TransactionTypeProvisionNode defines node provisioning record type.
+	TransactionTypeProvisionNode
 	// TransactionTypeNumber defines transaction types number.
 	TransactionTypeNumber
 )
@@ -102,11 +121,38 @@ func (t TransactionType) String() string {
 		return "IssueKeys"
 	case TransactionTypeUpdateBilling:
 		return "UpdateBilling"
+	case TransactionTypeRevokeNode:
+		return "RevokeNode"
+	case TransactionTypePublishDataset:
+		return "PublishDataset"
+	case TransactionTypeRegisterName:
+		return "RegisterName"
+	case TransactionTypeMultiSig:
+		return "MultiSig"
+	case TransactionTypeReserveCapacity:
+		return "ReserveCapacity"
+	case TransactionTypeDecommissionMiner:
+		return "DecommissionMiner"
+	case TransactionTypeTransferBatch:
+		return "TransferBatch"
+	case TransactionTypeProvisionNode:
+		return "ProvisionNode"
 	default:
 		return "Unknown"
 	}
 }
 
+// ParseTransactionType returns the transaction type by its name.
+func ParseTransactionType(name string) (t TransactionType, err error) {
+	for t = TransactionTypeTransfer; t < TransactionTypeNumber; t++ {
+		if strings.EqualFold(t.String(), name) {
+			return
+		}
+	}
+	err = errors.Wrapf(ErrInvalidTransactionType, "unknown transaction type %s", name)
+	return
+}
+
 // TransactionState defines a transaction state.
 type TransactionState uint32
 
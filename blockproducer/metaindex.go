@@ -45,6 +45,10 @@ type metaIndex struct {
 	accounts  map[proto.AccountAddress]*types.Account
 	databases map[proto.DatabaseID]*types.SQLChainProfile
 	provider  map[proto.AccountAddress]*types.ProviderProfile
+	revoked   map[proto.NodeID]*types.NodeRevocation
+	datasets  map[proto.DatabaseID]*types.DatasetProfile
+	names     map[string]*types.NameRecord
+	provision map[uint64]*types.ProvisionRecord
 }
 
 func newMetaIndex() *metaIndex {
@@ -52,6 +56,10 @@ func newMetaIndex() *metaIndex {
 		accounts:  make(map[proto.AccountAddress]*types.Account),
 		databases: make(map[proto.DatabaseID]*types.SQLChainProfile),
 		provider:  make(map[proto.AccountAddress]*types.ProviderProfile),
+		revoked:   make(map[proto.NodeID]*types.NodeRevocation),
+		datasets:  make(map[proto.DatabaseID]*types.DatasetProfile),
+		names:     make(map[string]*types.NameRecord),
+		provision: make(map[uint64]*types.ProvisionRecord),
 	}
 }
 
@@ -66,5 +74,17 @@ func (i *metaIndex) deepCopy() (cpy *metaIndex) {
 	for k, v := range i.provider {
 		cpy.provider[k] = deepcopy.Copy(v).(*types.ProviderProfile)
 	}
+	for k, v := range i.revoked {
+		cpy.revoked[k] = deepcopy.Copy(v).(*types.NodeRevocation)
+	}
+	for k, v := range i.datasets {
+		cpy.datasets[k] = deepcopy.Copy(v).(*types.DatasetProfile)
+	}
+	for k, v := range i.names {
+		cpy.names[k] = deepcopy.Copy(v).(*types.NameRecord)
+	}
+	for k, v := range i.provision {
+		cpy.provision[k] = deepcopy.Copy(v).(*types.ProvisionRecord)
+	}
 	return
 }
@@ -40,6 +40,10 @@ var (
 
 type metaState struct {
 	dirty, readonly *metaIndex
+	// producers are the block producer accounts authorized for the privileged transactions,
+	// they are taken from the genesis block instead of the local config, so that all the
+	// nodes apply these transactions to the same state.
+	producers map[proto.AccountAddress]bool
 }
 
 // MinerInfos is MinerInfo array.
@@ -63,6 +67,15 @@ func newMetaState() *metaState {
 	}
 }
 
+// setBlockProducers sets the block producers authorized by the genesis block.
+func (s *metaState) setBlockProducers(genesis *types.BPBlock) {
+	s.producers = map[proto.AccountAddress]bool{genesis.Producer(): true}
+}
+
+func (s *metaState) isBlockProducer(addr proto.AccountAddress) bool {
+	return s.producers[addr]
+}
+
 func (s *metaState) loadAccountObject(k proto.AccountAddress) (o *types.Account, loaded bool) {
 	var old *types.Account
 	if old, loaded = s.dirty.accounts[k]; loaded {
@@ -190,6 +203,30 @@ func (s *metaState) loadProviderObject(k proto.AccountAddress) (o *types.Provide
 	return
 }
 
+// loadProviderObjectByNodeID returns the provider serving with the node id, the one of the
+// smallest account address is returned if the node id is claimed by multiple providers, so that
+// the result does not depend on the map iteration order.
+func (s *metaState) loadProviderObjectByNodeID(nodeID proto.NodeID) (o *types.ProviderProfile, loaded bool) {
+	var addrs []proto.AccountAddress
+	for k, v := range s.dirty.provider {
+		if v != nil && v.NodeID == nodeID {
+			addrs = append(addrs, k)
+		}
+	}
+	for k, v := range s.readonly.provider {
+		if _, shadowed := s.dirty.provider[k]; !shadowed && v.NodeID == nodeID {
+			addrs = append(addrs, k)
+		}
+	}
+	if len(addrs) == 0 {
+		return
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+	return s.loadProviderObject(addrs[0])
+}
+
 func (s *metaState) loadOrStoreProviderObject(k proto.AccountAddress, v *types.ProviderProfile) (o *types.ProviderProfile, loaded bool) {
 	if o, loaded = s.dirty.provider[k]; loaded && o != nil {
 		return
@@ -201,6 +238,48 @@ func (s *metaState) loadOrStoreProviderObject(k proto.AccountAddress, v *types.P
 	return
 }
 
+func (s *metaState) loadRevocationObject(k proto.NodeID) (o *types.NodeRevocation, loaded bool) {
+	if o, loaded = s.dirty.revoked[k]; loaded {
+		return
+	}
+	o, loaded = s.readonly.revoked[k]
+	return
+}
+
+func (s *metaState) loadProvisionObject(k uint64) (o *types.ProvisionRecord, loaded bool) {
+	if o, loaded = s.dirty.provision[k]; loaded {
+		return
+	}
+	o, loaded = s.readonly.provision[k]
+	return
+}
+
+func (s *metaState) loadDatasetObject(k proto.DatabaseID) (o *types.DatasetProfile, loaded bool) {
+	var old *types.DatasetProfile
+	if old, loaded = s.dirty.datasets[k]; loaded {
+		o = deepcopy.Copy(old).(*types.DatasetProfile)
+		return
+	}
+	if old, loaded = s.readonly.datasets[k]; loaded {
+		o = deepcopy.Copy(old).(*types.DatasetProfile)
+		return
+	}
+	return
+}
+
+func (s *metaState) loadNameObject(k string) (o *types.NameRecord, loaded bool) {
+	var old *types.NameRecord
+	if old, loaded = s.dirty.names[k]; loaded {
+		o = deepcopy.Copy(old).(*types.NameRecord)
+		return
+	}
+	if old, loaded = s.readonly.names[k]; loaded {
+		o = deepcopy.Copy(old).(*types.NameRecord)
+		return
+	}
+	return
+}
+
 func (s *metaState) deleteAccountObject(k proto.AccountAddress) {
 	// Use a nil pointer to mark a deletion, which will be later used by commit procedure.
 	s.dirty.accounts[k] = nil
@@ -244,6 +323,22 @@ func (s *metaState) commit() {
 			delete(s.readonly.provider, k)
 		}
 	}
+	for k, v := range s.dirty.revoked {
+		// Revocation is permanent
+		s.readonly.revoked[k] = v
+	}
+	for k, v := range s.dirty.datasets {
+		// Published dataset versions are append-only
+		s.readonly.datasets[k] = v
+	}
+	for k, v := range s.dirty.names {
+		// Expired names are kept until registered again
+		s.readonly.names[k] = v
+	}
+	for k, v := range s.dirty.provision {
+		// Provisioning records are permanent
+		s.readonly.provision[k] = v
+	}
 	// Clean dirty map
 	s.dirty = newMetaIndex()
 	return
@@ -303,6 +398,12 @@ func (s *metaState) transferAccountToken(transfer *types.Transfer) (err error) {
 		err = errors.Wrap(err, "applyTx failed")
 		return err
 	}
+	return s.transferAccountTokenFrom(realSender, transfer)
+}
+
+// transferAccountTokenFrom transfers the account token of the real sender, which is the signee
+// or the multi-signature account of the transfer.
+func (s *metaState) transferAccountTokenFrom(realSender proto.AccountAddress, transfer *types.Transfer) (err error) {
 	if realSender != transfer.Sender {
 		err = errors.Wrapf(ErrInvalidSender,
 			"applyTx failed: real sender %s, sender %s", realSender, transfer.Sender)
@@ -372,6 +473,94 @@ func (s *metaState) transferAccountToken(transfer *types.Transfer) (err error) {
 
 }
 
+func (s *metaState) transferAccountTokenBatch(tx *types.TransferBatch) (err error) {
+	var realSender proto.AccountAddress
+	if realSender, err = crypto.PubKeyHash(tx.Signee); err != nil {
+		err = errors.Wrap(err, "transferAccountTokenBatch failed")
+		return
+	}
+	return s.transferAccountTokenBatchFrom(realSender, tx)
+}
+
+// transferAccountTokenBatchFrom transfers the account token of the real sender to all the
+// receivers of the batch, the batch is validated as a whole before any balance is changed.
+func (s *metaState) transferAccountTokenBatchFrom(
+	realSender proto.AccountAddress, tx *types.TransferBatch,
+) (err error) {
+	if realSender != tx.Sender {
+		err = errors.Wrapf(ErrInvalidSender,
+			"applyTx failed: real sender %s, sender %s", realSender, tx.Sender)
+		log.WithError(err).Warning("public key not match sender in applyTransaction")
+		return
+	}
+	if len(tx.Receivers) == 0 || len(tx.Receivers) > types.MaxTransferBatchSize {
+		err = errors.Wrapf(ErrInvalidTransferBatch, "batch size %d", len(tx.Receivers))
+		return
+	}
+
+	// Merge duplicated receivers and sum up the total amount
+	var (
+		total     uint64
+		receivers = make([]proto.AccountAddress, 0, len(tx.Receivers))
+		amounts   = make(map[proto.AccountAddress]uint64, len(tx.Receivers))
+	)
+	for _, r := range tx.Receivers {
+		if r.Receiver == tx.Sender || r.Amount == 0 {
+			continue
+		}
+		if _, ok := s.loadSQLChainObject(r.Receiver.DatabaseID()); ok {
+			err = errors.Wrapf(ErrInvalidTransferBatch, "receiver %s is a database", r.Receiver)
+			return
+		}
+		if err = safeAdd(&total, &r.Amount); err != nil {
+			return
+		}
+		amount, ok := amounts[r.Receiver]
+		if !ok {
+			receivers = append(receivers, r.Receiver)
+		}
+		if err = safeAdd(&amount, &r.Amount); err != nil {
+			return
+		}
+		amounts[r.Receiver] = amount
+	}
+	if total == 0 {
+		return
+	}
+
+	so, loaded := s.loadAccountObject(tx.Sender)
+	if !loaded {
+		err = ErrAccountNotFound
+		return
+	}
+	if so.TokenBalance[tx.TokenType] < total {
+		err = errors.Wrapf(ErrInsufficientBalance, "balance %d, required %d",
+			so.TokenBalance[tx.TokenType], total)
+		return
+	}
+	for _, receiver := range receivers {
+		if ro, loaded := s.loadAccountObject(receiver); loaded {
+			var rb, amount = ro.TokenBalance[tx.TokenType], amounts[receiver]
+			if err = safeAdd(&rb, &amount); err != nil {
+				return
+			}
+		}
+	}
+
+	// Proceed transfer
+	if err = s.decreaseAccountToken(tx.Sender, total, tx.TokenType); err != nil {
+		return
+	}
+	for _, receiver := range receivers {
+		// Create empty receiver account if not found
+		s.loadOrStoreAccountObject(receiver, &types.Account{Address: receiver})
+		if err = s.increaseAccountToken(receiver, amounts[receiver], tx.TokenType); err != nil {
+			return
+		}
+	}
+	return
+}
+
 func (s *metaState) increaseAccountCovenantBalance(k proto.AccountAddress, amount uint64) error {
 	return s.increaseAccountToken(k, amount, types.Wave)
 }
@@ -516,6 +705,20 @@ func (s *metaState) updateProviderList(tx *types.ProvideService, height uint32)
 		return
 	}
 
+	// revoked node identity can not provide service any more
+	if _, revoked := s.loadRevocationObject(tx.NodeID); revoked {
+		err = errors.Wrapf(ErrNodeRevoked, "node %s", tx.NodeID)
+		return
+	}
+
+	// the capacity reservation held by an owner survives the service update
+	var reserved *types.ProviderProfile
+	if po, loaded := s.loadProviderObject(sender); loaded {
+		if _, ok := po.Reservation(height); ok {
+			reserved = po
+		}
+	}
+
 	if height >= conf.BPHeightCIPFixProvideService {
 		// load previous provider object
 		po, loaded := s.loadProviderObject(sender)
@@ -545,18 +748,32 @@ func (s *metaState) updateProviderList(tx *types.ProvideService, height uint32)
 		Deposit:       minDeposit,
 		GasPrice:      tx.GasPrice,
 		NodeID:        tx.NodeID,
+
+		ReservationFee: tx.ReservationFee,
+		Build:          tx.Build,
+	}
+	if reserved != nil {
+		pp.ReservedBy, pp.ReservationExpiry = reserved.ReservedBy, reserved.ReservationExpiry
 	}
 	s.dirty.provider[sender] = &pp
 	return
 }
 
-func (s *metaState) matchProvidersWithUser(tx *types.CreateDatabase) (err error) {
+func (s *metaState) matchProvidersWithUser(tx *types.CreateDatabase, height uint32) (err error) {
 	log.Infof("create database: %s", tx.Hash())
 	sender, err := crypto.PubKeyHash(tx.Signee)
 	if err != nil {
 		err = errors.Wrap(err, "matchProviders failed")
 		return
 	}
+	return s.matchProvidersWithUserFrom(sender, tx, height)
+}
+
+// matchProvidersWithUserFrom creates the database owned by the sender, which is the signee or the
+// multi-signature account of the transaction.
+func (s *metaState) matchProvidersWithUserFrom(
+	sender proto.AccountAddress, tx *types.CreateDatabase, height uint32,
+) (err error) {
 	if sender != tx.Owner {
 		err = errors.Wrapf(ErrInvalidSender, "match failed with real sender: %s, sender: %s",
 			sender, tx.Owner)
@@ -582,42 +799,9 @@ func (s *metaState) matchProvidersWithUser(tx *types.CreateDatabase) (err error)
 		return
 	}
 
-	miners := make(MinerInfos, 0, minerCount)
-
-	for _, m := range tx.ResourceMeta.TargetMiners {
-		if po, loaded := s.loadProviderObject(m); !loaded {
-			log.WithFields(log.Fields{
-				"miner_addr": m,
-				"user_addr":  sender,
-			}).Error(err)
-			err = ErrNoSuchMiner
-			continue
-		} else {
-			miners, err = filterAndAppendMiner(miners, po, tx, sender)
-			if err != nil {
-				log.Warnf("miner filtered %v", err)
-			}
-			// if got enough, break
-			if uint64(miners.Len()) == minerCount {
-				break
-			}
-		}
-	}
-
-	// not enough, find more miner(s)
-	if uint64(miners.Len()) < minerCount {
-		if uint64(len(tx.ResourceMeta.TargetMiners)) >= minerCount {
-			err = errors.Wrapf(err, "miners match target are not enough %d:%d", miners.Len(), minerCount)
-			return
-		}
-		var newMiners MinerInfos
-		// create new merged map
-		newMiners, err = s.filterNMiners(tx, sender, int(minerCount)-miners.Len())
-		if err != nil {
-			return
-		}
-
-		miners = append(miners, newMiners...)
+	var miners MinerInfos
+	if miners, err = s.selectMiners(tx, sender, height, false); err != nil {
+		return
 	}
 
 	// generate new sqlchain id and address
@@ -692,35 +876,119 @@ func (s *metaState) matchProvidersWithUser(tx *types.CreateDatabase) (err error)
 	return
 }
 
+// selectMiners selects the miners matching the database creation, the target miners are
+// selected first, then the providers reserved by the sender.
+//
+// If the target miners are not enough, the state transition keeps accepting the matched ones
+// when the last target miner passes the filter, as the blocks produced before did. The strict
+// mode rejects it with ErrNoEnoughMiner and is only used by the preview, since changing the
+// state transition needs a fork height.
+func (s *metaState) selectMiners(
+	tx *types.CreateDatabase, sender proto.AccountAddress, height uint32, strict bool,
+) (
+	miners MinerInfos, err error,
+) {
+	minerCount := uint64(tx.ResourceMeta.Node)
+	miners = make(MinerInfos, 0, minerCount)
+
+	for _, m := range tx.ResourceMeta.TargetMiners {
+		if po, loaded := s.loadProviderObject(m); !loaded {
+			log.WithFields(log.Fields{
+				"miner_addr": m,
+				"user_addr":  sender,
+			}).Error(err)
+			err = ErrNoSuchMiner
+			continue
+		} else {
+			miners, err = filterAndAppendMiner(miners, po, tx, sender, height)
+			if err != nil {
+				log.Warnf("miner filtered %v", err)
+			}
+			// if got enough, break
+			if uint64(miners.Len()) == minerCount {
+				break
+			}
+		}
+	}
+
+	// not enough, find more miner(s)
+	if uint64(miners.Len()) < minerCount {
+		if uint64(len(tx.ResourceMeta.TargetMiners)) >= minerCount {
+			if err == nil && strict {
+				err = ErrNoEnoughMiner
+			}
+			err = errors.Wrapf(err, "miners match target are not enough %d:%d", miners.Len(), minerCount)
+			return
+		}
+		miners = s.appendReservedMiners(miners, tx, sender, height)
+	}
+	if uint64(miners.Len()) < minerCount {
+		var newMiners MinerInfos
+		// create new merged map
+		newMiners, err = s.filterNMiners(tx, sender, miners, int(minerCount)-miners.Len(), height)
+		if err != nil {
+			return
+		}
+
+		miners = append(miners, newMiners...)
+	}
+
+	return miners, nil
+}
+
+// appendReservedMiners appends the matching providers reserved by the user in address order,
+// until the miner count of the database is reached.
+func (s *metaState) appendReservedMiners(
+	miners MinerInfos, tx *types.CreateDatabase, user proto.AccountAddress, height uint32,
+) MinerInfos {
+	var (
+		selected = make(map[proto.AccountAddress]bool)
+		reserved []*types.ProviderProfile
+	)
+	for _, m := range miners {
+		selected[m.Address] = true
+	}
+	for _, po := range s.loadAllProviders() {
+		if owner, ok := po.Reservation(height); ok && owner == user && !selected[po.Provider] {
+			reserved = append(reserved, po)
+		}
+	}
+	sort.Slice(reserved, func(i, j int) bool {
+		return bytes.Compare(reserved[i].Provider[:], reserved[j].Provider[:]) < 0
+	})
+	for _, po := range reserved {
+		if uint64(miners.Len()) >= uint64(tx.ResourceMeta.Node) {
+			break
+		}
+		miners, _ = filterAndAppendMiner(miners, po, tx, user, height)
+	}
+	return miners
+}
+
 func (s *metaState) filterNMiners(
 	tx *types.CreateDatabase,
 	user proto.AccountAddress,
-	minerCount int) (
+	selected MinerInfos,
+	minerCount int,
+	height uint32) (
 	m MinerInfos, err error,
 ) {
 	// create new merged map
-	allProviderMap := make(map[proto.AccountAddress]*types.ProviderProfile)
-	for k, v := range s.readonly.provider {
-		allProviderMap[k] = v
-	}
-	for k, v := range s.dirty.provider {
-		if v == nil {
-			delete(allProviderMap, k)
-		} else {
-			allProviderMap[k] = v
-		}
-	}
+	allProviderMap := s.loadAllProviders()
 
-	// delete selected target miners
+	// delete selected target and reserved miners
 	for _, m := range tx.ResourceMeta.TargetMiners {
 		delete(allProviderMap, m)
 	}
+	for _, m := range selected {
+		delete(allProviderMap, m.Address)
+	}
 
 	// suppose 1/4 miners match
 	newMiners := make(MinerInfos, 0, len(allProviderMap)/4)
 	// filter all miners to slice and sort
 	for _, po := range allProviderMap {
-		newMiners, _ = filterAndAppendMiner(newMiners, po, tx, user)
+		newMiners, _ = filterAndAppendMiner(newMiners, po, tx, user, height)
 	}
 	if newMiners.Len() < minerCount {
 		err = ErrNoEnoughMiner
@@ -731,17 +999,39 @@ func (s *metaState) filterNMiners(
 	return newMiners[:minerCount], nil
 }
 
+// loadAllProviders returns the merged map of the readonly and dirty provider objects.
+func (s *metaState) loadAllProviders() (all map[proto.AccountAddress]*types.ProviderProfile) {
+	all = make(map[proto.AccountAddress]*types.ProviderProfile)
+	for k, v := range s.readonly.provider {
+		all[k] = v
+	}
+	for k, v := range s.dirty.provider {
+		if v == nil {
+			delete(all, k)
+		} else {
+			all[k] = v
+		}
+	}
+	return
+}
+
 func filterAndAppendMiner(
 	miners MinerInfos,
 	po *types.ProviderProfile,
 	req *types.CreateDatabase,
 	user proto.AccountAddress,
+	height uint32,
 ) (newMiners MinerInfos, err error) {
 	newMiners = miners
 	if !isProviderUserMatch(po.TargetUser, user) {
 		err = ErrMinerUserNotMatch
 		return
 	}
+	// the reserved capacity is kept for the owner of the reservation
+	if owner, ok := po.Reservation(height); ok && owner != user {
+		err = errors.Wrapf(ErrCapacityReserved, "reserved until height %d", po.ReservationExpiry)
+		return
+	}
 	var match bool
 	if match, err = isProviderReqMatch(po, req); !match {
 		return
@@ -816,6 +1106,12 @@ func (s *metaState) updatePermission(tx *types.UpdatePermission) (err error) {
 		}).WithError(err).Error("unexpected err")
 		return
 	}
+	return s.updatePermissionFrom(sender, tx)
+}
+
+// updatePermissionFrom updates the permission on behalf of the sender, which is the signee or the
+// multi-signature account of the transaction.
+func (s *metaState) updatePermissionFrom(sender proto.AccountAddress, tx *types.UpdatePermission) (err error) {
 	so, loaded := s.loadSQLChainObject(tx.TargetSQLChain.DatabaseID())
 	if !loaded {
 		log.WithFields(log.Fields{
@@ -998,6 +1294,436 @@ func (s *metaState) updateBilling(tx *types.UpdateBilling) (err error) {
 	return
 }
 
+// revokeNode publishes the revocation of a compromised node identity. The revocation can be
+// issued by the provider account owning the node or by a block producer, and the provider
+// profile of the node is removed with its deposit refunded.
+func (s *metaState) revokeNode(tx *types.RevokeNode, height uint32) (err error) {
+	var (
+		sender   proto.AccountAddress
+		owner    proto.AccountAddress
+		ownerPro *types.ProviderProfile
+	)
+	if sender, err = crypto.PubKeyHash(tx.Signee); err != nil {
+		err = errors.Wrap(err, "revokeNode failed")
+		return
+	}
+	if _, revoked := s.loadRevocationObject(tx.NodeID); revoked {
+		err = errors.Wrapf(ErrNodeRevoked, "node %s", tx.NodeID)
+		return
+	}
+
+	// find the account owning the node
+	if po, loaded := s.loadProviderObject(sender); loaded && po.NodeID == tx.NodeID {
+		owner, ownerPro = sender, po
+	} else if po, loaded := s.loadProviderObjectByNodeID(tx.NodeID); loaded {
+		owner, ownerPro = po.Provider, po
+	}
+	if owner != sender && !s.isBlockProducer(sender) {
+		err = errors.Wrapf(ErrNotNodeOwner, "node %s", tx.NodeID)
+		return
+	}
+
+	if ownerPro != nil {
+		if err = s.increaseAccountStableBalance(owner, ownerPro.Deposit); err != nil {
+			return
+		}
+		s.deleteProviderObject(owner)
+	}
+	s.dirty.revoked[tx.NodeID] = &types.NodeRevocation{
+		NodeID:  tx.NodeID,
+		Account: owner,
+		Revoker: sender,
+		Reason:  tx.Reason,
+		Height:  height,
+	}
+	return
+}
+
+// isAccountRevoked returns whether any node owned by the account is revoked.
+func (s *metaState) isAccountRevoked(addr proto.AccountAddress) bool {
+	if addr == (proto.AccountAddress{}) {
+		return false
+	}
+	for _, v := range s.readonly.revoked {
+		if v.Account == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// loadRevokedNodes returns all the revoked node ids.
+func (s *metaState) loadRevokedNodes() (nodes []proto.NodeID) {
+	for k := range s.readonly.revoked {
+		nodes = append(nodes, k)
+	}
+	return
+}
+
+// provisionNode records the provisioning token used by a new node, so that the token can not
+// be used again on any block producer. Only block producers can record provisioning tokens.
+func (s *metaState) provisionNode(tx *types.ProvisionNode, height uint32) (err error) {
+	var (
+		sender proto.AccountAddress
+		issuer proto.AccountAddress
+	)
+	if sender, err = crypto.PubKeyHash(tx.Signee); err != nil {
+		err = errors.Wrap(err, "provisionNode failed")
+		return
+	}
+	if issuer, err = crypto.PubKeyHash(tx.Token.Signee); err != nil {
+		err = errors.Wrap(err, "provisionNode failed")
+		return
+	}
+	if !s.isBlockProducer(sender) {
+		err = errors.Wrapf(ErrNotBlockProducer, "sender %s", sender)
+		return
+	}
+	if _, used := s.loadProvisionObject(tx.Token.Nonce); used {
+		err = errors.Wrapf(ErrProvisionTokenUsed, "nonce %d", tx.Token.Nonce)
+		return
+	}
+	s.dirty.provision[tx.Token.Nonce] = &types.ProvisionRecord{
+		Nonce:  tx.Token.Nonce,
+		NodeID: tx.NodeID,
+		Issuer: issuer,
+		Height: height,
+	}
+	return
+}
+
+// publishDataset records a new read-only dataset version of the database, only the database
+// owner can publish datasets and the version number is increased on each publishing.
+func (s *metaState) publishDataset(tx *types.PublishDataset, height uint32) (err error) {
+	var (
+		sender proto.AccountAddress
+		dbID   = tx.DatabaseID
+	)
+	if sender, err = crypto.PubKeyHash(tx.Signee); err != nil {
+		err = errors.Wrap(err, "publishDataset failed")
+		return
+	}
+	so, loaded := s.loadSQLChainObject(dbID)
+	if !loaded {
+		err = errors.Wrapf(ErrDatabaseNotFound, "publish dataset of %s", dbID)
+		return
+	}
+	if so.Owner != sender {
+		err = errors.Wrapf(ErrAccountPermissionDeny, "publish dataset of %s", dbID)
+		return
+	}
+	if tx.Size == 0 {
+		err = errors.Wrapf(ErrInvalidDataset, "empty dataset of %s", dbID)
+		return
+	}
+
+	po, loaded := s.loadDatasetObject(dbID)
+	if !loaded {
+		po = &types.DatasetProfile{
+			DatabaseID: dbID,
+			Owner:      so.Owner,
+		}
+	}
+	if latest := po.Latest(); latest != nil && latest.ContentHash.IsEqual(&tx.ContentHash) {
+		err = errors.Wrapf(ErrDatasetPublished, "dataset %s of %s", tx.ContentHash.String(), dbID)
+		return
+	}
+	po.Versions = append(po.Versions, &types.DatasetVersion{
+		Version:     uint32(len(po.Versions) + 1),
+		ContentHash: tx.ContentHash,
+		Size:        tx.Size,
+		BlockHash:   tx.BlockHash,
+		Height:      tx.Height,
+		Published:   height,
+	})
+	s.dirty.datasets[dbID] = po
+	return
+}
+
+// registerName registers the name to the sender if it's free or expired, or renews the name and
+// updates its target if the sender owns it. The fee of the registration periods is charged from
+// the Particle balance of the sender.
+func (s *metaState) registerName(tx *types.RegisterName, height uint32) (err error) {
+	var sender proto.AccountAddress
+	if sender, err = crypto.PubKeyHash(tx.Signee); err != nil {
+		err = errors.Wrap(err, "registerName failed")
+		return
+	}
+	if err = types.ValidateName(tx.Name); err != nil {
+		return
+	}
+	if tx.Periods > types.MaxNamePeriods {
+		err = errors.Wrapf(ErrInvalidNamePeriods, "%d periods of name %s", tx.Periods, tx.Name)
+		return
+	}
+
+	ro, loaded := s.loadNameObject(tx.Name)
+	if !loaded || ro.Expired(height) {
+		if tx.Periods == 0 {
+			err = errors.Wrapf(ErrInvalidNamePeriods, "register name %s without periods", tx.Name)
+			return
+		}
+		ro = &types.NameRecord{
+			Name:       tx.Name,
+			Owner:      sender,
+			Registered: height,
+			Expiry:     height,
+		}
+	} else if ro.Owner != sender {
+		err = errors.Wrapf(ErrNameRegistered, "name %s owned by %s", tx.Name, ro.Owner)
+		return
+	}
+
+	var fee = uint64(tx.Periods) * types.NameFeePerPeriod
+	if tx.Fee < fee {
+		err = errors.Wrapf(ErrInsufficientFee, "fee %d of name %s, %d required", tx.Fee, tx.Name, fee)
+		return
+	}
+	if fee > 0 {
+		if err = s.decreaseAccountStableBalance(sender, fee); err != nil {
+			err = errors.Wrapf(err, "charge fee of name %s", tx.Name)
+			return
+		}
+	}
+	ro.Target = tx.Target
+	ro.Expiry += tx.Periods * types.NamePeriodBlocks
+	s.dirty.names[tx.Name] = ro
+	return
+}
+
+// reserveCapacity reserves the capacity of the providers for the sender, the reservation fee of
+// each provider is paid to the provider. The reservation held by the sender is renewed.
+func (s *metaState) reserveCapacity(tx *types.ReserveCapacity, height uint32) (err error) {
+	var sender proto.AccountAddress
+	if sender, err = crypto.PubKeyHash(tx.Signee); err != nil {
+		err = errors.Wrap(err, "reserveCapacity failed")
+		return
+	}
+	if sender != tx.Owner {
+		err = errors.Wrapf(ErrInvalidSender, "reserve capacity with real sender: %s, sender: %s",
+			sender, tx.Owner)
+		return
+	}
+	if len(tx.Miners) == 0 || tx.Blocks == 0 || tx.Blocks > types.MaxReservationBlocks {
+		err = errors.Wrapf(ErrInvalidReservation, "%d miners for %d blocks", len(tx.Miners), tx.Blocks)
+		return
+	}
+
+	var (
+		reserved = make([]*types.ProviderProfile, 0, len(tx.Miners))
+		seen     = make(map[proto.AccountAddress]bool)
+		total    uint64
+	)
+	for _, m := range tx.Miners {
+		po, loaded := s.loadProviderObject(m)
+		switch {
+		case seen[m]:
+			err = errors.Wrapf(ErrInvalidReservation, "duplicate miner %s", m)
+		case !loaded:
+			err = errors.Wrapf(ErrNoSuchMiner, "miner %s", m)
+		case po.ReservationFee == 0:
+			err = errors.Wrapf(ErrMinerNotReservable, "miner %s", m)
+		case !isProviderUserMatch(po.TargetUser, sender):
+			err = errors.Wrapf(ErrMinerUserNotMatch, "miner %s", m)
+		case po.ReservationFee > tx.Fee:
+			err = errors.Wrapf(ErrInsufficientFee, "fee %d of miner %s, %d required",
+				tx.Fee, m, po.ReservationFee)
+		}
+		if err != nil {
+			return
+		}
+		if owner, ok := po.Reservation(height); ok && owner != sender {
+			err = errors.Wrapf(ErrCapacityReserved, "miner %s reserved until height %d",
+				m, po.ReservationExpiry)
+			return
+		}
+		seen[m] = true
+		if err = safeAdd(&total, &po.ReservationFee); err != nil {
+			return
+		}
+		reserved = append(reserved, po)
+	}
+
+	if err = s.decreaseAccountStableBalance(sender, total); err != nil {
+		err = errors.Wrap(err, "charge capacity reservation fee")
+		return
+	}
+	for _, po := range reserved {
+		if err = s.increaseAccountStableBalance(po.Provider, po.ReservationFee); err != nil {
+			return
+		}
+		var np = *po
+		np.ReservedBy, np.ReservationExpiry = sender, height+tx.Blocks
+		s.dirty.provider[po.Provider] = &np
+	}
+	return
+}
+
+// decommissionMiner announces or finalizes the departure of the miner, see DecommissionMiner.
+func (s *metaState) decommissionMiner(tx *types.DecommissionMiner, height uint32) (err error) {
+	var sender proto.AccountAddress
+	if sender, err = crypto.PubKeyHash(tx.Signee); err != nil {
+		err = errors.Wrap(err, "decommissionMiner failed")
+		return
+	}
+	if tx.Finalize {
+		return s.finalizeDecommission(sender)
+	}
+	return s.announceDecommission(sender, height)
+}
+
+// announceDecommission stops matching the miner for new databases. A replacement miner is added
+// to each database served by the miner, the state is untouched if any of the databases has no
+// replacement. The deposit of its provider profile is held with the miner deposit of the first
+// database left until the departure is finalized, so that it is not returned before the replicas
+// are migrated, or refunded at once if the miner serves no database.
+func (s *metaState) announceDecommission(sender proto.AccountAddress, height uint32) (err error) {
+	var (
+		po, isProvider = s.loadProviderObject(sender)
+		leaving        []*types.SQLChainProfile
+		replacements   MinerInfos
+	)
+	for _, db := range s.loadMinerSQLChains(sender) {
+		if db.Miners[minerIndex(db.Miners, sender)].Status != types.Decommissioning {
+			leaving = append(leaving, db)
+		}
+	}
+	if !isProvider && len(leaving) == 0 {
+		err = errors.Wrapf(ErrNoSuchMiner, "miner %s", sender)
+		return
+	}
+	for _, db := range leaving {
+		var (
+			req = &types.CreateDatabase{CreateDatabaseHeader: types.CreateDatabaseHeader{
+				Owner:        db.Owner,
+				ResourceMeta: db.Meta,
+				GasPrice:     db.GasPrice,
+				TokenType:    db.TokenType,
+			}}
+			// neither the miners of the database nor the replacements chosen for the others
+			selected = append(append(MinerInfos{{Address: sender}}, db.Miners...), replacements...)
+			miners   MinerInfos
+		)
+		if miners, err = s.filterNMiners(req, db.Owner, selected, 1, height); err != nil {
+			err = errors.Wrapf(err, "no replacement miner for database %s", db.ID)
+			return
+		}
+		replacements = append(replacements, miners[0])
+	}
+
+	if isProvider {
+		if len(leaving) == 0 {
+			if err = s.increaseAccountStableBalance(sender, po.Deposit); err != nil {
+				return
+			}
+		}
+		s.deleteProviderObject(sender)
+	}
+	for i, db := range leaving {
+		var leaver = db.Miners[minerIndex(db.Miners, sender)]
+		if i == 0 && isProvider {
+			leaver.Deposit += po.Deposit
+		}
+		leaver.Status = types.Decommissioning
+		leaver.DecommissionBilling = db.LastUpdatedHeight
+		db.Miners = append(db.Miners, replacements[i])
+		s.deleteProviderObject(replacements[i].Address)
+		s.dirty.databases[db.ID] = db
+	}
+	return
+}
+
+// finalizeDecommission removes the decommissioning miner from its databases and returns the
+// deposits, the billing of each database must be updated since the departure is announced, so
+// that the queries served by the miner are settled.
+func (s *metaState) finalizeDecommission(sender proto.AccountAddress) (err error) {
+	var leaving []*types.SQLChainProfile
+	for _, db := range s.loadMinerSQLChains(sender) {
+		var leaver = db.Miners[minerIndex(db.Miners, sender)]
+		if leaver.Status != types.Decommissioning {
+			continue
+		}
+		if db.GasPrice > 0 && db.LastUpdatedHeight <= leaver.DecommissionBilling {
+			err = errors.Wrapf(ErrBillingNotSettled, "database %s billed until height %d",
+				db.ID, db.LastUpdatedHeight)
+			return
+		}
+		leaving = append(leaving, db)
+	}
+	if len(leaving) == 0 {
+		err = errors.Wrapf(ErrMinerNotDecommissioning, "miner %s", sender)
+		return
+	}
+	for _, db := range leaving {
+		var i = minerIndex(db.Miners, sender)
+		if err = s.increaseAccountStableBalance(sender, db.Miners[i].Deposit); err != nil {
+			return
+		}
+		db.Miners = append(db.Miners[:i], db.Miners[i+1:]...)
+		s.dirty.databases[db.ID] = db
+	}
+	return
+}
+
+// loadMinerSQLChains returns the databases served by the miner in database id order.
+func (s *metaState) loadMinerSQLChains(addr proto.AccountAddress) (dbs []*types.SQLChainProfile) {
+	var ids = make(map[proto.DatabaseID]bool)
+	for k := range s.readonly.databases {
+		ids[k] = true
+	}
+	for k := range s.dirty.databases {
+		ids[k] = true
+	}
+	for k := range ids {
+		if db, loaded := s.loadSQLChainObject(k); loaded && minerIndex(db.Miners, addr) >= 0 {
+			dbs = append(dbs, db)
+		}
+	}
+	sort.Slice(dbs, func(i, j int) bool { return dbs[i].ID < dbs[j].ID })
+	return
+}
+
+// minerIndex returns the index of the miner in the miner list, or -1 if not found.
+func minerIndex(miners []*types.MinerInfo, addr proto.AccountAddress) int {
+	for i, m := range miners {
+		if m.Address == addr {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyMultiSig applies the wrapped transaction on behalf of the multi-signature account, the
+// member signatures are verified with the transaction before it is applied.
+func (s *metaState) applyMultiSig(tx *types.MultiSig, height uint32) (err error) {
+	var sender proto.AccountAddress
+	if sender, err = tx.Policy.Address(); err != nil {
+		err = errors.Wrap(err, "applyMultiSig failed")
+		return
+	}
+	if tx.Tx.Transaction == nil {
+		err = errors.Wrap(types.ErrMultiSigNotSupported, "empty transaction")
+		return
+	}
+	switch t := tx.Tx.Unwrap().(type) {
+	case *types.Transfer:
+		err = s.transferSQLChainTokenBalanceFrom(sender, t)
+		if err == ErrDatabaseNotFound {
+			err = s.transferAccountTokenFrom(sender, t)
+		}
+	case *types.TransferBatch:
+		err = s.transferAccountTokenBatchFrom(sender, t)
+	case *types.CreateDatabase:
+		err = s.matchProvidersWithUserFrom(sender, t, height)
+	case *types.UpdatePermission:
+		err = s.updatePermissionFrom(sender, t)
+	default:
+		err = errors.Wrapf(types.ErrMultiSigNotSupported,
+			"transaction type %s", t.GetTransactionType())
+	}
+	return
+}
+
 func (s *metaState) loadROSQLChains(addr proto.AccountAddress) (dbs []*types.SQLChainProfile) {
 	for _, db := range s.readonly.databases {
 		for _, miner := range db.Miners {
@@ -1022,7 +1748,14 @@ func (s *metaState) transferSQLChainTokenBalance(transfer *types.Transfer) (err
 		err = errors.Wrap(err, "applyTx failed")
 		return
 	}
+	return s.transferSQLChainTokenBalanceFrom(realSender, transfer)
+}
 
+// transferSQLChainTokenBalanceFrom transfers the token of the real sender to the sqlchain, see
+// transferAccountTokenFrom.
+func (s *metaState) transferSQLChainTokenBalanceFrom(
+	realSender proto.AccountAddress, transfer *types.Transfer,
+) (err error) {
 	if realSender != transfer.Sender {
 		err = errors.Wrapf(ErrInvalidSender,
 			"applyTx failed: real sender %s, sender %s", realSender, transfer.Sender)
@@ -1134,18 +1867,34 @@ func (s *metaState) applyTransaction(tx pi.Transaction, height uint32) (err erro
 			err = s.transferAccountToken(t)
 		}
 		return
+	case *types.TransferBatch:
+		err = s.transferAccountTokenBatch(t)
 	case *types.BaseAccount:
 		err = s.storeBaseAccount(t.Address, &t.Account)
 	case *types.ProvideService:
 		err = s.updateProviderList(t, height)
 	case *types.CreateDatabase:
-		err = s.matchProvidersWithUser(t)
+		err = s.matchProvidersWithUser(t, height)
 	case *types.UpdatePermission:
 		err = s.updatePermission(t)
 	case *types.IssueKeys:
 		err = s.updateKeys(t)
 	case *types.UpdateBilling:
 		err = s.updateBilling(t)
+	case *types.RevokeNode:
+		err = s.revokeNode(t, height)
+	case *types.PublishDataset:
+		err = s.publishDataset(t, height)
+	case *types.RegisterName:
+		err = s.registerName(t, height)
+	case *types.MultiSig:
+		err = s.applyMultiSig(t, height)
+	case *types.ReserveCapacity:
+		err = s.reserveCapacity(t, height)
+	case *types.DecommissionMiner:
+		err = s.decommissionMiner(t, height)
+	case *types.ProvisionNode:
+		err = s.provisionNode(t, height)
 	case *pi.TransactionWrapper:
 		// call again using unwrapped transaction
 		err = s.applyTransaction(t.Unwrap(), height)
@@ -1215,8 +1964,9 @@ func (s *metaState) apply(t pi.Transaction, height uint32) (err error) {
 
 func (s *metaState) makeCopy() *metaState {
 	return &metaState{
-		dirty:    newMetaIndex(),
-		readonly: s.readonly.deepCopy(),
+		dirty:     newMetaIndex(),
+		readonly:  s.readonly.deepCopy(),
+		producers: s.producers,
 	}
 }
 
@@ -1246,6 +1996,18 @@ func (s *metaState) compileChanges(
 			results = append(results, deleteProvider(k))
 		}
 	}
+	for _, v := range s.dirty.revoked {
+		results = append(results, addRevocation(v))
+	}
+	for _, v := range s.dirty.datasets {
+		results = append(results, updateDataset(v))
+	}
+	for _, v := range s.dirty.names {
+		results = append(results, updateName(v))
+	}
+	for _, v := range s.dirty.provision {
+		results = append(results, addProvision(v))
+	}
 	return
 }
 
@@ -17,6 +17,7 @@
 package blockproducer
 
 import (
+	"bytes"
 	"math"
 	"os"
 	"testing"
@@ -1510,3 +1511,634 @@ func TestMetaState(t *testing.T) {
 		})
 	})
 }
+
+func TestMetaStateRevokeNode(t *testing.T) {
+	Convey("Given a metaState with a provider", t, func() {
+		var (
+			ms     = newMetaState()
+			nodeID = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000001")
+		)
+		ownerKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		otherKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		owner, err := crypto.PubKeyHash(ownerKey.PubKey())
+		So(err, ShouldBeNil)
+
+		ms.loadOrStoreAccountObject(owner, &types.Account{Address: owner})
+		ms.loadOrStoreProviderObject(owner, &types.ProviderProfile{
+			Provider: owner,
+			NodeID:   nodeID,
+		})
+		ms.commit()
+
+		newRevokeNode := func(signer *asymmetric.PrivateKey) *types.RevokeNode {
+			tx := types.NewRevokeNode(&types.RevokeNodeHeader{
+				NodeID: nodeID,
+				Reason: "key leaked",
+			})
+			So(tx.Sign(signer), ShouldBeNil)
+			return tx
+		}
+
+		Convey("The node should not be revoked by other accounts", func() {
+			err = ms.revokeNode(newRevokeNode(otherKey), 1)
+			So(errors.Cause(err), ShouldEqual, ErrNotNodeOwner)
+		})
+
+		Convey("The node should be revoked by the genesis block producer", func() {
+			bp, err := crypto.PubKeyHash(otherKey.PubKey())
+			So(err, ShouldBeNil)
+			ms.setBlockProducers(&types.BPBlock{
+				SignedHeader: types.BPSignedHeader{BPHeader: types.BPHeader{Producer: bp}},
+			})
+			err = ms.revokeNode(newRevokeNode(otherKey), 1)
+			So(err, ShouldBeNil)
+			ms.commit()
+			So(ms.isAccountRevoked(owner), ShouldBeTrue)
+			So(ms.isAccountRevoked(bp), ShouldBeFalse)
+		})
+
+		Convey("The owner should be chosen regardless of the map order", func() {
+			var others []proto.AccountAddress
+			for i := 0; i < 16; i++ {
+				var addr = proto.AccountAddress(hash.HashH([]byte{byte(i)}))
+				ms.loadOrStoreProviderObject(addr, &types.ProviderProfile{
+					Provider: addr,
+					NodeID:   nodeID,
+				})
+				others = append(others, addr)
+			}
+			var least = owner
+			for _, v := range others {
+				if bytes.Compare(v[:], least[:]) < 0 {
+					least = v
+				}
+			}
+			for i := 0; i < 8; i++ {
+				po, loaded := ms.loadProviderObjectByNodeID(nodeID)
+				So(loaded, ShouldBeTrue)
+				So(po.Provider, ShouldEqual, least)
+			}
+		})
+
+		Convey("The node should be revoked by the owner", func() {
+			err = ms.revokeNode(newRevokeNode(ownerKey), 1)
+			So(err, ShouldBeNil)
+			ms.commit()
+
+			_, loaded := ms.loadProviderObject(owner)
+			So(loaded, ShouldBeFalse)
+			So(ms.loadRevokedNodes(), ShouldResemble, []proto.NodeID{nodeID})
+			So(ms.isAccountRevoked(owner), ShouldBeTrue)
+
+			Convey("The revoked node should not provide service again", func() {
+				tx := types.NewProvideService(&types.ProvideServiceHeader{NodeID: nodeID})
+				So(tx.Sign(ownerKey), ShouldBeNil)
+				err = ms.updateProviderList(tx, 1)
+				So(errors.Cause(err), ShouldEqual, ErrNodeRevoked)
+
+				err = ms.revokeNode(newRevokeNode(ownerKey), 2)
+				So(errors.Cause(err), ShouldEqual, ErrNodeRevoked)
+			})
+		})
+	})
+}
+
+func TestMetaStatePublishDataset(t *testing.T) {
+	Convey("Given a metaState with a database", t, func() {
+		var (
+			ms   = newMetaState()
+			dbID = proto.DatabaseID("dataset-db")
+		)
+		ownerKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		otherKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		owner, err := crypto.PubKeyHash(ownerKey.PubKey())
+		So(err, ShouldBeNil)
+
+		ms.loadOrStoreSQLChainObject(dbID, &types.SQLChainProfile{
+			ID:    dbID,
+			Owner: owner,
+		})
+		ms.commit()
+
+		newPublishDataset := func(signer *asymmetric.PrivateKey, content string) *types.PublishDataset {
+			tx := types.NewPublishDataset(&types.PublishDatasetHeader{
+				DatabaseID:  dbID,
+				ContentHash: hash.THashH([]byte(content)),
+				Size:        uint64(len(content)),
+			})
+			So(tx.Sign(signer), ShouldBeNil)
+			return tx
+		}
+
+		Convey("The dataset should not be published by other accounts", func() {
+			err = ms.publishDataset(newPublishDataset(otherKey, "v1"), 1)
+			So(errors.Cause(err), ShouldEqual, ErrAccountPermissionDeny)
+		})
+
+		Convey("The dataset versions should be published by the owner", func() {
+			err = ms.publishDataset(newPublishDataset(ownerKey, "v1"), 1)
+			So(err, ShouldBeNil)
+			err = ms.publishDataset(newPublishDataset(ownerKey, "v1"), 1)
+			So(errors.Cause(err), ShouldEqual, ErrDatasetPublished)
+			err = ms.publishDataset(newPublishDataset(ownerKey, "v2"), 2)
+			So(err, ShouldBeNil)
+			ms.commit()
+
+			po, loaded := ms.loadDatasetObject(dbID)
+			So(loaded, ShouldBeTrue)
+			So(po.Owner, ShouldEqual, owner)
+			So(po.Versions, ShouldHaveLength, 2)
+			So(po.Get(1).ContentHash, ShouldResemble, hash.THashH([]byte("v1")))
+			So(po.Get(0).Version, ShouldEqual, 2)
+			So(po.Get(0).Published, ShouldEqual, 2)
+			So(po.Get(3), ShouldBeNil)
+		})
+	})
+}
+
+func TestMetaStateRegisterName(t *testing.T) {
+	Convey("Given a metaState with funded accounts", t, func() {
+		var ms = newMetaState()
+		ownerKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		otherKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		owner, err := crypto.PubKeyHash(ownerKey.PubKey())
+		So(err, ShouldBeNil)
+		other, err := crypto.PubKeyHash(otherKey.PubKey())
+		So(err, ShouldBeNil)
+
+		for _, addr := range []proto.AccountAddress{owner, other} {
+			ms.loadOrStoreAccountObject(addr, &types.Account{Address: addr})
+			So(ms.increaseAccountStableBalance(addr, 10*types.NameFeePerPeriod), ShouldBeNil)
+		}
+		ms.commit()
+
+		newRegisterName := func(
+			signer *asymmetric.PrivateKey, name string, target proto.AccountAddress, periods uint32,
+		) *types.RegisterName {
+			tx := types.NewRegisterName(&types.RegisterNameHeader{
+				Name:    name,
+				Target:  target,
+				Periods: periods,
+				Fee:     uint64(periods) * types.NameFeePerPeriod,
+			})
+			So(tx.Sign(signer), ShouldBeNil)
+			return tx
+		}
+
+		Convey("Invalid names and periods should be rejected", func() {
+			err = ms.registerName(newRegisterName(ownerKey, "Alice", owner, 1), 1)
+			So(errors.Cause(err), ShouldEqual, types.ErrInvalidName)
+			err = ms.registerName(newRegisterName(ownerKey, "alice", owner, 0), 1)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidNamePeriods)
+			err = ms.registerName(newRegisterName(ownerKey, "alice", owner, types.MaxNamePeriods+1), 1)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidNamePeriods)
+			tx := newRegisterName(ownerKey, "alice", owner, 1)
+			tx.Fee = 0
+			So(tx.Sign(ownerKey), ShouldBeNil)
+			err = ms.registerName(tx, 1)
+			So(errors.Cause(err), ShouldEqual, ErrInsufficientFee)
+		})
+
+		Convey("The name should be owned by the first registrant until expiry", func() {
+			err = ms.registerName(newRegisterName(ownerKey, "alice", owner, 2), 1)
+			So(err, ShouldBeNil)
+			ms.commit()
+
+			ro, loaded := ms.loadNameObject("alice")
+			So(loaded, ShouldBeTrue)
+			So(ro.Owner, ShouldEqual, owner)
+			So(ro.Target, ShouldEqual, owner)
+			So(ro.Expiry, ShouldEqual, 1+2*types.NamePeriodBlocks)
+			bl, loaded := ms.loadAccountTokenBalance(owner, types.Particle)
+			So(loaded, ShouldBeTrue)
+			So(bl, ShouldEqual, 8*types.NameFeePerPeriod)
+
+			err = ms.registerName(newRegisterName(otherKey, "alice", other, 1), 2)
+			So(errors.Cause(err), ShouldEqual, ErrNameRegistered)
+
+			err = ms.registerName(newRegisterName(ownerKey, "alice", other, 0), 2)
+			So(err, ShouldBeNil)
+			ms.commit()
+			ro, _ = ms.loadNameObject("alice")
+			So(ro.Target, ShouldEqual, other)
+			So(ro.Expiry, ShouldEqual, 1+2*types.NamePeriodBlocks)
+
+			expiry := ro.Expiry
+			err = ms.registerName(newRegisterName(otherKey, "alice", other, 1), expiry)
+			So(err, ShouldBeNil)
+			ms.commit()
+			ro, _ = ms.loadNameObject("alice")
+			So(ro.Owner, ShouldEqual, other)
+			So(ro.Registered, ShouldEqual, expiry)
+			So(ro.Expiry, ShouldEqual, expiry+types.NamePeriodBlocks)
+		})
+	})
+}
+
+func TestMetaStateMultiSig(t *testing.T) {
+	Convey("Given a metaState with a funded multi-signature account", t, func() {
+		var (
+			ms     = newMetaState()
+			policy = &types.MultiSigPolicy{Threshold: 2}
+			privs  []*asymmetric.PrivateKey
+		)
+		for i := 0; i < 3; i++ {
+			priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			privs = append(privs, priv)
+			policy.PubKeys = append(policy.PubKeys, pub)
+		}
+		addr, err := policy.Address()
+		So(err, ShouldBeNil)
+		member, err := crypto.PubKeyHash(policy.PubKeys[0])
+		So(err, ShouldBeNil)
+
+		ms.loadOrStoreAccountObject(addr, &types.Account{Address: addr})
+		So(ms.increaseAccountStableBalance(addr, 100), ShouldBeNil)
+		ms.commit()
+
+		Convey("The transfer of the account should be applied on behalf of it", func() {
+			tx, err := types.NewMultiSig(policy, types.NewTransfer(&types.TransferHeader{
+				Sender:    addr,
+				Receiver:  member,
+				Amount:    40,
+				TokenType: types.Particle,
+			}))
+			So(err, ShouldBeNil)
+			So(tx.Sign(privs[0]), ShouldBeNil)
+			So(tx.Sign(privs[1]), ShouldBeNil)
+			So(tx.Verify(), ShouldBeNil)
+
+			So(ms.apply(tx, 1), ShouldBeNil)
+			ms.commit()
+			bl, loaded := ms.loadAccountTokenBalance(addr, types.Particle)
+			So(loaded, ShouldBeTrue)
+			So(bl, ShouldEqual, 60)
+			bl, loaded = ms.loadAccountTokenBalance(member, types.Particle)
+			So(loaded, ShouldBeTrue)
+			So(bl, ShouldEqual, 40)
+			nonce, err := ms.nextNonce(addr)
+			So(err, ShouldBeNil)
+			So(nonce, ShouldEqual, 1)
+		})
+
+		Convey("The member should not spend the account alone", func() {
+			tx := types.NewTransfer(&types.TransferHeader{
+				Sender:    addr,
+				Receiver:  member,
+				Amount:    40,
+				TokenType: types.Particle,
+			})
+			So(tx.Sign(privs[0]), ShouldBeNil)
+			err = ms.applyTransaction(tx, 1)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidSender)
+		})
+	})
+}
+
+func TestMetaStateReserveCapacity(t *testing.T) {
+	Convey("Given a metaState with reservable providers", t, func() {
+		var ms = newMetaState()
+		ownerKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		otherKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		owner, err := crypto.PubKeyHash(ownerKey.PubKey())
+		So(err, ShouldBeNil)
+		other, err := crypto.PubKeyHash(otherKey.PubKey())
+		So(err, ShouldBeNil)
+		var (
+			reservable = proto.AccountAddress(hash.HashH([]byte("reservable")))
+			fixed      = proto.AccountAddress(hash.HashH([]byte("fixed")))
+		)
+		for _, addr := range []proto.AccountAddress{owner, other, reservable, fixed} {
+			ms.loadOrStoreAccountObject(addr, &types.Account{Address: addr})
+			So(ms.increaseAccountStableBalance(addr, 1000), ShouldBeNil)
+		}
+		ms.loadOrStoreProviderObject(reservable, &types.ProviderProfile{
+			Provider: reservable, NodeID: "00000001", GasPrice: 1, ReservationFee: 100,
+		})
+		ms.loadOrStoreProviderObject(fixed, &types.ProviderProfile{
+			Provider: fixed, NodeID: "00000002", GasPrice: 1,
+		})
+		ms.commit()
+
+		newReserve := func(
+			signer *asymmetric.PrivateKey, sender proto.AccountAddress, blocks uint32, fee uint64,
+			miners ...proto.AccountAddress,
+		) *types.ReserveCapacity {
+			tx := types.NewReserveCapacity(&types.ReserveCapacityHeader{
+				Owner:  sender,
+				Miners: miners,
+				Blocks: blocks,
+				Fee:    fee,
+			})
+			So(tx.Sign(signer), ShouldBeNil)
+			return tx
+		}
+		newCreate := func(user proto.AccountAddress) *types.CreateDatabase {
+			return types.NewCreateDatabase(&types.CreateDatabaseHeader{
+				Owner:        user,
+				ResourceMeta: types.ResourceMeta{Node: 1},
+				GasPrice:     1,
+			})
+		}
+
+		Convey("Invalid reservations should be rejected", func() {
+			err = ms.reserveCapacity(newReserve(ownerKey, owner, 0, 100, reservable), 1)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidReservation)
+			err = ms.reserveCapacity(newReserve(ownerKey, owner, types.MaxReservationBlocks+1, 100, reservable), 1)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidReservation)
+			err = ms.reserveCapacity(newReserve(ownerKey, owner, 10, 100, reservable, reservable), 1)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidReservation)
+			err = ms.reserveCapacity(newReserve(ownerKey, other, 10, 100, reservable), 1)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidSender)
+			err = ms.reserveCapacity(newReserve(ownerKey, owner, 10, 100, fixed), 1)
+			So(errors.Cause(err), ShouldEqual, ErrMinerNotReservable)
+			err = ms.reserveCapacity(newReserve(ownerKey, owner, 10, 99, reservable), 1)
+			So(errors.Cause(err), ShouldEqual, ErrInsufficientFee)
+		})
+		Convey("Reserved capacity should only be matched for the owner", func() {
+			So(ms.reserveCapacity(newReserve(ownerKey, owner, 10, 100, reservable), 1), ShouldBeNil)
+			ms.commit()
+			balance, _ := ms.loadAccountTokenBalance(owner, types.Particle)
+			So(balance, ShouldEqual, 900)
+			balance, _ = ms.loadAccountTokenBalance(reservable, types.Particle)
+			So(balance, ShouldEqual, 1100)
+
+			// the other owner could neither reserve nor match the capacity
+			err = ms.reserveCapacity(newReserve(otherKey, other, 10, 100, reservable), 5)
+			So(errors.Cause(err), ShouldEqual, ErrCapacityReserved)
+			miners, err := ms.selectMiners(newCreate(other), other, 5, false)
+			So(err, ShouldBeNil)
+			So(miners, ShouldHaveLength, 1)
+			So(miners[0].Address, ShouldEqual, fixed)
+
+			// the reserved capacity is selected for the owner first
+			miners, err = ms.selectMiners(newCreate(owner), owner, 5, false)
+			So(err, ShouldBeNil)
+			So(miners, ShouldHaveLength, 1)
+			So(miners[0].Address, ShouldEqual, reservable)
+
+			// the matched target miners are accepted by the state transition only
+			create := newCreate(other)
+			create.ResourceMeta.Node = 2
+			create.ResourceMeta.TargetMiners = []proto.AccountAddress{reservable, fixed}
+			miners, err = ms.selectMiners(create, other, 5, false)
+			So(err, ShouldBeNil)
+			So(miners, ShouldHaveLength, 1)
+			_, err = ms.selectMiners(create, other, 5, true)
+			So(errors.Cause(err), ShouldEqual, ErrNoEnoughMiner)
+
+			// the reservation is recorded on the provider profile
+			po, _ := ms.loadProviderObject(reservable)
+			So(po.ReservedBy, ShouldEqual, owner)
+			So(po.ReservationExpiry, ShouldEqual, 11)
+
+			// the capacity is released after the reservation expires
+			So(ms.reserveCapacity(newReserve(otherKey, other, 10, 100, reservable), 11), ShouldBeNil)
+		})
+	})
+}
+
+func TestMetaStateDecommissionMiner(t *testing.T) {
+	Convey("Given a metaState with a miner serving a database", t, func() {
+		var ms = newMetaState()
+		minerKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		miner, err := crypto.PubKeyHash(minerKey.PubKey())
+		So(err, ShouldBeNil)
+		var (
+			dbID  = proto.DatabaseID("decommission")
+			owner = proto.AccountAddress(hash.HashH([]byte("owner")))
+			peer  = proto.AccountAddress(hash.HashH([]byte("peer")))
+			spare = proto.AccountAddress(hash.HashH([]byte("spare")))
+		)
+		for _, addr := range []proto.AccountAddress{owner, miner, peer, spare} {
+			ms.loadOrStoreAccountObject(addr, &types.Account{Address: addr})
+			So(ms.increaseAccountStableBalance(addr, 1000), ShouldBeNil)
+		}
+		ms.loadOrStoreProviderObject(miner, &types.ProviderProfile{
+			Provider: miner, NodeID: "00000001", GasPrice: 1, Deposit: 50,
+		})
+		ms.loadOrStoreProviderObject(spare, &types.ProviderProfile{
+			Provider: spare, NodeID: "00000003", GasPrice: 1, Deposit: 50,
+		})
+		ms.loadOrStoreSQLChainObject(dbID, &types.SQLChainProfile{
+			ID:       dbID,
+			Owner:    owner,
+			GasPrice: 1,
+			Meta:     types.ResourceMeta{Node: 2},
+			Miners: []*types.MinerInfo{
+				{Address: miner, NodeID: "00000001", Deposit: 100},
+				{Address: peer, NodeID: "00000002", Deposit: 100},
+			},
+		})
+		ms.commit()
+
+		newDecommission := func(finalize bool) *types.DecommissionMiner {
+			tx := types.NewDecommissionMiner(&types.DecommissionMinerHeader{Finalize: finalize})
+			So(tx.Sign(minerKey), ShouldBeNil)
+			return tx
+		}
+
+		Convey("The departure should not be finalized before announced", func() {
+			err = ms.decommissionMiner(newDecommission(true), 1)
+			So(errors.Cause(err), ShouldEqual, ErrMinerNotDecommissioning)
+		})
+		Convey("The announcement should be rejected without replacement", func() {
+			ms.deleteProviderObject(spare)
+			ms.commit()
+			err = ms.decommissionMiner(newDecommission(false), 1)
+			So(errors.Cause(err), ShouldEqual, ErrNoEnoughMiner)
+			_, loaded := ms.loadProviderObject(miner)
+			So(loaded, ShouldBeTrue)
+			db, _ := ms.loadSQLChainObject(dbID)
+			So(db.Miners, ShouldHaveLength, 2)
+		})
+		Convey("The replicas should be migrated before the deposits are returned", func() {
+			So(ms.decommissionMiner(newDecommission(false), 1), ShouldBeNil)
+			ms.commit()
+			// the provider deposit is held until the replicas are migrated
+			balance, _ := ms.loadAccountTokenBalance(miner, types.Particle)
+			So(balance, ShouldEqual, 1000)
+			_, loaded := ms.loadProviderObject(miner)
+			So(loaded, ShouldBeFalse)
+			_, loaded = ms.loadProviderObject(spare)
+			So(loaded, ShouldBeFalse)
+			db, _ := ms.loadSQLChainObject(dbID)
+			So(db.Miners, ShouldHaveLength, 3)
+			So(db.Miners[0].Status, ShouldEqual, types.Decommissioning)
+			So(db.Miners[0].Deposit, ShouldEqual, 150)
+			So(db.Miners[2].Address, ShouldEqual, spare)
+
+			// the queries served by the miner are billed first
+			err = ms.decommissionMiner(newDecommission(true), 2)
+			So(errors.Cause(err), ShouldEqual, ErrBillingNotSettled)
+			balance, _ = ms.loadAccountTokenBalance(miner, types.Particle)
+			So(balance, ShouldEqual, 1000)
+			db.LastUpdatedHeight = 10
+			ms.dirty.databases[dbID] = db
+			ms.commit()
+
+			So(ms.decommissionMiner(newDecommission(true), 3), ShouldBeNil)
+			ms.commit()
+			balance, _ = ms.loadAccountTokenBalance(miner, types.Particle)
+			So(balance, ShouldEqual, 1150)
+			db, _ = ms.loadSQLChainObject(dbID)
+			So(db.Miners, ShouldHaveLength, 2)
+			So(db.Miners[0].Address, ShouldEqual, peer)
+			So(db.Miners[1].Address, ShouldEqual, spare)
+			err = ms.decommissionMiner(newDecommission(true), 4)
+			So(errors.Cause(err), ShouldEqual, ErrMinerNotDecommissioning)
+		})
+	})
+}
+
+func TestMetaStateTransferBatch(t *testing.T) {
+	Convey("Given a metaState with a funded account", t, func() {
+		var ms = newMetaState()
+		senderKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		sender, err := crypto.PubKeyHash(senderKey.PubKey())
+		So(err, ShouldBeNil)
+		var (
+			alice = proto.AccountAddress{0x1}
+			bob   = proto.AccountAddress{0x2}
+			dbID  = proto.FromAccountAndNonce(sender, 1)
+		)
+		dbAddr, err := dbID.AccountAddress()
+		So(err, ShouldBeNil)
+
+		ms.loadOrStoreAccountObject(sender, &types.Account{Address: sender})
+		So(ms.increaseAccountStableBalance(sender, 100), ShouldBeNil)
+		ms.loadOrStoreAccountObject(alice, &types.Account{Address: alice})
+		So(ms.increaseAccountStableBalance(alice, 5), ShouldBeNil)
+		ms.dirty.databases[dbID] = &types.SQLChainProfile{ID: dbID, Address: dbAddr}
+		ms.commit()
+
+		newBatch := func(receivers ...types.TransferReceiver) *types.TransferBatch {
+			tx := types.NewTransferBatch(&types.TransferBatchHeader{
+				Sender:    sender,
+				Receivers: receivers,
+				TokenType: types.Particle,
+			})
+			So(tx.Sign(senderKey), ShouldBeNil)
+			return tx
+		}
+
+		Convey("The tokens should be transferred to all receivers", func() {
+			err = ms.applyTransaction(newBatch(
+				types.TransferReceiver{Receiver: alice, Amount: 10},
+				types.TransferReceiver{Receiver: bob, Amount: 20},
+				types.TransferReceiver{Receiver: alice, Amount: 30},
+				types.TransferReceiver{Receiver: sender, Amount: 40},
+			), 1)
+			So(err, ShouldBeNil)
+			ms.commit()
+			for addr, expected := range map[proto.AccountAddress]uint64{
+				sender: 40,
+				alice:  45,
+				bob:    20,
+			} {
+				bl, loaded := ms.loadAccountTokenBalance(addr, types.Particle)
+				So(loaded, ShouldBeTrue)
+				So(bl, ShouldEqual, expected)
+			}
+		})
+
+		Convey("The batch should be applied as a whole", func() {
+			err = ms.applyTransaction(newBatch(
+				types.TransferReceiver{Receiver: alice, Amount: 60},
+				types.TransferReceiver{Receiver: bob, Amount: 60},
+			), 1)
+			So(errors.Cause(err), ShouldEqual, ErrInsufficientBalance)
+			err = ms.applyTransaction(newBatch(
+				types.TransferReceiver{Receiver: bob, Amount: 10},
+				types.TransferReceiver{Receiver: dbAddr, Amount: 10},
+			), 1)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidTransferBatch)
+			err = ms.applyTransaction(newBatch(), 1)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidTransferBatch)
+			ms.commit()
+
+			bl, loaded := ms.loadAccountTokenBalance(sender, types.Particle)
+			So(loaded, ShouldBeTrue)
+			So(bl, ShouldEqual, 100)
+			_, loaded = ms.loadAccountObject(bob)
+			So(loaded, ShouldBeFalse)
+		})
+
+		Convey("The batch should be signed by the sender", func() {
+			otherKey, _, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			tx := newBatch(types.TransferReceiver{Receiver: bob, Amount: 10})
+			So(tx.Sign(otherKey), ShouldBeNil)
+			err = ms.applyTransaction(tx, 1)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidSender)
+		})
+	})
+}
+
+func TestMetaStateProvisionNode(t *testing.T) {
+	Convey("Given a metaState and a block producer", t, func() {
+		var (
+			ms     = newMetaState()
+			nodeID = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000001")
+		)
+		bpKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		otherKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		issuerKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+
+		bp, err := crypto.PubKeyHash(bpKey.PubKey())
+		So(err, ShouldBeNil)
+		ms.setBlockProducers(&types.BPBlock{
+			SignedHeader: types.BPSignedHeader{BPHeader: types.BPHeader{Producer: bp}},
+		})
+
+		token := proto.ProvisionToken{
+			ProvisionTokenHeader: proto.ProvisionTokenHeader{
+				Role:  proto.Miner,
+				Nonce: 1,
+			},
+		}
+		So(token.Sign(issuerKey), ShouldBeNil)
+		newProvisionNode := func(signer *asymmetric.PrivateKey) *types.ProvisionNode {
+			tx := types.NewProvisionNode(&types.ProvisionNodeHeader{
+				Token:  token,
+				NodeID: nodeID,
+			})
+			So(tx.Sign(signer), ShouldBeNil)
+			So(tx.Verify(), ShouldBeNil)
+			return tx
+		}
+
+		Convey("The token should not be recorded by other accounts", func() {
+			err = ms.provisionNode(newProvisionNode(otherKey), 1)
+			So(errors.Cause(err), ShouldEqual, ErrNotBlockProducer)
+		})
+
+		Convey("The token should be recorded once by block producer", func() {
+			err = ms.provisionNode(newProvisionNode(bpKey), 1)
+			So(err, ShouldBeNil)
+			err = ms.provisionNode(newProvisionNode(bpKey), 1)
+			So(errors.Cause(err), ShouldEqual, ErrProvisionTokenUsed)
+			ms.commit()
+
+			record, loaded := ms.loadProvisionObject(token.Nonce)
+			So(loaded, ShouldBeTrue)
+			So(record.NodeID, ShouldEqual, nodeID)
+			err = ms.provisionNode(newProvisionNode(bpKey), 2)
+			So(errors.Cause(err), ShouldEqual, ErrProvisionTokenUsed)
+		})
+	})
+}
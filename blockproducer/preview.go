@@ -0,0 +1,117 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+// previewCreateDatabase evaluates the database creation without the signature and balance
+// changes, and reports all the providers with the ones which would be selected.
+func (s *metaState) previewCreateDatabase(tx *types.CreateDatabase, height uint32) (
+	resp *types.PreviewCreateDatabaseResp,
+) {
+	var (
+		owner      = tx.Owner
+		minerCount = uint64(tx.ResourceMeta.Node)
+		selected   = make(map[proto.AccountAddress]bool)
+		err        error
+	)
+	resp = &types.PreviewCreateDatabaseResp{
+		MinAdvancePayment: minDeposit(tx.GasPrice, minerCount),
+	}
+	resp.Balance, _ = s.loadAccountTokenBalance(owner, tx.TokenType)
+
+	for _, po := range s.loadAllProviders() {
+		var c = types.MinerCandidate{
+			Address:       po.Provider,
+			NodeID:        po.NodeID,
+			Space:         po.Space,
+			Memory:        po.Memory,
+			LoadAvgPerCPU: po.LoadAvgPerCPU,
+			GasPrice:      po.GasPrice,
+			Deposit:       po.Deposit,
+
+			ReservationFee: po.ReservationFee,
+		}
+		if o, loaded := s.loadAccountObject(po.Provider); loaded {
+			c.Rating = o.Rating
+		}
+		if _, err = filterAndAppendMiner(nil, po, tx, owner, height); err != nil {
+			c.Mismatch = err.Error()
+		}
+		resp.Candidates = append(resp.Candidates, c)
+	}
+
+	switch {
+	case tx.GasPrice <= 0:
+		err = ErrInvalidGasPrice
+	case minerCount == 0:
+		err = ErrInvalidMinerCount
+	case tx.AdvancePayment < resp.MinAdvancePayment:
+		err = ErrInsufficientAdvancePayment
+	case resp.Balance < resp.MinAdvancePayment+tx.AdvancePayment:
+		err = errors.Wrapf(ErrInsufficientBalance, "balance %d, required %d",
+			resp.Balance, resp.MinAdvancePayment+tx.AdvancePayment)
+	default:
+		var miners MinerInfos
+		if miners, err = s.selectMiners(tx, owner, height, true); err == nil {
+			for _, m := range miners {
+				selected[m.Address] = true
+			}
+		}
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	for i := range resp.Candidates {
+		resp.Candidates[i].Selected = selected[resp.Candidates[i].Address]
+	}
+	sort.Slice(resp.Candidates, func(i, j int) bool {
+		var ci, cj = resp.Candidates[i], resp.Candidates[j]
+		if ci.Selected != cj.Selected {
+			return ci.Selected
+		}
+		return ci.NodeID < cj.NodeID
+	})
+	return
+}
+
+// previewCreateDatabase previews the database creation on the head branch state.
+func (c *Chain) previewCreateDatabase(header *types.CreateDatabaseHeader) (
+	resp *types.PreviewCreateDatabaseResp,
+) {
+	var tx = types.NewCreateDatabase(header)
+	func() {
+		c.RLock()
+		defer c.RUnlock()
+		resp = c.headBranch.preview.previewCreateDatabase(tx, c.headBranch.head.height+1)
+	}()
+	for i := range resp.Candidates {
+		if node, err := kms.GetNodeInfo(resp.Candidates[i].NodeID); err == nil && node != nil {
+			resp.Candidates[i].NodeAddr = node.Addr
+		}
+	}
+	return
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestPreviewCreateDatabase(t *testing.T) {
+	Convey("Given a meta state with providers", t, func() {
+		var (
+			err   error
+			ms    = newMetaState()
+			owner = proto.AccountAddress(hash.HashH([]byte("owner")))
+			small = proto.AccountAddress(hash.HashH([]byte("small")))
+			large = proto.AccountAddress(hash.HashH([]byte("large")))
+		)
+		conf.GConf, err = conf.LoadConfig("../test/node_standalone/config.yaml")
+		So(err, ShouldBeNil)
+
+		account := &types.Account{Address: owner}
+		account.TokenBalance[types.Particle] = 1 << 40
+		ms.readonly.accounts[owner] = account
+		ms.readonly.accounts[large] = &types.Account{Address: large, Rating: 0.9}
+		ms.readonly.provider[small] = &types.ProviderProfile{
+			Provider: small, NodeID: "00000001", Memory: 1 << 20, GasPrice: 1,
+		}
+		ms.readonly.provider[large] = &types.ProviderProfile{
+			Provider: large, NodeID: "00000002", Memory: 1 << 30, GasPrice: 1,
+		}
+
+		header := &types.CreateDatabaseHeader{
+			Owner:        owner,
+			ResourceMeta: types.ResourceMeta{Node: 1, Memory: 1 << 30},
+			GasPrice:     1,
+		}
+		header.AdvancePayment = minDeposit(1, 1)
+
+		Convey("The preview should select the matching provider", func() {
+			resp := ms.previewCreateDatabase(types.NewCreateDatabase(header), 0)
+			So(resp.Error, ShouldBeEmpty)
+			So(resp.Candidates, ShouldHaveLength, 2)
+			So(resp.Candidates[0].Address, ShouldEqual, large)
+			So(resp.Candidates[0].Selected, ShouldBeTrue)
+			So(resp.Candidates[0].Rating, ShouldEqual, 0.9)
+			So(resp.Candidates[1].Selected, ShouldBeFalse)
+			So(resp.Candidates[1].Mismatch, ShouldContainSubstring, "memory")
+			// nothing is changed by the preview
+			So(ms.dirty.databases, ShouldBeEmpty)
+			So(ms.loadAllProviders(), ShouldHaveLength, 2)
+		})
+		Convey("The preview should report the failure reason", func() {
+			header.ResourceMeta.Node = 2
+			header.AdvancePayment = minDeposit(1, 2)
+			resp := ms.previewCreateDatabase(types.NewCreateDatabase(header), 0)
+			So(resp.Error, ShouldContainSubstring, ErrNoEnoughMiner.Error())
+			header.AdvancePayment = 0
+			resp = ms.previewCreateDatabase(types.NewCreateDatabase(header), 0)
+			So(resp.Error, ShouldEqual, ErrInsufficientAdvancePayment.Error())
+		})
+	})
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+// IsProvisionTokenUsed implements route.ProvisionLedger.IsProvisionTokenUsed. A token is used if
+// it is recorded in the head branch or pending in the transaction pool.
+func (c *Chain) IsProvisionTokenUsed(nonce uint64) bool {
+	c.RLock()
+	defer c.RUnlock()
+	if _, ok := c.headBranch.preview.loadProvisionObject(nonce); ok {
+		return true
+	}
+	for _, v := range c.txPool {
+		if w, ok := v.(*pi.TransactionWrapper); ok {
+			v = w.Unwrap()
+		}
+		if pn, ok := v.(*types.ProvisionNode); ok && pn.Token.Nonce == nonce {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordProvisionToken implements route.ProvisionLedger.RecordProvisionToken. It adds a
+// ProvisionNode transaction signed by the local block producer to the transaction pool and
+// broadcasts it to the other block producers.
+func (c *Chain) RecordProvisionToken(t *proto.ProvisionToken, node proto.NodeID) (err error) {
+	c.provisionLock.Lock()
+	defer c.provisionLock.Unlock()
+
+	priv, err := kms.GetLocalPrivateKey()
+	if err != nil {
+		return
+	}
+	nonce, err := c.pooledNextNonce(c.address)
+	if err != nil {
+		return
+	}
+	var tx = types.NewProvisionNode(&types.ProvisionNodeHeader{
+		Token:  *t,
+		NodeID: node,
+		Nonce:  nonce,
+	})
+	if err = tx.Sign(priv); err != nil {
+		return
+	}
+	if err = c.storeTx(tx); err != nil {
+		return
+	}
+	c.nonblockingBroadcastTx(conf.MaxTxBroadcastTTL, tx)
+	return
+}
+
+// pooledNextNonce returns the next nonce of the account after its pending transactions.
+func (c *Chain) pooledNextNonce(addr proto.AccountAddress) (n pi.AccountNonce, err error) {
+	c.RLock()
+	defer c.RUnlock()
+	if n, err = c.headBranch.preview.nextNonce(addr); err != nil {
+		return
+	}
+	for _, v := range c.txPool {
+		if v.GetAccountAddress() == addr && v.GetAccountNonce() >= n {
+			n = v.GetAccountNonce() + 1
+		}
+	}
+	return
+}
@@ -17,6 +17,8 @@
 package blockproducer
 
 import (
+	"time"
+
 	"github.com/pkg/errors"
 
 	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
@@ -49,14 +51,28 @@ func (s *ChainRPCService) FetchBlock(req *types.FetchBlockReq, resp *types.Fetch
 // FetchLastIrreversibleBlock fetches the last block irreversible block from block producer.
 func (s *ChainRPCService) FetchLastIrreversibleBlock(
 	req *types.FetchLastIrreversibleBlockReq, resp *types.FetchLastIrreversibleBlockResp) error {
-	b, c, h, err := s.chain.fetchLastIrreversibleBlock()
+	v, err := s.chain.rpcCache.load("lib:"+req.Address.String(), func() (interface{}, error) {
+		var r = &types.FetchLastIrreversibleBlockResp{}
+		b, c, h, err := s.chain.fetchLastIrreversibleBlock()
+		if err != nil {
+			return nil, err
+		}
+		r.Block = b
+		r.Count = c
+		r.Height = h
+		r.SQLChains = s.chain.loadSQLChainProfiles(req.Address)
+		r.RevokedNodes = s.chain.loadRevokedNodes()
+		return r, nil
+	})
 	if err != nil {
 		return err
 	}
-	resp.Block = b
-	resp.Count = c
-	resp.Height = h
-	resp.SQLChains = s.chain.loadSQLChainProfiles(req.Address)
+	var r = v.(*types.FetchLastIrreversibleBlockResp)
+	resp.Block = r.Block
+	resp.Count = r.Count
+	resp.Height = r.Height
+	resp.SQLChains = r.SQLChains
+	resp.RevokedNodes = r.RevokedNodes
 	return nil
 }
 
@@ -72,6 +88,22 @@ func (s *ChainRPCService) FetchBlockByCount(req *types.FetchBlockByCountReq, res
 	return err
 }
 
+// QueryTime is the RPC method to query the local time of the target server.
+func (s *ChainRPCService) QueryTime(req *types.QueryTimeReq, resp *types.QueryTimeResp) error {
+	resp.Time = time.Now().UTC()
+	return nil
+}
+
+// QueryBuildInfos is the RPC method to query the build info distribution of the network.
+func (s *ChainRPCService) QueryBuildInfos(req *types.QueryBuildInfosReq, resp *types.QueryBuildInfosResp) error {
+	resp.Nodes = s.chain.queryBuildInfos()
+	resp.Versions = make(map[string]uint32)
+	for _, n := range resp.Nodes {
+		resp.Versions[n.Build.Version+"-"+n.Build.BuildHash]++
+	}
+	return nil
+}
+
 // FetchTxBilling is the RPC method to fetch a known billing tx from the target server.
 func (s *ChainRPCService) FetchTxBilling(req *types.FetchTxBillingReq, resp *types.FetchTxBillingResp) error {
 	return nil
@@ -106,12 +138,40 @@ func (s *ChainRPCService) QueryAccountTokenBalance(
 // QuerySQLChainProfile is the RPC method to query SQLChainProfile.
 func (s *ChainRPCService) QuerySQLChainProfile(req *types.QuerySQLChainProfileReq,
 	resp *types.QuerySQLChainProfileResp) (err error) {
-	p, ok := s.chain.loadSQLChainProfile(req.DBID)
+	v, err := s.chain.rpcCache.load("profile:"+string(req.DBID), func() (interface{}, error) {
+		p, ok := s.chain.loadSQLChainProfile(req.DBID)
+		if !ok {
+			return nil, ErrDatabaseNotFound
+		}
+		return p, nil
+	})
+	if err != nil {
+		err = errors.Wrap(err, "rpc query sqlchain profile failed")
+		return
+	}
+	resp.Profile = *v.(*types.SQLChainProfile)
+	return
+}
+
+// QueryDataset is the RPC method to query the datasets published for a database.
+func (s *ChainRPCService) QueryDataset(req *types.QueryDatasetReq, resp *types.QueryDatasetResp) (err error) {
+	p, ok := s.chain.loadDataset(req.DatabaseID)
 	if ok {
 		resp.Profile = *p
 		return
 	}
-	err = errors.Wrap(ErrDatabaseNotFound, "rpc query sqlchain profile failed")
+	err = errors.Wrap(ErrDatabaseNotFound, "rpc query dataset failed")
+	return
+}
+
+// ResolveName is the RPC method to resolve a registered name to the account address.
+func (s *ChainRPCService) ResolveName(req *types.ResolveNameReq, resp *types.ResolveNameResp) (err error) {
+	r, ok := s.chain.loadName(req.Name)
+	if !ok || r.Expired(s.chain.headHeight()) {
+		err = errors.Wrapf(ErrNameNotFound, "rpc resolve name %s failed", req.Name)
+		return
+	}
+	resp.Record = *r
 	return
 }
 
@@ -119,12 +179,17 @@ func (s *ChainRPCService) QuerySQLChainProfile(req *types.QuerySQLChainProfileRe
 func (s *ChainRPCService) QueryTxState(
 	req *types.QueryTxStateReq, resp *types.QueryTxStateResp) (err error,
 ) {
-	var state pi.TransactionState
-	if state, err = s.chain.queryTxState(req.Hash); err != nil {
+	var (
+		state  pi.TransactionState
+		height uint32
+	)
+	if state, height, err = s.chain.queryTxState(req.Hash); err != nil {
 		return
 	}
 	resp.Hash = req.Hash
 	resp.State = state
+	resp.Height = height
+	resp.HeadHeight = s.chain.headHeight()
 	return
 }
 
@@ -132,11 +197,84 @@ func (s *ChainRPCService) QueryTxState(
 func (s *ChainRPCService) QueryAccountSQLChainProfiles(
 	req *types.QueryAccountSQLChainProfilesReq, resp *types.QueryAccountSQLChainProfilesResp) (err error,
 ) {
-	var profiles []*types.SQLChainProfile
-	if profiles, err = s.chain.queryAccountSQLChainProfiles(req.Addr); err != nil {
+	v, err := s.chain.rpcCache.load("account:"+req.Addr.String(), func() (interface{}, error) {
+		return s.chain.queryAccountSQLChainProfiles(req.Addr)
+	})
+	if err != nil {
 		return
 	}
 	resp.Addr = req.Addr
-	resp.Profiles = profiles
+	resp.Profiles = v.([]*types.SQLChainProfile)
+	return
+}
+
+// QueryAccountActivities is the RPC method to query the activity feed of an account, newest first.
+func (s *ChainRPCService) QueryAccountActivities(
+	req *types.QueryAccountActivitiesReq, resp *types.QueryAccountActivitiesResp) (err error,
+) {
+	if resp.Activities, resp.Next, err = s.chain.queryAccountActivities(req); err != nil {
+		return
+	}
+	resp.Addr = req.Addr
+	return
+}
+
+// SubmitBillingStatement is the RPC method for miners to submit billing period statements.
+func (s *ChainRPCService) SubmitBillingStatement(
+	req *types.SubmitBillingStatementReq, _ *types.SubmitBillingStatementResp) (err error,
+) {
+	return s.chain.submitBillingStatement(&req.Statement)
+}
+
+// SubmitBillingStatements is the RPC method for miners to submit batched billing period
+// statements, each statement is accepted or refused independently.
+func (s *ChainRPCService) SubmitBillingStatements(
+	req *types.SubmitBillingStatementsReq, resp *types.SubmitBillingStatementsResp) (err error,
+) {
+	if err = req.Decompress(); err != nil {
+		return
+	}
+	resp.Errors = make([]string, len(req.Statements))
+	for i := range req.Statements {
+		if serr := s.chain.submitBillingStatement(&req.Statements[i]); serr != nil {
+			resp.Errors[i] = serr.Error()
+		}
+	}
+	return
+}
+
+// QueryBillingMismatches is the RPC method to query billing statement mismatches of a database,
+// which is only allowed to the owner and the miners of the database.
+func (s *ChainRPCService) QueryBillingMismatches(
+	req *types.QueryBillingMismatchesReq, resp *types.QueryBillingMismatchesResp) (err error,
+) {
+	resp.Mismatches, err = s.chain.queryBillingMismatches(req.GetNodeID().ToNodeID(), req.DatabaseID)
+	return
+}
+
+// SimulateTx is the RPC method to apply a transaction against a copy of current chain state
+// without committing.
+func (s *ChainRPCService) SimulateTx(req *types.SimulateTxReq, resp *types.SimulateTxResp) (err error) {
+	if req.Tx == nil {
+		return ErrEmptyTransaction
+	}
+	var changes []types.BalanceChange
+	resp.Nonce, changes, err = s.chain.simulateTx(req.Tx)
+	if err != nil {
+		resp.Error = err.Error()
+		err = nil
+		return
+	}
+	resp.OK = true
+	resp.Changes = changes
+	return
+}
+
+// PreviewCreateDatabase is the RPC method to preview the miners matched for a database creation
+// before paying for it.
+func (s *ChainRPCService) PreviewCreateDatabase(
+	req *types.PreviewCreateDatabaseReq, resp *types.PreviewCreateDatabaseResp) (err error,
+) {
+	*resp = *s.chain.previewCreateDatabase(&req.Header)
 	return
 }
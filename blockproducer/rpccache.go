@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	mw "github.com/zserge/metric"
+)
+
+const (
+	// DefaultRPCCacheTTL defines the default lifetime of the cached RPC responses, the cache is
+	// also invalidated once a new irreversible block is applied.
+	DefaultRPCCacheTTL = 10 * time.Second
+
+	mwKeyRPCCacheHit  = "service:bp:rpccache:hit"
+	mwKeyRPCCacheMiss = "service:bp:rpccache:miss"
+)
+
+func init() {
+	expvar.Publish(mwKeyRPCCacheHit, mw.NewCounter("5m1m"))
+	expvar.Publish(mwKeyRPCCacheMiss, mw.NewCounter("5m1m"))
+}
+
+type rpcCacheEntry struct {
+	value  interface{}
+	expire time.Time
+}
+
+// rpcCache caches the hot RPC responses which only change with the irreversible state, such
+// as the last irreversible block and the sqlchain profiles requested by every client and miner.
+// The cached values are shared by the requests and must not be modified.
+type rpcCache struct {
+	sync.Mutex
+	ttl     time.Duration
+	gen     uint64 // increased by each invalidation
+	entries map[string]*rpcCacheEntry
+}
+
+func newRPCCache(ttl time.Duration) *rpcCache {
+	return &rpcCache{
+		ttl:     ttl,
+		entries: make(map[string]*rpcCacheEntry),
+	}
+}
+
+func (c *rpcCache) get(key string, now time.Time) (value interface{}, gen uint64, ok bool) {
+	c.Lock()
+	defer c.Unlock()
+	var e *rpcCacheEntry
+	gen = c.gen
+	if e, ok = c.entries[key]; !ok {
+		return
+	}
+	if !now.Before(e.expire) {
+		delete(c.entries, key)
+		return nil, gen, false
+	}
+	return e.value, gen, true
+}
+
+// set caches the value loaded in generation gen, the value is dropped if the cache has been
+// invalidated during the loading.
+func (c *rpcCache) set(key string, value interface{}, gen uint64, now time.Time) {
+	c.Lock()
+	defer c.Unlock()
+	if gen != c.gen {
+		return
+	}
+	c.entries[key] = &rpcCacheEntry{value: value, expire: now.Add(c.ttl)}
+}
+
+// load returns the cached value of key, or calls f to load and cache it. Errors are not cached.
+func (c *rpcCache) load(key string, f func() (interface{}, error)) (value interface{}, err error) {
+	if c.ttl <= 0 {
+		return f()
+	}
+	var now = time.Now()
+	cached, gen, ok := c.get(key, now)
+	if ok {
+		expvar.Get(mwKeyRPCCacheHit).(mw.Metric).Add(1)
+		return cached, nil
+	}
+	expvar.Get(mwKeyRPCCacheMiss).(mw.Metric).Add(1)
+	if value, err = f(); err != nil {
+		return
+	}
+	c.set(key, value, gen, now)
+	return
+}
+
+// invalidate drops all the cached responses, it's called once the irreversible state changes.
+func (c *rpcCache) invalidate() {
+	c.Lock()
+	defer c.Unlock()
+	c.gen++
+	c.entries = make(map[string]*rpcCacheEntry)
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRPCCache(t *testing.T) {
+	Convey("Given a rpc response cache", t, func() {
+		var (
+			c     = newRPCCache(time.Minute)
+			loads int
+			f     = func() (interface{}, error) {
+				loads++
+				return loads, nil
+			}
+		)
+		v, err := c.load("k", f)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, 1)
+
+		Convey("The cached response should be served until invalidation", func() {
+			v, err = c.load("k", f)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, 1)
+			c.invalidate()
+			v, err = c.load("k", f)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, 2)
+		})
+		Convey("The expired response should be reloaded", func() {
+			_, gen, ok := c.get("k", time.Now().Add(time.Hour))
+			So(ok, ShouldBeFalse)
+			c.set("k", 0, gen, time.Now().Add(-time.Hour))
+			v, err = c.load("k", f)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, 2)
+		})
+		Convey("The response loaded before invalidation should not be cached", func() {
+			_, gen, _ := c.get("x", time.Now())
+			c.invalidate()
+			c.set("x", 0, gen, time.Now())
+			_, _, ok := c.get("x", time.Now())
+			So(ok, ShouldBeFalse)
+		})
+		Convey("The errors should not be cached", func() {
+			var errLoad = errors.New("load failed")
+			_, err = c.load("e", func() (interface{}, error) { return nil, errLoad })
+			So(err, ShouldEqual, errLoad)
+			v, err = c.load("e", f)
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, 2)
+		})
+	})
+}
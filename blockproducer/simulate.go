@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"sort"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+// simulateTx applies the transaction against an arena of the head branch state, on top of the
+// pending transactions of the same account. The arena is dropped afterwards, so nothing is
+// committed to the chain.
+func (c *Chain) simulateTx(tx pi.Transaction) (
+	nonce pi.AccountNonce, changes []types.BalanceChange, err error,
+) {
+	if err = tx.Verify(); err != nil {
+		return
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+	var (
+		addr    = tx.GetAccountAddress()
+		pending []pi.Transaction
+	)
+	for _, v := range c.headBranch.unpacked {
+		if v.GetAccountAddress() == addr && v.Hash() != tx.Hash() {
+			pending = append(pending, v)
+		}
+	}
+	return simulateOnState(c.headBranch.preview, pending, tx, c.nextHeight)
+}
+
+// simulateOnState applies the pending transactions in nonce order and then the target one to
+// a new dirty index sharing the read-only index of base, and reports the balance changes of the
+// target transaction.
+func simulateOnState(base *metaState, pending []pi.Transaction, tx pi.Transaction, height uint32) (
+	nonce pi.AccountNonce, changes []types.BalanceChange, err error,
+) {
+	var arena = &metaState{
+		dirty:     newMetaIndex(),
+		readonly:  base.readonly,
+		producers: base.producers,
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].GetAccountNonce() < pending[j].GetAccountNonce()
+	})
+	for _, v := range pending {
+		// pending transactions failing to apply are dropped by block producing as well
+		_ = arena.apply(v, height)
+	}
+	// the balances before the target transaction include the ones changed by pending
+	var before = make(map[proto.AccountAddress][types.SupportTokenNumber]uint64)
+	for k, v := range arena.dirty.accounts {
+		if v != nil {
+			before[k] = v.TokenBalance
+		} else {
+			before[k] = [types.SupportTokenNumber]uint64{}
+		}
+	}
+	if nonce, err = arena.nextNonce(tx.GetAccountAddress()); err != nil &&
+		tx.GetTransactionType() != pi.TransactionTypeBaseAccount {
+		return
+	}
+	if err = arena.apply(tx, height); err != nil {
+		return
+	}
+	for addr, o := range arena.dirty.accounts {
+		prev, ok := before[addr]
+		if !ok {
+			if v, loaded := arena.readonly.accounts[addr]; loaded && v != nil {
+				prev = v.TokenBalance
+			}
+		}
+		for i := types.TokenType(0); i < types.SupportTokenNumber; i++ {
+			var after uint64
+			if o != nil {
+				after = o.TokenBalance[i]
+			}
+			if after != prev[i] {
+				changes = append(changes, types.BalanceChange{
+					Address:   addr,
+					TokenType: i,
+					Before:    prev[i],
+					After:     after,
+				})
+			}
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Address != changes[j].Address {
+			return changes[i].Address.String() < changes[j].Address.String()
+		}
+		return changes[i].TokenType < changes[j].TokenType
+	})
+	return
+}
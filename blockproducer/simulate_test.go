@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package blockproducer
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestSimulateOnState(t *testing.T) {
+	Convey("Given a meta state with a funded account", t, func() {
+		var (
+			priv, _, err = asymmetric.GenSecp256k1KeyPair()
+			addr1, addr2 proto.AccountAddress
+			ms           = newMetaState()
+		)
+		So(err, ShouldBeNil)
+		addr1, err = crypto.PubKeyHash(priv.PubKey())
+		So(err, ShouldBeNil)
+		addr2 = proto.AccountAddress{0x02}
+		account := &types.Account{Address: addr1}
+		account.TokenBalance[types.Particle] = 100
+		So(ms.storeBaseAccount(addr1, account), ShouldBeNil)
+		ms.commit()
+
+		newTransfer := func(nonce pi.AccountNonce, amount uint64) *types.Transfer {
+			tx := types.NewTransfer(&types.TransferHeader{
+				Sender:   addr1,
+				Receiver: addr2,
+				Nonce:    nonce,
+				Amount:   amount,
+			})
+			So(tx.Sign(priv), ShouldBeNil)
+			return tx
+		}
+
+		Convey("The simulation should report balance changes on top of pending transactions", func() {
+			nonce, changes, err := simulateOnState(
+				ms, []pi.Transaction{newTransfer(0, 10)}, newTransfer(1, 20), 1)
+			So(err, ShouldBeNil)
+			So(nonce, ShouldEqual, 1)
+			So(changes, ShouldHaveLength, 2)
+			for _, v := range changes {
+				switch v.Address {
+				case addr1:
+					So(v.Before, ShouldEqual, 90)
+					So(v.After, ShouldEqual, 70)
+				case addr2:
+					So(v.Before, ShouldEqual, 10)
+					So(v.After, ShouldEqual, 30)
+				}
+			}
+			// nothing is committed to the base state
+			_, loaded := ms.loadAccountObject(addr2)
+			So(loaded, ShouldBeFalse)
+			bl, _ := ms.loadAccountTokenBalance(addr1, types.Particle)
+			So(bl, ShouldEqual, 100)
+		})
+		Convey("The simulation should fail on insufficient balance or invalid nonce", func() {
+			_, _, err := simulateOnState(ms, nil, newTransfer(0, 200), 1)
+			So(err, ShouldNotBeNil)
+			_, _, err = simulateOnState(ms, nil, newTransfer(5, 1), 1)
+			So(err, ShouldEqual, ErrInvalidAccountNonce)
+		})
+	})
+}
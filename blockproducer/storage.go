@@ -79,6 +79,30 @@ var (
 	UNIQUE ("address")
 );`,
 
+		`CREATE TABLE IF NOT EXISTS "revoked" (
+	"node_id"	TEXT,
+	"encoded"	BLOB,
+	UNIQUE ("node_id")
+);`,
+
+		`CREATE TABLE IF NOT EXISTS "datasets" (
+	"db_id"		TEXT,
+	"encoded"	BLOB,
+	UNIQUE ("db_id")
+);`,
+
+		`CREATE TABLE IF NOT EXISTS "names" (
+	"name"		TEXT,
+	"encoded"	BLOB,
+	UNIQUE ("name")
+);`,
+
+		`CREATE TABLE IF NOT EXISTS "provisions" (
+	"nonce"		INTEGER,
+	"encoded"	BLOB,
+	UNIQUE ("nonce")
+);`,
+
 		`CREATE TABLE IF NOT EXISTS "indexed_blocks" (
 	"height"		INTEGER PRIMARY KEY,
 	"hash"			TEXT,
@@ -118,6 +142,40 @@ var (
 	UNIQUE("account", "address", "id")
 );`,
 		`CREATE INDEX IF NOT EXISTS "idx__indexed_shardChains__id" ON "indexed_shardChains" ("id");`,
+
+		`CREATE TABLE IF NOT EXISTS "indexed_activities" (
+	"id"			INTEGER PRIMARY KEY,
+	"block_height"	INTEGER,
+	"tx_index"		INTEGER,
+	"ordinal"		INTEGER,
+	"account"		TEXT,
+	"kind"			TEXT,
+	"counterparty"	TEXT,
+	"db_id"			TEXT,
+	"amount"		INTEGER,
+	"token_type"	INTEGER,
+	"role"			INTEGER,
+	"hash"			TEXT,
+	"timestamp"		INTEGER,
+	UNIQUE ("block_height", "tx_index", "ordinal")
+);`,
+		`CREATE INDEX IF NOT EXISTS "idx__indexed_activities__account__id" ON "indexed_activities" ("account", "id" DESC);`,
+
+		// Billing audit tables
+		`CREATE TABLE IF NOT EXISTS "billing_rounds" (
+	"db_id"		TEXT,
+	"from"		INT,
+	"to"		INT,
+	"encoded"	BLOB,
+	UNIQUE ("db_id", "from", "to")
+);`,
+
+		`CREATE TABLE IF NOT EXISTS "billing_mismatches" (
+	"id"		INTEGER PRIMARY KEY,
+	"db_id"		TEXT,
+	"encoded"	BLOB
+);`,
+		`CREATE INDEX IF NOT EXISTS "idx__billing_mismatches__db_id__id" ON "billing_mismatches" ("db_id", "id" DESC);`,
 	}
 )
 
@@ -246,6 +304,9 @@ func buildBlockIndex(height uint32, b *types.BPBlock) storageProcedure {
 			); err != nil {
 				return err
 			}
+			if err := indexActivities(tx, height, txIndex, t); err != nil {
+				return err
+			}
 		}
 		return nil
 	}
@@ -404,6 +465,88 @@ func deleteProvider(address proto.AccountAddress) storageProcedure {
 	}
 }
 
+func addRevocation(revocation *types.NodeRevocation) storageProcedure {
+	var (
+		enc *bytes.Buffer
+		err error
+	)
+	if enc, err = utils.EncodeMsgPack(revocation); err != nil {
+		return errPass(err)
+	}
+	return func(tx *sql.Tx) (err error) {
+		log.WithFields(log.Fields{
+			"node_id": revocation.NodeID,
+			"revoker": revocation.Revoker.String(),
+		}).Debug("adding node revocation")
+		_, err = tx.Exec(`INSERT OR REPLACE INTO "revoked" ("node_id", "encoded") VALUES (?, ?)`,
+			string(revocation.NodeID),
+			enc.Bytes())
+		return
+	}
+}
+
+func addProvision(record *types.ProvisionRecord) storageProcedure {
+	var (
+		enc *bytes.Buffer
+		err error
+	)
+	if enc, err = utils.EncodeMsgPack(record); err != nil {
+		return errPass(err)
+	}
+	return func(tx *sql.Tx) (err error) {
+		log.WithFields(log.Fields{
+			"nonce":   record.Nonce,
+			"node_id": record.NodeID,
+		}).Debug("adding provisioning record")
+		// nonce is stored as int64 bits since the driver does not take uint64 with high bit set
+		_, err = tx.Exec(`INSERT OR REPLACE INTO "provisions" ("nonce", "encoded") VALUES (?, ?)`,
+			int64(record.Nonce),
+			enc.Bytes())
+		return
+	}
+}
+
+func updateDataset(profile *types.DatasetProfile) storageProcedure {
+	var (
+		enc *bytes.Buffer
+		err error
+	)
+	if enc, err = utils.EncodeMsgPack(profile); err != nil {
+		return errPass(err)
+	}
+	return func(tx *sql.Tx) (err error) {
+		log.WithFields(log.Fields{
+			"db_id":    profile.DatabaseID,
+			"versions": len(profile.Versions),
+		}).Debug("updating dataset profile")
+		_, err = tx.Exec(`INSERT OR REPLACE INTO "datasets" ("db_id", "encoded") VALUES (?, ?)`,
+			string(profile.DatabaseID),
+			enc.Bytes())
+		return
+	}
+}
+
+func updateName(record *types.NameRecord) storageProcedure {
+	var (
+		enc *bytes.Buffer
+		err error
+	)
+	if enc, err = utils.EncodeMsgPack(record); err != nil {
+		return errPass(err)
+	}
+	return func(tx *sql.Tx) (err error) {
+		log.WithFields(log.Fields{
+			"name":   record.Name,
+			"target": record.Target,
+			"expiry": record.Expiry,
+		}).Debug("updating name record")
+		_, err = tx.Exec(`INSERT OR REPLACE INTO "names" ("name", "encoded") VALUES (?, ?)`,
+			record.Name,
+			enc.Bytes())
+		return
+	}
+}
+
 func loadIrreHash(st xi.Storage) (irre hash.Hash, err error) {
 	var hex string
 	// Load last irreversible block hash
@@ -647,6 +790,109 @@ func loadAndCacheProviders(st xi.Storage, view *metaState) (err error) {
 	return
 }
 
+func loadAndCacheRevocations(st xi.Storage, view *metaState) (err error) {
+	var (
+		rows *sql.Rows
+		id   string
+		enc  []byte
+	)
+
+	if rows, err = st.Reader().Query(`SELECT "node_id", "encoded" FROM "revoked"`); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&id, &enc); err != nil {
+			return
+		}
+		var dec = &types.NodeRevocation{}
+		if err = utils.DecodeMsgPack(enc, dec); err != nil {
+			return
+		}
+		view.readonly.revoked[proto.NodeID(id)] = dec
+	}
+
+	return
+}
+
+func loadAndCacheProvisions(st xi.Storage, view *metaState) (err error) {
+	var (
+		rows *sql.Rows
+		enc  []byte
+	)
+
+	if rows, err = st.Reader().Query(`SELECT "encoded" FROM "provisions"`); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&enc); err != nil {
+			return
+		}
+		var dec = &types.ProvisionRecord{}
+		if err = utils.DecodeMsgPack(enc, dec); err != nil {
+			return
+		}
+		view.readonly.provision[dec.Nonce] = dec
+	}
+
+	return
+}
+
+func loadAndCacheDatasets(st xi.Storage, view *metaState) (err error) {
+	var (
+		rows *sql.Rows
+		id   string
+		enc  []byte
+	)
+
+	if rows, err = st.Reader().Query(`SELECT "db_id", "encoded" FROM "datasets"`); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&id, &enc); err != nil {
+			return
+		}
+		var dec = &types.DatasetProfile{}
+		if err = utils.DecodeMsgPack(enc, dec); err != nil {
+			return
+		}
+		view.readonly.datasets[proto.DatabaseID(id)] = dec
+	}
+
+	return
+}
+
+func loadAndCacheNames(st xi.Storage, view *metaState) (err error) {
+	var (
+		rows *sql.Rows
+		name string
+		enc  []byte
+	)
+
+	if rows, err = st.Reader().Query(`SELECT "name", "encoded" FROM "names"`); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&name, &enc); err != nil {
+			return
+		}
+		var dec = &types.NameRecord{}
+		if err = utils.DecodeMsgPack(enc, dec); err != nil {
+			return
+		}
+		view.readonly.names[name] = dec
+	}
+
+	return
+}
+
 func loadImmutableState(st xi.Storage) (immutable *metaState, err error) {
 	immutable = newMetaState()
 	if err = loadAndCacheAccounts(st, immutable); err != nil {
@@ -658,6 +904,18 @@ func loadImmutableState(st xi.Storage) (immutable *metaState, err error) {
 	if err = loadAndCacheProviders(st, immutable); err != nil {
 		return
 	}
+	if err = loadAndCacheRevocations(st, immutable); err != nil {
+		return
+	}
+	if err = loadAndCacheDatasets(st, immutable); err != nil {
+		return
+	}
+	if err = loadAndCacheNames(st, immutable); err != nil {
+		return
+	}
+	if err = loadAndCacheProvisions(st, immutable); err != nil {
+		return
+	}
 	return
 }
 
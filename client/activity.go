@@ -0,0 +1,58 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+)
+
+// QueryActivities returns a page of the activity feed of the account, newest first, i.e. the
+// transfers, database creations, permission grants and billing charges of the account. The
+// feed is filtered by the kinds if any, and the next page is queried with the returned next
+// cursor as before, which is 0 once the feed is exhausted.
+func QueryActivities(addr proto.AccountAddress, kinds []types.ActivityKind, before uint64, limit int) (
+	activities []*types.Activity, next uint64, err error,
+) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	if IsLiteMode() {
+		err = ErrNotSupportedInLiteMode
+		return
+	}
+
+	var (
+		req = &types.QueryAccountActivitiesReq{
+			Addr:   addr,
+			Kinds:  kinds,
+			Before: before,
+			Limit:  limit,
+		}
+		resp = new(types.QueryAccountActivitiesResp)
+	)
+	if err = requestBP(route.MCCQueryAccountActivities, req, resp); err != nil {
+		err = errors.Wrap(err, "call query account activities failed")
+		return
+	}
+	return resp.Activities, resp.Next, nil
+}
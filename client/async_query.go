@@ -0,0 +1,281 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// asyncPollInterval is the interval to poll the miner while waiting for an asynchronous query.
+const asyncPollInterval = 500 * time.Millisecond
+
+// AsyncResult defines the result set of a succeeded asynchronous query.
+type AsyncResult struct {
+	Columns   []string
+	DeclTypes []string
+	Rows      [][]interface{}
+}
+
+// AsyncQuery is the handle of a read query running asynchronously on the leader miner. The query
+// is tracked by the miner, so that the handle survives client disconnections, and the job could
+// be reopened by OpenAsyncQuery with the same private key until its result expires.
+type AsyncQuery struct {
+	JobID string
+
+	s      *blobSession
+	nodeID proto.NodeID
+	ack    sync.Once
+}
+
+// QueryAsync submits the read query to run asynchronously on the leader miner of the database,
+// it's intended for long-running analytical queries. The returned handle is used to poll the
+// status, fetch the result later or cancel the query.
+func QueryAsync(ctx context.Context, dsn string, query string, args ...interface{}) (
+	q *AsyncQuery, err error,
+) {
+	if q, err = OpenAsyncQuery(dsn, ""); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			q.Close()
+			q = nil
+		}
+	}()
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	var sq *types.Query
+	if sq, err = convertQuery(query, asyncArgs(args)); err != nil {
+		return
+	}
+
+	connID, seqNo := allocateConnAndSeq()
+	defer putBackConn(connID)
+	req := &types.Request{
+		Header: types.SignedRequestHeader{
+			RequestHeader: types.RequestHeader{
+				QueryType:    types.ReadQuery,
+				NodeID:       q.nodeID,
+				DatabaseID:   q.s.dbID,
+				ConnectionID: connID,
+				SeqNo:        seqNo,
+				Timestamp:    getLocalTime(),
+			},
+		},
+		Payload: types.RequestPayload{
+			Queries: []types.Query{*sq},
+		},
+	}
+	if err = req.Sign(q.s.privKey); err != nil {
+		return
+	}
+	resp := &types.SubmitAsyncQueryResp{}
+	if err = q.s.caller.Call(route.DBSSubmitAsyncQuery.String(), req, resp); err != nil {
+		return
+	}
+	q.JobID = resp.Status.JobID
+	log.WithFields(log.Fields{
+		"db":     q.s.dbID,
+		"job":    q.JobID,
+		"target": q.s.caller.Target(),
+	}).Debug("async query submitted")
+	return
+}
+
+// OpenAsyncQuery reopens the handle of an asynchronous query submitted before, e.g. by another
+// process of the same client node.
+func OpenAsyncQuery(dsn string, jobID string) (q *AsyncQuery, err error) {
+	q = &AsyncQuery{JobID: jobID}
+	if q.s, err = newBlobSession(dsn); err != nil {
+		q = nil
+		return
+	}
+	if q.nodeID, err = kms.GetLocalNodeID(); err != nil {
+		q.s.close()
+		q = nil
+	}
+	return
+}
+
+// asyncArgs converts the query arguments to driver named values, the sql.NamedArg arguments are
+// bound by name.
+func asyncArgs(args []interface{}) (nvs []driver.NamedValue) {
+	nvs = make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		nvs[i].Ordinal = i + 1
+		if named, ok := arg.(sql.NamedArg); ok {
+			nvs[i].Name, arg = named.Name, named.Value
+		}
+		nvs[i].Value = arg
+	}
+	return
+}
+
+func (q *AsyncQuery) call(ctx context.Context, method route.RemoteFunc) (
+	resp *types.AsyncQueryResp, err error,
+) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	req := &types.AsyncQueryReq{
+		DatabaseID:     q.s.dbID,
+		JobID:          q.JobID,
+		AcceptEncoding: types.CompressionDeflate,
+	}
+	resp = &types.AsyncQueryResp{}
+	if err = q.s.caller.Call(method.String(), req, resp); err != nil {
+		resp = nil
+	}
+	return
+}
+
+// Status returns the status of the asynchronous query.
+func (q *AsyncQuery) Status(ctx context.Context) (status *types.AsyncQueryStatus, err error) {
+	var resp *types.AsyncQueryResp
+	if resp, err = q.call(ctx, route.DBSAsyncQueryStatus); err != nil {
+		return
+	}
+	status = &resp.Status
+	return
+}
+
+// Fetch returns the result of the asynchronous query, ErrAsyncQueryRunning is returned if the
+// query is not finished yet. The result could be fetched repeatedly until it expires.
+func (q *AsyncQuery) Fetch(ctx context.Context) (res *AsyncResult, err error) {
+	var resp *types.AsyncQueryResp
+	if resp, err = q.call(ctx, route.DBSFetchAsyncQuery); err != nil {
+		return
+	}
+	switch resp.Status.State {
+	case types.AsyncQuerySucceeded:
+	case types.AsyncQueryRunning:
+		err = errors.Wrapf(ErrAsyncQueryRunning, "job: %s", q.JobID)
+		return
+	case types.AsyncQueryCanceled:
+		err = errors.Wrapf(ErrAsyncQueryCanceled, "job: %s", q.JobID)
+		return
+	default:
+		err = errors.Wrapf(ErrAsyncQueryFailed, "job %s: %s", q.JobID, resp.Status.Error)
+		return
+	}
+	if resp.Response == nil {
+		err = errors.Wrapf(ErrAsyncQueryFailed, "job %s: missing result", q.JobID)
+		return
+	}
+	if err = resp.Response.Decompress(); err != nil {
+		return
+	}
+	q.ack.Do(func() { q.sendAck(resp.Response) })
+	return newAsyncResult(resp.Response)
+}
+
+// Wait polls the miner until the asynchronous query is finished and returns its result. The
+// network errors are tolerated, the query keeps running on the miner while the client reconnects.
+func (q *AsyncQuery) Wait(ctx context.Context) (res *AsyncResult, err error) {
+	var ticker = time.NewTicker(asyncPollInterval)
+	defer ticker.Stop()
+	for {
+		res, err = q.Fetch(ctx)
+		switch cause := errors.Cause(err); {
+		case err == nil:
+			return
+		case cause == ErrAsyncQueryRunning:
+		case cause == ErrAsyncQueryCanceled, cause == ErrAsyncQueryFailed, isMinerError(err):
+			return
+		default:
+			log.WithField("job", q.JobID).WithError(err).Debug("poll async query failed")
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cancel cancels the asynchronous query if it's running, or discards its result on the miner.
+func (q *AsyncQuery) Cancel(ctx context.Context) (err error) {
+	_, err = q.call(ctx, route.DBSCancelAsyncQuery)
+	return
+}
+
+// Close releases the connection to the miner, the query itself is not canceled.
+func (q *AsyncQuery) Close() {
+	q.s.close()
+}
+
+// sendAck acknowledges the fetched response to the miner, so that the query is billed as the
+// synchronous ones.
+func (q *AsyncQuery) sendAck(resp *types.Response) {
+	var (
+		ack = &types.Ack{
+			Header: types.SignedAckHeader{
+				AckHeader: types.AckHeader{
+					Response:     resp.Header.ResponseHeader,
+					ResponseHash: resp.Header.Hash(),
+					NodeID:       q.nodeID,
+					Timestamp:    getLocalTime(),
+				},
+			},
+		}
+		ackRes types.AckResponse
+		err    error
+	)
+	if err = ack.Sign(q.s.privKey); err == nil {
+		err = q.s.caller.Call(route.DBSAck.String(), ack, &ackRes)
+	}
+	log.WithField("job", q.JobID).WithError(err).Debug("send async query ack")
+}
+
+func newAsyncResult(resp *types.Response) (res *AsyncResult, err error) {
+	var rs = newRows(resp)
+	res = &AsyncResult{
+		Columns:   rs.Columns(),
+		DeclTypes: resp.Payload.DeclTypes,
+		Rows:      make([][]interface{}, 0, len(resp.Payload.Rows)),
+	}
+	for {
+		row := make([]interface{}, len(res.Columns))
+		dest := make([]driver.Value, len(res.Columns))
+		if err = rs.Next(dest); err == io.EOF {
+			err = nil
+			return
+		} else if err != nil {
+			res = nil
+			return
+		}
+		for i, v := range dest {
+			row[i] = v
+		}
+		res.Rows = append(res.Rows, row)
+	}
+}
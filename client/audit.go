@@ -0,0 +1,167 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// sqlchainAuditInfo defines the sqlchain data from block producers to verify miner proofs with.
+type sqlchainAuditInfo struct {
+	genesis *types.Block
+	miners  map[proto.NodeID]bool
+	nodes   []proto.NodeID
+}
+
+// loadAuditInfo queries the sqlchain profile of the database from block producers.
+func loadAuditInfo(dbID proto.DatabaseID) (info *sqlchainAuditInfo, err error) {
+	var (
+		req  = &types.QuerySQLChainProfileReq{DBID: dbID}
+		resp = &types.QuerySQLChainProfileResp{}
+	)
+	if err = requestBP(route.MCCQuerySQLChainProfile, req, resp); err != nil {
+		err = errors.WithMessage(err, "query sqlchain profile failed")
+		return
+	}
+	info = &sqlchainAuditInfo{
+		genesis: &types.Block{},
+		miners:  make(map[proto.NodeID]bool),
+	}
+	if err = utils.DecodeMsgPack(resp.Profile.EncodedGenesis, info.genesis); err != nil {
+		err = errors.Wrap(err, "decode genesis block failed")
+		return
+	}
+	for _, m := range resp.Profile.Miners {
+		info.miners[m.NodeID] = true
+		info.nodes = append(info.nodes, m.NodeID)
+	}
+	return
+}
+
+// callMiners calls the method on the miners in order until one of them succeeds.
+func callMiners(ctx context.Context, nodes []proto.NodeID, method route.RemoteFunc,
+	req interface{}, resp interface{}) (err error) {
+	err = errors.New("no miner of the database")
+	for _, node := range nodes {
+		if err = mux.NewCaller().CallNodeWithContext(ctx, node, method.String(), req, resp); err != nil {
+			log.WithFields(log.Fields{
+				"node":   node,
+				"method": method.String(),
+			}).WithError(err).Debug("call miner failed")
+			continue
+		}
+		return
+	}
+	return errors.WithMessage(err, "call "+method.String()+" on all miners failed")
+}
+
+// AuditQuery fetches and verifies the inclusion proof of the query at the index of the block at
+// the height in the sqlchain of the database. The proof carries the signed request and response
+// headers, auditors compare them with the operation to audit, and may check the proof later with
+// the verified block header only, see types.ReceiptProof.VerifyWithHeader.
+func AuditQuery(ctx context.Context, dbID proto.DatabaseID, height int32, index int) (
+	proof *types.ReceiptProof, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	var info *sqlchainAuditInfo
+	if info, err = loadAuditInfo(dbID); err != nil {
+		return
+	}
+	var (
+		req  = &types.QueryProofReq{DatabaseID: dbID, Height: height, Index: index}
+		resp = &types.QueryProofResp{}
+	)
+	if err = callMiners(ctx, info.nodes, route.DBSQueryProof, req, resp); err != nil {
+		return
+	}
+	proof = &resp.Proof
+	if err = proof.VerifyInclusion(); err != nil {
+		err = errors.Wrapf(ErrInvalidAuditProof, "verify query proof failed: %v", err)
+		return
+	}
+	if proof.Height != height || proof.Response.Request.DatabaseID != dbID {
+		err = errors.Wrap(ErrInvalidAuditProof, "proof position not match")
+		return
+	}
+	if !proof.Block.GenesisHash.IsEqual(info.genesis.BlockHash()) {
+		err = errors.Wrap(ErrInvalidAuditProof, "block is not on the sqlchain")
+		return
+	}
+	err = checkMinerKey(info.miners, proof.Block.Producer, proof.Block.HSV.Signee)
+	return
+}
+
+// FetchBlockHeaders fetches the block headers in the height range [from, to] of the sqlchain of
+// the database, the headers are verified to be signed by the miners and linked to the genesis
+// block. Miners return at most worker.MaxFetchBlockHeaders headers per call, so the returned
+// headers may end before the height to.
+func FetchBlockHeaders(ctx context.Context, dbID proto.DatabaseID, from, to int32) (
+	headers []*types.HeightHeader, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	var info *sqlchainAuditInfo
+	if info, err = loadAuditInfo(dbID); err != nil {
+		return
+	}
+	var (
+		req  = &types.FetchBlockHeadersReq{DatabaseID: dbID, From: from, To: to}
+		resp = &types.FetchBlockHeadersResp{}
+	)
+	if err = callMiners(ctx, info.nodes, route.DBSFetchBlockHeaders, req, resp); err != nil {
+		return
+	}
+	headers = resp.Headers
+	if err = types.VerifyHeaderChain(headers); err != nil {
+		err = errors.Wrapf(ErrInvalidAuditProof, "verify header chain failed: %v", err)
+		return
+	}
+	for _, h := range headers {
+		if h.Height < from || h.Height > to {
+			err = errors.Wrapf(ErrInvalidAuditProof, "header at height %d out of range", h.Height)
+			return
+		}
+		if h.Height == 0 {
+			if !h.Header.HSV.DataHash.IsEqual(info.genesis.BlockHash()) {
+				err = errors.Wrap(ErrInvalidAuditProof, "genesis block not match")
+				return
+			}
+			continue
+		}
+		if !h.Header.GenesisHash.IsEqual(info.genesis.BlockHash()) {
+			err = errors.Wrapf(ErrInvalidAuditProof, "header at height %d is not on the sqlchain", h.Height)
+			return
+		}
+		if err = checkMinerKey(info.miners, h.Header.Producer, h.Header.HSV.Signee); err != nil {
+			return
+		}
+	}
+	return
+}
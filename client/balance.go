@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const staleReplicaMessage = "replica is too stale"
+
+// nextFollower returns the follower to serve the next read in round robin.
+func (c *conn) nextFollower() *pconn {
+	var i = atomic.AddUint32(&c.rrIndex, 1)
+	return c.followers[int(i)%len(c.followers)]
+}
+
+// isStaleRead reports whether the read is refused by a follower lagging behind the staleness
+// bound of the database or the connection.
+func (c *conn) isStaleRead(uc *pconn, err error) bool {
+	leader, _ := c.servingPConns()
+	return uc != leader && isMinerError(err) && strings.Contains(err.Error(), staleReplicaMessage)
+}
+
+// readLeader returns the leader connection to serve the reads refused by the stale followers,
+// the leader connection is established on demand if the connection reads from followers only.
+func (c *conn) readLeader(req *types.Request) (uc *pconn, err error) {
+	if uc, _ = c.servingPConns(); uc == nil {
+		var peers *proto.Peers
+		if peers, err = cacheGetPeers(c.dbID, c.privKey); err != nil {
+			return
+		}
+		var leader = c.newPConn(peers.Leader)
+		if err = leader.startAckWorkers(); err != nil {
+			_ = leader.close()
+			return
+		}
+		c.pconnLock.Lock()
+		if c.leader == nil {
+			c.leader = leader
+		} else {
+			go leader.close()
+		}
+		uc = c.leader
+		c.pconnLock.Unlock()
+	}
+	if req.Encoding != uc.acceptEncoding() {
+		err = req.Decompress()
+	}
+	log.WithFields(log.Fields{
+		"db":     c.dbID,
+		"leader": uc.pCaller.Target(),
+	}).Debug("fall back to leader for stale follower")
+	return
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	netrpc "net/rpc"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReadBalance(t *testing.T) {
+	Convey("test round robin followers", t, func() {
+		var (
+			a, b, l = &pconn{}, &pconn{}, &pconn{}
+			c       = &conn{leader: l, followers: []*pconn{a, b}}
+		)
+		So(c.nextFollower(), ShouldEqual, b)
+		So(c.nextFollower(), ShouldEqual, a)
+		So(c.nextFollower(), ShouldEqual, b)
+
+		Convey("only stale follower errors should fall back to leader", func() {
+			var stale = netrpc.ServerError(
+				"replica lags 3 blocks behind, max stale blocks is 2: replica is too stale to serve read query")
+			So(c.isStaleRead(a, stale), ShouldBeTrue)
+			So(c.isStaleRead(l, stale), ShouldBeFalse)
+			So(c.isStaleRead(a, netrpc.ServerError("permission deny")), ShouldBeFalse)
+			So(c.isStaleRead(a, errors.New("replica is too stale to serve read query")), ShouldBeFalse)
+		})
+	})
+}
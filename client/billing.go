@@ -0,0 +1,46 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"sync/atomic"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+)
+
+// QueryBillingMismatches returns the recent mismatches found by block producer between the
+// miner signed billing statements and the billed costs of the database, it's only allowed to the
+// owner and the miners of the database. The owner also finds the mismatches in its activity feed
+// as types.ActivityBillingMismatch.
+func QueryBillingMismatches(dbID proto.DatabaseID) (mismatches []*types.BillingMismatch, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	req := &types.QueryBillingMismatchesReq{
+		DatabaseID: dbID,
+	}
+	resp := new(types.QueryBillingMismatchesResp)
+	if err = requestBP(route.MCCQueryBillingMismatches, req, resp); err != nil {
+		return
+	}
+	mismatches = resp.Mismatches
+	return
+}
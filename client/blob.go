@@ -0,0 +1,189 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/blob"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/rpc"
+	"github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+)
+
+// blobSession defines a session to the leader miner of a database, used by blob chunk transfer
+// and other out-of-band operations.
+type blobSession struct {
+	dbID    proto.DatabaseID
+	privKey *asymmetric.PrivateKey
+	caller  rpc.PCaller
+}
+
+func newBlobSession(dsn string) (s *blobSession, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var (
+		cfg   *Config
+		peers *proto.Peers
+	)
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	s = &blobSession{
+		dbID: proto.DatabaseID(cfg.DatabaseID),
+	}
+	if s.privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	if peers, err = cacheGetPeers(s.dbID, s.privKey); err != nil {
+		err = errors.WithMessage(err, "cacheGetPeers failed")
+		return
+	}
+	if cfg.UseDirectRPC {
+		s.caller = rpc.NewPersistentCaller(peers.Leader)
+	} else {
+		s.caller = mux.NewPersistentCaller(peers.Leader)
+	}
+	return
+}
+
+func (s *blobSession) call(
+	ctx context.Context, method route.RemoteFunc, h hash.Hash, data []byte,
+) (resp *types.BlobChunkResp, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	req := &types.BlobChunkReq{
+		Header: types.SignedBlobChunkHeader{
+			BlobChunkHeader: types.BlobChunkHeader{
+				DatabaseID: s.dbID,
+				Hash:       h,
+				Data:       data,
+			},
+		},
+	}
+	if err = req.Header.Sign(s.privKey); err != nil {
+		return
+	}
+	resp = &types.BlobChunkResp{}
+	err = s.caller.Call(method.String(), req, resp)
+	return
+}
+
+func (s *blobSession) fetch(ctx context.Context, h hash.Hash) (data []byte, err error) {
+	var resp *types.BlobChunkResp
+	if resp, err = s.call(ctx, route.DBSFetchBlobChunk, h, nil); err != nil {
+		return
+	}
+	if actual := hash.THashH(resp.Data); !actual.IsEqual(&h) {
+		err = errors.Wrapf(blob.ErrChunkHashNotMatch, "chunk %s", h.String())
+		return
+	}
+	data = resp.Data
+	return
+}
+
+func (s *blobSession) close() {
+	if s.caller != nil {
+		s.caller.Close()
+	}
+}
+
+// PutBlob uploads a large value to the database miners as content-addressed chunks and returns
+// the reference string which could be stored in the database instead of the value itself.
+func PutBlob(ctx context.Context, dsn string, data []byte) (ref string, err error) {
+	var s *blobSession
+	if s, err = newBlobSession(dsn); err != nil {
+		return
+	}
+	defer s.close()
+
+	manifest, chunks := blob.Split(data, blob.DefaultChunkSize)
+	for i, chunk := range chunks {
+		if _, err = s.call(ctx, route.DBSPutBlobChunk, manifest.Chunks[i], chunk); err != nil {
+			err = errors.Wrapf(err, "put blob chunk #%d failed", i)
+			return
+		}
+	}
+
+	var encoded []byte
+	if encoded, err = blob.EncodeManifest(manifest); err != nil {
+		return
+	}
+	h := hash.THashH(encoded)
+	if _, err = s.call(ctx, route.DBSPutBlobChunk, h, encoded); err != nil {
+		err = errors.WithMessage(err, "put blob manifest failed")
+		return
+	}
+
+	ref = blob.EncodeRef(h)
+	return
+}
+
+// GetBlob downloads and verifies the large value of the reference string returned by PutBlob.
+func GetBlob(ctx context.Context, dsn string, ref string) (data []byte, err error) {
+	var (
+		s        *blobSession
+		h        hash.Hash
+		encoded  []byte
+		manifest *blob.Manifest
+	)
+	if h, err = blob.ParseRef(ref); err != nil {
+		return
+	}
+	if s, err = newBlobSession(dsn); err != nil {
+		return
+	}
+	defer s.close()
+
+	if encoded, err = s.fetch(ctx, h); err != nil {
+		err = errors.WithMessage(err, "fetch blob manifest failed")
+		return
+	}
+	if manifest, err = blob.DecodeManifest(encoded); err != nil {
+		return
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, manifest.Size))
+	for i, c := range manifest.Chunks {
+		var chunk []byte
+		if chunk, err = s.fetch(ctx, c); err != nil {
+			err = errors.Wrapf(err, "fetch blob chunk #%d failed", i)
+			return
+		}
+		buf.Write(chunk)
+	}
+	if uint64(buf.Len()) != manifest.Size {
+		err = errors.Wrap(blob.ErrInvalidManifest, "blob size mismatch")
+		return
+	}
+
+	data = buf.Bytes()
+	return
+}
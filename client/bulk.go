@@ -0,0 +1,107 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MaxBulkInsertParams is the maximum parameters count of a single insert statement built by
+// BulkInsert, it's bounded by SQLITE_MAX_VARIABLE_NUMBER of the storage.
+var MaxBulkInsertParams = 999
+
+// BulkInsert inserts the rows into the table in a single request. The rows are packed into
+// multi-row insert statements, which are committed in one transaction, i.e. one round trip and
+// one consensus log entry on the miners instead of one per row. Either all the rows are
+// inserted or none of them.
+//
+// The whole batch is held in a single request, so very large loads should be split into
+// batches of a few thousand rows by the caller.
+func BulkInsert(
+	ctx context.Context, db *sql.DB, table string, columns []string, rows [][]interface{},
+) (err error) {
+	var (
+		stmts []string
+		args  [][]interface{}
+		tx    *sql.Tx
+	)
+	if stmts, args, err = buildBulkInsert(table, columns, rows); err != nil || len(stmts) == 0 {
+		return
+	}
+	if tx, err = db.BeginTx(ctx, nil); err != nil {
+		return
+	}
+	for i := range stmts {
+		if _, err = tx.ExecContext(ctx, stmts[i], args[i]...); err != nil {
+			_ = tx.Rollback()
+			return
+		}
+	}
+	return tx.Commit()
+}
+
+// buildBulkInsert packs the rows into multi-row insert statements with at most
+// MaxBulkInsertParams parameters each.
+func buildBulkInsert(table string, columns []string, rows [][]interface{}) (
+	stmts []string, args [][]interface{}, err error,
+) {
+	if len(columns) == 0 {
+		err = errors.Wrap(ErrInvalidBulkRow, "no columns")
+		return
+	}
+	var perStmt = MaxBulkInsertParams / len(columns)
+	if perStmt < 1 {
+		perStmt = 1
+	}
+	var (
+		quoted = make([]string, len(columns))
+		tuple  = "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+	)
+	for i, c := range columns {
+		quoted[i] = quoteIdent(c)
+	}
+	var prefix = "INSERT INTO " + quoteIdent(table) + " (" + strings.Join(quoted, ",") + ") VALUES "
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			err = errors.Wrapf(ErrInvalidBulkRow, "row %d has %d values, expect %d",
+				i, len(row), len(columns))
+			return nil, nil, err
+		}
+	}
+	for begin := 0; begin < len(rows); begin += perStmt {
+		var (
+			end    = begin + perStmt
+			tuples []string
+			values []interface{}
+		)
+		if end > len(rows) {
+			end = len(rows)
+		}
+		tuples = make([]string, 0, end-begin)
+		values = make([]interface{}, 0, (end-begin)*len(columns))
+		for _, row := range rows[begin:end] {
+			tuples = append(tuples, tuple)
+			values = append(values, row...)
+		}
+		stmts = append(stmts, prefix+strings.Join(tuples, ","))
+		args = append(args, values)
+	}
+	return
+}
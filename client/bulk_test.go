@@ -0,0 +1,54 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBuildBulkInsert(t *testing.T) {
+	Convey("test build bulk insert statements", t, func() {
+		var (
+			origin = MaxBulkInsertParams
+			rows   [][]interface{}
+		)
+		MaxBulkInsertParams = 6
+		Reset(func() { MaxBulkInsertParams = origin })
+		for i := 0; i < 7; i++ {
+			rows = append(rows, []interface{}{i, "v"})
+		}
+
+		stmts, args, err := buildBulkInsert("t", []string{"k", "v"}, rows)
+		So(err, ShouldBeNil)
+		So(stmts, ShouldHaveLength, 3)
+		So(stmts[0], ShouldEqual, `INSERT INTO "t" ("k","v") VALUES (?,?),(?,?),(?,?)`)
+		So(stmts[2], ShouldEqual, `INSERT INTO "t" ("k","v") VALUES (?,?)`)
+		So(args[0], ShouldResemble, []interface{}{0, "v", 1, "v", 2, "v"})
+		So(args[2], ShouldResemble, []interface{}{6, "v"})
+
+		stmts, _, err = buildBulkInsert("t", []string{"k", "v"}, nil)
+		So(err, ShouldBeNil)
+		So(stmts, ShouldBeEmpty)
+
+		_, _, err = buildBulkInsert("t", []string{"k", "v"}, [][]interface{}{{1}})
+		So(errors.Cause(err), ShouldEqual, ErrInvalidBulkRow)
+		_, _, err = buildBulkInsert("t", nil, rows)
+		So(errors.Cause(err), ShouldEqual, ErrInvalidBulkRow)
+	})
+}
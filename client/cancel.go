@@ -0,0 +1,61 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// watchCancel cancels the read query on the miner once ctx is done, the returned function stops
+// watching and must be called after the query returns.
+func (c *pconn) watchCancel(ctx context.Context, dbID proto.DatabaseID, connID, seqNo uint64) (stop func()) {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	var done = make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.cancelQuery(dbID, connID, seqNo)
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// cancelQuery sends the best effort cancel request of the running read query to the miner.
+func (c *pconn) cancelQuery(dbID proto.DatabaseID, connID, seqNo uint64) {
+	var (
+		req = &types.CancelQueryReq{
+			DatabaseID:   dbID,
+			ConnectionID: connID,
+			SeqNo:        seqNo,
+		}
+		resp types.CancelQueryResp
+		err  = c.pCaller.Call(route.DBSCancelQuery.String(), req, &resp)
+	)
+	log.WithFields(log.Fields{
+		"connID":   connID,
+		"seqNo":    seqNo,
+		"target":   c.pCaller.Target(),
+		"canceled": resp.Canceled,
+	}).WithError(err).Debug("cancel query")
+}
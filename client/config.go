@@ -20,12 +20,36 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
 )
 
 const (
 	paramUseLeader    = "use_leader"
 	paramUseFollower  = "use_follower"
 	paramUseDirectRPC = "use_direct_rpc"
+	paramWarmStandby  = "warm_standby"
+	paramLatencyRoute = "latency_routing"
+	paramRoundRobin   = "round_robin"
+	paramMaxStale     = "max_staleness"
+	paramMaxStaleBlks = "max_stale_blocks"
+	paramCompress     = "compress"
+	paramLocation     = "loc"
+	paramTimeFormat   = "time_format"
+	paramParseTime    = "parse_time"
+	paramObserver     = "observer"
+	paramKey          = "key"
+	paramMaxOpen      = "max_open"
+	paramMaxIdle      = "max_idle"
+	paramMaxRetries   = "max_retries"
+	paramRetryBackoff = "retry_backoff"
+	paramRetryMaxWait = "retry_max_backoff"
+	paramRetryFactor  = "retry_multiplier"
+	paramResultCache  = "result_cache"
+	paramResultCheck  = "result_cache_check"
 )
 
 // Config is a configuration parsed from a DSN string.
@@ -44,6 +68,70 @@ type Config struct {
 
 	// UseDirectRPC use direct RPC to access the miner
 	UseDirectRPC bool
+
+	// WarmStandby is the number of follower miners kept connected as standbys, which take over
+	// the queries instantly when the leader becomes unreachable.
+	WarmStandby int
+
+	// LatencyRouting routes the follower reads to the healthy replica with the lowest measured
+	// round trip time instead of a random one, it only takes effect with UseFollower.
+	LatencyRouting bool
+
+	// RoundRobin spreads the follower reads across all the followers in turn instead of a
+	// single one, it only takes effect with UseFollower and supersedes LatencyRouting.
+	RoundRobin bool
+
+	// MaxStaleness and MaxStaleBlocks bound how far the follower serving a read may lag behind,
+	// in time or in sqlchain blocks. The reads are served by the leader instead if the follower
+	// lags too far. They are not bounded by the client if zero.
+	MaxStaleness   time.Duration
+	MaxStaleBlocks int32
+
+	// Compress negotiates the payload compression with the miners, large result sets and bulk
+	// writes are sent compressed if both sides support it.
+	Compress bool
+
+	// Location is the location of the returned time.Time values, they are returned in UTC by
+	// default.
+	Location *time.Location
+
+	// TimeFormat is the representation of the time.Time parameters, one of TimeFormatText,
+	// TimeFormatUnix and TimeFormatUnixMilli. The parameters are always converted to UTC first,
+	// and sent as TimeFormatText if it's empty. Note that the time.Time parameters were sent as
+	// is before, and stored by the miners as text in their own offsets, so that the values stored
+	// by earlier clients in non-UTC offsets do not compare in time order with the new ones.
+	TimeFormat string
+
+	// ParseTime parses the datetime text values of the columns without declared types, such as
+	// aggregates and expressions, to time.Time values.
+	ParseTime bool
+
+	// Observer is the base url of an observer materializing the database, such as
+	// http://127.0.0.1:2122, the reads issued with WithObserverRead are served by it.
+	Observer string
+
+	// Key is the alias of the named private key signing the queries instead of the local private
+	// key, see GetKey.
+	Key string
+
+	// MaxOpenConns and MaxIdleConns limit the open and idle connections of the pool opened by
+	// OpenDB, the defaults of database/sql are kept if zero.
+	MaxOpenConns int
+	MaxIdleConns int
+
+	// Retry is the retry policy of the queries failed by transient errors, the queries are not
+	// retried by default.
+	Retry RetryPolicy
+
+	// ResultCache serves the repeated read queries from the result cache of the driver until the
+	// sqlchain of the database advances, see SetResultCacheSize. ResultCacheCheck is the interval
+	// to check the block height of the database, DefaultResultCacheCheck is used if zero.
+	ResultCache      bool
+	ResultCacheCheck time.Duration
+
+	// PrivateKey signs the queries instead of the local private key, it is not encoded in DSN
+	// and only takes effect with the connector returned by NewConnector.
+	PrivateKey *asymmetric.PrivateKey
 }
 
 // NewConfig creates a new config with default value.
@@ -71,6 +159,63 @@ func (cfg *Config) FormatDSN() string {
 	if cfg.UseDirectRPC {
 		newQuery.Add(paramUseDirectRPC, strconv.FormatBool(cfg.UseDirectRPC))
 	}
+	if cfg.WarmStandby > 0 {
+		newQuery.Add(paramWarmStandby, strconv.Itoa(cfg.WarmStandby))
+	}
+	if cfg.LatencyRouting {
+		newQuery.Add(paramLatencyRoute, strconv.FormatBool(cfg.LatencyRouting))
+	}
+	if cfg.RoundRobin {
+		newQuery.Add(paramRoundRobin, strconv.FormatBool(cfg.RoundRobin))
+	}
+	if cfg.MaxStaleness > 0 {
+		newQuery.Add(paramMaxStale, cfg.MaxStaleness.String())
+	}
+	if cfg.MaxStaleBlocks > 0 {
+		newQuery.Add(paramMaxStaleBlks, strconv.FormatInt(int64(cfg.MaxStaleBlocks), 10))
+	}
+	if cfg.Compress {
+		newQuery.Add(paramCompress, strconv.FormatBool(cfg.Compress))
+	}
+	if cfg.Location != nil {
+		newQuery.Add(paramLocation, cfg.Location.String())
+	}
+	if cfg.TimeFormat != "" {
+		newQuery.Add(paramTimeFormat, cfg.TimeFormat)
+	}
+	if cfg.ParseTime {
+		newQuery.Add(paramParseTime, strconv.FormatBool(cfg.ParseTime))
+	}
+	if cfg.Observer != "" {
+		newQuery.Add(paramObserver, cfg.Observer)
+	}
+	if cfg.Key != "" {
+		newQuery.Add(paramKey, cfg.Key)
+	}
+	if cfg.MaxOpenConns > 0 {
+		newQuery.Add(paramMaxOpen, strconv.Itoa(cfg.MaxOpenConns))
+	}
+	if cfg.MaxIdleConns > 0 {
+		newQuery.Add(paramMaxIdle, strconv.Itoa(cfg.MaxIdleConns))
+	}
+	if cfg.Retry.MaxRetries > 0 {
+		newQuery.Add(paramMaxRetries, strconv.Itoa(cfg.Retry.MaxRetries))
+	}
+	if cfg.Retry.InitialBackoff > 0 {
+		newQuery.Add(paramRetryBackoff, cfg.Retry.InitialBackoff.String())
+	}
+	if cfg.Retry.MaxBackoff > 0 {
+		newQuery.Add(paramRetryMaxWait, cfg.Retry.MaxBackoff.String())
+	}
+	if cfg.Retry.Multiplier > 0 {
+		newQuery.Add(paramRetryFactor, strconv.FormatFloat(cfg.Retry.Multiplier, 'g', -1, 64))
+	}
+	if cfg.ResultCache {
+		newQuery.Add(paramResultCache, strconv.FormatBool(cfg.ResultCache))
+	}
+	if cfg.ResultCacheCheck > 0 {
+		newQuery.Add(paramResultCheck, cfg.ResultCacheCheck.String())
+	}
 	u.RawQuery = newQuery.Encode()
 
 	return u.String()
@@ -98,6 +243,63 @@ func ParseDSN(dsn string) (cfg *Config, err error) {
 		cfg.UseLeader = true
 	}
 	cfg.UseDirectRPC, _ = strconv.ParseBool(q.Get(paramUseDirectRPC))
+	cfg.WarmStandby, _ = strconv.Atoi(q.Get(paramWarmStandby))
+	if cfg.WarmStandby < 0 {
+		cfg.WarmStandby = 0
+	}
+	cfg.LatencyRouting, _ = strconv.ParseBool(q.Get(paramLatencyRoute))
+	cfg.RoundRobin, _ = strconv.ParseBool(q.Get(paramRoundRobin))
+	if stale := q.Get(paramMaxStale); stale != "" {
+		if cfg.MaxStaleness, err = time.ParseDuration(stale); err != nil {
+			return nil, errors.Wrapf(err, "invalid max staleness %s", stale)
+		}
+	}
+	if blocks, _ := strconv.ParseInt(q.Get(paramMaxStaleBlks), 10, 32); blocks > 0 {
+		cfg.MaxStaleBlocks = int32(blocks)
+	}
+	cfg.Compress, _ = strconv.ParseBool(q.Get(paramCompress))
+	if loc := q.Get(paramLocation); loc != "" {
+		if cfg.Location, err = time.LoadLocation(loc); err != nil {
+			return nil, errors.Wrapf(err, "invalid location %s", loc)
+		}
+	}
+	cfg.TimeFormat = q.Get(paramTimeFormat)
+	if !isValidTimeFormat(cfg.TimeFormat) {
+		return nil, errors.Wrapf(ErrInvalidTimeFormat, "time format %s", cfg.TimeFormat)
+	}
+	cfg.ParseTime, _ = strconv.ParseBool(q.Get(paramParseTime))
+	cfg.Observer = q.Get(paramObserver)
+	cfg.Key = q.Get(paramKey)
+	if cfg.MaxOpenConns, _ = strconv.Atoi(q.Get(paramMaxOpen)); cfg.MaxOpenConns < 0 {
+		cfg.MaxOpenConns = 0
+	}
+	if cfg.MaxIdleConns, _ = strconv.Atoi(q.Get(paramMaxIdle)); cfg.MaxIdleConns < 0 {
+		cfg.MaxIdleConns = 0
+	}
+	if cfg.Retry.MaxRetries, _ = strconv.Atoi(q.Get(paramMaxRetries)); cfg.Retry.MaxRetries < 0 {
+		cfg.Retry.MaxRetries = 0
+	}
+	if backoff := q.Get(paramRetryBackoff); backoff != "" {
+		if cfg.Retry.InitialBackoff, err = time.ParseDuration(backoff); err != nil {
+			return nil, errors.Wrapf(err, "invalid retry backoff %s", backoff)
+		}
+	}
+	if backoff := q.Get(paramRetryMaxWait); backoff != "" {
+		if cfg.Retry.MaxBackoff, err = time.ParseDuration(backoff); err != nil {
+			return nil, errors.Wrapf(err, "invalid retry max backoff %s", backoff)
+		}
+	}
+	if factor := q.Get(paramRetryFactor); factor != "" {
+		if cfg.Retry.Multiplier, err = strconv.ParseFloat(factor, 64); err != nil {
+			return nil, errors.Wrapf(err, "invalid retry multiplier %s", factor)
+		}
+	}
+	cfg.ResultCache, _ = strconv.ParseBool(q.Get(paramResultCache))
+	if check := q.Get(paramResultCheck); check != "" {
+		if cfg.ResultCacheCheck, err = time.ParseDuration(check); err != nil {
+			return nil, errors.Wrapf(err, "invalid result cache check interval %s", check)
+		}
+	}
 
 	return cfg, nil
 }
@@ -18,6 +18,7 @@ package client
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -90,5 +91,71 @@ func TestConfig(t *testing.T) {
 			UseLeader:   true,
 			UseFollower: true,
 		})
+		testFormatAndParse(&Config{
+			UseLeader:   true,
+			WarmStandby: 2,
+		})
+		testFormatAndParse(&Config{
+			UseLeader:      true,
+			UseFollower:    true,
+			LatencyRouting: true,
+		})
+		testFormatAndParse(&Config{
+			UseLeader:      true,
+			UseFollower:    true,
+			RoundRobin:     true,
+			MaxStaleness:   3 * time.Second,
+			MaxStaleBlocks: 2,
+		})
+		testFormatAndParse(&Config{
+			UseLeader: true,
+			Compress:  true,
+		})
+		testFormatAndParse(&Config{
+			UseLeader:  true,
+			Location:   time.UTC,
+			TimeFormat: TimeFormatUnixMilli,
+			ParseTime:  true,
+		})
+		testFormatAndParse(&Config{
+			UseLeader: true,
+			Observer:  "http://127.0.0.1:2122",
+		})
+		testFormatAndParse(&Config{
+			UseLeader: true,
+			Key:       "ops",
+		})
+		testFormatAndParse(&Config{
+			UseLeader:    true,
+			MaxOpenConns: 16,
+			MaxIdleConns: 4,
+		})
+		testFormatAndParse(&Config{
+			UseLeader: true,
+			Retry: RetryPolicy{
+				MaxRetries:     3,
+				InitialBackoff: 50 * time.Millisecond,
+				MaxBackoff:     2 * time.Second,
+				Multiplier:     1.5,
+			},
+		})
+		testFormatAndParse(&Config{
+			UseLeader:        true,
+			ResultCache:      true,
+			ResultCacheCheck: 5 * time.Second,
+		})
+	})
+
+	Convey("test dsn with invalid time options", t, func() {
+		_, err := ParseDSN("cqlprotocol://db?loc=Nowhere/Unknown")
+		So(err, ShouldNotBeNil)
+		_, err = ParseDSN("cqlprotocol://db?time_format=iso")
+		So(err, ShouldNotBeNil)
+		_, err = ParseDSN("cqlprotocol://db?max_staleness=3")
+		So(err, ShouldNotBeNil)
+		_, err = ParseDSN("cqlprotocol://db?retry_backoff=fast")
+		So(err, ShouldNotBeNil)
+		_, err = ParseDSN("cqlprotocol://db?result_cache_check=soon")
+		So(err, ShouldNotBeNil)
 	})
 }
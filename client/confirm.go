@@ -0,0 +1,198 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultConfirmInterval defines the default polling interval of WaitTxConfirmed.
+	DefaultConfirmInterval = time.Second
+	// DefaultRejectTimeout defines how long a transaction never seen by the block producers is
+	// considered as rejected.
+	DefaultRejectTimeout = 10 * time.Second
+)
+
+// WaitOptions defines the options of WaitTxConfirmed.
+type WaitOptions struct {
+	// Depth is the number of blocks required on top of the confirmed transaction block,
+	// including the block itself. Zero or one returns as soon as the transaction is confirmed.
+	Depth uint32
+	// Timeout limits the whole waiting, zero means waiting until the context is done.
+	Timeout time.Duration
+	// Interval is the polling interval of the transaction state.
+	Interval time.Duration
+	// RejectTimeout is the duration before an unseen transaction is reported as rejected, the
+	// block producers add transactions asynchronously and silently drop invalid ones.
+	RejectTimeout time.Duration
+	// Updates subscribes the status changes of the transaction if not nil, the channel is
+	// never closed by WaitTxConfirmed and the sends are dropped if the channel is not ready.
+	Updates chan<- TxStatus
+}
+
+// TxStatus defines an observed status of a transaction.
+type TxStatus struct {
+	Hash  hash.Hash
+	State pi.TransactionState
+	// Height is the height of the block packing the transaction.
+	Height uint32
+	// Depth is the number of blocks on top of the transaction block, including itself.
+	Depth uint32
+}
+
+// statusQuerier queries the transaction status from the block producers.
+type statusQuerier func(txHash hash.Hash) (TxStatus, error)
+
+func queryTxStatus(txHash hash.Hash) (status TxStatus, err error) {
+	var (
+		req  = &types.QueryTxStateReq{Hash: txHash}
+		resp = &types.QueryTxStateResp{}
+	)
+	if err = requestBP(route.MCCQueryTxState, req, resp); err != nil {
+		err = errors.Wrapf(err, "failed to call %s", route.MCCQueryTxState)
+		return
+	}
+	status = TxStatus{
+		Hash:   txHash,
+		State:  resp.State,
+		Height: resp.Height,
+	}
+	if resp.Height > 0 && resp.HeadHeight >= resp.Height {
+		status.Depth = resp.HeadHeight - resp.Height + 1
+	}
+	return
+}
+
+// WaitTxConfirmed waits for the transaction with target hash txHash to be confirmed with the
+// required depth. A failed transaction is reported by an error with cause ErrTxRejected,
+// ErrTxExpired or ErrTxReorged, a timeout by the context error.
+func WaitTxConfirmed(ctx context.Context, txHash hash.Hash, opts *WaitOptions) (
+	status TxStatus, err error,
+) {
+	if opts == nil {
+		opts = &WaitOptions{}
+	}
+	if status, err = waitTxConfirmed(ctx, txHash, opts, queryTxStatus); err == nil {
+		nonces.settle(txHash, status.State)
+	} else {
+		switch errors.Cause(err) {
+		case ErrTxRejected, ErrTxExpired:
+			nonces.settle(txHash, pi.TransactionStateExpired)
+		}
+	}
+	return
+}
+
+func waitTxConfirmed(
+	ctx context.Context, txHash hash.Hash, opts *WaitOptions, query statusQuerier) (
+	status TxStatus, err error,
+) {
+	var (
+		interval      = opts.Interval
+		rejectTimeout = opts.RejectTimeout
+		start         = time.Now()
+		seen, packed  bool
+		last          TxStatus
+	)
+	if interval <= 0 {
+		interval = DefaultConfirmInterval
+	}
+	if rejectTimeout <= 0 {
+		rejectTimeout = DefaultRejectTimeout
+	}
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if status, err = query(txHash); err != nil {
+			return
+		}
+		if status != last {
+			last = status
+			log.WithFields(log.Fields{
+				"tx_hash":  txHash,
+				"tx_state": status.State,
+				"height":   status.Height,
+				"depth":    status.Depth,
+			}).Debug("transaction status changed")
+			if opts.Updates != nil {
+				select {
+				case opts.Updates <- status:
+				default:
+				}
+			}
+		}
+
+		switch status.State {
+		case pi.TransactionStatePending:
+			if packed {
+				err = errors.Wrapf(ErrTxReorged, "transaction %s returned to pool", txHash)
+				return
+			}
+			seen = true
+		case pi.TransactionStatePacked:
+			seen, packed = true, true
+		case pi.TransactionStateConfirmed:
+			if status.Depth >= opts.Depth {
+				return
+			}
+			seen, packed = true, true
+		case pi.TransactionStateExpired:
+			err = errors.Wrapf(ErrTxExpired, "transaction %s expired", txHash)
+			return
+		case pi.TransactionStateNotFound:
+			if packed {
+				err = errors.Wrapf(ErrTxReorged, "transaction %s dropped from chain", txHash)
+				return
+			}
+			if seen {
+				err = errors.Wrapf(ErrTxRejected, "transaction %s dropped from pool", txHash)
+				return
+			}
+			if time.Since(start) >= rejectTimeout {
+				err = errors.Wrapf(ErrTxRejected, "transaction %s not accepted in %s",
+					txHash, rejectTimeout)
+				return
+			}
+		default:
+			err = errors.Errorf("unknown transaction state %d", status.State)
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto/hash"
+)
+
+// replayStatus returns a querier replaying the status sequence, the last one is repeated.
+func replayStatus(seq ...TxStatus) statusQuerier {
+	var i int
+	return func(txHash hash.Hash) (status TxStatus, err error) {
+		status = seq[i]
+		status.Hash = txHash
+		if i < len(seq)-1 {
+			i++
+		}
+		return
+	}
+}
+
+func TestWaitTxConfirmed(t *testing.T) {
+	Convey("test wait tx confirmed", t, func() {
+		var (
+			txHash = hash.HashH([]byte("tx"))
+			ctx    = context.Background()
+			opts   = &WaitOptions{Interval: time.Millisecond, RejectTimeout: 20 * time.Millisecond}
+		)
+		Convey("should wait for the required depth", func() {
+			updates := make(chan TxStatus, 10)
+			opts.Depth = 3
+			opts.Updates = updates
+			status, err := waitTxConfirmed(ctx, txHash, opts, replayStatus(
+				TxStatus{State: pi.TransactionStateNotFound},
+				TxStatus{State: pi.TransactionStatePending},
+				TxStatus{State: pi.TransactionStatePacked, Height: 5, Depth: 1},
+				TxStatus{State: pi.TransactionStateConfirmed, Height: 5, Depth: 2},
+				TxStatus{State: pi.TransactionStateConfirmed, Height: 5, Depth: 3},
+			))
+			So(err, ShouldBeNil)
+			So(status.Height, ShouldEqual, 5)
+			So(status.Depth, ShouldEqual, 3)
+			So(len(updates), ShouldEqual, 5)
+		})
+		Convey("should report failure reasons", func() {
+			_, err := waitTxConfirmed(ctx, txHash, opts, replayStatus(
+				TxStatus{State: pi.TransactionStateNotFound},
+			))
+			So(errors.Cause(err), ShouldEqual, ErrTxRejected)
+			_, err = waitTxConfirmed(ctx, txHash, opts, replayStatus(
+				TxStatus{State: pi.TransactionStatePending},
+				TxStatus{State: pi.TransactionStateExpired},
+			))
+			So(errors.Cause(err), ShouldEqual, ErrTxExpired)
+			_, err = waitTxConfirmed(ctx, txHash, opts, replayStatus(
+				TxStatus{State: pi.TransactionStatePacked, Height: 5, Depth: 1},
+				TxStatus{State: pi.TransactionStateNotFound},
+			))
+			So(errors.Cause(err), ShouldEqual, ErrTxReorged)
+		})
+		Convey("should stop on timeout", func() {
+			opts.Timeout = 10 * time.Millisecond
+			_, err := waitTxConfirmed(ctx, txHash, opts, replayStatus(
+				TxStatus{State: pi.TransactionStatePending},
+			))
+			So(err, ShouldEqual, context.DeadlineExceeded)
+		})
+	})
+}
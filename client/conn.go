@@ -46,10 +46,39 @@ type conn struct {
 	privKey     *asymmetric.PrivateKey
 
 	inTransaction bool
+	txWriteAck    types.WriteAck
 	closed        int32
 
-	leader   *pconn
-	follower *pconn
+	// pconnLock protects leader, follower, followers and standbys, which are replaced by the
+	// failover and rerouting while the warm ups and ack workers are running.
+	pconnLock sync.Mutex
+	leader    *pconn
+	follower  *pconn
+
+	// standbys are the warm connections to other followers, see standby.go.
+	standbys     []*pconn
+	standbyWg    sync.WaitGroup
+	useDirectRPC bool
+
+	// latencyRouting routes the reads to the lowest latency replica, see latency.go.
+	latencyRouting bool
+	// followers serve the reads in turn if round robin is enabled, see balance.go.
+	followers []*pconn
+	rrIndex   uint32
+	// maxStaleness and maxStaleBlocks bound the lag of the follower serving the reads.
+	maxStaleness   time.Duration
+	maxStaleBlocks int32
+	// compress negotiates the payload compression with the miners.
+	compress bool
+	// times is the datetime handling of parameters and results, see datetime.go.
+	times timeOptions
+	// observer is the base url of the observer serving the offloaded reads, see observer.go.
+	observer string
+	// retry is the retry policy of the transient query failures, see retry.go.
+	retry RetryPolicy
+	// resultCache serves the repeated reads from the result cache, see resultcache.go.
+	resultCache      bool
+	resultCacheCheck time.Duration
 }
 
 // pconn represents a connection to a peer.
@@ -58,6 +87,11 @@ type pconn struct {
 	parent  *conn
 	ackCh   chan *types.Ack
 	pCaller rpc.PCaller
+	ready   int32 // set when a standby connection is established and authenticated
+	// encoding is the payload compression accepted by the peer, learned from its responses.
+	encoding uint32
+	// epoch is the health epoch of the peer when connected, see health.go.
+	epoch uint64
 }
 
 const workerCount int = 2
@@ -70,9 +104,16 @@ func newConn(cfg *Config) (c *conn, err error) {
 	}
 
 	// get local private key
-	var privKey *asymmetric.PrivateKey
-	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
-		return
+	var privKey = cfg.PrivateKey
+	if privKey == nil && cfg.Key != "" {
+		if privKey, err = GetKey(cfg.Key); err != nil {
+			return
+		}
+	}
+	if privKey == nil {
+		if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+			return
+		}
 	}
 
 	c = &conn{
@@ -80,6 +121,39 @@ func newConn(cfg *Config) (c *conn, err error) {
 		localNodeID: localNodeID,
 		privKey:     privKey,
 		queries:     make([]types.Query, 0),
+
+		useDirectRPC:   cfg.UseDirectRPC,
+		latencyRouting: cfg.UseFollower && cfg.LatencyRouting && !cfg.RoundRobin,
+		maxStaleness:   cfg.MaxStaleness,
+		maxStaleBlocks: cfg.MaxStaleBlocks,
+		compress:       cfg.Compress,
+		times: timeOptions{
+			loc:       cfg.Location,
+			format:    cfg.TimeFormat,
+			parseTime: cfg.ParseTime,
+		},
+		observer: cfg.Observer,
+		retry:    cfg.Retry,
+		// the lite mode has no sqlchain to tell the staleness of the cached results
+		resultCache:      cfg.ResultCache && !IsLiteMode(),
+		resultCacheCheck: cfg.ResultCacheCheck,
+	}
+	if c.resultCacheCheck <= 0 {
+		c.resultCacheCheck = DefaultResultCacheCheck
+	}
+
+	// serve queries in-process in lite mode
+	if IsLiteMode() {
+		var caller *liteCaller
+		if caller, err = newLiteCaller(c.dbID); err != nil {
+			return nil, err
+		}
+		c.leader = &pconn{
+			wg:      &sync.WaitGroup{},
+			parent:  c,
+			pCaller: caller,
+		}
+		return
 	}
 
 	// get peers from BP
@@ -89,37 +163,32 @@ func newConn(cfg *Config) (c *conn, err error) {
 	}
 
 	if cfg.UseLeader {
-		var caller rpc.PCaller
-		if cfg.UseDirectRPC {
-			caller = rpc.NewPersistentCaller(peers.Leader)
-		} else {
-			caller = mux.NewPersistentCaller(peers.Leader)
+		c.leader = c.newPConn(peers.Leader)
+	}
+
+	// spread the reads across all the followers
+	if cfg.UseFollower && cfg.RoundRobin && len(peers.Servers) > 1 {
+		for _, node := range readCandidates(peers) {
+			c.followers = append(c.followers, c.newPConn(node))
 		}
-		c.leader = &pconn{
-			wg:      &sync.WaitGroup{},
-			ackCh:   make(chan *types.Ack, workerCount*4),
-			parent:  c,
-			pCaller: caller,
+		c.follower = c.followers[0]
+	}
+
+	// choose the lowest latency follower node if measured
+	if c.latencyRouting && len(peers.Servers) > 1 {
+		var candidates = readCandidates(peers)
+		c.probeReplicas(candidates)
+		if node, ok := replicaRTTs.best(candidates); ok {
+			c.follower = c.newPConn(node)
 		}
 	}
 
 	// choose a random follower node
-	if cfg.UseFollower && len(peers.Servers) > 1 {
+	if cfg.UseFollower && c.follower == nil && len(peers.Servers) > 1 {
 		for {
 			node := peers.Servers[randSource.Intn(len(peers.Servers))]
 			if node != peers.Leader {
-				var caller rpc.PCaller
-				if cfg.UseDirectRPC {
-					caller = rpc.NewPersistentCaller(node)
-				} else {
-					caller = mux.NewPersistentCaller(node)
-				}
-				c.follower = &pconn{
-					wg:      &sync.WaitGroup{},
-					ackCh:   make(chan *types.Ack, workerCount*4),
-					parent:  c,
-					pCaller: caller,
-				}
+				c.follower = c.newPConn(node)
 				break
 			}
 		}
@@ -139,11 +208,40 @@ func newConn(cfg *Config) (c *conn, err error) {
 			return nil, errors.WithMessage(err, "follower startAckWorkers failed")
 		}
 	}
+	for _, f := range c.followers {
+		if f == c.follower {
+			continue
+		}
+		if err := f.startAckWorkers(); err != nil {
+			return nil, errors.WithMessage(err, "follower startAckWorkers failed")
+		}
+	}
+
+	if cfg.WarmStandby > 0 {
+		c.startStandbys(peers, cfg.WarmStandby)
+	}
 
 	log.WithField("db", c.dbID).Debug("new connection to database")
 	return
 }
 
+// newPConn creates a peer connection to the node.
+func (c *conn) newPConn(node proto.NodeID) *pconn {
+	var caller rpc.PCaller
+	if c.useDirectRPC {
+		caller = rpc.NewPersistentCaller(node)
+	} else {
+		caller = mux.NewPersistentCaller(node)
+	}
+	return &pconn{
+		wg:      &sync.WaitGroup{},
+		ackCh:   make(chan *types.Ack, workerCount*4),
+		parent:  c,
+		pCaller: caller,
+		epoch:   peerHealth.watch(node),
+	}
+}
+
 func (c *pconn) startAckWorkers() (err error) {
 	for i := 0; i < workerCount; i++ {
 		c.wg.Add(1)
@@ -196,11 +294,19 @@ ackWorkerLoop:
 	log.Debug("ack worker quiting")
 }
 
+// acceptEncoding returns the payload compression accepted by the peer.
+func (c *pconn) acceptEncoding() types.CompressionType {
+	return types.CompressionType(atomic.LoadUint32(&c.encoding))
+}
+
 func (c *pconn) close() error {
 	c.stopAckWorkers()
 	c.wg.Wait()
 	if c.pCaller != nil {
 		c.pCaller.Close()
+		if c.ackCh != nil { // the in-process peer of lite mode is not watched
+			peerHealth.unwatch(proto.NodeID(c.pCaller.Target()))
+		}
 	}
 	return nil
 }
@@ -216,12 +322,20 @@ func (c *conn) Close() error {
 	if atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
 		log.WithField("db", c.dbID).Debug("closed connection")
 	}
+	c.pconnLock.Lock()
 	if c.leader != nil {
 		c.leader.close()
 	}
 	if c.follower != nil {
 		c.follower.close()
 	}
+	for _, f := range c.followers {
+		if f != c.follower {
+			f.close()
+		}
+	}
+	c.pconnLock.Unlock()
+	c.closeStandbys()
 	return nil
 }
 
@@ -245,6 +359,7 @@ func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, e
 
 	// TODO(xq262144): make use of the ctx argument
 	c.inTransaction = true
+	c.txWriteAck = getWriteAck(ctx)
 	c.queries = c.queries[:0]
 
 	return c, nil
@@ -258,12 +373,26 @@ func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, e
 
 	log.WithField("query", query).Debug("prepared statement")
 
-	// prepare the statement
-	return newStmt(c, query), nil
+	// prepare the statement, the syntax errors are reported without a round trip
+	pq := getPreparedQuery(c.dbID, query)
+	if pq.err != nil {
+		return nil, pq.err
+	}
+	s := newStmt(c, query)
+	s.ddl = pq.ddl
+	return s, nil
 }
 
 // ExecContext implements the driver.ExecerContext.ExecContext method.
 func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, err error) {
+	return c.execContext(ctx, query, args, isSchemaChange(query))
+}
+
+// execContext executes the write query, the cached statements of the database are invalidated
+// if the query changes the schema.
+func (c *conn) execContext(
+	ctx context.Context, query string, args []driver.NamedValue, ddl bool) (result driver.Result, err error,
+) {
 	defer trace.StartRegion(ctx, "dbExec").End()
 
 	if atomic.LoadInt32(&c.closed) != 0 {
@@ -272,12 +401,19 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 	}
 
 	// TODO(xq262144): make use of the ctx argument
-	sq := convertQuery(query, args)
+	sq, err := convertQuery(query, args)
+	if err != nil {
+		return
+	}
+	c.times.encodeArgs(sq.Args)
 
 	var affectedRows, lastInsertID int64
 	if affectedRows, lastInsertID, _, err = c.addQuery(ctx, types.WriteQuery, sq); err != nil {
 		return
 	}
+	if ddl {
+		invalidateStmtCache(c.dbID)
+	}
 
 	result = &execResult{
 		affectedRows: affectedRows,
@@ -296,7 +432,20 @@ func (c *conn) QueryContext(ctx context.Context, query string, args []driver.Nam
 	}
 
 	// TODO(xq262144): make use of the ctx argument
-	sq := convertQuery(query, args)
+	sq, err := convertQuery(query, args)
+	if err != nil {
+		return
+	}
+	c.times.encodeArgs(sq.Args)
+	if read, ok := getObserverRead(ctx); ok && !c.inTransaction {
+		return c.queryObserver(ctx, sq, read)
+	}
+	if size, ok := getStreamPageSize(ctx); ok && !c.inTransaction {
+		return c.queryStream(ctx, sq, size)
+	}
+	if c.resultCache && !c.inTransaction {
+		return c.queryCached(ctx, sq)
+	}
 	_, _, rows, err = c.addQuery(ctx, types.ReadQuery, sq)
 
 	return
@@ -319,7 +468,8 @@ func (c *conn) Commit() (err error) {
 
 	if len(c.queries) > 0 {
 		// send query
-		if _, _, _, err = c.sendQuery(context.Background(), types.WriteQuery, c.queries); err != nil {
+		ctx := WithWriteAck(context.Background(), c.txWriteAck)
+		if _, _, _, err = c.sendQuery(ctx, types.WriteQuery, c.queries); err != nil {
 			return
 		}
 	}
@@ -358,8 +508,11 @@ func (c *conn) addQuery(ctx context.Context, queryType types.QueryType, query *t
 			return
 		}
 
-		// append queries
+		// append queries, the transaction is committed with the strongest write ack of them
 		c.queries = append(c.queries, *query)
+		if ack := getWriteAck(ctx); ack > c.txWriteAck {
+			c.txWriteAck = ack
+		}
 
 		log.WithFields(log.Fields{
 			"pattern": query.Pattern,
@@ -380,6 +533,18 @@ func (c *conn) addQuery(ctx context.Context, queryType types.QueryType, query *t
 func (c *conn) sendQuery(ctx context.Context, queryType types.QueryType, queries []types.Query) (affectedRows int64, lastInsertID int64, rows driver.Rows, err error) {
 	var uc *pconn // peer connection used to execute the queries
 
+	pg, _ := ctx.Value(&ctxPageKey).(*page)
+	// the following pages are served by the cursor on the current follower
+	if queryType == types.ReadQuery && c.latencyRouting && (pg == nil || len(pg.token) == 0) {
+		c.maybeReroute()
+	}
+
+	c.pconnLock.Lock()
+	// rotate the followers by reads, the following pages stay on the follower of the first page
+	if queryType == types.ReadQuery && len(c.followers) > 1 && (pg == nil || len(pg.token) == 0) {
+		c.follower = c.nextFollower()
+	}
+
 	uc = c.leader
 	// use follower pconn only when the query is readonly
 	if queryType == types.ReadQuery && c.follower != nil {
@@ -388,11 +553,23 @@ func (c *conn) sendQuery(ctx context.Context, queryType types.QueryType, queries
 	if uc == nil {
 		uc = c.follower
 	}
+	c.pconnLock.Unlock()
+	// the following pages are served by the cursor on the same miner
+	if pg == nil || len(pg.token) == 0 {
+		uc = c.renewPConn(uc, queryType)
+	}
 
 	// allocate sequence
 	connID, seqNo := allocateConnAndSeq()
 	defer putBackConn(connID)
 
+	// instrument the query with the registered hooks, see hooks.go
+	qh := newQueryHooks(c.dbID, queryType, queries, connID, seqNo)
+	ctx = qh.before(ctx, proto.NodeID(uc.pCaller.Target()))
+	defer func() {
+		qh.after(ctx, proto.NodeID(uc.pCaller.Target()), err)
+	}()
+
 	defer func() {
 		log.WithFields(log.Fields{
 			"count":  len(queries),
@@ -405,25 +582,41 @@ func (c *conn) sendQuery(ctx context.Context, queryType types.QueryType, queries
 	}()
 
 	// build request
-	req := &types.Request{
-		Header: types.SignedRequestHeader{
-			RequestHeader: types.RequestHeader{
-				QueryType:    queryType,
-				NodeID:       c.localNodeID,
-				DatabaseID:   c.dbID,
-				ConnectionID: connID,
-				SeqNo:        seqNo,
-				Timestamp:    getLocalTime(),
-			},
-		},
-		Payload: types.RequestPayload{
-			Queries: queries,
-		},
+	var req *types.Request
+	// sign with the key selected for the query if any
+	var privKey = c.privKey
+	if key, ok := getQueryKey(ctx); ok {
+		privKey = key
 	}
-
-	if err = req.Sign(c.privKey); err != nil {
+	if req, err = c.newRequest(privKey, queryType, connID, seqNo, queries); err != nil {
 		return
 	}
+	// forward the context deadline to lower the statement timeout of the database
+	if deadline, ok := ctx.Deadline(); ok && queryType == types.ReadQuery {
+		if timeout := time.Until(deadline); timeout > 0 {
+			req.Timeout = timeout
+		}
+	}
+	if queryType == types.ReadQuery {
+		req.MaxStaleness, req.MaxStaleBlocks = c.maxStaleness, c.maxStaleBlocks
+	}
+	if pg != nil && queryType == types.ReadQuery {
+		req.Page = types.PageRequest{Size: pg.size, Token: pg.token, Close: pg.close}
+	}
+	if queryType == types.WriteQuery {
+		req.WriteAck = getWriteAck(ctx)
+		if c.retry.enabled() {
+			if req.IdempotencyKey, err = newIdempotencyKey(); err != nil {
+				return
+			}
+		}
+	}
+	if c.compress {
+		req.AcceptEncoding = types.CompressionDeflate
+		if err = req.Compress(uc.acceptEncoding()); err != nil {
+			return
+		}
+	}
 
 	// set receipt if key exists in context
 	if val := ctx.Value(&ctxReceiptKey); val != nil {
@@ -433,14 +626,61 @@ func (c *conn) sendQuery(ctx context.Context, queryType types.QueryType, queries
 	}
 
 	var response types.Response
-	if err = uc.pCaller.Call(route.DBSQuery.String(), req, &response); err != nil {
+	if err = c.callQueryRetry(ctx, uc, privKey, req, &response, qh); err != nil && pg == nil && c.isStaleRead(uc, err) {
+		// the follower lags too far behind, fall back to the leader
+		if uc, err = c.readLeader(req); err == nil {
+			err = c.callQuery(ctx, uc, req, &response)
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// canceled by the caller, the peer is not to blame
+			return
+		}
+		if !isMinerError(err) {
+			// the query time includes execution, only the probes measure the RTT
+			replicaRTTs.observe(proto.NodeID(uc.pCaller.Target()), 0, err)
+		}
+		var next = c.failover(uc, queryType, err)
+		if next == nil || queryType != types.ReadQuery {
+			return
+		}
+		// read queries are retried on the promoted standby, writes are never resent
+		uc = next
+		if req.Encoding != uc.acceptEncoding() {
+			if err = req.Decompress(); err != nil {
+				return
+			}
+		}
+		if err = c.callQuery(ctx, uc, req, &response); err != nil {
+			return
+		}
+	}
+	atomic.StoreUint32(&uc.encoding, uint32(response.AcceptEncoding))
+	if err = response.Decompress(); err != nil {
 		return
 	}
-	rows = newRows(&response)
+	qh.result(&response)
+	rs := newRows(&response)
+	rs.times = &c.times
+	rs.height = response.BlockHeight
+	rows = rs
+	if pg != nil {
+		pg.next.Store(response.NextPage)
+	}
 
 	if queryType == types.WriteQuery {
 		affectedRows = response.Header.AffectedRows
 		lastInsertID = response.Header.LastInsertID
+		// the cached results may not reflect the write until the next block
+		invalidateResultCache(c.dbID)
+		// attach the signed receipt if key exists in context
+		if val := ctx.Value(&ctxReceiptKey); val != nil && response.Receipt != nil {
+			val.(*atomic.Value).Store(&Receipt{
+				RequestHash: req.Header.Hash(),
+				Signed:      response.Receipt,
+			})
+		}
 	}
 
 	// build ack
@@ -463,11 +703,56 @@ func (c *conn) sendQuery(ctx context.Context, queryType types.QueryType, queries
 	return
 }
 
+// callQuery sends the query request to the miner, the running read query is canceled on the
+// miner once ctx is done.
+func (c *conn) callQuery(ctx context.Context, uc *pconn, req *types.Request, resp *types.Response) (err error) {
+	if req.Header.QueryType != types.ReadQuery {
+		return uc.pCaller.Call(route.DBSQuery.String(), req, resp)
+	}
+	stop := uc.watchCancel(ctx, c.dbID, req.Header.ConnectionID, req.Header.SeqNo)
+	err = uc.pCaller.Call(route.DBSQuery.String(), req, resp)
+	stop()
+	if err != nil && ctx.Err() != nil {
+		err = errors.Wrapf(ctx.Err(), "query canceled: %v", err)
+	}
+	return
+}
+
+// newRequest builds and signs the query request with the private key.
+func (c *conn) newRequest(
+	privKey *asymmetric.PrivateKey, queryType types.QueryType, connID, seqNo uint64,
+	queries []types.Query) (req *types.Request, err error,
+) {
+	req = &types.Request{
+		Header: types.SignedRequestHeader{
+			RequestHeader: types.RequestHeader{
+				QueryType:    queryType,
+				NodeID:       c.localNodeID,
+				DatabaseID:   c.dbID,
+				ConnectionID: connID,
+				SeqNo:        seqNo,
+				Timestamp:    getLocalTime(),
+			},
+		},
+		Payload: types.RequestPayload{
+			Queries: queries,
+		},
+	}
+	if err = req.Sign(privKey); err != nil {
+		req = nil
+	}
+	return
+}
+
 func getLocalTime() time.Time {
 	return time.Now().UTC()
 }
 
-func convertQuery(query string, args []driver.NamedValue) (sq *types.Query) {
+func convertQuery(query string, args []driver.NamedValue) (sq *types.Query, err error) {
+	if query, args, err = bindNamedArgs(query, args); err != nil {
+		return
+	}
+
 	// rebuild args to named args
 	sq = &types.Query{
 		Pattern: query,
@@ -0,0 +1,233 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// PublishDataset publishes a read-only dataset version of the database. The leader miner
+// exports and pins a snapshot of the database, and the content hash of the snapshot is recorded
+// on chain by a PublishDataset transaction, so that third parties fetching the dataset from the
+// miners can verify they received exactly the version published by the owner. Only the database
+// owner is allowed to publish.
+func PublishDataset(ctx context.Context, dsn string) (txHash hash.Hash, info *types.SnapshotInfo, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var (
+		cfg     *Config
+		pubKey  *asymmetric.PublicKey
+		privKey *asymmetric.PrivateKey
+		addr    proto.AccountAddress
+		nonce   interfaces.AccountNonce
+		peers   *proto.Peers
+	)
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	if pubKey, err = kms.GetLocalPublicKey(); err != nil {
+		return
+	}
+	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(pubKey); err != nil {
+		return
+	}
+	dbID := proto.DatabaseID(cfg.DatabaseID)
+	if peers, err = cacheGetPeers(dbID, privKey); err != nil {
+		return
+	}
+
+	// pin the dataset snapshot on the leader miner
+	req := &types.PrepareDatasetReq{
+		Header: types.SignedPrepareDatasetHeader{
+			PrepareDatasetHeader: types.PrepareDatasetHeader{
+				DatabaseID: dbID,
+				Timestamp:  getLocalTime(),
+			},
+		},
+	}
+	if err = req.Header.Sign(privKey); err != nil {
+		return
+	}
+	resp := &types.PrepareDatasetResp{}
+	if err = mux.NewCaller().CallNodeWithContext(
+		ctx, peers.Leader, route.DBSPrepareDataset.String(), req, resp,
+	); err != nil {
+		err = errors.Wrapf(err, "prepare dataset on miner %s failed", peers.Leader)
+		return
+	}
+	info = &resp.Info
+
+	// record the content hash on chain
+	if nonce, err = nonces.allocate(addr); err != nil {
+		return
+	}
+	pd := types.NewPublishDataset(&types.PublishDatasetHeader{
+		DatabaseID:  dbID,
+		ContentHash: info.ID,
+		Size:        info.Size,
+		BlockHash:   info.BlockHash,
+		Height:      info.Height,
+		Nonce:       nonce,
+	})
+	if err = pd.Sign(privKey); err != nil {
+		nonces.release(addr, nonce)
+		log.WithError(err).Warning("sign failed")
+		return
+	}
+	addTxReq := new(types.AddTxReq)
+	addTxResp := new(types.AddTxResp)
+	addTxReq.Tx = pd
+	if err = requestBP(route.MCCAddTx, addTxReq, addTxResp); err != nil {
+		nonces.release(addr, nonce)
+		log.WithError(err).Warning("send tx failed")
+		return
+	}
+
+	txHash = pd.Hash()
+	nonces.commit(addr, txHash)
+	return
+}
+
+// QueryDataset returns the dataset versions published on chain for the database.
+func QueryDataset(dbID proto.DatabaseID) (profile *types.DatasetProfile, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var (
+		req  = &types.QueryDatasetReq{DatabaseID: dbID}
+		resp = &types.QueryDatasetResp{}
+	)
+	if err = requestBP(route.MCCQueryDataset, req, resp); err != nil {
+		err = errors.WithMessage(err, "query dataset failed")
+		return
+	}
+	profile = &resp.Profile
+	return
+}
+
+// FetchDataset downloads the published dataset version of the database from its miners to
+// filename, the latest version is fetched if version is 0. The downloaded file is verified
+// against the content hash recorded on chain, which is a plain SQLite database file.
+func FetchDataset(
+	ctx context.Context, dbID proto.DatabaseID, version uint32, filename string,
+) (dv *types.DatasetVersion, err error) {
+	var profile *types.DatasetProfile
+	if profile, err = QueryDataset(dbID); err != nil {
+		return
+	}
+	if dv = profile.Get(version); dv == nil {
+		err = errors.Wrapf(ErrDatasetNotFound, "version %d of database %s", version, dbID)
+		return
+	}
+
+	var (
+		req  = &types.QuerySQLChainProfileReq{DBID: dbID}
+		resp = &types.QuerySQLChainProfileResp{}
+	)
+	if err = requestBP(route.MCCQuerySQLChainProfile, req, resp); err != nil {
+		err = errors.WithMessage(err, "query sqlchain profile failed")
+		return
+	}
+	// the published datasets are replicated to all the miners lazily, try all of them
+	for _, m := range resp.Profile.Miners {
+		if err = fetchDatasetFrom(ctx, m.NodeID, dbID, dv, filename); err == nil {
+			return
+		}
+		log.WithFields(log.Fields{
+			"db":   dbID,
+			"node": m.NodeID,
+		}).WithError(err).Debug("fetch dataset from miner failed")
+	}
+	if err == nil {
+		err = errors.Wrapf(ErrDatasetNotFound, "no miner serves database %s", dbID)
+	}
+	return
+}
+
+func fetchDatasetFrom(
+	ctx context.Context, node proto.NodeID, dbID proto.DatabaseID, dv *types.DatasetVersion, filename string,
+) (err error) {
+	var (
+		caller = mux.NewCaller()
+		req    = &types.FetchDatasetChunkReq{
+			DatabaseID:  dbID,
+			ContentHash: dv.ContentHash,
+		}
+		tmpFile = filename + ".part"
+		f       *os.File
+	)
+	if f, err = os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+		if err != nil {
+			_ = os.Remove(tmpFile)
+		}
+	}()
+	for req.Offset < dv.Size {
+		resp := &types.FetchDatasetChunkResp{}
+		if err = caller.CallNodeWithContext(
+			ctx, node, route.DBSFetchDatasetChunk.String(), req, resp,
+		); err != nil {
+			return
+		}
+		if len(resp.Data) == 0 {
+			err = errors.Errorf("unexpected end of dataset at offset %d", req.Offset)
+			return
+		}
+		if _, err = f.WriteAt(resp.Data, int64(req.Offset)); err != nil {
+			return
+		}
+		req.Offset += uint64(len(resp.Data))
+	}
+
+	var data []byte
+	if data, err = ioutil.ReadFile(tmpFile); err != nil {
+		return
+	}
+	if actual := hash.THashH(data); !actual.IsEqual(&dv.ContentHash) {
+		err = errors.Wrapf(ErrDatasetHashMismatch, "expected %s, actual %s",
+			dv.ContentHash.String(), actual.String())
+		return
+	}
+	return os.Rename(tmpFile, filename)
+}
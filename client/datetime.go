@@ -0,0 +1,127 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"strings"
+	"time"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+const (
+	// TimeFormatText sends the time.Time parameters as UTC text in the sqlite timestamp format.
+	TimeFormatText = "text"
+	// TimeFormatUnix sends the time.Time parameters as unix timestamps in seconds.
+	TimeFormatUnix = "unix"
+	// TimeFormatUnixMilli sends the time.Time parameters as unix timestamps in milliseconds.
+	TimeFormatUnixMilli = "unixmilli"
+
+	// sqliteTimestampFormat is the text format which keeps the nanoseconds and the offset, it is
+	// parsed back to the same instant by the miners.
+	sqliteTimestampFormat = "2006-01-02 15:04:05.999999999-07:00"
+)
+
+// sqliteTimestampFormats are the text formats parsed as datetimes, same as the storage driver.
+var sqliteTimestampFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// timeOptions defines the datetime handling of a connection.
+type timeOptions struct {
+	// loc is the location of the returned time.Time values, they are returned as decoded if nil.
+	loc *time.Location
+	// format is the representation of the time.Time parameters.
+	format string
+	// parseTime parses the datetime text values of the columns without declared types.
+	parseTime bool
+}
+
+func isValidTimeFormat(format string) bool {
+	switch format {
+	case "", TimeFormatText, TimeFormatUnix, TimeFormatUnixMilli:
+		return true
+	default:
+		return false
+	}
+}
+
+// encodeArgs converts the time.Time parameters to the configured representation, the time is
+// converted to UTC first so that the stored text values compare in time order. The time.Time
+// parameters are never sent as is, they are text in sqliteTimestampFormat by default.
+func (o *timeOptions) encodeArgs(args []types.NamedArg) {
+	for i := range args {
+		t, ok := args[i].Value.(time.Time)
+		if !ok {
+			continue
+		}
+		t = t.UTC()
+		switch o.format {
+		case TimeFormatUnix:
+			args[i].Value = t.Unix()
+		case TimeFormatUnixMilli:
+			args[i].Value = t.UnixNano() / int64(time.Millisecond)
+		default:
+			args[i].Value = t.Format(sqliteTimestampFormat)
+		}
+	}
+}
+
+// decodeValue converts the datetime value of the column to the configured location.
+func (o *timeOptions) decodeValue(v interface{}, declType string) interface{} {
+	switch d := v.(type) {
+	case time.Time:
+		if o.loc != nil {
+			return d.In(o.loc)
+		}
+	case string:
+		if o.parseTime && declType == "" {
+			if t, ok := parseTimeText(d); ok {
+				if o.loc != nil {
+					return t.In(o.loc)
+				}
+				return t
+			}
+		}
+	}
+	return v
+}
+
+// parseTimeText parses the text in the sqlite timestamp formats, the text without offset is
+// considered in UTC.
+func parseTimeText(s string) (t time.Time, ok bool) {
+	// the shortest format is a date
+	if len(s) < len("2006-01-02") {
+		return
+	}
+	s = strings.TrimSuffix(s, "Z")
+	for _, format := range sqliteTimestampFormats {
+		var err error
+		if t, err = time.ParseInLocation(format, s, time.UTC); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestTimeOptions(t *testing.T) {
+	Convey("test datetime handling of the driver", t, func() {
+		var (
+			loc = time.FixedZone("UTC+8", 8*3600)
+			ts  = time.Date(2019, 5, 15, 16, 11, 40, 123456789, loc)
+		)
+
+		Convey("The time.Time parameters should be converted to UTC", func() {
+			var args = func() []types.NamedArg {
+				return []types.NamedArg{{Value: ts}, {Value: "2019-05-15"}, {Value: int64(1)}}
+			}
+			var cases = []struct {
+				format string
+				expect interface{}
+			}{
+				{"", "2019-05-15 08:11:40.123456789+00:00"},
+				{TimeFormatText, "2019-05-15 08:11:40.123456789+00:00"},
+				{TimeFormatUnix, ts.Unix()},
+				{TimeFormatUnixMilli, ts.Unix()*1000 + 123},
+			}
+			for _, c := range cases {
+				So(isValidTimeFormat(c.format), ShouldBeTrue)
+				var (
+					o = &timeOptions{format: c.format}
+					a = args()
+				)
+				o.encodeArgs(a)
+				So(a[0].Value, ShouldEqual, c.expect)
+				So(a[1].Value, ShouldEqual, "2019-05-15")
+				So(a[2].Value, ShouldEqual, int64(1))
+			}
+			So(isValidTimeFormat("rfc3339"), ShouldBeFalse)
+
+			// the text parameter is parsed back to the same instant
+			var (
+				o = &timeOptions{}
+				a = []types.NamedArg{{Value: ts}}
+			)
+			o.encodeArgs(a)
+			parsed, ok := parseTimeText(a[0].Value.(string))
+			So(ok, ShouldBeTrue)
+			So(parsed.Equal(ts), ShouldBeTrue)
+		})
+
+		Convey("The datetime text should be parsed in the sqlite formats", func() {
+			var cases = []struct {
+				text   string
+				ok     bool
+				expect time.Time
+			}{
+				{"2019-05-15 08:11:40.123456789+00:00", true, ts},
+				{"2019-05-15T16:11:40.123456789+08:00", true, ts},
+				{"2019-05-15T08:11:40.123456789Z", true, ts},
+				{"2019-05-15 08:11:40", true, time.Date(2019, 5, 15, 8, 11, 40, 0, time.UTC)},
+				{"2019-05-15 08:11", true, time.Date(2019, 5, 15, 8, 11, 0, 0, time.UTC)},
+				{"2019-05-15", true, time.Date(2019, 5, 15, 0, 0, 0, 0, time.UTC)},
+				{"2019-05", false, time.Time{}},
+				{"not a datetime", false, time.Time{}},
+				{"2019-13-45", false, time.Time{}},
+			}
+			for _, c := range cases {
+				parsed, ok := parseTimeText(c.text)
+				So(ok, ShouldEqual, c.ok)
+				So(parsed.Equal(c.expect), ShouldBeTrue)
+			}
+		})
+
+		Convey("The datetime values should be decoded in the location", func() {
+			var plain = &timeOptions{}
+			So(plain.decodeValue(ts, "TIMESTAMP"), ShouldEqual, ts)
+			So(plain.decodeValue("2019-05-15", ""), ShouldEqual, "2019-05-15")
+			So(plain.decodeValue(int64(1), ""), ShouldEqual, int64(1))
+
+			var o = &timeOptions{loc: loc, parseTime: true}
+			decoded := o.decodeValue(ts.UTC(), "TIMESTAMP").(time.Time)
+			So(decoded.Location(), ShouldEqual, loc)
+			So(decoded.Equal(ts), ShouldBeTrue)
+
+			// only the text of the columns without declared types is parsed
+			decoded = o.decodeValue("2019-05-15 08:11:40.123456789+00:00", "").(time.Time)
+			So(decoded.Location(), ShouldEqual, loc)
+			So(decoded.Equal(ts), ShouldBeTrue)
+			So(o.decodeValue("2019-05-15", "TEXT"), ShouldEqual, "2019-05-15")
+			So(o.decodeValue("hello", ""), ShouldEqual, "hello")
+		})
+	})
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"database/sql/driver"
+	"math/big"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/utils"
+)
+
+// Decimal is an exact decimal number backed by math/big, it is stored as canonical text by the
+// miners, see the decimal functions of the storage. The values of shopspring/decimal are also
+// accepted as parameters and scanned from the canonical text.
+type Decimal struct {
+	r big.Rat
+}
+
+// NewDecimal parses the decimal number in plain or exponent notation.
+func NewDecimal(s string) (d *Decimal, err error) {
+	var r *big.Rat
+	if r, err = utils.ParseDecimal(s); err != nil {
+		return
+	}
+	d = &Decimal{}
+	d.r.Set(r)
+	return
+}
+
+// NewDecimalFromRat returns the decimal of the rational number.
+func NewDecimalFromRat(r *big.Rat) *Decimal {
+	d := &Decimal{}
+	d.r.Set(r)
+	return d
+}
+
+// Rat returns a copy of the decimal as a rational number.
+func (d *Decimal) Rat() *big.Rat {
+	return new(big.Rat).Set(&d.r)
+}
+
+// String implements fmt.Stringer, it returns the canonical text of the decimal.
+func (d *Decimal) String() string {
+	s, err := utils.FormatDecimal(&d.r)
+	if err != nil {
+		// non-terminating decimals constructed from rational numbers
+		return d.r.RatString()
+	}
+	return s
+}
+
+// Scan implements sql.Scanner.
+func (d *Decimal) Scan(src interface{}) (err error) {
+	var r *big.Rat
+	if r, err = utils.DecimalFromValue(src); err != nil {
+		return errors.Wrapf(err, "scan %T to decimal", src)
+	}
+	d.r.Set(r)
+	return
+}
+
+// Value implements driver.Valuer.
+func (d *Decimal) Value() (v driver.Value, err error) {
+	return utils.FormatDecimal(&d.r)
+}
+
+// CheckNamedValue implements driver.NamedValueChecker, the math/big numbers are sent as canonical
+// decimal text and other values are left to the default conversion.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) (err error) {
+	switch v := nv.Value.(type) {
+	case *big.Int:
+		nv.Value = v.String()
+	case *big.Rat:
+		if nv.Value, err = utils.FormatDecimal(v); err != nil {
+			err = errors.Wrapf(err, "argument %s", v.RatString())
+		}
+	case *big.Float:
+		if v.IsInf() {
+			return errors.Wrap(utils.ErrInvalidDecimal, "infinite argument")
+		}
+		// the shortest text which converts back to the same float
+		nv.Value = v.Text('f', -1)
+	default:
+		return driver.ErrSkip
+	}
+	return
+}
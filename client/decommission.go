@@ -0,0 +1,80 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"sync/atomic"
+
+	"github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// DecommissionMiner sends a DecommissionMiner transaction to chain, which must be signed by the
+// miner account. The miner announces its departure first, it is not matched for new databases
+// any more and a replacement miner restores a replica of each database it serves. The miner
+// keeps serving until it finalizes the departure with finalize set, which is accepted after the
+// billing of its databases is updated, the miner leaves the databases and the deposits are
+// returned then.
+func DecommissionMiner(finalize bool) (txHash hash.Hash, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var (
+		signer asymmetric.Signer
+		addr   proto.AccountAddress
+		nonce  interfaces.AccountNonce
+	)
+	if signer, err = getTxSigner(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(signer.PubKey()); err != nil {
+		return
+	}
+	if nonce, err = nonces.allocate(addr); err != nil {
+		return
+	}
+
+	tx := types.NewDecommissionMiner(&types.DecommissionMinerHeader{
+		Finalize: finalize,
+		Nonce:    nonce,
+	})
+	if err = signTx(signer, tx); err != nil {
+		nonces.release(addr, nonce)
+		log.WithError(err).Warning("sign failed")
+		return
+	}
+	var (
+		req  = &types.AddTxReq{Tx: tx}
+		resp = new(types.AddTxResp)
+	)
+	if err = requestBP(route.MCCAddTx, req, resp); err != nil {
+		nonces.release(addr, nonce)
+		log.WithError(err).Warning("send tx failed")
+		return
+	}
+
+	txHash = tx.Hash()
+	nonces.commit(addr, txHash)
+	return
+}
@@ -99,6 +99,33 @@ func (d *covenantSQLDriver) Open(dsn string) (conn driver.Conn, err error) {
 	return newConn(cfg)
 }
 
+// connector implements the driver.Connector interface with a parsed config.
+type connector struct {
+	cfg *Config
+}
+
+// NewConnector returns a driver.Connector of the config to be used with sql.OpenDB, which
+// allows the config fields not encoded in DSN such as PrivateKey.
+func NewConnector(cfg *Config) driver.Connector {
+	return &connector{cfg: cfg}
+}
+
+// Connect implements driver.Connector.Connect.
+func (c *connector) Connect(ctx context.Context) (conn driver.Conn, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = defaultInit()
+		if err != nil && err != ErrAlreadyInitialized {
+			return
+		}
+	}
+	return newConn(c.cfg)
+}
+
+// Driver implements driver.Connector.Driver.
+func (c *connector) Driver() driver.Driver {
+	return &covenantSQLDriver{}
+}
+
 // ResourceMeta defines new database resources requirement descriptions.
 type ResourceMeta struct {
 	// copied fields from types.ResourceMeta
@@ -111,6 +138,14 @@ type ResourceMeta struct {
 	UseEventualConsistency bool                   `json:"eventual-consistency,omitempty"` // use eventual consistency replication if enabled
 	ConsistencyLevel       float64                `json:"consistency-level,omitempty"`    // customized strong consistency level
 	IsolationLevel         int                    `json:"isolation-level,omitempty"`      // customized isolation level
+	StatementTimeout       time.Duration          `json:"statement-timeout,omitempty"`    // default statement timeout
+	ForeignKeys            bool                   `json:"foreign-keys,omitempty"`         // enforce foreign key constraints
+	ConsistencyPreset      string                 `json:"consistency-preset,omitempty"`   // named consistency preset: strong, session or eventual
+	LeaderReadsOnly        bool                   `json:"leader-reads-only,omitempty"`    // serve read queries on leader only
+	MaxReadStaleness       time.Duration          `json:"max-read-staleness,omitempty"`   // max head lag of followers serving reads
+	WriteAck               types.WriteAck         `json:"write-ack,omitempty"`            // replica acknowledgements required by writes
+	StandbyNode            proto.NodeID           `json:"standby-node,omitempty"`         // standby miner receiving shipped snapshots
+	SnapshotShipInterval   time.Duration          `json:"ship-interval,omitempty"`        // interval of snapshot shipping
 
 	GasPrice       uint64 `json:"gas-price"`       // customized gas price
 	AdvancePayment uint64 `json:"advance-payment"` // customized advance payment
@@ -141,9 +176,13 @@ func Init(configFile string, masterKey []byte) (err error) {
 	}
 
 	route.InitKMS(conf.GConf.PubKeyStoreFile)
+	if len(masterKey) == 0 {
+		masterKey = []byte(conf.GConf.MasterKey.Value())
+	}
 	if err = kms.InitLocalKeyPair(conf.GConf.PrivateKeyFile, masterKey); err != nil {
 		return
 	}
+	setKeyMasterKey(masterKey)
 
 	// ping block producer to register node
 	if err = registerNode(); err != nil {
@@ -164,41 +203,75 @@ func Create(meta ResourceMeta) (txHash hash.Hash, dsn string, err error) {
 		err = ErrNotInitialized
 		return
 	}
+	if IsLiteMode() {
+		dsn, err = createLite()
+		return
+	}
+	if meta.ConsistencyPreset != "" {
+		if _, err = types.ConsistencyPreset(meta.ConsistencyPreset).Settings(); err != nil {
+			return
+		}
+	}
 
 	var (
-		nonceReq   = new(types.NextAccountNonceReq)
-		nonceResp  = new(types.NextAccountNonceResp)
 		req        = new(types.AddTxReq)
 		resp       = new(types.AddTxResp)
-		privateKey *asymmetric.PrivateKey
+		signer     asymmetric.Signer
 		clientAddr proto.AccountAddress
+		nonce      interfaces.AccountNonce
 	)
-	if privateKey, err = kms.GetLocalPrivateKey(); err != nil {
-		err = errors.Wrap(err, "get local private key failed")
+	if signer, err = getTxSigner(); err != nil {
+		err = errors.Wrap(err, "get transaction signer failed")
 		return
 	}
-	if clientAddr, err = crypto.PubKeyHash(privateKey.PubKey()); err != nil {
+	if clientAddr, err = crypto.PubKeyHash(signer.PubKey()); err != nil {
 		err = errors.Wrap(err, "get local account address failed")
 		return
 	}
 	// allocate nonce
-	nonceReq.Addr = clientAddr
-
-	if err = requestBP(route.MCCNextAccountNonce, nonceReq, nonceResp); err != nil {
+	if nonce, err = nonces.allocate(clientAddr); err != nil {
 		err = errors.Wrap(err, "allocate create database transaction nonce failed")
 		return
 	}
 
+	req.TTL = 1
+	tx := types.NewCreateDatabase(newCreateDatabaseHeader(clientAddr, meta, nonce))
+
+	if err = signTx(signer, tx); err != nil {
+		nonces.release(clientAddr, nonce)
+		err = errors.Wrap(err, "sign request failed")
+		return
+	}
+	req.Tx = tx
+
+	if err = requestBP(route.MCCAddTx, req, resp); err != nil {
+		nonces.release(clientAddr, nonce)
+		err = errors.Wrap(err, "call create database transaction failed")
+		return
+	}
+
+	txHash = req.Tx.Hash()
+	nonces.commit(clientAddr, txHash)
+	cfg := NewConfig()
+	cfg.DatabaseID = string(proto.FromAccountAndNonce(clientAddr, uint32(nonce)))
+	dsn = cfg.FormatDSN()
+
+	return
+}
+
+// newCreateDatabaseHeader builds the create database transaction header of the resource meta,
+// the default gas price and advance payment are used if not set.
+func newCreateDatabaseHeader(
+	owner proto.AccountAddress, meta ResourceMeta, nonce interfaces.AccountNonce,
+) *types.CreateDatabaseHeader {
 	if meta.GasPrice == 0 {
 		meta.GasPrice = DefaultGasPrice
 	}
 	if meta.AdvancePayment == 0 {
 		meta.AdvancePayment = DefaultAdvancePayment
 	}
-
-	req.TTL = 1
-	req.Tx = types.NewCreateDatabase(&types.CreateDatabaseHeader{
-		Owner: clientAddr,
+	return &types.CreateDatabaseHeader{
+		Owner: owner,
 		ResourceMeta: types.ResourceMeta{
 			TargetMiners:           meta.TargetMiners,
 			Node:                   meta.Node,
@@ -209,28 +282,53 @@ func Create(meta ResourceMeta) (txHash hash.Hash, dsn string, err error) {
 			UseEventualConsistency: meta.UseEventualConsistency,
 			ConsistencyLevel:       meta.ConsistencyLevel,
 			IsolationLevel:         meta.IsolationLevel,
+			StatementTimeout:       meta.StatementTimeout,
+			ForeignKeys:            meta.ForeignKeys,
+			ConsistencyPreset:      meta.ConsistencyPreset,
+			LeaderReadsOnly:        meta.LeaderReadsOnly,
+			MaxReadStaleness:       meta.MaxReadStaleness,
+			WriteAck:               meta.WriteAck,
+			StandbyNode:            meta.StandbyNode,
+			SnapshotShipInterval:   meta.SnapshotShipInterval,
 		},
 		GasPrice:       meta.GasPrice,
 		AdvancePayment: meta.AdvancePayment,
 		TokenType:      types.Particle,
-		Nonce:          nonceResp.Nonce,
-	})
+		Nonce:          nonce,
+	}
+}
 
-	if err = req.Tx.Sign(privateKey); err != nil {
-		err = errors.Wrap(err, "sign request failed")
+// PreviewCreate asks the block producer which miners would be matched for the database
+// creation and whether it would succeed, without sending the transaction.
+func PreviewCreate(meta ResourceMeta) (resp *types.PreviewCreateDatabaseResp, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
 		return
 	}
-
-	if err = requestBP(route.MCCAddTx, req, resp); err != nil {
-		err = errors.Wrap(err, "call create database transaction failed")
+	if IsLiteMode() {
+		err = ErrNotSupportedInLiteMode
 		return
 	}
 
-	txHash = req.Tx.Hash()
-	cfg := NewConfig()
-	cfg.DatabaseID = string(proto.FromAccountAndNonce(clientAddr, uint32(nonceResp.Nonce)))
-	dsn = cfg.FormatDSN()
-
+	var (
+		signer asymmetric.Signer
+		owner  proto.AccountAddress
+		req    = new(types.PreviewCreateDatabaseReq)
+	)
+	if signer, err = getTxSigner(); err != nil {
+		err = errors.Wrap(err, "get transaction signer failed")
+		return
+	}
+	if owner, err = crypto.PubKeyHash(signer.PubKey()); err != nil {
+		err = errors.Wrap(err, "get local account address failed")
+		return
+	}
+	req.Header = *newCreateDatabaseHeader(owner, meta, 0)
+	resp = new(types.PreviewCreateDatabaseResp)
+	if err = requestBP(route.MCCPreviewCreateDatabase, req, resp); err != nil {
+		resp = nil
+		err = errors.Wrap(err, "call preview create database failed")
+	}
 	return
 }
 
@@ -240,6 +338,10 @@ func WaitDBCreation(ctx context.Context, dsn string) (err error) {
 	if err != nil {
 		return
 	}
+	if IsLiteMode() {
+		// lite databases are created synchronously
+		return
+	}
 
 	db, err := sql.Open("cqlprotocol", dsn)
 	defer db.Close()
@@ -314,6 +416,11 @@ func Drop(dsn string) (txHash hash.Hash, err error) {
 
 	peerList.Delete(cfg.DatabaseID)
 
+	if IsLiteMode() {
+		err = dropLite(proto.DatabaseID(cfg.DatabaseID))
+		return
+	}
+
 	//TODO(laodouya) currently not supported
 	//err = errors.New("drop db current not support")
 
@@ -375,7 +482,7 @@ func UpdatePermission(targetUser proto.AccountAddress,
 		return
 	}
 
-	nonce, err = getNonce(addr)
+	nonce, err = nonces.allocate(addr)
 	if err != nil {
 		return
 	}
@@ -388,6 +495,7 @@ func UpdatePermission(targetUser proto.AccountAddress,
 	})
 	err = up.Sign(privKey)
 	if err != nil {
+		nonces.release(addr, nonce)
 		log.WithError(err).Warning("sign failed")
 		return
 	}
@@ -396,11 +504,13 @@ func UpdatePermission(targetUser proto.AccountAddress,
 	addTxReq.Tx = up
 	err = requestBP(route.MCCAddTx, addTxReq, addTxResp)
 	if err != nil {
+		nonces.release(addr, nonce)
 		log.WithError(err).Warning("send tx failed")
 		return
 	}
 
 	txHash = up.Hash()
+	nonces.commit(addr, txHash)
 	return
 }
 
@@ -414,22 +524,18 @@ func TransferToken(targetUser proto.AccountAddress, amount uint64, tokenType typ
 	}
 
 	var (
-		pubKey  *asymmetric.PublicKey
-		privKey *asymmetric.PrivateKey
-		addr    proto.AccountAddress
-		nonce   interfaces.AccountNonce
+		signer asymmetric.Signer
+		addr   proto.AccountAddress
+		nonce  interfaces.AccountNonce
 	)
-	if pubKey, err = kms.GetLocalPublicKey(); err != nil {
+	if signer, err = getTxSigner(); err != nil {
 		return
 	}
-	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
-		return
-	}
-	if addr, err = crypto.PubKeyHash(pubKey); err != nil {
+	if addr, err = crypto.PubKeyHash(signer.PubKey()); err != nil {
 		return
 	}
 
-	nonce, err = getNonce(addr)
+	nonce, err = nonces.allocate(addr)
 	if err != nil {
 		return
 	}
@@ -441,8 +547,63 @@ func TransferToken(targetUser proto.AccountAddress, amount uint64, tokenType typ
 		TokenType: tokenType,
 		Nonce:     nonce,
 	})
-	err = tran.Sign(privKey)
+	err = signTx(signer, tran)
+	if err != nil {
+		nonces.release(addr, nonce)
+		log.WithError(err).Warning("sign failed")
+		return
+	}
+	addTxReq := new(types.AddTxReq)
+	addTxResp := new(types.AddTxResp)
+	addTxReq.Tx = tran
+	err = requestBP(route.MCCAddTx, addTxReq, addTxResp)
+	if err != nil {
+		nonces.release(addr, nonce)
+		log.WithError(err).Warning("send tx failed")
+		return
+	}
+
+	txHash = tran.Hash()
+	nonces.commit(addr, txHash)
+	return
+}
+
+// TransferTokenBatch send TransferBatch transaction to chain, the tokens are transferred to all
+// the receivers under a single nonce.
+func TransferTokenBatch(receivers []types.TransferReceiver, tokenType types.TokenType) (
+	txHash hash.Hash, err error,
+) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var (
+		signer asymmetric.Signer
+		addr   proto.AccountAddress
+		nonce  interfaces.AccountNonce
+	)
+	if signer, err = getTxSigner(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(signer.PubKey()); err != nil {
+		return
+	}
+
+	nonce, err = nonces.allocate(addr)
+	if err != nil {
+		return
+	}
+
+	tran := types.NewTransferBatch(&types.TransferBatchHeader{
+		Sender:    addr,
+		Receivers: receivers,
+		TokenType: tokenType,
+		Nonce:     nonce,
+	})
+	err = signTx(signer, tran)
 	if err != nil {
+		nonces.release(addr, nonce)
 		log.WithError(err).Warning("sign failed")
 		return
 	}
@@ -451,11 +612,13 @@ func TransferToken(targetUser proto.AccountAddress, amount uint64, tokenType typ
 	addTxReq.Tx = tran
 	err = requestBP(route.MCCAddTx, addTxReq, addTxResp)
 	if err != nil {
+		nonces.release(addr, nonce)
 		log.WithError(err).Warning("send tx failed")
 		return
 	}
 
 	txHash = tran.Hash()
+	nonces.commit(addr, txHash)
 	return
 }
 
@@ -494,6 +657,7 @@ func WaitTxConfirmation(
 		case interfaces.TransactionStateConfirmed,
 			interfaces.TransactionStateExpired,
 			interfaces.TransactionStateNotFound:
+			nonces.settle(txHash, state)
 			return
 		default:
 			err = errors.Errorf("unknown transaction state %d", state)
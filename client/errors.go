@@ -30,6 +30,77 @@ var (
 	ErrInvalidRequestSeq = errors.New("invalid request sequence applied")
 	// ErrInvalidProfile indicates the SQLChain profile is invalid.
 	ErrInvalidProfile = errors.New("invalid sqlchain profile")
+	// ErrNotSupportedInLiteMode indicates the operation requires a real network.
+	ErrNotSupportedInLiteMode = errors.New("operation not supported in lite mode")
+	// ErrLiteDatabaseDropped indicates the lite database is dropped while the connection is open.
+	ErrLiteDatabaseDropped = errors.New("lite database dropped")
+	// ErrInvalidRequest indicates the request payload is invalid.
+	ErrInvalidRequest = errors.New("invalid request")
+	// ErrNotReadOnlyQuery indicates a non read-only query is presented to a federation.
+	ErrNotReadOnlyQuery = errors.New("only read-only query is supported across databases")
+	// ErrUnknownDatabaseAlias indicates a table is qualified by an unknown database alias.
+	ErrUnknownDatabaseAlias = errors.New("unknown database alias")
 	// ErrNoSuchTokenBalance indicates no such token balance in chain.
 	ErrNoSuchTokenBalance = errors.New("no such token balance")
+	// ErrUnknownTenant indicates the tenant is not registered in the tenant pool.
+	ErrUnknownTenant = errors.New("unknown tenant")
+	// ErrTenantExists indicates the tenant is already registered in the tenant pool.
+	ErrTenantExists = errors.New("tenant already exists")
+	// ErrTenantRateLimited indicates the query rate of the tenant exceeds its limit.
+	ErrTenantRateLimited = errors.New("tenant query rate limit exceeded")
+	// ErrOfflineSignNotSupported indicates the transaction type can not be signed offline.
+	ErrOfflineSignNotSupported = errors.New("transaction type not supported by offline signing")
+	// ErrInvalidOfflineTx indicates the offline transaction is malformed or tampered.
+	ErrInvalidOfflineTx = errors.New("invalid offline transaction")
+	// ErrTxRejected indicates the transaction is not accepted by the block producers.
+	ErrTxRejected = errors.New("transaction rejected")
+	// ErrTxExpired indicates the transaction is expired before being packed.
+	ErrTxExpired = errors.New("transaction expired")
+	// ErrTxReorged indicates the packed transaction is dropped by a chain reorganization.
+	ErrTxReorged = errors.New("transaction reorged")
+	// ErrInvalidTimeFormat indicates the time format of the time.Time parameters is unknown.
+	ErrInvalidTimeFormat = errors.New("invalid time format")
+	// ErrDatasetNotFound indicates the dataset version is not published on chain.
+	ErrDatasetNotFound = errors.New("dataset not found")
+	// ErrDatasetHashMismatch indicates the received dataset does not match the content hash on chain.
+	ErrDatasetHashMismatch = errors.New("dataset content hash mismatch")
+	// ErrInvalidReceipt indicates the write receipt can not be verified against the sqlchain.
+	ErrInvalidReceipt = errors.New("invalid receipt")
+	// ErrInvalidAuditProof indicates the query proof can not be verified against the sqlchain.
+	ErrInvalidAuditProof = errors.New("invalid audit proof")
+	// ErrNoObserver indicates an observer read is requested without an observer configured.
+	ErrNoObserver = errors.New("no observer configured")
+	// ErrObserverStale indicates the observer replica lags behind more than the read accepts.
+	ErrObserverStale = errors.New("observer replica too stale")
+	// ErrObserverPermissionDenied indicates the observer refuses the read of the signee.
+	ErrObserverPermissionDenied = errors.New("observer read permission denied")
+	// ErrUnknownKeyAlias indicates the named private key is neither configured nor added.
+	ErrUnknownKeyAlias = errors.New("unknown key alias")
+	// ErrUnboundParameter indicates a placeholder of the query has no argument to bind.
+	ErrUnboundParameter = errors.New("unbound query parameter")
+	// ErrPeerUnhealthy indicates the miner connected fails the health checks.
+	ErrPeerUnhealthy = errors.New("peer failed health checks")
+	// ErrInvalidBulkRow indicates a bulk insert row does not match the columns.
+	ErrInvalidBulkRow = errors.New("bulk insert row does not match columns")
+	// ErrAsyncQueryRunning indicates the asynchronous query is not finished yet.
+	ErrAsyncQueryRunning = errors.New("async query is still running")
+	// ErrAsyncQueryCanceled indicates the asynchronous query is canceled.
+	ErrAsyncQueryCanceled = errors.New("async query canceled")
+	// ErrAsyncQueryFailed indicates the asynchronous query is finished with an error on the miner.
+	ErrAsyncQueryFailed = errors.New("async query failed")
+	// ErrReceiverNotAllowed indicates the transfer receiver is not in the allowlist of the spending
+	// policy.
+	ErrReceiverNotAllowed = errors.New("receiver not allowed by spending policy")
+	// ErrDailySpendExceeded indicates the transaction exceeds the daily limit of the spending
+	// policy.
+	ErrDailySpendExceeded = errors.New("daily spending limit exceeded")
+	// ErrSpendApprovalRequired indicates the transaction requires a second approval but no
+	// approver is set.
+	ErrSpendApprovalRequired = errors.New("spending approval required")
+	// ErrSpendNotApproved indicates the transaction is rejected by the approver.
+	ErrSpendNotApproved = errors.New("spending not approved")
+	// ErrTxSignerRequired indicates the signer only signs whole transactions with SignTx.
+	ErrTxSignerRequired = errors.New("signer only signs whole transactions")
+	// ErrRemoteSignRejected indicates the remote policy signer refused to sign the transaction.
+	ErrRemoteSignRejected = errors.New("remote signer rejected the transaction")
 )
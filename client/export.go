@@ -0,0 +1,146 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+)
+
+// ExportInfo defines the chain head which an exported database file is based on.
+type ExportInfo struct {
+	NodeID    proto.NodeID
+	BlockHash hash.Hash
+	Height    int32
+	FileHash  hash.Hash
+	Size      uint64
+}
+
+// ExportDatabase exports the current state of the database to a plain SQLite file, which can
+// be opened by any SQLite tool. The file is downloaded in chunks to a temporary file and renamed
+// to the target after it's verified against the hash signed by the miner.
+func ExportDatabase(ctx context.Context, dsn string, filename string) (info *ExportInfo, err error) {
+	var (
+		s      *blobSession
+		f      *os.File
+		header *types.ExportHeader
+		offset uint64
+	)
+	if s, err = newBlobSession(dsn); err != nil {
+		return
+	}
+	defer s.close()
+	if f, err = ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.part"); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		req := &types.ExportDatabaseReq{
+			Header: types.SignedExportDatabaseHeader{
+				ExportDatabaseHeader: types.ExportDatabaseHeader{
+					DatabaseID: s.dbID,
+					Offset:     offset,
+				},
+			},
+		}
+		if header != nil {
+			req.Header.ExportID = header.FileHash
+		}
+		if err = req.Header.Sign(s.privKey); err != nil {
+			return
+		}
+		resp := &types.ExportDatabaseResp{}
+		if err = s.caller.Call(route.DBSExportDatabase.String(), req, resp); err != nil {
+			return
+		}
+		if err = resp.Header.Verify(); err != nil {
+			err = errors.WithMessage(err, "verify export header failed")
+			return
+		}
+		if resp.Header.DatabaseID != s.dbID {
+			err = errors.Errorf("unexpected database %s in export", resp.Header.DatabaseID)
+			return
+		}
+		if header == nil {
+			header = &resp.Header.ExportHeader
+		} else if resp.Header.ExportHeader != *header {
+			err = errors.Errorf("export %s changed during transfer", header.FileHash.String())
+			return
+		}
+		if _, err = f.Write(resp.Data); err != nil {
+			return
+		}
+		offset += uint64(len(resp.Data))
+		if offset >= header.Size || len(resp.Data) == 0 {
+			break
+		}
+	}
+	if offset != header.Size {
+		err = errors.Errorf("export size not match, expected %d, actual %d", header.Size, offset)
+		return
+	}
+
+	// verify the downloaded file
+	var actual hash.Hash
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	if actual, _, err = hash.THashReader(f); err != nil {
+		return
+	}
+	if !actual.IsEqual(&header.FileHash) {
+		err = errors.Errorf("export file hash not match, expected %s, actual %s",
+			header.FileHash.String(), actual.String())
+		return
+	}
+	if err = f.Chmod(0644); err != nil {
+		return
+	}
+	if err = f.Sync(); err != nil {
+		return
+	}
+	if err = os.Rename(f.Name(), filename); err != nil {
+		return
+	}
+	info = &ExportInfo{
+		NodeID:    header.NodeID,
+		BlockHash: header.BlockHash,
+		Height:    header.Height,
+		FileHash:  header.FileHash,
+		Size:      header.Size,
+	}
+	return
+}
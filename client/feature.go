@@ -0,0 +1,97 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/rpc"
+	"github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+)
+
+// FeatureStatus defines the readiness of a protocol feature on the miners of a database.
+type FeatureStatus struct {
+	Ready      bool
+	MinVersion string
+	Missing    []proto.NodeID
+}
+
+// CheckFeature checks whether all miners of the database are ready for the protocol feature,
+// owners should check it during rolling upgrades before enabling the feature in applications.
+func CheckFeature(ctx context.Context, dsn string, feature string) (status *FeatureStatus, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	var (
+		cfg     *Config
+		peers   *proto.Peers
+		privKey *asymmetric.PrivateKey
+		caller  rpc.PCaller
+	)
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	dbID := proto.DatabaseID(cfg.DatabaseID)
+	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	if peers, err = cacheGetPeers(dbID, privKey); err != nil {
+		err = errors.WithMessage(err, "cacheGetPeers failed")
+		return
+	}
+	if cfg.UseDirectRPC {
+		caller = rpc.NewPersistentCaller(peers.Leader)
+	} else {
+		caller = mux.NewPersistentCaller(peers.Leader)
+	}
+	defer caller.Close()
+
+	req := &types.CheckFeatureReq{
+		Header: types.SignedCheckFeatureHeader{
+			CheckFeatureHeader: types.CheckFeatureHeader{
+				DatabaseID: dbID,
+				Feature:    feature,
+			},
+		},
+	}
+	if err = req.Header.Sign(privKey); err != nil {
+		return
+	}
+	resp := &types.CheckFeatureResp{}
+	if err = caller.Call(route.DBSCheckFeature.String(), req, resp); err != nil {
+		return
+	}
+	status = &FeatureStatus{
+		Ready:      resp.Ready,
+		MinVersion: resp.MinVersion,
+		Missing:    resp.Missing,
+	}
+	return
+}
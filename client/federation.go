@@ -0,0 +1,234 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/SQLess/sqlparser"
+	"github.com/pkg/errors"
+)
+
+// Federation runs read-only queries joining tables across multiple databases the user has read
+// access to, e.g. per-tenant databases. Tables are qualified by the database alias in queries:
+//
+//	f, err := client.NewFederation(map[string]string{
+//		"east": "sqless://<db1>",
+//		"west": "sqless://<db2>",
+//	})
+//	rows, err := f.QueryContext(ctx, `SELECT e.id, w.total FROM east.users e
+//		JOIN west.orders w ON e.id = w.user_id`)
+//
+// The referenced tables are fetched from their databases and the query is executed locally on
+// an in-memory copy, so the tables should be reasonably small. The rows of a previous query
+// should be closed before running the next query.
+type Federation struct {
+	sync.Mutex
+	dbs      map[string]*sql.DB
+	local    *sql.DB
+	attached map[string]bool
+}
+
+// NewFederation opens the databases of the dsn list keyed by database alias.
+func NewFederation(dsns map[string]string) (f *Federation, err error) {
+	f = &Federation{
+		dbs:      make(map[string]*sql.DB),
+		attached: make(map[string]bool),
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			f = nil
+		}
+	}()
+	for alias, dsn := range dsns {
+		var db *sql.DB
+		if db, err = sql.Open(DBScheme, dsn); err != nil {
+			return
+		}
+		f.dbs[strings.ToLower(alias)] = db
+	}
+	if f.local, err = sql.Open("sqlite3", ":memory:"); err != nil {
+		return
+	}
+	// attached in-memory databases only live in the single local connection
+	f.local.SetMaxOpenConns(1)
+	f.local.SetMaxIdleConns(1)
+	return
+}
+
+// QueryContext executes the read-only query on the latest state of the referenced tables.
+func (f *Federation) QueryContext(ctx context.Context, query string, args ...interface{}) (
+	rows *sql.Rows, err error,
+) {
+	var tables map[string][]string
+	if tables, err = federatedTables(query); err != nil {
+		return
+	}
+
+	f.Lock()
+	defer f.Unlock()
+	for alias, names := range tables {
+		db, ok := f.dbs[alias]
+		if !ok {
+			err = errors.Wrapf(ErrUnknownDatabaseAlias, "alias: %s", alias)
+			return
+		}
+		if !f.attached[alias] {
+			if _, err = f.local.ExecContext(ctx, fmt.Sprintf(
+				`ATTACH DATABASE ':memory:' AS %s`, quoteIdent(alias))); err != nil {
+				return
+			}
+			f.attached[alias] = true
+		}
+		for _, name := range names {
+			if err = f.fetchTable(ctx, db, alias, name); err != nil {
+				err = errors.Wrapf(err, "fetch table %s.%s failed", alias, name)
+				return
+			}
+		}
+	}
+	return f.local.QueryContext(ctx, query, args...)
+}
+
+// Close closes all the databases of the federation.
+func (f *Federation) Close() (err error) {
+	for _, db := range f.dbs {
+		if ierr := db.Close(); ierr != nil && err == nil {
+			err = ierr
+		}
+	}
+	if f.local != nil {
+		if ierr := f.local.Close(); ierr != nil && err == nil {
+			err = ierr
+		}
+	}
+	return
+}
+
+// fetchTable copies the remote table to the attached local schema of the alias.
+func (f *Federation) fetchTable(ctx context.Context, db *sql.DB, alias, name string) (err error) {
+	var (
+		rows    *sql.Rows
+		types   []*sql.ColumnType
+		target  = quoteIdent(alias) + "." + quoteIdent(name)
+		columns []string
+		marks   []string
+		tx      *sql.Tx
+		stmt    *sql.Stmt
+	)
+	if rows, err = db.QueryContext(ctx, "SELECT * FROM "+quoteIdent(name)); err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	if types, err = rows.ColumnTypes(); err != nil {
+		return
+	}
+	for _, t := range types {
+		columns = append(columns, quoteIdent(t.Name())+" "+t.DatabaseTypeName())
+		marks = append(marks, "?")
+	}
+
+	if tx, err = f.local.BeginTx(ctx, nil); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if _, err = tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+target); err != nil {
+		return
+	}
+	if _, err = tx.ExecContext(ctx, fmt.Sprintf(
+		"CREATE TABLE %s (%s)", target, strings.Join(columns, ", "))); err != nil {
+		return
+	}
+	if stmt, err = tx.PrepareContext(ctx, fmt.Sprintf(
+		"INSERT INTO %s VALUES (%s)", target, strings.Join(marks, ", "))); err != nil {
+		return
+	}
+	defer func() { _ = stmt.Close() }()
+	var (
+		values = make([]interface{}, len(types))
+		dest   = make([]interface{}, len(types))
+	)
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		if _, err = stmt.ExecContext(ctx, values...); err != nil {
+			return
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	return tx.Commit()
+}
+
+// federatedTables returns the qualified tables referenced by the read-only query.
+func federatedTables(query string) (tables map[string][]string, err error) {
+	var stmt sqlparser.Statement
+	if stmt, err = sqlparser.Parse(query); err != nil {
+		err = errors.Wrap(err, "parse sql failed")
+		return
+	}
+	switch stmt.(type) {
+	case *sqlparser.Select, *sqlparser.Union, *sqlparser.ParenSelect:
+	default:
+		err = ErrNotReadOnlyQuery
+		return
+	}
+	var seen = make(map[string]bool)
+	tables = make(map[string][]string)
+	err = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		// only the table expressions of FROM clauses reference tables, the qualifiers of the
+		// column names are walked as table names as well but they are table aliases
+		expr, ok := node.(*sqlparser.AliasedTableExpr)
+		if !ok {
+			return true, nil
+		}
+		t, ok := expr.Expr.(sqlparser.TableName)
+		if !ok || t.IsEmpty() {
+			// subqueries are walked for their own table expressions
+			return true, nil
+		}
+		if t.Qualifier.IsEmpty() {
+			return false, errors.Wrapf(ErrUnknownDatabaseAlias,
+				"table %s is not qualified by database alias", t.Name.String())
+		}
+		var (
+			alias = strings.ToLower(t.Qualifier.String())
+			name  = t.Name.String()
+			key   = alias + "." + name
+		)
+		if !seen[key] {
+			seen[key] = true
+			tables[alias] = append(tables[alias], name)
+		}
+		return true, nil
+	}, stmt)
+	return
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFederatedTables(t *testing.T) {
+	Convey("Given federated queries", t, func() {
+		Convey("Qualified tables should be grouped by database alias", func() {
+			tables, err := federatedTables(`SELECT u.id, o.total FROM East.users u ` +
+				`JOIN west.orders o ON u.id = o.user_id ` +
+				`WHERE u.id IN (SELECT user_id FROM west.orders WHERE total > 10)`)
+			So(err, ShouldBeNil)
+			So(tables, ShouldResemble, map[string][]string{
+				"east": {"users"},
+				"west": {"orders"},
+			})
+		})
+		Convey("Tables of derived tables should be found", func() {
+			tables, err := federatedTables(`SELECT e.id, w.total FROM (SELECT id FROM east.users) e ` +
+				`JOIN west.orders w ON e.id = w.user_id`)
+			So(err, ShouldBeNil)
+			So(tables, ShouldResemble, map[string][]string{
+				"east": {"users"},
+				"west": {"orders"},
+			})
+		})
+		Convey("Unqualified tables should be rejected", func() {
+			_, err := federatedTables(`SELECT * FROM east.users u JOIN orders o ON u.id = o.user_id`)
+			So(errors.Cause(err), ShouldEqual, ErrUnknownDatabaseAlias)
+		})
+		Convey("Write queries should be rejected", func() {
+			_, err := federatedTables(`DELETE FROM east.users`)
+			So(err, ShouldEqual, ErrNotReadOnlyQuery)
+			_, err = federatedTables(`INSERT INTO east.users SELECT * FROM west.users`)
+			So(err, ShouldEqual, ErrNotReadOnlyQuery)
+		})
+	})
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/SQLess/SQLess/xenomint"
+)
+
+// SetFirewallOverrides allows the overridable sql firewall rules, e.g. collation-unicode_ci, on
+// the database. The overrides are written as a replicated write, so all miners of the database
+// check statements against the same overrides. Only the database owner is allowed to set
+// overrides.
+func SetFirewallOverrides(ctx context.Context, db *sql.DB, overrides []string) (err error) {
+	var table = quoteIdent(xenomint.FirewallOverridesTable)
+	var query strings.Builder
+	fmt.Fprintf(&query, `CREATE TABLE IF NOT EXISTS %s ("rule" TEXT PRIMARY KEY);`, table)
+	fmt.Fprintf(&query, `DELETE FROM %s;`, table)
+	for _, o := range overrides {
+		fmt.Fprintf(&query, `INSERT OR IGNORE INTO %s ("rule") VALUES (%s);`, table, quoteLiteral(o))
+	}
+	_, err = db.ExecContext(ctx, query.String())
+	return
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+var (
+	// HealthCheckInterval defines the interval of the background probes of the miners serving
+	// the open connections, the sessions to a miner failing the probe are evicted so that the
+	// connections redial it instead of failing the next query.
+	HealthCheckInterval = 10 * time.Second
+
+	peerHealth = newHealthTracker()
+	// probePeer probes the liveness of the miner.
+	probePeer = mux.ProbeNode
+)
+
+// healthStat defines the health of a miner connected by the open connections.
+type healthStat struct {
+	refs   int
+	broken bool
+	epoch  uint64 // increased each time the sessions to the miner are evicted
+}
+
+// healthTracker tracks the health of miners shared by all the connections of the process, the
+// miners are probed in background while any of them is watched.
+type healthTracker struct {
+	sync.RWMutex
+	stats map[proto.NodeID]*healthStat
+	stop  chan struct{} // closed to stop the running checker
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{
+		stats: make(map[proto.NodeID]*healthStat),
+	}
+}
+
+// watch starts probing the miner for a peer connection and returns the current epoch.
+func (t *healthTracker) watch(node proto.NodeID) (epoch uint64) {
+	t.Lock()
+	defer t.Unlock()
+	s, ok := t.stats[node]
+	if !ok {
+		s = &healthStat{}
+		t.stats[node] = s
+	}
+	s.refs++
+	t.runChecker()
+	return s.epoch
+}
+
+// unwatch stops probing the miner once no peer connection is connected to it, the checker is
+// stopped with the last watched miner.
+func (t *healthTracker) unwatch(node proto.NodeID) {
+	t.Lock()
+	defer t.Unlock()
+	if s, ok := t.stats[node]; ok {
+		if s.refs--; s.refs <= 0 {
+			delete(t.stats, node)
+		}
+	}
+	if len(t.stats) == 0 {
+		t.stopChecker()
+	}
+}
+
+// runChecker starts the background checker if it's not running, the caller must hold the lock.
+func (t *healthTracker) runChecker() {
+	if HealthCheckInterval <= 0 || t.stop != nil {
+		return
+	}
+	var (
+		stop     = make(chan struct{})
+		interval = HealthCheckInterval
+	)
+	t.stop = stop
+	go func() {
+		var ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				checkPeers()
+			}
+		}
+	}()
+}
+
+// stopChecker stops the running checker, the caller must hold the lock. Each checker has its
+// own stop channel, so a checker started right after is never shadowed by the stopping one.
+func (t *healthTracker) stopChecker() {
+	if t.stop != nil {
+		close(t.stop)
+		t.stop = nil
+	}
+}
+
+// nodes returns the watched miners.
+func (t *healthTracker) nodes() (nodes []proto.NodeID) {
+	t.RLock()
+	defer t.RUnlock()
+	for k := range t.stats {
+		nodes = append(nodes, k)
+	}
+	return
+}
+
+// observe records a probe result of the miner, and returns true if the miner just turns broken
+// and its sessions should be evicted.
+func (t *healthTracker) observe(node proto.NodeID, err error) (evict bool) {
+	t.Lock()
+	defer t.Unlock()
+	s, ok := t.stats[node]
+	if !ok {
+		return
+	}
+	if err == nil {
+		s.broken = false
+		return
+	}
+	if !s.broken {
+		s.broken = true
+		s.epoch++
+		evict = true
+	}
+	return
+}
+
+// state returns the current epoch of the miner and whether it's failing the probes.
+func (t *healthTracker) state(node proto.NodeID) (epoch uint64, broken bool) {
+	t.RLock()
+	defer t.RUnlock()
+	if s, ok := t.stats[node]; ok {
+		return s.epoch, s.broken
+	}
+	return
+}
+
+// checkPeers probes all the watched miners once.
+func checkPeers() {
+	var wg sync.WaitGroup
+	for _, node := range peerHealth.nodes() {
+		wg.Add(1)
+		go func(node proto.NodeID) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), HealthCheckInterval)
+			defer cancel()
+			err := probePeer(ctx, node)
+			if peerHealth.observe(node, err) {
+				mux.GetSessionPoolInstance().Remove(node)
+				log.WithField("node", node).WithError(err).Warning("evicted sessions to broken miner")
+			}
+		}(node)
+	}
+	wg.Wait()
+}
+
+// renewPConn replaces the peer connection if the sessions to its miner are evicted by the health
+// checks since it was established. The broken miner is failed over like a failed query if
+// possible, otherwise the miner is redialed.
+func (c *conn) renewPConn(pc *pconn, queryType types.QueryType) *pconn {
+	var node = proto.NodeID(pc.pCaller.Target())
+	epoch, broken := peerHealth.state(node)
+	if epoch == pc.epoch {
+		return pc
+	}
+	if broken {
+		if next := c.failover(pc, queryType, ErrPeerUnhealthy); next != nil {
+			return next
+		}
+	}
+	var next = c.newPConn(node)
+	_ = next.startAckWorkers()
+	c.replacePConn(pc, next)
+	go pc.close()
+	log.WithFields(log.Fields{
+		"db":     c.dbID,
+		"target": node,
+	}).Info("redialed peer connection")
+	return next
+}
+
+// replacePConn replaces the serving peer connection.
+func (c *conn) replacePConn(old, next *pconn) {
+	c.pconnLock.Lock()
+	defer c.pconnLock.Unlock()
+	if c.leader == old {
+		c.leader = next
+	}
+	if c.follower == old {
+		c.follower = next
+	}
+	for i, f := range c.followers {
+		if f == old {
+			c.followers[i] = next
+		}
+	}
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestPeerHealth(t *testing.T) {
+	Convey("test peer health checks", t, func() {
+		var (
+			origProbe    = probePeer
+			origInterval = HealthCheckInterval
+			down         = make(map[proto.NodeID]bool)
+			node         = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000001")
+		)
+		probePeer = func(_ context.Context, id proto.NodeID) error {
+			if down[id] {
+				return errors.New("probe failed")
+			}
+			return nil
+		}
+		// probe by hand instead of the background checker
+		HealthCheckInterval = 0
+		defer func() {
+			probePeer = origProbe
+			HealthCheckInterval = origInterval
+		}()
+
+		c := &conn{}
+		pc := c.newPConn(node)
+		So(pc.startAckWorkers(), ShouldBeNil)
+		c.leader = pc
+		defer func() { _ = c.leader.close() }()
+
+		Convey("healthy peer should be kept", func() {
+			checkPeers()
+			So(c.renewPConn(pc, types.ReadQuery), ShouldEqual, pc)
+			So(c.ResetSession(context.Background()), ShouldBeNil)
+		})
+		Convey("broken peer should be evicted and redialed", func() {
+			down[node] = true
+			checkPeers()
+			_, broken := peerHealth.state(node)
+			So(broken, ShouldBeTrue)
+			So(c.ResetSession(context.Background()), ShouldNotBeNil)
+
+			// evicted only once while it keeps failing
+			epoch, _ := peerHealth.state(node)
+			checkPeers()
+			again, _ := peerHealth.state(node)
+			So(again, ShouldEqual, epoch)
+
+			down[node] = false
+			checkPeers()
+			So(c.ResetSession(context.Background()), ShouldBeNil)
+			next := c.renewPConn(pc, types.ReadQuery)
+			So(next, ShouldNotEqual, pc)
+			So(next.epoch, ShouldEqual, epoch)
+			So(c.leader, ShouldEqual, next)
+			So(c.renewPConn(next, types.ReadQuery), ShouldEqual, next)
+		})
+	})
+}
+
+func TestHealthChecker(t *testing.T) {
+	Convey("test health checker lifecycle", t, func() {
+		var (
+			origInterval = HealthCheckInterval
+			tracker      = newHealthTracker()
+			node         = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000002")
+		)
+		HealthCheckInterval = time.Hour
+		defer func() { HealthCheckInterval = origInterval }()
+
+		tracker.watch(node)
+		tracker.watch(node)
+		So(tracker.stop, ShouldNotBeNil)
+		first := tracker.stop
+
+		// restart should replace the stop channel instead of reviving the old checker
+		tracker.Lock()
+		tracker.stopChecker()
+		tracker.runChecker()
+		tracker.Unlock()
+		So(tracker.stop, ShouldNotBeNil)
+		So(tracker.stop, ShouldNotEqual, first)
+		_, open := <-first
+		So(open, ShouldBeFalse)
+
+		// the checker should be stopped with the last watched peer
+		second := tracker.stop
+		tracker.unwatch(node)
+		So(tracker.stop, ShouldEqual, second)
+		tracker.unwatch(node)
+		So(tracker.stop, ShouldBeNil)
+		_, open = <-second
+		So(open, ShouldBeFalse)
+	})
+}
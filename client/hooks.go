@@ -0,0 +1,216 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+// QueryInfo describes a query sent to the miner for the hooks.
+type QueryInfo struct {
+	DatabaseID proto.DatabaseID
+	Type       types.QueryType
+	Queries    []types.Query
+
+	// Target is the miner serving the query, it may change on the failovers.
+	Target       proto.NodeID
+	ConnectionID uint64
+	SeqNo        uint64
+
+	// RequestBytes and ResponseBytes are the estimated payload sizes of the queries and the
+	// result rows before compression.
+	RequestBytes  int
+	ResponseBytes int
+	Rows          int
+	AffectedRows  int64
+
+	// Retries is the retries of the query so far, see RetryPolicy.
+	Retries  int
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Hooks instruments the queries of the driver for metrics, logging or tracing. The hooks are
+// called synchronously on the query path and should return quickly.
+type Hooks interface {
+	// BeforeQuery is called before the query is sent, the returned context is passed down to
+	// the query and the following hooks of the query.
+	BeforeQuery(ctx context.Context, info *QueryInfo) context.Context
+	// OnRetry is called before each retry of the query with the failure of the last attempt.
+	OnRetry(ctx context.Context, info *QueryInfo, err error)
+	// OnError is called once the query fails, before AfterQuery.
+	OnError(ctx context.Context, info *QueryInfo, err error)
+	// AfterQuery is called once the query finishes, err is nil if it succeeds.
+	AfterQuery(ctx context.Context, info *QueryInfo, err error)
+}
+
+// NopHooks implements Hooks doing nothing, it is embedded to implement a part of the hooks.
+type NopHooks struct{}
+
+// BeforeQuery implements Hooks.BeforeQuery.
+func (NopHooks) BeforeQuery(ctx context.Context, _ *QueryInfo) context.Context { return ctx }
+
+// OnRetry implements Hooks.OnRetry.
+func (NopHooks) OnRetry(context.Context, *QueryInfo, error) {}
+
+// OnError implements Hooks.OnError.
+func (NopHooks) OnError(context.Context, *QueryInfo, error) {}
+
+// AfterQuery implements Hooks.AfterQuery.
+func (NopHooks) AfterQuery(context.Context, *QueryInfo, error) {}
+
+var (
+	hooksLock sync.RWMutex
+	hooks     hookChain
+)
+
+// AddHooks registers the hooks of all the queries sent by the driver, the hooks are called in
+// the order of registration.
+func AddHooks(h ...Hooks) {
+	hooksLock.Lock()
+	defer hooksLock.Unlock()
+	// copy on write, the running queries keep the hooks they started with
+	hooks = append(hooks[:len(hooks):len(hooks)], h...)
+}
+
+// ResetHooks removes all the registered hooks.
+func ResetHooks() {
+	hooksLock.Lock()
+	defer hooksLock.Unlock()
+	hooks = nil
+}
+
+type hookChain []Hooks
+
+func getHooks() hookChain {
+	hooksLock.RLock()
+	defer hooksLock.RUnlock()
+	return hooks
+}
+
+// queryHooks are the hooks of a running query, the methods of a nil queryHooks do nothing so
+// that the queries are not instrumented without the registered hooks.
+type queryHooks struct {
+	chain hookChain
+	info  *QueryInfo
+}
+
+func newQueryHooks(
+	dbID proto.DatabaseID, queryType types.QueryType, queries []types.Query, connID, seqNo uint64,
+) *queryHooks {
+	var chain = getHooks()
+	if len(chain) == 0 {
+		return nil
+	}
+	return &queryHooks{
+		chain: chain,
+		info: &QueryInfo{
+			DatabaseID:   dbID,
+			Type:         queryType,
+			Queries:      queries,
+			ConnectionID: connID,
+			SeqNo:        seqNo,
+			RequestBytes: queriesBytes(queries),
+		},
+	}
+}
+
+func (qh *queryHooks) before(ctx context.Context, target proto.NodeID) context.Context {
+	if qh == nil {
+		return ctx
+	}
+	qh.info.Target = target
+	qh.info.Start = time.Now()
+	for _, h := range qh.chain {
+		ctx = h.BeforeQuery(ctx, qh.info)
+	}
+	return ctx
+}
+
+func (qh *queryHooks) retry(ctx context.Context, seqNo uint64, err error) {
+	if qh == nil {
+		return
+	}
+	qh.info.SeqNo = seqNo
+	qh.info.Retries++
+	for _, h := range qh.chain {
+		h.OnRetry(ctx, qh.info, err)
+	}
+}
+
+func (qh *queryHooks) result(response *types.Response) {
+	if qh == nil {
+		return
+	}
+	qh.info.Rows = len(response.Payload.Rows)
+	qh.info.ResponseBytes = rowsBytes(response.Payload.Rows)
+	qh.info.AffectedRows = response.Header.AffectedRows
+}
+
+func (qh *queryHooks) after(ctx context.Context, target proto.NodeID, err error) {
+	if qh == nil {
+		return
+	}
+	qh.info.Target = target
+	qh.info.Duration = time.Since(qh.info.Start)
+	if err != nil {
+		for _, h := range qh.chain {
+			h.OnError(ctx, qh.info, err)
+		}
+	}
+	for _, h := range qh.chain {
+		h.AfterQuery(ctx, qh.info, err)
+	}
+}
+
+// queriesBytes estimates the payload size of the queries.
+func queriesBytes(queries []types.Query) (n int) {
+	for _, q := range queries {
+		n += len(q.Pattern)
+		for _, arg := range q.Args {
+			n += len(arg.Name) + valueBytes(arg.Value)
+		}
+	}
+	return
+}
+
+// rowsBytes estimates the payload size of the result rows.
+func rowsBytes(rows []types.ResponseRow) (n int) {
+	for _, row := range rows {
+		for _, v := range row.Values {
+			n += valueBytes(v)
+		}
+	}
+	return
+}
+
+func valueBytes(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(v)
+	case []byte:
+		return len(v)
+	default:
+		return 8
+	}
+}
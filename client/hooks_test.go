@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+type testHookKey struct{}
+
+type recordHooks struct {
+	NopHooks
+	name  string
+	calls *[]string
+}
+
+func (h *recordHooks) BeforeQuery(ctx context.Context, info *QueryInfo) context.Context {
+	*h.calls = append(*h.calls, h.name+":before")
+	return context.WithValue(ctx, testHookKey{}, h.name)
+}
+
+func (h *recordHooks) OnRetry(ctx context.Context, info *QueryInfo, err error) {
+	*h.calls = append(*h.calls, h.name+":retry")
+}
+
+func (h *recordHooks) AfterQuery(ctx context.Context, info *QueryInfo, err error) {
+	*h.calls = append(*h.calls, h.name+":after:"+ctx.Value(testHookKey{}).(string))
+}
+
+type errorHooks struct {
+	NopHooks
+	errs []error
+}
+
+func (h *errorHooks) OnError(ctx context.Context, info *QueryInfo, err error) {
+	h.errs = append(h.errs, err)
+}
+
+func TestHooks(t *testing.T) {
+	Convey("test query hooks", t, func() {
+		defer ResetHooks()
+		var queries = []types.Query{{
+			Pattern: "INSERT INTO t VALUES(?, ?)",
+			Args: []types.NamedArg{
+				{Value: "abc"},
+				{Value: int64(1)},
+			},
+		}}
+
+		So(newQueryHooks("db", types.WriteQuery, queries, 1, 2), ShouldBeNil)
+		var nilHooks *queryHooks
+		ctx := nilHooks.before(context.Background(), "node")
+		nilHooks.retry(ctx, 3, nil)
+		nilHooks.result(&types.Response{})
+		nilHooks.after(ctx, "node", nil)
+
+		var (
+			calls []string
+			eh    = &errorHooks{}
+		)
+		AddHooks(&recordHooks{name: "a", calls: &calls}, eh)
+		AddHooks(&recordHooks{name: "b", calls: &calls})
+
+		qh := newQueryHooks("db", types.WriteQuery, queries, 1, 2)
+		So(qh, ShouldNotBeNil)
+		So(qh.info.RequestBytes, ShouldEqual, len(queries[0].Pattern)+3+8)
+		ctx = qh.before(context.Background(), "node1")
+		qh.retry(ctx, 3, errors.New("broken pipe"))
+		qh.result(&types.Response{
+			Header: types.SignedResponseHeader{
+				ResponseHeader: types.ResponseHeader{AffectedRows: 2},
+			},
+			Payload: types.ResponsePayload{
+				Rows: []types.ResponseRow{{Values: []interface{}{"xy", nil}}},
+			},
+		})
+		var failure = errors.New("failed")
+		qh.after(ctx, "node2", failure)
+
+		So(calls, ShouldResemble, []string{
+			"a:before", "b:before", "a:retry", "b:retry", "a:after:b", "b:after:b",
+		})
+		So(eh.errs, ShouldResemble, []error{failure})
+		So(qh.info.Target, ShouldEqual, "node2")
+		So(qh.info.SeqNo, ShouldEqual, 3)
+		So(qh.info.Retries, ShouldEqual, 1)
+		So(qh.info.Rows, ShouldEqual, 1)
+		So(qh.info.ResponseBytes, ShouldEqual, 2)
+		So(qh.info.AffectedRows, ShouldEqual, 2)
+		So(qh.info.Duration, ShouldBeGreaterThan, 0)
+
+		ResetHooks()
+		So(newQueryHooks("db", types.ReadQuery, queries, 1, 2), ShouldBeNil)
+	})
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/kms"
+)
+
+type queryKeyCtxKey struct{}
+
+var (
+	keysLock     sync.RWMutex
+	keys         = make(map[string]*asymmetric.PrivateKey)
+	keyMasterKey []byte
+)
+
+func setKeyMasterKey(masterKey []byte) {
+	keysLock.Lock()
+	defer keysLock.Unlock()
+	keyMasterKey = masterKey
+	keys = make(map[string]*asymmetric.PrivateKey)
+}
+
+// AddKey registers the private key under the alias, replacing the configured key file of the
+// same alias if any.
+func AddKey(alias string, privKey *asymmetric.PrivateKey) {
+	keysLock.Lock()
+	defer keysLock.Unlock()
+	keys[alias] = privKey
+}
+
+// GetKey returns the private key of the alias, which is either added by AddKey or loaded from
+// the Keys section of the client config with the master key of Init.
+func GetKey(alias string) (privKey *asymmetric.PrivateKey, err error) {
+	keysLock.RLock()
+	privKey, ok := keys[alias]
+	keysLock.RUnlock()
+	if ok {
+		return
+	}
+
+	var keyFile string
+	if conf.GConf != nil {
+		keyFile, ok = conf.GConf.Keys[alias]
+	}
+	if !ok {
+		err = errors.Wrapf(ErrUnknownKeyAlias, "key %s", alias)
+		return
+	}
+
+	keysLock.Lock()
+	defer keysLock.Unlock()
+	if privKey, ok = keys[alias]; ok {
+		return
+	}
+	if privKey, err = kms.LoadPrivateKey(keyFile, keyMasterKey); err != nil {
+		err = errors.Wrapf(err, "load key %s", alias)
+		return
+	}
+	keys[alias] = privKey
+	return
+}
+
+// WithKey returns a context signing the queries with the private key of the alias instead of
+// the key of the connection.
+func WithKey(ctx context.Context, alias string) (context.Context, error) {
+	privKey, err := GetKey(alias)
+	if err != nil {
+		return ctx, err
+	}
+	return context.WithValue(ctx, queryKeyCtxKey{}, privKey), nil
+}
+
+func getQueryKey(ctx context.Context) (privKey *asymmetric.PrivateKey, ok bool) {
+	privKey, ok = ctx.Value(queryKeyCtxKey{}).(*asymmetric.PrivateKey)
+	return
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/kms"
+)
+
+func TestNamedKeys(t *testing.T) {
+	Convey("test named key aliases", t, func() {
+		dir, err := ioutil.TempDir("", "client_keys")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			origConf  = conf.GConf
+			masterKey = []byte("keys")
+			keyFile   = filepath.Join(dir, "ops.key")
+		)
+		opsKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		So(kms.SavePrivateKey(keyFile, opsKey, masterKey), ShouldBeNil)
+		conf.GConf = &conf.Config{Keys: map[string]string{"ops": keyFile}}
+		setKeyMasterKey(masterKey)
+		defer func() {
+			conf.GConf = origConf
+			setKeyMasterKey(nil)
+		}()
+
+		Convey("configured key should be loaded once", func() {
+			key, err := GetKey("ops")
+			So(err, ShouldBeNil)
+			So(key.Serialize(), ShouldResemble, opsKey.Serialize())
+			So(os.Remove(keyFile), ShouldBeNil)
+			cached, err := GetKey("ops")
+			So(err, ShouldBeNil)
+			So(cached, ShouldEqual, key)
+		})
+		Convey("added key should be selected by alias", func() {
+			roKey, _, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			AddKey("readonly", roKey)
+			key, err := GetKey("readonly")
+			So(err, ShouldBeNil)
+			So(key, ShouldEqual, roKey)
+
+			ctx, err := WithKey(context.Background(), "readonly")
+			So(err, ShouldBeNil)
+			key, ok := getQueryKey(ctx)
+			So(ok, ShouldBeTrue)
+			So(key, ShouldEqual, roKey)
+			_, ok = getQueryKey(context.Background())
+			So(ok, ShouldBeFalse)
+		})
+		Convey("unknown alias should be rejected", func() {
+			_, err := GetKey("owner")
+			So(errors.Cause(err), ShouldEqual, ErrUnknownKeyAlias)
+			_, err = WithKey(context.Background(), "owner")
+			So(errors.Cause(err), ShouldEqual, ErrUnknownKeyAlias)
+		})
+		Convey("wrong master key should fail to load", func() {
+			setKeyMasterKey([]byte("wrong"))
+			_, err := GetKey("ops")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
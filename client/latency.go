@@ -0,0 +1,221 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/rpc"
+	"github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+var (
+	// ReplicaProbeInterval defines the average interval to re-probe the RTT of a replica, each
+	// probe is jittered by ±20% to avoid synchronized probing of clients.
+	ReplicaProbeInterval = 30 * time.Second
+	// ReplicaUnhealthyFailures defines the consecutive failures to consider a replica unhealthy.
+	ReplicaUnhealthyFailures = 3
+
+	// rttAlpha is the smoothing factor of the RTT moving average.
+	rttAlpha = 0.3
+	// rerouteRatio is the RTT ratio of a better replica to reroute the reads to it.
+	rerouteRatio = 0.7
+
+	replicaRTTs = newRTTTracker()
+)
+
+// rttStat defines the measured round trip time of a replica.
+type rttStat struct {
+	rtt       time.Duration // exponential moving average
+	failures  int
+	nextProbe time.Time
+}
+
+// rttTracker tracks the RTT of replicas shared by all the connections of the process.
+type rttTracker struct {
+	sync.RWMutex
+	stats map[proto.NodeID]*rttStat
+}
+
+func newRTTTracker() *rttTracker {
+	return &rttTracker{
+		stats: make(map[proto.NodeID]*rttStat),
+	}
+}
+
+// observe records a query or probe result of the replica.
+func (t *rttTracker) observe(node proto.NodeID, d time.Duration, err error) {
+	t.Lock()
+	defer t.Unlock()
+	s, ok := t.stats[node]
+	if !ok {
+		s = &rttStat{}
+		t.stats[node] = s
+	}
+	if err != nil {
+		s.failures++
+		return
+	}
+	s.failures = 0
+	if s.rtt == 0 {
+		s.rtt = d
+	} else {
+		s.rtt = time.Duration(rttAlpha*float64(d) + (1-rttAlpha)*float64(s.rtt))
+	}
+}
+
+// rtt returns the measured RTT of the healthy replica.
+func (t *rttTracker) rtt(node proto.NodeID) (d time.Duration, ok bool) {
+	t.RLock()
+	defer t.RUnlock()
+	s, ok := t.stats[node]
+	if !ok || s.rtt == 0 || s.failures >= ReplicaUnhealthyFailures {
+		return 0, false
+	}
+	return s.rtt, true
+}
+
+// best returns the healthy replica with the lowest RTT among candidates, unmeasured replicas are
+// only chosen if none is measured.
+func (t *rttTracker) best(candidates []proto.NodeID) (node proto.NodeID, ok bool) {
+	var min time.Duration
+	for _, v := range candidates {
+		if d, measured := t.rtt(v); measured && (!ok || d < min) {
+			node, min, ok = v, d, true
+		}
+	}
+	return
+}
+
+// due returns the replicas to probe at now and schedules their next probes.
+func (t *rttTracker) due(candidates []proto.NodeID, now time.Time) (nodes []proto.NodeID) {
+	t.Lock()
+	defer t.Unlock()
+	for _, v := range candidates {
+		s, ok := t.stats[v]
+		if !ok {
+			s = &rttStat{}
+			t.stats[v] = s
+		}
+		if now.Before(s.nextProbe) {
+			continue
+		}
+		var jitter = time.Duration((randSource.Float64()*0.4 - 0.2) * float64(ReplicaProbeInterval))
+		s.nextProbe = now.Add(ReplicaProbeInterval + jitter)
+		nodes = append(nodes, v)
+	}
+	return
+}
+
+// readCandidates returns the replicas to serve the reads of the connection.
+func readCandidates(peers *proto.Peers) (nodes []proto.NodeID) {
+	for _, v := range peers.Servers {
+		if v != peers.Leader {
+			nodes = append(nodes, v)
+		}
+	}
+	return
+}
+
+// probeReplicas measures the RTT of the due replicas in background.
+func (c *conn) probeReplicas(candidates []proto.NodeID) {
+	for _, node := range replicaRTTs.due(candidates, time.Now()) {
+		go probeReplica(&conn{
+			dbID:        c.dbID,
+			localNodeID: c.localNodeID,
+			privKey:     c.privKey,
+		}, node, c.useDirectRPC)
+	}
+}
+
+func probeReplica(c *conn, node proto.NodeID, useDirectRPC bool) {
+	var (
+		caller        rpc.PCaller
+		connID, seqNo = allocateConnAndSeq()
+		req           *types.Request
+		resp          types.Response
+		err           error
+	)
+	defer putBackConn(connID)
+	if useDirectRPC {
+		caller = rpc.NewPersistentCaller(node)
+	} else {
+		caller = mux.NewPersistentCaller(node)
+	}
+	defer caller.Close()
+	if req, err = c.newRequest(c.privKey, types.ReadQuery, connID, seqNo, []types.Query{
+		{Pattern: "SELECT 1"},
+	}); err != nil {
+		return
+	}
+	var start = time.Now()
+	err = caller.Call(route.DBSQuery.String(), req, &resp)
+	replicaRTTs.observe(node, time.Since(start), err)
+	log.WithFields(log.Fields{
+		"db":   c.dbID,
+		"node": node,
+		"rtt":  time.Since(start),
+	}).WithError(err).Debug("probed replica")
+}
+
+// maybeReroute switches the reads to a replica which is significantly faster than the current
+// follower, or healthy while the current one is not.
+func (c *conn) maybeReroute() {
+	peers, err := cacheGetPeers(c.dbID, c.privKey)
+	if err != nil {
+		return
+	}
+	var candidates = readCandidates(peers)
+	c.probeReplicas(candidates)
+
+	best, ok := replicaRTTs.best(candidates)
+	if !ok {
+		return
+	}
+	c.pconnLock.Lock()
+	defer c.pconnLock.Unlock()
+	if c.follower != nil {
+		var current = proto.NodeID(c.follower.pCaller.Target())
+		if current == best {
+			return
+		}
+		if d, healthy := replicaRTTs.rtt(current); healthy {
+			if bd, _ := replicaRTTs.rtt(best); float64(bd) > rerouteRatio*float64(d) {
+				return
+			}
+		}
+	}
+
+	var next = c.takeStandby(best)
+	if next == nil {
+		next = c.newPConn(best)
+	}
+	_ = next.startAckWorkers()
+	if old := c.follower; old != nil {
+		go old.close()
+	}
+	c.follower = next
+	log.WithFields(log.Fields{
+		"db":       c.dbID,
+		"follower": best,
+	}).Debug("rerouted reads to lower latency replica")
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestRTTTracker(t *testing.T) {
+	Convey("test rtt tracker", t, func() {
+		var (
+			tr         = newRTTTracker()
+			a, b, c    = proto.NodeID("a"), proto.NodeID("b"), proto.NodeID("c")
+			candidates = []proto.NodeID{a, b, c}
+		)
+		_, ok := tr.best(candidates)
+		So(ok, ShouldBeFalse)
+
+		tr.observe(a, 30*time.Millisecond, nil)
+		tr.observe(b, 10*time.Millisecond, nil)
+		node, ok := tr.best(candidates)
+		So(ok, ShouldBeTrue)
+		So(node, ShouldEqual, b)
+
+		// moving average
+		tr.observe(b, 110*time.Millisecond, nil)
+		d, ok := tr.rtt(b)
+		So(ok, ShouldBeTrue)
+		So(d, ShouldEqual, 40*time.Millisecond)
+		node, _ = tr.best(candidates)
+		So(node, ShouldEqual, a)
+
+		// unhealthy replica is skipped until it recovers
+		for i := 0; i < ReplicaUnhealthyFailures; i++ {
+			tr.observe(a, 0, errors.New("unreachable"))
+		}
+		node, _ = tr.best(candidates)
+		So(node, ShouldEqual, b)
+		tr.observe(a, 30*time.Millisecond, nil)
+		node, _ = tr.best(candidates)
+		So(node, ShouldEqual, a)
+
+		// probes are scheduled with jitter
+		var now = time.Now()
+		So(tr.due(candidates, now), ShouldHaveLength, 3)
+		So(tr.due(candidates, now), ShouldBeEmpty)
+		So(tr.due(candidates, now.Add(ReplicaProbeInterval*2)), ShouldHaveLength, 3)
+	})
+}
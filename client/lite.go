@@ -0,0 +1,384 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/kayak"
+	kt "github.com/SQLess/SQLess/kayak/types"
+	kl "github.com/SQLess/SQLess/kayak/wal"
+	"github.com/SQLess/SQLess/pow/cpuminer"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/rpc"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+	"github.com/SQLess/SQLess/xenomint"
+)
+
+const (
+	// LiteTarget defines the pseudo target node of the in-process database.
+	LiteTarget = "lite"
+
+	liteDBFileSuffix  = ".db3"
+	liteWalFileSuffix = ".ldb"
+
+	// the kayak runtime has no follower to call, the rpc names are only required by config
+	liteKayakRPCName         = "LiteKayak"
+	liteKayakApplyMethodName = "Apply"
+	liteKayakFetchMethodName = "Fetch"
+	liteKayakTimeout         = time.Minute
+)
+
+var (
+	liteMode    uint32
+	liteDataDir string
+	liteNonce   uint32
+	liteChains  = struct {
+		sync.Mutex
+		m map[proto.DatabaseID]*liteChain
+	}{
+		m: make(map[proto.DatabaseID]*liteChain),
+	}
+)
+
+// liteChain defines an in-process single-node database, writes are committed by a local kayak
+// runtime with the node itself as the only member, as a miner database does.
+type liteChain struct {
+	sync.RWMutex // protects the chain from being stopped during queries
+	dbID         proto.DatabaseID
+	dropped      bool
+	chain        *xenomint.Chain
+	wal          *kl.LevelDBWal
+	runtime      *kayak.Runtime
+}
+
+// InitLite initializes the driver in embedded single-node mode: databases are stored in the
+// data directory and queried in-process without block producers, PoW or network access. The
+// driver API is unchanged, so applications can run unit tests and local development against it.
+func InitLite(dataDir string) (err error) {
+	if !atomic.CompareAndSwapUint32(&driverInitialized, 0, 1) {
+		err = ErrAlreadyInitialized
+		return
+	}
+	defer func() {
+		if err != nil {
+			atomic.StoreUint32(&driverInitialized, 0)
+		}
+	}()
+
+	if err = os.MkdirAll(dataDir, 0755); err != nil {
+		return
+	}
+	// use a throwaway identity if no key pair is loaded
+	if _, keyErr := kms.GetLocalPrivateKey(); keyErr != nil {
+		var (
+			priv *asymmetric.PrivateKey
+			pub  *asymmetric.PublicKey
+		)
+		if priv, pub, err = asymmetric.GenSecp256k1KeyPair(); err != nil {
+			return
+		}
+		kms.SetLocalKeyPair(priv, pub)
+		nodeID := hash.THashH(pub.Serialize())
+		kms.SetLocalNodeIDNonce(nodeID.CloneBytes(), &cpuminer.Uint256{})
+	}
+
+	liteDataDir = dataDir
+	atomic.StoreUint32(&liteMode, 1)
+	return
+}
+
+// IsLiteMode returns whether the driver is running in embedded single-node mode.
+func IsLiteMode() bool {
+	return atomic.LoadUint32(&liteMode) == 1
+}
+
+func liteDBFile(dbID proto.DatabaseID) string {
+	return filepath.Join(liteDataDir, string(dbID)+liteDBFileSuffix)
+}
+
+func createLite() (dsn string, err error) {
+	var (
+		pub  *asymmetric.PublicKey
+		addr proto.AccountAddress
+	)
+	if pub, err = kms.GetLocalPublicKey(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(pub); err != nil {
+		return
+	}
+	var dbID proto.DatabaseID
+	for {
+		dbID = proto.FromAccountAndNonce(addr, atomic.AddUint32(&liteNonce, 1))
+		if _, statErr := os.Stat(liteDBFile(dbID)); os.IsNotExist(statErr) {
+			break
+		}
+	}
+	if _, err = getLiteChain(dbID, true); err != nil {
+		return
+	}
+	cfg := NewConfig()
+	cfg.DatabaseID = string(dbID)
+	dsn = cfg.FormatDSN()
+	return
+}
+
+func liteWalFile(dbID proto.DatabaseID) string {
+	return filepath.Join(liteDataDir, string(dbID)+liteWalFileSuffix)
+}
+
+func getLiteChain(dbID proto.DatabaseID, create bool) (lc *liteChain, err error) {
+	liteChains.Lock()
+	defer liteChains.Unlock()
+	var ok bool
+	if lc, ok = liteChains.m[dbID]; ok {
+		return
+	}
+	if !create {
+		if _, err = os.Stat(liteDBFile(dbID)); err != nil {
+			err = errors.Wrapf(err, "lite database %s not exists", dbID)
+			return
+		}
+	}
+	if lc, err = openLiteChain(dbID); err != nil {
+		return
+	}
+	liteChains.m[dbID] = lc
+	return
+}
+
+func openLiteChain(dbID proto.DatabaseID) (lc *liteChain, err error) {
+	var (
+		nodeID proto.NodeID
+		priv   *asymmetric.PrivateKey
+	)
+	if nodeID, err = kms.GetLocalNodeID(); err != nil {
+		return
+	}
+	if priv, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	var peers = &proto.Peers{
+		PeersHeader: proto.PeersHeader{
+			Leader:  nodeID,
+			Servers: []proto.NodeID{nodeID},
+		},
+	}
+	if err = peers.Sign(priv); err != nil {
+		return
+	}
+
+	lc = &liteChain{dbID: dbID}
+	defer func() {
+		if err != nil {
+			_ = lc.stop()
+			lc = nil
+		}
+	}()
+	if lc.chain, err = xenomint.NewChain(liteDBFile(dbID)); err != nil {
+		return
+	}
+	if lc.wal, err = kl.NewLevelDBWal(liteWalFile(dbID)); err != nil {
+		return
+	}
+	if lc.runtime, err = kayak.NewRuntime(&kt.RuntimeConfig{
+		Handler:          lc,
+		PrepareThreshold: 1.0,
+		CommitThreshold:  1.0,
+		PrepareTimeout:   liteKayakTimeout,
+		CommitTimeout:    liteKayakTimeout,
+		LogWaitTimeout:   liteKayakTimeout,
+		Peers:            peers,
+		Wal:              lc.wal,
+		NodeID:           nodeID,
+		InstanceID:       string(dbID),
+		ServiceName:      liteKayakRPCName,
+		ApplyMethodName:  liteKayakApplyMethodName,
+		FetchMethodName:  liteKayakFetchMethodName,
+	}); err != nil {
+		return
+	}
+	err = lc.runtime.Start()
+	return
+}
+
+func (lc *liteChain) stop() (err error) {
+	if lc.runtime != nil {
+		if err = lc.runtime.Shutdown(); err != nil {
+			return
+		}
+	}
+	if lc.wal != nil {
+		lc.wal.Close()
+	}
+	if lc.chain != nil {
+		err = lc.chain.Stop()
+	}
+	return
+}
+
+// dropLite stops the database and removes its files, queries of the connections still open
+// fail with ErrLiteDatabaseDropped.
+func dropLite(dbID proto.DatabaseID) (err error) {
+	liteChains.Lock()
+	defer liteChains.Unlock()
+	if lc, ok := liteChains.m[dbID]; ok {
+		delete(liteChains.m, dbID)
+		// wait for the running queries
+		lc.Lock()
+		lc.dropped = true
+		err = lc.stop()
+		lc.Unlock()
+		if err != nil {
+			return
+		}
+	}
+	if err = os.RemoveAll(liteWalFile(dbID)); err != nil {
+		return
+	}
+	if err = os.Remove(liteDBFile(dbID)); os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+func (lc *liteChain) query(req *types.Request) (resp *types.Response, err error) {
+	lc.RLock()
+	defer lc.RUnlock()
+	if lc.dropped {
+		err = errors.Wrapf(ErrLiteDatabaseDropped, "database %s", lc.dbID)
+		return
+	}
+	if req.Header.QueryType != types.WriteQuery {
+		return lc.chain.Query(req)
+	}
+	var result interface{}
+	if result, _, err = lc.runtime.Apply(req.GetContext(), req); err != nil {
+		return
+	}
+	resp = result.(*types.Response)
+	return
+}
+
+// EncodePayload implements kayak.types.Handler.EncodePayload.
+func (lc *liteChain) EncodePayload(request interface{}) (data []byte, err error) {
+	buf, err := utils.EncodeMsgPack(request)
+	if err != nil {
+		err = errors.Wrap(err, "encode request failed")
+		return
+	}
+	data = buf.Bytes()
+	return
+}
+
+// DecodePayload implements kayak.types.Handler.DecodePayload.
+func (lc *liteChain) DecodePayload(data []byte) (request interface{}, err error) {
+	var req *types.Request
+	if err = utils.DecodeMsgPack(data, &req); err != nil {
+		err = errors.Wrap(err, "decode request failed")
+		return
+	}
+	request = req
+	return
+}
+
+// Check implements kayak.types.Handler.Check.
+func (lc *liteChain) Check(rawReq interface{}) (err error) {
+	req, ok := rawReq.(*types.Request)
+	if !ok || req == nil {
+		err = errors.Wrap(ErrInvalidRequest, "invalid request payload")
+		return
+	}
+	return req.Verify()
+}
+
+// Commit implements kayak.types.Handler.Commit.
+func (lc *liteChain) Commit(rawReq interface{}, isLeader bool) (result interface{}, err error) {
+	req, ok := rawReq.(*types.Request)
+	if !ok || req == nil {
+		err = errors.Wrap(ErrInvalidRequest, "invalid request payload")
+		return
+	}
+	// reset context, commit should never be canceled
+	req.SetContext(context.Background())
+	var resp *types.Response
+	if resp, err = lc.chain.Query(req); err != nil {
+		return
+	}
+	if err = lc.chain.Commit(); err != nil {
+		return
+	}
+	result = resp
+	return
+}
+
+// liteCaller implements rpc.PCaller and serves queries with the in-process database.
+type liteCaller struct {
+	dbID proto.DatabaseID
+	lc   *liteChain
+}
+
+func newLiteCaller(dbID proto.DatabaseID) (c *liteCaller, err error) {
+	var lc *liteChain
+	if lc, err = getLiteChain(dbID, false); err != nil {
+		return
+	}
+	return &liteCaller{dbID: dbID, lc: lc}, nil
+}
+
+// Call implements rpc.PCaller.Call.
+func (c *liteCaller) Call(method string, request interface{}, reply interface{}) (err error) {
+	switch method {
+	case route.DBSQuery.String():
+		var resp *types.Response
+		if resp, err = c.lc.query(request.(*types.Request)); err != nil {
+			return
+		}
+		*reply.(*types.Response) = *resp
+	case route.DBSAck.String():
+	default:
+		err = errors.Wrapf(ErrNotSupportedInLiteMode, "method: %s", method)
+	}
+	return
+}
+
+// Close implements rpc.PCaller.Close.
+func (c *liteCaller) Close() {}
+
+// Target implements rpc.PCaller.Target.
+func (c *liteCaller) Target() string {
+	return LiteTarget
+}
+
+// New implements rpc.PCaller.New.
+func (c *liteCaller) New() rpc.PCaller {
+	return &liteCaller{dbID: c.dbID, lc: c.lc}
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestLiteMode(t *testing.T) {
+	Convey("test embedded single-node mode", t, func() {
+		dataDir, err := ioutil.TempDir("", "lite_test_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dataDir)
+
+		atomic.StoreUint32(&driverInitialized, 0)
+		So(InitLite(dataDir), ShouldBeNil)
+		defer func() {
+			atomic.StoreUint32(&liteMode, 0)
+			atomic.StoreUint32(&driverInitialized, 0)
+		}()
+		So(IsLiteMode(), ShouldBeTrue)
+		So(InitLite(dataDir), ShouldEqual, ErrAlreadyInitialized)
+
+		_, dsn, err := Create(ResourceMeta{})
+		So(err, ShouldBeNil)
+		So(WaitDBCreation(context.Background(), dsn), ShouldBeNil)
+		cfg, err := ParseDSN(dsn)
+		So(err, ShouldBeNil)
+		dbID := proto.DatabaseID(cfg.DatabaseID)
+
+		db, err := sql.Open(DBScheme, dsn)
+		So(err, ShouldBeNil)
+		defer db.Close()
+
+		_, err = db.Exec("CREATE TABLE test (test int)")
+		So(err, ShouldBeNil)
+		_, err = db.Exec("INSERT INTO test VALUES(?)", 1)
+		So(err, ShouldBeNil)
+		var v int
+		So(db.QueryRow("SELECT * FROM test LIMIT 1").Scan(&v), ShouldBeNil)
+		So(v, ShouldEqual, 1)
+
+		// writes are committed through the kayak log of the single member
+		lc, err := getLiteChain(dbID, false)
+		So(err, ShouldBeNil)
+		So(lc.runtime, ShouldNotBeNil)
+		_, err = os.Stat(liteWalFile(dbID))
+		So(err, ShouldBeNil)
+
+		_, err = Drop(dsn)
+		So(err, ShouldBeNil)
+		_, err = os.Stat(liteDBFile(dbID))
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		// the connection still open fails instead of using the stopped chain
+		_, err = lc.query(&types.Request{})
+		So(errors.Cause(err), ShouldEqual, ErrLiteDatabaseDropped)
+		So(db.QueryRow("SELECT * FROM test LIMIT 1").Scan(&v), ShouldNotBeNil)
+	})
+}
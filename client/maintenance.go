@@ -0,0 +1,49 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/SQLess/SQLess/xenomint"
+)
+
+// SetMaintenance switches the read-only maintenance mode of the database, writes are rejected
+// with a clear error while reads are still served. The mode is written as a replicated write,
+// so all miners of the database agree on it once the write is committed. Only the database
+// owner is allowed to switch maintenance mode.
+func SetMaintenance(ctx context.Context, db *sql.DB, enable bool, reason string) (err error) {
+	var (
+		table   = quoteIdent(xenomint.MaintenanceTable)
+		enabled int
+	)
+	if enable {
+		enabled = 1
+	} else {
+		reason = ""
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s ("enabled" BOOLEAN, "reason" TEXT, "since" TEXT);`+
+			`DELETE FROM %s;`+
+			`INSERT INTO %s ("enabled", "reason", "since") VALUES (%d, %s, %s);`,
+		table, table, table, enabled, quoteLiteral(reason),
+		quoteLiteral(getLocalTime().Format(time.RFC3339))))
+	return
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/SQLess/SQLess/xenomint"
+)
+
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// CreateMaterializedView defines a materialized view of the query, e.g. an expensive aggregate
+// query. The view is a table named name which is maintained incrementally by miners whenever a
+// write changes its source table, so it could be read cheaply as an ordinary table. The query
+// should be an aggregate over a single table grouped by selected columns, see
+// xenomint.MaterializedViewsTable. Only the database owner is allowed to define materialized
+// views.
+func CreateMaterializedView(ctx context.Context, db *sql.DB, name string, query string) (err error) {
+	if err = xenomint.ValidateMaterializedView(query); err != nil {
+		return
+	}
+	_, err = db.ExecContext(ctx, fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s ("name" TEXT PRIMARY KEY, "query" TEXT NOT NULL);`+
+			`INSERT INTO %s ("name", "query") VALUES (%s, %s);`,
+		quoteIdent(xenomint.MaterializedViewsTable), quoteIdent(xenomint.MaterializedViewsTable),
+		quoteLiteral(name), quoteLiteral(query)))
+	return
+}
+
+// DropMaterializedView drops the materialized view and its table.
+func DropMaterializedView(ctx context.Context, db *sql.DB, name string) (err error) {
+	_, err = db.ExecContext(ctx, fmt.Sprintf(
+		`DELETE FROM %s WHERE "name" = %s;DROP TABLE IF EXISTS %s;`,
+		quoteIdent(xenomint.MaterializedViewsTable), quoteLiteral(name), quoteIdent(name)))
+	return
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+)
+
+// MigrationDryRun executes the migration queries on a shadow copy of the database on the
+// leader miner, and reports the estimated execution time, table rewrites and projected token
+// cost of each query. The database itself is not modified, so heavy migrations could be
+// scheduled appropriately before being applied.
+func MigrationDryRun(ctx context.Context, dsn string, queries ...string) (
+	report *types.MigrationDryRunResp, err error,
+) {
+	var s *blobSession
+	if s, err = newBlobSession(dsn); err != nil {
+		return
+	}
+	defer s.close()
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	req := &types.MigrationDryRunReq{
+		Header: types.SignedMigrationDryRunHeader{
+			MigrationDryRunHeader: types.MigrationDryRunHeader{
+				DatabaseID: s.dbID,
+				Queries:    make([]types.Query, len(queries)),
+				Timestamp:  getLocalTime(),
+			},
+		},
+	}
+	for i, q := range queries {
+		req.Header.Queries[i].Pattern = q
+	}
+	if err = req.Header.Sign(s.privKey); err != nil {
+		return
+	}
+	report = &types.MigrationDryRunResp{}
+	if err = s.caller.Call(route.DBSMigrationDryRun.String(), req, report); err != nil {
+		report = nil
+	}
+	return
+}
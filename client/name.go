@@ -0,0 +1,127 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// RegisterName sends a RegisterName transaction to chain, which registers the name for the
+// target address for the periods, or renews it if the name is owned by the current account.
+// The fee of types.NameFeePerPeriod Particles per period is charged, and the target of an owned
+// name is updated without renewing with 0 periods. An empty target points the name to the current
+// account.
+func RegisterName(name string, target proto.AccountAddress, periods uint32) (txHash hash.Hash, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	if err = types.ValidateName(name); err != nil {
+		return
+	}
+
+	var (
+		signer asymmetric.Signer
+		addr   proto.AccountAddress
+		nonce  interfaces.AccountNonce
+	)
+	if signer, err = getTxSigner(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(signer.PubKey()); err != nil {
+		return
+	}
+	if target == (proto.AccountAddress{}) {
+		target = addr
+	}
+	if nonce, err = nonces.allocate(addr); err != nil {
+		return
+	}
+
+	tx := types.NewRegisterName(&types.RegisterNameHeader{
+		Name:    name,
+		Target:  target,
+		Periods: periods,
+		Fee:     uint64(periods) * types.NameFeePerPeriod,
+		Nonce:   nonce,
+	})
+	if err = signTx(signer, tx); err != nil {
+		nonces.release(addr, nonce)
+		log.WithError(err).Warning("sign failed")
+		return
+	}
+	var (
+		req  = &types.AddTxReq{Tx: tx}
+		resp = new(types.AddTxResp)
+	)
+	if err = requestBP(route.MCCAddTx, req, resp); err != nil {
+		nonces.release(addr, nonce)
+		log.WithError(err).Warning("send tx failed")
+		return
+	}
+
+	txHash = tx.Hash()
+	nonces.commit(addr, txHash)
+	return
+}
+
+// ResolveName returns the record of the registered name, expired names are not resolved.
+func ResolveName(name string) (record *types.NameRecord, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	var (
+		req  = &types.ResolveNameReq{Name: name}
+		resp = new(types.ResolveNameResp)
+	)
+	if err = requestBP(route.MCCResolveName, req, resp); err != nil {
+		err = errors.Wrapf(err, "resolve name %s failed", name)
+		return
+	}
+	return &resp.Record, nil
+}
+
+// ResolveAccount returns the account address of the hex address or the registered name.
+func ResolveAccount(nameOrAddr string) (addr proto.AccountAddress, err error) {
+	// short hex strings are zero padded by the hash decoding, take them as names
+	if len(nameOrAddr) == hash.MaxHashStringSize {
+		var h *hash.Hash
+		if h, err = hash.NewHashFromStr(nameOrAddr); err != nil {
+			return
+		}
+		return proto.AccountAddress(*h), nil
+	}
+	if err = types.ValidateName(nameOrAddr); err != nil {
+		return
+	}
+	var record *types.NameRecord
+	if record, err = ResolveName(nameOrAddr); err != nil {
+		return
+	}
+	return record.Target, nil
+}
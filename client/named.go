@@ -0,0 +1,149 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"database/sql/driver"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// bindNamedArgs rewrites the :name and @name placeholders of the query to positional ones and
+// orders the arguments accordingly, the miners bind the arguments by position only. The query
+// is untouched if none of the arguments is named.
+func bindNamedArgs(query string, args []driver.NamedValue) (
+	bound string, boundArgs []driver.NamedValue, err error,
+) {
+	var (
+		named      map[string]driver.NamedValue
+		positional []driver.NamedValue
+	)
+	for _, arg := range args {
+		if arg.Name == "" {
+			positional = append(positional, arg)
+			continue
+		}
+		if named == nil {
+			named = make(map[string]driver.NamedValue)
+		}
+		named[arg.Name] = arg
+	}
+	if named == nil {
+		return query, args, nil
+	}
+
+	var (
+		buf  strings.Builder
+		last int
+		bind = func(arg driver.NamedValue) {
+			buf.WriteByte('?')
+			boundArgs = append(boundArgs, driver.NamedValue{Ordinal: len(boundArgs) + 1, Value: arg.Value})
+		}
+	)
+	buf.Grow(len(query))
+	for i := 0; i < len(query); {
+		switch ch := query[i]; {
+		case ch == '\'' || ch == '"' || ch == '`' || ch == '[':
+			// quoted literals and identifiers
+			end := ch
+			if ch == '[' {
+				end = ']'
+			}
+			j := i + 1
+			for j < len(query) {
+				if query[j] == end {
+					if j+1 < len(query) && query[j+1] == end && ch != '[' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j < len(query) {
+				j++
+			}
+			buf.WriteString(query[i:j])
+			i = j
+		case ch == '-' && strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = len(query) - i
+			}
+			buf.WriteString(query[i : i+j])
+			i += j
+		case ch == '/' && strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				j = len(query) - i
+			} else {
+				j += 4
+			}
+			buf.WriteString(query[i : i+j])
+			i += j
+		case ch == '?':
+			j := i + 1
+			for j < len(query) && isDigit(query[j]) {
+				j++
+			}
+			// follow the sqlite numbering of the ? and ?NNN placeholders
+			index := last + 1
+			if j > i+1 {
+				index, _ = strconv.Atoi(query[i+1 : j])
+			}
+			if index > last {
+				last = index
+			}
+			if index < 1 || index > len(positional) {
+				err = errors.Wrapf(ErrUnboundParameter, "%s", query[i:j])
+				return
+			}
+			bind(positional[index-1])
+			i = j
+		case (ch == ':' || ch == '@') && i+1 < len(query) && isNameStart(query[i+1]):
+			j := i + 1
+			for j < len(query) && (isNameStart(query[j]) || isDigit(query[j])) {
+				j++
+			}
+			arg, ok := named[query[i+1:j]]
+			if !ok {
+				err = errors.Wrapf(ErrUnboundParameter, "%s", query[i:j])
+				return
+			}
+			bind(arg)
+			i = j
+		case (ch == ':' || ch == '@') && i+1 < len(query) && query[i+1] == ch:
+			// :: casts and @@ system variables
+			buf.WriteString(query[i : i+2])
+			i += 2
+		default:
+			buf.WriteByte(ch)
+			i++
+		}
+	}
+	bound = buf.String()
+	return
+}
+
+func isNameStart(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+}
+
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
@@ -0,0 +1,66 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBindNamedArgs(t *testing.T) {
+	Convey("test bind named arguments", t, func() {
+		values := func(args []driver.NamedValue) (vs []driver.Value) {
+			for i, arg := range args {
+				So(arg.Name, ShouldBeEmpty)
+				So(arg.Ordinal, ShouldEqual, i+1)
+				vs = append(vs, arg.Value)
+			}
+			return
+		}
+
+		Convey("positional arguments should be untouched", func() {
+			args := []driver.NamedValue{{Ordinal: 1, Value: 1}, {Ordinal: 2, Value: 2}}
+			q, bound, err := bindNamedArgs("SELECT ?, :a", args)
+			So(err, ShouldBeNil)
+			So(q, ShouldEqual, "SELECT ?, :a")
+			So(bound, ShouldResemble, args)
+		})
+		Convey("colon and at placeholders should be bound by name", func() {
+			q, bound, err := bindNamedArgs(
+				"INSERT INTO t VALUES (:a, @b, :a, ':c', \"@d\") -- :e\n/* @f */",
+				[]driver.NamedValue{{Name: "b", Value: 2}, {Name: "a", Value: 1}})
+			So(err, ShouldBeNil)
+			So(q, ShouldEqual, "INSERT INTO t VALUES (?, ?, ?, ':c', \"@d\") -- :e\n/* @f */")
+			So(values(bound), ShouldResemble, []driver.Value{1, 2, 1})
+		})
+		Convey("positional and named placeholders should be mixed", func() {
+			q, bound, err := bindNamedArgs("SELECT ?2, ?1, :a, ?", []driver.NamedValue{
+				{Ordinal: 1, Value: 1}, {Ordinal: 2, Value: 2}, {Name: "a", Value: 4}, {Ordinal: 4, Value: 3}})
+			So(err, ShouldBeNil)
+			So(q, ShouldEqual, "SELECT ?, ?, ?, ?")
+			So(values(bound), ShouldResemble, []driver.Value{2, 1, 4, 3})
+		})
+		Convey("unbound placeholders should be rejected", func() {
+			_, _, err := bindNamedArgs("SELECT :a, :b", []driver.NamedValue{{Name: "a", Value: 1}})
+			So(errors.Cause(err), ShouldEqual, ErrUnboundParameter)
+			_, _, err = bindNamedArgs("SELECT :a, ?", []driver.NamedValue{{Name: "a", Value: 1}})
+			So(errors.Cause(err), ShouldEqual, ErrUnboundParameter)
+		})
+	})
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"sync"
+	"time"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+)
+
+// pendingTxTTL is how long a submitted transaction is tracked for settlement, the ones never
+// waited by WaitTxConfirmation are dropped afterwards.
+const pendingTxTTL = 10 * time.Minute
+
+// nonceFetcher fetches the next account nonce known by the block producers.
+type nonceFetcher func(addr proto.AccountAddress) (pi.AccountNonce, error)
+
+// accountNonce is the locally tracked nonce of an account, the lock is held across the nonce
+// fetch so that concurrent allocations of the account wait for it instead of fetching again.
+type accountNonce struct {
+	sync.Mutex
+	next  pi.AccountNonce
+	valid bool
+}
+
+// pendingTx is a submitted transaction waiting for settlement.
+type pendingTx struct {
+	addr  proto.AccountAddress
+	since time.Time
+}
+
+// nonceManager tracks the account nonces of the transactions submitted by this process, so that
+// concurrent submissions of one account get distinct and consecutive nonces. The block producers
+// only count packed transactions in the next account nonce, thus fetching it for each
+// transaction collides with the ones still pending in the tx pool.
+type nonceManager struct {
+	sync.Mutex
+	fetch    nonceFetcher
+	ttl      time.Duration
+	accounts map[proto.AccountAddress]*accountNonce
+	pending  map[hash.Hash]pendingTx
+	swept    time.Time
+}
+
+func newNonceManager(fetch nonceFetcher) *nonceManager {
+	return &nonceManager{
+		fetch:    fetch,
+		ttl:      pendingTxTTL,
+		accounts: make(map[proto.AccountAddress]*accountNonce),
+		pending:  make(map[hash.Hash]pendingTx),
+		swept:    time.Now(),
+	}
+}
+
+var nonces = newNonceManager(getNonce)
+
+// account returns the tracked nonce of the account, it is created on first use.
+func (m *nonceManager) account(addr proto.AccountAddress) (a *accountNonce) {
+	m.Lock()
+	defer m.Unlock()
+	var ok bool
+	if a, ok = m.accounts[addr]; !ok {
+		a = &accountNonce{}
+		m.accounts[addr] = a
+	}
+	return
+}
+
+// allocate returns the next nonce of the account and reserves it for the caller. The nonce is
+// fetched from the block producers for the first allocation of the account, or after it is reset.
+func (m *nonceManager) allocate(addr proto.AccountAddress) (nonce pi.AccountNonce, err error) {
+	var a = m.account(addr)
+	a.Lock()
+	defer a.Unlock()
+	if !a.valid {
+		if a.next, err = m.fetch(addr); err != nil {
+			return
+		}
+		a.valid = true
+	}
+	nonce = a.next
+	a.next++
+	return
+}
+
+// commit records the hash of the transaction submitted with an allocated nonce, so that the
+// account can be reset if the transaction is rejected later.
+func (m *nonceManager) commit(addr proto.AccountAddress, txHash hash.Hash) {
+	m.Lock()
+	defer m.Unlock()
+	var now = time.Now()
+	m.pending[txHash] = pendingTx{addr: addr, since: now}
+	if now.Sub(m.swept) < m.ttl {
+		return
+	}
+	for h, p := range m.pending {
+		if now.Sub(p.since) >= m.ttl {
+			delete(m.pending, h)
+		}
+	}
+	m.swept = now
+}
+
+// release gives back an allocated nonce whose transaction is not submitted. It is rolled back
+// if no later nonce is allocated, otherwise the account is reset to avoid a nonce gap.
+func (m *nonceManager) release(addr proto.AccountAddress, nonce pi.AccountNonce) {
+	var a = m.account(addr)
+	a.Lock()
+	defer a.Unlock()
+	if a.valid && a.next == nonce+1 {
+		a.next = nonce
+		return
+	}
+	a.valid = false
+}
+
+// settle removes the submitted transaction from tracking with its final state. The account is
+// reset if the transaction is rejected or expired, since the later nonces become invalid as well.
+func (m *nonceManager) settle(txHash hash.Hash, state pi.TransactionState) {
+	m.Lock()
+	p, ok := m.pending[txHash]
+	delete(m.pending, txHash)
+	m.Unlock()
+	if !ok {
+		return
+	}
+	switch state {
+	case pi.TransactionStateExpired, pi.TransactionStateNotFound:
+		m.reset(p.addr)
+	}
+}
+
+// reset drops the cached nonce of the account, the next allocation will refetch it.
+func (m *nonceManager) reset(addr proto.AccountAddress) {
+	var a = m.account(addr)
+	a.Lock()
+	defer a.Unlock()
+	a.valid = false
+}
+
+// ResetNonce drops the locally tracked nonce of the account, e.g. after transactions are
+// submitted by another process with the same account. The next transaction will refetch the
+// nonce from the block producers.
+func ResetNonce(addr proto.AccountAddress) {
+	nonces.reset(addr)
+}
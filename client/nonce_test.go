@@ -0,0 +1,155 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestNonceManager(t *testing.T) {
+	Convey("test nonce manager", t, func() {
+		var (
+			addr    = proto.AccountAddress(hash.HashH([]byte("account")))
+			fetched int
+			base    pi.AccountNonce = 10
+			failed  error
+			m       = newNonceManager(func(proto.AccountAddress) (pi.AccountNonce, error) {
+				fetched++
+				return base, failed
+			})
+		)
+		Convey("concurrent allocations should get distinct nonces", func() {
+			var (
+				wg     sync.WaitGroup
+				mu     sync.Mutex
+				allocs = make(map[pi.AccountNonce]bool)
+				errs   int
+			)
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					n, err := m.allocate(addr)
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						errs++
+						return
+					}
+					allocs[n] = true
+				}()
+			}
+			wg.Wait()
+			So(errs, ShouldEqual, 0)
+			So(fetched, ShouldEqual, 1)
+			So(len(allocs), ShouldEqual, 50)
+			for i := pi.AccountNonce(0); i < 50; i++ {
+				So(allocs[base+i], ShouldBeTrue)
+			}
+		})
+		Convey("release should roll back or reset the account", func() {
+			n1, err := m.allocate(addr)
+			So(err, ShouldBeNil)
+			m.release(addr, n1)
+			n2, err := m.allocate(addr)
+			So(err, ShouldBeNil)
+			So(n2, ShouldEqual, n1)
+			So(fetched, ShouldEqual, 1)
+
+			_, err = m.allocate(addr)
+			So(err, ShouldBeNil)
+			m.release(addr, n2)
+			base = 20
+			n3, err := m.allocate(addr)
+			So(err, ShouldBeNil)
+			So(n3, ShouldEqual, 20)
+			So(fetched, ShouldEqual, 2)
+		})
+		Convey("rejected transaction should reset the account", func() {
+			n, err := m.allocate(addr)
+			So(err, ShouldBeNil)
+			txHash := hash.HashH([]byte("tx"))
+			m.commit(addr, txHash)
+			m.settle(txHash, pi.TransactionStateConfirmed)
+			next, err := m.allocate(addr)
+			So(err, ShouldBeNil)
+			So(next, ShouldEqual, n+1)
+
+			m.commit(addr, txHash)
+			m.settle(txHash, pi.TransactionStateExpired)
+			base = 30
+			next, err = m.allocate(addr)
+			So(err, ShouldBeNil)
+			So(next, ShouldEqual, 30)
+			So(fetched, ShouldEqual, 2)
+		})
+		Convey("fetch failure should not be cached", func() {
+			failed = errors.New("bp unreachable")
+			_, err := m.allocate(addr)
+			So(err, ShouldNotBeNil)
+			failed = nil
+			n, err := m.allocate(addr)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, base)
+			So(fetched, ShouldEqual, 2)
+		})
+		Convey("unsettled transactions should be dropped after the ttl", func() {
+			m.ttl = time.Millisecond
+			m.commit(addr, hash.HashH([]byte("tx1")))
+			time.Sleep(2 * m.ttl)
+			m.commit(addr, hash.HashH([]byte("tx2")))
+			So(m.pending, ShouldHaveLength, 1)
+			m.ttl = time.Hour
+			m.commit(addr, hash.HashH([]byte("tx3")))
+			So(m.pending, ShouldHaveLength, 2)
+		})
+		Convey("fetching the nonce should not block other accounts", func() {
+			var (
+				slow     = proto.AccountAddress(hash.HashH([]byte("slow")))
+				fetching = make(chan struct{})
+				unblock  = make(chan struct{})
+				done     = make(chan error, 1)
+			)
+			m = newNonceManager(func(a proto.AccountAddress) (pi.AccountNonce, error) {
+				if a == slow {
+					close(fetching)
+					<-unblock
+				}
+				return base, nil
+			})
+			go func() {
+				_, err := m.allocate(slow)
+				done <- err
+			}()
+			<-fetching
+			n, err := m.allocate(addr)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, base)
+			close(unblock)
+			So(<-done, ShouldBeNil)
+		})
+	})
+}
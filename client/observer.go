@@ -0,0 +1,161 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+)
+
+const (
+	observerQueryPath = "/apiproxy.cqlprotocol/v3/query/"
+	// maxObserverResponseSize limits the size of the result set read from the observer.
+	maxObserverResponseSize = 64 << 20
+)
+
+var (
+	ctxObserverReadKey = "_cql_observer_read"
+
+	observerClient = &http.Client{}
+)
+
+// ObserverRead defines a read served by the materialized replica of the observer instead of the
+// miners, it is meant for the heavy analytical queries over historical data.
+type ObserverRead struct {
+	// MaxStaleness rejects the read with ErrObserverStale if the last block materialized by the
+	// observer is produced earlier than it, 0 to accept any staleness.
+	MaxStaleness time.Duration
+
+	// Count, Height and Timestamp describe the last block materialized by the observer when the
+	// read is served, they are set after the read succeeds.
+	Count     int32
+	Height    int32
+	Timestamp time.Time
+}
+
+// WithObserverRead returns a context which directs the reads to the observer configured by the
+// Observer option of the DSN. Writes and the reads in transactions are not affected.
+//
+// Note that the read is filled with the replica state after each read, so it should not be
+// shared by concurrent queries.
+func WithObserverRead(ctx context.Context, read *ObserverRead) context.Context {
+	return context.WithValue(ctx, &ctxObserverReadKey, read)
+}
+
+func getObserverRead(ctx context.Context) (read *ObserverRead, ok bool) {
+	read, ok = ctx.Value(&ctxObserverReadKey).(*ObserverRead)
+	if read == nil {
+		ok = false
+	}
+	return
+}
+
+// queryObserver sends the read query to the observer.
+func (c *conn) queryObserver(
+	ctx context.Context, sq *types.Query, read *ObserverRead) (rows driver.Rows, err error,
+) {
+	if c.observer == "" {
+		err = ErrNoObserver
+		return
+	}
+
+	var oreq = &types.ObserverQueryReq{
+		Header: types.SignedObserverQueryHeader{
+			ObserverQueryHeader: types.ObserverQueryHeader{
+				DatabaseID:   c.dbID,
+				Queries:      []types.Query{*sq},
+				MaxStaleness: read.MaxStaleness,
+				Timestamp:    getLocalTime(),
+			},
+		},
+	}
+	if err = oreq.Header.Sign(c.privKey); err != nil {
+		return
+	}
+	buf, err := utils.EncodeMsgPack(oreq)
+	if err != nil {
+		return
+	}
+	var (
+		u   = strings.TrimSuffix(c.observer, "/") + observerQueryPath + url.PathEscape(string(c.dbID))
+		req *http.Request
+	)
+	if req, err = http.NewRequest(http.MethodPost, u, buf); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-msgpack")
+
+	resp, err := observerClient.Do(req.WithContext(ctx))
+	if err != nil {
+		err = errors.Wrap(err, "query observer failed")
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxObserverResponseSize))
+	if err != nil {
+		err = errors.Wrap(err, "read observer response failed")
+		return
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusPreconditionFailed:
+		err = errors.Wrap(ErrObserverStale, observerErrorMessage(body))
+		return
+	case http.StatusForbidden:
+		err = errors.Wrap(ErrObserverPermissionDenied, observerErrorMessage(body))
+		return
+	default:
+		err = errors.Errorf("query observer failed with status %d: %s",
+			resp.StatusCode, observerErrorMessage(body))
+		return
+	}
+
+	var res types.ObserverQueryResp
+	if err = utils.DecodeMsgPack(body, &res); err != nil {
+		err = errors.Wrap(err, "decode observer response failed")
+		return
+	}
+	read.Count, read.Height, read.Timestamp = res.Count, res.Height, res.Timestamp
+
+	rs := newRows(&types.Response{Payload: res.Payload})
+	rs.times = &c.times
+	rows = rs
+	return
+}
+
+// observerErrorMessage extracts the error message from the json response of the observer.
+func observerErrorMessage(body []byte) string {
+	var res struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil || res.Status == "" {
+		return strings.TrimSpace(string(body))
+	}
+	return res.Status
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+)
+
+func TestObserverRead(t *testing.T) {
+	Convey("test observer read", t, func() {
+		var stale bool
+		srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != observerQueryPath+"db" {
+				rw.WriteHeader(http.StatusNotFound)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			var req types.ObserverQueryReq
+			if err := utils.DecodeMsgPack(body, &req); err != nil || len(req.Header.Queries) != 1 {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if err := req.Header.Verify(); err != nil || req.Header.DatabaseID != "db" {
+				rw.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if stale {
+				rw.WriteHeader(http.StatusPreconditionFailed)
+				_, _ = rw.Write([]byte(`{"status":"replica stale","success":false}`))
+				return
+			}
+			buf, _ := utils.EncodeMsgPack(&types.ObserverQueryResp{
+				Count:  3,
+				Height: 5,
+				Payload: types.ResponsePayload{
+					Columns:   []string{"v"},
+					DeclTypes: []string{"INTEGER"},
+					Rows:      []types.ResponseRow{{Values: []interface{}{int64(1)}}},
+				},
+			})
+			_, _ = rw.Write(buf.Bytes())
+		}))
+		defer srv.Close()
+
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		c := &conn{dbID: "db", observer: srv.URL + "/", privKey: privKey}
+		read := &ObserverRead{MaxStaleness: time.Minute}
+		ctx := WithObserverRead(context.Background(), read)
+
+		rows, err := c.QueryContext(ctx, "SELECT 1", nil)
+		So(err, ShouldBeNil)
+		So(rows.Columns(), ShouldResemble, []string{"v"})
+		dest := make([]driver.Value, 1)
+		So(rows.Next(dest), ShouldBeNil)
+		So(fmt.Sprint(dest[0]), ShouldEqual, "1")
+		So(read.Count, ShouldEqual, 3)
+		So(read.Height, ShouldEqual, 5)
+
+		stale = true
+		_, err = c.QueryContext(ctx, "SELECT 1", nil)
+		So(errors.Cause(err), ShouldEqual, ErrObserverStale)
+
+		c.observer = ""
+		_, err = c.QueryContext(ctx, "SELECT 1", nil)
+		So(err, ShouldEqual, ErrNoObserver)
+	})
+}
@@ -0,0 +1,294 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+)
+
+// OfflineTx is a transaction carried to an air-gapped machine to be signed and carried back to be
+// submitted, it is encoded in JSON:
+//
+//	tx := types.NewTransfer(&types.TransferHeader{...})
+//	otx, err := client.PrepareTx(tx)            // online, without the private key
+//	err = otx.Sign(privateKey)                   // air-gapped
+//	txHash, err := client.SubmitTx(otx)          // online
+//
+// The hash is always recomputed from the transaction body before signing and submitting, the
+// Hash field is only for the signer to cross-check with other tools.
+//
+// The transaction of a multi-signature account is prepared by PrepareMultiSigTx instead, it is
+// carried to the members in turn to be signed, and submitted once enough members signed it. The
+// member signatures are kept in the transaction body.
+type OfflineTx struct {
+	Type      string                `json:"type"`
+	Tx        pi.TransactionWrapper `json:"tx"`
+	Hash      hash.Hash             `json:"hash"`
+	Signee    string                `json:"signee,omitempty"`    // hex encoded public key
+	Signature string                `json:"signature,omitempty"` // hex encoded signature
+}
+
+// signatureSetter is implemented by the transactions embedding DefaultHashSignVerifierImpl.
+type signatureSetter interface {
+	SetSignature(signee *asymmetric.PublicKey, sig *asymmetric.Signature)
+}
+
+// NewTx builds a transaction of the registered type from its JSON body, the timestamp is set to
+// now if not present.
+func NewTx(txType pi.TransactionType, body []byte) (tx pi.Transaction, err error) {
+	if tx, err = pi.NewTransaction(txType); err != nil {
+		return
+	}
+	if err = json.Unmarshal(body, tx); err != nil {
+		err = errors.Wrapf(err, "decode %s transaction failed", txType)
+		return
+	}
+	if m, ok := tx.(interface {
+		pi.ContainsTransactionTypeMixin
+		SetTimestamp(time.Time)
+	}); ok {
+		m.SetTransactionType(txType)
+		if tx.GetTimestamp().IsZero() {
+			m.SetTimestamp(time.Now().UTC())
+		}
+	}
+	return
+}
+
+// NextNonce returns the next nonce of the account to build a transaction with.
+func NextNonce(addr proto.AccountAddress) (nonce pi.AccountNonce, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	return getNonce(addr)
+}
+
+// txSigningHash computes the canonical signing hash of the transaction. Transactions compute the
+// hash of their own signed fields on signing, so the transaction is signed with an ephemeral key
+// and the signature is cleared afterwards.
+func txSigningHash(tx pi.Transaction) (h hash.Hash, err error) {
+	setter, ok := tx.(signatureSetter)
+	if !ok {
+		err = errors.Wrapf(ErrOfflineSignNotSupported, "transaction type %s", tx.GetTransactionType())
+		return
+	}
+	var ephemeral *asymmetric.PrivateKey
+	if ephemeral, _, err = asymmetric.GenSecp256k1KeyPair(); err != nil {
+		return
+	}
+	if err = tx.Sign(ephemeral); err != nil {
+		return
+	}
+	setter.SetSignature(nil, nil)
+	return tx.Hash(), nil
+}
+
+// PrepareTx prepares the transaction to be signed offline, the nonce of the transaction should be
+// set already, e.g. by NextNonce.
+func PrepareTx(tx pi.Transaction) (otx *OfflineTx, err error) {
+	var h hash.Hash
+	if h, err = txSigningHash(tx); err != nil {
+		return
+	}
+	otx = &OfflineTx{
+		Type: tx.GetTransactionType().String(),
+		Tx:   pi.TransactionWrapper{Transaction: tx},
+		Hash: h,
+	}
+	return
+}
+
+// PrepareMultiSigTx prepares the transaction of the multi-signature account to be signed offline
+// by the members, the nonce of the transaction should be the next nonce of the account.
+func PrepareMultiSigTx(policy *types.MultiSigPolicy, tx pi.Transaction) (otx *OfflineTx, err error) {
+	var ms *types.MultiSig
+	if ms, err = types.NewMultiSig(policy, tx); err != nil {
+		return
+	}
+	otx = &OfflineTx{
+		Type: ms.GetTransactionType().String(),
+		Tx:   pi.TransactionWrapper{Transaction: ms},
+		Hash: ms.SigningHash(),
+	}
+	return
+}
+
+// multiSig returns the multi-signature transaction if the offline transaction is one.
+func (otx *OfflineTx) multiSig() (ms *types.MultiSig, ok bool) {
+	ms, ok = otx.Tx.Transaction.(*types.MultiSig)
+	return
+}
+
+// checkHash recomputes the signing hash from the transaction body.
+func (otx *OfflineTx) checkHash() (h hash.Hash, err error) {
+	if otx.Tx.Transaction == nil {
+		err = errors.Wrap(ErrInvalidOfflineTx, "empty transaction")
+		return
+	}
+	var (
+		tx     = otx.Tx.Transaction
+		ms, ok = otx.multiSig()
+	)
+	if ok {
+		// the members sign the wrapped transaction bound to the multi-signature account
+		if ms.Tx.Transaction == nil {
+			err = errors.Wrap(ErrInvalidOfflineTx, "empty multi-signature transaction")
+			return
+		}
+		tx = ms.Tx.Transaction
+	}
+	if h, err = txSigningHash(tx); err != nil {
+		return
+	}
+	if ok {
+		h = ms.SigningHash()
+	}
+	if !h.IsEqual(&otx.Hash) {
+		err = errors.Wrapf(ErrInvalidOfflineTx, "hash mismatch, computed %s vs %s", h, otx.Hash)
+	}
+	return
+}
+
+// Sign signs the transaction with the signer, e.g. a private key or a hardware wallet.
+func (otx *OfflineTx) Sign(signer asymmetric.Signer) (err error) {
+	var (
+		h   hash.Hash
+		sig *asymmetric.Signature
+	)
+	if ts, ok := signer.(TxSigner); ok {
+		return ts.SignTx(otx)
+	}
+	if h, err = otx.checkHash(); err != nil {
+		return
+	}
+	// the offline transactions are signed within the spending policy of the signer as well
+	var revert func()
+	if revert, err = checkSpending(signer.PubKey(), otx.Tx.Transaction); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			revert()
+		}
+	}()
+	if ms, ok := otx.multiSig(); ok {
+		return ms.SignWith(signer)
+	}
+	if sig, err = signer.Sign(h[:]); err != nil {
+		return
+	}
+	return otx.AttachSignature(signer.PubKey(), sig)
+}
+
+// AttachSignature attaches the signature of the transaction hash produced by an external tool,
+// the signature is added to the member signatures of the multi-signature transaction.
+func (otx *OfflineTx) AttachSignature(signee *asymmetric.PublicKey, sig *asymmetric.Signature) (err error) {
+	if ms, ok := otx.multiSig(); ok {
+		if _, err = otx.checkHash(); err != nil {
+			return
+		}
+		if err = ms.AttachSignature(signee, sig); err != nil {
+			err = errors.Wrap(ErrInvalidOfflineTx, err.Error())
+		}
+		return
+	}
+	if signee == nil || sig == nil || !sig.Verify(otx.Hash[:], signee) {
+		return errors.Wrap(ErrInvalidOfflineTx, "signature does not match transaction hash")
+	}
+	otx.Signee = hex.EncodeToString(signee.Serialize())
+	otx.Signature = hex.EncodeToString(sig.Serialize())
+	return
+}
+
+// SignedTx returns the signed transaction after verifying its hash and signature.
+func (otx *OfflineTx) SignedTx() (tx pi.Transaction, err error) {
+	var (
+		buf    []byte
+		signee *asymmetric.PublicKey
+		sig    *asymmetric.Signature
+	)
+	if ms, ok := otx.multiSig(); ok {
+		if _, err = otx.checkHash(); err != nil {
+			return
+		}
+		if err = ms.Verify(); err != nil {
+			return
+		}
+		tx = ms
+		return
+	}
+	if otx.Signee == "" || otx.Signature == "" {
+		err = errors.Wrap(ErrInvalidOfflineTx, "transaction is not signed")
+		return
+	}
+	if _, err = otx.checkHash(); err != nil {
+		return
+	}
+	if buf, err = hex.DecodeString(otx.Signee); err != nil {
+		return
+	}
+	if signee, err = asymmetric.ParsePubKey(buf); err != nil {
+		return
+	}
+	if buf, err = hex.DecodeString(otx.Signature); err != nil {
+		return
+	}
+	if sig, err = asymmetric.ParseSignature(buf); err != nil {
+		return
+	}
+	tx = otx.Tx.Transaction
+	tx.(signatureSetter).SetSignature(signee, sig)
+	if err = tx.Verify(); err != nil {
+		tx.(signatureSetter).SetSignature(nil, nil)
+		tx = nil
+	}
+	return
+}
+
+// SubmitTx submits the transaction signed offline to block producers.
+func SubmitTx(otx *OfflineTx) (txHash hash.Hash, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	var tx pi.Transaction
+	if tx, err = otx.SignedTx(); err != nil {
+		return
+	}
+	var (
+		req  = &types.AddTxReq{Tx: tx}
+		resp = &types.AddTxResp{}
+	)
+	if err = requestBP(route.MCCAddTx, req, resp); err != nil {
+		err = errors.Wrap(err, "send tx failed")
+		return
+	}
+	return tx.Hash(), nil
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestOfflineTx(t *testing.T) {
+	Convey("test offline transaction signing", t, func() {
+		priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		sender, err := crypto.PubKeyHash(pub)
+		So(err, ShouldBeNil)
+
+		txType, err := pi.ParseTransactionType("transfer")
+		So(err, ShouldBeNil)
+		So(txType, ShouldEqual, pi.TransactionTypeTransfer)
+		_, err = pi.ParseTransactionType("unknown")
+		So(err, ShouldNotBeNil)
+
+		body, err := json.Marshal(map[string]interface{}{
+			"Sender":   sender,
+			"Receiver": sender,
+			"Nonce":    3,
+			"Amount":   100,
+		})
+		So(err, ShouldBeNil)
+		tx, err := NewTx(txType, body)
+		So(err, ShouldBeNil)
+		So(tx.GetTransactionType(), ShouldEqual, pi.TransactionTypeTransfer)
+		So(tx.GetAccountNonce(), ShouldEqual, 3)
+		So(tx.GetTimestamp().IsZero(), ShouldBeFalse)
+
+		// carry the prepared transaction to the air-gapped signer
+		otx, err := PrepareTx(tx)
+		So(err, ShouldBeNil)
+		So(otx.Type, ShouldEqual, "Transfer")
+		prepared, err := json.Marshal(otx)
+		So(err, ShouldBeNil)
+
+		var offline OfflineTx
+		So(json.Unmarshal(prepared, &offline), ShouldBeNil)
+		So(offline.Hash, ShouldResemble, otx.Hash)
+		_, err = offline.SignedTx()
+		So(errors.Cause(err), ShouldEqual, ErrInvalidOfflineTx)
+		So(offline.Sign(priv), ShouldBeNil)
+		signed, err := json.Marshal(&offline)
+		So(err, ShouldBeNil)
+
+		// carry the signed transaction back to be submitted
+		var online OfflineTx
+		So(json.Unmarshal(signed, &online), ShouldBeNil)
+		stx, err := online.SignedTx()
+		So(err, ShouldBeNil)
+		So(stx.Verify(), ShouldBeNil)
+		So(stx.Hash(), ShouldResemble, otx.Hash)
+		So(stx.(*types.Transfer).Amount, ShouldEqual, 100)
+
+		// tampered transaction body
+		var tampered OfflineTx
+		So(json.Unmarshal(signed, &tampered), ShouldBeNil)
+		tampered.Tx.Transaction.(*types.Transfer).Amount = 1000000
+		_, err = tampered.SignedTx()
+		So(errors.Cause(err), ShouldEqual, ErrInvalidOfflineTx)
+
+		// signature of another hash
+		other, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		sig, err := other.Sign(otx.Hash[:])
+		So(err, ShouldBeNil)
+		err = online.AttachSignature(pub, sig)
+		So(errors.Cause(err), ShouldEqual, ErrInvalidOfflineTx)
+	})
+}
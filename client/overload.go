@@ -0,0 +1,40 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+const overloadedMessage = "miner overloaded"
+
+var retryAfterRe = regexp.MustCompile(`retry after ([0-9.]+[a-zµ]+)`)
+
+// RetryAfter reports whether the query is shed by an overloaded miner, and returns the retry
+// interval suggested by the miner. Reads are shed before writes, and the replication between
+// miners is never shed.
+func RetryAfter(err error) (d time.Duration, ok bool) {
+	if err == nil || !strings.Contains(err.Error(), overloadedMessage) {
+		return
+	}
+	ok = true
+	if m := retryAfterRe.FindStringSubmatch(err.Error()); m != nil {
+		d, _ = time.ParseDuration(m[1])
+	}
+	return
+}
@@ -0,0 +1,40 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRetryAfter(t *testing.T) {
+	Convey("test retry after of shed queries", t, func() {
+		d, ok := RetryAfter(nil)
+		So(ok, ShouldBeFalse)
+		d, ok = RetryAfter(errors.New("permission deny"))
+		So(ok, ShouldBeFalse)
+		d, ok = RetryAfter(errors.New(
+			"read request shed at 60 in-flight, retry after 200ms: miner overloaded"))
+		So(ok, ShouldBeTrue)
+		So(d, ShouldEqual, 200*time.Millisecond)
+		d, ok = RetryAfter(errors.New("miner overloaded"))
+		So(ok, ShouldBeTrue)
+		So(d, ShouldEqual, 0)
+	})
+}
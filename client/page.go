@@ -0,0 +1,70 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+var (
+	ctxPageKey = "_cql_page"
+)
+
+// page holds the pagination parameters of a read query and the continuation token returned by
+// the miner.
+type page struct {
+	size  uint32
+	token []byte
+	close bool
+	next  atomic.Value
+}
+
+// WithPage returns a context which requests a server-driven paginated read, the miner returns at
+// most size rows of the query. The first page is requested with an empty token, the following
+// pages are requested with the token returned by GetNextPage of the previous page context. All
+// the pages are read from the snapshot of the first page.
+//
+// Note that the cursor lives on the serving miner, so the following pages must be requested on
+// the same connection.
+func WithPage(ctx context.Context, size uint32, token []byte) context.Context {
+	var p = &page{
+		size:  size,
+		token: token,
+	}
+	p.next.Store([]byte(nil))
+	return context.WithValue(ctx, &ctxPageKey, p)
+}
+
+// GetNextPage tries to get the continuation token of the page from context, ok is false if the
+// context has no pagination or the result set is exhausted.
+func GetNextPage(ctx context.Context) (token []byte, ok bool) {
+	p, ok := ctx.Value(&ctxPageKey).(*page)
+	if !ok {
+		return
+	}
+	token, _ = p.next.Load().([]byte)
+	ok = len(token) > 0
+	return
+}
+
+// withPageClose returns a context which releases the cursor of the token on the miner.
+func withPageClose(ctx context.Context, size uint32, token []byte) context.Context {
+	ctx = WithPage(ctx, size, token)
+	ctx.Value(&ctxPageKey).(*page).close = true
+	return ctx
+}
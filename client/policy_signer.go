@@ -0,0 +1,310 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/proto"
+)
+
+const (
+	// maxSignRequestSize is the max size of the offline transaction sent to the policy signer.
+	maxSignRequestSize = 1 << 20
+
+	remoteSignerTimeout = 30 * time.Second
+)
+
+// TxSigner defines a signer backend which signs the whole transaction instead of its hash, so
+// that it could inspect the transaction and enforce its own policy, e.g. a RemoteSigner.
+type TxSigner interface {
+	asymmetric.Signer
+	// SignTx signs the offline transaction, the hash is recomputed from the transaction body.
+	SignTx(otx *OfflineTx) error
+}
+
+// PolicySigner is a signer backend enforcing the spending policy of its key with a persisted
+// ledger. It should run in a separate process holding the private key, e.g. "cql signer", and
+// serve the clients through its Handler, so that the clients never hold the key and could not
+// sign around the policy.
+type PolicySigner struct {
+	signer   asymmetric.Signer
+	addr     proto.AccountAddress
+	policy   conf.SpendingPolicy
+	approver SpendApprover
+	ledger   *spendLedger
+}
+
+// NewPolicySigner returns the policy signer of the key, the spending is persisted to the ledger
+// file. The transactions above the approval threshold of the policy are refused if the approver
+// is nil.
+func NewPolicySigner(
+	signer asymmetric.Signer, policy *conf.SpendingPolicy, ledgerFile string, approver SpendApprover,
+) (s *PolicySigner, err error) {
+	if ledgerFile == "" {
+		err = errors.New("policy signer requires a spending ledger file")
+		return
+	}
+	var instance = &PolicySigner{
+		signer:   signer,
+		policy:   *policy,
+		approver: approver,
+	}
+	if instance.addr, err = crypto.PubKeyHash(signer.PubKey()); err != nil {
+		return
+	}
+	if policy.Account != (proto.AccountAddress{}) && policy.Account != instance.addr {
+		err = errors.Errorf("spending policy of %s does not match the signer account %s",
+			policy.Account, instance.addr)
+		return
+	}
+	instance.policy.Account = instance.addr
+	if instance.ledger, err = newSpendLedger(ledgerFile); err != nil {
+		return
+	}
+	s = instance
+	return
+}
+
+// PubKey implements asymmetric.Signer.PubKey.
+func (s *PolicySigner) PubKey() *asymmetric.PublicKey {
+	return s.signer.PubKey()
+}
+
+// Sign implements asymmetric.Signer.Sign, a bare hash is never signed as the policy could not be
+// checked on it.
+func (s *PolicySigner) Sign(hash []byte) (*asymmetric.Signature, error) {
+	return nil, ErrTxSignerRequired
+}
+
+// SignTx implements TxSigner.SignTx, the spending of the transaction is recorded in the ledger
+// before it's signed.
+func (s *PolicySigner) SignTx(otx *OfflineTx) (err error) {
+	if _, err = otx.checkHash(); err != nil {
+		return
+	}
+	var revert func()
+	if revert, err = enforceSpending(
+		&s.policy, s.approver, s.ledger, s.addr, otx.Tx.Transaction,
+	); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			revert()
+		}
+	}()
+	if ms, ok := otx.multiSig(); ok {
+		return ms.SignWith(s.signer)
+	}
+	var sig *asymmetric.Signature
+	if sig, err = s.signer.Sign(otx.Hash[:]); err != nil {
+		return
+	}
+	return otx.AttachSignature(s.signer.PubKey(), sig)
+}
+
+// Handler returns the http api of the signer authenticated by the bearer token in the
+// Authorization header, all requests are refused if the token is empty. GET /pubkey returns the
+// hex public key of the signer, POST /sign signs the JSON encoded OfflineTx in the body and
+// returns it signed.
+func (s *PolicySigner) Handler(token string) http.Handler {
+	var mux = http.NewServeMux()
+	mux.HandleFunc("/pubkey", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeSignerResponse(rw, http.StatusOK, &signerResponse{
+			PubKey: hex.EncodeToString(s.PubKey().Serialize()),
+		})
+	})
+	mux.HandleFunc("/sign", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var otx = &OfflineTx{}
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxSignRequestSize)).Decode(otx); err != nil {
+			writeSignerResponse(rw, http.StatusBadRequest, &signerResponse{Error: err.Error()})
+			return
+		}
+		if err := s.SignTx(otx); err != nil {
+			writeSignerResponse(rw, http.StatusForbidden, &signerResponse{Error: err.Error()})
+			return
+		}
+		writeSignerResponse(rw, http.StatusOK, &signerResponse{Tx: otx})
+	})
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var auth = r.Header.Get("Authorization")
+		if token == "" || !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(rw, r)
+	})
+}
+
+// signerResponse is the JSON response of the policy signer api.
+type signerResponse struct {
+	PubKey string     `json:"pubkey,omitempty"`
+	Tx     *OfflineTx `json:"tx,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+func writeSignerResponse(rw http.ResponseWriter, status int, resp *signerResponse) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(resp)
+}
+
+// RemoteSigner is the TxSigner of a PolicySigner served by another process, set it with
+// SetTxSigner to sign the transactions of the client.
+type RemoteSigner struct {
+	url    string
+	token  string
+	client *http.Client
+	pubKey *asymmetric.PublicKey
+}
+
+// NewRemoteSigner connects to the policy signer at url and loads its public key.
+func NewRemoteSigner(url, token string) (s *RemoteSigner, err error) {
+	var (
+		instance = &RemoteSigner{
+			url:    strings.TrimRight(url, "/"),
+			token:  token,
+			client: &http.Client{Timeout: remoteSignerTimeout},
+		}
+		resp = &signerResponse{}
+		buf  []byte
+	)
+	if err = instance.call(http.MethodGet, "/pubkey", nil, resp); err != nil {
+		return
+	}
+	if buf, err = hex.DecodeString(resp.PubKey); err != nil {
+		return
+	}
+	if instance.pubKey, err = asymmetric.ParsePubKey(buf); err != nil {
+		err = errors.Wrap(err, "parse remote signer public key failed")
+		return
+	}
+	s = instance
+	return
+}
+
+// PubKey implements asymmetric.Signer.PubKey.
+func (s *RemoteSigner) PubKey() *asymmetric.PublicKey {
+	return s.pubKey
+}
+
+// Sign implements asymmetric.Signer.Sign, the policy signer never signs a bare hash.
+func (s *RemoteSigner) Sign(hash []byte) (*asymmetric.Signature, error) {
+	return nil, ErrTxSignerRequired
+}
+
+// SignTx implements TxSigner.SignTx, the signature returned by the policy signer is verified
+// against the locally computed hash.
+func (s *RemoteSigner) SignTx(otx *OfflineTx) (err error) {
+	var resp = &signerResponse{}
+	if err = s.call(http.MethodPost, "/sign", otx, resp); err != nil {
+		return
+	}
+	var signed = resp.Tx
+	if signed == nil || !signed.Hash.IsEqual(&otx.Hash) {
+		return errors.Wrap(ErrInvalidOfflineTx, "remote signer returned another transaction")
+	}
+	if _, ok := otx.multiSig(); ok {
+		// the member signature is added to the transaction body
+		if _, err = signed.checkHash(); err != nil {
+			return
+		}
+		if _, ok = signed.multiSig(); !ok {
+			return errors.Wrap(ErrInvalidOfflineTx, "remote signer returned another transaction")
+		}
+		otx.Tx = signed.Tx
+		return
+	}
+	var (
+		buf    []byte
+		signee *asymmetric.PublicKey
+		sig    *asymmetric.Signature
+	)
+	if buf, err = hex.DecodeString(signed.Signee); err != nil {
+		return
+	}
+	if signee, err = asymmetric.ParsePubKey(buf); err != nil {
+		return
+	}
+	if buf, err = hex.DecodeString(signed.Signature); err != nil {
+		return
+	}
+	if sig, err = asymmetric.ParseSignature(buf); err != nil {
+		return
+	}
+	return otx.AttachSignature(signee, sig)
+}
+
+func (s *RemoteSigner) call(method, path string, in interface{}, out *signerResponse) (err error) {
+	var body io.Reader
+	if in != nil {
+		var data []byte
+		if data, err = json.Marshal(in); err != nil {
+			return
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, s.url+path, body)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSignRequestSize))
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, out); err != nil && resp.StatusCode == http.StatusOK {
+		return errors.Wrap(err, "decode remote signer response failed")
+	}
+	if resp.StatusCode != http.StatusOK {
+		var msg = out.Error
+		if msg == "" {
+			msg = strings.TrimSpace(string(data))
+		}
+		return errors.Wrapf(ErrRemoteSignRejected, "%s: %s", resp.Status, msg)
+	}
+	return nil
+}
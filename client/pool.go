@@ -0,0 +1,59 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync/atomic"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+// OpenDB opens the database of the DSN with the connection pool limits of the DSN, i.e.
+// max_open and max_idle. The pooled connections are probed in background and discarded once
+// the leader fails the health checks, see HealthCheckInterval.
+func OpenDB(dsn string) (db *sql.DB, err error) {
+	var cfg *Config
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	db = sql.OpenDB(NewConnector(cfg))
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	return
+}
+
+// ResetSession implements driver.SessionResetter, the connection is discarded by the pool if
+// its leader fails the health checks, so that the next connection is dialed to the refreshed
+// peers of the database. The failed followers are replaced by the next query instead.
+func (c *conn) ResetSession(ctx context.Context) error {
+	if atomic.LoadInt32(&c.closed) != 0 {
+		return driver.ErrBadConn
+	}
+	if leader, _ := c.servingPConns(); leader != nil && leader.ackCh != nil {
+		if _, broken := peerHealth.state(proto.NodeID(leader.pCaller.Target())); broken {
+			peerList.Delete(c.dbID)
+			return driver.ErrBadConn
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+)
+
+// PromoteStandby promotes the standby miner of the database, which receives the snapshots
+// shipped by the database miners periodically, to serve the database alone. It's the disaster
+// recovery path if the whole primary region is lost, the writes committed after the latest
+// shipped snapshot are lost. The standby designated in the database meta is used if standby is
+// empty. Only the database owner is allowed to promote.
+//
+// The promotion is not recorded on chain, the owner should update the miners of the database
+// on chain to include the standby miner afterwards, so that the clients are routed to it.
+func PromoteStandby(ctx context.Context, dsn string, standby proto.NodeID) (info *types.SnapshotInfo, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	var cfg *Config
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	dbID := proto.DatabaseID(cfg.DatabaseID)
+	if standby == "" {
+		var (
+			req  = &types.QuerySQLChainProfileReq{DBID: dbID}
+			resp = &types.QuerySQLChainProfileResp{}
+		)
+		if err = mux.RequestBP(route.MCCQuerySQLChainProfile.String(), req, resp); err != nil {
+			err = errors.WithMessage(err, "query sqlchain profile failed")
+			return
+		}
+		if standby = resp.Profile.Meta.StandbyNode; standby == "" {
+			err = errors.Errorf("no standby miner designated for database %s", dbID)
+			return
+		}
+	}
+
+	privKey, err := kms.GetLocalPrivateKey()
+	if err != nil {
+		return
+	}
+	req := &types.PromoteStandbyReq{
+		Header: types.SignedPromoteStandbyHeader{
+			PromoteStandbyHeader: types.PromoteStandbyHeader{
+				DatabaseID: dbID,
+				Timestamp:  getLocalTime(),
+			},
+		},
+	}
+	if err = req.Header.Sign(privKey); err != nil {
+		return
+	}
+	resp := &types.PromoteStandbyResp{}
+	if err = mux.NewCaller().CallNodeWithContext(
+		ctx, standby, route.DBSPromoteStandby.String(), req, resp,
+	); err != nil {
+		err = errors.Wrapf(err, "promote standby miner %s failed", standby)
+		return
+	}
+	// drop the cached peers of the lost replication group
+	peerList.Delete(dbID)
+	info = &resp.Info
+	return
+}
@@ -20,7 +20,14 @@ import (
 	"context"
 	"sync/atomic"
 
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
 	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
 )
 
 var (
@@ -30,6 +37,8 @@ var (
 // Receipt defines a receipt of SQLess query request.
 type Receipt struct {
 	RequestHash hash.Hash
+	// Signed is the receipt signed by the miner accepted the write query, nil for reads.
+	Signed *types.SignedReceiptHeader
 }
 
 // WithReceipt returns a context who holds a *atomic.Value. A *Receipt will be set to this value
@@ -61,3 +70,87 @@ func GetReceipt(ctx context.Context) (rec *Receipt, ok bool) {
 	}
 	return
 }
+
+// VerifyReceipt verifies the signed receipt of a write query against the sqlchain data, and
+// returns the proof that the write is packed in a block signed by a miner of the database. The
+// proof is not available until the block including the write is produced, retry later if
+// the miners report the response is not packed yet.
+func VerifyReceipt(ctx context.Context, rec *Receipt) (proof *types.ReceiptProof, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	if rec == nil || rec.Signed == nil {
+		err = errors.Wrap(ErrInvalidReceipt, "no signed receipt")
+		return
+	}
+	var receipt = &rec.Signed.ReceiptHeader
+	if err = rec.Signed.Verify(); err != nil {
+		err = errors.Wrapf(ErrInvalidReceipt, "verify receipt signature failed: %v", err)
+		return
+	}
+	if !receipt.RequestHash.IsEqual(&rec.RequestHash) {
+		err = errors.Wrap(ErrInvalidReceipt, "request hash not match")
+		return
+	}
+
+	var info *sqlchainAuditInfo
+	if info, err = loadAuditInfo(receipt.DatabaseID); err != nil {
+		return
+	}
+	if err = checkMinerKey(info.miners, receipt.NodeID, rec.Signed.Signee); err != nil {
+		return
+	}
+
+	// ask the signing miner first, the others have the same blocks
+	var nodes = []proto.NodeID{receipt.NodeID}
+	for _, node := range info.nodes {
+		if node != receipt.NodeID {
+			nodes = append(nodes, node)
+		}
+	}
+	var (
+		proofReq = &types.QueryReceiptProofReq{
+			DatabaseID:   receipt.DatabaseID,
+			ResponseHash: receipt.ResponseHash,
+			Height:       receipt.Height,
+		}
+		proofResp = &types.QueryReceiptProofResp{}
+	)
+	if err = callMiners(ctx, nodes, route.DBSQueryReceiptProof, proofReq, proofResp); err != nil {
+		return
+	}
+	proof = &proofResp.Proof
+
+	if err = proof.Verify(receipt); err != nil {
+		err = errors.Wrapf(ErrInvalidReceipt, "verify receipt proof failed: %v", err)
+		return
+	}
+	if !proof.Block.GenesisHash.IsEqual(info.genesis.BlockHash()) {
+		err = errors.Wrap(ErrInvalidReceipt, "block is not on the sqlchain")
+		return
+	}
+	if err = checkMinerKey(info.miners, proof.Block.Producer, proof.Block.HSV.Signee); err != nil {
+		return
+	}
+	return
+}
+
+// checkMinerKey checks that the node is a miner of the database and signs with the public key.
+func checkMinerKey(miners map[proto.NodeID]bool, id proto.NodeID, signee *asymmetric.PublicKey) (err error) {
+	if !miners[id] {
+		return errors.Wrapf(ErrInvalidReceipt, "%s is not a miner of the database", id)
+	}
+	rawID := id.ToRawNodeID()
+	if rawID == nil {
+		return errors.Wrapf(ErrInvalidReceipt, "invalid node id %s", id)
+	}
+	var node *proto.Node
+	if node, err = mux.GetNodeInfo(rawID); err != nil {
+		return errors.WithMessage(err, "get miner node info failed")
+	}
+	if node.PublicKey == nil || !node.PublicKey.IsEqual(signee) {
+		return errors.Wrapf(ErrInvalidReceipt, "%s public key not match", id)
+	}
+	return
+}
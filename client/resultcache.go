@@ -0,0 +1,324 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SQLess/sqlparser"
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultResultCacheSize is the default max read results cached by the driver.
+	DefaultResultCacheSize = 1024
+	// DefaultResultCacheCheck is the default interval to check the block height of the database
+	// before serving the cached results.
+	DefaultResultCacheCheck = time.Second
+)
+
+var (
+	resultCacheLock sync.RWMutex
+	resultCache     *lru.Cache
+
+	// resultDBs tracks the block heights of the databases with cached results.
+	resultDBLock sync.Mutex
+	resultDBs    = make(map[proto.DatabaseID]*resultCacheDB)
+
+	resultCacheHits          uint64
+	resultCacheMisses        uint64
+	resultCacheInvalidations uint64
+)
+
+func init() {
+	SetResultCacheSize(DefaultResultCacheSize)
+}
+
+// resultCacheKey is the key of a read result in the cache, the query is normalized to share the
+// results of the queries differing in whitespaces and keyword cases.
+type resultCacheKey struct {
+	dbID   proto.DatabaseID
+	signer string
+	query  string
+	args   string
+}
+
+// cachedResult is the read result cached at the block height of the database.
+type cachedResult struct {
+	payload types.ResponsePayload
+	height  int32
+	gen     uint64
+}
+
+// resultCacheDB is the cache state of a database, the results cached at a lower block height or
+// before the last write of the client are stale.
+type resultCacheDB struct {
+	height  int32
+	checked time.Time // last time the height is confirmed by a miner
+	gen     uint64    // bumped by the writes of the client
+}
+
+// ResultCacheStats defines the statistics of the read result cache.
+type ResultCacheStats StmtCacheStats
+
+// HitRate returns the ratio of the reads served by the cache.
+func (s ResultCacheStats) HitRate() float64 {
+	return StmtCacheStats(s).HitRate()
+}
+
+// SetResultCacheSize sets the max read results cached by the driver, the cached results are
+// dropped. A non-positive size disables the cache for all the connections.
+func SetResultCacheSize(size int) {
+	var cache *lru.Cache
+	if size > 0 {
+		cache, _ = lru.New(size)
+	}
+	resultCacheLock.Lock()
+	defer resultCacheLock.Unlock()
+	resultCache = cache
+}
+
+// GetResultCacheStats returns the statistics of the read result cache.
+func GetResultCacheStats() (stats ResultCacheStats) {
+	stats = ResultCacheStats{
+		Hits:          atomic.LoadUint64(&resultCacheHits),
+		Misses:        atomic.LoadUint64(&resultCacheMisses),
+		Invalidations: atomic.LoadUint64(&resultCacheInvalidations),
+	}
+	if cache := loadResultCache(); cache != nil {
+		stats.Len = cache.Len()
+	}
+	return
+}
+
+func loadResultCache() *lru.Cache {
+	resultCacheLock.RLock()
+	defer resultCacheLock.RUnlock()
+	return resultCache
+}
+
+// queryCached serves the read query from the result cache, the result is cached on miss. Only
+// the single select statements are cached.
+func (c *conn) queryCached(ctx context.Context, sq *types.Query) (rs driver.Rows, err error) {
+	var privKey = c.privKey
+	if key, ok := getQueryKey(ctx); ok {
+		privKey = key
+	}
+	key, ok := newResultCacheKey(c.dbID, string(privKey.PubKey().Serialize()), sq)
+	if !ok || ctx.Value(&ctxPageKey) != nil {
+		_, _, rs, err = c.addQuery(ctx, types.ReadQuery, sq)
+		return
+	}
+	if payload, ok := getCachedResult(key, c.resultCacheCheck, c.probeHeight); ok {
+		atomic.AddUint64(&resultCacheHits, 1)
+		r := newRows(&types.Response{Payload: *payload})
+		r.times = &c.times
+		return r, nil
+	}
+	atomic.AddUint64(&resultCacheMisses, 1)
+	var gen = resultCacheGen(c.dbID)
+	if _, _, rs, err = c.addQuery(ctx, types.ReadQuery, sq); err != nil {
+		return
+	}
+	putCachedResult(key, rs.(*rows), gen)
+	return
+}
+
+// probeHeight returns the sqlchain head height of the miner serving the reads, the header at the
+// height from is fetched as well in case the miner does not report its head.
+func (c *conn) probeHeight(from int32) (head int32, err error) {
+	var uc, follower = c.servingPConns()
+	if follower != nil {
+		uc = follower
+	}
+	var (
+		req  = &types.FetchBlockHeadersReq{DatabaseID: c.dbID, From: from, To: from}
+		resp = &types.FetchBlockHeadersResp{}
+	)
+	if err = uc.pCaller.Call(route.DBSFetchBlockHeaders.String(), req, resp); err != nil {
+		return
+	}
+	head = resp.Head
+	for _, h := range resp.Headers {
+		if h.Height > head {
+			head = h.Height
+		}
+	}
+	return
+}
+
+// newResultCacheKey returns the cache key of the read query, ok is false if the query is not a
+// single select statement.
+func newResultCacheKey(dbID proto.DatabaseID, signer string, sq *types.Query) (
+	key resultCacheKey, ok bool) {
+	stmt, err := sqlparser.Parse(sq.Pattern)
+	if err != nil {
+		return
+	}
+	switch stmt.(type) {
+	case *sqlparser.Select, *sqlparser.Union, *sqlparser.ParenSelect:
+	default:
+		return
+	}
+	var args strings.Builder
+	for _, arg := range sq.Args {
+		fmt.Fprintf(&args, "%s=%T:%#v;", arg.Name, arg.Value, arg.Value)
+	}
+	return resultCacheKey{
+		dbID:   dbID,
+		signer: signer,
+		query:  sqlparser.NewTrackedBuffer(nil).WriteNode(stmt).String(),
+		args:   args.String(),
+	}, true
+}
+
+// getResultDB returns the cache state of the database, resultDBLock must be held.
+func getResultDB(dbID proto.DatabaseID) (db *resultCacheDB) {
+	if db = resultDBs[dbID]; db == nil {
+		db = &resultCacheDB{}
+		resultDBs[dbID] = db
+	}
+	return
+}
+
+// resultCacheGen returns the write generation of the database, a result is only cached if no
+// write is sent by the client while it is queried.
+func resultCacheGen(dbID proto.DatabaseID) uint64 {
+	resultDBLock.Lock()
+	defer resultDBLock.Unlock()
+	return getResultDB(dbID).gen
+}
+
+// observeResultHeight records the block height of the database reported by a miner, the cached
+// results are dropped if the height advances. The current height and write generation are
+// returned, which stay unchanged if a lagging miner reports a lower height.
+func observeResultHeight(dbID proto.DatabaseID, height int32) (current int32, gen uint64) {
+	resultDBLock.Lock()
+	var (
+		db       = getResultDB(dbID)
+		advanced = height > db.height
+	)
+	if height >= db.height {
+		db.height = height
+		db.checked = time.Now()
+	}
+	current, gen = db.height, db.gen
+	resultDBLock.Unlock()
+	if advanced {
+		removeResults(dbID)
+	}
+	return
+}
+
+// getCachedResult returns the cached result of the key, the block height of the database is
+// checked by probe if it is not confirmed in the check interval.
+func getCachedResult(
+	key resultCacheKey, check time.Duration, probe func(from int32) (int32, error),
+) (payload *types.ResponsePayload, ok bool) {
+	var cache = loadResultCache()
+	if cache == nil {
+		return
+	}
+	v, ok := cache.Get(key)
+	if !ok {
+		return
+	}
+	var entry = v.(*cachedResult)
+	resultDBLock.Lock()
+	var (
+		db     = getResultDB(key.dbID)
+		height = db.height
+		valid  = entry.height == db.height && entry.gen == db.gen
+		due    = time.Since(db.checked) >= check
+	)
+	resultDBLock.Unlock()
+	if !valid {
+		cache.Remove(key)
+		return nil, false
+	}
+	if due {
+		head, err := probe(height + 1)
+		if err != nil {
+			log.WithField("db", key.dbID).WithError(err).Debug("check result cache height failed")
+			return nil, false
+		}
+		if current, _ := observeResultHeight(key.dbID, head); current != height {
+			return nil, false
+		}
+	}
+	return &entry.payload, true
+}
+
+// putCachedResult caches the result of the key unless it is stale already.
+func putCachedResult(key resultCacheKey, rs *rows, gen uint64) {
+	var cache = loadResultCache()
+	if cache == nil {
+		return
+	}
+	current, currentGen := observeResultHeight(key.dbID, rs.height)
+	if current != rs.height || currentGen != gen {
+		return
+	}
+	cache.Add(key, &cachedResult{
+		payload: types.ResponsePayload{
+			Columns:    rs.columns,
+			DeclTypes:  rs.types,
+			Rows:       rs.data,
+			ColumnMeta: rs.meta,
+		},
+		height: rs.height,
+		gen:    gen,
+	})
+}
+
+// invalidateResultCache drops the cached results of the database after the client writes it.
+func invalidateResultCache(dbID proto.DatabaseID) {
+	resultDBLock.Lock()
+	db, ok := resultDBs[dbID]
+	if ok {
+		db.gen++
+	}
+	resultDBLock.Unlock()
+	if ok {
+		removeResults(dbID)
+	}
+}
+
+// removeResults drops the cached results of the database.
+func removeResults(dbID proto.DatabaseID) {
+	var cache = loadResultCache()
+	if cache == nil {
+		return
+	}
+	for _, k := range cache.Keys() {
+		if k.(resultCacheKey).dbID == dbID {
+			cache.Remove(k)
+		}
+	}
+	atomic.AddUint64(&resultCacheInvalidations, 1)
+}
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestResultCache(t *testing.T) {
+	Convey("test read result cache", t, func() {
+		SetResultCacheSize(8)
+		defer SetResultCacheSize(DefaultResultCacheSize)
+		var (
+			dbID  = proto.DatabaseID("result-cache-db")
+			query = func(pattern string, args ...interface{}) *types.Query {
+				sq := &types.Query{Pattern: pattern}
+				for _, v := range args {
+					sq.Args = append(sq.Args, types.NamedArg{Value: v})
+				}
+				return sq
+			}
+			result = func(height int32, v int64) *rows {
+				return &rows{
+					columns: []string{"v"},
+					types:   []string{"INTEGER"},
+					data:    []types.ResponseRow{{Values: []interface{}{v}}},
+					height:  height,
+				}
+			}
+			head   int32
+			probes int
+			probe  = func(from int32) (int32, error) {
+				probes++
+				return head, nil
+			}
+		)
+		defer func() {
+			resultDBLock.Lock()
+			delete(resultDBs, dbID)
+			resultDBLock.Unlock()
+		}()
+
+		Convey("queries should be normalized", func() {
+			k1, ok := newResultCacheKey(dbID, "", query("select v from t where id = ?", 1))
+			So(ok, ShouldBeTrue)
+			k2, ok := newResultCacheKey(dbID, "", query("SELECT  v\n FROM t WHERE id=?", 1))
+			So(ok, ShouldBeTrue)
+			So(k2, ShouldResemble, k1)
+			k3, ok := newResultCacheKey(dbID, "", query("select v from t where id = ?", "1"))
+			So(ok, ShouldBeTrue)
+			So(k3, ShouldNotResemble, k1)
+			k4, ok := newResultCacheKey(dbID, "", query("select v from t where name = 'a  b'"))
+			So(ok, ShouldBeTrue)
+			k5, _ := newResultCacheKey(dbID, "", query("select v from t where name = 'a b'"))
+			So(k5, ShouldNotResemble, k4)
+			_, ok = newResultCacheKey(dbID, "", query("update t set v = 1"))
+			So(ok, ShouldBeFalse)
+			_, ok = newResultCacheKey(dbID, "", query("select 1; select 2"))
+			So(ok, ShouldBeFalse)
+		})
+		Convey("results should be served until the height advances", func() {
+			key, _ := newResultCacheKey(dbID, "", query("select v from t"))
+			head = 10
+			putCachedResult(key, result(10, 1), resultCacheGen(dbID))
+			payload, ok := getCachedResult(key, time.Hour, probe)
+			So(ok, ShouldBeTrue)
+			So(payload.Rows[0].Values[0], ShouldEqual, 1)
+			So(probes, ShouldEqual, 0)
+
+			// a lagging miner should neither advance nor pollute the cache
+			putCachedResult(key, result(9, 0), resultCacheGen(dbID))
+			payload, ok = getCachedResult(key, 0, probe)
+			So(ok, ShouldBeTrue)
+			So(payload.Rows[0].Values[0], ShouldEqual, 1)
+			So(probes, ShouldEqual, 1)
+
+			head = 11
+			_, ok = getCachedResult(key, 0, probe)
+			So(ok, ShouldBeFalse)
+			_, ok = getCachedResult(key, 0, probe)
+			So(ok, ShouldBeFalse)
+			putCachedResult(key, result(11, 2), resultCacheGen(dbID))
+			payload, ok = getCachedResult(key, 0, probe)
+			So(ok, ShouldBeTrue)
+			So(payload.Rows[0].Values[0], ShouldEqual, 2)
+		})
+		Convey("results should be dropped by writes and failed checks", func() {
+			key, _ := newResultCacheKey(dbID, "", query("select v from t"))
+			head = 20
+			var gen = resultCacheGen(dbID)
+			putCachedResult(key, result(20, 1), gen)
+			_, ok := getCachedResult(key, time.Hour, probe)
+			So(ok, ShouldBeTrue)
+			invalidateResultCache(dbID)
+			_, ok = getCachedResult(key, time.Hour, probe)
+			So(ok, ShouldBeFalse)
+
+			// the result queried across the write is not cached
+			putCachedResult(key, result(20, 1), gen)
+			_, ok = getCachedResult(key, time.Hour, probe)
+			So(ok, ShouldBeFalse)
+
+			putCachedResult(key, result(20, 1), resultCacheGen(dbID))
+			_, ok = getCachedResult(key, 0, func(int32) (int32, error) {
+				return 0, errors.New("unreachable")
+			})
+			So(ok, ShouldBeFalse)
+			So(GetResultCacheStats().Invalidations, ShouldBeGreaterThan, 0)
+		})
+	})
+}
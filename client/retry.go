@@ -0,0 +1,142 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	mrand "math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultRetryInitialBackoff is the backoff before the first retry if not configured.
+	DefaultRetryInitialBackoff = 100 * time.Millisecond
+	// DefaultRetryMaxBackoff is the upper bound of the retry backoff if not configured.
+	DefaultRetryMaxBackoff = 5 * time.Second
+	// DefaultRetryMultiplier is the growth of the retry backoff if not configured.
+	DefaultRetryMultiplier = 2.0
+)
+
+// RetryPolicy retries the queries failed by transient errors talking to the miner, such as
+// broken connections and timeouts, the errors returned by the miner are never retried. The
+// write queries are sent with idempotency keys if retries are enabled, so that the miner applies
+// a retried write only once.
+type RetryPolicy struct {
+	// MaxRetries is the max retries of a query, the queries are not retried if zero.
+	MaxRetries int
+
+	// InitialBackoff is the backoff before the first retry, it grows by Multiplier for each of
+	// the following retries up to MaxBackoff. The backoffs are jittered down to half.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+}
+
+func (p *RetryPolicy) enabled() bool {
+	return p.MaxRetries > 0
+}
+
+// backoff returns the jittered backoff before the retry, retry counts from 0.
+func (p *RetryPolicy) backoff(retry int) (d time.Duration) {
+	var (
+		initial    = p.InitialBackoff
+		max        = p.MaxBackoff
+		multiplier = p.Multiplier
+	)
+	if initial <= 0 {
+		initial = DefaultRetryInitialBackoff
+	}
+	if max <= 0 {
+		max = DefaultRetryMaxBackoff
+	}
+	if multiplier < 1 {
+		multiplier = DefaultRetryMultiplier
+	}
+	var b = float64(initial)
+	for i := 0; i < retry && b < float64(max); i++ {
+		b *= multiplier
+	}
+	if b > float64(max) {
+		b = float64(max)
+	}
+	d = time.Duration(b)
+	return d/2 + time.Duration(mrand.Int63n(int64(d/2)+1))
+}
+
+// newIdempotencyKey returns a random key identifying a write query across its retries.
+func newIdempotencyKey() (key string, err error) {
+	var b [16]byte
+	if _, err = rand.Read(b[:]); err != nil {
+		return
+	}
+	key = hex.EncodeToString(b[:])
+	return
+}
+
+// callQueryRetry calls the query with the retry policy of the connection. The retried reads are
+// re-signed with new sequence numbers, while the writes are resent as is to be deduplicated by
+// their idempotency keys. The paginated reads are not retried since the cursor may have moved.
+func (c *conn) callQueryRetry(
+	ctx context.Context, uc *pconn, privKey *asymmetric.PrivateKey, req *types.Request, resp *types.Response,
+	qh *queryHooks,
+) (err error) {
+	for retry := 0; ; retry++ {
+		if err = c.callQuery(ctx, uc, req, resp); err == nil || !c.shouldRetry(ctx, req, retry, err) {
+			return
+		}
+		var backoff = c.retry.backoff(retry)
+		log.WithFields(log.Fields{
+			"db":      c.dbID,
+			"target":  uc.pCaller.Target(),
+			"retry":   retry + 1,
+			"backoff": backoff,
+		}).WithError(err).Debug("retry query")
+
+		var timer = time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		var cause = err
+		if req.Header.QueryType == types.ReadQuery {
+			req.Header.SeqNo = atomic.AddUint64(&globalSeqNo, 1)
+			req.Header.Timestamp = getLocalTime()
+			if err = req.Header.Sign(privKey); err != nil {
+				return
+			}
+		}
+		qh.retry(ctx, req.Header.SeqNo, cause)
+	}
+}
+
+func (c *conn) shouldRetry(ctx context.Context, req *types.Request, retry int, err error) bool {
+	if retry >= c.retry.MaxRetries || ctx.Err() != nil || isMinerError(err) {
+		return false
+	}
+	if req.Header.QueryType == types.WriteQuery {
+		return req.IdempotencyKey != ""
+	}
+	return len(req.Page.Token) == 0 && !req.Page.Close
+}
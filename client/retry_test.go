@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	netrpc "net/rpc"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	Convey("test retry backoff", t, func() {
+		var p = RetryPolicy{
+			MaxRetries:     5,
+			InitialBackoff: 100 * time.Millisecond,
+			MaxBackoff:     time.Second,
+			Multiplier:     2,
+		}
+		for retry, max := range []time.Duration{
+			100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond,
+			800 * time.Millisecond, time.Second, time.Second,
+		} {
+			d := p.backoff(retry)
+			So(d, ShouldBeGreaterThanOrEqualTo, max/2)
+			So(d, ShouldBeLessThanOrEqualTo, max)
+		}
+		p = RetryPolicy{MaxRetries: 1}
+		So(p.backoff(0), ShouldBeLessThanOrEqualTo, DefaultRetryInitialBackoff)
+		So(p.backoff(100), ShouldBeLessThanOrEqualTo, DefaultRetryMaxBackoff)
+		So(p.backoff(100), ShouldBeGreaterThanOrEqualTo, DefaultRetryMaxBackoff/2)
+	})
+	Convey("test retryable failures", t, func() {
+		var (
+			c        = &conn{retry: RetryPolicy{MaxRetries: 2}}
+			ctx      = context.Background()
+			netErr   = errors.New("connection reset by peer")
+			read     = &types.Request{}
+			write    = &types.Request{}
+			keyed    = &types.Request{IdempotencyKey: "k"}
+			nextPage = &types.Request{Page: types.PageRequest{Size: 10, Token: []byte("t")}}
+		)
+		write.Header.QueryType = types.WriteQuery
+		keyed.Header.QueryType = types.WriteQuery
+
+		So(c.shouldRetry(ctx, read, 0, netErr), ShouldBeTrue)
+		So(c.shouldRetry(ctx, read, 2, netErr), ShouldBeFalse)
+		So(c.shouldRetry(ctx, read, 0, netrpc.ServerError("permission deny")), ShouldBeFalse)
+		So(c.shouldRetry(ctx, nextPage, 0, netErr), ShouldBeFalse)
+		So(c.shouldRetry(ctx, write, 0, netErr), ShouldBeFalse)
+		So(c.shouldRetry(ctx, keyed, 0, netErr), ShouldBeTrue)
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		So(c.shouldRetry(canceled, read, 0, netErr), ShouldBeFalse)
+
+		key1, err := newIdempotencyKey()
+		So(err, ShouldBeNil)
+		key2, err := newIdempotencyKey()
+		So(err, ShouldBeNil)
+		So(key1, ShouldHaveLength, 32)
+		So(key1, ShouldNotEqual, key2)
+	})
+}
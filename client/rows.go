@@ -19,21 +19,41 @@ package client
 import (
 	"database/sql/driver"
 	"io"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/SQLess/SQLess/types"
 )
 
+var (
+	scanTypeInt64     = reflect.TypeOf(int64(0))
+	scanTypeFloat64   = reflect.TypeOf(float64(0))
+	scanTypeString    = reflect.TypeOf("")
+	scanTypeBytes     = reflect.TypeOf([]byte(nil))
+	scanTypeBool      = reflect.TypeOf(false)
+	scanTypeTime      = reflect.TypeOf(time.Time{})
+	scanTypeInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
 type rows struct {
 	columns []string
 	types   []string
-	data    []types.ResponseRow
+	meta    []types.ColumnMeta
+	// row is the index of the next row in the result set, which the mixed column kinds are
+	// looked up with.
+	row   int
+	data  []types.ResponseRow
+	times *timeOptions
+	// height is the sqlchain head height of the miner serving the rows.
+	height int32
 }
 
 func newRows(res *types.Response) *rows {
 	return &rows{
 		columns: res.Payload.Columns,
 		types:   res.Payload.DeclTypes,
+		meta:    res.Payload.ColumnMeta,
 		data:    res.Payload.Rows,
 	}
 }
@@ -56,11 +76,18 @@ func (r *rows) Next(dest []driver.Value) error {
 	}
 
 	for i, d := range r.data[0].Values {
+		if i < len(r.meta) {
+			d = normalizeValue(d, r.meta[i].KindAt(r.row))
+		}
+		if r.times != nil && i < len(r.types) {
+			d = r.times.decodeValue(d, r.types[i])
+		}
 		dest[i] = d
 	}
 
 	// unshift data
 	r.data = r.data[1:]
+	r.row++
 
 	return nil
 }
@@ -69,3 +96,85 @@ func (r *rows) Next(dest []driver.Value) error {
 func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
 	return strings.ToUpper(r.types[index])
 }
+
+// ColumnTypeScanType implements driver.RowsColumnTypeScanType.ColumnTypeScanType method.
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	if index < len(r.meta) {
+		switch r.meta[index].Kind {
+		case types.KindInteger:
+			return scanTypeInt64
+		case types.KindReal:
+			return scanTypeFloat64
+		case types.KindText:
+			return scanTypeString
+		case types.KindBlob:
+			return scanTypeBytes
+		case types.KindBool:
+			return scanTypeBool
+		case types.KindTime:
+			return scanTypeTime
+		case types.KindMixed:
+			return scanTypeInterface
+		}
+	}
+	// no values to tell, fallback to the affinity of the declared type
+	if index < len(r.types) {
+		return scanTypeOfDeclType(r.types[index])
+	}
+	return scanTypeInterface
+}
+
+// ColumnTypeNullable implements driver.RowsColumnTypeNullable.ColumnTypeNullable method, the
+// nullability is only known if NULL values are present in the result set.
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if index < len(r.meta) && r.meta[index].HasNull {
+		return true, true
+	}
+	return false, false
+}
+
+// scanTypeOfDeclType returns the scan type of the sqlite declared column type by the type
+// affinity rules, the date and boolean types are converted by the storage driver.
+func scanTypeOfDeclType(declType string) reflect.Type {
+	var t = strings.ToUpper(declType)
+	switch t {
+	case "DATE", "DATETIME", "TIMESTAMP":
+		return scanTypeTime
+	case "BOOLEAN":
+		return scanTypeBool
+	}
+	switch {
+	case t == "":
+		return scanTypeInterface
+	case strings.Contains(t, "INT"):
+		return scanTypeInt64
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return scanTypeString
+	case strings.Contains(t, "BLOB"):
+		return scanTypeBytes
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return scanTypeFloat64
+	default:
+		return scanTypeInterface
+	}
+}
+
+// normalizeValue restores the value decoded from the wire to the driver value of the column kind,
+// text values are decoded as []byte and integers may be decoded as unsigned.
+func normalizeValue(v interface{}, kind types.ValueKind) interface{} {
+	switch d := v.(type) {
+	case []byte:
+		if kind == types.KindText {
+			return string(d)
+		}
+	case uint64:
+		return int64(d)
+	case int:
+		return int64(d)
+	case int32:
+		return int64(d)
+	case float32:
+		return float64(d)
+	}
+	return v
+}
@@ -19,7 +19,9 @@ package client
 import (
 	"database/sql/driver"
 	"io"
+	"reflect"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 
@@ -58,3 +60,98 @@ func TestRowsStructure(t *testing.T) {
 		So(r.data, ShouldBeNil)
 	})
 }
+
+func TestRowsColumnMeta(t *testing.T) {
+	Convey("test rows with column metadata", t, func() {
+		data := [][]interface{}{
+			{int64(1), "", nil, []byte{}},
+			{int64(2), "b", "x", []byte("c")},
+		}
+		meta := types.BuildColumnMeta(4, data)
+		So(meta, ShouldResemble, []types.ColumnMeta{
+			{Kind: types.KindInteger},
+			{Kind: types.KindText},
+			{Kind: types.KindText, HasNull: true},
+			{Kind: types.KindBlob},
+		})
+		r := newRows(&types.Response{
+			Payload: types.ResponsePayload{
+				Columns:   []string{"a", "b", "c", "d"},
+				DeclTypes: []string{"int", "", "text", "blob"},
+				Rows: []types.ResponseRow{
+					// values as decoded from the wire
+					{Values: []interface{}{uint64(1), []byte{}, nil, []byte{}}},
+				},
+				ColumnMeta: meta,
+			},
+		})
+		So(r.ColumnTypeScanType(0), ShouldEqual, reflect.TypeOf(int64(0)))
+		So(r.ColumnTypeScanType(1), ShouldEqual, reflect.TypeOf(""))
+		So(r.ColumnTypeScanType(3), ShouldEqual, reflect.TypeOf([]byte(nil)))
+		nullable, ok := r.ColumnTypeNullable(2)
+		So(nullable, ShouldBeTrue)
+		So(ok, ShouldBeTrue)
+		_, ok = r.ColumnTypeNullable(0)
+		So(ok, ShouldBeFalse)
+
+		dest := make([]driver.Value, 4)
+		err := r.Next(dest)
+		So(err, ShouldBeNil)
+		So(dest[0], ShouldEqual, int64(1))
+		So(dest[1], ShouldEqual, "")
+		So(dest[2], ShouldBeNil)
+		So(dest[3], ShouldResemble, []byte{})
+	})
+	Convey("test rows with mixed column", t, func() {
+		data := [][]interface{}{
+			{"a", int64(1)},
+			{[]byte("b"), nil},
+			{int64(3), "c"},
+			{nil, "d"},
+		}
+		meta := types.BuildColumnMeta(2, data)
+		So(meta, ShouldResemble, []types.ColumnMeta{
+			{Kind: types.KindMixed, HasNull: true, Kinds: []types.ValueKind{
+				types.KindText, types.KindBlob, types.KindInteger, types.KindNull}},
+			{Kind: types.KindMixed, HasNull: true, Kinds: []types.ValueKind{
+				types.KindInteger, types.KindNull, types.KindText, types.KindText}},
+		})
+		r := newRows(&types.Response{
+			Payload: types.ResponsePayload{
+				Columns:   []string{"a", "b"},
+				DeclTypes: []string{"", ""},
+				Rows: []types.ResponseRow{
+					// values as decoded from the wire
+					{Values: []interface{}{[]byte("a"), uint64(1)}},
+					{Values: []interface{}{[]byte("b"), nil}},
+					{Values: []interface{}{uint64(3), []byte("c")}},
+					{Values: []interface{}{nil, []byte("d")}},
+				},
+				ColumnMeta: meta,
+			},
+		})
+		So(r.ColumnTypeScanType(0), ShouldEqual, reflect.TypeOf((*interface{})(nil)).Elem())
+
+		var (
+			dest     = make([]driver.Value, 2)
+			expected = [][]driver.Value{
+				{"a", int64(1)},
+				{[]byte("b"), nil},
+				{int64(3), "c"},
+				{nil, "d"},
+			}
+		)
+		for _, row := range expected {
+			So(r.Next(dest), ShouldBeNil)
+			So(dest, ShouldResemble, row)
+		}
+		So(r.Next(dest), ShouldEqual, io.EOF)
+	})
+	Convey("test scan type of declared types without values", t, func() {
+		So(scanTypeOfDeclType("VARCHAR(20)"), ShouldEqual, reflect.TypeOf(""))
+		So(scanTypeOfDeclType("bigint"), ShouldEqual, reflect.TypeOf(int64(0)))
+		So(scanTypeOfDeclType("datetime"), ShouldEqual, reflect.TypeOf(time.Time{}))
+		So(scanTypeOfDeclType("DOUBLE"), ShouldEqual, reflect.TypeOf(float64(0)))
+		So(scanTypeOfDeclType(""), ShouldEqual, reflect.TypeOf((*interface{})(nil)).Elem())
+	})
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"sync"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/kms"
+)
+
+var (
+	txSignerLock sync.RWMutex
+	txSigner     asymmetric.Signer
+)
+
+// SetTxSigner sets the signer backend of the Create and TransferToken transactions, e.g. a
+// hwwallet.Signer, so the private key of the account is never loaded into the process. The
+// account of the transactions becomes the one of the signer. A nil signer restores the local
+// private key.
+func SetTxSigner(signer asymmetric.Signer) {
+	txSignerLock.Lock()
+	defer txSignerLock.Unlock()
+	txSigner = signer
+}
+
+func getTxSigner() (signer asymmetric.Signer, err error) {
+	txSignerLock.RLock()
+	signer = txSigner
+	txSignerLock.RUnlock()
+	if signer != nil {
+		return
+	}
+	var privKey *asymmetric.PrivateKey
+	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	signer = privKey
+	return
+}
@@ -0,0 +1,42 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"sync/atomic"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+)
+
+// SimulateTx asks the block producer to apply the signed transaction against a copy of current
+// chain state without committing it. The response reports whether the transaction would
+// succeed and the token balance changes it would cause.
+func SimulateTx(tx pi.Transaction) (resp *types.SimulateTxResp, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+
+	req := &types.SimulateTxReq{Tx: tx}
+	resp = new(types.SimulateTxResp)
+	if err = requestBP(route.MCCSimulateTx, req, resp); err != nil {
+		resp = nil
+	}
+	return
+}
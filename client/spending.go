@@ -0,0 +1,349 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+// spendWindow is the sliding window of the daily spending limit.
+const spendWindow = 24 * time.Hour
+
+// SpendApprover approves the transaction spending more than the approval threshold of the
+// spending policy, e.g. by asking a second operator. A non-nil error rejects the transaction.
+type SpendApprover func(tx pi.Transaction, amount uint64) error
+
+type spendRecord struct {
+	At     time.Time `json:"at"`
+	Amount uint64    `json:"amount"`
+}
+
+// spendLedger records the spending of each account within the window. It's persisted to the
+// file if the path is set, so that the transactions signed by the previous processes are
+// counted as well.
+type spendLedger struct {
+	sync.Mutex
+	path    string
+	records map[string][]*spendRecord
+}
+
+var (
+	spendingLock     sync.Mutex
+	spendingPolicies = make(map[proto.AccountAddress]*conf.SpendingPolicy)
+	spendApprover    SpendApprover
+	// localLedger is the ledger of the policies enforced in the client process, it's loaded
+	// from the SpendingLedgerFile of the client config on first use.
+	localLedger *spendLedger
+)
+
+// newSpendLedger loads the ledger from the file, the ledger is kept in memory only if the path
+// is empty.
+func newSpendLedger(path string) (l *spendLedger, err error) {
+	l = &spendLedger{
+		path:    path,
+		records: make(map[string][]*spendRecord),
+	}
+	if path == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		err = nil
+		return
+	} else if err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, &l.records); err != nil {
+		err = errors.Wrapf(err, "decode spending ledger %s failed", path)
+	}
+	return
+}
+
+// save persists the ledger atomically, the lock must be held by the caller.
+func (l *spendLedger) save() (err error) {
+	if l.path == "" {
+		return
+	}
+	data, err := json.Marshal(l.records)
+	if err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(filepath.Dir(l.path), filepath.Base(l.path)+".tmp")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(f.Name())
+		}
+	}()
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return
+	}
+	return os.Rename(f.Name(), l.path)
+}
+
+// reserve records the amount in the daily limit of the account, the record is persisted before
+// returning. The returned function reverts it.
+func (l *spendLedger) reserve(addr proto.AccountAddress, limit, amount uint64, now time.Time) (
+	revert func(), err error,
+) {
+	revert = func() {}
+	if limit == 0 || amount == 0 {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	var (
+		key   = addr.String()
+		spent uint64
+		kept  []*spendRecord
+	)
+	for _, r := range l.records[key] {
+		if now.Sub(r.At) < spendWindow {
+			kept = append(kept, r)
+			spent += r.Amount
+		}
+	}
+	if amount > limit || spent > limit-amount {
+		l.records[key] = kept
+		err = errors.Wrapf(ErrDailySpendExceeded, "spent %d of %d in 24h, requested %d",
+			spent, limit, amount)
+		return
+	}
+	var (
+		record = &spendRecord{At: now, Amount: amount}
+		prev   = l.records[key]
+	)
+	l.records[key] = append(kept, record)
+	if err = l.save(); err != nil {
+		l.records[key] = prev
+		err = errors.Wrap(err, "persist spending ledger failed")
+		return
+	}
+	revert = func() {
+		l.Lock()
+		defer l.Unlock()
+		var records = l.records[key]
+		for i, r := range records {
+			if r == record {
+				l.records[key] = append(records[:i:i], records[i+1:]...)
+				break
+			}
+		}
+		_ = l.save()
+	}
+	return
+}
+
+// getLocalLedger returns the ledger of the client process.
+func getLocalLedger() (l *spendLedger, err error) {
+	spendingLock.Lock()
+	defer spendingLock.Unlock()
+	if localLedger == nil {
+		var path string
+		if conf.GConf != nil {
+			path = conf.GConf.SpendingLedgerFile
+		}
+		if localLedger, err = newSpendLedger(path); err != nil {
+			localLedger = nil
+			return
+		}
+	}
+	return localLedger, nil
+}
+
+// SetSpendingPolicy attaches the spending policy to the key of the account, overriding the
+// SpendingPolicies of the client config. A nil policy restores the configured one.
+func SetSpendingPolicy(addr proto.AccountAddress, policy *conf.SpendingPolicy) {
+	spendingLock.Lock()
+	defer spendingLock.Unlock()
+	if policy == nil {
+		delete(spendingPolicies, addr)
+		return
+	}
+	var p = *policy
+	p.Account = addr
+	spendingPolicies[addr] = &p
+}
+
+// SetSpendApprover sets the approver of the transactions above the approval threshold, such
+// transactions are refused if no approver is set.
+func SetSpendApprover(approver SpendApprover) {
+	spendingLock.Lock()
+	defer spendingLock.Unlock()
+	spendApprover = approver
+}
+
+func getSpendingPolicy(addr proto.AccountAddress) (policy *conf.SpendingPolicy, approver SpendApprover) {
+	spendingLock.Lock()
+	defer spendingLock.Unlock()
+	approver = spendApprover
+	if policy = spendingPolicies[addr]; policy != nil || conf.GConf == nil {
+		return
+	}
+	for i := range conf.GConf.SpendingPolicies {
+		if conf.GConf.SpendingPolicies[i].Account == addr {
+			policy = &conf.GConf.SpendingPolicies[i]
+			return
+		}
+	}
+	return
+}
+
+// txSpending returns the tokens spent by the transaction and the receivers of the transfer, the
+// wrapped transaction of a multi-signature transaction is inspected.
+func txSpending(tx pi.Transaction) (amount uint64, receivers []proto.AccountAddress, isTransfer bool) {
+	switch t := tx.(type) {
+	case *types.Transfer:
+		return t.Amount, []proto.AccountAddress{t.Receiver}, true
+	case *types.TransferBatch:
+		var ok bool
+		if amount, ok = t.TotalAmount(); !ok {
+			amount = math.MaxUint64
+		}
+		receivers = make([]proto.AccountAddress, 0, len(t.Receivers))
+		for _, r := range t.Receivers {
+			receivers = append(receivers, r.Receiver)
+		}
+		return amount, receivers, true
+	case *types.CreateDatabase:
+		return t.AdvancePayment, nil, false
+	case *types.RegisterName:
+		return t.Fee, nil, false
+	case *types.ReserveCapacity:
+		return t.Fee * uint64(len(t.Miners)), nil, false
+	case *types.MultiSig:
+		if t.Tx.Transaction != nil {
+			return txSpending(t.Tx.Transaction)
+		}
+	}
+	return
+}
+
+// checkSpending enforces the spending policy of the signer account on the transaction before it
+// is signed. The spending is reserved in the daily limit, the returned function reverts it if
+// the transaction is not signed eventually.
+//
+// The policy is enforced by the client process itself, a process holding the same key could
+// sign around it. Run the key behind a PolicySigner to enforce the policy for all the clients.
+func checkSpending(signee *asymmetric.PublicKey, tx pi.Transaction) (revert func(), err error) {
+	revert = func() {}
+	var (
+		addr   proto.AccountAddress
+		ledger *spendLedger
+	)
+	if addr, err = crypto.PubKeyHash(signee); err != nil {
+		return
+	}
+	policy, approver := getSpendingPolicy(addr)
+	if policy == nil {
+		return
+	}
+	if ledger, err = getLocalLedger(); err != nil {
+		return
+	}
+	return enforceSpending(policy, approver, ledger, addr, tx)
+}
+
+// enforceSpending checks the transaction of the account against the policy, and reserves the
+// spending in the ledger.
+func enforceSpending(
+	policy *conf.SpendingPolicy, approver SpendApprover, ledger *spendLedger,
+	addr proto.AccountAddress, tx pi.Transaction,
+) (revert func(), err error) {
+	revert = func() {}
+	amount, receivers, isTransfer := txSpending(tx)
+	if isTransfer && len(policy.AllowedReceivers) > 0 {
+		for _, receiver := range receivers {
+			var allowed bool
+			for _, r := range policy.AllowedReceivers {
+				if r == receiver {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				err = errors.Wrapf(ErrReceiverNotAllowed, "receiver %s", receiver.String())
+				return
+			}
+		}
+	}
+	if policy.ApprovalThreshold > 0 && amount > policy.ApprovalThreshold {
+		if approver == nil {
+			err = errors.Wrapf(ErrSpendApprovalRequired, "amount %d above threshold %d",
+				amount, policy.ApprovalThreshold)
+			return
+		}
+		if err = approver(tx, amount); err != nil {
+			err = errors.Wrapf(ErrSpendNotApproved, "amount %d: %v", amount, err)
+			return
+		}
+	}
+	return ledger.reserve(addr, policy.MaxDailySpend, amount, time.Now())
+}
+
+// signableTx defines the transaction signed with a signer backend.
+type signableTx interface {
+	pi.Transaction
+	SignWith(signer asymmetric.Signer) error
+}
+
+// signTx signs the transaction with the signer within the spending policy of the signer account,
+// a signed transaction is counted as spent even if it's not submitted. The transaction is sent to
+// the TxSigner as a whole, which enforces its own policy.
+func signTx(signer asymmetric.Signer, tx signableTx) (err error) {
+	if ts, ok := signer.(TxSigner); ok {
+		var otx *OfflineTx
+		if otx, err = PrepareTx(tx); err != nil {
+			return
+		}
+		if err = ts.SignTx(otx); err != nil {
+			return
+		}
+		_, err = otx.SignedTx()
+		return
+	}
+	var revert func()
+	if revert, err = checkSpending(signer.PubKey(), tx); err != nil {
+		return
+	}
+	if err = tx.SignWith(signer); err != nil {
+		revert()
+	}
+	return
+}
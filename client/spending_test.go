@@ -0,0 +1,224 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestSpendingPolicy(t *testing.T) {
+	Convey("test spending policy", t, func() {
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		addr, err := crypto.PubKeyHash(privKey.PubKey())
+		So(err, ShouldBeNil)
+		var (
+			allowed = proto.AccountAddress{0x1}
+			other   = proto.AccountAddress{0x2}
+			nonce   pi.AccountNonce
+			newTx   = func(receiver proto.AccountAddress, amount uint64) *types.Transfer {
+				nonce++
+				return types.NewTransfer(&types.TransferHeader{
+					Sender:   addr,
+					Receiver: receiver,
+					Amount:   amount,
+					Nonce:    nonce,
+				})
+			}
+		)
+		SetSpendingPolicy(addr, &conf.SpendingPolicy{
+			MaxDailySpend:     100,
+			AllowedReceivers:  []proto.AccountAddress{allowed},
+			ApprovalThreshold: 50,
+		})
+		Reset(func() {
+			SetSpendingPolicy(addr, nil)
+			SetSpendApprover(nil)
+			spendingLock.Lock()
+			localLedger = nil
+			spendingLock.Unlock()
+		})
+
+		Convey("receiver should be in the allowlist", func() {
+			err := signTx(privKey, newTx(other, 1))
+			So(errors.Cause(err), ShouldEqual, ErrReceiverNotAllowed)
+			So(signTx(privKey, newTx(allowed, 1)), ShouldBeNil)
+		})
+		Convey("daily spending should be limited", func() {
+			So(signTx(privKey, newTx(allowed, 50)), ShouldBeNil)
+			So(signTx(privKey, newTx(allowed, 40)), ShouldBeNil)
+			err := signTx(privKey, newTx(allowed, 20))
+			So(errors.Cause(err), ShouldEqual, ErrDailySpendExceeded)
+			So(signTx(privKey, newTx(allowed, 10)), ShouldBeNil)
+			// the spending leaves the window after 24 hours
+			ledger, err := getLocalLedger()
+			So(err, ShouldBeNil)
+			_, err = ledger.reserve(addr, 100, 100, time.Now().Add(spendWindow))
+			So(err, ShouldBeNil)
+		})
+		Convey("reverted spending should be released", func() {
+			revert, err := checkSpending(privKey.PubKey(), newTx(allowed, 50))
+			So(err, ShouldBeNil)
+			_, err = checkSpending(privKey.PubKey(), newTx(allowed, 50))
+			So(err, ShouldBeNil)
+			_, err = checkSpending(privKey.PubKey(), newTx(allowed, 50))
+			So(errors.Cause(err), ShouldEqual, ErrDailySpendExceeded)
+			revert()
+			_, err = checkSpending(privKey.PubKey(), newTx(allowed, 50))
+			So(err, ShouldBeNil)
+		})
+		Convey("spending above threshold should be approved", func() {
+			err := signTx(privKey, newTx(allowed, 60))
+			So(errors.Cause(err), ShouldEqual, ErrSpendApprovalRequired)
+			SetSpendApprover(func(tx pi.Transaction, amount uint64) error {
+				if amount > 80 {
+					return errors.New("too much")
+				}
+				return nil
+			})
+			err = signTx(privKey, newTx(allowed, 90))
+			So(errors.Cause(err), ShouldEqual, ErrSpendNotApproved)
+			So(signTx(privKey, newTx(allowed, 60)), ShouldBeNil)
+		})
+		Convey("multi-signature transaction should be inspected", func() {
+			amount, receivers, isTransfer := txSpending(&types.MultiSig{
+				MultiSigHeader: types.MultiSigHeader{
+					Tx: *pi.WrapTransaction(newTx(other, 7)),
+				},
+			})
+			So(amount, ShouldEqual, 7)
+			So(receivers, ShouldResemble, []proto.AccountAddress{other})
+			So(isTransfer, ShouldBeTrue)
+		})
+		Convey("all receivers of batch transfer should be in the allowlist", func() {
+			var batch = func(receivers ...proto.AccountAddress) *types.TransferBatch {
+				var tx = types.NewTransferBatch(&types.TransferBatchHeader{})
+				for _, r := range receivers {
+					tx.Receivers = append(tx.Receivers, types.TransferReceiver{
+						Receiver: r,
+						Amount:   10,
+					})
+				}
+				return tx
+			}
+			err = signTx(privKey, batch(allowed, other))
+			So(errors.Cause(err), ShouldEqual, ErrReceiverNotAllowed)
+			So(signTx(privKey, batch(allowed, allowed)), ShouldBeNil)
+		})
+	})
+}
+
+func TestSpendLedger(t *testing.T) {
+	Convey("test persisted spending ledger", t, func() {
+		dir, err := ioutil.TempDir("", "spend_ledger")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		var (
+			path = filepath.Join(dir, "ledger.json")
+			addr = proto.AccountAddress{0x1}
+			now  = time.Now()
+		)
+		ledger, err := newSpendLedger(path)
+		So(err, ShouldBeNil)
+		_, err = ledger.reserve(addr, 100, 60, now)
+		So(err, ShouldBeNil)
+		revert, err := ledger.reserve(addr, 100, 30, now)
+		So(err, ShouldBeNil)
+		revert()
+
+		// the spending is counted by the next process
+		ledger, err = newSpendLedger(path)
+		So(err, ShouldBeNil)
+		_, err = ledger.reserve(addr, 100, 50, now)
+		So(errors.Cause(err), ShouldEqual, ErrDailySpendExceeded)
+		_, err = ledger.reserve(addr, 100, 40, now)
+		So(err, ShouldBeNil)
+	})
+}
+
+func TestPolicySigner(t *testing.T) {
+	Convey("test policy signer served to remote clients", t, func() {
+		dir, err := ioutil.TempDir("", "policy_signer")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		addr, err := crypto.PubKeyHash(privKey.PubKey())
+		So(err, ShouldBeNil)
+		var (
+			allowed = proto.AccountAddress{0x1}
+			policy  = &conf.SpendingPolicy{
+				MaxDailySpend:    100,
+				AllowedReceivers: []proto.AccountAddress{allowed},
+			}
+			ledgerFile = filepath.Join(dir, "ledger.json")
+			nonce      pi.AccountNonce
+			newTx      = func(receiver proto.AccountAddress, amount uint64) *types.Transfer {
+				nonce++
+				return types.NewTransfer(&types.TransferHeader{
+					Sender:   addr,
+					Receiver: receiver,
+					Amount:   amount,
+					Nonce:    nonce,
+				})
+			}
+		)
+		_, err = NewPolicySigner(privKey, policy, "", nil)
+		So(err, ShouldNotBeNil)
+		ps, err := NewPolicySigner(privKey, policy, ledgerFile, nil)
+		So(err, ShouldBeNil)
+		_, err = ps.Sign(make([]byte, 32))
+		So(errors.Cause(err), ShouldEqual, ErrTxSignerRequired)
+		server := httptest.NewServer(ps.Handler("token"))
+		defer server.Close()
+
+		_, err = NewRemoteSigner(server.URL, "wrong")
+		So(errors.Cause(err), ShouldEqual, ErrRemoteSignRejected)
+		rs, err := NewRemoteSigner(server.URL, "token")
+		So(err, ShouldBeNil)
+		So(rs.PubKey().IsEqual(privKey.PubKey()), ShouldBeTrue)
+
+		tx := newTx(allowed, 60)
+		So(signTx(rs, tx), ShouldBeNil)
+		So(tx.Verify(), ShouldBeNil)
+		err = signTx(rs, newTx(proto.AccountAddress{0x2}, 1))
+		So(errors.Cause(err), ShouldEqual, ErrRemoteSignRejected)
+		So(err.Error(), ShouldContainSubstring, "receiver not allowed")
+
+		// the ledger is kept by the signer across restarts
+		ps, err = NewPolicySigner(privKey, policy, ledgerFile, nil)
+		So(err, ShouldBeNil)
+		otx, err := PrepareTx(newTx(allowed, 50))
+		So(err, ShouldBeNil)
+		err = ps.SignTx(otx)
+		So(errors.Cause(err), ShouldEqual, ErrDailySpendExceeded)
+	})
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	netrpc "net/rpc"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// startStandbys connects up to n followers other than the serving ones in background. Each
+// standby is authenticated by a trivial read query, so it is ready to serve as soon as the
+// leader or the follower becomes unreachable.
+func (c *conn) startStandbys(peers *proto.Peers, n int) {
+	c.pconnLock.Lock()
+	defer c.pconnLock.Unlock()
+	var serving = make(map[proto.NodeID]bool)
+	for _, pc := range []*pconn{c.leader, c.follower} {
+		if pc != nil {
+			serving[proto.NodeID(pc.pCaller.Target())] = true
+		}
+	}
+	for _, i := range randSource.Perm(len(peers.Servers)) {
+		if len(c.standbys) >= n {
+			break
+		}
+		var node = peers.Servers[i]
+		if node == peers.Leader || serving[node] {
+			continue
+		}
+		var pc = c.newPConn(node)
+		c.standbys = append(c.standbys, pc)
+		c.standbyWg.Add(1)
+		go c.warmUp(pc)
+	}
+}
+
+// warmUp establishes the standby connection and marks it ready.
+func (c *conn) warmUp(pc *pconn) {
+	defer c.standbyWg.Done()
+	var (
+		le = log.WithFields(log.Fields{
+			"db":     c.dbID,
+			"target": pc.pCaller.Target(),
+		})
+		connID, seqNo = allocateConnAndSeq()
+		req           *types.Request
+		resp          types.Response
+		err           error
+	)
+	defer putBackConn(connID)
+	if req, err = c.newRequest(c.privKey, types.ReadQuery, connID, seqNo, []types.Query{
+		{Pattern: "SELECT 1"},
+	}); err != nil {
+		le.WithError(err).Warning("failed to build standby warm up request")
+		return
+	}
+	if err = pc.pCaller.Call(route.DBSQuery.String(), req, &resp); err != nil {
+		le.WithError(err).Debug("failed to warm up standby connection")
+		return
+	}
+	atomic.StoreInt32(&pc.ready, 1)
+	le.Debug("standby connection is ready")
+}
+
+// takeStandby removes and returns the first ready standby, or the standby to the node if node
+// is not empty regardless of its readiness. It must be called with c.pconnLock held.
+func (c *conn) takeStandby(node proto.NodeID) (pc *pconn) {
+	for i, v := range c.standbys {
+		if (node == "" && atomic.LoadInt32(&v.ready) == 1) ||
+			(node != "" && proto.NodeID(v.pCaller.Target()) == node) {
+			pc = v
+			c.standbys = append(c.standbys[:i], c.standbys[i+1:]...)
+			return
+		}
+	}
+	return
+}
+
+// failover replaces the failed peer connection and returns the new one, or nil if the query
+// error is returned by the miner or no replacement is available. Reads are taken over by a
+// ready standby instantly. The leader is only replaced by the one assigned by block producers,
+// which is still promoted from the standbys if it is connected already.
+func (c *conn) failover(failed *pconn, queryType types.QueryType, cause error) (next *pconn) {
+	if isMinerError(cause) {
+		return
+	}
+	var le = log.WithFields(log.Fields{
+		"db":     c.dbID,
+		"failed": failed.pCaller.Target(),
+	})
+
+	if queryType == types.WriteQuery {
+		if leader, _ := c.servingPConns(); failed != leader {
+			return
+		}
+		// refresh the peers without holding the lock
+		peerList.Delete(c.dbID)
+		peers, err := cacheGetPeers(c.dbID, c.privKey)
+		if err != nil {
+			le.WithError(err).Warning("failed to refresh peers for leader failover")
+			return
+		}
+		return c.switchLeader(failed, peers)
+	}
+
+	c.pconnLock.Lock()
+	defer c.pconnLock.Unlock()
+	var serving = failed == c.leader || failed == c.follower
+	for _, f := range c.followers {
+		serving = serving || f == failed
+	}
+	if !serving {
+		// replaced by a concurrent failover already
+		return c.follower
+	}
+	if next = c.takeStandby(""); next == nil {
+		return
+	}
+	_ = next.startAckWorkers()
+	if failed != c.leader {
+		go failed.close()
+	}
+	for i, f := range c.followers {
+		if f == failed {
+			c.followers[i] = next
+		}
+	}
+	c.follower = next
+	le.WithField("standby", next.pCaller.Target()).Info("promoted standby for reads")
+	return
+}
+
+// switchLeader replaces the failed leader by the leader assigned in peers, which is promoted from
+// the standbys if it is connected already.
+func (c *conn) switchLeader(failed *pconn, peers *proto.Peers) (next *pconn) {
+	c.pconnLock.Lock()
+	defer c.pconnLock.Unlock()
+	if failed != c.leader || peers.Leader == proto.NodeID(failed.pCaller.Target()) {
+		return
+	}
+	if next = c.takeStandby(peers.Leader); next == nil {
+		next = c.newPConn(peers.Leader)
+	}
+	_ = next.startAckWorkers()
+	c.leader = next
+	go failed.close()
+	log.WithFields(log.Fields{
+		"db":     c.dbID,
+		"failed": failed.pCaller.Target(),
+		"leader": peers.Leader,
+	}).Info("switched to new leader")
+	return
+}
+
+// servingPConns returns the current leader and follower connections.
+func (c *conn) servingPConns() (leader, follower *pconn) {
+	c.pconnLock.Lock()
+	defer c.pconnLock.Unlock()
+	return c.leader, c.follower
+}
+
+// isMinerError returns if the error is returned by the miner, instead of a transport failure.
+func isMinerError(err error) (ok bool) {
+	_, ok = errors.Cause(err).(netrpc.ServerError)
+	return
+}
+
+// closeStandbys closes all the standby connections.
+func (c *conn) closeStandbys() {
+	c.pconnLock.Lock()
+	var standbys = c.standbys
+	c.standbys = nil
+	c.pconnLock.Unlock()
+	for _, pc := range standbys {
+		_ = pc.close()
+	}
+	c.standbyWg.Wait()
+}
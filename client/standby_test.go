@@ -0,0 +1,132 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	netrpc "net/rpc"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/rpc"
+	"github.com/SQLess/SQLess/types"
+)
+
+type fakeCaller struct {
+	target string
+	err    error
+	calls  int32
+}
+
+func (f *fakeCaller) Call(method string, request interface{}, reply interface{}) error {
+	atomic.AddInt32(&f.calls, 1)
+	return f.err
+}
+
+func (f *fakeCaller) Close() {}
+
+func (f *fakeCaller) Target() string {
+	return f.target
+}
+
+func (f *fakeCaller) New() rpc.PCaller {
+	return f
+}
+
+func newFakePConn(c *conn, target string, err error) *pconn {
+	return &pconn{
+		wg:      &sync.WaitGroup{},
+		ackCh:   make(chan *types.Ack, workerCount*4),
+		parent:  c,
+		pCaller: &fakeCaller{target: target, err: err},
+	}
+}
+
+func TestStandby(t *testing.T) {
+	Convey("Given a connection with standbys", t, func() {
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		var (
+			c = &conn{dbID: "standby-db", privKey: priv}
+
+			leader   = newFakePConn(c, "leader", nil)
+			follower = newFakePConn(c, "follower", nil)
+			ready    = newFakePConn(c, "ready", nil)
+			broken   = newFakePConn(c, "broken", errors.New("connection refused"))
+
+			transport = errors.New("connection reset by peer")
+		)
+		c.leader, c.follower, c.followers = leader, follower, []*pconn{follower}
+		c.standbys = []*pconn{broken, ready}
+		defer c.Close()
+
+		c.standbyWg.Add(2)
+		c.warmUp(broken)
+		c.warmUp(ready)
+		So(atomic.LoadInt32(&broken.ready), ShouldEqual, 0)
+		So(atomic.LoadInt32(&ready.ready), ShouldEqual, 1)
+		So(ready.pCaller.(*fakeCaller).calls, ShouldEqual, 1)
+
+		Convey("The miner errors should not fail over", func() {
+			So(c.failover(follower, types.ReadQuery, netrpc.ServerError("no such table")), ShouldBeNil)
+			So(c.follower, ShouldEqual, follower)
+		})
+
+		Convey("The failed follower should be taken over by the ready standby", func() {
+			var (
+				wg      sync.WaitGroup
+				results = make([]*pconn, 4)
+			)
+			// the concurrent failovers of the same follower promote one standby only
+			for i := range results {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i] = c.failover(follower, types.ReadQuery, transport)
+					_, _ = c.servingPConns()
+				}(i)
+			}
+			wg.Wait()
+			for _, v := range results {
+				So(v, ShouldEqual, ready)
+			}
+			So(c.follower, ShouldEqual, ready)
+			So(c.followers, ShouldResemble, []*pconn{ready})
+			So(c.standbys, ShouldResemble, []*pconn{broken})
+
+			// the standby not ready is not promoted for reads
+			So(c.failover(ready, types.ReadQuery, transport), ShouldBeNil)
+		})
+
+		Convey("The failed leader should be replaced by the assigned one", func() {
+			var peers = &proto.Peers{PeersHeader: proto.PeersHeader{Leader: "broken"}}
+			So(c.switchLeader(follower, peers), ShouldBeNil)
+			So(c.switchLeader(leader, &proto.Peers{PeersHeader: proto.PeersHeader{Leader: "leader"}}), ShouldBeNil)
+
+			// the standby to the assigned leader is promoted regardless of its readiness
+			So(c.switchLeader(leader, peers), ShouldEqual, broken)
+			So(c.leader, ShouldEqual, broken)
+			So(c.standbys, ShouldResemble, []*pconn{ready})
+			So(c.switchLeader(leader, peers), ShouldBeNil)
+		})
+	})
+}
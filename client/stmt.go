@@ -26,6 +26,8 @@ type stmt struct {
 	c       *conn
 	closed  int32
 	pattern string
+	// ddl reports whether the statement changes the schema.
+	ddl bool
 }
 
 func newStmt(c *conn, query string) (s *stmt) {
@@ -62,7 +64,7 @@ func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (drive
 		return nil, driver.ErrBadConn
 	}
 
-	return s.c.ExecContext(ctx, s.pattern, args)
+	return s.c.execContext(ctx, s.pattern, args, s.ddl)
 }
 
 // Close closes the statement.
@@ -0,0 +1,165 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/SQLess/sqlparser"
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+// DefaultStmtCacheSize is the default max prepared statements cached by the driver.
+const DefaultStmtCacheSize = 256
+
+var (
+	stmtCacheLock sync.RWMutex
+	stmtCache     *lru.Cache
+
+	stmtCacheHits          uint64
+	stmtCacheMisses        uint64
+	stmtCacheInvalidations uint64
+)
+
+func init() {
+	SetStmtCacheSize(DefaultStmtCacheSize)
+}
+
+// stmtCacheKey is the key of a prepared statement in the cache.
+type stmtCacheKey struct {
+	dbID  proto.DatabaseID
+	query string
+}
+
+// preparedQuery is the parse result of a prepared statement, which is shared by the statements
+// of the same database and query.
+type preparedQuery struct {
+	// ddl reports whether the statement changes the schema.
+	ddl bool
+	// err is the syntax error of the statement.
+	err error
+}
+
+// StmtCacheStats defines the statistics of the prepared statement cache.
+type StmtCacheStats struct {
+	Hits          uint64
+	Misses        uint64
+	Invalidations uint64
+	Len           int
+}
+
+// HitRate returns the ratio of the prepares served by the cache.
+func (s StmtCacheStats) HitRate() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// SetStmtCacheSize sets the max prepared statements cached by the driver, the cached statements
+// are dropped. A non-positive size disables the cache.
+func SetStmtCacheSize(size int) {
+	var cache *lru.Cache
+	if size > 0 {
+		cache, _ = lru.New(size)
+	}
+	stmtCacheLock.Lock()
+	defer stmtCacheLock.Unlock()
+	stmtCache = cache
+}
+
+// GetStmtCacheStats returns the statistics of the prepared statement cache.
+func GetStmtCacheStats() (stats StmtCacheStats) {
+	stats = StmtCacheStats{
+		Hits:          atomic.LoadUint64(&stmtCacheHits),
+		Misses:        atomic.LoadUint64(&stmtCacheMisses),
+		Invalidations: atomic.LoadUint64(&stmtCacheInvalidations),
+	}
+	stmtCacheLock.RLock()
+	defer stmtCacheLock.RUnlock()
+	if stmtCache != nil {
+		stats.Len = stmtCache.Len()
+	}
+	return
+}
+
+// getPreparedQuery returns the cached analysis of the query, the query is analyzed on cache miss.
+func getPreparedQuery(dbID proto.DatabaseID, query string) (pq *preparedQuery) {
+	stmtCacheLock.RLock()
+	var cache = stmtCache
+	stmtCacheLock.RUnlock()
+	if cache == nil {
+		return analyzeQuery(query)
+	}
+
+	var key = stmtCacheKey{dbID: dbID, query: query}
+	if v, ok := cache.Get(key); ok {
+		atomic.AddUint64(&stmtCacheHits, 1)
+		return v.(*preparedQuery)
+	}
+	atomic.AddUint64(&stmtCacheMisses, 1)
+	pq = analyzeQuery(query)
+	cache.Add(key, pq)
+	return
+}
+
+// invalidateStmtCache drops the cached statements of the database after its schema changes.
+func invalidateStmtCache(dbID proto.DatabaseID) {
+	stmtCacheLock.RLock()
+	var cache = stmtCache
+	stmtCacheLock.RUnlock()
+	if cache == nil {
+		return
+	}
+	for _, k := range cache.Keys() {
+		if k.(stmtCacheKey).dbID == dbID {
+			cache.Remove(k)
+		}
+	}
+	atomic.AddUint64(&stmtCacheInvalidations, 1)
+}
+
+// isSchemaChange reports whether the query changes the schema of the database.
+func isSchemaChange(query string) bool {
+	return sqlparser.Preview(query) == sqlparser.StmtDDL
+}
+
+// analyzeQuery parses the query in the same way as the miners, the transaction statements are
+// left to the miners.
+func analyzeQuery(query string) (pq *preparedQuery) {
+	pq = &preparedQuery{}
+	if lower := strings.ToLower(query); strings.Contains(lower, "begin") ||
+		strings.Contains(lower, "rollback") || strings.Contains(lower, "commit") {
+		pq.ddl = isSchemaChange(query)
+		return
+	}
+	var statements []sqlparser.Statement
+	if _, statements, pq.err = sqlparser.ParseMultiple(sqlparser.NewStringTokenizer(query)); pq.err != nil {
+		pq.err = errors.Wrap(pq.err, "parse sql failed")
+		return
+	}
+	for _, s := range statements {
+		if _, ok := s.(*sqlparser.DDL); ok {
+			pq.ddl = true
+		}
+	}
+	return
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestStmtCache(t *testing.T) {
+	Convey("test prepared statement cache", t, func() {
+		SetStmtCacheSize(2)
+		defer SetStmtCacheSize(DefaultStmtCacheSize)
+		var (
+			db1   = proto.DatabaseID("db1")
+			db2   = proto.DatabaseID("db2")
+			query = "SELECT * FROM test WHERE id = ?"
+			base  = GetStmtCacheStats()
+		)
+
+		pq := getPreparedQuery(db1, query)
+		So(pq.err, ShouldBeNil)
+		So(pq.ddl, ShouldBeFalse)
+		So(getPreparedQuery(db1, query), ShouldEqual, pq)
+		So(getPreparedQuery(db2, query), ShouldNotEqual, pq)
+		stats := GetStmtCacheStats()
+		So(stats.Hits-base.Hits, ShouldEqual, 1)
+		So(stats.Misses-base.Misses, ShouldEqual, 2)
+		So(stats.Len, ShouldEqual, 2)
+
+		// the least recently used statement is evicted
+		So(getPreparedQuery(db1, "SELECT 1").err, ShouldBeNil)
+		So(GetStmtCacheStats().Len, ShouldEqual, 2)
+		So(getPreparedQuery(db2, query), ShouldNotEqual, pq)
+
+		// syntax errors are cached too
+		pq = getPreparedQuery(db1, "SELEC * FROM test")
+		So(pq.err, ShouldNotBeNil)
+		So(getPreparedQuery(db1, "SELEC * FROM test"), ShouldEqual, pq)
+
+		So(getPreparedQuery(db1, "CREATE TABLE t2 (id INT)").ddl, ShouldBeTrue)
+		So(getPreparedQuery(db1, "BEGIN").err, ShouldBeNil)
+		So(isSchemaChange("DROP TABLE t2"), ShouldBeTrue)
+		So(isSchemaChange("INSERT INTO t2 VALUES (1)"), ShouldBeFalse)
+
+		// schema changes invalidate the statements of the database only
+		pq = getPreparedQuery(db2, query)
+		invalidateStmtCache(db1)
+		So(GetStmtCacheStats().Len, ShouldEqual, 1)
+		So(getPreparedQuery(db2, query), ShouldEqual, pq)
+
+		SetStmtCacheSize(0)
+		So(getPreparedQuery(db1, query), ShouldNotEqual, getPreparedQuery(db1, query))
+		So(GetStmtCacheStats().Len, ShouldEqual, 0)
+	})
+}
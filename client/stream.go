@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+// DefaultStreamPageSize defines the default rows count of a page fetched by a streaming read.
+const DefaultStreamPageSize = 1000
+
+var (
+	ctxStreamKey = "_cql_stream"
+)
+
+// WithStreaming returns a context which streams the result set of the read query in pages of at
+// most size rows, DefaultStreamPageSize is used if size is 0. The pages are fetched from the
+// server-side cursor on the serving miner as the rows are iterated, so large result sets are
+// iterated with bounded memory on both sides. Closing the rows before the result set is exhausted
+// releases the cursor on the miner.
+//
+// Streaming reads are not supported in transactions, the queries in transactions are executed as
+// usual.
+func WithStreaming(ctx context.Context, size uint32) context.Context {
+	if size == 0 {
+		size = DefaultStreamPageSize
+	}
+	return context.WithValue(ctx, &ctxStreamKey, size)
+}
+
+func getStreamPageSize(ctx context.Context) (size uint32, ok bool) {
+	size, ok = ctx.Value(&ctxStreamKey).(uint32)
+	return
+}
+
+// streamRows iterates the result set page by page, only the current page is held in memory.
+type streamRows struct {
+	*rows
+	ctx   context.Context
+	c     *conn
+	query types.Query
+	size  uint32
+	token []byte
+}
+
+func (c *conn) queryStream(ctx context.Context, sq *types.Query, size uint32) (driver.Rows, error) {
+	var s = &streamRows{
+		ctx:   ctx,
+		c:     c,
+		query: *sq,
+		size:  size,
+	}
+	if err := s.fetch(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// fetch reads the next page of the result set, the first page opens the cursor on the miner.
+func (s *streamRows) fetch() (err error) {
+	var (
+		ctx = WithPage(s.ctx, s.size, s.token)
+		dr  driver.Rows
+	)
+	if _, _, dr, err = s.c.sendQuery(ctx, types.ReadQuery, []types.Query{s.query}); err != nil {
+		return
+	}
+	s.rows = dr.(*rows)
+	s.token, _ = GetNextPage(ctx)
+	return
+}
+
+// Next implements driver.Rows.Next method, the next page is fetched once the current page is
+// consumed.
+func (s *streamRows) Next(dest []driver.Value) (err error) {
+	for {
+		if err = s.rows.Next(dest); err != io.EOF || len(s.token) == 0 {
+			return
+		}
+		if err = s.fetch(); err != nil {
+			return
+		}
+	}
+}
+
+// Close implements driver.Rows.Close method, the cursor on the miner is released if the result
+// set is not exhausted yet.
+func (s *streamRows) Close() (err error) {
+	_ = s.rows.Close()
+	if len(s.token) == 0 {
+		return
+	}
+	var ctx = withPageClose(context.Background(), s.size, s.token)
+	s.token = nil
+	_, _, _, err = s.c.sendQuery(ctx, types.ReadQuery, []types.Query{s.query})
+	return
+}
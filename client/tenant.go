@@ -0,0 +1,249 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+)
+
+const mwClientTenant = "service:client:tenant"
+
+// tenantVars holds the metrics of tenants keyed by tenant id.
+var tenantVars = expvar.NewMap(mwClientTenant)
+
+// TenantConfig defines a logical tenant served by a TenantPool.
+type TenantConfig struct {
+	// DSN of the database of the tenant.
+	DSN string
+	// PrivateKey is the credential of the tenant, the local private key is used if nil.
+	PrivateKey *asymmetric.PrivateKey
+	// QPS limits the queries per second of the tenant, 0 for unlimited.
+	QPS float64
+	// Burst is the max queries in a burst, defaults to QPS.
+	Burst int
+	// MaxOpenConns limits the open connections of the tenant, 0 for unlimited.
+	MaxOpenConns int
+}
+
+// TenantPool maps many logical tenants to their own databases and credentials, so a single
+// gateway could serve all the tenants of a SaaS product:
+//
+//	p := client.NewTenantPool()
+//	err := p.AddTenant("acme", &client.TenantConfig{
+//		DSN:        "sqless://<db>",
+//		PrivateKey: acmeKey,
+//		QPS:        100,
+//	})
+//	rows, err := p.QueryContext(ctx, "acme", "SELECT * FROM orders")
+//
+// Queries exceeding the rate limit of the tenant fail fast with ErrTenantRateLimited. The
+// metrics of each tenant are published to expvar under "service:client:tenant".
+type TenantPool struct {
+	sync.RWMutex
+	tenants map[string]*tenant
+}
+
+type tenant struct {
+	db      *sql.DB
+	limiter *tokenBucket
+	vars    *expvar.Map
+}
+
+// NewTenantPool returns a new empty tenant pool.
+func NewTenantPool() *TenantPool {
+	return &TenantPool{
+		tenants: make(map[string]*tenant),
+	}
+}
+
+// AddTenant registers the tenant to the pool.
+func (p *TenantPool) AddTenant(id string, cfg *TenantConfig) (err error) {
+	dsnCfg, err := ParseDSN(cfg.DSN)
+	if err != nil {
+		return
+	}
+	dsnCfg.PrivateKey = cfg.PrivateKey
+
+	p.Lock()
+	defer p.Unlock()
+	if _, ok := p.tenants[id]; ok {
+		return errors.Wrapf(ErrTenantExists, "add tenant %s failed", id)
+	}
+	var t = &tenant{
+		db:   sql.OpenDB(NewConnector(dsnCfg)),
+		vars: new(expvar.Map).Init(),
+	}
+	t.db.SetMaxOpenConns(cfg.MaxOpenConns)
+	if cfg.QPS > 0 {
+		t.limiter = newTokenBucket(cfg.QPS, cfg.Burst)
+	}
+	p.tenants[id] = t
+	tenantVars.Set(id, t.vars)
+	return
+}
+
+// RemoveTenant unregisters the tenant and closes its database.
+func (p *TenantPool) RemoveTenant(id string) (err error) {
+	p.Lock()
+	t, ok := p.tenants[id]
+	delete(p.tenants, id)
+	p.Unlock()
+	if !ok {
+		return errors.Wrapf(ErrUnknownTenant, "remove tenant %s failed", id)
+	}
+	tenantVars.Delete(id)
+	return t.db.Close()
+}
+
+// Tenants returns the sorted ids of registered tenants.
+func (p *TenantPool) Tenants() (ids []string) {
+	p.RLock()
+	defer p.RUnlock()
+	ids = make([]string, 0, len(p.tenants))
+	for id := range p.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return
+}
+
+// DB returns the database of the tenant, queries run on it directly bypass the rate limit
+// and metrics of the tenant.
+func (p *TenantPool) DB(id string) (db *sql.DB, err error) {
+	t, err := p.get(id)
+	if err != nil {
+		return
+	}
+	return t.db, nil
+}
+
+// QueryContext runs the read query in the database of the tenant.
+func (p *TenantPool) QueryContext(ctx context.Context, id string, query string, args ...interface{}) (
+	rows *sql.Rows, err error,
+) {
+	t, err := p.acquire(id, "query")
+	if err != nil {
+		return
+	}
+	defer t.observe(time.Now(), &err)
+	return t.db.QueryContext(ctx, query, args...)
+}
+
+// ExecContext runs the write query in the database of the tenant.
+func (p *TenantPool) ExecContext(ctx context.Context, id string, query string, args ...interface{}) (
+	result sql.Result, err error,
+) {
+	t, err := p.acquire(id, "exec")
+	if err != nil {
+		return
+	}
+	defer t.observe(time.Now(), &err)
+	return t.db.ExecContext(ctx, query, args...)
+}
+
+// Close closes the databases of all tenants.
+func (p *TenantPool) Close() (err error) {
+	p.Lock()
+	defer p.Unlock()
+	for id, t := range p.tenants {
+		if closeErr := t.db.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		tenantVars.Delete(id)
+	}
+	p.tenants = make(map[string]*tenant)
+	return
+}
+
+func (p *TenantPool) get(id string) (t *tenant, err error) {
+	p.RLock()
+	defer p.RUnlock()
+	var ok bool
+	if t, ok = p.tenants[id]; !ok {
+		err = errors.Wrapf(ErrUnknownTenant, "tenant %s", id)
+	}
+	return
+}
+
+func (p *TenantPool) acquire(id string, kind string) (t *tenant, err error) {
+	if t, err = p.get(id); err != nil {
+		return
+	}
+	if t.limiter != nil && !t.limiter.allow(time.Now()) {
+		t.vars.Add("limited", 1)
+		return nil, errors.Wrapf(ErrTenantRateLimited, "tenant %s", id)
+	}
+	t.vars.Add(kind, 1)
+	return
+}
+
+func (t *tenant) observe(start time.Time, err *error) {
+	t.vars.Add("duration_us", time.Since(start).Microseconds())
+	if *err != nil {
+		t.vars.Add("errors", 1)
+	}
+}
+
+// tokenBucket is a simple token bucket rate limiter.
+type tokenBucket struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	var b = float64(burst)
+	if b < 1 {
+		b = rate
+	}
+	if b < 1 {
+		b = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  b,
+		tokens: b,
+	}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTenantPool(t *testing.T) {
+	Convey("test tenant pool", t, func() {
+		p := NewTenantPool()
+		defer p.Close()
+
+		So(p.AddTenant("acme", &TenantConfig{DSN: "sqless://acme-db", QPS: 1}), ShouldBeNil)
+		So(p.AddTenant("initech", &TenantConfig{DSN: "sqless://initech-db"}), ShouldBeNil)
+		err := p.AddTenant("acme", &TenantConfig{DSN: "sqless://other-db"})
+		So(errors.Cause(err), ShouldEqual, ErrTenantExists)
+		So(p.Tenants(), ShouldResemble, []string{"acme", "initech"})
+
+		_, err = p.DB("unknown")
+		So(errors.Cause(err), ShouldEqual, ErrUnknownTenant)
+		_, err = p.QueryContext(context.Background(), "unknown", "SELECT 1")
+		So(errors.Cause(err), ShouldEqual, ErrUnknownTenant)
+
+		// the burst of acme is exhausted after the first acquire
+		_, err = p.acquire("acme", "query")
+		So(err, ShouldBeNil)
+		_, err = p.QueryContext(context.Background(), "acme", "SELECT 1")
+		So(errors.Cause(err), ShouldEqual, ErrTenantRateLimited)
+		So(tenantVars.Get("acme").String(), ShouldContainSubstring, `"limited": 1`)
+
+		So(p.RemoveTenant("initech"), ShouldBeNil)
+		So(errors.Cause(p.RemoveTenant("initech")), ShouldEqual, ErrUnknownTenant)
+		So(tenantVars.Get("initech"), ShouldBeNil)
+	})
+	Convey("test token bucket", t, func() {
+		var (
+			now = time.Now()
+			b   = newTokenBucket(10, 2)
+		)
+		So(b.allow(now), ShouldBeTrue)
+		So(b.allow(now), ShouldBeTrue)
+		So(b.allow(now), ShouldBeFalse)
+		So(b.allow(now.Add(100*time.Millisecond)), ShouldBeTrue)
+		So(b.allow(now.Add(100*time.Millisecond)), ShouldBeFalse)
+		// refill is capped by burst
+		So(b.allow(now.Add(time.Hour)), ShouldBeTrue)
+		So(b.allow(now.Add(time.Hour)), ShouldBeTrue)
+		So(b.allow(now.Add(time.Hour)), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+)
+
+// TableUsage returns the approximate storage usage of each table of the database, only the
+// database owner is allowed. The same figures could also be read by any user with read
+// permission from the "__sqless_table_usage" system table.
+func TableUsage(ctx context.Context, dsn string) (tables []types.TableUsage, err error) {
+	var s *blobSession
+	if s, err = newBlobSession(dsn); err != nil {
+		return
+	}
+	defer s.close()
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	req := &types.TableUsageReq{
+		Header: types.SignedTableUsageHeader{
+			TableUsageHeader: types.TableUsageHeader{
+				DatabaseID: s.dbID,
+				Timestamp:  getLocalTime(),
+			},
+		},
+	}
+	if err = req.Header.Sign(s.privKey); err != nil {
+		return
+	}
+	resp := &types.TableUsageResp{}
+	if err = s.caller.Call(route.DBSTableUsage.String(), req, resp); err != nil {
+		return
+	}
+	tables = resp.Tables
+	return
+}
@@ -0,0 +1,282 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"sort"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/rpc"
+	"github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/xenomint"
+)
+
+// diffBuckets defines the buckets to split a divergent rowid range into on each round.
+const diffBuckets = 64
+
+// RowDigester computes the row digests of a table on a database replica or a backup file.
+type RowDigester interface {
+	RowDigests(ctx context.Context, table string, from, to int64, buckets uint32) (
+		ranges []types.RowRangeDigest, rows []types.RowDigest, err error)
+	Close() error
+}
+
+// ReplicaNodes returns the miners serving the database, the leader comes first.
+func ReplicaNodes(dsn string) (nodes []proto.NodeID, err error) {
+	var (
+		cfg     *Config
+		privKey *asymmetric.PrivateKey
+		peers   *proto.Peers
+	)
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	if privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	if peers, err = cacheGetPeers(proto.DatabaseID(cfg.DatabaseID), privKey); err != nil {
+		return
+	}
+	nodes = append(nodes, peers.Leader)
+	for _, n := range peers.Servers {
+		if n != peers.Leader {
+			nodes = append(nodes, n)
+		}
+	}
+	return
+}
+
+type replicaDigester struct {
+	dbID    proto.DatabaseID
+	privKey *asymmetric.PrivateKey
+	caller  rpc.PCaller
+}
+
+// NewReplicaDigester returns a RowDigester of the database replica on the miner node, only the
+// database owner is allowed.
+func NewReplicaDigester(dsn string, node proto.NodeID) (d RowDigester, err error) {
+	if atomic.LoadUint32(&driverInitialized) == 0 {
+		err = ErrNotInitialized
+		return
+	}
+	var (
+		cfg *Config
+		r   = &replicaDigester{}
+	)
+	if cfg, err = ParseDSN(dsn); err != nil {
+		return
+	}
+	r.dbID = proto.DatabaseID(cfg.DatabaseID)
+	if r.privKey, err = kms.GetLocalPrivateKey(); err != nil {
+		return
+	}
+	if cfg.UseDirectRPC {
+		r.caller = rpc.NewPersistentCaller(node)
+	} else {
+		r.caller = mux.NewPersistentCaller(node)
+	}
+	return r, nil
+}
+
+func (r *replicaDigester) RowDigests(ctx context.Context, table string, from, to int64, buckets uint32) (
+	ranges []types.RowRangeDigest, rows []types.RowDigest, err error,
+) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	req := &types.RowDigestsReq{
+		Header: types.SignedRowDigestsHeader{
+			RowDigestsHeader: types.RowDigestsHeader{
+				DatabaseID: r.dbID,
+				Table:      table,
+				From:       from,
+				To:         to,
+				Buckets:    buckets,
+				Timestamp:  getLocalTime(),
+			},
+		},
+	}
+	if err = req.Header.Sign(r.privKey); err != nil {
+		return
+	}
+	resp := &types.RowDigestsResp{}
+	if err = r.caller.Call(route.DBSRowDigests.String(), req, resp); err != nil {
+		err = errors.Wrapf(err, "get row digests from %s", r.caller.Target())
+		return
+	}
+	return resp.Ranges, resp.Rows, nil
+}
+
+func (r *replicaDigester) Close() error {
+	r.caller.Close()
+	return nil
+}
+
+type fileDigester struct {
+	db *sql.DB
+}
+
+// NewFileDigester returns a RowDigester of a local SQLite file, e.g. a backup or an exported
+// database file.
+func NewFileDigester(filename string) (d RowDigester, err error) {
+	var db *sql.DB
+	if db, err = sql.Open("sqlite3", "file:"+filename+"?mode=ro"); err != nil {
+		return
+	}
+	if err = db.Ping(); err != nil {
+		_ = db.Close()
+		return
+	}
+	return &fileDigester{db: db}, nil
+}
+
+func (f *fileDigester) RowDigests(ctx context.Context, table string, from, to int64, buckets uint32) (
+	ranges []types.RowRangeDigest, rows []types.RowDigest, err error,
+) {
+	return xenomint.DigestRows(ctx, f.db, table, from, to, buckets)
+}
+
+func (f *fileDigester) Close() error {
+	return f.db.Close()
+}
+
+// TableDiff defines the divergent rows of a table between two replicas by rowid.
+type TableDiff struct {
+	Table    string
+	OnlyA    []int64 // rows only present in replica A
+	OnlyB    []int64 // rows only present in replica B
+	Changed  []int64 // rows present in both replicas with different contents
+	Requests int     // digest requests sent to each replica
+}
+
+// Equal returns whether the table is the same in both replicas.
+func (d *TableDiff) Equal() bool {
+	return len(d.OnlyA) == 0 && len(d.OnlyB) == 0 && len(d.Changed) == 0
+}
+
+// DiffTable compares the rows of the table between two replicas without dumping them. The rowid
+// space is hashed in chunks, and divergent chunks are split again until they are small enough
+// to be compared row by row. The replicas should not be written during the comparison, or the
+// rows written meanwhile may be reported as divergent.
+func DiffTable(ctx context.Context, a, b RowDigester, table string) (diff *TableDiff, err error) {
+	diff = &TableDiff{Table: table}
+	if err = diffRange(ctx, a, b, diff, math.MinInt64, math.MaxInt64); err != nil {
+		diff = nil
+		return
+	}
+	for _, ids := range [][]int64{diff.OnlyA, diff.OnlyB, diff.Changed} {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+	return
+}
+
+func diffRange(ctx context.Context, a, b RowDigester, diff *TableDiff, from, to int64) (err error) {
+	var ra, rb []types.RowRangeDigest
+	if ra, _, err = a.RowDigests(ctx, diff.Table, from, to, diffBuckets); err != nil {
+		return
+	}
+	if rb, _, err = b.RowDigests(ctx, diff.Table, from, to, diffBuckets); err != nil {
+		return
+	}
+	diff.Requests++
+
+	var (
+		byFrom = make(map[int64][2]*types.RowRangeDigest, len(ra)+len(rb))
+		froms  []int64
+	)
+	for i, rs := range [][]types.RowRangeDigest{ra, rb} {
+		for j := range rs {
+			pair, ok := byFrom[rs[j].From]
+			if !ok {
+				froms = append(froms, rs[j].From)
+			}
+			pair[i] = &rs[j]
+			byFrom[rs[j].From] = pair
+		}
+	}
+	sort.Slice(froms, func(i, j int) bool { return froms[i] < froms[j] })
+
+	for _, f := range froms {
+		var (
+			pair = byFrom[f]
+			ref  = pair[0]
+			rows uint64
+		)
+		if pair[0] != nil && pair[1] != nil &&
+			pair[0].Rows == pair[1].Rows && pair[0].Hash.IsEqual(&pair[1].Hash) {
+			continue
+		}
+		for _, r := range pair {
+			if r != nil && r.Rows > rows {
+				rows = r.Rows
+			}
+		}
+		if ref == nil {
+			ref = pair[1]
+		}
+		if rows <= xenomint.MaxRowDigests || ref.From == ref.To {
+			err = diffRows(ctx, a, b, diff, ref.From, ref.To)
+		} else {
+			err = diffRange(ctx, a, b, diff, ref.From, ref.To)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func diffRows(ctx context.Context, a, b RowDigester, diff *TableDiff, from, to int64) (err error) {
+	var rowsA, rowsB []types.RowDigest
+	if _, rowsA, err = a.RowDigests(ctx, diff.Table, from, to, 0); err != nil {
+		return
+	}
+	if _, rowsB, err = b.RowDigests(ctx, diff.Table, from, to, 0); err != nil {
+		return
+	}
+	diff.Requests++
+
+	var inB = make(map[int64]*types.RowDigest, len(rowsB))
+	for i := range rowsB {
+		inB[rowsB[i].RowID] = &rowsB[i]
+	}
+	for _, r := range rowsA {
+		rb, ok := inB[r.RowID]
+		if !ok {
+			diff.OnlyA = append(diff.OnlyA, r.RowID)
+			continue
+		}
+		if !rb.Hash.IsEqual(&r.Hash) {
+			diff.Changed = append(diff.Changed, r.RowID)
+		}
+		delete(inB, r.RowID)
+	}
+	for id := range inB {
+		diff.OnlyB = append(diff.OnlyB, id)
+	}
+	return
+}
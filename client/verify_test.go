@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiffTable(t *testing.T) {
+	Convey("test diff table between replicas", t, func() {
+		dir, err := ioutil.TempDir("", "verify")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var files = []string{path.Join(dir, "a.db"), path.Join(dir, "b.db")}
+		for _, f := range files {
+			db, err := sql.Open("sqlite3", f)
+			So(err, ShouldBeNil)
+			_, err = db.Exec(`CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT)`)
+			So(err, ShouldBeNil)
+			tx, err := db.Begin()
+			So(err, ShouldBeNil)
+			for i := 1; i <= 20000; i++ {
+				_, err = tx.Exec(`INSERT INTO t VALUES (?, ?)`, i, "value")
+				So(err, ShouldBeNil)
+			}
+			So(tx.Commit(), ShouldBeNil)
+			if f == files[1] {
+				_, err = db.Exec(`UPDATE t SET v = 'changed' WHERE id IN (7, 15000)`)
+				So(err, ShouldBeNil)
+				_, err = db.Exec(`DELETE FROM t WHERE id = 12345`)
+				So(err, ShouldBeNil)
+				_, err = db.Exec(`INSERT INTO t VALUES (-5, 'negative')`)
+				So(err, ShouldBeNil)
+			}
+			So(db.Close(), ShouldBeNil)
+		}
+
+		a, err := NewFileDigester(files[0])
+		So(err, ShouldBeNil)
+		defer a.Close()
+		b, err := NewFileDigester(files[1])
+		So(err, ShouldBeNil)
+		defer b.Close()
+
+		diff, err := DiffTable(context.Background(), a, b, "t")
+		So(err, ShouldBeNil)
+		So(diff.Equal(), ShouldBeFalse)
+		So(diff.OnlyA, ShouldResemble, []int64{12345})
+		So(diff.OnlyB, ShouldResemble, []int64{-5})
+		So(diff.Changed, ShouldResemble, []int64{7, 15000})
+
+		diff, err = DiffTable(context.Background(), a, a, "t")
+		So(err, ShouldBeNil)
+		So(diff.Equal(), ShouldBeTrue)
+		So(diff.Requests, ShouldEqual, 1)
+
+		_, err = DiffTable(context.Background(), a, b, "not_exist")
+		So(err, ShouldNotBeNil)
+	})
+}
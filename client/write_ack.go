@@ -0,0 +1,40 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+var (
+	ctxWriteAckKey = "_cql_write_ack"
+)
+
+// WithWriteAck returns a context which requires the write queries executed with it to be
+// acknowledged by the given replicas before succeeding, e.g. for critical writes. It only raises
+// the write ack of the database, a weaker write ack is ignored by the miner.
+func WithWriteAck(ctx context.Context, ack types.WriteAck) context.Context {
+	return context.WithValue(ctx, &ctxWriteAckKey, ack)
+}
+
+// getWriteAck returns the write ack of the context.
+func getWriteAck(ctx context.Context) types.WriteAck {
+	ack, _ := ctx.Value(&ctxWriteAckKey).(types.WriteAck)
+	return ack
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SQLess/SQLess/bench"
+	"github.com/SQLess/SQLess/client"
+)
+
+var (
+	benchWorkload    string
+	benchConcurrency int
+	benchDuration    time.Duration
+	benchOps         int64
+	benchWarmup      time.Duration
+	benchSkipSetup   bool
+	benchRecords     int
+	benchWarehouses  int
+	benchOut         string
+	benchBaseline    string
+	benchThreshold   float64
+)
+
+// CmdBench is cql bench command entity.
+var CmdBench = &Command{
+	UsageLine: "cql bench [common params] [-workload ycsb-a] [-concurrency 4] [-duration 1m] [-ops 0] [-warmup 0] [-skip-setup] [-records 1000] [-warehouses 1] [-out file] [-baseline file [-threshold 0.1]] dsn",
+	Short:     "run a standard benchmark workload against a database",
+	Long: `
+Bench runs a standard benchmark workload through the database driver and reports the throughput
+and latencies of each operation. The workload creates its own tables, so run it on a dedicated
+database. The built-in workloads are the YCSB core workloads ycsb-a to ycsb-f and a TPC-C style
+workload tpcc.
+e.g.
+    cql bench -workload ycsb-b -concurrency 8 -duration 5m \
+        cqlprotocol://4119ef997dedc585bfbcfae00ab6b87b8486fab323a8e107ea1fd4fc4f7eba5c
+
+Save the result as the baseline, and compare the later runs with it:
+    cql bench -workload tpcc -out base.json cqlprotocol://4119ef...
+    cql bench -workload tpcc -baseline base.json -threshold 0.05 cqlprotocol://4119ef...
+
+The command exits with status 1 if any regression is found.
+`,
+	Flag:       flag.NewFlagSet("Bench params", flag.ExitOnError),
+	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
+	DebugFlag:  flag.NewFlagSet("Debug params", flag.ExitOnError),
+}
+
+func init() {
+	CmdBench.Run = runBench
+
+	addCommonFlags(CmdBench)
+	addConfigFlag(CmdBench)
+	CmdBench.Flag.StringVar(&benchWorkload, "workload", "ycsb-a",
+		"Benchmark workload: "+strings.Join(bench.Workloads(), ", "))
+	CmdBench.Flag.IntVar(&benchConcurrency, "concurrency", 4, "Number of concurrent clients")
+	CmdBench.Flag.DurationVar(&benchDuration, "duration", 0, "Duration of the measured run, defaults to 1m")
+	CmdBench.Flag.Int64Var(&benchOps, "ops", 0, "Total operations of the measured run")
+	CmdBench.Flag.DurationVar(&benchWarmup, "warmup", 0, "Duration to run the workload before measuring")
+	CmdBench.Flag.BoolVar(&benchSkipSetup, "skip-setup", false, "Run on the records loaded by a previous run")
+	CmdBench.Flag.IntVar(&benchRecords, "records", 0, "Initial records of the YCSB workloads, defaults to 1000")
+	CmdBench.Flag.IntVar(&benchWarehouses, "warehouses", 0, "Warehouses of the TPC-C workload, defaults to 1")
+	CmdBench.Flag.StringVar(&benchOut, "out", "", "File to save the result as JSON")
+	CmdBench.Flag.StringVar(&benchBaseline, "baseline", "", "Result file of a previous run to compare with")
+	CmdBench.Flag.Float64Var(&benchThreshold, "threshold", bench.DefaultRegressionThreshold,
+		"Relative change of the throughput or tail latencies reported as a regression")
+}
+
+func runBench(cmd *Command, args []string) {
+	commonFlagsInit(cmd)
+
+	if len(args) != 1 {
+		ConsoleLog.Error("bench command need CQL dsn or database_id string as param")
+		SetExitStatus(1)
+		printCommandHelp(cmd)
+		Exit()
+	}
+
+	w, err := bench.NewWorkload(benchWorkload)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("invalid benchmark workload")
+		SetExitStatus(1)
+		return
+	}
+	switch w := w.(type) {
+	case *bench.YCSB:
+		if benchRecords > 0 {
+			w.RecordCount = benchRecords
+		}
+	case *bench.TPCC:
+		if benchWarehouses > 0 {
+			w.Warehouses = benchWarehouses
+		}
+	}
+
+	var baseline *bench.Result
+	if benchBaseline != "" {
+		if baseline, err = bench.LoadResult(benchBaseline); err != nil {
+			ConsoleLog.WithField("path", benchBaseline).WithError(err).Error("load baseline failed")
+			SetExitStatus(1)
+			return
+		}
+	}
+
+	configInit()
+
+	var dsn = args[0]
+	db, err := sql.Open(client.DBScheme, dsn)
+	if err != nil {
+		ConsoleLog.WithField("db", dsn).WithError(err).Error("open database failed")
+		SetExitStatus(1)
+		return
+	}
+	defer db.Close()
+
+	ConsoleLog.Infof("running %s with %d clients", w.Name(), benchConcurrency)
+	res, err := bench.Run(context.Background(), db, w, bench.Config{
+		Concurrency: benchConcurrency,
+		Duration:    benchDuration,
+		Operations:  benchOps,
+		Warmup:      benchWarmup,
+		SkipSetup:   benchSkipSetup,
+	})
+	if err != nil {
+		ConsoleLog.WithError(err).Error("run benchmark failed")
+		SetExitStatus(1)
+		return
+	}
+	_ = res.WriteText(os.Stdout)
+
+	if benchOut != "" {
+		if err = bench.SaveResult(benchOut, res); err != nil {
+			ConsoleLog.WithField("path", benchOut).WithError(err).Error("save result failed")
+			SetExitStatus(1)
+			return
+		}
+		ConsoleLog.WithField("path", benchOut).Info("result saved")
+	}
+
+	if baseline == nil {
+		return
+	}
+	regs, err := bench.Compare(baseline, res, benchThreshold)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("compare with baseline failed")
+		SetExitStatus(1)
+		return
+	}
+	if len(regs) == 0 {
+		fmt.Printf("\nno regression compared with %s\n", benchBaseline)
+		return
+	}
+	fmt.Printf("\n%d regression(s) compared with %s:\n", len(regs), benchBaseline)
+	for _, r := range regs {
+		fmt.Printf("  %s\n", r)
+	}
+	SetExitStatus(1)
+}
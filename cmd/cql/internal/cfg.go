@@ -33,8 +33,10 @@ import (
 	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
 	"github.com/SQLess/SQLess/client"
 	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto"
 	"github.com/SQLess/SQLess/crypto/asymmetric"
 	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/hwwallet"
 	"github.com/SQLess/SQLess/crypto/kms"
 	"github.com/SQLess/SQLess/utils"
 	"github.com/SQLess/SQLess/utils/log"
@@ -47,7 +49,10 @@ var (
 	withPassword    bool
 	consoleLogLevel string // foreground console log level
 
-	waitTxConfirmation bool // wait for transaction confirmation before exiting
+	waitTxConfirmation bool   // wait for transaction confirmation before exiting
+	hwWalletBridge     string // hardware wallet bridge command to sign transactions
+	hwWalletPath       string // key derivation path on the hardware wallet
+	remoteSignerURL    string // url of the policy signer to sign transactions
 	// Shard chain explorer stuff
 	tmpPath    string // background observer and explorer block and log file path
 	bgLogLevel string // background log level
@@ -112,6 +117,44 @@ func addWaitFlag(cmd *Command) {
 	cmd.Flag.BoolVar(&waitTxConfirmation, "wait-tx-confirm", false, "Wait for transaction confirmation")
 }
 
+func addHWWalletFlags(cmd *Command) {
+	cmd.Flag.StringVar(&hwWalletBridge, "hw-wallet-bridge", "",
+		"Hardware wallet bridge command to sign the transaction, e.g. \"cql-ledger-bridge --device ledger\"")
+	cmd.Flag.StringVar(&hwWalletPath, "hw-wallet-path", "",
+		"Key derivation path on the hardware wallet, empty for the bridge default")
+	cmd.Flag.StringVar(&remoteSignerURL, "remote-signer", "",
+		"URL of the policy signer started by \"cql signer\" to sign the transaction, the token is read from $"+signerTokenEnv)
+}
+
+func hwWalletInit() {
+	if remoteSignerURL != "" {
+		remoteSignerInit()
+		return
+	}
+	if hwWalletBridge == "" {
+		return
+	}
+	signer, err := hwwallet.NewSigner(&hwwallet.Config{
+		Bridge: hwWalletBridge,
+		Path:   hwWalletPath,
+	})
+	if err != nil {
+		ConsoleLog.WithError(err).Error("connect hardware wallet failed")
+		SetExitStatus(1)
+		Exit()
+	}
+	client.SetTxSigner(signer)
+
+	addr, err := crypto.PubKeyHash(signer.PubKey())
+	if err != nil {
+		ConsoleLog.WithError(err).Error("get hardware wallet address failed")
+		SetExitStatus(1)
+		Exit()
+	}
+	ConsoleLog.WithField("addr", addr.String()).Info(
+		"signing with hardware wallet, confirm the transaction on the device")
+}
+
 func wait(txHash hash.Hash) (err error) {
 	var ctx, cancel = context.WithTimeout(context.Background(), waitTxConfirmationMaxDuration)
 	defer cancel()
@@ -226,3 +269,22 @@ func storeOneDSN(dsn string) {
 	dsnArray = append(dsnArray, dsn)
 	storeDSN(dsnArray)
 }
+
+func remoteSignerInit() {
+	signer, err := client.NewRemoteSigner(remoteSignerURL, os.Getenv(signerTokenEnv))
+	if err != nil {
+		ConsoleLog.WithError(err).Error("connect remote signer failed")
+		SetExitStatus(1)
+		Exit()
+	}
+	client.SetTxSigner(signer)
+
+	addr, err := crypto.PubKeyHash(signer.PubKey())
+	if err != nil {
+		ConsoleLog.WithError(err).Error("get remote signer address failed")
+		SetExitStatus(1)
+		Exit()
+	}
+	ConsoleLog.WithField("addr", addr.String()).Info(
+		"signing with remote signer, the spending policy is enforced by the signer")
+}
@@ -27,13 +27,17 @@ import (
 	"github.com/SQLess/SQLess/client"
 	"github.com/SQLess/SQLess/crypto/hash"
 	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
 )
 
-var meta client.ResourceMeta
+var (
+	meta         client.ResourceMeta
+	createDryRun bool
+)
 
 // CmdCreate is cql create command entity.
 var CmdCreate = &Command{
-	UsageLine: "cql create [common params] [-wait-tx-confirm] [db_meta_params]",
+	UsageLine: "cql create [common params] [-wait-tx-confirm] [-hw-wallet-bridge command] [-dry-run] [db_meta_params]",
 	Short:     "create a database",
 	Long: `
 Create command creates a CQL database by database meta params. The meta info must include
@@ -45,6 +49,16 @@ Since CQL is built on top of blockchains, you may want to wait for the transacti
 confirmation before the creation takes effect.
 e.g.
     cql create -wait-tx-confirm -db-node 2
+
+To keep the private key of the account on a hardware wallet, the transaction could be signed
+through a Ledger or Trezor bridge command, the database is then owned by the wallet account.
+e.g.
+    cql create -hw-wallet-bridge "cql-ledger-bridge --device ledger" -db-node 2
+
+To preview the miners which would be matched before paying for the database, use the dry run
+mode, nothing is sent to the chain.
+e.g.
+    cql create -dry-run -db-node 2 -db-memory 1073741824
 `,
 	Flag:       flag.NewFlagSet("DB meta params", flag.ExitOnError),
 	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
@@ -57,6 +71,7 @@ func init() {
 	addCommonFlags(CmdCreate)
 	addConfigFlag(CmdCreate)
 	addWaitFlag(CmdCreate)
+	addHWWalletFlags(CmdCreate)
 	addCreateFlags(CmdCreate)
 }
 
@@ -81,6 +96,8 @@ func (l *List) Get() interface{} { return List(*l) }
 
 var targetMiners List
 var node32 uint
+var writeAck string
+var standbyNode string
 
 func addCreateFlags(cmd *Command) {
 	cmd.Flag.Var(&targetMiners, "db-target-miners", "List of target miner addresses(separated by ',')")
@@ -92,8 +109,15 @@ func addCreateFlags(cmd *Command) {
 	cmd.Flag.BoolVar(&meta.UseEventualConsistency, "db-eventual-consistency", false, "Use eventual consistency to sync among miner nodes")
 	cmd.Flag.Float64Var(&meta.ConsistencyLevel, "db-consistency-level", 0, "Consistency level, node*consistency_level is the node count to perform strong consistency")
 	cmd.Flag.IntVar(&meta.IsolationLevel, "db-isolation-level", 0, "Isolation level in a single node")
+	cmd.Flag.DurationVar(&meta.StatementTimeout, "db-statement-timeout", 0, "Default statement timeout of read queries, 0 for unlimited")
+	cmd.Flag.BoolVar(&meta.ForeignKeys, "db-foreign-keys", false, "Enforce foreign key constraints on all miner nodes")
+	cmd.Flag.StringVar(&writeAck, "db-write-ack", "", "Replica acknowledgements required by writes: one, quorum or all")
+	cmd.Flag.StringVar(&standbyNode, "db-standby-node", "", "Node id of the standby miner outside the replication group receiving shipped snapshots")
+	cmd.Flag.DurationVar(&meta.SnapshotShipInterval, "db-snapshot-ship-interval", 0, "Interval of snapshot shipping to the standby miner, 0 for default")
+	cmd.Flag.StringVar(&meta.ConsistencyPreset, "db-consistency", "", "Consistency preset overriding the consistency and isolation levels: strong, session or eventual")
 	cmd.Flag.Uint64Var(&meta.GasPrice, "db-gas-price", 0, "Customized gas price")
 	cmd.Flag.Uint64Var(&meta.AdvancePayment, "db-advance-payment", 0, "Customized advance payment")
+	cmd.Flag.BoolVar(&createDryRun, "dry-run", false, "Preview the matched miners without creating the database")
 }
 
 func runCreate(cmd *Command, args []string) {
@@ -123,6 +147,25 @@ func runCreate(cmd *Command, args []string) {
 	}
 	meta.Node = uint16(node32)
 
+	if writeAck != "" {
+		ack, err := types.ParseWriteAck(writeAck)
+		if err != nil {
+			ConsoleLog.Error("create write-ack param is not valid: ", writeAck)
+			SetExitStatus(1)
+			return
+		}
+		meta.WriteAck = ack
+	}
+
+	if standbyNode != "" {
+		if _, err := hash.NewHashFromStr(standbyNode); err != nil {
+			ConsoleLog.Error("create standby-node param has invalid node id: ", standbyNode)
+			SetExitStatus(1)
+			return
+		}
+		meta.StandbyNode = proto.NodeID(standbyNode)
+	}
+
 	if len(args) == 1 && args[0] != "" {
 		// fill the meta with params
 		if err := json.Unmarshal([]byte(args[0]), &meta); err != nil {
@@ -148,6 +191,8 @@ func runCreate(cmd *Command, args []string) {
 					_ = json.Unmarshal(v, &meta.ConsistencyLevel)
 				case "isolationlevel":
 					_ = json.Unmarshal(v, &meta.IsolationLevel)
+				case "foreignkeys":
+					_ = json.Unmarshal(v, &meta.ForeignKeys)
 				case "gasprice":
 					_ = json.Unmarshal(v, &meta.GasPrice)
 				case "advancepayment":
@@ -166,6 +211,12 @@ func runCreate(cmd *Command, args []string) {
 	}
 
 	configInit()
+	hwWalletInit()
+
+	if createDryRun {
+		previewCreate()
+		return
+	}
 
 	// create database
 	// parse instance requirement
@@ -202,3 +253,34 @@ func runCreate(cmd *Command, args []string) {
 	storeOneDSN(dsn)
 	fmt.Printf("The connecting string beginning with 'cqlprotocol://' could be used as a dsn for `cql console`\n")
 }
+
+func previewCreate() {
+	resp, err := client.PreviewCreate(meta)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("preview create database failed")
+		SetExitStatus(1)
+		return
+	}
+
+	fmt.Printf("Balance: %d, minimum advance payment: %d\n", resp.Balance, resp.MinAdvancePayment)
+	fmt.Printf("%-8s %-64s %-12s %-12s %-8s %-8s %-8s %s\n",
+		"SELECTED", "NODE", "MEMORY", "SPACE", "PRICE", "RESERVE", "RATING", "ADDR/MISMATCH")
+	for _, c := range resp.Candidates {
+		var (
+			selected = ""
+			extra    = c.NodeAddr
+		)
+		if c.Selected {
+			selected = "*"
+		}
+		if c.Mismatch != "" {
+			extra = c.Mismatch
+		}
+		fmt.Printf("%-8s %-64s %-12d %-12d %-8d %-8d %-8.2f %s\n",
+			selected, c.NodeID, c.Memory, c.Space, c.GasPrice, c.ReservationFee, c.Rating, extra)
+	}
+	if resp.Error != "" {
+		ConsoleLog.Errorf("create database would fail: %s", resp.Error)
+		SetExitStatus(1)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package internal
+
+import (
+	"flag"
+
+	"github.com/SQLess/SQLess/client"
+)
+
+var (
+	decommissionFinalize bool
+)
+
+// CmdDecommission is cql decommission command entity.
+var CmdDecommission = &Command{
+	UsageLine: "cql decommission [common params] [-wait-tx-confirm] [-hw-wallet-bridge command] [-finalize]",
+	Short:     "decommission the miner of the current account",
+	Long: `
+Decommission announces the departure of the miner of the current account, the miner is not
+matched for new databases any more and the block producers add a replacement miner to each
+database it serves, which restores a replica from the serving miners. Run it with the config of
+the miner.
+e.g.
+    cql decommission -wait-tx-confirm
+
+The miner keeps serving its databases until the departure is finalized with -finalize, which
+is accepted once the billing of each database is updated after the announcement. The miner
+leaves the databases and the deposits are returned then.
+e.g.
+    cql decommission -finalize
+`,
+	Flag:       flag.NewFlagSet("Decommission params", flag.ExitOnError),
+	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
+	DebugFlag:  flag.NewFlagSet("Debug params", flag.ExitOnError),
+}
+
+func init() {
+	CmdDecommission.Run = runDecommission
+
+	addCommonFlags(CmdDecommission)
+	addConfigFlag(CmdDecommission)
+	addWaitFlag(CmdDecommission)
+	addHWWalletFlags(CmdDecommission)
+	CmdDecommission.Flag.BoolVar(&decommissionFinalize, "finalize", false,
+		"Finalize the departure announced before")
+}
+
+func runDecommission(cmd *Command, args []string) {
+	commonFlagsInit(cmd)
+
+	if len(args) > 0 {
+		ConsoleLog.Error("decommission command takes no arguments")
+		SetExitStatus(1)
+		printCommandHelp(cmd)
+		Exit()
+	}
+
+	configInit()
+	hwWalletInit()
+
+	txHash, err := client.DecommissionMiner(decommissionFinalize)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("decommission miner failed")
+		SetExitStatus(1)
+		return
+	}
+
+	if waitTxConfirmation {
+		err = wait(txHash)
+		if err != nil {
+			ConsoleLog.WithError(err).Error("decommission miner failed")
+			SetExitStatus(1)
+			return
+		}
+	}
+
+	if decommissionFinalize {
+		ConsoleLog.Info("miner decommission finalized")
+	} else {
+		ConsoleLog.Info("miner decommission announced")
+	}
+}
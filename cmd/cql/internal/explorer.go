@@ -54,8 +54,16 @@ func init() {
 }
 
 func startExplorerServer(explorerAddr string) func() {
-	var err error
-	explorerService, explorerHTTPServer, err = observer.StartObserver(explorerAddr, Version)
+	var (
+		cfg *observer.Config
+		err error
+	)
+	// the observer section is optional
+	if cfg, err = observer.LoadConfig(configFile); err != nil {
+		ConsoleLog.WithError(err).Warning("load observer config failed, no retention applied")
+		cfg = nil
+	}
+	explorerService, explorerHTTPServer, err = observer.StartObserver(explorerAddr, Version, cfg)
 	if err != nil {
 		ConsoleLog.WithError(err).Error("start explorer failed")
 		SetExitStatus(1)
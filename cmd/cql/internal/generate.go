@@ -266,6 +266,10 @@ func runGenerate(cmd *Command, args []string) {
 
 	walletAddr := keyHash.String()
 
+	if rawConfig.IsDevMode() {
+		// any nonce is accepted in the dev mode
+		difficulty = 0
+	}
 	fmt.Println("Generating nonce...")
 	nonce := nonceGen(publicKey)
 	cliNodeID := proto.NodeID(nonce.Hash.String())
@@ -301,7 +305,7 @@ func runGenerate(cmd *Command, args []string) {
 		return
 	}
 	configFilePath := path.Join(workingRoot, "config.yaml")
-	err = ioutil.WriteFile(configFilePath, out, 0644)
+	err = ioutil.WriteFile(configFilePath, out, 0600)
 	if err != nil {
 		ConsoleLog.WithError(err).Error("unexpected error")
 		SetExitStatus(1)
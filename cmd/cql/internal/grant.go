@@ -40,10 +40,19 @@ Grant grants specific permissions for the target user on target dsn.
 e.g.
     cql grant -to-user=43602c17adcc96acf2f68964830bb6ebfbca6834961c0eca0915fcc5270e0b40 -to-dsn="cqlprotocol://xxxx" -perm perm_struct
 
+The target user could also be a name registered by "cql name".
+e.g.
+    cql grant -to-user=alice -to-dsn="cqlprotocol://xxxx" -perm Read
+
 Since CQL is built on top of blockchains, you may want to wait for the transaction
 confirmation before the permission takes effect.
 e.g.
     cql grant -wait-tx-confirm -to-user=43602c17adcc96acf2f68964830bb6ebfbca6834961c0eca0915fcc5270e0b40 -to-dsn="cqlprotocol://xxxx" -perm perm_struct
+
+Statement rules could be attached to restrict the queries of the target user.
+e.g.
+    cql grant -to-user=43602c17adcc96acf2f68964830bb6ebfbca6834961c0eca0915fcc5270e0b40 -to-dsn="cqlprotocol://xxxx" \
+        -perm '{"role": "ReadWrite", "rules": [{"action": "deny", "statements": ["DELETE"], "without-where": true}, {"action": "deny", "statements": ["DROP"]}]}'
 `,
 	Flag:       flag.NewFlagSet("Grant params", flag.ExitOnError),
 	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
@@ -56,7 +65,7 @@ func init() {
 	addCommonFlags(CmdGrant)
 	addConfigFlag(CmdGrant)
 	addWaitFlag(CmdGrant)
-	CmdGrant.Flag.StringVar(&toUser, "to-user", "", "Target address of an user account to grant permission.")
+	CmdGrant.Flag.StringVar(&toUser, "to-user", "", "Target address or registered name of an user account to grant permission.")
 	CmdGrant.Flag.StringVar(&toDSN, "to-dsn", "", "Target database dsn to grant permission.")
 	CmdGrant.Flag.StringVar(&perm, "perm", "", "Permission type struct for grant.")
 }
@@ -67,6 +76,8 @@ type userPermPayload struct {
 	// SQL pattern regulations for user queries
 	// only a fully matched (case-sensitive) sql query is permitted to execute.
 	Patterns []string `json:"patterns"`
+	// Statement pattern rules for user queries, e.g. deny DELETE without WHERE.
+	Rules []types.QueryRule `json:"rules"`
 }
 
 func runGrant(cmd *Command, args []string) {
@@ -87,14 +98,6 @@ func runGrant(cmd *Command, args []string) {
 	toDSN = strings.TrimLeft(toDSN, client.DBScheme+"://")
 	toDSN = strings.TrimLeft(toDSN, client.DBSchemeAlias+"://")
 
-	targetUserHash, err := hash.NewHashFromStr(toUser)
-	if err != nil {
-		ConsoleLog.WithError(err).Error("target user address is not valid")
-		SetExitStatus(1)
-		return
-	}
-	targetUser := proto.AccountAddress(*targetUserHash)
-
 	targetChainHash, err := hash.NewHashFromStr(toDSN)
 	if err != nil {
 		ConsoleLog.WithError(err).Error("target dsn address is not valid")
@@ -119,6 +122,7 @@ func runGrant(cmd *Command, args []string) {
 	p := &types.UserPermission{
 		Role:     permPayload.Role,
 		Patterns: permPayload.Patterns,
+		Rules:    permPayload.Rules,
 	}
 
 	if !p.IsValid() {
@@ -129,6 +133,13 @@ func runGrant(cmd *Command, args []string) {
 
 	configInit()
 
+	targetUser, err := client.ResolveAccount(toUser)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("target user address is not valid")
+		SetExitStatus(1)
+		return
+	}
+
 	txHash, err := client.UpdatePermission(targetUser, targetChain, p)
 	if err != nil {
 		ConsoleLog.WithError(err).Error("update permission failed")
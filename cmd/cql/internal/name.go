@@ -0,0 +1,132 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package internal
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/SQLess/SQLess/client"
+	"github.com/SQLess/SQLess/proto"
+)
+
+var (
+	registerName string
+	resolveName  string
+	nameTarget   string
+	namePeriods  uint
+)
+
+// CmdName is cql name command entity.
+var CmdName = &Command{
+	UsageLine: "cql name [common params] [-wait-tx-confirm] [-hw-wallet-bridge command] [-register name [-target wallet] [-periods count] | -resolve name]",
+	Short:     "register or resolve a human-readable account name",
+	Long: `
+Name registers a human-readable name on chain which points to an account address, the name
+could be used in place of the address by "cql transfer" and "cql grant" afterwards.
+A name consists of 3 to 32 lowercase letters, digits and hyphens, and starts with a letter.
+e.g.
+    cql name -register alice
+
+The name points to the current account by default, use -target to point it to another account.
+Each registration period lasts about 30 days and costs 1000 Particles, register the owned name
+again to renew it or to change its target, with -periods 0 to change the target only.
+e.g.
+    cql name -register alice -target 43602c17adcc96acf2f68964830bb6ebfbca6834961c0eca0915fcc5270e0b40 -periods 12
+
+Resolve prints the account address and the expiry height of a registered name.
+e.g.
+    cql name -resolve alice
+
+Since CQL is built on top of blockchains, you may want to wait for the transaction
+confirmation before the name could be resolved.
+e.g.
+    cql name -wait-tx-confirm -register alice
+`,
+	Flag:       flag.NewFlagSet("Name params", flag.ExitOnError),
+	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
+	DebugFlag:  flag.NewFlagSet("Debug params", flag.ExitOnError),
+}
+
+func init() {
+	CmdName.Run = runName
+
+	addCommonFlags(CmdName)
+	addConfigFlag(CmdName)
+	addWaitFlag(CmdName)
+	addHWWalletFlags(CmdName)
+	CmdName.Flag.StringVar(&registerName, "register", "", "Name to register or renew")
+	CmdName.Flag.StringVar(&resolveName, "resolve", "", "Name to resolve")
+	CmdName.Flag.StringVar(&nameTarget, "target", "", "Target address or registered name of the account to point the name to, the current account by default")
+	CmdName.Flag.UintVar(&namePeriods, "periods", 1, "Registration periods to pay for")
+}
+
+func runName(cmd *Command, args []string) {
+	commonFlagsInit(cmd)
+
+	if len(args) > 0 || (registerName == "" && resolveName == "") || (registerName != "" && resolveName != "") {
+		ConsoleLog.Error("name command need either register or resolve name as param")
+		SetExitStatus(1)
+		printCommandHelp(cmd)
+		Exit()
+	}
+
+	configInit()
+
+	if resolveName != "" {
+		record, err := client.ResolveName(resolveName)
+		if err != nil {
+			ConsoleLog.WithField("name", resolveName).WithError(err).Error("resolve name failed")
+			SetExitStatus(1)
+			return
+		}
+		fmt.Printf("Name: %s\n", record.Name)
+		fmt.Printf("Target: %s\n", record.Target.String())
+		fmt.Printf("Owner: %s\n", record.Owner.String())
+		fmt.Printf("Expiry: %d\n", record.Expiry)
+		return
+	}
+
+	hwWalletInit()
+
+	var target proto.AccountAddress
+	if nameTarget != "" {
+		var err error
+		if target, err = client.ResolveAccount(nameTarget); err != nil {
+			ConsoleLog.WithError(err).Error("target account address is not valid")
+			SetExitStatus(1)
+			return
+		}
+	}
+
+	txHash, err := client.RegisterName(registerName, target, uint32(namePeriods))
+	if err != nil {
+		ConsoleLog.WithField("name", registerName).WithError(err).Error("register name failed")
+		SetExitStatus(1)
+		return
+	}
+
+	if waitTxConfirmation {
+		err = wait(txHash)
+		if err != nil {
+			ConsoleLog.WithField("name", registerName).WithError(err).Error("register name failed")
+			SetExitStatus(1)
+			return
+		}
+	}
+
+	ConsoleLog.Infof("register name %#v success", registerName)
+}
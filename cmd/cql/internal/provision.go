@@ -0,0 +1,296 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/utils"
+)
+
+var (
+	provisionMint  bool
+	provisionRole  string
+	provisionTTL   time.Duration
+	provisionToken string
+)
+
+// CmdProvision is cql provision command entity.
+var CmdProvision = &Command{
+	UsageLine: "cql provision [common params] [-mint [-role miner] [-ttl 1h]] [-token token [-miner listen_addr] [dest_path]]",
+	Short:     "mint a provisioning token or provision a new node with it",
+	Long: `
+Provision mints a short-lived provisioning token with the operator account, the issuer account
+must be listed in ProvisionIssuers of block producers config. Each token could be used once.
+e.g.
+    cql provision -mint -role miner -ttl 1h
+
+On first boot of a new node, provision uses the token to generate the private key, mine the
+node id, register the node to block producer and fetch the network config.
+e.g.
+    cql provision -token <token> -miner 0.0.0.0:7458 ~/.cql
+`,
+	Flag:       flag.NewFlagSet("Provision params", flag.ExitOnError),
+	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
+	DebugFlag:  flag.NewFlagSet("Debug params", flag.ExitOnError),
+}
+
+func init() {
+	CmdProvision.Run = runProvision
+
+	addCommonFlags(CmdProvision)
+	addConfigFlag(CmdProvision)
+	CmdProvision.Flag.BoolVar(&provisionMint, "mint", false, "Mint a provisioning token")
+	CmdProvision.Flag.StringVar(&provisionRole, "role", "miner",
+		"Role of the node to provision: miner or client")
+	CmdProvision.Flag.DurationVar(&provisionTTL, "ttl", time.Hour, "Lifetime of the provisioning token")
+	CmdProvision.Flag.StringVar(&provisionToken, "token", "", "Provisioning token to provision a new node")
+	CmdProvision.Flag.StringVar(&minerListenAddr, "miner", "",
+		"Listen address of the provisioned miner, e.g. 0.0.0.0:7458")
+}
+
+func runProvision(cmd *Command, args []string) {
+	commonFlagsInit(cmd)
+
+	switch {
+	case provisionMint && provisionToken == "":
+		mintProvisionToken()
+	case !provisionMint && provisionToken != "":
+		provisionNode(args)
+	default:
+		ConsoleLog.Error("provision command accepts either -mint or -token as param")
+		SetExitStatus(1)
+		printCommandHelp(cmd)
+		Exit()
+	}
+}
+
+func mintProvisionToken() {
+	var role proto.ServerRole
+	switch strings.ToLower(provisionRole) {
+	case "miner":
+		role = proto.Miner
+	case "client":
+		role = proto.Client
+	default:
+		ConsoleLog.Errorf("invalid role to provision: %s", provisionRole)
+		SetExitStatus(1)
+		return
+	}
+	if provisionTTL <= 0 || provisionTTL > route.MaxProvisionTokenTTL {
+		ConsoleLog.Errorf("token lifetime should be in (0, %s]", route.MaxProvisionTokenTTL)
+		SetExitStatus(1)
+		return
+	}
+
+	configInit()
+
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		ConsoleLog.WithError(err).Error("generate token nonce failed")
+		SetExitStatus(1)
+		return
+	}
+	token := &proto.ProvisionToken{
+		ProvisionTokenHeader: proto.ProvisionTokenHeader{
+			Role:    role,
+			Expire:  time.Now().Add(provisionTTL).UTC(),
+			Nonce:   binary.BigEndian.Uint64(nonce[:]),
+			BPNodes: conf.GConf.SeedBPNodes,
+		},
+	}
+	privateKey, err := kms.GetLocalPrivateKey()
+	if err != nil {
+		ConsoleLog.WithError(err).Error("get local private key failed")
+		SetExitStatus(1)
+		return
+	}
+	if err = token.Sign(privateKey); err != nil {
+		ConsoleLog.WithError(err).Error("sign provisioning token failed")
+		SetExitStatus(1)
+		return
+	}
+	encoded, err := route.EncodeProvisionToken(token)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("encode provisioning token failed")
+		SetExitStatus(1)
+		return
+	}
+	fmt.Printf("\nProvisioning token for %s, expires at %s:\n", role, token.Expire)
+	fmt.Println(encoded)
+}
+
+func provisionNode(args []string) {
+	var workingRoot = utils.HomeDirExpand("~/.cql")
+	if len(args) > 0 && args[0] != "" {
+		workingRoot = utils.HomeDirExpand(args[0])
+	}
+
+	token, err := route.DecodeProvisionToken(provisionToken)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("invalid provisioning token")
+		SetExitStatus(1)
+		return
+	}
+	if token.Expire.Before(time.Now()) {
+		ConsoleLog.WithField("expire", token.Expire).Error("provisioning token expired")
+		SetExitStatus(1)
+		return
+	}
+	if len(token.BPNodes) == 0 {
+		ConsoleLog.Error("no block producer found in provisioning token")
+		SetExitStatus(1)
+		return
+	}
+	if token.Role == proto.Miner && minerListenAddr == "" {
+		ConsoleLog.Error("-miner listen address is required to provision a miner")
+		SetExitStatus(1)
+		return
+	}
+
+	var (
+		privateKeyFile = path.Join(workingRoot, "private.key")
+		configFile     = path.Join(workingRoot, "config.yaml")
+	)
+	for _, f := range []string{privateKeyFile, configFile} {
+		if _, err = os.Stat(f); err == nil {
+			ConsoleLog.WithField("file", f).Error("node is already provisioned")
+			SetExitStatus(1)
+			return
+		}
+	}
+	if err = os.MkdirAll(workingRoot, 0755); err != nil {
+		ConsoleLog.WithError(err).Error("create config directory failed")
+		SetExitStatus(1)
+		return
+	}
+
+	// generate key and mine node id
+	if password == "" {
+		fmt.Println("Please enter passphrase for new private key")
+		password = readMasterKey(!withPassword)
+	}
+	privateKey, publicKey, err := asymmetric.GenSecp256k1KeyPair()
+	if err != nil {
+		ConsoleLog.WithError(err).Error("generate key pair failed")
+		SetExitStatus(1)
+		return
+	}
+	if err = kms.SavePrivateKey(privateKeyFile, privateKey, []byte(password)); err != nil {
+		ConsoleLog.WithError(err).Error("save generated keypair failed")
+		SetExitStatus(1)
+		return
+	}
+	fmt.Println("Generating nonce...")
+	nonce := nonceGen(publicKey)
+	node := proto.Node{
+		ID:        proto.NodeID(nonce.Hash.String()),
+		Role:      token.Role,
+		Addr:      "0.0.0.0:15151",
+		PublicKey: publicKey,
+		Nonce:     nonce.Nonce,
+	}
+	if minerListenAddr != "" {
+		node.Addr = minerListenAddr
+	}
+
+	// register to block producer
+	conf.GConf = &conf.Config{
+		ThisNodeID:      node.ID,
+		PrivateKeyFile:  privateKeyFile,
+		PubKeyStoreFile: path.Join(workingRoot, "public.keystore"),
+		KnownNodes:      append(append([]proto.Node{}, token.BPNodes...), node),
+	}
+	route.InitKMS(conf.GConf.PubKeyStoreFile)
+	if err = kms.InitLocalKeyPair(privateKeyFile, []byte(password)); err != nil {
+		ConsoleLog.WithError(err).Error("init local key pair failed")
+		SetExitStatus(1)
+		return
+	}
+	var rawConfig []byte
+	for _, bp := range token.BPNodes {
+		if rawConfig, err = mux.Provision(token, &node, bp.ID); err == nil {
+			break
+		}
+		ConsoleLog.WithField("bp", bp.ID).WithError(err).Warning("provision node failed")
+	}
+	if err != nil {
+		ConsoleLog.WithError(err).Error("provision node failed in all block producers")
+		SetExitStatus(1)
+		return
+	}
+
+	// write config
+	config := &conf.Config{}
+	if err = yaml.Unmarshal(rawConfig, config); err != nil {
+		ConsoleLog.WithError(err).Error("load provisioned config failed")
+		SetExitStatus(1)
+		return
+	}
+	walletAddr, err := crypto.PubKeyHash(publicKey)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("unexpected error")
+		SetExitStatus(1)
+		return
+	}
+	config.WorkingRoot = "./"
+	config.PrivateKeyFile = "private.key"
+	config.PubKeyStoreFile = "public.keystore"
+	config.DHTFileName = "dht.db"
+	config.WalletAddress = walletAddr.String()
+	config.ThisNodeID = node.ID
+	config.KnownNodes = append(config.KnownNodes, node)
+	if token.Role == proto.Miner {
+		config.ListenAddr = minerListenAddr
+		config.Miner = &conf.MinerInfo{
+			RootDir: "./data",
+		}
+	}
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("unexpected error")
+		SetExitStatus(1)
+		return
+	}
+	if err = ioutil.WriteFile(configFile, out, 0644); err != nil {
+		ConsoleLog.WithError(err).Error("write config failed")
+		SetExitStatus(1)
+		return
+	}
+
+	fmt.Printf("\nConfig file:      %s\n", configFile)
+	fmt.Printf("Private key file: %s\n", privateKeyFile)
+	fmt.Printf("Node ID:          %s\n", node.ID)
+	fmt.Printf("\nWallet address: %s\n", walletAddr)
+}
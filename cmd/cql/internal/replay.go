@@ -0,0 +1,167 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/SQLess/SQLess/client"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/sqlchain/replay"
+	"github.com/SQLess/SQLess/types"
+)
+
+var (
+	replaySpeed float64
+	replayTo    int
+	replayOut   string
+)
+
+// CmdReplay is cql replay command entity.
+var CmdReplay = &Command{
+	UsageLine: "cql replay [common params] [-speed 0] [-to -1] [-out file] dsn",
+	Short:     "replay the query history of a database from its sqlchain blocks",
+	Long: `
+Replay fetches the sqlchain blocks of a database from its leader miner, and replays the signed
+write queries against a fresh local SQLite file. The replayed state is verified against the state
+digests kept by the miner, which is useful to debug determinism bugs and to validate upgrades.
+The account should have read permission on the database.
+e.g.
+    cql replay -out replayed.db cqlprotocol://4119ef997dedc585bfbcfae00ab6b87b8486fab323a8e107ea1fd4fc4f7eba5c
+
+Replay in 10x of the original pace to block count 1000:
+    cql replay -speed 10 -to 1000 cqlprotocol://4119ef997dedc585bfbcfae00ab6b87b8486fab323a8e107ea1fd4fc4f7eba5c
+`,
+	Flag:       flag.NewFlagSet("Replay params", flag.ExitOnError),
+	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
+	DebugFlag:  flag.NewFlagSet("Debug params", flag.ExitOnError),
+}
+
+func init() {
+	CmdReplay.Run = runReplay
+
+	addCommonFlags(CmdReplay)
+	addConfigFlag(CmdReplay)
+	CmdReplay.Flag.Float64Var(&replaySpeed, "speed", 0,
+		"Speed relative to the original pace of queries, 0 to replay as fast as possible")
+	CmdReplay.Flag.IntVar(&replayTo, "to", -1, "Last block count to replay, -1 for the whole chain")
+	CmdReplay.Flag.StringVar(&replayOut, "out", "", "Local SQLite file to replay to, defaults to a temp file")
+}
+
+func runReplay(cmd *Command, args []string) {
+	commonFlagsInit(cmd)
+
+	if len(args) != 1 {
+		ConsoleLog.Error("replay command need CQL dsn or database_id string as param")
+		SetExitStatus(1)
+		printCommandHelp(cmd)
+		Exit()
+	}
+
+	configInit()
+
+	dsnCfg, err := client.ParseDSN(args[0])
+	if err != nil {
+		ConsoleLog.WithField("db", args[0]).WithError(err).Error("not a valid dsn")
+		SetExitStatus(1)
+		return
+	}
+
+	var out = replayOut
+	if out == "" {
+		f, err := ioutil.TempFile("", "cql-replay-*.db")
+		if err != nil {
+			ConsoleLog.WithError(err).Error("create temp file failed")
+			SetExitStatus(1)
+			return
+		}
+		out = f.Name()
+		_ = f.Close()
+		_ = os.Remove(out)
+	} else if _, err = os.Stat(out); err == nil {
+		ConsoleLog.WithField("out", out).Error("replay target file already exists")
+		SetExitStatus(1)
+		return
+	}
+
+	src, err := replay.NewMinerSource(proto.DatabaseID(dsnCfg.DatabaseID))
+	if err != nil {
+		ConsoleLog.WithError(err).Error("connect to database miner failed")
+		SetExitStatus(1)
+		return
+	}
+	defer src.Close()
+
+	r, err := replay.NewReplayer(src, out, replay.Config{
+		Speed: replaySpeed,
+		To:    int32(replayTo),
+		OnBlock: func(count int32, b *types.Block) {
+			ConsoleLog.WithFields(logrus.Fields{
+				"count":   count,
+				"block":   b.BlockHash().String(),
+				"queries": len(b.QueryTxs),
+			}).Debug("block replayed")
+		},
+	})
+	if err != nil {
+		ConsoleLog.WithError(err).Error("create replayer failed")
+		SetExitStatus(1)
+		return
+	}
+	var ctx = context.Background()
+	res, err := r.Replay(ctx)
+	if closeErr := r.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		ConsoleLog.WithError(err).Error("replay failed")
+		SetExitStatus(1)
+		return
+	}
+
+	fmt.Printf("Replayed %d blocks, %d write queries to %s\n", res.Blocks, res.Queries, out)
+	fmt.Printf("State digest at seq %d: %s\n", res.Digest.Seq, res.Digest.Root.String())
+
+	// verify the most recent checkpoint still kept by the miner
+	var candidates = make([]*types.StateDigest, 0, len(res.Checkpoints)+1)
+	candidates = append(append(candidates, res.Checkpoints...), res.Digest)
+	for i := len(candidates) - 1; i >= 0; i-- {
+		remote, found, err := src.StateDigest(ctx, candidates[i].Seq)
+		if err != nil {
+			ConsoleLog.WithError(err).Error("fetch state digest from miner failed")
+			SetExitStatus(1)
+			return
+		}
+		if !found {
+			continue
+		}
+		if err = res.Verify(remote); err != nil {
+			ConsoleLog.WithError(err).Error("replayed state diverges from miner")
+			SetExitStatus(1)
+			return
+		}
+		fmt.Printf("Verified against miner state digest at seq %d\n", remote.Seq)
+		return
+	}
+	ConsoleLog.Warning("no state digest of the replayed sequences is kept by the miner, skip verification")
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package internal
+
+import (
+	"flag"
+
+	"github.com/SQLess/SQLess/client"
+	"github.com/SQLess/SQLess/proto"
+)
+
+var (
+	reserveMiners List
+	reserveBlocks uint
+	reserveFee    uint64
+)
+
+// CmdReserve is cql reserve command entity.
+var CmdReserve = &Command{
+	UsageLine: "cql reserve [common params] [-wait-tx-confirm] [-hw-wallet-bridge command] -miners addresses [-blocks count] -fee amount",
+	Short:     "reserve miner capacity ahead of a database creation",
+	Long: `
+Reserve reserves the capacity of the miners for the current account ahead of a planned database
+creation, the reserved miners are matched for the databases created by the account only until
+the reservation expires, and they are selected before any other miners by "cql create".
+The reservable miners and their reservation fees are listed by "cql create -dry-run", the fee
+of each miner is paid to the miner and -fee is the max fee paid to each of them.
+e.g.
+    cql reserve -miners 43602c17adcc96acf2f68964830bb6ebfbca6834961c0eca0915fcc5270e0b40 -blocks 8640 -fee 500
+
+A reservation lasts at most 60480 blocks, about 7 days. Reserve the miners again to renew it.
+`,
+	Flag:       flag.NewFlagSet("Reserve params", flag.ExitOnError),
+	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
+	DebugFlag:  flag.NewFlagSet("Debug params", flag.ExitOnError),
+}
+
+func init() {
+	CmdReserve.Run = runReserve
+
+	addCommonFlags(CmdReserve)
+	addConfigFlag(CmdReserve)
+	addWaitFlag(CmdReserve)
+	addHWWalletFlags(CmdReserve)
+	CmdReserve.Flag.Var(&reserveMiners, "miners", "List of miner addresses to reserve(separated by ',')")
+	CmdReserve.Flag.UintVar(&reserveBlocks, "blocks", 8640, "Block count to reserve the capacity for")
+	CmdReserve.Flag.Uint64Var(&reserveFee, "fee", 0, "Max reservation fee paid to each miner")
+}
+
+func runReserve(cmd *Command, args []string) {
+	commonFlagsInit(cmd)
+
+	if len(args) > 0 || len(reserveMiners.Values) == 0 {
+		ConsoleLog.Error("reserve command need miners as param")
+		SetExitStatus(1)
+		printCommandHelp(cmd)
+		Exit()
+	}
+
+	configInit()
+	hwWalletInit()
+
+	var miners = make([]proto.AccountAddress, 0, len(reserveMiners.Values))
+	for _, m := range reserveMiners.Values {
+		addr, err := client.ResolveAccount(m)
+		if err != nil {
+			ConsoleLog.WithField("miner", m).WithError(err).Error("miner address is not valid")
+			SetExitStatus(1)
+			return
+		}
+		miners = append(miners, addr)
+	}
+
+	txHash, err := client.ReserveCapacity(miners, uint32(reserveBlocks), reserveFee)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("reserve capacity failed")
+		SetExitStatus(1)
+		return
+	}
+
+	if waitTxConfirmation {
+		err = wait(txHash)
+		if err != nil {
+			ConsoleLog.WithError(err).Error("reserve capacity failed")
+			SetExitStatus(1)
+			return
+		}
+	}
+
+	ConsoleLog.Infof("reserve capacity of %d miners success", len(miners))
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/kms"
+	mine "github.com/SQLess/SQLess/pow/cpuminer"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/utils"
+)
+
+var (
+	seedDomain        string
+	seedFormat        string
+	seedTTL           uint
+	seedIPv4          bool
+	seedSign          bool
+	seedOut           string
+	seedVerify        bool
+	seedResolvers     string
+	seedMinDifficulty int
+
+	// newSeedResolver returns the resolver of the seed domain with the name servers.
+	newSeedResolver = func(servers []string) route.SeedResolver {
+		return route.NewNetResolver(servers)
+	}
+)
+
+// CmdSeed is cql seed command entity.
+var CmdSeed = &Command{
+	UsageLine: "cql seed [common params] -domain domain [-format bind|coredns|route53|terraform] [-ttl 1] [-ipv4] [-sign] [-out file] [-verify [-resolvers ns1,ns2] [-min-difficulty 0]]",
+	Short:     "generate and verify the BP seed records of a DNS seed domain",
+	Long: `
+Seed generates the IPv6 seed records of the BPs in the KnownNodes of the node config, which
+could be published to the DNS seed domain of the BPs. A single BP is published under the domain
+directly, multiple BPs are published with the indexed scheme.
+e.g.
+    cql seed -config bp/config.yaml -domain bp00.testnet.example.com -out bp00.zone
+
+The records could also be generated for CoreDNS, AWS Route53 or Terraform:
+    cql seed -config bp/config.yaml -domain seed.example.com -format route53 -out seed.json
+
+With -ipv4, the A records are also generated for the clients behind the resolvers which strip
+the AAAA records.
+
+With -sign, the records of the BP with the private key of the config are signed and published
+as the sig.<domain> record, which proves the records are published by the BP. The signatures
+are always verified if present, and -verify -sign requires all BPs to be signed.
+
+With -verify, the domain is resolved and the decoded BPs are verified that the node id matches
+the public key and nonce by proof of work:
+    cql seed -verify -domain bp00.testnet.example.com -resolvers 8.8.8.8
+`,
+	Flag:       flag.NewFlagSet("Seed params", flag.ExitOnError),
+	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
+	DebugFlag:  flag.NewFlagSet("Debug params", flag.ExitOnError),
+}
+
+func init() {
+	CmdSeed.Run = runSeed
+
+	addCommonFlags(CmdSeed)
+	addConfigFlag(CmdSeed)
+	CmdSeed.Flag.StringVar(&seedDomain, "domain", "", "DNS seed domain of the BPs")
+	CmdSeed.Flag.StringVar(&seedFormat, "format", "bind",
+		"Output format of the seed records: bind, coredns, route53 or terraform")
+	CmdSeed.Flag.UintVar(&seedTTL, "ttl", route.DefaultZoneTTL, "TTL of the seed records")
+	CmdSeed.Flag.BoolVar(&seedIPv4, "ipv4", false, "Also generate the A records of the seed")
+	CmdSeed.Flag.BoolVar(&seedSign, "sign", false, "Sign the seed records with the private key of the config")
+	CmdSeed.Flag.StringVar(&seedOut, "out", "", "File to write the seed records to, defaults to stdout")
+	CmdSeed.Flag.BoolVar(&seedVerify, "verify", false, "Resolve the domain and verify the published BPs")
+	CmdSeed.Flag.StringVar(&seedResolvers, "resolvers", "",
+		"Comma separated name servers to resolve the domain with, defaults to the system resolver")
+	CmdSeed.Flag.IntVar(&seedMinDifficulty, "min-difficulty", 0,
+		"Minimum node id difficulty required in verification")
+}
+
+func runSeed(cmd *Command, args []string) {
+	commonFlagsInit(cmd)
+
+	if seedDomain == "" {
+		ConsoleLog.Error("seed command need a domain")
+		SetExitStatus(1)
+		printCommandHelp(cmd)
+		Exit()
+	}
+
+	if seedVerify {
+		verifySeed()
+	} else {
+		genSeed()
+	}
+}
+
+func genSeed() {
+	format, err := route.ParseZoneFormat(seedFormat)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("invalid seed record format")
+		SetExitStatus(1)
+		return
+	}
+
+	configFile = utils.HomeDirExpand(configFile)
+	cfg, err := conf.LoadConfig(configFile)
+	if err != nil {
+		ConsoleLog.WithField("path", configFile).WithError(err).Error("load config file failed")
+		SetExitStatus(1)
+		return
+	}
+	var bps []proto.Node
+	for _, node := range cfg.KnownNodes {
+		if node.Role == proto.Leader || node.Role == proto.Follower {
+			bps = append(bps, node)
+		}
+	}
+	if len(bps) == 0 {
+		ConsoleLog.WithField("path", configFile).Error("no BP found in the known nodes of config")
+		SetExitStatus(1)
+		return
+	}
+
+	var (
+		isc  = &route.IPv6SeedClient{}
+		opts = route.ZoneOptions{Format: format, TTL: uint32(seedTTL), IPv4: seedIPv4}
+		out  string
+	)
+	if seedSign {
+		if password == "" {
+			password = readMasterKey(!withPassword)
+		}
+		if isc.PrivateKey, err = kms.LoadPrivateKey(cfg.PrivateKeyFile, []byte(password)); err != nil {
+			ConsoleLog.WithField("path", cfg.PrivateKeyFile).WithError(err).Error("load private key failed")
+			SetExitStatus(1)
+			return
+		}
+	}
+	if len(bps) == 1 {
+		out, err = isc.GenBPIPv6Zone(&bps[0], seedDomain, opts)
+	} else {
+		out, err = isc.GenBPsIPv6Zone(bps, seedDomain, opts)
+	}
+	if err != nil {
+		ConsoleLog.WithError(err).Error("generate seed records failed")
+		SetExitStatus(1)
+		return
+	}
+
+	if seedOut == "" {
+		fmt.Print(out)
+		return
+	}
+	if err = ioutil.WriteFile(seedOut, []byte(out), 0644); err != nil {
+		ConsoleLog.WithField("path", seedOut).WithError(err).Error("write seed records failed")
+		SetExitStatus(1)
+		return
+	}
+	ConsoleLog.WithField("path", seedOut).Infof("seed records of %d BP(s) written", len(bps))
+}
+
+func verifySeed() {
+	var (
+		isc = &route.IPv6SeedClient{
+			Resolver:         newSeedResolver(splitList(seedResolvers)),
+			RequireSignature: seedSign,
+		}
+		bps route.IDNodeMap
+		err error
+	)
+	// multiple BPs are published with the indexed scheme, a single BP under the domain directly
+	if bps, err = isc.GetBPsFromDNSSeed(seedDomain); err == nil && len(bps) == 0 {
+		bps, err = isc.GetBPFromDNSSeed(seedDomain)
+	}
+	if err != nil {
+		ConsoleLog.WithField("domain", seedDomain).WithError(err).Error("resolve seed domain failed")
+		SetExitStatus(1)
+		return
+	}
+	if len(bps) == 0 {
+		ConsoleLog.WithField("domain", seedDomain).Error("no BP published in seed domain")
+		SetExitStatus(1)
+		return
+	}
+
+	var nodes = make([]proto.Node, 0, len(bps))
+	for _, node := range bps {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	fmt.Printf("seed domain: %s\n", seedDomain)
+	fmt.Printf("BP count: %d\n", len(nodes))
+	var failed int
+	for i, node := range nodes {
+		var (
+			pub        = node.PublicKey.Serialize()
+			keyHash    = mine.HashBlock(pub, node.Nonce)
+			difficulty = keyHash.Difficulty()
+			powOK      = kms.IsIDPubNonceValid(node.ID.ToRawNodeID(), &node.Nonce, node.PublicKey)
+			result     = "OK"
+		)
+		switch {
+		case !powOK:
+			result = "FAILED: node id does not match public key and nonce"
+		case difficulty < seedMinDifficulty:
+			result = fmt.Sprintf("FAILED: difficulty %d is less than %d", difficulty, seedMinDifficulty)
+		}
+		if result != "OK" {
+			failed++
+		}
+		fmt.Printf("\nBP #%d\n", i)
+		fmt.Printf("  node id:    %s\n", node.ID)
+		fmt.Printf("  address:    %s\n", node.Addr)
+		fmt.Printf("  public key: %s\n", hex.EncodeToString(pub))
+		fmt.Printf("  nonce:      %s\n", hex.EncodeToString(node.Nonce.Bytes()))
+		fmt.Printf("  difficulty: %d\n", difficulty)
+		fmt.Printf("  result:     %s\n", result)
+	}
+
+	if failed > 0 {
+		ConsoleLog.Errorf("%d of %d BP(s) failed verification", failed, len(nodes))
+		SetExitStatus(1)
+		return
+	}
+	ConsoleLog.Infof("all %d BP(s) verified", len(nodes))
+}
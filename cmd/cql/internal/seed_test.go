@@ -0,0 +1,151 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/route"
+)
+
+const testSeedConfig = `KnownNodes:
+- ID: 00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9
+  Role: Leader
+  Addr: 127.0.0.1:3122
+  PublicKey: 02c76216704d797c64c58bc11519fb68582e8e63de7e5b3b2dbbbe8733efe5fd24
+  Nonce:
+    a: 313283
+    b: 0
+    c: 0
+    d: 0
+- ID: 00000f3b43288fe99831eb533ab77ec455d13e11fc38ec35a42d4edd17aa320d
+  Role: Client
+  Addr: 127.0.0.1:3123
+`
+
+// testZoneResolver resolves the IP records from the BIND zone.
+type testZoneResolver struct {
+	zone map[string][]net.IP
+}
+
+func newTestZoneResolver(bind string) *testZoneResolver {
+	var r = &testZoneResolver{zone: make(map[string][]net.IP)}
+	for _, line := range strings.Split(strings.TrimSpace(bind), "\n") {
+		if fields := strings.Fields(line); len(fields) == 5 && (fields[3] == "AAAA" || fields[3] == "A") {
+			r.zone[fields[0]] = append(r.zone[fields[0]], net.ParseIP(fields[4]))
+		}
+	}
+	return r
+}
+
+func (r *testZoneResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if ips, ok := r.zone[host]; ok {
+		return ips, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (r *testZoneResolver) LookupTXT(ctx context.Context, host string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestSeed(t *testing.T) {
+	Convey("Given a config with a BP", t, func() {
+		dir, err := ioutil.TempDir("", "cql_seed_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		var path = filepath.Join(dir, "config.yaml")
+		So(ioutil.WriteFile(path, []byte(testSeedConfig), 0600), ShouldBeNil)
+
+		var origResolver = newSeedResolver
+		defer func() {
+			newSeedResolver = origResolver
+			configFile, seedDomain, seedFormat, seedOut = "", "", "", ""
+			seedIPv4, seedSign, seedMinDifficulty = false, false, 0
+			exitStatus = 0
+		}()
+
+		var gen = func(format string, ipv4 bool) (out string, status int) {
+			configFile, seedDomain, seedFormat, seedIPv4 = path, "bp00.seed.test", format, ipv4
+			seedTTL, seedSign = 1, false
+			seedOut = filepath.Join(dir, format+".zone")
+			exitStatus = 0
+			genSeed()
+			data, _ := ioutil.ReadFile(seedOut)
+			return string(data), exitStatus
+		}
+
+		Convey("The seed records should be generated in the formats", func() {
+			var cases = []struct {
+				format string
+				ipv4   bool
+				status int
+				expect []string
+			}{
+				{"bind", false, 0, []string{"bp00.seed.test", "IN\tAAAA"}},
+				{"bind", true, 0, []string{"IN\tAAAA", "IN\tA\t"}},
+				{"coredns", false, 0, []string{"$ORIGIN", "SOA", "AAAA"}},
+				{"route53", false, 0, []string{`"Type": "AAAA"`, `"TTL": 1`}},
+				{"terraform", false, 0, []string{"aws_route53_record", "AAAA"}},
+				{"unknown", false, 1, nil},
+			}
+			for _, c := range cases {
+				out, status := gen(c.format, c.ipv4)
+				So(status, ShouldEqual, c.status)
+				for _, e := range c.expect {
+					So(out, ShouldContainSubstring, e)
+				}
+				// only the BP of the known nodes is published
+				So(out, ShouldNotContainSubstring, "3123")
+			}
+		})
+
+		Convey("The published BPs should be verified", func() {
+			bind, status := gen("bind", false)
+			So(status, ShouldEqual, 0)
+			var resolver = newTestZoneResolver(bind)
+			newSeedResolver = func(servers []string) route.SeedResolver { return resolver }
+
+			var cases = []struct {
+				domain        string
+				minDifficulty int
+				sign          bool
+				status        int
+			}{
+				{"bp00.seed.test", 0, false, 0},
+				{"bp00.seed.test", 20, false, 0},
+				{"bp00.seed.test", 256, false, 1},
+				{"bp00.seed.test", 0, true, 1}, // the records are not signed
+				{"bp01.seed.test", 0, false, 1},
+			}
+			for _, c := range cases {
+				seedDomain, seedMinDifficulty, seedSign = c.domain, c.minDifficulty, c.sign
+				exitStatus = 0
+				verifySeed()
+				So(exitStatus, ShouldEqual, c.status)
+			}
+		})
+	})
+}
@@ -0,0 +1,136 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"flag"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/SQLess/SQLess/client"
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/utils"
+)
+
+// signerTokenEnv is the environment variable of the bearer token shared by the policy signer
+// and its clients.
+const signerTokenEnv = "CQL_SIGNER_TOKEN"
+
+// CmdSigner is cql signer command entity.
+var CmdSigner = &Command{
+	UsageLine: "cql signer [common params] [-hw-wallet-bridge command [-hw-wallet-path path]] listen_address",
+	Short:     "serve the key as a policy signer enforcing its spending policy",
+	Long: `
+Signer holds the private key of the config, or the hardware wallet, in a separate process and
+signs the transactions of the clients within the spending policy of the key. The spending is
+persisted to the SpendingLedgerFile of the config, so the daily limit holds across restarts and
+for all the clients, which never hold the key. The transactions above the approval threshold
+are refused. The clients authenticate with the token in $CQL_SIGNER_TOKEN.
+e.g.
+    CQL_SIGNER_TOKEN=<token> cql signer 127.0.0.1:4665
+
+Sign the transactions of a client with the signer:
+    CQL_SIGNER_TOKEN=<token> cql transfer -remote-signer http://127.0.0.1:4665 ...
+`,
+	Flag:       flag.NewFlagSet("Signer params", flag.ExitOnError),
+	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
+	DebugFlag:  flag.NewFlagSet("Debug params", flag.ExitOnError),
+}
+
+func init() {
+	CmdSigner.Run = runSigner
+
+	addCommonFlags(CmdSigner)
+	addConfigFlag(CmdSigner)
+	CmdSigner.Flag.StringVar(&hwWalletBridge, "hw-wallet-bridge", "",
+		"Hardware wallet bridge command to sign the transactions, e.g. \"cql-ledger-bridge --device ledger\"")
+	CmdSigner.Flag.StringVar(&hwWalletPath, "hw-wallet-path", "",
+		"Key derivation path on the hardware wallet, empty for the bridge default")
+}
+
+func runSigner(cmd *Command, args []string) {
+	commonFlagsInit(cmd)
+
+	if len(args) != 1 {
+		ConsoleLog.Error("signer command need listen address as param")
+		SetExitStatus(1)
+		printCommandHelp(cmd)
+		Exit()
+	}
+	var token = os.Getenv(signerTokenEnv)
+	if token == "" {
+		ConsoleLog.Errorf("signer command need the client token in $%s", signerTokenEnv)
+		SetExitStatus(1)
+		return
+	}
+
+	signer, err := offlineSigner()
+	if err != nil {
+		ConsoleLog.WithError(err).Error("load signer key failed")
+		SetExitStatus(1)
+		return
+	}
+	if conf.GConf == nil {
+		if conf.GConf, err = conf.LoadConfig(utils.HomeDirExpand(configFile)); err != nil {
+			ConsoleLog.WithError(err).Error("load config failed")
+			SetExitStatus(1)
+			return
+		}
+	}
+	addr, err := crypto.PubKeyHash(signer.PubKey())
+	if err != nil {
+		ConsoleLog.WithError(err).Error("get signer address failed")
+		SetExitStatus(1)
+		return
+	}
+	var policy *conf.SpendingPolicy
+	for i := range conf.GConf.SpendingPolicies {
+		if conf.GConf.SpendingPolicies[i].Account == addr {
+			policy = &conf.GConf.SpendingPolicies[i]
+			break
+		}
+	}
+	if policy == nil {
+		ConsoleLog.WithField("addr", addr.String()).Error("no spending policy of the signer account in config")
+		SetExitStatus(1)
+		return
+	}
+	ps, err := client.NewPolicySigner(signer, policy, conf.GConf.SpendingLedgerFile, nil)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("start policy signer failed")
+		SetExitStatus(1)
+		return
+	}
+
+	listener, err := net.Listen("tcp", args[0])
+	if err != nil {
+		ConsoleLog.WithError(err).Error("listen failed")
+		SetExitStatus(1)
+		return
+	}
+	server := &http.Server{Handler: ps.Handler(token)}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Close()
+
+	ConsoleLog.WithField("addr", addr.String()).Infof("policy signer started on %s", args[0])
+	ConsoleLog.Printf("Ctrl + C to stop policy signer on %s\n", args[0])
+	<-utils.WaitForExit()
+}
@@ -17,12 +17,14 @@
 package internal
 
 import (
+	"encoding/csv"
 	"flag"
+	"fmt"
+	"os"
+	"strconv"
 	"strings"
 
 	"github.com/SQLess/SQLess/client"
-	"github.com/SQLess/SQLess/crypto/hash"
-	"github.com/SQLess/SQLess/proto"
 	"github.com/SQLess/SQLess/types"
 )
 
@@ -31,11 +33,12 @@ var (
 	toDSN     string
 	amount    uint64
 	tokenType string
+	batchFile string
 )
 
 // CmdTransfer is cql transfer command entity.
 var CmdTransfer = &Command{
-	UsageLine: "cql transfer [common params] [-wait-tx-confirm] [-to-user wallet | -to-dsn dsn] [-amount count] [-token token_type]",
+	UsageLine: "cql transfer [common params] [-wait-tx-confirm] [-hw-wallet-bridge command] [-to-user wallet | -to-dsn dsn | -batch file] [-amount count] [-token token_type]",
 	Short:     "transfer token to target account",
 	Long: `
 Transfer transfers your token to the target account or database.
@@ -43,10 +46,24 @@ The command arguments are target wallet address(or dsn), amount of token, and to
 e.g.
     cql transfer -to-user=43602c17adcc96acf2f68964830bb6ebfbca6834961c0eca0915fcc5270e0b40 -amount=100 -token=Particle
 
+The target user could also be a name registered by "cql name".
+e.g.
+    cql transfer -to-user=alice -amount=100 -token=Particle
+
 Since CovenantSQL is built on top of the blockchain, you need to wait for the transaction
 confirmation before the transfer takes effect.
 e.g.
     cql transfer -wait-tx-confirm -to-dsn="cqlprotocol://xxxx" -amount=100 -token=Particle
+
+To transfer token from an account held by a hardware wallet, sign the transaction through a
+Ledger or Trezor bridge command and confirm it on the device.
+e.g.
+    cql transfer -hw-wallet-bridge "cql-ledger-bridge --device ledger" -to-user=43602c17adcc96acf2f68964830bb6ebfbca6834961c0eca0915fcc5270e0b40 -amount=100 -token=Particle
+
+To transfer token to many user accounts in a single transaction, such as airdrops and payouts,
+provide a csv file of receiver and amount pairs, the receiver could also be a registered name.
+e.g.
+    cql transfer -batch=payouts.csv -token=Particle
 `,
 	Flag:       flag.NewFlagSet("Transfer params", flag.ExitOnError),
 	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
@@ -59,23 +76,90 @@ func init() {
 	addCommonFlags(CmdTransfer)
 	addConfigFlag(CmdTransfer)
 	addWaitFlag(CmdTransfer)
-	CmdTransfer.Flag.StringVar(&toUser, "to-user", "", "Target address of an user account to transfer token")
+	addHWWalletFlags(CmdTransfer)
+	CmdTransfer.Flag.StringVar(&toUser, "to-user", "", "Target address or registered name of an user account to transfer token")
 	CmdTransfer.Flag.StringVar(&toDSN, "to-dsn", "", "Target database dsn to transfer token")
 	CmdTransfer.Flag.Uint64Var(&amount, "amount", 0, "Token account to transfer")
 	CmdTransfer.Flag.StringVar(&tokenType, "token", "", "Token type to transfer, e.g. Particle, Wave")
+	CmdTransfer.Flag.StringVar(&batchFile, "batch", "", "CSV file of receiver and amount pairs to transfer token in batch")
+}
+
+// readTransferBatch reads the receiver and amount pairs from the csv file.
+func readTransferBatch(path string) (receivers []types.TransferReceiver, err error) {
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+	defer func() { _ = f.Close() }()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return
+	}
+	for i, record := range records {
+		var receiver types.TransferReceiver
+		if receiver.Receiver, err = client.ResolveAccount(record[0]); err != nil {
+			err = fmt.Errorf("line %d: %v", i+1, err)
+			return
+		}
+		if receiver.Amount, err = strconv.ParseUint(record[1], 10, 64); err != nil {
+			err = fmt.Errorf("line %d: %v", i+1, err)
+			return
+		}
+		receivers = append(receivers, receiver)
+	}
+	return
+}
+
+func runTransferBatch(unit types.TokenType) {
+	configInit()
+	hwWalletInit()
+
+	receivers, err := readTransferBatch(batchFile)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("read transfer batch failed")
+		SetExitStatus(1)
+		return
+	}
+	if len(receivers) == 0 || len(receivers) > types.MaxTransferBatchSize {
+		ConsoleLog.Errorf("transfer batch should have 1 to %d receivers", types.MaxTransferBatchSize)
+		SetExitStatus(1)
+		return
+	}
+
+	txHash, err := client.TransferTokenBatch(receivers, unit)
+	if err != nil {
+		ConsoleLog.WithError(err).Error("transfer token failed")
+		SetExitStatus(1)
+		return
+	}
+
+	if waitTxConfirmation {
+		err = wait(txHash)
+		if err != nil {
+			ConsoleLog.WithError(err).Error("transfer token failed")
+			SetExitStatus(1)
+			return
+		}
+	}
+
+	ConsoleLog.Info("succeed in sending transaction to CQL")
 }
 
 func runTransfer(cmd *Command, args []string) {
 	commonFlagsInit(cmd)
 
-	if len(args) > 0 || (toUser == "" && toDSN == "") || tokenType == "" {
-		ConsoleLog.Error("transfer command need to-user(or to-dsn) address and token type as param")
+	if len(args) > 0 || (toUser == "" && toDSN == "" && batchFile == "") || tokenType == "" {
+		ConsoleLog.Error("transfer command need to-user(or to-dsn, batch) address and token type as param")
 		SetExitStatus(1)
 		printCommandHelp(cmd)
 		Exit()
 	}
-	if toUser != "" && toDSN != "" {
-		ConsoleLog.Error("transfer command accepts either to-user or to-dsn as param")
+	if (toUser != "" && toDSN != "") || (batchFile != "" && (toUser != "" || toDSN != "")) {
+		ConsoleLog.Error("transfer command accepts either to-user, to-dsn or batch as param")
 		SetExitStatus(1)
 		printCommandHelp(cmd)
 		Exit()
@@ -88,6 +172,11 @@ func runTransfer(cmd *Command, args []string) {
 		return
 	}
 
+	if batchFile != "" {
+		runTransferBatch(unit)
+		return
+	}
+
 	var addr string
 	if toUser != "" {
 		addr = toUser
@@ -101,15 +190,15 @@ func runTransfer(cmd *Command, args []string) {
 		addr = strings.TrimLeft(toDSN, client.DBSchemeAlias+"://")
 	}
 
-	targetAccountHash, err := hash.NewHashFromStr(addr)
+	configInit()
+	hwWalletInit()
+
+	targetAccount, err := client.ResolveAccount(addr)
 	if err != nil {
 		ConsoleLog.WithError(err).Error("target account address is not valid")
 		SetExitStatus(1)
 		return
 	}
-	targetAccount := proto.AccountAddress(*targetAccountHash)
-
-	configInit()
 
 	txHash, err := client.TransferToken(targetAccount, amount, unit)
 	if err != nil {
@@ -0,0 +1,361 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/client"
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hwwallet"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+)
+
+var (
+	txBuild    string
+	txBody     string
+	txNonceOf  string
+	txSign     bool
+	txSubmit   bool
+	txSim      bool
+	txMultiSig string
+)
+
+// CmdTx is cql tx command entity.
+var CmdTx = &Command{
+	UsageLine: "cql tx [common params] [-build type -body json [-nonce-of account] [-multisig policy]] [-sign] [-simulate] [-submit [-wait-tx-confirm]] file",
+	Short:     "build, sign offline and submit a transaction",
+	Long: `
+Tx builds any registered transaction from its JSON body to a file, which could be carried to an
+air-gapped machine to be signed, and carried back to be submitted to block producers.
+
+Build a transfer transaction on an online machine, the nonce is fetched for the sender account:
+    cql tx -build Transfer -body '{"Sender":"<addr>","Receiver":"<addr>","Amount":100}' \
+        -nonce-of <addr> transfer.json
+
+Sign the transaction file on the air-gapped machine, no network access is needed:
+    cql tx -sign transfer.json
+
+Check the signed transaction file against current chain state without submitting it:
+    cql tx -simulate transfer.json
+
+Submit the signed transaction file on an online machine:
+    cql tx -submit -wait-tx-confirm transfer.json
+
+A multi-signature account is co-owned by its members, its Transfer, CreateDatabase and
+UpdatePermission transactions take effect only if signed by enough members. The account is
+defined by a policy of the required signature count and the hex public keys of the members,
+print the account address of the policy to fund it:
+    cql tx -multisig 2:<pubkey1>,<pubkey2>,<pubkey3>
+
+Build the transaction of the account with the policy, the nonce is fetched for the account. Then
+carry the file to the members in turn to sign it with "cql tx -sign", and submit it once enough
+members signed it:
+    cql tx -build Transfer -body '{"Sender":"<multisig addr>","Receiver":"<addr>","Amount":100}' \
+        -multisig 2:<pubkey1>,<pubkey2>,<pubkey3> transfer.json
+`,
+	Flag:       flag.NewFlagSet("Tx params", flag.ExitOnError),
+	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
+	DebugFlag:  flag.NewFlagSet("Debug params", flag.ExitOnError),
+}
+
+func init() {
+	CmdTx.Run = runTx
+
+	addCommonFlags(CmdTx)
+	addConfigFlag(CmdTx)
+	addWaitFlag(CmdTx)
+	addHWWalletFlags(CmdTx)
+	CmdTx.Flag.StringVar(&txBuild, "build", "", "Build a transaction of the type, e.g. Transfer, UpdatePermission")
+	CmdTx.Flag.StringVar(&txBody, "body", "{}", "JSON body of the transaction to build")
+	CmdTx.Flag.StringVar(&txNonceOf, "nonce-of", "", "Fetch the next nonce of the account as the transaction nonce")
+	CmdTx.Flag.BoolVar(&txSign, "sign", false, "Sign the transaction file offline")
+	CmdTx.Flag.BoolVar(&txSubmit, "submit", false, "Submit the signed transaction file")
+	CmdTx.Flag.BoolVar(&txSim, "simulate", false, "Simulate the signed transaction file without submitting")
+	CmdTx.Flag.StringVar(&txMultiSig, "multisig", "",
+		"Policy of the multi-signature account as threshold:pubkey1,pubkey2,..., prints the account address without other params")
+}
+
+func runTx(cmd *Command, args []string) {
+	commonFlagsInit(cmd)
+
+	var modes int
+	for _, m := range []bool{txBuild != "", txSign, txSim, txSubmit} {
+		if m {
+			modes++
+		}
+	}
+	if txMultiSig != "" && len(args) == 0 && modes == 0 {
+		if err := printMultiSigAddress(); err != nil {
+			ConsoleLog.WithError(err).Error("tx command failed")
+			SetExitStatus(1)
+		}
+		return
+	}
+	if len(args) != 1 || modes != 1 {
+		ConsoleLog.Error("tx command needs one of -build, -sign, -simulate or -submit, and a transaction file as param")
+		SetExitStatus(1)
+		printCommandHelp(cmd)
+		Exit()
+	}
+
+	var (
+		file = args[0]
+		err  error
+	)
+	switch {
+	case txBuild != "":
+		err = buildTx(file)
+	case txSign:
+		err = signTx(file)
+	case txSim:
+		err = simulateTx(file)
+	case txSubmit:
+		err = submitTx(file)
+	}
+	if err != nil {
+		ConsoleLog.WithField("file", file).WithError(err).Error("tx command failed")
+		SetExitStatus(1)
+	}
+}
+
+func buildTx(file string) (err error) {
+	txType, err := pi.ParseTransactionType(txBuild)
+	if err != nil {
+		return
+	}
+	var (
+		body   = []byte(txBody)
+		policy *types.MultiSigPolicy
+	)
+	if txMultiSig != "" {
+		var addr proto.AccountAddress
+		if policy, err = parseMultiSigPolicy(txMultiSig); err != nil {
+			return
+		}
+		if addr, err = policy.Address(); err != nil {
+			return
+		}
+		// the transaction is sent by the multi-signature account
+		if txNonceOf == "" {
+			txNonceOf = addr.String()
+		}
+	}
+	if txNonceOf != "" {
+		configInit()
+		var (
+			addr  proto.AccountAddress
+			nonce pi.AccountNonce
+			m     map[string]interface{}
+		)
+		if err = addr.UnmarshalJSON([]byte(`"` + txNonceOf + `"`)); err != nil {
+			return
+		}
+		if nonce, err = client.NextNonce(addr); err != nil {
+			return
+		}
+		if err = json.Unmarshal(body, &m); err != nil {
+			return
+		}
+		m["Nonce"] = nonce
+		if body, err = json.Marshal(m); err != nil {
+			return
+		}
+	}
+	tx, err := client.NewTx(txType, body)
+	if err != nil {
+		return
+	}
+	var otx *client.OfflineTx
+	if policy != nil {
+		otx, err = client.PrepareMultiSigTx(policy, tx)
+	} else {
+		otx, err = client.PrepareTx(tx)
+	}
+	if err != nil {
+		return
+	}
+	if err = writeOfflineTx(file, otx); err != nil {
+		return
+	}
+	fmt.Printf("Transaction %s built to %s\nHash: %s\n", otx.Type, file, otx.Hash)
+	return
+}
+
+// offlineSigner returns the remote policy signer, the hardware wallet signer or the private key
+// of the config, only the remote signer connects to the network.
+func offlineSigner() (signer asymmetric.Signer, err error) {
+	if remoteSignerURL != "" {
+		return client.NewRemoteSigner(remoteSignerURL, os.Getenv(signerTokenEnv))
+	}
+	if hwWalletBridge != "" {
+		return hwwallet.NewSigner(&hwwallet.Config{
+			Bridge: hwWalletBridge,
+			Path:   hwWalletPath,
+		})
+	}
+	if conf.GConf, err = conf.LoadConfig(utils.HomeDirExpand(configFile)); err != nil {
+		return
+	}
+	if password == "" {
+		password = readMasterKey(!withPassword)
+	}
+	return kms.LoadPrivateKey(conf.GConf.PrivateKeyFile, []byte(password))
+}
+
+func signTx(file string) (err error) {
+	otx, err := readOfflineTx(file)
+	if err != nil {
+		return
+	}
+	// show the transaction to be checked before signing
+	content, err := json.MarshalIndent(otx.Tx, "", "  ")
+	if err != nil {
+		return
+	}
+	fmt.Printf("Signing %s transaction %s:\n%s\n", otx.Type, otx.Hash, content)
+	signer, err := offlineSigner()
+	if err != nil {
+		return
+	}
+	if err = otx.Sign(signer); err != nil {
+		return
+	}
+	if err = writeOfflineTx(file, otx); err != nil {
+		return
+	}
+	fmt.Printf("Transaction signed to %s\n", file)
+	return
+}
+
+func submitTx(file string) (err error) {
+	otx, err := readOfflineTx(file)
+	if err != nil {
+		return
+	}
+	configInit()
+	txHash, err := client.SubmitTx(otx)
+	if err != nil {
+		return
+	}
+	fmt.Printf("Transaction submitted: %s\n", txHash)
+	if waitTxConfirmation {
+		err = wait(txHash)
+	}
+	return
+}
+
+func simulateTx(file string) (err error) {
+	otx, err := readOfflineTx(file)
+	if err != nil {
+		return
+	}
+	tx, err := otx.SignedTx()
+	if err != nil {
+		return
+	}
+	configInit()
+	resp, err := client.SimulateTx(tx)
+	if err != nil {
+		return
+	}
+	if !resp.OK {
+		fmt.Printf("Transaction would fail: %s (next nonce %d)\n", resp.Error, resp.Nonce)
+		SetExitStatus(1)
+		return
+	}
+	fmt.Printf("Transaction would succeed, balance changes:\n")
+	for _, v := range resp.Changes {
+		fmt.Printf("  %s %s: %d -> %d\n", v.Address, v.TokenType, v.Before, v.After)
+	}
+	return
+}
+
+// parseMultiSigPolicy parses the policy of the multi-signature account from
+// threshold:pubkey1,pubkey2,... with hex encoded public keys.
+func parseMultiSigPolicy(s string) (policy *types.MultiSigPolicy, err error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		err = fmt.Errorf("invalid multi-signature policy %s, use threshold:pubkey1,pubkey2,...", s)
+		return
+	}
+	threshold, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return
+	}
+	policy = &types.MultiSigPolicy{Threshold: uint32(threshold)}
+	for _, k := range strings.Split(parts[1], ",") {
+		var (
+			buf []byte
+			pub *asymmetric.PublicKey
+		)
+		if buf, err = hex.DecodeString(strings.TrimSpace(k)); err != nil {
+			return
+		}
+		if pub, err = asymmetric.ParsePubKey(buf); err != nil {
+			return
+		}
+		policy.PubKeys = append(policy.PubKeys, pub)
+	}
+	err = policy.Validate()
+	return
+}
+
+func printMultiSigAddress() (err error) {
+	policy, err := parseMultiSigPolicy(txMultiSig)
+	if err != nil {
+		return
+	}
+	addr, err := policy.Address()
+	if err != nil {
+		return
+	}
+	fmt.Printf("Multi-signature account: %s\n", addr.String())
+	return
+}
+
+func readOfflineTx(file string) (otx *client.OfflineTx, err error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	otx = &client.OfflineTx{}
+	if err = json.Unmarshal(data, otx); err != nil {
+		otx = nil
+	}
+	return
+}
+
+func writeOfflineTx(file string, otx *client.OfflineTx) (err error) {
+	data, err := json.MarshalIndent(otx, "", "  ")
+	if err != nil {
+		return
+	}
+	return ioutil.WriteFile(file, data, 0600)
+}
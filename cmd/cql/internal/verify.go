@@ -0,0 +1,222 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/SQLess/SQLess/client"
+	"github.com/SQLess/SQLess/proto"
+)
+
+var (
+	verifyReplicas string
+	verifyBackup   string
+	verifyTables   string
+)
+
+// CmdVerify is cql verify command entity.
+var CmdVerify = &Command{
+	UsageLine: "cql verify [common params] [-replicas node_a,node_b] [-backup file] [-tables t1,t2] dsn",
+	Short:     "compare the table rows of two database replicas",
+	Long: `
+Verify compares the table rows of two replicas of a database, or a replica and a local backup
+file, by hashing the rows in chunks. It reports the exact rowids which differ without dumping
+the tables. Only the database owner is allowed to verify the replicas.
+e.g.
+    cql verify cqlprotocol://4119ef997dedc585bfbcfae00ab6b87b8486fab323a8e107ea1fd4fc4f7eba5c
+
+The leader and the first follower are compared by default, specify the replicas by node id:
+    cql verify -replicas 00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9,000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade \
+        cqlprotocol://4119ef997dedc585bfbcfae00ab6b87b8486fab323a8e107ea1fd4fc4f7eba5c
+
+Compare the leader with a backup file:
+    cql verify -backup backup.db -tables users,orders \
+        cqlprotocol://4119ef997dedc585bfbcfae00ab6b87b8486fab323a8e107ea1fd4fc4f7eba5c
+`,
+	Flag:       flag.NewFlagSet("Verify params", flag.ExitOnError),
+	CommonFlag: flag.NewFlagSet("Common params", flag.ExitOnError),
+	DebugFlag:  flag.NewFlagSet("Debug params", flag.ExitOnError),
+}
+
+func init() {
+	CmdVerify.Run = runVerify
+
+	addCommonFlags(CmdVerify)
+	addConfigFlag(CmdVerify)
+	CmdVerify.Flag.StringVar(&verifyReplicas, "replicas", "",
+		"Comma separated node ids of the replicas to compare, defaults to the leader and a follower")
+	CmdVerify.Flag.StringVar(&verifyBackup, "backup", "", "Local SQLite backup file to compare with")
+	CmdVerify.Flag.StringVar(&verifyTables, "tables", "", "Comma separated tables to compare, defaults to all tables")
+}
+
+func splitList(s string) (list []string) {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return
+}
+
+func listTables(dsn string) (tables []string, err error) {
+	db, err := sql.Open(client.DBScheme, dsn)
+	if err != nil {
+		return
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT "name" FROM "sqlite_master" ` +
+		`WHERE "type"='table' AND "name" NOT LIKE 'sqlite\_%' ESCAPE '\' ORDER BY "name"`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return
+		}
+		tables = append(tables, name)
+	}
+	err = rows.Err()
+	return
+}
+
+func runVerify(cmd *Command, args []string) {
+	commonFlagsInit(cmd)
+
+	if len(args) != 1 {
+		ConsoleLog.Error("verify command need CQL dsn or database_id string as param")
+		SetExitStatus(1)
+		printCommandHelp(cmd)
+		Exit()
+	}
+
+	configInit()
+
+	var dsn = args[0]
+	if _, err := client.ParseDSN(dsn); err != nil {
+		ConsoleLog.WithField("db", dsn).WithError(err).Error("not a valid dsn")
+		SetExitStatus(1)
+		return
+	}
+
+	var (
+		nodes = splitList(verifyReplicas)
+		want  = 2
+	)
+	if verifyBackup != "" {
+		want = 1
+	}
+	if len(nodes) == 0 {
+		replicas, err := client.ReplicaNodes(dsn)
+		if err != nil {
+			ConsoleLog.WithError(err).Error("get database replicas failed")
+			SetExitStatus(1)
+			return
+		}
+		for _, n := range replicas {
+			nodes = append(nodes, string(n))
+		}
+		if len(nodes) > want {
+			nodes = nodes[:want]
+		}
+	}
+	if len(nodes) != want {
+		ConsoleLog.Errorf("verify needs %d replicas to compare, got %d", want, len(nodes))
+		SetExitStatus(1)
+		return
+	}
+
+	var digesters [2]client.RowDigester
+	for i, n := range nodes {
+		d, err := client.NewReplicaDigester(dsn, proto.NodeID(n))
+		if err != nil {
+			ConsoleLog.WithField("node", n).WithError(err).Error("connect to replica failed")
+			SetExitStatus(1)
+			return
+		}
+		defer d.Close()
+		digesters[i] = d
+	}
+	var names = nodes
+	if verifyBackup != "" {
+		d, err := client.NewFileDigester(verifyBackup)
+		if err != nil {
+			ConsoleLog.WithField("backup", verifyBackup).WithError(err).Error("open backup file failed")
+			SetExitStatus(1)
+			return
+		}
+		defer d.Close()
+		digesters[1] = d
+		names = append(names, verifyBackup)
+	}
+
+	var tables = splitList(verifyTables)
+	if len(tables) == 0 {
+		var err error
+		if tables, err = listTables(dsn); err != nil {
+			ConsoleLog.WithError(err).Error("list database tables failed")
+			SetExitStatus(1)
+			return
+		}
+	}
+
+	fmt.Printf("A: %s\nB: %s\n\n", names[0], names[1])
+	var divergent int
+	for _, t := range tables {
+		diff, err := client.DiffTable(context.Background(), digesters[0], digesters[1], t)
+		if err != nil {
+			ConsoleLog.WithField("table", t).WithError(err).Error("compare table failed")
+			SetExitStatus(1)
+			return
+		}
+		if diff.Equal() {
+			fmt.Printf("%s: identical\n", t)
+			continue
+		}
+		divergent++
+		fmt.Printf("%s: divergent\n", t)
+		printRowIDs("  only in A", diff.OnlyA)
+		printRowIDs("  only in B", diff.OnlyB)
+		printRowIDs("  changed", diff.Changed)
+	}
+	if divergent > 0 {
+		ConsoleLog.Errorf("%d of %d tables are divergent", divergent, len(tables))
+		SetExitStatus(1)
+	}
+}
+
+func printRowIDs(title string, ids []int64) {
+	const maxPrinted = 100
+	if len(ids) == 0 {
+		return
+	}
+	var s = make([]string, 0, maxPrinted)
+	for i, id := range ids {
+		if i == maxPrinted {
+			s = append(s, fmt.Sprintf("... (%d more)", len(ids)-maxPrinted))
+			break
+		}
+		s = append(s, fmt.Sprint(id))
+	}
+	fmt.Printf("%s (%d rows): rowid %s\n", title, len(ids), strings.Join(s, ", "))
+}
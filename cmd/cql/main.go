@@ -39,8 +39,18 @@ func init() {
 		internal.CmdDrop,
 		internal.CmdTransfer,
 		internal.CmdGrant,
+		internal.CmdName,
+		internal.CmdReserve,
+		internal.CmdDecommission,
 		internal.CmdExplorer,
 		internal.CmdIDMiner,
+		internal.CmdSeed,
+		internal.CmdProvision,
+		internal.CmdReplay,
+		internal.CmdVerify,
+		internal.CmdBench,
+		internal.CmdTx,
+		internal.CmdSigner,
 		internal.CmdRPC,
 		internal.CmdVersion,
 		internal.CmdHelp,
@@ -0,0 +1,60 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conf
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+var (
+	// Version defines the release version of the binary, set by -ldflags.
+	Version = "unknown"
+	// BuildHash defines the source revision of the binary, set by -ldflags.
+	BuildHash = "unknown"
+
+	capabilities   = make(map[string]struct{})
+	capabilitiesMu sync.RWMutex
+)
+
+// RegisterCapability registers an enabled capability of the node, which is announced to block
+// producers with build info.
+func RegisterCapability(name string) {
+	capabilitiesMu.Lock()
+	defer capabilitiesMu.Unlock()
+	capabilities[name] = struct{}{}
+}
+
+// GetBuildInfo returns the build info of the running binary.
+func GetBuildInfo() (info proto.BuildInfo) {
+	info = proto.BuildInfo{
+		Version:   Version,
+		BuildHash: BuildHash,
+		GoVersion: runtime.Version(),
+		Role:      RoleTag,
+	}
+	capabilitiesMu.RLock()
+	defer capabilitiesMu.RUnlock()
+	for c := range capabilities {
+		info.Capabilities = append(info.Capabilities, c)
+	}
+	sort.Strings(info.Capabilities)
+	return
+}
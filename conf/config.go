@@ -52,9 +52,14 @@ type BaseAccountInfo struct {
 	CovenantCoinBalance uint64    `yaml:"CovenantCoinBalance"`
 }
 
+// GenesisVersionProduction is the bit of the BP genesis block version which marks a production
+// chain. The version is covered by the genesis block hash, so all the nodes of a chain agree on
+// it, and the DevMode is refused on a production chain.
+const GenesisVersionProduction int32 = 1 << 30
+
 // BPGenesisInfo hold all genesis info fields.
 type BPGenesisInfo struct {
-	// Version defines the block version
+	// Version defines the block version, see GenesisVersionProduction
 	Version int32 `yaml:"Version"`
 	// Timestamp defines the initial time of chain
 	Timestamp time.Time `yaml:"Timestamp"`
@@ -62,6 +67,11 @@ type BPGenesisInfo struct {
 	BaseAccounts []BaseAccountInfo `yaml:"BaseAccounts"`
 }
 
+// Production returns whether the genesis marks a production chain.
+func (g *BPGenesisInfo) Production() bool {
+	return g.Version&GenesisVersionProduction != 0
+}
+
 // BPInfo hold all BP info fields.
 type BPInfo struct {
 	// PublicKey point to BlockProducer public key
@@ -98,17 +108,120 @@ type MinerInfo struct {
 	TargetUsers            []proto.AccountAddress `yaml:"TargetUsers,omitempty"`
 }
 
+// KeyVault defines the HashiCorp Vault keystore of the node private key.
+type KeyVault struct {
+	// Addr is the Vault address, VAULT_ADDR is used if empty.
+	Addr string `yaml:"Addr,omitempty"`
+	// Token is the Vault token, VAULT_TOKEN is used if empty.
+	Token Secret `yaml:"Token,omitempty"`
+	// Path is the KV path of the key, e.g. secret/data/miners/node1 for KV version 2 engine.
+	Path string `yaml:"Path"`
+	// Field is the field of the key in the KV secret, default "private_key".
+	Field string `yaml:"Field,omitempty"`
+	// TransitKey is the name of the Transit key which wraps the stored private key, the key is
+	// stored in plain encoding if empty.
+	TransitKey string `yaml:"TransitKey,omitempty"`
+	// TransitMount is the mount path of the Transit engine, default "transit".
+	TransitMount string `yaml:"TransitMount,omitempty"`
+}
+
 // DNSSeed defines seed DNS info.
 type DNSSeed struct {
 	EnforcedDNSSEC bool     `yaml:"EnforcedDNSSEC"`
 	DNSServers     []string `yaml:"DNSServers"`
 	Domain         string   `yaml:"Domain"`
 	BPCount        int      `yaml:"BPCount"`
+	// Domains are the additional seed domains, which are looked up concurrently with Domain,
+	// the BPs of the domains succeeded are merged.
+	Domains []string `yaml:"Domains"`
+	// TrustAnchors are the DS records in presentation format which the DNSSEC chain of trust
+	// of the seed records starts from, e.g. "example.com. IN DS 2371 13 2 1F98...".
+	TrustAnchors []string `yaml:"TrustAnchors"`
+	// Encoding is the preferred encoding of the seed records: "aaaa" (default) or "txt".
+	Encoding string `yaml:"Encoding"`
+	// Resolver is the DNS-over-HTTPS (RFC 8484) endpoint of the seed lookups, e.g.
+	// "https://1.1.1.1/dns-query", the system resolver is used if empty.
+	Resolver string `yaml:"Resolver"`
+	// CacheFile persists the BPs decoded from the seed, so that the node can boot offline or
+	// during seed outages, it is disabled if empty.
+	CacheFile string `yaml:"CacheFile"`
+	// CacheTTL is the duration to use the cached BPs without looking up the seed, defaults to 24h.
+	CacheTTL time.Duration `yaml:"CacheTTL"`
+	// JSONSeeds are the https urls or local file paths of the signed JSON seed documents, which
+	// are tried in order if the DNS seeding fails.
+	JSONSeeds []string `yaml:"JSONSeeds"`
+	// JSONSeedSigner is the hex encoded public key signing the JSON seed documents.
+	JSONSeedSigner string `yaml:"JSONSeedSigner"`
+	// RequireSignature rejects the DNS seed records without the sig record signed by the BP.
+	RequireSignature bool `yaml:"RequireSignature"`
+}
+
+// SeedDomains returns the configured seed domains without duplicates, Domain comes first.
+func (s *DNSSeed) SeedDomains() (domains []string) {
+	var seen = make(map[string]bool)
+	for _, d := range append([]string{s.Domain}, s.Domains...) {
+		if d != "" && !seen[d] {
+			seen[d] = true
+			domains = append(domains, d)
+		}
+	}
+	return
+}
+
+// KubernetesDiscovery defines the peer discovery from Kubernetes headless service.
+type KubernetesDiscovery struct {
+	// Service is the name of the headless service of peers.
+	Service string `yaml:"Service"`
+	// Namespace of the service, defaults to the namespace of the pod.
+	Namespace string `yaml:"Namespace,omitempty"`
+	// ClusterDomain defaults to cluster.local.
+	ClusterDomain string `yaml:"ClusterDomain,omitempty"`
+	// Port overrides the port of discovered peers.
+	Port int `yaml:"Port,omitempty"`
+	// UseAPI reads the service endpoints from Kubernetes API instead of DNS.
+	UseAPI bool `yaml:"UseAPI,omitempty"`
+	// Interval of refreshing peer addresses, defaults to 30s.
+	Interval time.Duration `yaml:"Interval,omitempty"`
+}
+
+// MDNSDiscovery defines the peer discovery on the local network via multicast DNS, it is meant
+// for local development clusters since the announcements are not authenticated.
+type MDNSDiscovery struct {
+	// Service is the mDNS service name of peers, defaults to _sqless._udp.local.
+	Service string `yaml:"Service,omitempty"`
+	// Interface is the network interface to multicast on, all interfaces are used if empty.
+	Interface string `yaml:"Interface,omitempty"`
+	// Role of this node in the announcements, nodes of the Client role only discover peers. It
+	// defaults to the role of this node in KnownNodes, or Miner if the Miner section is set.
+	Role proto.ServerRole `yaml:"Role,omitempty"`
+	// Interval of announcing and querying peers, defaults to 10s.
+	Interval time.Duration `yaml:"Interval,omitempty"`
+}
+
+// SpendingPolicy limits the tokens spent by the transactions signed with the key of an account,
+// so that a leaked automation key could only do bounded harm. The limits are enforced by the
+// signer holding the key, i.e. the client process or a policy signer serving the clients.
+type SpendingPolicy struct {
+	// Account is the account address of the key.
+	Account proto.AccountAddress `yaml:"Account"`
+	// MaxDailySpend is the max tokens spent in any 24 hours, no limit if it's zero.
+	MaxDailySpend uint64 `yaml:"MaxDailySpend,omitempty"`
+	// AllowedReceivers are the only accounts allowed to receive transfers, any account is allowed
+	// if it's empty.
+	AllowedReceivers []proto.AccountAddress `yaml:"AllowedReceivers,omitempty"`
+	// ApprovalThreshold is the amount above which a transaction requires a second approval, no
+	// approval is required if it's zero.
+	ApprovalThreshold uint64 `yaml:"ApprovalThreshold,omitempty"`
 }
 
 // Config holds all the config read from yaml config file.
 type Config struct {
 	UseTestMasterKey bool `yaml:"UseTestMasterKey,omitempty"` // when UseTestMasterKey use default empty masterKey
+	// KeyVault stores the node private key in HashiCorp Vault instead of PrivateKeyFile.
+	KeyVault *KeyVault `yaml:"KeyVault,omitempty"`
+	// MasterKey is the master key of the private key file if not provided on startup, it should
+	// be a secret reference like env://CQL_MASTER_KEY instead of plaintext, see ResolveSecret.
+	MasterKey Secret `yaml:"MasterKey,omitempty"`
 	// StartupSyncHoles indicates synchronizing hole blocks from other peers on BP
 	// startup/reloading.
 	StartupSyncHoles bool `yaml:"StartupSyncHoles,omitempty"`
@@ -117,6 +230,7 @@ type Config struct {
 	WorkingRoot        string            `yaml:"WorkingRoot"`
 	PubKeyStoreFile    string            `yaml:"PubKeyStoreFile"`
 	PrivateKeyFile     string            `yaml:"PrivateKeyFile"`
+	Keys               map[string]string `yaml:"Keys,omitempty"` // alias -> key file under the same master key
 	WalletAddress      string            `yaml:"WalletAddress"`
 	DHTFileName        string            `yaml:"DHTFileName"`
 	ListenAddr         string            `yaml:"ListenAddr"`
@@ -126,8 +240,30 @@ type Config struct {
 	ValidDNSKeys       map[string]string `yaml:"ValidDNSKeys"` // map[DNSKEY]domain
 	// Check By BP DHT.Ping
 	MinNodeIDDifficulty int `yaml:"MinNodeIDDifficulty"`
+	// SpendingPolicies are the spending limits of the transaction signing keys.
+	SpendingPolicies []SpendingPolicy `yaml:"SpendingPolicies,omitempty"`
+	// SpendingLedgerFile persists the spending counted in the daily limits of SpendingPolicies,
+	// the spending is counted in memory only if it's empty.
+	SpendingLedgerFile string `yaml:"SpendingLedgerFile,omitempty"`
+	// ProvisionIssuers are the operator accounts allowed to mint node provisioning tokens.
+	ProvisionIssuers []proto.AccountAddress `yaml:"ProvisionIssuers,omitempty"`
+	// DevMode accepts the trivially mined node IDs of difficulty 0 for local clusters and CI, it
+	// is refused on every role if the BP genesis marks a production chain or is not configured.
+	DevMode bool `yaml:"DevMode,omitempty"`
+	// StaticTopology takes all the nodes, roles and addresses from KnownNodes, the DNS seed,
+	// discovery and node ID PoW are disabled, see ValidateStaticTopology.
+	StaticTopology bool `yaml:"StaticTopology,omitempty"`
+	// AddressBookFile persists the known peers with their last-seen info, it is disabled if empty.
+	AddressBookFile string `yaml:"AddressBookFile,omitempty"`
+	// NodeTableFile persists the nodes learned by the routing layer including the BPs, the DNS
+	// seed is not looked up if the BPs are loaded from it. It is disabled if empty.
+	NodeTableFile string `yaml:"NodeTableFile,omitempty"`
 
 	DNSSeed DNSSeed `yaml:"DNSSeed"`
+	// Kubernetes enables the peer addresses discovery in Kubernetes cluster.
+	Kubernetes *KubernetesDiscovery `yaml:"Kubernetes,omitempty"`
+	// MDNS enables the peer discovery on the local network.
+	MDNS *MDNSDiscovery `yaml:"MDNS,omitempty"`
 
 	BP    *BPInfo    `yaml:"BlockProducer"`
 	Miner *MinerInfo `yaml:"Miner,omitempty"`
@@ -144,6 +280,41 @@ type Config struct {
 	SQLChainTick       time.Duration `yaml:"SQLChainTick"`
 	SQLChainTTL        int32         `yaml:"SQLChainTTL"`
 	MinProviderDeposit uint64        `yaml:"MinProviderDeposit"`
+
+	// MaxClockSkew is the max tolerable local clock skew against peers.
+	MaxClockSkew time.Duration `yaml:"MaxClockSkew,omitempty"`
+	// RefuseLeadOnClockSkew makes the node refuse to produce blocks or accept writes as leader
+	// when the local clock skew exceeds MaxClockSkew.
+	RefuseLeadOnClockSkew bool `yaml:"RefuseLeadOnClockSkew,omitempty"`
+
+	// CostAnomaly enables the cost anomaly detection on the billing stream of block producer.
+	CostAnomaly *CostAnomalyConfig `yaml:"CostAnomaly,omitempty"`
+}
+
+// CostAnomalyConfig defines the cost anomaly detection on the billing stream.
+type CostAnomalyConfig struct {
+	// Webhooks are the URLs to post the JSON encoded anomaly alerts to.
+	Webhooks []string `yaml:"Webhooks,omitempty"`
+	// Threshold is the ratio of hourly cost to the rolling baseline which fires an alert.
+	Threshold float64 `yaml:"Threshold,omitempty"`
+	// MinCost is the hourly cost below which no alert is fired.
+	MinCost uint64 `yaml:"MinCost,omitempty"`
+	// Baseline is the window of the rolling baseline.
+	Baseline time.Duration `yaml:"Baseline,omitempty"`
+}
+
+// IsDevMode returns whether the DevMode is enabled on a non-production chain, the chain of a
+// config without the BP genesis is unknown and treated as a production chain.
+func (c *Config) IsDevMode() bool {
+	return c.DevMode && c.BP != nil && !c.BP.BPGenesis.Production()
+}
+
+// NodeIDDifficulty returns the min difficulty of the node IDs, which is 0 in the DevMode.
+func (c *Config) NodeIDDifficulty() int {
+	if c.IsDevMode() {
+		return 0
+	}
+	return c.MinNodeIDDifficulty
 }
 
 // GConf is the global config pointer.
@@ -191,10 +362,32 @@ func LoadConfig(configPath string) (config *Config, err error) {
 		config.PrivateKeyFile = path.Join(configDir, config.PrivateKeyFile)
 	}
 
+	for alias, keyFile := range config.Keys {
+		if !path.IsAbs(keyFile) {
+			config.Keys[alias] = path.Join(configDir, keyFile)
+		}
+	}
+
 	if !path.IsAbs(config.DHTFileName) {
 		config.DHTFileName = path.Join(configDir, config.DHTFileName)
 	}
 
+	if config.DNSSeed.CacheFile != "" && !path.IsAbs(config.DNSSeed.CacheFile) {
+		config.DNSSeed.CacheFile = path.Join(configDir, config.DNSSeed.CacheFile)
+	}
+
+	if config.AddressBookFile != "" && !path.IsAbs(config.AddressBookFile) {
+		config.AddressBookFile = path.Join(configDir, config.AddressBookFile)
+	}
+
+	if config.NodeTableFile != "" && !path.IsAbs(config.NodeTableFile) {
+		config.NodeTableFile = path.Join(configDir, config.NodeTableFile)
+	}
+
+	if config.SpendingLedgerFile != "" && !path.IsAbs(config.SpendingLedgerFile) {
+		config.SpendingLedgerFile = path.Join(configDir, config.SpendingLedgerFile)
+	}
+
 	if !path.IsAbs(config.WorkingRoot) {
 		config.WorkingRoot = path.Join(configDir, config.WorkingRoot)
 	}
@@ -207,6 +400,19 @@ func LoadConfig(configPath string) (config *Config, err error) {
 		config.Miner.RootDir = path.Join(configDir, config.Miner.RootDir)
 	}
 
+	if config.DevMode && !config.IsDevMode() {
+		err = ErrDevModeOnProduction
+		log.WithError(err).Error("validate config failed")
+		return
+	}
+
+	if config.StaticTopology {
+		if err = config.ValidateStaticTopology(); err != nil {
+			log.WithError(err).Error("validate static topology failed")
+			return
+		}
+	}
+
 	if len(config.KnownNodes) > 0 {
 		for _, node := range config.KnownNodes {
 			if node.ID == config.ThisNodeID {
@@ -160,3 +160,42 @@ func TestConf(t *testing.T) {
 		So(err, ShouldNotBeNil)
 	})
 }
+
+func TestDevMode(t *testing.T) {
+	Convey("Dev mode should accept node IDs of difficulty 0", t, func() {
+		defer os.Remove(testFile)
+		config := &Config{
+			MinNodeIDDifficulty: 24,
+			DevMode:             true,
+			BP:                  &BPInfo{},
+		}
+		So(config.NodeIDDifficulty(), ShouldEqual, 0)
+		sConfig, err := yaml.Marshal(config)
+		So(err, ShouldBeNil)
+		So(ioutil.WriteFile(testFile, sConfig, 0600), ShouldBeNil)
+		_, err = LoadConfig(testFile)
+		So(err, ShouldBeNil)
+
+		config.DevMode = false
+		So(config.NodeIDDifficulty(), ShouldEqual, 24)
+
+		// refused on production chain
+		config.DevMode = true
+		config.BP.BPGenesis.Version = 1 | GenesisVersionProduction
+		So(config.NodeIDDifficulty(), ShouldEqual, 24)
+		sConfig, err = yaml.Marshal(config)
+		So(err, ShouldBeNil)
+		So(ioutil.WriteFile(testFile, sConfig, 0600), ShouldBeNil)
+		_, err = LoadConfig(testFile)
+		So(err, ShouldEqual, ErrDevModeOnProduction)
+
+		// refused without the BP genesis, e.g. on clients and miners
+		config.BP = nil
+		So(config.NodeIDDifficulty(), ShouldEqual, 24)
+		sConfig, err = yaml.Marshal(config)
+		So(err, ShouldBeNil)
+		So(ioutil.WriteFile(testFile, sConfig, 0600), ShouldBeNil)
+		_, err = LoadConfig(testFile)
+		So(err, ShouldEqual, ErrDevModeOnProduction)
+	})
+}
@@ -0,0 +1,29 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conf
+
+import "errors"
+
+var (
+	// ErrSecretNotFound indicates the referenced secret is not found.
+	ErrSecretNotFound = errors.New("secret not found")
+	// ErrInvalidStaticTopology indicates the static topology config is invalid.
+	ErrInvalidStaticTopology = errors.New("invalid static topology")
+	// ErrDevModeOnProduction indicates the dev mode is enabled on a production chain, or on a
+	// node without the BP genesis config.
+	ErrDevModeOnProduction = errors.New("dev mode is not allowed on production chain")
+)
@@ -0,0 +1,188 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conf
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultVaultField defines the default field of vault secret references.
+const DefaultVaultField = "value"
+
+var (
+	secretProvidersLock sync.RWMutex
+	secretProviders     = map[string]SecretProvider{
+		"env":   SecretProviderFunc(resolveEnvSecret),
+		"file":  SecretProviderFunc(resolveFileSecret),
+		"vault": SecretProviderFunc(resolveVaultSecret),
+	}
+)
+
+// SecretProvider is the interface implemented by an object that resolves secret references of
+// an URL scheme.
+type SecretProvider interface {
+	Resolve(ref *url.URL) (secret string, err error)
+}
+
+// SecretProviderFunc is an adapter to use an ordinary function as a SecretProvider.
+type SecretProviderFunc func(ref *url.URL) (secret string, err error)
+
+// Resolve implements SecretProvider.Resolve.
+func (f SecretProviderFunc) Resolve(ref *url.URL) (secret string, err error) {
+	return f(ref)
+}
+
+// RegisterSecretProvider registers the secret provider of the scheme, the builtin schemes are:
+//
+//	env://NAME                      the environment variable NAME
+//	file:///path/to/secret          the content of the file, trailing new lines trimmed
+//	vault://secret/data/app#field   the field of the secret in Vault KV engine, addressed by the
+//	                                VAULT_ADDR and VAULT_TOKEN environment variables
+func RegisterSecretProvider(scheme string, provider SecretProvider) {
+	secretProvidersLock.Lock()
+	defer secretProvidersLock.Unlock()
+	secretProviders[strings.ToLower(scheme)] = provider
+}
+
+// ResolveSecret resolves the value if it is a reference of a registered secret provider,
+// otherwise the value is returned as plaintext.
+func ResolveSecret(value string) (secret string, err error) {
+	var i = strings.Index(value, "://")
+	if i <= 0 {
+		return value, nil
+	}
+	secretProvidersLock.RLock()
+	provider, ok := secretProviders[strings.ToLower(value[:i])]
+	secretProvidersLock.RUnlock()
+	if !ok {
+		return value, nil
+	}
+	var ref *url.URL
+	if ref, err = url.Parse(value); err != nil {
+		err = errors.Wrap(err, "parse secret reference failed")
+		return
+	}
+	if secret, err = provider.Resolve(ref); err != nil {
+		// never log the secret itself, the scheme is enough for diagnosing
+		err = errors.Wrapf(err, "resolve %s secret failed", ref.Scheme)
+	}
+	return
+}
+
+// Secret defines a config value which could be a secret reference instead of plaintext, the
+// reference is resolved when the config is loaded and kept for marshaling, so the resolved
+// secret is never written back to the config file.
+type Secret struct {
+	ref   string
+	value string
+}
+
+// NewSecret returns a plaintext secret.
+func NewSecret(value string) Secret {
+	return Secret{ref: value, value: value}
+}
+
+// Value returns the resolved secret.
+func (s Secret) Value() string {
+	return s.value
+}
+
+// Ref returns the secret as configured, which is the reference for a resolved secret.
+func (s Secret) Ref() string {
+	return s.ref
+}
+
+// IsZero implements yaml.IsZeroer for the omitempty fields.
+func (s Secret) IsZero() bool {
+	return s.ref == "" && s.value == ""
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (s *Secret) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	var value, secret string
+	if err = unmarshal(&value); err != nil {
+		return
+	}
+	if secret, err = ResolveSecret(value); err != nil {
+		return
+	}
+	*s = Secret{ref: value, value: secret}
+	return
+}
+
+// MarshalYAML implements yaml.Marshaler, the original reference is marshaled instead of the
+// resolved secret.
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.ref, nil
+}
+
+// String implements fmt.Stringer, the secret is masked.
+func (s Secret) String() string {
+	if s.value == "" {
+		return ""
+	}
+	return "******"
+}
+
+func resolveEnvSecret(ref *url.URL) (secret string, err error) {
+	var ok bool
+	if secret, ok = os.LookupEnv(ref.Host + ref.Path); !ok {
+		err = errors.Wrapf(ErrSecretNotFound, "env %s not set", ref.Host+ref.Path)
+	}
+	return
+}
+
+func resolveFileSecret(ref *url.URL) (secret string, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(ref.Host + ref.Path); err != nil {
+		return
+	}
+	secret = strings.TrimRight(string(data), "\r\n")
+	return
+}
+
+func resolveVaultSecret(ref *url.URL) (secret string, err error) {
+	var (
+		client = NewVaultClient("", "")
+		field  = ref.Fragment
+		data   map[string]interface{}
+	)
+	if client.Addr() == "" {
+		err = errors.Wrap(ErrSecretNotFound, "VAULT_ADDR not set")
+		return
+	}
+	if field == "" {
+		field = DefaultVaultField
+	}
+	if data, err = client.ReadKV(ref.Host + ref.Path); err != nil {
+		err = errors.Wrapf(ErrSecretNotFound, "read vault path %s failed: %v", ref.Host+ref.Path, err)
+		return
+	}
+	value, ok := data[field].(string)
+	if !ok {
+		err = errors.Wrapf(ErrSecretNotFound, "field %s not found", field)
+		return
+	}
+	secret = value
+	return
+}
@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conf
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestResolveSecret(t *testing.T) {
+	Convey("Given secret references", t, func() {
+		Convey("Plaintext values should be returned as is", func() {
+			secret, err := ResolveSecret("plain-password")
+			So(err, ShouldBeNil)
+			So(secret, ShouldEqual, "plain-password")
+			secret, err = ResolveSecret("unknown://abc")
+			So(err, ShouldBeNil)
+			So(secret, ShouldEqual, "unknown://abc")
+		})
+		Convey("Env references should be resolved", func() {
+			So(os.Setenv("CQL_TEST_SECRET", "from-env"), ShouldBeNil)
+			defer os.Unsetenv("CQL_TEST_SECRET")
+			secret, err := ResolveSecret("env://CQL_TEST_SECRET")
+			So(err, ShouldBeNil)
+			So(secret, ShouldEqual, "from-env")
+			_, err = ResolveSecret("env://CQL_TEST_SECRET_NOT_SET")
+			So(errors.Cause(err), ShouldEqual, ErrSecretNotFound)
+		})
+		Convey("File references should be resolved", func() {
+			dir, err := ioutil.TempDir("", "secret")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			var file = filepath.Join(dir, "secret")
+			So(ioutil.WriteFile(file, []byte("from-file\n"), 0600), ShouldBeNil)
+			secret, err := ResolveSecret("file://" + file)
+			So(err, ShouldBeNil)
+			So(secret, ShouldEqual, "from-file")
+		})
+		Convey("Vault references should be resolved", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-Vault-Token") != "token" || r.URL.Path != "/v1/secret/data/cql" {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				_, _ = w.Write([]byte(`{"data":{"data":{"value":"v","master":"from-vault"}}}`))
+			}))
+			defer server.Close()
+			So(os.Setenv("VAULT_ADDR", server.URL), ShouldBeNil)
+			So(os.Setenv("VAULT_TOKEN", "token"), ShouldBeNil)
+			defer os.Unsetenv("VAULT_ADDR")
+			defer os.Unsetenv("VAULT_TOKEN")
+			secret, err := ResolveSecret("vault://secret/data/cql#master")
+			So(err, ShouldBeNil)
+			So(secret, ShouldEqual, "from-vault")
+			secret, err = ResolveSecret("vault://secret/data/cql")
+			So(err, ShouldBeNil)
+			So(secret, ShouldEqual, "v")
+			_, err = ResolveSecret("vault://secret/data/other")
+			So(errors.Cause(err), ShouldEqual, ErrSecretNotFound)
+		})
+		Convey("Custom providers should be pluggable", func() {
+			RegisterSecretProvider("test", SecretProviderFunc(func(ref *url.URL) (string, error) {
+				return "custom-" + ref.Host, nil
+			}))
+			var c struct {
+				Key Secret `yaml:"Key"`
+			}
+			So(yaml.Unmarshal([]byte("Key: test://abc\n"), &c), ShouldBeNil)
+			So(c.Key.Value(), ShouldEqual, "custom-abc")
+			So(c.Key.String(), ShouldNotContainSubstring, "custom")
+		})
+		Convey("Secret references should be marshaled instead of the secrets", func() {
+			So(os.Setenv("CQL_TEST_SECRET", "s3cret"), ShouldBeNil)
+			defer os.Unsetenv("CQL_TEST_SECRET")
+			var c struct {
+				Key   Secret `yaml:"Key"`
+				Plain Secret `yaml:"Plain"`
+				Empty Secret `yaml:"Empty,omitempty"`
+			}
+			So(yaml.Unmarshal([]byte("Key: env://CQL_TEST_SECRET\nPlain: abc\n"), &c), ShouldBeNil)
+			So(c.Key.Value(), ShouldEqual, "s3cret")
+			So(c.Key.Ref(), ShouldEqual, "env://CQL_TEST_SECRET")
+			So(c.Plain.Value(), ShouldEqual, "abc")
+			out, err := yaml.Marshal(&c)
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, "Key: env://CQL_TEST_SECRET\nPlain: abc\n")
+			So(NewSecret("abc").Value(), ShouldEqual, "abc")
+		})
+	})
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conf
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/pow/cpuminer"
+	"github.com/SQLess/SQLess/proto"
+)
+
+// ValidateStaticTopology validates the static topology of the private network, in which all the
+// nodes, roles and addresses come from KnownNodes and no DNS seed, discovery or node ID PoW is
+// needed. The node IDs are still required to match the public keys and nonces, so that every
+// peer is authenticated by its key.
+func (c *Config) ValidateStaticTopology() (err error) {
+	if len(c.DNSSeed.SeedDomains()) > 0 || len(c.DNSSeed.JSONSeeds) > 0 {
+		return errors.Wrap(ErrInvalidStaticTopology, "DNS seed is not allowed")
+	}
+	if c.Kubernetes != nil {
+		return errors.Wrap(ErrInvalidStaticTopology, "kubernetes discovery is not allowed")
+	}
+	if c.MDNS != nil {
+		return errors.Wrap(ErrInvalidStaticTopology, "mDNS discovery is not allowed")
+	}
+	if len(c.KnownNodes) == 0 {
+		return errors.Wrap(ErrInvalidStaticTopology, "no known node")
+	}
+	var (
+		ids     = make(map[proto.NodeID]*proto.Node, len(c.KnownNodes))
+		addrs   = make(map[string]proto.NodeID, len(c.KnownNodes))
+		leaders int
+	)
+	for i := range c.KnownNodes {
+		var n = &c.KnownNodes[i]
+		if err = validateStaticNode(n); err != nil {
+			return
+		}
+		if _, ok := ids[n.ID]; ok {
+			return errors.Wrapf(ErrInvalidStaticTopology, "duplicate node %s", n.ID)
+		}
+		ids[n.ID] = n
+		if n.Addr != "" {
+			if other, ok := addrs[n.Addr]; ok {
+				return errors.Wrapf(ErrInvalidStaticTopology,
+					"node %s and %s share the address %s", other, n.ID, n.Addr)
+			}
+			addrs[n.Addr] = n.ID
+		}
+		if n.Role == proto.Leader {
+			leaders++
+		}
+	}
+	if leaders != 1 {
+		return errors.Wrapf(ErrInvalidStaticTopology, "expect exactly 1 leader, got %d", leaders)
+	}
+	if _, ok := ids[c.ThisNodeID]; !ok {
+		return errors.Wrapf(ErrInvalidStaticTopology, "this node %s is not a known node", c.ThisNodeID)
+	}
+	if c.BP != nil {
+		if n, ok := ids[c.BP.NodeID]; !ok || n.Role != proto.Leader {
+			return errors.Wrapf(ErrInvalidStaticTopology,
+				"block producer %s is not the known leader", c.BP.NodeID)
+		}
+	}
+	return
+}
+
+func validateStaticNode(n *proto.Node) (err error) {
+	var id *hash.Hash
+	if id, err = hash.NewHashFromStr(string(n.ID)); err != nil {
+		return errors.Wrapf(ErrInvalidStaticTopology, "invalid node id %s", n.ID)
+	}
+	if n.PublicKey == nil {
+		return errors.Wrapf(ErrInvalidStaticTopology, "node %s has no public key", n.ID)
+	}
+	if keyHash := cpuminer.HashBlock(n.PublicKey.Serialize(), n.Nonce); !keyHash.IsEqual(id) {
+		return errors.Wrapf(ErrInvalidStaticTopology, "node %s nonce public key not match", n.ID)
+	}
+	switch n.Role {
+	case proto.Leader, proto.Follower, proto.Miner:
+		if n.Addr == "" {
+			return errors.Wrapf(ErrInvalidStaticTopology, "%s node %s has no address", n.Role, n.ID)
+		}
+	case proto.Client:
+	default:
+		return errors.Wrapf(ErrInvalidStaticTopology, "node %s has unknown role", n.ID)
+	}
+	return nil
+}
+
+// StaticNode returns the known node of the static topology.
+func (c *Config) StaticNode(id proto.NodeID) (node *proto.Node, ok bool) {
+	for i := range c.KnownNodes {
+		if c.KnownNodes[i].ID == id {
+			return &c.KnownNodes[i], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conf
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/pow/cpuminer"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func testStaticNode(id, pub string, nonce cpuminer.Uint256, addr string, role proto.ServerRole) proto.Node {
+	var (
+		key      = new(asymmetric.PublicKey)
+		buf, err = hex.DecodeString(pub)
+	)
+	if err == nil {
+		err = key.UnmarshalBinary(buf)
+	}
+	if err != nil {
+		panic(err)
+	}
+	return proto.Node{
+		ID:        proto.NodeID(id),
+		Addr:      addr,
+		PublicKey: key,
+		Nonce:     nonce,
+		Role:      role,
+	}
+}
+
+func TestValidateStaticTopology(t *testing.T) {
+	Convey("Given a static topology", t, func() {
+		const bpPub = "02c76216704d797c64c58bc11519fb68582e8e63de7e5b3b2dbbbe8733efe5fd24"
+		var (
+			leader = testStaticNode("00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9",
+				bpPub, cpuminer.Uint256{A: 313283}, "10.0.0.1:4661", proto.Leader)
+			follower = testStaticNode("00000381d46fd6cf7742d7fb94e2422033af989c0e348b5781b3219599a3af35",
+				bpPub, cpuminer.Uint256{A: 478373, D: 2305843009893772025}, "10.0.0.2:4661", proto.Follower)
+			miner = testStaticNode("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade",
+				"0367aa51809a7c1dc0f82c02452fec9557b3e1d10ce7c919d8e73d90048df86d20",
+				cpuminer.Uint256{A: 567323, D: 3104982049}, "10.0.0.3:4661", proto.Miner)
+			client = testStaticNode("00000f3b43288fe99831eb533ab77ec455d13e11fc38ec35a42d4edd17aa320d",
+				"02ec784ca599f21ef93fe7abdc68d78817ab6c9b31f2324d15ea174d9da498b4c4",
+				cpuminer.Uint256{A: 22403}, "", proto.Client)
+			config = &Config{
+				StaticTopology: true,
+				ThisNodeID:     miner.ID,
+				KnownNodes:     []proto.Node{leader, follower, miner, client},
+			}
+		)
+		So(config.ValidateStaticTopology(), ShouldBeNil)
+		node, ok := config.StaticNode(follower.ID)
+		So(ok, ShouldBeTrue)
+		So(node.Addr, ShouldEqual, follower.Addr)
+
+		Convey("The discovery should not be configured", func() {
+			config.DNSSeed.Domain = "bp.example.org"
+			So(errors.Cause(config.ValidateStaticTopology()), ShouldEqual, ErrInvalidStaticTopology)
+		})
+		Convey("This node should be a known node", func() {
+			config.ThisNodeID = "000003f49592f83d0473bddb70d543f1096b4ffed5e5f942a3117e256b7052b8"
+			So(errors.Cause(config.ValidateStaticTopology()), ShouldEqual, ErrInvalidStaticTopology)
+		})
+		Convey("The node id should match the public key and nonce", func() {
+			config.KnownNodes[2].Nonce.A++
+			So(errors.Cause(config.ValidateStaticTopology()), ShouldEqual, ErrInvalidStaticTopology)
+		})
+		Convey("The server nodes should have distinct addresses", func() {
+			config.KnownNodes[1].Addr = leader.Addr
+			So(errors.Cause(config.ValidateStaticTopology()), ShouldEqual, ErrInvalidStaticTopology)
+			config.KnownNodes[1].Addr = ""
+			So(errors.Cause(config.ValidateStaticTopology()), ShouldEqual, ErrInvalidStaticTopology)
+		})
+		Convey("There should be exactly one leader", func() {
+			config.KnownNodes[1].Role = proto.Leader
+			So(errors.Cause(config.ValidateStaticTopology()), ShouldEqual, ErrInvalidStaticTopology)
+		})
+	})
+}
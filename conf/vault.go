@@ -0,0 +1,133 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const vaultRequestTimeout = 10 * time.Second
+
+// VaultClient is a minimal HashiCorp Vault HTTP API client shared by the vault secret
+// references and the vault keystore.
+type VaultClient struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// NewVaultClient returns a Vault client, VAULT_ADDR and VAULT_TOKEN are used for the empty
+// address and token.
+func NewVaultClient(addr, token string) (c *VaultClient) {
+	c = &VaultClient{
+		addr:   strings.TrimRight(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: vaultRequestTimeout},
+	}
+	if c.addr == "" {
+		c.addr = strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	}
+	if c.token == "" {
+		c.token = os.Getenv("VAULT_TOKEN")
+	}
+	return
+}
+
+// Addr returns the Vault address.
+func (c *VaultClient) Addr() string {
+	return c.addr
+}
+
+// Request sends the request with the JSON encoded in to the API path and decodes the response
+// to out, os.ErrNotExist is returned if the path is not found.
+func (c *VaultClient) Request(method, path string, in, out interface{}) (err error) {
+	var (
+		body io.Reader
+		req  *http.Request
+		resp *http.Response
+	)
+	if c.addr == "" {
+		return errors.New("vault address not set")
+	}
+	if in != nil {
+		var data []byte
+		if data, err = json.Marshal(in); err != nil {
+			return
+		}
+		body = bytes.NewReader(data)
+	}
+	path = strings.Trim(path, "/")
+	if req, err = http.NewRequest(method, fmt.Sprintf("%s/v1/%s", c.addr, path), body); err != nil {
+		return
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if resp, err = c.client.Do(req); err != nil {
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return os.ErrNotExist
+	case resp.StatusCode >= http.StatusBadRequest:
+		return errors.Errorf("vault %s %s responded %s", method, path, resp.Status)
+	case out != nil && resp.StatusCode != http.StatusNoContent:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return
+}
+
+// isKVv2 returns whether the path is in a KV version 2 engine, which nests the secret in
+// another data field.
+func isKVv2(path string) bool {
+	return strings.Contains("/"+strings.Trim(path, "/")+"/", "/data/")
+}
+
+// ReadKV reads the secret at the path of a KV engine.
+func (c *VaultClient) ReadKV(path string) (data map[string]interface{}, err error) {
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err = c.Request(http.MethodGet, path, nil, &body); err != nil {
+		return
+	}
+	data = body.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok && isKVv2(path) {
+		data = nested
+	}
+	return
+}
+
+// WriteKV writes the secret to the path of a KV engine.
+func (c *VaultClient) WriteKV(path string, data map[string]string) (err error) {
+	var body interface{} = data
+	if isKVv2(path) {
+		body = map[string]interface{}{"data": data}
+	}
+	return c.Request(http.MethodPost, path, body, nil)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package conf
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVaultClient(t *testing.T) {
+	Convey("Given a Vault server with KV version 1 and 2 engines", t, func() {
+		var (
+			lock    sync.Mutex
+			secrets = make(map[string]json.RawMessage)
+		)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			if r.Header.Get("X-Vault-Token") != "token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if r.Method == http.MethodPost {
+				var body json.RawMessage
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				secrets[r.URL.Path] = body
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			body, ok := secrets[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": body})
+		}))
+		defer server.Close()
+		client := NewVaultClient(server.URL+"/", "token")
+
+		Convey("The secrets should be read as written", func() {
+			for _, path := range []string{"kv/app", "secret/data/app"} {
+				So(client.WriteKV(path, map[string]string{"key": path}), ShouldBeNil)
+				data, err := client.ReadKV(path)
+				So(err, ShouldBeNil)
+				So(data["key"], ShouldEqual, path)
+			}
+			So(string(secrets["/v1/secret/data/app"]), ShouldContainSubstring, `"data":`)
+			So(string(secrets["/v1/kv/app"]), ShouldNotContainSubstring, `"data":`)
+		})
+		Convey("Missing secrets should be reported as not exist", func() {
+			_, err := client.ReadKV("kv/missing")
+			So(err, ShouldEqual, os.ErrNotExist)
+		})
+		Convey("Errors should be reported", func() {
+			_, err := NewVaultClient(server.URL, "wrong").ReadKV("kv/app")
+			So(err, ShouldNotBeNil)
+			So(err, ShouldNotEqual, os.ErrNotExist)
+		})
+	})
+}
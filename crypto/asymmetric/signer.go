@@ -0,0 +1,28 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package asymmetric
+
+// Signer is the interface implemented by a signing backend which holds the private key, e.g. a
+// local PrivateKey or a hardware wallet.
+type Signer interface {
+	// PubKey returns the public key of the signer.
+	PubKey() *PublicKey
+	// Sign signs the hash.
+	Sign(hash []byte) (*Signature, error)
+}
+
+var _ Signer = (*PrivateKey)(nil)
@@ -218,6 +218,13 @@ func TestTHashH(t *testing.T) {
 		h := THashH(b)
 		So(h.CloneBytes(), ShouldResemble, THashB(b))
 	})
+	Convey("THashReader", t, func() {
+		b := bytes.Repeat([]byte{0x43, 0x9c, 0x2f, 0x4b}, 1<<16)
+		h, n, err := THashReader(bytes.NewReader(b))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, len(b))
+		So(h, ShouldResemble, THashH(b))
+	})
 }
 
 func BenchmarkTHashB(b *testing.B) {
@@ -0,0 +1,28 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package hwwallet implements an asymmetric.Signer backed by a hardware wallet, e.g. Ledger or
+// Trezor, so the private key of the account is never loaded into the current process.
+//
+// The USB/HID transport of the device is delegated to a bridge program, which is invoked with
+// the device flags followed by one of the commands:
+//
+//	<bridge> [args...] pubkey [path]          prints the hex encoded compressed public key
+//	<bridge> [args...] sign [path] <hash>     prints the hex encoded DER signature of the hash
+//
+// The hash is a hex encoded 32-byte transaction hash, which should be confirmed on the device
+// before signing. Signatures returned by the bridge are always verified against the public key.
+package hwwallet
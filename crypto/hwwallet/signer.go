@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hwwallet
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+)
+
+const (
+	// DefaultConfirmTimeout defines the default timeout for the user to confirm signing on the
+	// device.
+	DefaultConfirmTimeout = 2 * time.Minute
+)
+
+// Config defines the hardware wallet signer config.
+type Config struct {
+	// Bridge is the bridge command line, e.g. "cql-ledger-bridge --device ledger".
+	Bridge string
+	// Path is the key derivation path on the device, empty for the bridge default.
+	Path string
+	// ConfirmTimeout is the timeout for the user to confirm signing on the device.
+	ConfirmTimeout time.Duration
+}
+
+// Signer defines a hardware wallet signer.
+type Signer struct {
+	cmd     string
+	args    []string
+	path    string
+	timeout time.Duration
+	pubKey  *asymmetric.PublicKey
+}
+
+// NewSigner connects to the hardware wallet through the bridge and loads its public key.
+func NewSigner(cfg *Config) (s *Signer, err error) {
+	var fields = strings.Fields(cfg.Bridge)
+	if len(fields) == 0 {
+		err = ErrInvalidBridge
+		return
+	}
+	var instance = &Signer{
+		cmd:     fields[0],
+		args:    fields[1:],
+		path:    cfg.Path,
+		timeout: cfg.ConfirmTimeout,
+	}
+	if instance.timeout <= 0 {
+		instance.timeout = DefaultConfirmTimeout
+	}
+	var out []byte
+	if out, err = instance.call("pubkey"); err != nil {
+		return
+	}
+	if instance.pubKey, err = asymmetric.ParsePubKey(out); err != nil {
+		err = errors.Wrap(err, "parse hardware wallet public key failed")
+		return
+	}
+	s = instance
+	return
+}
+
+// PubKey implements asymmetric.Signer.PubKey.
+func (s *Signer) PubKey() *asymmetric.PublicKey {
+	return s.pubKey
+}
+
+// Sign implements asymmetric.Signer.Sign, it blocks until the signing is confirmed on the device.
+func (s *Signer) Sign(hash []byte) (sig *asymmetric.Signature, err error) {
+	var out []byte
+	if out, err = s.call("sign", hex.EncodeToString(hash)); err != nil {
+		return
+	}
+	if sig, err = asymmetric.ParseSignature(out); err != nil {
+		err = errors.Wrap(err, "parse hardware wallet signature failed")
+		return
+	}
+	if !sig.Verify(hash, s.pubKey) {
+		sig = nil
+		err = ErrSignatureNotMatch
+	}
+	return
+}
+
+// call runs the bridge command and returns the hex decoded output.
+func (s *Signer) call(command string, params ...string) (out []byte, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var (
+		args           = append(append([]string{}, s.args...), command)
+		stdout, stderr bytes.Buffer
+	)
+	if s.path != "" {
+		args = append(args, s.path)
+	}
+	args = append(args, params...)
+	cmd := exec.CommandContext(ctx, s.cmd, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err = cmd.Run(); err != nil {
+		err = errors.Wrapf(err, "hardware wallet %s failed: %s",
+			command, strings.TrimSpace(stderr.String()))
+		return
+	}
+	if out, err = hex.DecodeString(strings.TrimSpace(stdout.String())); err != nil {
+		err = errors.Wrapf(err, "decode hardware wallet %s output failed", command)
+	}
+	return
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package hwwallet
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+)
+
+const testBridgeEnv = "HWWALLET_TEST_BRIDGE_KEY"
+
+// TestBridgeHelper acts as the bridge program when invoked by the signer in tests.
+func TestBridgeHelper(t *testing.T) {
+	keyHex := os.Getenv(testBridgeEnv)
+	if keyHex == "" {
+		return
+	}
+	defer os.Exit(0)
+	var args []string
+	for i, v := range os.Args {
+		if v == "--" {
+			args = os.Args[i+1:]
+			break
+		}
+	}
+	keyBytes, _ := hex.DecodeString(keyHex)
+	priv, pub := asymmetric.PrivKeyFromBytes(keyBytes)
+	switch args[0] {
+	case "pubkey":
+		fmt.Println(hex.EncodeToString(pub.Serialize()))
+	case "sign":
+		h, _ := hex.DecodeString(args[len(args)-1])
+		if args[1] == "m/wrong" {
+			// sign with another key
+			priv, _, _ = asymmetric.GenSecp256k1KeyPair()
+		}
+		sig, _ := priv.Sign(h)
+		fmt.Println(hex.EncodeToString(sig.Serialize()))
+	default:
+		os.Exit(1)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	Convey("Given a hardware wallet bridge", t, func() {
+		priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		So(os.Setenv(testBridgeEnv, hex.EncodeToString(priv.Serialize())), ShouldBeNil)
+		Reset(func() { _ = os.Unsetenv(testBridgeEnv) })
+		var bridge = strings.Join([]string{os.Args[0], "-test.run=TestBridgeHelper", "--"}, " ")
+
+		Convey("The signer should load the public key and sign with the device key", func() {
+			s, err := NewSigner(&Config{Bridge: bridge, Path: "m/44'/60'/0'/0/0"})
+			So(err, ShouldBeNil)
+			So(s.PubKey().IsEqual(pub), ShouldBeTrue)
+			var h = hash.THashH([]byte("transaction"))
+			sig, err := s.Sign(h[:])
+			So(err, ShouldBeNil)
+			So(sig.Verify(h[:], pub), ShouldBeTrue)
+		})
+		Convey("The signature of another key should be rejected", func() {
+			s, err := NewSigner(&Config{Bridge: bridge, Path: "m/wrong"})
+			So(err, ShouldBeNil)
+			var h = hash.THashH([]byte("transaction"))
+			_, err = s.Sign(h[:])
+			So(err, ShouldEqual, ErrSignatureNotMatch)
+		})
+		Convey("An empty bridge should be rejected", func() {
+			_, err := NewSigner(&Config{})
+			So(err, ShouldEqual, ErrInvalidBridge)
+		})
+	})
+}
@@ -155,6 +155,9 @@ func SavePrivateKey(keyFilePath string, key *asymmetric.PrivateKey, masterKey []
 func InitLocalKeyPair(privateKeyPath string, masterKey []byte) (err error) {
 	var privateKey *asymmetric.PrivateKey
 	var publicKey *asymmetric.PublicKey
+	if conf.GConf != nil && conf.GConf.KeyVault != nil {
+		return InitLocalKeyPairFromVault(conf.GConf.KeyVault, masterKey)
+	}
 	initLocalKeyStore()
 	privateKey, err = LoadPrivateKey(privateKeyPath, masterKey)
 	if err != nil {
@@ -0,0 +1,163 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultVaultKeyField defines the default field of the private key in the KV secret.
+	DefaultVaultKeyField = "private_key"
+	// DefaultVaultTransitMount defines the default mount path of the Transit engine.
+	DefaultVaultTransitMount = "transit"
+)
+
+// vaultKeyStore stores the node private key in the KV engine of HashiCorp Vault, optionally
+// wrapped by a Transit key so the KV secret alone does not reveal the key.
+//
+// Note that the Transit engine does not support secp256k1 keys, the private key is still loaded
+// into the process for signing and ECDH key exchange, Vault only removes the key files.
+type vaultKeyStore struct {
+	client       *conf.VaultClient
+	path         string
+	field        string
+	transitKey   string
+	transitMount string
+}
+
+func newVaultKeyStore(cfg *conf.KeyVault) (s *vaultKeyStore) {
+	s = &vaultKeyStore{
+		client:       conf.NewVaultClient(cfg.Addr, cfg.Token.Value()),
+		path:         strings.Trim(cfg.Path, "/"),
+		field:        cfg.Field,
+		transitKey:   cfg.TransitKey,
+		transitMount: strings.Trim(cfg.TransitMount, "/"),
+	}
+	if s.field == "" {
+		s.field = DefaultVaultKeyField
+	}
+	if s.transitMount == "" {
+		s.transitMount = DefaultVaultTransitMount
+	}
+	return
+}
+
+// load loads and decodes the private key.
+func (s *vaultKeyStore) load(masterKey []byte) (key *asymmetric.PrivateKey, err error) {
+	var data map[string]interface{}
+	if data, err = s.client.ReadKV(s.path); err != nil {
+		return
+	}
+	value, ok := data[s.field].(string)
+	if !ok {
+		err = os.ErrNotExist
+		return
+	}
+	if s.transitKey != "" {
+		if value, err = s.unwrap(value); err != nil {
+			return
+		}
+	}
+	return DecodePrivateKey([]byte(value), masterKey)
+}
+
+// save encodes and stores the private key.
+func (s *vaultKeyStore) save(key *asymmetric.PrivateKey, masterKey []byte) (err error) {
+	var keyBytes []byte
+	if keyBytes, err = EncodePrivateKey(key, masterKey); err != nil {
+		return
+	}
+	var value = string(keyBytes)
+	if s.transitKey != "" {
+		if value, err = s.wrap(value); err != nil {
+			return
+		}
+	}
+	return s.client.WriteKV(s.path, map[string]string{s.field: value})
+}
+
+func (s *vaultKeyStore) wrap(plaintext string) (ciphertext string, err error) {
+	var out struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	if err = s.client.Request(http.MethodPost, s.transitMount+"/encrypt/"+s.transitKey, map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString([]byte(plaintext)),
+	}, &out); err != nil {
+		return
+	}
+	ciphertext = out.Data.Ciphertext
+	return
+}
+
+func (s *vaultKeyStore) unwrap(ciphertext string) (plaintext string, err error) {
+	var (
+		out struct {
+			Data struct {
+				Plaintext string `json:"plaintext"`
+			} `json:"data"`
+		}
+		data []byte
+	)
+	if err = s.client.Request(http.MethodPost, s.transitMount+"/decrypt/"+s.transitKey, map[string]string{
+		"ciphertext": ciphertext,
+	}, &out); err != nil {
+		return
+	}
+	if data, err = base64.StdEncoding.DecodeString(out.Data.Plaintext); err != nil {
+		return
+	}
+	plaintext = string(data)
+	return
+}
+
+// InitLocalKeyPairFromVault initializes local private key from the Vault keystore, a new key is
+// generated and stored if not exists and GenerateKeyPair is set.
+func InitLocalKeyPairFromVault(cfg *conf.KeyVault, masterKey []byte) (err error) {
+	var (
+		s          = newVaultKeyStore(cfg)
+		privateKey *asymmetric.PrivateKey
+		le         = log.WithField("path", s.path)
+	)
+	initLocalKeyStore()
+	if privateKey, err = s.load(masterKey); err != nil {
+		if err != os.ErrNotExist || !conf.GConf.GenerateKeyPair {
+			le.WithError(err).Error("load private key from vault failed")
+			return
+		}
+		le.Info("private key not exist in vault, generating one")
+		if privateKey, _, err = asymmetric.GenSecp256k1KeyPair(); err != nil {
+			le.WithError(err).Error("generate private key failed")
+			return
+		}
+		if err = s.save(privateKey, masterKey); err != nil {
+			le.WithError(err).Error("save private key to vault failed")
+			return
+		}
+	}
+	SetLocalKeyPair(privateKey, privateKey.PubKey())
+	return
+}
@@ -0,0 +1,123 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kms
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/conf"
+)
+
+// newFakeVault returns a fake Vault server with a KV version 2 engine at "secret" and a Transit
+// engine at "transit".
+func newFakeVault() *httptest.Server {
+	var (
+		lock    sync.Mutex
+		secrets = make(map[string]json.RawMessage)
+	)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var in map[string]interface{}
+		if r.Method == http.MethodPost {
+			_ = json.NewDecoder(r.Body).Decode(&in)
+		}
+		switch path := strings.TrimPrefix(r.URL.Path, "/v1/"); {
+		case strings.HasPrefix(path, "transit/encrypt/"):
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"ciphertext": "vault:v1:" + in["plaintext"].(string)},
+			})
+		case strings.HasPrefix(path, "transit/decrypt/"):
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"plaintext": strings.TrimPrefix(in["ciphertext"].(string), "vault:v1:"),
+				},
+			})
+		case r.Method == http.MethodPost:
+			secrets[path], _ = json.Marshal(in["data"])
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			data, ok := secrets[path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(`{"data":{"data":` + string(data) + `}}`))
+		}
+	}))
+}
+
+func TestVaultKeyStore(t *testing.T) {
+	Convey("Given a Vault server", t, func() {
+		server := newFakeVault()
+		defer server.Close()
+		var (
+			cfg = &conf.KeyVault{
+				Addr:  server.URL,
+				Token: conf.NewSecret("token"),
+				Path:  "secret/data/miners/node1",
+			}
+			origConf = conf.GConf
+		)
+		conf.GConf = &conf.Config{GenerateKeyPair: true}
+		defer func() { conf.GConf = origConf }()
+
+		Convey("A missing key should be generated and stored", func() {
+			err := InitLocalKeyPairFromVault(cfg, []byte(password))
+			So(err, ShouldBeNil)
+			generated, err := GetLocalPrivateKey()
+			So(err, ShouldBeNil)
+
+			Convey("The stored key should be loaded on next startup", func() {
+				loaded, err := newVaultKeyStore(cfg).load([]byte(password))
+				So(err, ShouldBeNil)
+				So(string(loaded.Serialize()), ShouldEqual, string(generated.Serialize()))
+			})
+		})
+		Convey("The key wrapped by Transit should be loaded", func() {
+			cfg.TransitKey = "miners"
+			err := InitLocalKeyPairFromVault(cfg, nil)
+			So(err, ShouldBeNil)
+			generated, err := GetLocalPrivateKey()
+			So(err, ShouldBeNil)
+			loaded, err := newVaultKeyStore(cfg).load(nil)
+			So(err, ShouldBeNil)
+			So(string(loaded.Serialize()), ShouldEqual, string(generated.Serialize()))
+			_, err = (&vaultKeyStore{
+				client: conf.NewVaultClient(server.URL, "token"), path: cfg.Path,
+				field: DefaultVaultKeyField,
+			}).load(nil)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("A missing key should fail without GenerateKeyPair", func() {
+			conf.GConf.GenerateKeyPair = false
+			err := InitLocalKeyPairFromVault(cfg, nil)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -83,6 +83,26 @@ func (i *DefaultHashSignVerifierImpl) Sign(mh MarshalHasher, signer *ca.PrivateK
 	return
 }
 
+// SignWith sets the hash of mh and signs it with the signer backend, the private key of which
+// may never be loaded into the current process.
+func (i *DefaultHashSignVerifierImpl) SignWith(mh MarshalHasher, signer ca.Signer) (err error) {
+	var sig *ca.Signature
+	if err = i.SetHash(mh); err != nil {
+		return
+	}
+	if sig, err = signer.Sign(i.DataHash[:]); err != nil {
+		return
+	}
+	i.Signature, i.Signee = sig, signer.PubKey()
+	return
+}
+
+// SetSignature sets the signature of the data hash produced elsewhere, e.g. by an offline signer.
+// The signature is not verified until Verify is called.
+func (i *DefaultHashSignVerifierImpl) SetSignature(signee *ca.PublicKey, sig *ca.Signature) {
+	i.Signee, i.Signature = signee, sig
+}
+
 // VerifyHash implements HashSignVerifier.VerifyHash.
 func (i *DefaultHashSignVerifierImpl) VerifyHash(mh MarshalHasher) (err error) {
 	var enc []byte
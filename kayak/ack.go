@@ -0,0 +1,41 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kayak
+
+import (
+	"context"
+)
+
+type ackReplicasKey struct{}
+
+// WithAckReplicas returns a copy of ctx which overrides the replica count, including the leader,
+// required to prepare the log applied with it. The count is capped to the peers size.
+func WithAckReplicas(ctx context.Context, replicas int) context.Context {
+	return context.WithValue(ctx, ackReplicasKey{}, replicas)
+}
+
+// minPreparedFollowersOf returns the min follower nodes for prepare of the apply context.
+func (r *Runtime) minPreparedFollowersOf(ctx context.Context) int {
+	replicas, ok := ctx.Value(ackReplicasKey{}).(int)
+	if !ok || replicas <= 0 {
+		return r.minPreparedFollowers
+	}
+	if replicas > len(r.followers)+1 {
+		replicas = len(r.followers) + 1
+	}
+	return replicas - 1
+}
@@ -259,6 +259,8 @@ func (r *Runtime) getPrepareLog(ctx context.Context, l *kt.Log) (lastCommitIndex
 func (r *Runtime) doCommitCycle(req *commitReq) {
 	r.peersLock.RLock()
 	defer r.peersLock.RUnlock()
+	r.commitLock.Lock()
+	defer r.commitLock.Unlock()
 
 	if r.role == proto.Leader {
 		defer trace.StartRegion(req.ctx, "commitCycle").End()
@@ -75,6 +75,12 @@ func (r *Runtime) readLogs() (err error) {
 			break
 		}
 
+		if l.Index <= r.appliedIndex && l.Type != kt.LogPrepare {
+			// already applied to the storage, the prepare log may not exist
+			r.updateNextIndex(context.Background(), l)
+			continue
+		}
+
 		switch l.Type {
 		case kt.LogPrepare:
 			// record in pending prepares
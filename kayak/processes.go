@@ -60,7 +60,7 @@ func (r *Runtime) doLeaderPrepare(ctx context.Context, tm *timer.Timer, req inte
 	tm.Add("leader_prepare")
 
 	// send prepare to all nodes
-	prepareTracker := r.applyRPC(prepareLog, r.minPreparedFollowers)
+	prepareTracker := r.applyRPC(prepareLog, r.minPreparedFollowersOf(ctx))
 	prepareCtx, prepareCtxCancelFunc := context.WithTimeout(ctx, r.prepareTimeout)
 	defer prepareCtxCancelFunc()
 	prepareErrors, prepareDone, _ := prepareTracker.get(prepareCtx)
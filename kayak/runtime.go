@@ -45,6 +45,10 @@ type Runtime struct {
 	nextIndex     uint64
 	// lastCommit, last commit log index
 	lastCommit uint64
+	// appliedIndex, commits at or before it are already applied to the storage
+	appliedIndex uint64
+	// commitLock, held during commits, commits are paused while it's held by Barrier
+	commitLock sync.Mutex
 	// pendingPrepares, prepares needs to be committed/rollback
 	pendingPrepares     map[uint64]bool
 	pendingPreparesLock sync.RWMutex
@@ -242,6 +246,13 @@ func NewRuntime(cfg *kt.RuntimeConfig) (rt *Runtime, err error) {
 		stopCh: make(chan struct{}),
 	}
 
+	// the storage already contains the commits before the applied index
+	if cfg.AppliedIndex > 0 {
+		rt.appliedIndex = cfg.AppliedIndex
+		rt.lastCommit = cfg.AppliedIndex
+		rt.nextIndex = cfg.AppliedIndex + 1
+	}
+
 	// read from pool to rebuild uncommitted log map
 	if err = rt.readLogs(); err != nil {
 		return
@@ -278,6 +289,14 @@ func (r *Runtime) Shutdown() (err error) {
 	return
 }
 
+// Barrier runs fn with the commits paused, the index of the last commit log applied to the
+// storage is passed to fn, e.g. to take a snapshot of the storage consistent with the logs.
+func (r *Runtime) Barrier(fn func(lastCommit uint64) error) error {
+	r.commitLock.Lock()
+	defer r.commitLock.Unlock()
+	return fn(atomic.LoadUint64(&r.lastCommit))
+}
+
 // Apply defines entry for Leader node.
 func (r *Runtime) Apply(ctx context.Context, req interface{}) (result interface{}, logIndex uint64, err error) {
 	if atomic.LoadUint32(&r.started) != 1 {
@@ -364,6 +383,11 @@ func (r *Runtime) FollowerApply(l *kt.Log) (err error) {
 	return r.followerApply(l, true)
 }
 
+// IsLeader returns whether current node is the leader of the peers.
+func (r *Runtime) IsLeader() bool {
+	return r.role == proto.Leader
+}
+
 // UpdatePeers defines entry for peers update logic.
 func (r *Runtime) UpdatePeers(peers *proto.Peers) (err error) {
 	r.peersLock.Lock()
@@ -450,6 +474,18 @@ func (r *Runtime) followerApply(l *kt.Log, checkPrepare bool) (err error) {
 		return
 	}
 
+	// the commit or rollback is already applied to the storage, only record it
+	if l.Index <= r.appliedIndex && l.Type != kt.LogPrepare {
+		if _, getErr := r.wal.Get(l.Index); getErr != nil {
+			if err = r.writeWAL(ctx, l); err != nil {
+				return
+			}
+		}
+		r.updateNextIndex(ctx, l)
+		r.triggerLogAwaits(l)
+		return
+	}
+
 	// verify log structure
 	switch l.Type {
 	case kt.LogPrepare:
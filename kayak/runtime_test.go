@@ -229,6 +229,57 @@ func (c *fakeCaller) Call(method string, req interface{}, resp interface{}) (err
 	return client.Call(method, req, resp)
 }
 
+func TestRuntimeAppliedIndex(t *testing.T) {
+	Convey("Given a wal of a storage restored from a snapshot", t, func() {
+		node1 := proto.NodeID("000005aa62048f85da4ae9698ed59c14ec0d48a88a07c15a32265634e7e64ade")
+		node2 := proto.NodeID("000005f4f22c06f76c43c4f48d5a7ec1309cc94030cbf9ebae814172884ac8b5")
+		peers := &proto.Peers{
+			PeersHeader: proto.PeersHeader{
+				Leader:  node1,
+				Servers: []proto.NodeID{node1, node2},
+			},
+		}
+		privKey, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		So(peers.Sign(privKey), ShouldBeNil)
+
+		// the commit log fetched after restore, the prepare log of which does not exist
+		var data = make([]byte, 16)
+		binary.BigEndian.PutUint64(data[:8], 4)
+		binary.BigEndian.PutUint64(data[8:], 3)
+		wal := kl.NewMemWal()
+		defer wal.Close()
+		So(wal.Write(&kt.Log{
+			LogHeader: kt.LogHeader{Index: 5, Type: kt.LogCommit, Producer: node1},
+			Data:      data,
+		}), ShouldBeNil)
+
+		Convey("The applied commits should be skipped when reading logs", func() {
+			rt, err := kayak.NewRuntime(&kt.RuntimeConfig{
+				Handler:          &sqliteStorage{},
+				PrepareThreshold: 1.0,
+				CommitThreshold:  1.0,
+				PrepareTimeout:   time.Second,
+				CommitTimeout:    time.Second,
+				LogWaitTimeout:   time.Second,
+				Peers:            peers,
+				Wal:              wal,
+				NodeID:           node2,
+				ServiceName:      "Test",
+				ApplyMethodName:  "Apply",
+				AppliedIndex:     5,
+			})
+			So(err, ShouldBeNil)
+			var lastCommit uint64
+			So(rt.Barrier(func(index uint64) error {
+				lastCommit = index
+				return nil
+			}), ShouldBeNil)
+			So(lastCommit, ShouldEqual, 5)
+		})
+	})
+}
+
 func TestRuntime(t *testing.T) {
 	Convey("runtime test", t, func(c C) {
 		lvl := log.GetLevel()
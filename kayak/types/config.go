@@ -50,4 +50,7 @@ type RuntimeConfig struct {
 	FetchMethodName string
 	// fetch timeout.
 	LogWaitTimeout time.Duration
+	// logs at or before the applied index are already applied to the storage, e.g. the storage
+	// is restored from a snapshot, such commits are recorded without being applied again.
+	AppliedIndex uint64
 }
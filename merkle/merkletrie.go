@@ -76,6 +76,43 @@ func (merkle *Merkle) GetRoot() *hash.Hash {
 	return merkle.tree[len(merkle.tree)-1]
 }
 
+// GetProof returns the sibling hashes from the leaf at index up to the root, ok is false if the
+// index is out of range.
+func (merkle *Merkle) GetProof(index int) (proof []*hash.Hash, ok bool) {
+	var (
+		width = (len(merkle.tree) + 1) / 2
+		base  = 0
+	)
+	if index < 0 || index >= width || merkle.tree[index] == nil {
+		return
+	}
+	for ; width > 1; width /= 2 {
+		sibling := merkle.tree[base+(index^1)]
+		if sibling == nil {
+			// only left node, which is merged with itself
+			sibling = merkle.tree[base+index]
+		}
+		proof = append(proof, sibling)
+		base += width
+		index /= 2
+	}
+	return proof, true
+}
+
+// VerifyProof checks whether the leaf at index is included in the merkle tree with the root.
+func VerifyProof(leaf *hash.Hash, index int, proof []*hash.Hash, root *hash.Hash) bool {
+	var h = leaf
+	for _, p := range proof {
+		if index%2 == 0 {
+			h = MergeTwoHash(h, p)
+		} else {
+			h = MergeTwoHash(p, h)
+		}
+		index /= 2
+	}
+	return index == 0 && h.IsEqual(root)
+}
+
 // MergeTwoHash computes the hash of the concatenate of two hash.
 func MergeTwoHash(l *hash.Hash, r *hash.Hash) *hash.Hash {
 	result := hash.THashH(append(append([]byte{}, (*l)[:]...), (*r)[:]...))
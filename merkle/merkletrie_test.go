@@ -23,6 +23,29 @@ func TestMergeTwoHash(t *testing.T) {
 	})
 }
 
+func TestMerkleProof(t *testing.T) {
+	Convey("Every leaf should be proved against the root", t, func() {
+		for _, n := range []int{1, 2, 3, 5, 8} {
+			items := make([]*hash.Hash, n)
+			for i := range items {
+				items[i] = &hash.Hash{}
+				rand.Read(items[i][:])
+			}
+			merkle := NewMerkle(items)
+			for i := range items {
+				proof, ok := merkle.GetProof(i)
+				So(ok, ShouldBeTrue)
+				So(VerifyProof(items[i], i, proof, merkle.GetRoot()), ShouldBeTrue)
+				other := &hash.Hash{}
+				rand.Read(other[:])
+				So(VerifyProof(other, i, proof, merkle.GetRoot()), ShouldBeFalse)
+			}
+			_, ok := merkle.GetProof(n)
+			So(ok, ShouldBeFalse)
+		}
+	})
+}
+
 func TestNewMerkle(t *testing.T) {
 	tests := [][]*hash.Hash{
 		{},
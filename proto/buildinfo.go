@@ -0,0 +1,46 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proto
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BuildInfo defines the binary provenance of a node.
+type BuildInfo struct {
+	Version      string
+	BuildHash    string // source revision the binary is built from
+	GoVersion    string
+	Role         string // build role tag
+	Capabilities []string
+}
+
+// String implements fmt.Stringer.
+func (i *BuildInfo) String() string {
+	return fmt.Sprintf("%s-%s (%s) [%s]",
+		i.Version, i.BuildHash, i.GoVersion, strings.Join(i.Capabilities, ","))
+}
+
+// NodeBuildInfo defines the build info reported by a node, LastSeen is zero if the build info
+// is only known from the provider profile on chain.
+type NodeBuildInfo struct {
+	NodeID   NodeID
+	Build    BuildInfo
+	LastSeen time.Time
+}
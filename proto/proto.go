@@ -56,13 +56,15 @@ type Envelope struct {
 
 // PingReq is Ping RPC request.
 type PingReq struct {
-	Node Node
+	Node  Node
+	Build BuildInfo
 	Envelope
 }
 
 // PingResp is Ping RPC response, i.e. Pong.
 type PingResp struct {
-	Msg string
+	Msg   string
+	Build BuildInfo
 	Envelope
 }
 
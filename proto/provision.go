@@ -0,0 +1,65 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proto
+
+import (
+	"time"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/verifier"
+)
+
+//go:generate hsp
+
+// ProvisionTokenHeader defines the header of a short-lived provisioning token, which is minted by
+// an operator and used once by a new node to join the network.
+type ProvisionTokenHeader struct {
+	Role    ServerRole // role of the provisioned node
+	Expire  time.Time
+	Nonce   uint64 // random nonce, each token could only be used once
+	BPNodes []Node // block producers to contact on first boot
+}
+
+// ProvisionToken defines a provisioning token signed by the operator.
+type ProvisionToken struct {
+	ProvisionTokenHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the provisioning token.
+func (t *ProvisionToken) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.ProvisionTokenHeader, signer)
+}
+
+// Verify checks hash and signature in the provisioning token.
+func (t *ProvisionToken) Verify() (err error) {
+	return t.DefaultHashSignVerifierImpl.Verify(&t.ProvisionTokenHeader)
+}
+
+// ProvisionReq is Provision RPC request.
+type ProvisionReq struct {
+	Token ProvisionToken
+	Node  Node
+	Build BuildInfo
+	Envelope
+}
+
+// ProvisionResp is Provision RPC response.
+type ProvisionResp struct {
+	Config []byte // yaml encoded network config
+	Envelope
+}
@@ -54,6 +54,9 @@ ACLs:
 
    	* -> BP, DHT.FindNode(), DHT.FindNeighbor():
   		ACL: Open to world
+
+   	* -> BP, DHT.Provision():
+  		ACL: Open to world, add provisioning token verification
 */
 
 // RemoteFunc defines the RPC Call name.
@@ -68,6 +71,8 @@ const (
 	DHTFindNode
 	// DHTGSetNode is used by BP for dht data gossip
 	DHTGSetNode
+	// DHTProvision registers a new node with an operator minted provisioning token
+	DHTProvision
 	// MetricUploadMetrics uploads node metrics
 	MetricUploadMetrics
 	// DBSQuery is used by client to read/write database
@@ -78,12 +83,62 @@ const (
 	DBSDeploy
 	// DBSObserverFetchBlock is used by observer to fetch block.
 	DBSObserverFetchBlock
+	// DBSPutBlobChunk is used by client to upload blob chunk to miner
+	DBSPutBlobChunk
+	// DBSFetchBlobChunk is used by client and miner to fetch blob chunk from miner
+	DBSFetchBlobChunk
+	// DBSBuildInfo is used by miner to query build info of peer miners
+	DBSBuildInfo
+	// DBSCheckFeature is used by database owner to check feature readiness of the miner group
+	DBSCheckFeature
+	// DBSExportDatabase is used by client to export database as a SQLite file
+	DBSExportDatabase
+	// DBSStateDigest is used by miner and owner to compare replica state digests
+	DBSStateDigest
+	// DBSFetchSnapshotChunk is used by miner to fetch database snapshot from a healthy replica
+	DBSFetchSnapshotChunk
+	// DBSMigrationDryRun is used by client to estimate a migration on the leader shadow copy
+	DBSMigrationDryRun
+	// DBSTableUsage is used by database owner to get the storage usage of each table
+	DBSTableUsage
+	// DBSRowDigests is used by database owner to compare table rows between replicas
+	DBSRowDigests
+	// DBSShipSnapshotChunk is used by miner to ship database snapshot to the standby miner
+	DBSShipSnapshotChunk
+	// DBSPromoteStandby is used by database owner to promote the standby miner
+	DBSPromoteStandby
+	// DBSPrepareDataset is used by database owner to prepare a snapshot for dataset publishing
+	DBSPrepareDataset
+	// DBSFetchDatasetChunk is used by anyone to fetch a published dataset from miner
+	DBSFetchDatasetChunk
+	// DBSQueryReceiptProof is used by anyone to query the block inclusion proof of a write receipt
+	DBSQueryReceiptProof
+	// DBSQueryProof is used by auditors to query the inclusion proof of a query in the sqlchain
+	DBSQueryProof
+	// DBSFetchBlockHeaders is used by auditors to fetch the sqlchain block headers
+	DBSFetchBlockHeaders
+	// DBSCancelQuery is used by client to cancel its running read query
+	DBSCancelQuery
+	// DBSSubmitAsyncQuery is used by client to run a read query asynchronously on the miner
+	DBSSubmitAsyncQuery
+	// DBSAsyncQueryStatus is used by client to poll the status of its asynchronous query
+	DBSAsyncQueryStatus
+	// DBSFetchAsyncQuery is used by client to fetch the result of its asynchronous query
+	DBSFetchAsyncQuery
+	// DBSCancelAsyncQuery is used by client to cancel or discard its asynchronous query
+	DBSCancelAsyncQuery
+	// DBSPutWALSegment is used by miner to archive database wal segment to the archive miner
+	DBSPutWALSegment
+	// DBSFetchWALSegment is used by miner to fetch archived wal segment from the archive miner
+	DBSFetchWALSegment
 	// DBCCall is used by Miner for data consistency
 	DBCCall
 	// SQLCAdviseNewBlock is used by sqlchain to advise new block between adjacent node
 	SQLCAdviseNewBlock
 	// SQLCFetchBlock is used by sqlchain to fetch block from adjacent nodes
 	SQLCFetchBlock
+	// SQLCFetchBlocks is used by sqlchain to fetch a checksummed block batch during catch-up
+	SQLCFetchBlocks
 	// SQLCSignBilling is used by sqlchain to response billing signature for periodic billing request
 	SQLCSignBilling
 	// SQLCLaunchBilling is used by blockproducer to trigger the billing process in sqlchain
@@ -115,6 +170,26 @@ const (
 	MCCQueryTxState
 	// MCCQueryAccountSQLChainProfiles is used by client to query account databases.
 	MCCQueryAccountSQLChainProfiles
+	// MCCQueryTime is used by nodes to query the local time of block producer for clock skew detection.
+	MCCQueryTime
+	// MCCQueryBuildInfos is used by operators to query the build info distribution of the network.
+	MCCQueryBuildInfos
+	// MCCSubmitBillingStatement is used by miner to submit signed billing period statements.
+	MCCSubmitBillingStatement
+	// MCCSubmitBillingStatements is used by miner to submit batched billing period statements.
+	MCCSubmitBillingStatements
+	// MCCQueryBillingMismatches is used by database owner to query billing statement mismatches.
+	MCCQueryBillingMismatches
+	// MCCSimulateTx is used by client to pre-validate a transaction against current chain state.
+	MCCSimulateTx
+	// MCCPreviewCreateDatabase is used by client to preview the miners matched for a database creation.
+	MCCPreviewCreateDatabase
+	// MCCQueryDataset is used by anyone to query the datasets published for a database.
+	MCCQueryDataset
+	// MCCQueryAccountActivities is used by client to query the activity feed of an account.
+	MCCQueryAccountActivities
+	// MCCResolveName is used by anyone to resolve a registered name to the account address.
+	MCCResolveName
 	// MaxRPCOffset defines max rpc constant.
 	MaxRPCOffset
 
@@ -141,6 +216,8 @@ func (s RemoteFunc) String() string {
 		return "DHT.FindNode"
 	case DHTGSetNode:
 		return "DHTG.SetNode"
+	case DHTProvision:
+		return "DHT.Provision"
 	case MetricUploadMetrics:
 		return "Metric.UploadMetrics"
 	case DBSQuery:
@@ -151,12 +228,62 @@ func (s RemoteFunc) String() string {
 		return "DBS.Deploy"
 	case DBSObserverFetchBlock:
 		return "DBS.ObserverFetchBlock"
+	case DBSPutBlobChunk:
+		return "DBS.PutBlobChunk"
+	case DBSFetchBlobChunk:
+		return "DBS.FetchBlobChunk"
+	case DBSBuildInfo:
+		return "DBS.BuildInfo"
+	case DBSCheckFeature:
+		return "DBS.CheckFeature"
+	case DBSExportDatabase:
+		return "DBS.ExportDatabase"
+	case DBSStateDigest:
+		return "DBS.StateDigest"
+	case DBSFetchSnapshotChunk:
+		return "DBS.FetchSnapshotChunk"
+	case DBSMigrationDryRun:
+		return "DBS.MigrationDryRun"
+	case DBSTableUsage:
+		return "DBS.TableUsage"
+	case DBSRowDigests:
+		return "DBS.RowDigests"
+	case DBSShipSnapshotChunk:
+		return "DBS.ShipSnapshotChunk"
+	case DBSPromoteStandby:
+		return "DBS.PromoteStandby"
+	case DBSPrepareDataset:
+		return "DBS.PrepareDataset"
+	case DBSFetchDatasetChunk:
+		return "DBS.FetchDatasetChunk"
+	case DBSQueryReceiptProof:
+		return "DBS.QueryReceiptProof"
+	case DBSQueryProof:
+		return "DBS.QueryProof"
+	case DBSFetchBlockHeaders:
+		return "DBS.FetchBlockHeaders"
+	case DBSCancelQuery:
+		return "DBS.CancelQuery"
+	case DBSSubmitAsyncQuery:
+		return "DBS.SubmitAsyncQuery"
+	case DBSAsyncQueryStatus:
+		return "DBS.AsyncQueryStatus"
+	case DBSFetchAsyncQuery:
+		return "DBS.FetchAsyncQuery"
+	case DBSCancelAsyncQuery:
+		return "DBS.CancelAsyncQuery"
+	case DBSPutWALSegment:
+		return "DBS.PutWALSegment"
+	case DBSFetchWALSegment:
+		return "DBS.FetchWALSegment"
 	case DBCCall:
 		return "DBC.Call"
 	case SQLCAdviseNewBlock:
 		return "SQLC.AdviseNewBlock"
 	case SQLCFetchBlock:
 		return "SQLC.FetchBlock"
+	case SQLCFetchBlocks:
+		return "SQLC.FetchBlocks"
 	case SQLCSignBilling:
 		return "SQLC.SignBilling"
 	case SQLCLaunchBilling:
@@ -187,10 +314,36 @@ func (s RemoteFunc) String() string {
 		return "MCC.QueryTxState"
 	case MCCQueryAccountSQLChainProfiles:
 		return "MCC.QueryAccountSQLChainProfiles"
+	case MCCQueryTime:
+		return "MCC.QueryTime"
+	case MCCQueryBuildInfos:
+		return "MCC.QueryBuildInfos"
+	case MCCSubmitBillingStatement:
+		return "MCC.SubmitBillingStatement"
+	case MCCSubmitBillingStatements:
+		return "MCC.SubmitBillingStatements"
+	case MCCQueryBillingMismatches:
+		return "MCC.QueryBillingMismatches"
+	case MCCSimulateTx:
+		return "MCC.SimulateTx"
+	case MCCPreviewCreateDatabase:
+		return "MCC.PreviewCreateDatabase"
+	case MCCQueryDataset:
+		return "MCC.QueryDataset"
+	case MCCQueryAccountActivities:
+		return "MCC.QueryAccountActivities"
+	case MCCResolveName:
+		return "MCC.ResolveName"
 	}
 	return "Unknown"
 }
 
+// IsAnonymousMethod returns if the RPC method is called with anonymous ETLS session, i.e. by a
+// node which is not registered yet.
+func IsAnonymousMethod(method string) bool {
+	return method == DHTPing.String() || method == DHTProvision.String()
+}
+
 // IsPermitted returns if the node is permitted to call the RPC func.
 func IsPermitted(callerEnvelope *proto.Envelope, funcName RemoteFunc) (ok bool) {
 	callerETLSNodeID := callerEnvelope.GetNodeID()
@@ -198,7 +351,7 @@ func IsPermitted(callerEnvelope *proto.Envelope, funcName RemoteFunc) (ok bool)
 	// the envelope node id is set at NodeAwareServerCodec and CryptoListener.CHandler
 	// if callerETLSNodeID == nil here indicates that ETLS is not used, just ignore it
 	if callerETLSNodeID == nil || callerETLSNodeID.IsEqual(&kms.AnonymousRawNodeID.Hash) {
-		if funcName != DHTPing {
+		if funcName != DHTPing && funcName != DHTProvision {
 			log.WithField("field", funcName).Warning("anonymous ETLS connection can not used")
 			return false
 		}
@@ -208,7 +361,7 @@ func IsPermitted(callerEnvelope *proto.Envelope, funcName RemoteFunc) (ok bool)
 		// non BP
 		switch funcName {
 		// DHT related
-		case DHTPing, DHTFindNode, DHTFindNeighbor, MetricUploadMetrics:
+		case DHTPing, DHTProvision, DHTFindNode, DHTFindNeighbor, MetricUploadMetrics:
 			return true
 			// DHTGSetNode is for block producer to update node info
 		case DHTGSetNode:
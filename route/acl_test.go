@@ -56,6 +56,7 @@ func TestIsPermitted(t *testing.T) {
 		So(IsPermitted(testEnv, DHTFindNode), ShouldBeTrue)
 		So(IsPermitted(testEnv, RemoteFunc(9999)), ShouldBeFalse)
 		So(IsPermitted(testAnonymous, DHTFindNode), ShouldBeFalse)
+		So(IsPermitted(testAnonymous, DHTProvision), ShouldBeTrue)
 	})
 
 	Convey("string RemoteFunc", t, func() {
@@ -0,0 +1,295 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+var (
+	// AddressBookMaxAge is the max age of the peers loaded from the address book, the peers not
+	// seen for longer are pruned.
+	AddressBookMaxAge = 7 * 24 * time.Hour
+	// AddressBookFlushInterval is the interval of flushing the address book to disk.
+	AddressBookFlushInterval = time.Minute
+)
+
+// AddressBookEntry defines a known peer in the address book.
+type AddressBookEntry struct {
+	NodeID proto.NodeID `json:"id"`
+	Addr   string       `json:"addr"`
+	// Version is the protocol version advertised by the peer.
+	Version  string    `json:"version,omitempty"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// AddressBook persists the known peers of the node, which is loaded on restart to bootstrap
+// without asking the BP for the same resolutions.
+type AddressBook struct {
+	sync.Mutex
+	path    string
+	entries map[proto.NodeID]*AddressBookEntry
+	dirty   bool
+	now     func() time.Time
+}
+
+// LoadAddressBook loads the address book from the file, an empty book is returned if the file
+// does not exist.
+func LoadAddressBook(path string) (ab *AddressBook, err error) {
+	ab = &AddressBook{
+		path:    path,
+		entries: make(map[proto.NodeID]*AddressBookEntry),
+		now:     time.Now,
+	}
+	var data []byte
+	if data, err = ioutil.ReadFile(path); err != nil {
+		if os.IsNotExist(err) {
+			return ab, nil
+		}
+		return nil, errors.Wrapf(err, "read address book %s failed", path)
+	}
+	var entries []*AddressBookEntry
+	if err = json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.Wrapf(err, "decode address book %s failed", path)
+	}
+	for _, e := range entries {
+		if e.NodeID.IsEmpty() || e.Addr == "" {
+			continue
+		}
+		ab.entries[e.NodeID] = e
+	}
+	return
+}
+
+// Seen records the address of the peer and updates its last-seen time.
+func (ab *AddressBook) Seen(id proto.NodeID, addr string) {
+	if id.IsEmpty() || addr == "" {
+		return
+	}
+	ab.Lock()
+	defer ab.Unlock()
+	e, ok := ab.entries[id]
+	if !ok {
+		e = &AddressBookEntry{NodeID: id}
+		ab.entries[id] = e
+	}
+	e.Addr = addr
+	e.LastSeen = ab.now().UTC()
+	ab.dirty = true
+}
+
+// SetVersion records the protocol version advertised by a known peer.
+func (ab *AddressBook) SetVersion(id proto.NodeID, version string) {
+	ab.Lock()
+	defer ab.Unlock()
+	if e, ok := ab.entries[id]; ok && e.Version != version {
+		e.Version = version
+		ab.dirty = true
+	}
+}
+
+// Remove removes the peer from the address book.
+func (ab *AddressBook) Remove(id proto.NodeID) {
+	ab.Lock()
+	defer ab.Unlock()
+	if _, ok := ab.entries[id]; ok {
+		delete(ab.entries, id)
+		ab.dirty = true
+	}
+}
+
+// Get returns the entry of the peer.
+func (ab *AddressBook) Get(id proto.NodeID) (e AddressBookEntry, ok bool) {
+	ab.Lock()
+	defer ab.Unlock()
+	var p *AddressBookEntry
+	if p, ok = ab.entries[id]; ok {
+		e = *p
+	}
+	return
+}
+
+// Entries returns the entries ordered by node id.
+func (ab *AddressBook) Entries() (entries []AddressBookEntry) {
+	ab.Lock()
+	defer ab.Unlock()
+	entries = make([]AddressBookEntry, 0, len(ab.entries))
+	for _, e := range ab.entries {
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].NodeID < entries[j].NodeID })
+	return
+}
+
+// Prune removes the peers not seen for longer than maxAge, returns the number of removed peers.
+func (ab *AddressBook) Prune(maxAge time.Duration) (pruned int) {
+	ab.Lock()
+	defer ab.Unlock()
+	var deadline = ab.now().Add(-maxAge)
+	for id, e := range ab.entries {
+		if e.LastSeen.Before(deadline) {
+			delete(ab.entries, id)
+			pruned++
+		}
+	}
+	if pruned > 0 {
+		ab.dirty = true
+	}
+	return
+}
+
+// Save writes the address book to disk if it is changed, the file is replaced atomically.
+func (ab *AddressBook) Save() (err error) {
+	ab.Lock()
+	defer ab.Unlock()
+	if !ab.dirty {
+		return
+	}
+	var entries = make([]*AddressBookEntry, 0, len(ab.entries))
+	for _, e := range ab.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].NodeID < entries[j].NodeID })
+	var data []byte
+	if data, err = json.MarshalIndent(entries, "", "  "); err != nil {
+		return
+	}
+	var tmp = ab.path + ".tmp"
+	if err = os.MkdirAll(filepath.Dir(ab.path), 0755); err != nil {
+		return errors.Wrapf(err, "create address book dir failed")
+	}
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Wrapf(err, "write address book %s failed", tmp)
+	}
+	if err = os.Rename(tmp, ab.path); err != nil {
+		return errors.Wrapf(err, "replace address book %s failed", ab.path)
+	}
+	ab.dirty = false
+	return
+}
+
+// addressBook is the address book of the running node.
+var addressBook struct {
+	sync.RWMutex
+	book *AddressBook
+}
+
+func getAddressBook() *AddressBook {
+	addressBook.RLock()
+	defer addressBook.RUnlock()
+	return addressBook.book
+}
+
+// recordPeerAddr records the resolved peer address to the address book if it is started.
+func recordPeerAddr(id *proto.RawNodeID, addr string) {
+	if ab := getAddressBook(); ab != nil {
+		ab.Seen(proto.NodeID(id.String()), addr)
+	}
+}
+
+// recordPeerVersion records the peer version to the address book if it is started.
+func recordPeerVersion(id proto.NodeID, version string) {
+	if ab := getAddressBook(); ab != nil {
+		ab.SetVersion(id, version)
+	}
+}
+
+// StartAddressBook loads the address book if conf.GConf.AddressBookFile is set, the peers
+// seen within AddressBookMaxAge are added to the resolver cache unless they are resolved by
+// config or seeds already. The resolved peers are recorded to the address book and flushed to
+// disk periodically. Call the returned stop func to stop and flush the address book.
+func StartAddressBook() (stop func(), err error) {
+	stop = func() {}
+	if conf.GConf == nil || conf.GConf.AddressBookFile == "" {
+		return
+	}
+	initResolver()
+	var ab *AddressBook
+	if ab, err = LoadAddressBook(conf.GConf.AddressBookFile); err != nil {
+		return
+	}
+	if pruned := ab.Prune(AddressBookMaxAge); pruned > 0 {
+		log.WithField("pruned", pruned).Info("pruned stale peers from address book")
+	}
+	var loaded int
+	resolver.Lock()
+	for _, e := range ab.Entries() {
+		rawID := e.NodeID.ToRawNodeID()
+		if rawID == nil {
+			continue
+		}
+		if _, ok := resolver.cache[*rawID]; !ok {
+			resolver.cache[*rawID] = e.Addr
+			loaded++
+		}
+	}
+	resolver.Unlock()
+	log.WithFields(log.Fields{
+		"file":   conf.GConf.AddressBookFile,
+		"loaded": loaded,
+	}).Info("loaded peers from address book")
+
+	addressBook.Lock()
+	addressBook.book = ab
+	addressBook.Unlock()
+
+	var (
+		done    = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+	go func() {
+		defer close(stopped)
+		var ticker = time.NewTicker(AddressBookFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := ab.Save(); err != nil {
+					log.WithError(err).Warning("flush address book failed")
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+			addressBook.Lock()
+			addressBook.book = nil
+			addressBook.Unlock()
+			if err := ab.Save(); err != nil {
+				log.WithError(err).Warning("flush address book failed")
+			}
+		})
+	}
+	return
+}
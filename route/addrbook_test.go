@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestAddressBook(t *testing.T) {
+	Convey("Given an address book file", t, func() {
+		dir, err := ioutil.TempDir("", "addrbook")
+		So(err, ShouldBeNil)
+		defer func() { _ = os.RemoveAll(dir) }()
+
+		var (
+			path  = filepath.Join(dir, "peers", "addrbook.json")
+			now   = time.Now()
+			nodeA = proto.NodeID("00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9")
+			nodeB = proto.NodeID("000000000013fd4b3180dd424d5a895bc57b798e5315087b7198c926d8893f98")
+		)
+		ab, err := LoadAddressBook(path)
+		So(err, ShouldBeNil)
+		So(ab.Entries(), ShouldBeEmpty)
+		ab.now = func() time.Time { return now }
+
+		Convey("The peers should be persisted with last-seen info", func() {
+			ab.Seen(nodeA, "127.0.0.1:2120")
+			ab.SetVersion(nodeA, "v0.8.0")
+			// unknown peer version is ignored
+			ab.SetVersion(nodeB, "v0.8.0")
+			ab.Seen(proto.NodeID(""), "127.0.0.1:2121")
+			So(ab.Save(), ShouldBeNil)
+
+			loaded, err := LoadAddressBook(path)
+			So(err, ShouldBeNil)
+			entries := loaded.Entries()
+			So(entries, ShouldHaveLength, 1)
+			So(entries[0].NodeID, ShouldEqual, nodeA)
+			So(entries[0].Addr, ShouldEqual, "127.0.0.1:2120")
+			So(entries[0].Version, ShouldEqual, "v0.8.0")
+			So(entries[0].LastSeen.Equal(now), ShouldBeTrue)
+
+			// the address is updated on resolution
+			loaded.Seen(nodeA, "127.0.0.1:3120")
+			e, ok := loaded.Get(nodeA)
+			So(ok, ShouldBeTrue)
+			So(e.Addr, ShouldEqual, "127.0.0.1:3120")
+			So(e.Version, ShouldEqual, "v0.8.0")
+		})
+		Convey("The stale peers should be pruned", func() {
+			ab.Seen(nodeA, "127.0.0.1:2120")
+			ab.now = func() time.Time { return now.Add(time.Hour) }
+			ab.Seen(nodeB, "127.0.0.1:2121")
+			So(ab.Prune(30*time.Minute), ShouldEqual, 1)
+			_, ok := ab.Get(nodeA)
+			So(ok, ShouldBeFalse)
+			_, ok = ab.Get(nodeB)
+			So(ok, ShouldBeTrue)
+		})
+		Convey("The corrupted file should be reported", func() {
+			So(os.MkdirAll(filepath.Dir(path), 0755), ShouldBeNil)
+			So(ioutil.WriteFile(path, []byte("{"), 0600), ShouldBeNil)
+			_, err := LoadAddressBook(path)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
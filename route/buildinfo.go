@@ -0,0 +1,58 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+// buildInfos caches the build info reported by nodes.
+var buildInfos = struct {
+	sync.RWMutex
+	nodes map[proto.NodeID]*proto.NodeBuildInfo
+}{
+	nodes: make(map[proto.NodeID]*proto.NodeBuildInfo),
+}
+
+// RecordBuildInfo records the build info reported by the node.
+func RecordBuildInfo(id proto.NodeID, info proto.BuildInfo) {
+	buildInfos.Lock()
+	defer buildInfos.Unlock()
+	buildInfos.nodes[id] = &proto.NodeBuildInfo{
+		NodeID:   id,
+		Build:    info,
+		LastSeen: time.Now().UTC(),
+	}
+	recordPeerVersion(id, info.Version)
+}
+
+// GetBuildInfos returns the recorded build info of all nodes, ordered by node id.
+func GetBuildInfos() (infos []*proto.NodeBuildInfo) {
+	buildInfos.RLock()
+	defer buildInfos.RUnlock()
+	infos = make([]*proto.NodeBuildInfo, 0, len(buildInfos.nodes))
+	for _, v := range buildInfos.nodes {
+		cpy := *v
+		infos = append(infos, &cpy)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].NodeID < infos[j].NodeID })
+	return
+}
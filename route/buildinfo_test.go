@@ -0,0 +1,64 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestBuildInfos(t *testing.T) {
+	Convey("test recording build info of nodes", t, func() {
+		var (
+			node1 = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000002")
+			node2 = proto.NodeID("0000000000000000000000000000000000000000000000000000000000000001")
+		)
+		RecordBuildInfo(node1, proto.BuildInfo{Version: "v1.0.0", BuildHash: "a"})
+		RecordBuildInfo(node2, proto.BuildInfo{Version: "v1.0.0", BuildHash: "a"})
+		RecordBuildInfo(node1, proto.BuildInfo{Version: "v1.1.0", BuildHash: "b"})
+		defer func() {
+			buildInfos.Lock()
+			defer buildInfos.Unlock()
+			delete(buildInfos.nodes, node1)
+			delete(buildInfos.nodes, node2)
+		}()
+
+		infos := GetBuildInfos()
+		So(len(infos), ShouldBeGreaterThanOrEqualTo, 2)
+		var found = make(map[proto.NodeID]*proto.NodeBuildInfo)
+		for i, v := range infos {
+			if i > 0 {
+				So(infos[i-1].NodeID, ShouldBeLessThan, v.NodeID)
+			}
+			found[v.NodeID] = v
+		}
+		So(found[node1].Build.Version, ShouldEqual, "v1.1.0")
+		So(found[node1].LastSeen.IsZero(), ShouldBeFalse)
+		So(found[node2].Build.BuildHash, ShouldEqual, "a")
+
+		// returned infos are copies
+		found[node2].Build.Version = "changed"
+		for _, v := range GetBuildInfos() {
+			if v.NodeID == node2 {
+				So(v.Build.Version, ShouldEqual, "v1.0.0")
+			}
+		}
+	})
+}
@@ -17,10 +17,12 @@
 package route
 
 import (
-	"errors"
 	"fmt"
 	"math/rand"
 	"sync"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/SQLess/SQLess/conf"
 	"github.com/SQLess/SQLess/crypto/kms"
@@ -42,6 +44,10 @@ var (
 	Once utils.Once
 )
 
+// SeedMergeWindow is how long to wait for the other seed domains after the first one succeeds,
+// the BPs of the domains succeeded in the window are merged.
+var SeedMergeWindow = 500 * time.Millisecond
+
 var (
 	// ErrUnknownNodeID indicates we got unknown node id
 	ErrUnknownNodeID = errors.New("unknown node id")
@@ -108,8 +114,10 @@ func setNodeAddrCache(id *proto.RawNodeID, addr string) (err error) {
 		return ErrNilNodeID
 	}
 	resolver.Lock()
-	defer resolver.Unlock()
 	resolver.cache[*id] = addr
+	resolver.Unlock()
+	recordPeerAddr(id, addr)
+	recordNodeAddr(id, addr)
 	return
 }
 
@@ -131,15 +139,13 @@ func initBPNodeIDs() (bpNodeIDs NodeIDAddressMap) {
 
 	var err error
 
-	if conf.GConf.DNSSeed.Domain != "" {
-		var bpIndex int
-		dc := IPv6SeedClient{}
-		bpIndex = rand.Intn(conf.GConf.DNSSeed.BPCount)
-		bpDomain := fmt.Sprintf("bp%02d.%s", bpIndex, conf.GConf.DNSSeed.Domain)
-		log.Infof("Geting bp address from dns: %v", bpDomain)
-		resolver.bpNodes, err = dc.GetBPFromDNSSeed(bpDomain)
-		if err != nil {
-			log.WithField("seed", bpDomain).WithError(err).Error(
+	if bpNodes := loadTableBPs(); len(bpNodes) > 0 {
+		// rejoin with the BPs learned before restart, without looking up the seed
+		log.WithField("count", len(bpNodes)).Info("use the BPs of node table")
+		resolver.bpNodes = bpNodes
+	} else if len(conf.GConf.DNSSeed.SeedDomains()) > 0 || len(conf.GConf.DNSSeed.JSONSeeds) > 0 {
+		if resolver.bpNodes, err = loadSeedBPs(&conf.GConf.DNSSeed); err != nil {
+			log.WithField("seed", conf.GConf.DNSSeed.SeedDomains()).WithError(err).Error(
 				"getting BP info from DNS failed")
 			return
 		}
@@ -167,12 +173,109 @@ func initBPNodeIDs() (bpNodeIDs NodeIDAddressMap) {
 			conf.GConf.SeedBPNodes = append(conf.GConf.SeedBPNodes, n)
 			setNodeAddrCache(rawID, n.Addr)
 			resolver.bpNodeIDs[*rawID] = n.Addr
+			RecordNode(&n)
 		}
 	}
 
 	return resolver.bpNodeIDs
 }
 
+// getBPsFromDNSSeed gets the BPs from the seed domains of the config, the domains are looked up
+// concurrently so that a dead domain does not stall the bootstrap.
+func getBPsFromDNSSeed(cfg *conf.DNSSeed) (bpNodes IDNodeMap, err error) {
+	return raceSeedLookups(cfg.SeedDomains(), func(domain string) (IDNodeMap, error) {
+		return getBPsFromSeedDomain(cfg, domain)
+	})
+}
+
+// raceSeedLookups looks up the seed domains concurrently, the BPs of the first succeeded domain
+// are returned once the SeedMergeWindow elapses, merged with the BPs of the other domains
+// succeeded in the window. An error is returned if all the domains fail.
+func raceSeedLookups(
+	domains []string, lookup func(domain string) (IDNodeMap, error),
+) (bpNodes IDNodeMap, err error) {
+	type result struct {
+		domain  string
+		bpNodes IDNodeMap
+		err     error
+	}
+	if len(domains) == 1 {
+		return lookup(domains[0])
+	}
+	var (
+		results = make(chan result, len(domains))
+		merge   <-chan time.Time
+	)
+	for _, d := range domains {
+		go func(domain string) {
+			nodes, err := lookup(domain)
+			results <- result{domain: domain, bpNodes: nodes, err: err}
+		}(d)
+	}
+	for pending := len(domains); pending > 0; {
+		select {
+		case r := <-results:
+			pending--
+			if r.err != nil || len(r.bpNodes) == 0 {
+				log.WithField("seed", r.domain).WithError(r.err).Warning(
+					"getting BP info from seed domain failed")
+				if r.err != nil {
+					err = r.err
+				}
+				continue
+			}
+			if bpNodes == nil {
+				bpNodes = make(IDNodeMap)
+				merge = time.After(SeedMergeWindow)
+			}
+			for id, n := range r.bpNodes {
+				if _, ok := bpNodes[id]; !ok {
+					bpNodes[id] = n
+				}
+			}
+		case <-merge:
+			return bpNodes, nil
+		}
+	}
+	if len(bpNodes) > 0 {
+		err = nil
+	}
+	return
+}
+
+// getBPsFromSeedDomain gets the BPs from the seed domain.
+func getBPsFromSeedDomain(cfg *conf.DNSSeed, domain string) (bpNodes IDNodeMap, err error) {
+	dc := IPv6SeedClient{RequireSignature: cfg.RequireSignature}
+	if dc.Encoding, err = ParseSeedEncoding(cfg.Encoding); err != nil {
+		return nil, errors.Wrap(err, "invalid DNS seed encoding")
+	}
+	if cfg.Resolver != "" {
+		var doh *DoHResolver
+		if doh, err = NewDoHResolver(cfg.Resolver); err != nil {
+			return nil, errors.Wrap(err, "invalid DNS seed resolver")
+		}
+		dc.Resolver = doh
+	}
+	if cfg.EnforcedDNSSEC || len(cfg.TrustAnchors) > 0 {
+		if dc.Validator, err = NewDNSSECValidator(cfg); err != nil {
+			return nil, errors.Wrap(err, "init DNSSEC validator failed")
+		}
+	}
+	log.Infof("Geting bp addresses from dns: %v", domain)
+	if bpNodes, err = dc.GetBPsFromDNSSeed(domain); err != nil {
+		return
+	}
+	if len(bpNodes) == 0 && cfg.BPCount > 0 {
+		// the seed domain publishes a single BP per bpXX sub-domain
+		bpDomain := fmt.Sprintf("bp%02d.%s", rand.Intn(cfg.BPCount), domain)
+		log.Infof("Geting bp address from dns: %v", bpDomain)
+		if bpNodes, err = dc.GetBPFromDNSSeed(bpDomain); err != nil {
+			return nil, errors.Wrapf(err, "getting BP info from %s failed", bpDomain)
+		}
+	}
+	return
+}
+
 // GetBPs returns the known BP node id list.
 func GetBPs() (bpAddrs []proto.NodeID) {
 	bpAddrs = make([]proto.NodeID, 0, len(resolver.bpNodeIDs))
@@ -20,6 +20,9 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
 
 	. "github.com/smartystreets/goconvey/convey"
 
@@ -76,3 +79,43 @@ func TestResolver(t *testing.T) {
 		So(len(BPs), ShouldBeGreaterThanOrEqualTo, len(ips))
 	})
 }
+
+func TestRaceSeedLookups(t *testing.T) {
+	Convey("Given seed domains with a dead one", t, func() {
+		var (
+			idA, idB = proto.RawNodeID{Hash: hash.Hash{0x01}}, proto.RawNodeID{Hash: hash.Hash{0x02}}
+			dead     = make(chan struct{})
+			window   = SeedMergeWindow
+		)
+		SeedMergeWindow = 50 * time.Millisecond
+		defer func() {
+			SeedMergeWindow = window
+			close(dead)
+		}()
+		lookup := func(domain string) (IDNodeMap, error) {
+			switch domain {
+			case "a.example.com":
+				return IDNodeMap{idA: {Addr: "a:1"}}, nil
+			case "b.example.com":
+				return IDNodeMap{idA: {Addr: "a:2"}, idB: {Addr: "b:1"}}, nil
+			case "broken.example.com":
+				return nil, errors.New("broken")
+			}
+			<-dead
+			return nil, errors.New("timeout")
+		}
+
+		Convey("The dead domain should not stall the lookup", func() {
+			nodes, err := raceSeedLookups(
+				[]string{"dead.example.com", "a.example.com", "b.example.com"}, lookup)
+			So(err, ShouldBeNil)
+			So(nodes, ShouldHaveLength, 2)
+			So(nodes[idB].Addr, ShouldEqual, "b:1")
+		})
+
+		Convey("The error should be returned if all the domains fail", func() {
+			_, err := raceSeedLookups([]string{"broken.example.com", "broken.example.com"}, lookup)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
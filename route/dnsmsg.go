@@ -0,0 +1,330 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A minimal DNS client which fetches the raw records and signatures for the DNSSEC validation,
+// see dnssec.go.
+
+const (
+	dnsTypeA      uint16 = 1
+	dnsTypeNS     uint16 = 2
+	dnsTypeCNAME  uint16 = 5
+	dnsTypeSOA    uint16 = 6
+	dnsTypeTXT    uint16 = 16
+	dnsTypeOPT    uint16 = 41
+	dnsTypeAAAA   uint16 = 28
+	dnsTypeDS     uint16 = 43
+	dnsTypeRRSIG  uint16 = 46
+	dnsTypeNSEC   uint16 = 47
+	dnsTypeDNSKEY uint16 = 48
+	dnsTypeNSEC3  uint16 = 50
+
+	dnsClassINET uint16 = 1
+
+	dnsFlagRD uint16 = 1 << 8
+	dnsFlagTC uint16 = 1 << 9
+	dnsFlagCD uint16 = 1 << 4
+	dnsFlagQR uint16 = 1 << 15
+
+	dnsRcodeSuccess  = 0
+	dnsRcodeNXDomain = 3
+
+	dnsHeaderLen   = 12
+	dnsUDPSize     = 4096
+	dnsEDNSFlagDO  = 1 << 15
+	dnsMaxPointers = 16
+)
+
+var (
+	errDNSMsgTruncated = errors.New("dns message truncated")
+	errDNSMsgMismatch  = errors.New("dns response mismatches query")
+)
+
+// dnsRR defines a resource record, the name is lower-cased and fully qualified.
+type dnsRR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte
+}
+
+// dnsMsg defines the parsed sections of a DNS response.
+type dnsMsg struct {
+	ID        uint16
+	Flags     uint16
+	Answer    []dnsRR
+	Authority []dnsRR
+}
+
+func (m *dnsMsg) rcode() int {
+	return int(m.Flags & 0xf)
+}
+
+// fqdn returns the lower-cased fully qualified domain name.
+func fqdn(name string) string {
+	name = strings.ToLower(name)
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	return name
+}
+
+// nameLabels splits the fully qualified domain name into labels, the root has no labels.
+func nameLabels(name string) []string {
+	name = strings.TrimSuffix(fqdn(name), ".")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, ".")
+}
+
+// appendName appends the uncompressed wire format of the name.
+func appendName(b []byte, name string) []byte {
+	for _, l := range nameLabels(name) {
+		b = append(b, byte(len(l)))
+		b = append(b, l...)
+	}
+	return append(b, 0)
+}
+
+// isSubdomain reports whether child equals or is under parent.
+func isSubdomain(child, parent string) bool {
+	child, parent = fqdn(child), fqdn(parent)
+	return parent == "." || child == parent || strings.HasSuffix(child, "."+parent)
+}
+
+// buildDNSQuery builds the query with the DNSSEC OK bit, the checking disabled flag should be
+// set if the records are validated locally.
+func buildDNSQuery(id uint16, name string, qtype uint16, flags uint16) []byte {
+	var b = make([]byte, dnsHeaderLen, 512)
+	binary.BigEndian.PutUint16(b[0:], id)
+	binary.BigEndian.PutUint16(b[2:], flags)
+	binary.BigEndian.PutUint16(b[4:], 1)  // qdcount
+	binary.BigEndian.PutUint16(b[10:], 1) // arcount
+	b = appendName(b, name)
+	b = append(b, byte(qtype>>8), byte(qtype), byte(dnsClassINET>>8), byte(dnsClassINET))
+	// EDNS0 OPT record with the DNSSEC OK bit
+	b = append(b, 0, byte(dnsTypeOPT>>8), byte(dnsTypeOPT), byte(dnsUDPSize>>8), byte(dnsUDPSize&0xff))
+	b = append(b, 0, 0, byte(dnsEDNSFlagDO>>8), 0, 0, 0)
+	return b
+}
+
+// readName reads the possibly compressed name at offset, returns the lower-cased name and the
+// offset after it.
+func readName(msg []byte, off int) (name string, next int, err error) {
+	var (
+		labels   []string
+		pointers int
+	)
+	next = -1
+	for {
+		if off >= len(msg) {
+			return "", 0, errDNSMsgTruncated
+		}
+		c := int(msg[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if next < 0 {
+					next = off + 1
+				}
+				return fqdn(strings.Join(labels, ".")), next, nil
+			}
+			if off+1+c > len(msg) {
+				return "", 0, errDNSMsgTruncated
+			}
+			labels = append(labels, string(msg[off+1:off+1+c]))
+			off += 1 + c
+		case 0xc0:
+			if off+2 > len(msg) {
+				return "", 0, errDNSMsgTruncated
+			}
+			if pointers++; pointers > dnsMaxPointers {
+				return "", 0, errors.New("too many dns name compression pointers")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		default:
+			return "", 0, errors.New("unsupported dns label type")
+		}
+	}
+}
+
+// txtData concatenates the character strings of the TXT record data.
+func txtData(data []byte) (txt string, err error) {
+	var b []byte
+	for len(data) > 0 {
+		l := int(data[0])
+		if 1+l > len(data) {
+			return "", errDNSMsgTruncated
+		}
+		b = append(b, data[1:1+l]...)
+		data = data[1+l:]
+	}
+	return string(b), nil
+}
+
+func readRR(msg []byte, off int) (rr dnsRR, next int, err error) {
+	if rr.Name, off, err = readName(msg, off); err != nil {
+		return
+	}
+	if off+10 > len(msg) {
+		err = errDNSMsgTruncated
+		return
+	}
+	rr.Type = binary.BigEndian.Uint16(msg[off:])
+	rr.Class = binary.BigEndian.Uint16(msg[off+2:])
+	rr.TTL = binary.BigEndian.Uint32(msg[off+4:])
+	l := int(binary.BigEndian.Uint16(msg[off+8:]))
+	off += 10
+	if off+l > len(msg) {
+		err = errDNSMsgTruncated
+		return
+	}
+	// the rdata of the record types in use contains no compressed names
+	rr.Data = append([]byte(nil), msg[off:off+l]...)
+	next = off + l
+	return
+}
+
+func parseDNSMsg(msg []byte) (m *dnsMsg, err error) {
+	if len(msg) < dnsHeaderLen {
+		return nil, errDNSMsgTruncated
+	}
+	m = &dnsMsg{
+		ID:    binary.BigEndian.Uint16(msg[0:]),
+		Flags: binary.BigEndian.Uint16(msg[2:]),
+	}
+	var (
+		qd  = int(binary.BigEndian.Uint16(msg[4:]))
+		an  = int(binary.BigEndian.Uint16(msg[6:]))
+		ns  = int(binary.BigEndian.Uint16(msg[8:]))
+		off = dnsHeaderLen
+	)
+	for i := 0; i < qd; i++ {
+		if _, off, err = readName(msg, off); err != nil {
+			return nil, err
+		}
+		off += 4
+	}
+	for i := 0; i < an+ns; i++ {
+		var rr dnsRR
+		if rr, off, err = readRR(msg, off); err != nil {
+			return nil, err
+		}
+		if i < an {
+			m.Answer = append(m.Answer, rr)
+		} else {
+			m.Authority = append(m.Authority, rr)
+		}
+	}
+	return
+}
+
+// exchangeDNS sends the query to the server over udp, and retries over tcp if the response is
+// truncated.
+func exchangeDNS(server, name string, qtype uint16, timeout time.Duration) (m *dnsMsg, err error) {
+	var (
+		id    = uint16(rand.Uint32())
+		query = buildDNSQuery(id, name, qtype, dnsFlagRD|dnsFlagCD)
+		resp  []byte
+	)
+	if resp, err = exchangeDNSOver("udp", server, query, timeout); err != nil {
+		return
+	}
+	if m, err = parseDNSMsg(resp); err != nil {
+		return
+	}
+	if m.Flags&dnsFlagTC != 0 {
+		if resp, err = exchangeDNSOver("tcp", server, query, timeout); err != nil {
+			return
+		}
+		if m, err = parseDNSMsg(resp); err != nil {
+			return
+		}
+	}
+	if m.ID != id || m.Flags&dnsFlagQR == 0 {
+		return nil, errDNSMsgMismatch
+	}
+	return
+}
+
+func exchangeDNSOver(network, server string, query []byte, timeout time.Duration) (resp []byte, err error) {
+	var conn net.Conn
+	if conn, err = net.DialTimeout(network, server, timeout); err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return
+	}
+	if network == "udp" {
+		if _, err = conn.Write(query); err != nil {
+			return
+		}
+		var buf = make([]byte, dnsUDPSize)
+		var n int
+		if n, err = conn.Read(buf); err != nil {
+			return
+		}
+		return buf[:n], nil
+	}
+	var l = make([]byte, 2)
+	binary.BigEndian.PutUint16(l, uint16(len(query)))
+	if _, err = conn.Write(append(l, query...)); err != nil {
+		return
+	}
+	if _, err = io.ReadFull(conn, l); err != nil {
+		return
+	}
+	resp = make([]byte, binary.BigEndian.Uint16(l))
+	_, err = io.ReadFull(conn, resp)
+	return
+}
+
+// systemDNSServers returns the name servers in resolv.conf.
+func systemDNSServers() (servers []string, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile("/etc/resolv.conf"); err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	if len(servers) == 0 {
+		err = errors.New("no name server found in resolv.conf")
+	}
+	return
+}
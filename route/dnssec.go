@@ -0,0 +1,649 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/conf"
+)
+
+const (
+	dnssecAlgRSASHA256       = 8
+	dnssecAlgRSASHA512       = 10
+	dnssecAlgECDSAP256SHA256 = 13
+	dnssecAlgECDSAP384SHA384 = 14
+	dnssecAlgED25519         = 15
+
+	dnssecDigestSHA1   = 1
+	dnssecDigestSHA256 = 2
+	dnssecDigestSHA384 = 4
+
+	dnskeyFlagZone = 1 << 8
+	dnskeyProtocol = 3
+
+	rrsigFixedLen = 18
+	// maxChainDepth limits the delegations walked from a zone up to its trust anchor.
+	maxChainDepth = 8
+)
+
+var (
+	// DNSSECQueryTimeout is the timeout of a single DNS query of the validating lookups.
+	DNSSECQueryTimeout = 5 * time.Second
+	// DNSSECKeyCacheTTL is the duration to cache the validated keys of a zone.
+	DNSSECKeyCacheTTL = 10 * time.Minute
+)
+
+var (
+	// ErrDNSSECUnsigned indicates the records are not under any trust anchor, so they can not
+	// be validated. The stripped signatures under the trust anchors are ErrDNSSECBogus.
+	ErrDNSSECUnsigned = errors.New("dnssec: records are not signed")
+	// ErrDNSSECBogus indicates the signatures of the records can not be validated.
+	ErrDNSSECBogus = errors.New("dnssec: validation failed")
+	// ErrDNSSECNoTrustAnchor indicates the zone is not under any configured trust anchor.
+	ErrDNSSECNoTrustAnchor = errors.New("dnssec: no trust anchor for zone")
+	// ErrDNSNotFound indicates the name or the record type does not exist.
+	ErrDNSNotFound = errors.New("dns: record not found")
+)
+
+// TrustAnchor defines a DS record of a zone trusted without validation.
+type TrustAnchor struct {
+	Zone       string
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+// ParseTrustAnchor parses the trust anchor in the DS record presentation format, e.g.
+//
+//	example.com. 3600 IN DS 2371 13 2 1F987CC6583E92DF0890718C42...
+func ParseTrustAnchor(s string) (ta *TrustAnchor, err error) {
+	var fields = strings.Fields(s)
+	var i int
+	for i = 1; i < len(fields) && !strings.EqualFold(fields[i], "DS"); i++ {
+	}
+	if i+4 > len(fields) {
+		return nil, errors.Errorf("invalid trust anchor: %s", s)
+	}
+	ta = &TrustAnchor{Zone: fqdn(fields[0])}
+	var tag, alg, dt uint64
+	if tag, err = strconv.ParseUint(fields[i+1], 10, 16); err != nil {
+		return nil, errors.Wrapf(err, "invalid key tag of trust anchor: %s", s)
+	}
+	if alg, err = strconv.ParseUint(fields[i+2], 10, 8); err != nil {
+		return nil, errors.Wrapf(err, "invalid algorithm of trust anchor: %s", s)
+	}
+	if dt, err = strconv.ParseUint(fields[i+3], 10, 8); err != nil {
+		return nil, errors.Wrapf(err, "invalid digest type of trust anchor: %s", s)
+	}
+	if ta.Digest, err = hex.DecodeString(strings.Join(fields[i+4:], "")); err != nil {
+		return nil, errors.Wrapf(err, "invalid digest of trust anchor: %s", s)
+	}
+	ta.KeyTag, ta.Algorithm, ta.DigestType = uint16(tag), uint8(alg), uint8(dt)
+	return
+}
+
+// dnskey defines a parsed DNSKEY record.
+type dnskey struct {
+	Flags     uint16
+	Protocol  uint8
+	Algorithm uint8
+	PublicKey []byte
+	rdata     []byte
+}
+
+func parseDNSKEY(rdata []byte) (k *dnskey, err error) {
+	if len(rdata) < 4 {
+		return nil, errDNSMsgTruncated
+	}
+	return &dnskey{
+		Flags:     binary.BigEndian.Uint16(rdata),
+		Protocol:  rdata[2],
+		Algorithm: rdata[3],
+		PublicKey: rdata[4:],
+		rdata:     rdata,
+	}, nil
+}
+
+// keyTag computes the key tag of the DNSKEY rdata, see RFC 4034 Appendix B.
+func (k *dnskey) keyTag() uint16 {
+	var ac uint32
+	for i, b := range k.rdata {
+		if i&1 == 1 {
+			ac += uint32(b)
+		} else {
+			ac += uint32(b) << 8
+		}
+	}
+	ac += ac >> 16 & 0xffff
+	return uint16(ac & 0xffff)
+}
+
+// matchDS reports whether the key of the zone is referred by the DS record.
+func (k *dnskey) matchDS(zone string, ds *TrustAnchor) bool {
+	if k.Algorithm != ds.Algorithm || k.keyTag() != ds.KeyTag {
+		return false
+	}
+	var data = append(appendName(nil, zone), k.rdata...)
+	var digest []byte
+	switch ds.DigestType {
+	case dnssecDigestSHA1:
+		d := sha1.Sum(data)
+		digest = d[:]
+	case dnssecDigestSHA256:
+		d := sha256.Sum256(data)
+		digest = d[:]
+	case dnssecDigestSHA384:
+		d := sha512.Sum384(data)
+		digest = d[:]
+	default:
+		return false
+	}
+	return bytes.Equal(digest, ds.Digest)
+}
+
+func parseDS(zone string, rdata []byte) (ds *TrustAnchor, err error) {
+	if len(rdata) < 4 {
+		return nil, errDNSMsgTruncated
+	}
+	return &TrustAnchor{
+		Zone:       zone,
+		KeyTag:     binary.BigEndian.Uint16(rdata),
+		Algorithm:  rdata[2],
+		DigestType: rdata[3],
+		Digest:     rdata[4:],
+	}, nil
+}
+
+// rrsig defines a parsed RRSIG record.
+type rrsig struct {
+	TypeCovered uint16
+	Algorithm   uint8
+	Labels      uint8
+	OrigTTL     uint32
+	Expiration  uint32
+	Inception   uint32
+	KeyTag      uint16
+	SignerName  string
+	Signature   []byte
+}
+
+func parseRRSIG(rdata []byte) (sig *rrsig, err error) {
+	if len(rdata) < rrsigFixedLen+1 {
+		return nil, errDNSMsgTruncated
+	}
+	sig = &rrsig{
+		TypeCovered: binary.BigEndian.Uint16(rdata),
+		Algorithm:   rdata[2],
+		Labels:      rdata[3],
+		OrigTTL:     binary.BigEndian.Uint32(rdata[4:]),
+		Expiration:  binary.BigEndian.Uint32(rdata[8:]),
+		Inception:   binary.BigEndian.Uint32(rdata[12:]),
+		KeyTag:      binary.BigEndian.Uint16(rdata[16:]),
+	}
+	var off int
+	// the signer name is never compressed
+	if sig.SignerName, off, err = readName(rdata, rrsigFixedLen); err != nil {
+		return nil, err
+	}
+	sig.Signature = rdata[off:]
+	return
+}
+
+// signedData builds the data signed by the RRSIG over the RRset, see RFC 4034 Section 3.1.8.1.
+func (sig *rrsig) signedData(rrs []dnsRR) []byte {
+	var b = make([]byte, rrsigFixedLen, 512)
+	binary.BigEndian.PutUint16(b, sig.TypeCovered)
+	b[2], b[3] = sig.Algorithm, sig.Labels
+	binary.BigEndian.PutUint32(b[4:], sig.OrigTTL)
+	binary.BigEndian.PutUint32(b[8:], sig.Expiration)
+	binary.BigEndian.PutUint32(b[12:], sig.Inception)
+	binary.BigEndian.PutUint16(b[16:], sig.KeyTag)
+	b = appendName(b, sig.SignerName)
+
+	// the records are sorted by the canonical rdata, duplicates are removed
+	var sorted = make([]dnsRR, len(rrs))
+	copy(sorted, rrs)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i].Data, sorted[j].Data) < 0 })
+	for i, rr := range sorted {
+		if i > 0 && bytes.Equal(rr.Data, sorted[i-1].Data) {
+			continue
+		}
+		var owner = rr.Name
+		if labels := nameLabels(owner); int(sig.Labels) < len(labels) {
+			// expanded from a wildcard
+			owner = "*." + strings.Join(labels[len(labels)-int(sig.Labels):], ".")
+		}
+		b = appendName(b, owner)
+		var h [10]byte
+		binary.BigEndian.PutUint16(h[0:], rr.Type)
+		binary.BigEndian.PutUint16(h[2:], rr.Class)
+		binary.BigEndian.PutUint32(h[4:], sig.OrigTTL)
+		binary.BigEndian.PutUint16(h[8:], uint16(len(rr.Data)))
+		b = append(b, h[:]...)
+		b = append(b, rr.Data...)
+	}
+	return b
+}
+
+// verify checks the signature of the RRset by the keys of the signer zone.
+func (sig *rrsig) verify(rrs []dnsRR, keys []*dnskey, now time.Time) (err error) {
+	var ts = uint32(now.Unix())
+	if ts < sig.Inception || ts > sig.Expiration {
+		return errors.Wrapf(ErrDNSSECBogus, "signature of %s by %s out of validity period",
+			rrs[0].Name, sig.SignerName)
+	}
+	var data = sig.signedData(rrs)
+	for _, k := range keys {
+		if k.Algorithm != sig.Algorithm || k.keyTag() != sig.KeyTag {
+			continue
+		}
+		if err = verifySignature(k, data, sig.Signature); err == nil {
+			return
+		}
+	}
+	return errors.Wrapf(ErrDNSSECBogus, "no key of %s verifies the signature of %s",
+		sig.SignerName, rrs[0].Name)
+}
+
+func verifySignature(k *dnskey, data, signature []byte) (err error) {
+	switch k.Algorithm {
+	case dnssecAlgRSASHA256, dnssecAlgRSASHA512:
+		var pub *rsa.PublicKey
+		if pub, err = parseRSAPublicKey(k.PublicKey); err != nil {
+			return
+		}
+		if k.Algorithm == dnssecAlgRSASHA256 {
+			h := sha256.Sum256(data)
+			return rsa.VerifyPKCS1v15(pub, crypto.SHA256, h[:], signature)
+		}
+		h := sha512.Sum512(data)
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA512, h[:], signature)
+	case dnssecAlgECDSAP256SHA256, dnssecAlgECDSAP384SHA384:
+		var (
+			curve  = elliptic.P256()
+			digest []byte
+		)
+		if k.Algorithm == dnssecAlgECDSAP256SHA256 {
+			h := sha256.Sum256(data)
+			digest = h[:]
+		} else {
+			curve = elliptic.P384()
+			h := sha512.Sum384(data)
+			digest = h[:]
+		}
+		var size = (curve.Params().BitSize + 7) / 8
+		if len(k.PublicKey) != 2*size || len(signature) != 2*size {
+			return errors.New("invalid ecdsa key or signature length")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(k.PublicKey[:size]),
+			Y:     new(big.Int).SetBytes(k.PublicKey[size:]),
+		}
+		if !ecdsa.Verify(pub, digest,
+			new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])) {
+			return errors.New("invalid ecdsa signature")
+		}
+		return
+	case dnssecAlgED25519:
+		if len(k.PublicKey) != ed25519.PublicKeySize {
+			return errors.New("invalid ed25519 key length")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(k.PublicKey), data, signature) {
+			return errors.New("invalid ed25519 signature")
+		}
+		return
+	default:
+		return errors.Errorf("unsupported dnssec algorithm %d", k.Algorithm)
+	}
+}
+
+// parseRSAPublicKey parses the RSA public key in RFC 3110 format.
+func parseRSAPublicKey(key []byte) (pub *rsa.PublicKey, err error) {
+	if len(key) < 3 {
+		return nil, errDNSMsgTruncated
+	}
+	var (
+		elen = int(key[0])
+		off  = 1
+	)
+	if elen == 0 {
+		elen = int(binary.BigEndian.Uint16(key[1:]))
+		off = 3
+	}
+	if elen > 4 || off+elen >= len(key) {
+		return nil, errors.New("unsupported rsa public key exponent")
+	}
+	var e int
+	for _, b := range key[off : off+elen] {
+		e = e<<8 | int(b)
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(key[off+elen:]), E: e}, nil
+}
+
+// splitRRSet returns the records of the type owned by the name and the signatures covering them.
+func splitRRSet(rrs []dnsRR, name string, t uint16) (set []dnsRR, sigs []*rrsig) {
+	name = fqdn(name)
+	for _, rr := range rrs {
+		if rr.Name != name || rr.Class != dnsClassINET {
+			continue
+		}
+		switch rr.Type {
+		case t:
+			set = append(set, rr)
+		case dnsTypeRRSIG:
+			if sig, err := parseRRSIG(rr.Data); err == nil && sig.TypeCovered == t {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	return
+}
+
+type zoneKeys struct {
+	keys    []*dnskey
+	expires time.Time
+}
+
+// DNSSECValidator does the DNSSEC validating lookups, the chain of trust is built from the
+// configured trust anchors instead of the root zone.
+type DNSSECValidator struct {
+	// Enforced rejects the records outside the trust anchors, otherwise the lookups of them
+	// fallback to the non-validating lookup with a warning. The records under the trust anchors
+	// are always validated.
+	Enforced bool
+
+	anchors map[string][]*TrustAnchor
+	servers []string
+	query   func(name string, t uint16) (*dnsMsg, error)
+	now     func() time.Time
+
+	sync.Mutex
+	cache map[string]*zoneKeys
+}
+
+// NewDNSSECValidator returns a validator with the trust anchors and name servers of the DNS
+// seed config, the DoH resolver takes precedence over the name servers if configured, and the
+// system name servers are used if neither is configured.
+func NewDNSSECValidator(cfg *conf.DNSSeed) (v *DNSSECValidator, err error) {
+	v = &DNSSECValidator{
+		Enforced: cfg.EnforcedDNSSEC,
+		anchors:  make(map[string][]*TrustAnchor),
+		now:      time.Now,
+		cache:    make(map[string]*zoneKeys),
+	}
+	for _, s := range cfg.TrustAnchors {
+		var ta *TrustAnchor
+		if ta, err = ParseTrustAnchor(s); err != nil {
+			return nil, err
+		}
+		v.anchors[ta.Zone] = append(v.anchors[ta.Zone], ta)
+	}
+	if len(v.anchors) == 0 {
+		return nil, errors.Wrap(ErrDNSSECNoTrustAnchor, "no trust anchor configured")
+	}
+	if cfg.Resolver != "" {
+		var doh *DoHResolver
+		if doh, err = NewDoHResolver(cfg.Resolver); err != nil {
+			return nil, err
+		}
+		v.query = doh.query
+		return
+	}
+	for _, s := range cfg.DNSServers {
+		if _, _, err = net.SplitHostPort(s); err != nil {
+			s = net.JoinHostPort(s, "53")
+		}
+		v.servers = append(v.servers, s)
+	}
+	err = nil
+	if len(v.servers) == 0 {
+		if v.servers, err = systemDNSServers(); err != nil {
+			return nil, err
+		}
+	}
+	v.query = v.queryServers
+	return
+}
+
+func (v *DNSSECValidator) queryServers(name string, t uint16) (m *dnsMsg, err error) {
+	for _, s := range v.servers {
+		if m, err = exchangeDNS(s, name, t, DNSSECQueryTimeout); err == nil {
+			return
+		}
+	}
+	return
+}
+
+func (v *DNSSECValidator) underAnchor(zone string) bool {
+	for a := range v.anchors {
+		if isSubdomain(zone, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupAAAA returns the validated AAAA records of the host.
+func (v *DNSSECValidator) LookupAAAA(host string) (ips []net.IP, err error) {
+	var set []dnsRR
+	if set, err = v.lookup(host, dnsTypeAAAA); err != nil {
+		return
+	}
+	for _, rr := range set {
+		if len(rr.Data) != net.IPv6len {
+			return nil, errors.Wrapf(ErrDNSSECBogus, "invalid AAAA record of %s", host)
+		}
+		ips = append(ips, net.IP(rr.Data))
+	}
+	return
+}
+
+// LookupA returns the validated A records of the host.
+func (v *DNSSECValidator) LookupA(host string) (ips []net.IP, err error) {
+	var set []dnsRR
+	if set, err = v.lookup(host, dnsTypeA); err != nil {
+		return
+	}
+	for _, rr := range set {
+		if len(rr.Data) != net.IPv4len {
+			return nil, errors.Wrapf(ErrDNSSECBogus, "invalid A record of %s", host)
+		}
+		ips = append(ips, net.IP(rr.Data))
+	}
+	return
+}
+
+// LookupTXT returns the validated TXT records of the host, the character strings of each record
+// are concatenated.
+func (v *DNSSECValidator) LookupTXT(host string) (txts []string, err error) {
+	var set []dnsRR
+	if set, err = v.lookup(host, dnsTypeTXT); err != nil {
+		return
+	}
+	for _, rr := range set {
+		var txt string
+		if txt, err = txtData(rr.Data); err != nil {
+			return nil, errors.Wrapf(ErrDNSSECBogus, "invalid TXT record of %s", host)
+		}
+		txts = append(txts, txt)
+	}
+	return
+}
+
+// lookup returns the validated RRset of the type owned by the host. The names under the trust
+// anchors are expected to be signed, so the missing signatures or the unproven negative responses
+// are bogus, only the names outside the trust anchors are reported as unsigned.
+func (v *DNSSECValidator) lookup(host string, t uint16) (set []dnsRR, err error) {
+	if !v.underAnchor(host) {
+		return nil, errors.Wrapf(ErrDNSSECUnsigned, "lookup %s: no trust anchor", host)
+	}
+	var m *dnsMsg
+	if m, err = v.query(host, t); err != nil {
+		return
+	}
+	switch m.rcode() {
+	case dnsRcodeSuccess:
+	case dnsRcodeNXDomain:
+		return nil, v.verifyDenial(host, t, m)
+	default:
+		return nil, errors.Errorf("lookup %s failed with rcode %d", host, m.rcode())
+	}
+	set, sigs := splitRRSet(m.Answer, host, t)
+	if len(set) == 0 {
+		return nil, v.verifyDenial(host, t, m)
+	}
+	if len(sigs) == 0 {
+		return nil, errors.Wrapf(ErrDNSSECBogus, "lookup %s: signatures missing", host)
+	}
+	if err = v.verifyRRSet(host, set, sigs, 0); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// verifyRRSet verifies the RRset by any of the signatures from the validated zone keys.
+func (v *DNSSECValidator) verifyRRSet(name string, set []dnsRR, sigs []*rrsig, depth int) (err error) {
+	err = errors.Wrapf(ErrDNSSECBogus, "no valid signature of %s", name)
+	for _, sig := range sigs {
+		if !isSubdomain(name, sig.SignerName) || !v.underAnchor(sig.SignerName) {
+			continue
+		}
+		var keys []*dnskey
+		if keys, err = v.zoneKeys(sig.SignerName, depth+1); err != nil {
+			continue
+		}
+		if err = sig.verify(set, keys, v.now()); err == nil {
+			return
+		}
+	}
+	return
+}
+
+// zoneKeys returns the validated DNSKEYs of the zone, which are authenticated by the trust
+// anchor of the zone or by the DS records from the parent zone.
+func (v *DNSSECValidator) zoneKeys(zone string, depth int) (keys []*dnskey, err error) {
+	zone = fqdn(zone)
+	if depth > maxChainDepth {
+		return nil, errors.Wrapf(ErrDNSSECBogus, "chain of trust of %s too long", zone)
+	}
+	if !v.underAnchor(zone) {
+		return nil, errors.Wrapf(ErrDNSSECNoTrustAnchor, "zone %s", zone)
+	}
+	v.Lock()
+	zk, ok := v.cache[zone]
+	v.Unlock()
+	if ok && v.now().Before(zk.expires) {
+		return zk.keys, nil
+	}
+
+	// authenticate the delegation first
+	var ds = v.anchors[zone]
+	if len(ds) == 0 {
+		var m *dnsMsg
+		if m, err = v.query(zone, dnsTypeDS); err != nil {
+			return
+		}
+		set, sigs := splitRRSet(m.Answer, zone, dnsTypeDS)
+		if len(set) == 0 || len(sigs) == 0 {
+			return nil, errors.Wrapf(ErrDNSSECBogus, "no signed DS of %s", zone)
+		}
+		for _, sig := range sigs {
+			// the DS records are signed by the parent zone
+			if sig.SignerName == zone {
+				return nil, errors.Wrapf(ErrDNSSECBogus, "DS of %s signed by itself", zone)
+			}
+		}
+		if err = v.verifyRRSet(zone, set, sigs, depth); err != nil {
+			return
+		}
+		for _, rr := range set {
+			var d *TrustAnchor
+			if d, err = parseDS(zone, rr.Data); err != nil {
+				return
+			}
+			ds = append(ds, d)
+		}
+	}
+
+	var m *dnsMsg
+	if m, err = v.query(zone, dnsTypeDNSKEY); err != nil {
+		return
+	}
+	set, sigs := splitRRSet(m.Answer, zone, dnsTypeDNSKEY)
+	if len(set) == 0 || len(sigs) == 0 {
+		return nil, errors.Wrapf(ErrDNSSECBogus, "no signed DNSKEY of %s", zone)
+	}
+	var all, entry []*dnskey
+	for _, rr := range set {
+		var k *dnskey
+		if k, err = parseDNSKEY(rr.Data); err != nil {
+			return
+		}
+		if k.Flags&dnskeyFlagZone == 0 || k.Protocol != dnskeyProtocol {
+			continue
+		}
+		all = append(all, k)
+		for _, d := range ds {
+			if k.matchDS(zone, d) {
+				entry = append(entry, k)
+				break
+			}
+		}
+	}
+	if len(entry) == 0 {
+		return nil, errors.Wrapf(ErrDNSSECBogus, "no DNSKEY of %s matches the DS", zone)
+	}
+	// the DNSKEY RRset must be signed by a key referred by the DS
+	err = errors.Wrapf(ErrDNSSECBogus, "DNSKEY of %s not signed by the entry key", zone)
+	for _, sig := range sigs {
+		if sig.SignerName != zone {
+			continue
+		}
+		if err = sig.verify(set, entry, v.now()); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return
+	}
+	v.Lock()
+	v.cache[zone] = &zoneKeys{keys: all, expires: v.now().Add(DNSSECKeyCacheTTL)}
+	v.Unlock()
+	return all, nil
+}
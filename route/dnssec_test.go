@@ -0,0 +1,350 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/conf"
+)
+
+type testZoneKey struct {
+	priv *ecdsa.PrivateKey
+	key  *dnskey
+}
+
+func newTestZoneKey() (k *testZoneKey, err error) {
+	var priv *ecdsa.PrivateKey
+	if priv, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		return
+	}
+	var rdata = make([]byte, 4+64)
+	binary.BigEndian.PutUint16(rdata, dnskeyFlagZone|1)
+	rdata[2], rdata[3] = dnskeyProtocol, dnssecAlgECDSAP256SHA256
+	putBigInt(rdata[4:36], priv.X)
+	putBigInt(rdata[36:], priv.Y)
+	k = &testZoneKey{priv: priv}
+	k.key, err = parseDNSKEY(rdata)
+	return
+}
+
+func putBigInt(buf []byte, i *big.Int) {
+	b := i.Bytes()
+	copy(buf[len(buf)-len(b):], b)
+}
+
+func (k *testZoneKey) ds(zone string) []byte {
+	var digest = sha256.Sum256(append(appendName(nil, zone), k.key.rdata...))
+	var rdata = make([]byte, 4, 4+len(digest))
+	binary.BigEndian.PutUint16(rdata, k.key.keyTag())
+	rdata[2], rdata[3] = dnssecAlgECDSAP256SHA256, dnssecDigestSHA256
+	return append(rdata, digest[:]...)
+}
+
+func (k *testZoneKey) sign(signer string, rrs []dnsRR, inception, expiration time.Time) dnsRR {
+	var sig = &rrsig{
+		TypeCovered: rrs[0].Type,
+		Algorithm:   dnssecAlgECDSAP256SHA256,
+		Labels:      uint8(len(nameLabels(rrs[0].Name))),
+		OrigTTL:     rrs[0].TTL,
+		Expiration:  uint32(expiration.Unix()),
+		Inception:   uint32(inception.Unix()),
+		KeyTag:      k.key.keyTag(),
+		SignerName:  fqdn(signer),
+	}
+	var digest = sha256.Sum256(sig.signedData(rrs))
+	r, s, err := ecdsa.Sign(rand.Reader, k.priv, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	var signature = make([]byte, 64)
+	putBigInt(signature[:32], r)
+	putBigInt(signature[32:], s)
+	return dnsRR{
+		Name:  rrs[0].Name,
+		Type:  dnsTypeRRSIG,
+		Class: dnsClassINET,
+		TTL:   rrs[0].TTL,
+		// the signed data starts with the rdata of the RRSIG record without the signature
+		Data: append(sig.signedData(nil), signature...),
+	}
+}
+
+type testZone struct {
+	sync.Mutex
+	msgs    map[string]*dnsMsg
+	queries int
+}
+
+func (z *testZone) set(name string, t uint16, rrs ...dnsRR) {
+	z.msgs[fmt.Sprintf("%s/%d", fqdn(name), t)] = &dnsMsg{Answer: rrs}
+}
+
+func (z *testZone) deny(name string, t uint16, nx bool, authority ...dnsRR) {
+	var m = &dnsMsg{Authority: authority}
+	if nx {
+		m.Flags = dnsRcodeNXDomain
+	}
+	z.msgs[fmt.Sprintf("%s/%d", fqdn(name), t)] = m
+}
+
+func (z *testZone) query(name string, t uint16) (*dnsMsg, error) {
+	z.Lock()
+	defer z.Unlock()
+	z.queries++
+	if m, ok := z.msgs[fmt.Sprintf("%s/%d", fqdn(name), t)]; ok {
+		return m, nil
+	}
+	return &dnsMsg{Flags: dnsRcodeNXDomain}, nil
+}
+
+func testRR(name string, t uint16, data []byte) dnsRR {
+	return dnsRR{Name: fqdn(name), Type: t, Class: dnsClassINET, TTL: 3600, Data: data}
+}
+
+func testTypeBitmap(types ...uint16) []byte {
+	var b = make([]byte, 2+32)
+	for _, t := range types {
+		b[2+t/8] |= 0x80 >> (t % 8)
+	}
+	var l = 32
+	for l > 1 && b[1+l] == 0 {
+		l--
+	}
+	b[1] = byte(l)
+	return b[:2+l]
+}
+
+func testNSEC(owner, next string, types ...uint16) dnsRR {
+	return testRR(owner, dnsTypeNSEC, append(appendName(nil, fqdn(next)), testTypeBitmap(types...)...))
+}
+
+// testNSEC3Chain returns the NSEC3 chain of the names in the zone, the types are set to the
+// records of every name.
+func testNSEC3Chain(zone string, salt []byte, iterations uint16, names []string, types ...uint16) (rrs []dnsRR) {
+	var hashes [][]byte
+	for _, n := range names {
+		hashes = append(hashes, nsec3Hash(n, salt, iterations))
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i], hashes[j]) < 0 })
+	for i, h := range hashes {
+		var rdata = []byte{nsec3HashSHA1, 0, byte(iterations >> 8), byte(iterations), byte(len(salt))}
+		rdata = append(rdata, salt...)
+		rdata = append(rdata, byte(len(h)))
+		rdata = append(rdata, hashes[(i+1)%len(hashes)]...)
+		rdata = append(rdata, testTypeBitmap(types...)...)
+		owner := strings.ToLower(nsec3Encoding.EncodeToString(h)) + "." + zone
+		rrs = append(rrs, testRR(owner, dnsTypeNSEC3, rdata))
+	}
+	return
+}
+
+func TestDNSSECValidator(t *testing.T) {
+	Convey("Given a signed seed zone delegated from the trust anchor", t, func() {
+		var (
+			now   = time.Now()
+			inc   = now.Add(-time.Hour)
+			exp   = now.Add(time.Hour)
+			ip    = net.ParseIP("2001:db8::1")
+			host  = "00.id.bp00.seed.test"
+			zone  = &testZone{msgs: make(map[string]*dnsMsg)}
+			err   error
+			root  *testZoneKey
+			child *testZoneKey
+		)
+		root, err = newTestZoneKey()
+		So(err, ShouldBeNil)
+		child, err = newTestZoneKey()
+		So(err, ShouldBeNil)
+
+		rootKeys := []dnsRR{testRR("seed.test", dnsTypeDNSKEY, root.key.rdata)}
+		zone.set("seed.test", dnsTypeDNSKEY, append(rootKeys, root.sign("seed.test", rootKeys, inc, exp))...)
+		childDS := []dnsRR{testRR("bp00.seed.test", dnsTypeDS, child.ds("bp00.seed.test."))}
+		zone.set("bp00.seed.test", dnsTypeDS, append(childDS, root.sign("seed.test", childDS, inc, exp))...)
+		childKeys := []dnsRR{testRR("bp00.seed.test", dnsTypeDNSKEY, child.key.rdata)}
+		zone.set("bp00.seed.test", dnsTypeDNSKEY,
+			append(childKeys, child.sign("bp00.seed.test", childKeys, inc, exp))...)
+		records := []dnsRR{testRR(host, dnsTypeAAAA, ip)}
+		zone.set(host, dnsTypeAAAA, append(records, child.sign("bp00.seed.test", records, inc, exp))...)
+
+		anchor := fmt.Sprintf("seed.test. 3600 IN DS %d 13 2 %X",
+			root.key.keyTag(), root.ds("seed.test.")[4:])
+		v, err := NewDNSSECValidator(&conf.DNSSeed{
+			TrustAnchors: []string{anchor},
+			DNSServers:   []string{"127.0.0.1"},
+		})
+		So(err, ShouldBeNil)
+		So(v.servers, ShouldResemble, []string{"127.0.0.1:53"})
+		v.query = zone.query
+
+		Convey("The signed records should be validated", func() {
+			ips, err := v.LookupAAAA(host)
+			So(err, ShouldBeNil)
+			So(ips, ShouldHaveLength, 1)
+			So(ips[0].Equal(ip), ShouldBeTrue)
+
+			// the zone keys are cached
+			queries := zone.queries
+			_, err = v.LookupAAAA(host)
+			So(err, ShouldBeNil)
+			So(zone.queries, ShouldEqual, queries+1)
+		})
+		signed := func(rrs ...dnsRR) (out []dnsRR) {
+			for _, rr := range rrs {
+				out = append(out, rr, child.sign("bp00.seed.test", []dnsRR{rr}, inc, exp))
+			}
+			return
+		}
+		Convey("The missing records proven by NSEC should be reported as not found", func() {
+			missing := "05.id.bp00.seed.test"
+			zone.deny(missing, dnsTypeAAAA, true, signed(
+				testNSEC("bp00.seed.test", host, dnsTypeSOA, dnsTypeNS, dnsTypeDNSKEY, dnsTypeNSEC),
+				testNSEC(host, "bp00.seed.test", dnsTypeAAAA, dnsTypeRRSIG, dnsTypeNSEC),
+			)...)
+			_, err := v.LookupAAAA(missing)
+			So(errors.Cause(err), ShouldEqual, ErrDNSNotFound)
+
+			zone.deny(host, dnsTypeTXT, false, signed(
+				testNSEC(host, "bp00.seed.test", dnsTypeAAAA, dnsTypeRRSIG, dnsTypeNSEC))...)
+			_, err = v.LookupTXT(host)
+			So(errors.Cause(err), ShouldEqual, ErrDNSNotFound)
+
+			// the NSEC of the existing type proves nothing
+			zone.deny(host, dnsTypeAAAA, false, signed(
+				testNSEC(host, "bp00.seed.test", dnsTypeAAAA, dnsTypeRRSIG, dnsTypeNSEC))...)
+			_, err = v.LookupAAAA(host)
+			So(errors.Cause(err), ShouldEqual, ErrDNSSECBogus)
+
+			// the wildcard of the closest encloser is not denied
+			zone.deny(missing, dnsTypeAAAA, true, signed(
+				testNSEC(host, "bp00.seed.test", dnsTypeAAAA, dnsTypeRRSIG, dnsTypeNSEC))...)
+			_, err = v.LookupAAAA(missing)
+			So(errors.Cause(err), ShouldEqual, ErrDNSSECBogus)
+		})
+		Convey("The missing records proven by NSEC3 should be reported as not found", func() {
+			missing := "05.id.bp00.seed.test"
+			chain := testNSEC3Chain("bp00.seed.test.", []byte{0xab}, 2,
+				[]string{"bp00.seed.test", "id.bp00.seed.test", host}, dnsTypeAAAA, dnsTypeRRSIG)
+			zone.deny(missing, dnsTypeAAAA, true, signed(chain...)...)
+			_, err := v.LookupAAAA(missing)
+			So(errors.Cause(err), ShouldEqual, ErrDNSNotFound)
+
+			zone.deny(host, dnsTypeTXT, false, signed(chain...)...)
+			_, err = v.LookupTXT(host)
+			So(errors.Cause(err), ShouldEqual, ErrDNSNotFound)
+
+			// the unsigned chain proves nothing
+			zone.deny(missing, dnsTypeAAAA, true, chain...)
+			_, err = v.LookupAAAA(missing)
+			So(errors.Cause(err), ShouldEqual, ErrDNSSECBogus)
+		})
+		Convey("The forged negative responses should be rejected", func() {
+			_, err := v.LookupAAAA("05.id.bp00.seed.test")
+			So(errors.Cause(err), ShouldEqual, ErrDNSSECBogus)
+			zone.deny(host, dnsTypeAAAA, false)
+			_, err = v.LookupAAAA(host)
+			So(errors.Cause(err), ShouldEqual, ErrDNSSECBogus)
+		})
+		Convey("The stripped signatures under the trust anchor should be rejected", func() {
+			zone.set(host, dnsTypeAAAA, records...)
+			_, err := v.LookupAAAA(host)
+			So(errors.Cause(err), ShouldEqual, ErrDNSSECBogus)
+
+			var (
+				isc  = IPv6SeedClient{Validator: v}
+				verr error
+				mu   sync.Mutex
+			)
+			So(v.Enforced, ShouldBeFalse)
+			So(isc.validationFallback(host, err, &verr, &mu), ShouldBeFalse)
+			So(errors.Cause(verr), ShouldEqual, ErrDNSSECBogus)
+		})
+		Convey("The records outside the trust anchor should fallback if not enforced", func() {
+			var (
+				isc  = IPv6SeedClient{Validator: v}
+				verr error
+				mu   sync.Mutex
+			)
+			_, err := v.LookupAAAA("00.id.bp00.other.test")
+			So(errors.Cause(err), ShouldEqual, ErrDNSSECUnsigned)
+			So(isc.validationFallback(host, err, &verr, &mu), ShouldBeTrue)
+			v.Enforced = true
+			So(isc.validationFallback(host, err, &verr, &mu), ShouldBeFalse)
+			So(errors.Cause(verr), ShouldEqual, ErrDNSSECUnsigned)
+		})
+		Convey("The tampered records should be rejected", func() {
+			sig := child.sign("bp00.seed.test", records, inc, exp)
+			zone.set(host, dnsTypeAAAA, testRR(host, dnsTypeAAAA, net.ParseIP("2001:db8::2")), sig)
+			_, err := v.LookupAAAA(host)
+			So(errors.Cause(err), ShouldEqual, ErrDNSSECBogus)
+		})
+		Convey("The expired signatures should be rejected", func() {
+			sig := child.sign("bp00.seed.test", records, inc.Add(-time.Hour), inc)
+			zone.set(host, dnsTypeAAAA, append(records, sig)...)
+			_, err := v.LookupAAAA(host)
+			So(errors.Cause(err), ShouldEqual, ErrDNSSECBogus)
+		})
+		Convey("The delegation not matching the parent DS should be rejected", func() {
+			other, err := newTestZoneKey()
+			So(err, ShouldBeNil)
+			otherKeys := []dnsRR{testRR("bp00.seed.test", dnsTypeDNSKEY, other.key.rdata)}
+			zone.set("bp00.seed.test", dnsTypeDNSKEY,
+				append(otherKeys, other.sign("bp00.seed.test", otherKeys, inc, exp))...)
+			sig := other.sign("bp00.seed.test", records, inc, exp)
+			zone.set(host, dnsTypeAAAA, append(records, sig)...)
+			_, err = v.LookupAAAA(host)
+			So(errors.Cause(err), ShouldEqual, ErrDNSSECBogus)
+		})
+		Convey("The seed client should report the validation failure", func() {
+			zone.set(host, dnsTypeAAAA, testRR(host, dnsTypeAAAA, net.ParseIP("2001:db8::2")),
+				child.sign("bp00.seed.test", records, inc, exp))
+			var (
+				isc  = IPv6SeedClient{Validator: v}
+				verr error
+				mu   sync.Mutex
+			)
+			_, err := v.LookupAAAA(host)
+			So(err, ShouldNotBeNil)
+			So(isc.validationFallback(host, err, &verr, &mu), ShouldBeFalse)
+			So(errors.Cause(verr), ShouldEqual, ErrDNSSECBogus)
+		})
+	})
+	Convey("Invalid trust anchors should be rejected", t, func() {
+		_, err := ParseTrustAnchor("seed.test. IN DS 2371 13")
+		So(err, ShouldNotBeNil)
+		_, err = ParseTrustAnchor("seed.test. IN DS 2371 13 2 XYZ")
+		So(err, ShouldNotBeNil)
+		_, err = NewDNSSECValidator(&conf.DNSSeed{EnforcedDNSSEC: true})
+		So(errors.Cause(err), ShouldEqual, ErrDNSSECNoTrustAnchor)
+	})
+}
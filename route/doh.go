@@ -0,0 +1,174 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	dohMediaType = "application/dns-message"
+	// dohMaxMsgSize is the max size of a DNS message over https.
+	dohMaxMsgSize = 65535
+)
+
+var (
+	// DoHQueryTimeout is the timeout of a single DNS-over-HTTPS query.
+	DoHQueryTimeout = 5 * time.Second
+)
+
+// DoHResolver resolves the seed records with DNS-over-HTTPS (RFC 8484), which works even if the
+// port 53 is blocked or hijacked.
+type DoHResolver struct {
+	// URL is the endpoint of the DoH server, e.g. https://1.1.1.1/dns-query.
+	URL string
+	// Client sends the queries, a client with DoHQueryTimeout is used if nil.
+	Client *http.Client
+}
+
+// NewDoHResolver returns the resolver of the https endpoint.
+func NewDoHResolver(endpoint string) (r *DoHResolver, err error) {
+	var u *url.URL
+	if u, err = url.Parse(endpoint); err != nil {
+		return nil, errors.Wrapf(err, "parse DoH endpoint %s failed", endpoint)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, errors.Errorf("invalid DoH endpoint: %s, an https url is required", endpoint)
+	}
+	r = &DoHResolver{
+		URL:    u.String(),
+		Client: &http.Client{Timeout: DoHQueryTimeout},
+	}
+	return
+}
+
+// LookupIP implements SeedResolver.LookupIP, it returns the AAAA records of the host, which are
+// validated by the DoH server if the zone is signed.
+func (r *DoHResolver) LookupIP(ctx context.Context, host string) (ips []net.IP, err error) {
+	var set []dnsRR
+	if set, err = r.lookup(ctx, host, dnsTypeAAAA); err != nil {
+		return
+	}
+	for _, rr := range set {
+		if len(rr.Data) != net.IPv6len {
+			return nil, errors.Errorf("invalid AAAA record of %s", host)
+		}
+		ips = append(ips, net.IP(rr.Data))
+	}
+	return
+}
+
+// LookupTXT implements SeedResolver.LookupTXT, the character strings of each record are
+// concatenated.
+func (r *DoHResolver) LookupTXT(ctx context.Context, host string) (txts []string, err error) {
+	var set []dnsRR
+	if set, err = r.lookup(ctx, host, dnsTypeTXT); err != nil {
+		return
+	}
+	for _, rr := range set {
+		var txt string
+		if txt, err = txtData(rr.Data); err != nil {
+			return nil, errors.Wrapf(err, "invalid TXT record of %s", host)
+		}
+		txts = append(txts, txt)
+	}
+	return
+}
+
+// lookup returns the records of the type in the answer, the CNAME chain is already followed by
+// the DoH server.
+func (r *DoHResolver) lookup(ctx context.Context, host string, t uint16) (set []dnsRR, err error) {
+	var m *dnsMsg
+	if m, err = r.exchange(ctx, host, t, dnsFlagRD); err != nil {
+		return
+	}
+	switch m.rcode() {
+	case dnsRcodeSuccess:
+	case dnsRcodeNXDomain:
+		return nil, errors.Wrapf(ErrDNSNotFound, "lookup %s", host)
+	default:
+		return nil, errors.Errorf("lookup %s failed with rcode %d", host, m.rcode())
+	}
+	for _, rr := range m.Answer {
+		if rr.Type == t && rr.Class == dnsClassINET {
+			set = append(set, rr)
+		}
+	}
+	if len(set) == 0 {
+		return nil, errors.Wrapf(ErrDNSNotFound, "lookup %s", host)
+	}
+	return
+}
+
+// query fetches the raw records and signatures for the DNSSEC validation.
+func (r *DoHResolver) query(name string, t uint16) (*dnsMsg, error) {
+	return r.exchange(context.Background(), name, t, dnsFlagRD|dnsFlagCD)
+}
+
+func (r *DoHResolver) exchange(ctx context.Context, name string, t uint16, flags uint16) (m *dnsMsg, err error) {
+	var (
+		// the message id should be 0 for the http cache friendliness, see RFC 8484 4.1
+		query  = buildDNSQuery(0, name, t, flags)
+		client = r.Client
+		req    *http.Request
+		resp   *http.Response
+		body   []byte
+	)
+	if client == nil {
+		client = &http.Client{Timeout: DoHQueryTimeout}
+	}
+	if req, err = http.NewRequest(http.MethodPost, r.URL, bytes.NewReader(query)); err != nil {
+		return
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", dohMediaType)
+	req.Header.Set("Accept", dohMediaType)
+	if resp, err = client.Do(req); err != nil {
+		return nil, errors.Wrapf(err, "DoH query %s failed", name)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("DoH query %s failed with status: %s", name, resp.Status)
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != dohMediaType {
+		return nil, errors.Errorf("DoH query %s got unexpected content type: %s",
+			name, resp.Header.Get("Content-Type"))
+	}
+	if body, err = ioutil.ReadAll(&io.LimitedReader{R: resp.Body, N: dohMaxMsgSize + 1}); err != nil {
+		return nil, errors.Wrapf(err, "read DoH response of %s failed", name)
+	}
+	if len(body) > dohMaxMsgSize {
+		return nil, errors.Errorf("DoH response of %s too large", name)
+	}
+	if m, err = parseDNSMsg(body); err != nil {
+		return
+	}
+	if m.ID != 0 || m.Flags&dnsFlagQR == 0 {
+		return nil, errDNSMsgMismatch
+	}
+	return
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// packTestDNSResp packs the response of the query with the answers.
+func packTestDNSResp(query []byte, rcode uint16, answers ...dnsRR) []byte {
+	_, off, err := readName(query, dnsHeaderLen)
+	if err != nil {
+		panic(err)
+	}
+	var b = make([]byte, dnsHeaderLen, 512)
+	copy(b, query[:4])
+	binary.BigEndian.PutUint16(b[2:], binary.BigEndian.Uint16(query[2:])|dnsFlagQR|rcode)
+	binary.BigEndian.PutUint16(b[4:], 1)
+	binary.BigEndian.PutUint16(b[6:], uint16(len(answers)))
+	b = append(b, query[dnsHeaderLen:off+4]...)
+	for _, rr := range answers {
+		b = appendName(b, rr.Name)
+		var fixed = make([]byte, 10)
+		binary.BigEndian.PutUint16(fixed, rr.Type)
+		binary.BigEndian.PutUint16(fixed[2:], rr.Class)
+		binary.BigEndian.PutUint32(fixed[4:], rr.TTL)
+		binary.BigEndian.PutUint16(fixed[8:], uint16(len(rr.Data)))
+		b = append(append(b, fixed...), rr.Data...)
+	}
+	return b
+}
+
+func TestDoHResolver(t *testing.T) {
+	Convey("Given a DoH server", t, func() {
+		var (
+			ip      = net.ParseIP("2001:db8::1")
+			records = map[string][]dnsRR{
+				fmt.Sprintf("00.id.seed.test./%d", dnsTypeAAAA): {
+					// the CNAME chain followed by the server
+					testRR("00.id.seed.test", 5, appendName(nil, "alias.seed.test")),
+					testRR("alias.seed.test", dnsTypeAAAA, ip),
+				},
+				fmt.Sprintf("id.seed.test./%d", dnsTypeTXT): {
+					testRR("id.seed.test", dnsTypeTXT, []byte("\x0300:\x04abcd")),
+				},
+			}
+			// flags of the last query
+			flags uint32
+		)
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.Header.Get("Content-Type") != dohMediaType {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			query, _ := ioutil.ReadAll(r.Body)
+			name, off, err := readName(query, dnsHeaderLen)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			atomic.StoreUint32(&flags, uint32(binary.BigEndian.Uint16(query[2:])))
+			w.Header().Set("Content-Type", dohMediaType)
+			key := fmt.Sprintf("%s/%d", name, binary.BigEndian.Uint16(query[off:]))
+			if rrs, ok := records[key]; ok {
+				_, _ = w.Write(packTestDNSResp(query, dnsRcodeSuccess, rrs...))
+			} else {
+				_, _ = w.Write(packTestDNSResp(query, dnsRcodeNXDomain))
+			}
+		}))
+		defer srv.Close()
+
+		r, err := NewDoHResolver(srv.URL + "/dns-query")
+		So(err, ShouldBeNil)
+		r.Client = srv.Client()
+
+		Convey("The AAAA records should be resolved over https", func() {
+			ips, err := r.LookupIP(context.Background(), "00.id.seed.test")
+			So(err, ShouldBeNil)
+			So(ips, ShouldHaveLength, 1)
+			So(ips[0].Equal(ip), ShouldBeTrue)
+			// the server validates the records
+			So(atomic.LoadUint32(&flags)&uint32(dnsFlagCD) == 0, ShouldBeTrue)
+		})
+		Convey("The TXT records should be resolved over https", func() {
+			txts, err := r.LookupTXT(context.Background(), "id.seed.test")
+			So(err, ShouldBeNil)
+			So(txts, ShouldResemble, []string{"00:abcd"})
+		})
+		Convey("The missing records should be reported as not found", func() {
+			_, err := r.LookupIP(context.Background(), "01.id.seed.test")
+			So(errors.Cause(err), ShouldEqual, ErrDNSNotFound)
+			So(isNotFound(err), ShouldBeTrue)
+		})
+		Convey("The raw records should be queried with checking disabled", func() {
+			m, err := r.query("00.id.seed.test", dnsTypeAAAA)
+			So(err, ShouldBeNil)
+			So(m.Answer, ShouldHaveLength, 2)
+			So(atomic.LoadUint32(&flags)&uint32(dnsFlagCD) != 0, ShouldBeTrue)
+		})
+	})
+	Convey("Only https endpoints should be accepted", t, func() {
+		_, err := NewDoHResolver("http://1.1.1.1/dns-query")
+		So(err, ShouldNotBeNil)
+		_, err = NewDoHResolver("1.1.1.1")
+		So(err, ShouldNotBeNil)
+		r, err := NewDoHResolver("https://1.1.1.1/dns-query")
+		So(err, ShouldBeNil)
+		So(r.URL, ShouldEqual, "https://1.1.1.1/dns-query")
+	})
+}
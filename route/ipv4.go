@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// ToIPv4 encodes the data to 4 bytes chunks as the A records, it's the fallback encoding of the
+// seed records for the resolvers which strip the AAAA records.
+func ToIPv4(in []byte) (ips []net.IP, err error) {
+	if len(in)%net.IPv4len != 0 {
+		return nil, errors.New("must be n * 4 length")
+	}
+	ipCount := len(in) / net.IPv4len
+	ips = make([]net.IP, ipCount)
+	for i := 0; i < ipCount; i++ {
+		ips[i] = make(net.IP, net.IPv4len)
+		copy(ips[i], in[i*net.IPv4len:(i+1)*net.IPv4len])
+	}
+	return
+}
+
+// FromIPv4 decodes the data from the 4 bytes chunks.
+func FromIPv4(ips []net.IP) (out []byte, err error) {
+	out = make([]byte, 0, len(ips)*net.IPv4len)
+	for _, ip := range ips {
+		ip4 := ip.To4()
+		if ip4 == nil {
+			return nil, errors.Errorf("not an IPv4 address: %s", ip)
+		}
+		out = append(out, ip4...)
+	}
+	return
+}
+
+// FromIPv4Domain decodes the data from the indexed A records of the domain, the records are
+// named the same as the AAAA records, see FromDomain.
+func FromIPv4Domain(domain string, f func(host string) ([]net.IP, error)) (out []byte, err error) {
+	return fromIPDomain(domain, f, net.IPv4len)
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/pow/cpuminer"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestIPv4(t *testing.T) {
+	Convey("data should be encoded to IPv4 chunks", t, func() {
+		_, err := ToIPv4([]byte("aa"))
+		So(err, ShouldNotBeNil)
+		in := []byte("从前有座山の里有座庙")
+		ips, err := ToIPv4(in)
+		So(err, ShouldBeNil)
+		So(ips, ShouldHaveLength, len(in)/net.IPv4len)
+		out, err := FromIPv4(ips)
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, in)
+		_, err = FromIPv4([]net.IP{net.ParseIP("::1")})
+		So(err, ShouldNotBeNil)
+	})
+	Convey("seed should fallback to A records if AAAA records are stripped", t, func() {
+		var pub asymmetric.PublicKey
+		pubKeyBytes, _ := hex.DecodeString("02c76216704d797c64c58bc11519fb68582e8e63de7e5b3b2dbbbe8733efe5fd24")
+		So(pub.UnmarshalBinary(pubKeyBytes), ShouldBeNil)
+		node := proto.Node{
+			ID:        proto.NodeID("00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9"),
+			Addr:      "127.0.0.1:3122",
+			PublicKey: &pub,
+			Nonce:     cpuminer.Uint256{A: 313283},
+		}
+		out, err := (&IPv6SeedClient{}).GenBPIPv6Zone(&node, "seed.test", ZoneOptions{IPv4: true})
+		So(err, ShouldBeNil)
+		resolver := &testSeedResolver{zone: make(map[string][]net.IP), lookups: make(map[string]int)}
+		var aaaa, a int
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			fields := strings.Fields(line)
+			So(fields, ShouldHaveLength, 5)
+			if fields[3] == "AAAA" {
+				aaaa++
+				continue
+			}
+			a++
+			resolver.zone[fields[0]] = append(resolver.zone[fields[0]], net.ParseIP(fields[4]))
+		}
+		So(aaaa, ShouldBeGreaterThan, 0)
+		So(a, ShouldEqual, aaaa*4)
+
+		isc := IPv6SeedClient{Resolver: resolver, Timeout: time.Second}
+		m, err := isc.GetBPFromDNSSeed("seed.test")
+		So(err, ShouldBeNil)
+		So(m, ShouldHaveLength, 1)
+		So(m[*node.ID.ToRawNodeID()].Addr, ShouldEqual, node.Addr)
+		So(m[*node.ID.ToRawNodeID()].Nonce, ShouldResemble, node.Nonce)
+	})
+}
@@ -32,10 +32,16 @@ func FromIPv6(ips []net.IP) (out []byte, err error) {
 }
 
 func FromDomain(domain string, f func(host string) ([]net.IP, error)) (out []byte, err error) {
+	return fromIPDomain(domain, f, net.IPv6len)
+}
+
+// fromIPDomain decodes the data from the indexed IP chunks of the domain, size is the IP length
+// of the chunks, the IPs of the other family are ignored.
+func fromIPDomain(domain string, f func(host string) ([]net.IP, error), size int) (out []byte, err error) {
 	concurrentNum := 5
 	retryCount := 3
 
-	allIPv6 := make([]net.IP, 0, 4)
+	allIP := make([]net.IP, 0, 4)
 
 	var ipsErr error
 	var ipsArray [][]net.IP
@@ -80,14 +86,15 @@ func FromDomain(domain string, f func(host string) ([]net.IP, error)) (out []byt
 				if len(ips) == 0 {
 					return nil, errors.New("empty IP list")
 				}
-				if len(ips[0]) != net.IPv6len {
-					return nil, errors.Errorf("unexpected IP: %s", ips[0])
+				ip := chunkIP(ips, size)
+				if ip == nil {
+					return nil, errors.Wrapf(ErrDNSNotFound, "unexpected IP: %s", ips[0])
 				}
-				allIPv6 = append(allIPv6, ips[0])
+				allIP = append(allIP, ip)
 			}
 		}
 
-		if len(allIPv6) != 0 {
+		if len(allIP) != 0 {
 
 			if successCount < int32(concurrentNum) {
 				break
@@ -97,9 +104,27 @@ func FromDomain(domain string, f func(host string) ([]net.IP, error)) (out []byt
 		}
 	}
 
-	out, err = FromIPv6(allIPv6)
+	if size == net.IPv4len {
+		out, err = FromIPv4(allIP)
+	} else {
+		out, err = FromIPv6(allIP)
+	}
 	if err != nil {
-		return nil, errors.Errorf("convert from IPv6 failed: %v", err)
+		return nil, errors.Errorf("convert from IP failed: %v", err)
 	}
 	return
 }
+
+// chunkIP returns the first IP of the chunk size in ips, nil if not found.
+func chunkIP(ips []net.IP, size int) net.IP {
+	for _, ip := range ips {
+		if size == net.IPv4len {
+			if ip4 := ip.To4(); ip4 != nil {
+				return ip4
+			}
+		} else if len(ip) == net.IPv6len && ip.To4() == nil {
+			return ip
+		}
+	}
+	return nil
+}
@@ -17,16 +17,21 @@
 package route
 
 import (
+	"context"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/SQLess/SQLess/crypto"
 	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
 	"github.com/SQLess/SQLess/pow/cpuminer"
 	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/utils/log"
 )
 
 const (
@@ -38,42 +43,268 @@ const (
 	NONCE = "n."
 	// ADDR is address
 	ADDR = "addr."
+	// SIG is the signature of the other fields by the BP private key
+	SIG = "sig."
+
+	// MaxSeedBPCount is the max BP count of a seed domain with the indexed scheme.
+	MaxSeedBPCount = 100
+)
+
+var (
+	// DefaultSeedLookupTimeout is the default timeout of each seed record lookup.
+	DefaultSeedLookupTimeout = 10 * time.Second
+
+	// ErrSeedUnsigned indicates the seed records have no signature record while it is required.
+	ErrSeedUnsigned = errors.New("seed records are not signed")
 )
 
 // IPv6SeedClient is IPv6 DNS seed client
-type IPv6SeedClient struct{}
+type IPv6SeedClient struct {
+	// Validator validates the seed records with DNSSEC if not nil, the zero value client uses
+	// the system resolver without validation.
+	Validator *DNSSECValidator
+	// Encoding is the preferred encoding of the seed records, the TXT encoding falls back to
+	// AAAA if the TXT records are absent, and AAAA falls back to A if no AAAA record resolves.
+	Encoding SeedEncoding
+	// Resolver resolves the seed records, the system resolver is used if nil.
+	Resolver SeedResolver
+	// Timeout is the timeout of each lookup, DefaultSeedLookupTimeout is used if not set.
+	Timeout time.Duration
+	// PrivateKey signs the generated seed records of the BP with the same public key, the
+	// signature is published as the SIG record.
+	PrivateKey *asymmetric.PrivateKey
+	// RequireSignature rejects the seed records without the SIG record, the SIG record is always
+	// verified if present.
+	RequireSignature bool
+}
+
+// SeedEncoding defines the encoding of the node info in the seed records.
+type SeedEncoding int
+
+const (
+	// SeedEncodingAAAA encodes the node info in 16 bytes chunks as the AAAA records.
+	SeedEncodingAAAA SeedEncoding = iota
+	// SeedEncodingTXT encodes the node info in base64 chunks as the TXT records.
+	SeedEncodingTXT
+)
+
+// ParseSeedEncoding parses the seed encoding name, empty name defaults to AAAA.
+func ParseSeedEncoding(s string) (e SeedEncoding, err error) {
+	switch strings.ToLower(s) {
+	case "", "aaaa":
+		return SeedEncodingAAAA, nil
+	case "txt":
+		return SeedEncodingTXT, nil
+	default:
+		return 0, errors.Errorf("unknown seed encoding: %s", s)
+	}
+}
+
+// seedFetcher fetches the encoded field of the seed records from the domain.
+type seedFetcher func(domain string) ([]byte, error)
+
+// fetcher returns the seed fetcher of the preferred encoding, the first validation failure is
+// saved to verr so that a spoofed record never truncates the seed silently.
+func (isc *IPv6SeedClient) fetcher(verr *error, mu *sync.Mutex) seedFetcher {
+	var (
+		resolver = isc.Resolver
+		timeout  = isc.Timeout
+	)
+	if resolver == nil {
+		resolver = NewNetResolver(nil)
+	}
+	if timeout <= 0 {
+		timeout = DefaultSeedLookupTimeout
+	}
+	var (
+		lookupIP = func(host string) ([]net.IP, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			return resolver.LookupIP(ctx, host)
+		}
+		// the A records are picked from the IPs by FromIPv4Domain
+		lookupA   = lookupIP
+		lookupTXT = func(host string) ([]string, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			return resolver.LookupTXT(ctx, host)
+		}
+	)
+	if isc.Validator != nil {
+		plainIP, plainTXT := lookupIP, lookupTXT
+		lookupIP = func(host string) (ips []net.IP, err error) {
+			if ips, err = isc.Validator.LookupAAAA(host); isc.validationFallback(host, err, verr, mu) {
+				return plainIP(host)
+			}
+			return
+		}
+		lookupA = func(host string) (ips []net.IP, err error) {
+			if ips, err = isc.Validator.LookupA(host); isc.validationFallback(host, err, verr, mu) {
+				return plainIP(host)
+			}
+			return
+		}
+		lookupTXT = func(host string) (txts []string, err error) {
+			if txts, err = isc.Validator.LookupTXT(host); isc.validationFallback(host, err, verr, mu) {
+				return plainTXT(host)
+			}
+			return
+		}
+	}
+	aaaa := func(domain string) (out []byte, err error) {
+		if out, err = FromDomain(domain, lookupIP); err != nil && isNotFound(err) {
+			// some resolvers strip the AAAA records, try the A records
+			return FromIPv4Domain(domain, lookupA)
+		}
+		return
+	}
+	if isc.Encoding != SeedEncodingTXT {
+		return aaaa
+	}
+	return func(domain string) (out []byte, err error) {
+		if out, err = FromTXT(domain, lookupTXT); err != nil && isNotFound(err) {
+			return aaaa(domain)
+		}
+		return
+	}
+}
+
+// validationFallback checks the error of a validating lookup, it reports whether the lookup
+// should fallback to the non-validating lookup for a record outside the trust anchors, and saves
+// the validation failures to verr. The bogus records and the unproven negative responses under
+// the trust anchors never fallback.
+func (isc *IPv6SeedClient) validationFallback(host string, err error, verr *error, mu *sync.Mutex) bool {
+	switch errors.Cause(err) {
+	case nil, ErrDNSNotFound:
+		return false
+	case ErrDNSSECUnsigned:
+		if !isc.Validator.Enforced {
+			log.WithField("host", host).Warning("seed record not under any trust anchor, fallback to non-validating lookup")
+			return true
+		}
+	}
+	if _, ok := err.(net.Error); ok {
+		// network failures are retried by FromDomain
+		return false
+	}
+	mu.Lock()
+	if *verr == nil {
+		*verr = err
+	}
+	mu.Unlock()
+	return false
+}
 
 // GetBPFromDNSSeed gets BP info from the IPv6 domain
 func (isc *IPv6SeedClient) GetBPFromDNSSeed(BPDomain string) (BPNodes IDNodeMap, err error) {
+	var (
+		verr error
+		vmu  sync.Mutex
+		node *proto.Node
+	)
+	node, err = decodeSeedNode(func(field string) string {
+		return field + BPDomain
+	}, isc.fetcher(&verr, &vmu), isc.RequireSignature)
+	if verr != nil {
+		return nil, verr
+	}
+	if err != nil {
+		return
+	}
+
+	BPNodes = make(IDNodeMap)
+	BPNodes[*node.ID.ToRawNodeID()] = *node
+	return
+}
+
+// GetBPsFromDNSSeed gets all the BPs published by the indexed scheme of the seed domain, the
+// i-th BP is decoded from the records of bp<i>.id.<domain>, bp<i>.pub.<domain> and so on. The
+// BPs are looked up in index order until the first missing one, an empty map is returned if
+// the domain publishes no indexed BP.
+func (isc *IPv6SeedClient) GetBPsFromDNSSeed(domain string) (BPNodes IDNodeMap, err error) {
+	var (
+		verr error
+		vmu  sync.Mutex
+	)
+	BPNodes, err = getSeedBPs(domain, isc.fetcher(&verr, &vmu), isc.RequireSignature)
+	if verr != nil {
+		return nil, verr
+	}
+	return
+}
+
+func getSeedBPs(domain string, fetch seedFetcher, requireSig bool) (BPNodes IDNodeMap, err error) {
+	BPNodes = make(IDNodeMap)
+	for i := 0; i < MaxSeedBPCount; i++ {
+		var node *proto.Node
+		if node, err = decodeSeedNode(func(field string) string {
+			return IndexedSeedDomain(i, field, domain)
+		}, fetch, requireSig); err != nil {
+			if isNotFound(err) {
+				// end of the list
+				err = nil
+				break
+			}
+			return nil, errors.Wrapf(err, "decode BP #%d from seed %s failed", i, domain)
+		}
+		BPNodes[*node.ID.ToRawNodeID()] = *node
+	}
+	return
+}
+
+// IndexedSeedDomain returns the domain of the seed record field of the i-th BP.
+func IndexedSeedDomain(i int, field, domain string) string {
+	return fmt.Sprintf("bp%02d.%s%s", i, field, domain)
+}
+
+// isNotFound reports whether the lookup error indicates a non-existent record.
+func isNotFound(err error) bool {
+	err = errors.Cause(err)
+	if err == ErrDNSNotFound {
+		return true
+	}
+	if dnsErr, ok := err.(*net.DNSError); ok {
+		return dnsErr.IsNotFound
+	}
+	return false
+}
+
+// decodeSeedNode decodes the node from the seed records, name maps the record field to the
+// domain name of it. The SIG record is verified if present, and required if requireSig is set.
+func decodeSeedNode(
+	name func(field string) string, fetch seedFetcher, requireSig bool) (node *proto.Node, err error,
+) {
 	// Public key
 	var pubKeyBuf []byte
-	var pubBuf, nonceBuf, addrBuf, nodeIDBuf []byte
-	var pubErr, nonceErr, addrErr, nodeIDErr error
+	var pubBuf, nonceBuf, addrBuf, nodeIDBuf, sigBuf []byte
+	var pubErr, nonceErr, addrErr, nodeIDErr, sigErr error
 	wg := new(sync.WaitGroup)
-	wg.Add(4)
+	wg.Add(5)
 
-	f := func(host string) ([]net.IP, error) {
-		return net.LookupIP(host)
-	}
 	// Public key
 	go func() {
 		defer wg.Done()
-		pubBuf, pubErr = FromDomain(PUBKEY+BPDomain, f)
+		pubBuf, pubErr = fetch(name(PUBKEY))
 	}()
 	// Nonce
 	go func() {
 		defer wg.Done()
-		nonceBuf, nonceErr = FromDomain(NONCE+BPDomain, f)
+		nonceBuf, nonceErr = fetch(name(NONCE))
 	}()
 	// Addr
 	go func() {
 		defer wg.Done()
-		addrBuf, addrErr = FromDomain(ADDR+BPDomain, f)
+		addrBuf, addrErr = fetch(name(ADDR))
 	}()
 	// NodeID
 	go func() {
 		defer wg.Done()
-		nodeIDBuf, nodeIDErr = FromDomain(ID+BPDomain, f)
+		nodeIDBuf, nodeIDErr = fetch(name(ID))
+	}()
+	// Signature
+	go func() {
+		defer wg.Done()
+		sigBuf, sigErr = fetch(name(SIG))
 	}()
 
 	wg.Wait()
@@ -128,53 +359,170 @@ func (isc *IPv6SeedClient) GetBPFromDNSSeed(BPDomain string) (BPNodes IDNodeMap,
 		return
 	}
 
-	BPNodes = make(IDNodeMap)
-	BPNodes[nodeID] = proto.Node{
+	node = &proto.Node{
 		ID:        nodeID.ToNodeID(),
 		Addr:      string(addrBytes),
 		PublicKey: &pubKey,
 		Nonce:     *nonce,
 	}
 
+	switch {
+	case sigErr == nil:
+		err = verifySeedSignature(node, sigBuf)
+	case !isNotFound(sigErr):
+		err = sigErr
+	case requireSig:
+		err = errors.Wrapf(ErrSeedUnsigned, "node %s", node.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
 	return
 }
 
-// GenBPIPv6 generates the IPv6 addrs contain BP info
-func (isc *IPv6SeedClient) GenBPIPv6(node *proto.Node, domain string) (out string, err error) {
-	// NodeID
-	nodeIDIps, err := ToIPv6(node.ID.ToRawNodeID().AsBytes())
-	if err != nil {
-		return "", err
+// seedSigningHash returns the hash signed by the SIG record, which is the concatenation of the
+// node id, public key, nonce and addr.
+func seedSigningHash(node *proto.Node) hash.Hash {
+	var buf []byte
+	buf = append(buf, node.ID.ToRawNodeID().AsBytes()...)
+	buf = append(buf, node.PublicKey.Serialize()...)
+	buf = append(buf, node.Nonce.Bytes()...)
+	buf = append(buf, node.Addr...)
+	return hash.THashH(buf)
+}
+
+// signSeed returns the signature of the seed records of the node, nil if the client has no
+// private key.
+func (isc *IPv6SeedClient) signSeed(node *proto.Node) (sig []byte, err error) {
+	if isc.PrivateKey == nil {
+		return
 	}
-	for i, ip := range nodeIDIps {
-		out += fmt.Sprintf("%02d.%s%s	1	IN	AAAA	%s\n", i, ID, domain, ip)
+	if !isc.PrivateKey.PubKey().IsEqual(node.PublicKey) {
+		return nil, errors.Errorf("private key does not match the public key of node %s", node.ID)
+	}
+	var (
+		h = seedSigningHash(node)
+		s *asymmetric.Signature
+	)
+	if s, err = isc.PrivateKey.Sign(h[:]); err != nil {
+		return
 	}
+	return s.Serialize(), nil
+}
 
-	pubKeyIps, err := ToIPv6(crypto.AddPKCSPadding(node.PublicKey.Serialize()))
-	if err != nil {
-		return "", err
+// signNodeSeed signs the seed records of the node with the indexed scheme, only the node with the
+// same public key as the private key is signed.
+func (isc *IPv6SeedClient) signNodeSeed(node *proto.Node) (sig []byte, err error) {
+	if isc.PrivateKey == nil || !isc.PrivateKey.PubKey().IsEqual(node.PublicKey) {
+		return
 	}
-	for i, ip := range pubKeyIps {
-		out += fmt.Sprintf("%02d.%s%s	1	IN	AAAA	%s\n", i, PUBKEY, domain, ip)
+	return isc.signSeed(node)
+}
+
+// verifySeedSignature verifies the SIG record of the node against its public key.
+func verifySeedSignature(node *proto.Node, sigBuf []byte) (err error) {
+	var sigBytes []byte
+	if sigBytes, err = crypto.RemovePKCSPadding(sigBuf); err != nil {
+		return errors.Wrapf(ErrInvalidSeedSignature, "node %s: %v", node.ID, err)
+	}
+	var sig *asymmetric.Signature
+	if sig, err = asymmetric.ParseSignature(sigBytes); err != nil {
+		return errors.Wrapf(ErrInvalidSeedSignature, "node %s: %v", node.ID, err)
+	}
+	if h := seedSigningHash(node); !sig.Verify(h[:], node.PublicKey) {
+		return errors.Wrapf(ErrInvalidSeedSignature, "node %s", node.ID)
 	}
+	return
+}
 
-	// Nonce
-	nonceIps, err := ToIPv6(node.Nonce.Bytes())
-	if err != nil {
-		return "", err
+// GenBPIPv6 generates the IPv6 addrs contain BP info
+func (isc *IPv6SeedClient) GenBPIPv6(node *proto.Node, domain string) (out string, err error) {
+	return isc.GenBPIPv6Zone(node, domain, ZoneOptions{})
+}
+
+// GenBPIPv6Zone generates the IPv6 addrs contain BP info in the zone format of opts.
+func (isc *IPv6SeedClient) GenBPIPv6Zone(
+	node *proto.Node, domain string, opts ZoneOptions) (out string, err error,
+) {
+	var (
+		sig     []byte
+		records []zoneRecord
+	)
+	if sig, err = isc.signSeed(node); err != nil {
+		return
 	}
-	for i, ip := range nonceIps {
-		out += fmt.Sprintf("%02d.%s%s	1	IN	AAAA	%s\n", i, NONCE, domain, ip)
+	if records, err = genSeedRecords(node, sig, func(field string) string {
+		return field + domain
+	}, opts.IPv4); err != nil {
+		return
 	}
+	return renderZone(records, domain, opts)
+}
 
-	// Addr
-	addrIps, err := ToIPv6(crypto.AddPKCSPadding([]byte(node.Addr)))
-	if err != nil {
-		return "", err
+// GenBPsIPv6 generates the IPv6 addrs contain the info of all BPs with the indexed scheme, see
+// GetBPsFromDNSSeed.
+func (isc *IPv6SeedClient) GenBPsIPv6(nodes []proto.Node, domain string) (out string, err error) {
+	return isc.GenBPsIPv6Zone(nodes, domain, ZoneOptions{})
+}
+
+// GenBPsIPv6Zone generates the IPv6 addrs contain the info of all BPs with the indexed scheme in
+// the zone format of opts.
+func (isc *IPv6SeedClient) GenBPsIPv6Zone(
+	nodes []proto.Node, domain string, opts ZoneOptions) (out string, err error,
+) {
+	if len(nodes) > MaxSeedBPCount {
+		return "", errors.Errorf("too many BPs: %d, max %d", len(nodes), MaxSeedBPCount)
 	}
-	for i, ip := range addrIps {
-		out += fmt.Sprintf("%02d.%s%s	1	IN	AAAA	%s\n", i, ADDR, domain, ip)
+	var all []zoneRecord
+	for i := range nodes {
+		var (
+			sig     []byte
+			records []zoneRecord
+		)
+		if sig, err = isc.signNodeSeed(&nodes[i]); err != nil {
+			return "", err
+		}
+		if records, err = genSeedRecords(&nodes[i], sig, func(field string) string {
+			return IndexedSeedDomain(i, field, domain)
+		}, opts.IPv4); err != nil {
+			return "", err
+		}
+		all = append(all, records...)
 	}
+	return renderZone(all, domain, opts)
+}
 
+// genSeedRecords generates the AAAA records of the node and its signature if not nil, name maps
+// the record field to the domain name of it, the A records of the same names are also generated
+// if ipv4 is set.
+func genSeedRecords(
+	node *proto.Node, sig []byte, name func(field string) string, ipv4 bool) (records []zoneRecord, err error,
+) {
+	for _, f := range seedFields(node, sig) {
+		var ips []net.IP
+		if ips, err = ToIPv6(f.data); err != nil {
+			return nil, err
+		}
+		for i, ip := range ips {
+			records = append(records, zoneRecord{
+				name:  fmt.Sprintf("%02d.%s", i, name(f.field)),
+				typ:   "AAAA",
+				value: ip.String(),
+			})
+		}
+		if !ipv4 {
+			continue
+		}
+		if ips, err = ToIPv4(f.data); err != nil {
+			return nil, err
+		}
+		for i, ip := range ips {
+			records = append(records, zoneRecord{
+				name:  fmt.Sprintf("%02d.%s", i, name(f.field)),
+				typ:   "A",
+				value: ip.String(),
+			})
+		}
+	}
 	return
 }
@@ -19,8 +19,11 @@ package route
 import (
 	"encoding/hex"
 	"fmt"
+	"net"
+	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 
 	"github.com/SQLess/SQLess/conf"
@@ -141,3 +144,118 @@ func TestGenTestNetDomain(t *testing.T) {
 		}
 	})
 }
+
+func TestIndexedSeed(t *testing.T) {
+	isc := IPv6SeedClient{}
+	Convey("all BPs should be published by one seed domain", t, func() {
+		var pub asymmetric.PublicKey
+		pubKeyBytes, _ := hex.DecodeString("02c76216704d797c64c58bc11519fb68582e8e63de7e5b3b2dbbbe8733efe5fd24")
+		_ = pub.UnmarshalBinary(pubKeyBytes)
+
+		nodes := []proto.Node{
+			{
+				ID:        proto.NodeID("00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9"),
+				Addr:      "127.0.0.1:3122",
+				PublicKey: &pub,
+				Nonce:     cpuminer.Uint256{313283, 0, 0, 0},
+			},
+			{
+				ID:        proto.NodeID("0000000001f26f2145dc770edc385806c6ef131a472ea9ae0f9073d03b4b96d8"),
+				Addr:      "bp01.seed.test:11111",
+				PublicKey: &pub,
+				Nonce:     cpuminer.Uint256{1, 2, 3, 4},
+			},
+		}
+		out, err := isc.GenBPsIPv6(nodes, "seed.test")
+		So(err, ShouldBeNil)
+
+		zone := make(map[string][]net.IP)
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			fields := strings.Fields(line)
+			So(fields, ShouldHaveLength, 5)
+			zone[fields[0]] = append(zone[fields[0]], net.ParseIP(fields[4]))
+		}
+		So(zone, ShouldContainKey, "00.bp01.id.seed.test")
+		lookup := func(host string) ([]net.IP, error) {
+			if ips, ok := zone[host]; ok {
+				return ips, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+
+		fetch := func(domain string) ([]byte, error) { return FromDomain(domain, lookup) }
+		m, err := getSeedBPs("seed.test", fetch, false)
+		So(err, ShouldBeNil)
+		So(m, ShouldHaveLength, len(nodes))
+		for _, node := range nodes {
+			So(m[*node.ID.ToRawNodeID()].ID, ShouldResemble, node.ID)
+			So(m[*node.ID.ToRawNodeID()].Addr, ShouldEqual, node.Addr)
+			So(m[*node.ID.ToRawNodeID()].Nonce, ShouldResemble, node.Nonce)
+		}
+
+		m, err = getSeedBPs("other.test", fetch, false)
+		So(err, ShouldBeNil)
+		So(m, ShouldBeEmpty)
+	})
+}
+
+func TestSignedSeed(t *testing.T) {
+	Convey("seed records should be verified with the SIG record", t, func() {
+		priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		node := proto.Node{
+			ID:        proto.NodeID("0000000001f26f2145dc770edc385806c6ef131a472ea9ae0f9073d03b4b96d8"),
+			Addr:      "bp00.seed.test:11111",
+			PublicKey: pub,
+			Nonce:     cpuminer.Uint256{1, 2, 3, 4},
+		}
+		zoneFetcher := func(out string) seedFetcher {
+			zone := make(map[string][]net.IP)
+			for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+				fields := strings.Fields(line)
+				zone[fields[0]] = append(zone[fields[0]], net.ParseIP(fields[4]))
+			}
+			return func(domain string) ([]byte, error) {
+				return FromDomain(domain, func(host string) ([]net.IP, error) {
+					if ips, ok := zone[host]; ok {
+						return ips, nil
+					}
+					return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+				})
+			}
+		}
+		name := func(field string) string { return field + "seed.test" }
+
+		signed, err := (&IPv6SeedClient{PrivateKey: priv}).GenBPIPv6(&node, "seed.test")
+		So(err, ShouldBeNil)
+		So(signed, ShouldContainSubstring, "00.sig.seed.test")
+		decoded, err := decodeSeedNode(name, zoneFetcher(signed), true)
+		So(err, ShouldBeNil)
+		So(decoded.Addr, ShouldEqual, node.Addr)
+
+		unsigned, err := (&IPv6SeedClient{}).GenBPIPv6(&node, "seed.test")
+		So(err, ShouldBeNil)
+		_, err = decodeSeedNode(name, zoneFetcher(unsigned), false)
+		So(err, ShouldBeNil)
+		_, err = decodeSeedNode(name, zoneFetcher(unsigned), true)
+		So(errors.Cause(err), ShouldEqual, ErrSeedUnsigned)
+
+		// the addr records are replaced but the SIG record is kept
+		spoofed := node
+		spoofed.Addr = "evil.seed.test:11111"
+		tampered, err := (&IPv6SeedClient{}).GenBPIPv6(&spoofed, "seed.test")
+		So(err, ShouldBeNil)
+		for _, line := range strings.Split(signed, "\n") {
+			if strings.Contains(line, ".sig.") {
+				tampered += line + "\n"
+			}
+		}
+		_, err = decodeSeedNode(name, zoneFetcher(tampered), false)
+		So(errors.Cause(err), ShouldEqual, ErrInvalidSeedSignature)
+
+		other, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		_, err = (&IPv6SeedClient{PrivateKey: other}).GenBPIPv6(&node, "seed.test")
+		So(err, ShouldNotBeNil)
+	})
+}
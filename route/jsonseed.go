@@ -0,0 +1,232 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// jsonSeedMaxSize is the max size of a JSON seed document.
+	jsonSeedMaxSize = 1 << 20
+)
+
+var (
+	// JSONSeedFetchTimeout is the timeout of fetching a JSON seed document over https.
+	JSONSeedFetchTimeout = 10 * time.Second
+
+	// ErrInvalidSeedSignature indicates the JSON seed document is not signed by the trusted key,
+	// or the SIG record of the DNS seed does not match the BP public key.
+	ErrInvalidSeedSignature = errors.New("invalid seed document signature")
+)
+
+// SeedDocument is the signed JSON document of the BP nodes, which is an alternative seed source
+// of the DNS seed. The signature is made over the THash of the compact JSON payload.
+type SeedDocument struct {
+	Payload   json.RawMessage `json:"payload"`
+	Signature string          `json:"signature"`
+}
+
+type seedPayload struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Nodes     []seedPayloadBP `json:"nodes"`
+}
+
+// seedPayloadBP defines the BP fields, which are encoded the same as the DNS seed records.
+type seedPayloadBP struct {
+	ID        []byte `json:"id"`
+	PublicKey []byte `json:"pub"`
+	Nonce     []byte `json:"nonce"`
+	Addr      []byte `json:"addr"`
+}
+
+func (bp *seedPayloadBP) field(name string) []byte {
+	switch name {
+	case ID:
+		return bp.ID
+	case PUBKEY:
+		return bp.PublicKey
+	case NONCE:
+		return bp.Nonce
+	case ADDR:
+		return bp.Addr
+	}
+	return nil
+}
+
+// GenSeedJSON generates the JSON seed document of the BP nodes signed by the private key.
+func GenSeedJSON(nodes []proto.Node, key *asymmetric.PrivateKey) (out []byte, err error) {
+	var payload = seedPayload{
+		Timestamp: time.Now().UTC(),
+		Nodes:     make([]seedPayloadBP, 0, len(nodes)),
+	}
+	for i := range nodes {
+		var bp seedPayloadBP
+		for _, f := range seedFields(&nodes[i], nil) {
+			switch f.field {
+			case ID:
+				bp.ID = f.data
+			case PUBKEY:
+				bp.PublicKey = f.data
+			case NONCE:
+				bp.Nonce = f.data
+			case ADDR:
+				bp.Addr = f.data
+			}
+		}
+		payload.Nodes = append(payload.Nodes, bp)
+	}
+	var doc SeedDocument
+	if doc.Payload, err = json.Marshal(&payload); err != nil {
+		return
+	}
+	var sig *asymmetric.Signature
+	if sig, err = key.Sign(hash.THashB(doc.Payload)); err != nil {
+		return
+	}
+	doc.Signature = hex.EncodeToString(sig.Serialize())
+	return json.MarshalIndent(&doc, "", "  ")
+}
+
+// ParseSeedJSON verifies the JSON seed document with the trusted public key and decodes the BP
+// nodes in the same way as the DNS seed records.
+func ParseSeedJSON(data []byte, signer *asymmetric.PublicKey) (BPNodes IDNodeMap, err error) {
+	if signer == nil {
+		return nil, errors.Wrap(ErrInvalidSeedSignature, "no trusted seed signer")
+	}
+	var doc SeedDocument
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "decode seed document failed")
+	}
+	sigBytes, err := hex.DecodeString(doc.Signature)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidSeedSignature, err.Error())
+	}
+	sig, err := asymmetric.ParseSignature(sigBytes)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidSeedSignature, err.Error())
+	}
+	// the document may be reformatted, the payload is signed in the compact form
+	var payloadBuf bytes.Buffer
+	if err = json.Compact(&payloadBuf, doc.Payload); err != nil {
+		return nil, errors.Wrap(err, "decode seed payload failed")
+	}
+	if !sig.Verify(hash.THashB(payloadBuf.Bytes()), signer) {
+		return nil, ErrInvalidSeedSignature
+	}
+	var payload seedPayload
+	if err = json.Unmarshal(doc.Payload, &payload); err != nil {
+		return nil, errors.Wrap(err, "decode seed payload failed")
+	}
+	BPNodes = make(IDNodeMap, len(payload.Nodes))
+	for i := range payload.Nodes {
+		var bp = &payload.Nodes[i]
+		node, err := decodeSeedNode(func(field string) string { return field }, func(field string) ([]byte, error) {
+			if data := bp.field(field); len(data) > 0 {
+				return data, nil
+			}
+			return nil, errors.Wrapf(ErrDNSNotFound, "missing field %s", strings.TrimSuffix(field, "."))
+		}, false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decode BP #%d from seed document failed", i)
+		}
+		BPNodes[*node.ID.ToRawNodeID()] = *node
+	}
+	return
+}
+
+// FetchSeedJSON fetches the JSON seed document from the https url or the local file path, and
+// verifies it with the trusted public key.
+func FetchSeedJSON(src string, signer *asymmetric.PublicKey) (BPNodes IDNodeMap, err error) {
+	var data []byte
+	if strings.HasPrefix(src, "https://") {
+		var (
+			client = &http.Client{Timeout: JSONSeedFetchTimeout}
+			resp   *http.Response
+		)
+		if resp, err = client.Get(src); err != nil {
+			return nil, errors.Wrapf(err, "fetch seed document %s failed", src)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.Errorf("fetch seed document %s failed with status: %s", src, resp.Status)
+		}
+		if data, err = ioutil.ReadAll(io.LimitReader(resp.Body, jsonSeedMaxSize)); err != nil {
+			return nil, errors.Wrapf(err, "read seed document %s failed", src)
+		}
+	} else {
+		if data, err = ioutil.ReadFile(strings.TrimPrefix(src, "file://")); err != nil {
+			return nil, errors.Wrapf(err, "read seed document %s failed", src)
+		}
+	}
+	return ParseSeedJSON(data, signer)
+}
+
+// getBPsFromSeeds gets the BPs from the DNS seed, the JSON seed documents are tried in order if
+// the DNS seeding fails or no DNS seed is configured.
+func getBPsFromSeeds(cfg *conf.DNSSeed) (bpNodes IDNodeMap, err error) {
+	if domains := cfg.SeedDomains(); len(domains) > 0 {
+		if bpNodes, err = getBPsFromDNSSeed(cfg); err == nil && len(bpNodes) > 0 {
+			return
+		}
+		if len(cfg.JSONSeeds) == 0 {
+			return
+		}
+		log.WithField("seed", domains).WithError(err).Warning(
+			"getting BP info from DNS failed, fallback to JSON seeds")
+	}
+	if len(cfg.JSONSeeds) == 0 {
+		return
+	}
+	var signer *asymmetric.PublicKey
+	if signer, err = parseSeedSigner(cfg.JSONSeedSigner); err != nil {
+		return
+	}
+	for _, src := range cfg.JSONSeeds {
+		if bpNodes, err = FetchSeedJSON(src, signer); err == nil {
+			return
+		}
+		log.WithField("seed", src).WithError(err).Warning("getting BP info from JSON seed failed")
+	}
+	return
+}
+
+func parseSeedSigner(s string) (signer *asymmetric.PublicKey, err error) {
+	var buf []byte
+	if buf, err = hex.DecodeString(s); err != nil {
+		return nil, errors.Wrap(err, "invalid JSON seed signer")
+	}
+	if signer, err = asymmetric.ParsePubKey(buf); err != nil {
+		return nil, errors.Wrap(err, "invalid JSON seed signer")
+	}
+	return
+}
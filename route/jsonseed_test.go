@@ -0,0 +1,89 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/pow/cpuminer"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestJSONSeed(t *testing.T) {
+	Convey("Given a signed JSON seed document", t, func() {
+		var pub asymmetric.PublicKey
+		pubKeyBytes, _ := hex.DecodeString("02c76216704d797c64c58bc11519fb68582e8e63de7e5b3b2dbbbe8733efe5fd24")
+		So(pub.UnmarshalBinary(pubKeyBytes), ShouldBeNil)
+		nodes := []proto.Node{{
+			ID:        proto.NodeID("00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9"),
+			Addr:      "bp00.seed.test:3122",
+			PublicKey: &pub,
+			Nonce:     cpuminer.Uint256{A: 313283},
+		}}
+		priv, signer, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		doc, err := GenSeedJSON(nodes, priv)
+		So(err, ShouldBeNil)
+
+		Convey("The BPs should be decoded as the DNS seed", func() {
+			m, err := ParseSeedJSON(doc, signer)
+			So(err, ShouldBeNil)
+			So(m, ShouldHaveLength, 1)
+			node := m[*nodes[0].ID.ToRawNodeID()]
+			So(node.Addr, ShouldEqual, nodes[0].Addr)
+			So(node.Nonce, ShouldResemble, nodes[0].Nonce)
+			So(node.PublicKey.IsEqual(&pub), ShouldBeTrue)
+		})
+		Convey("The document should be verified with the trusted key", func() {
+			_, other, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			_, err = ParseSeedJSON(doc, other)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidSeedSignature)
+			_, err = ParseSeedJSON(doc, nil)
+			So(errors.Cause(err), ShouldEqual, ErrInvalidSeedSignature)
+
+			tampered := bytes.Replace(doc, []byte(`"timestamp": "`), []byte(`"timestamp": "1`), 1)
+			So(tampered, ShouldNotResemble, doc)
+			_, err = ParseSeedJSON(tampered, signer)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("The document should be loaded from the local file", func() {
+			dir, err := ioutil.TempDir("", "jsonseed")
+			So(err, ShouldBeNil)
+			defer func() { _ = os.RemoveAll(dir) }()
+			path := filepath.Join(dir, "seed.json")
+			So(ioutil.WriteFile(path, doc, 0600), ShouldBeNil)
+
+			m, err := getBPsFromSeeds(&conf.DNSSeed{
+				JSONSeeds:      []string{filepath.Join(dir, "missing.json"), "file://" + path},
+				JSONSeedSigner: hex.EncodeToString(signer.Serialize()),
+			})
+			So(err, ShouldBeNil)
+			So(m, ShouldHaveLength, 1)
+		})
+	})
+}
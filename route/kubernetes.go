@@ -0,0 +1,380 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// kubernetesServiceAccountDir is the mount point of the pod service account.
+	kubernetesServiceAccountDir  = "/var/run/secrets/kubernetes.io/serviceaccount"
+	defaultKubernetesDomain      = "cluster.local"
+	defaultKubernetesNamespace   = "default"
+	defaultKubernetesInterval    = 30 * time.Second
+	kubernetesLookupTimeout      = 10 * time.Second
+	kubernetesAPIResponseMaxSize = 4 << 20
+)
+
+// KubernetesPeer is a peer pod discovered from the headless service.
+type KubernetesPeer struct {
+	// Hostname is the stable hostname of the pod, e.g. "sqless-bp-0" of a StatefulSet.
+	Hostname string
+	// Addr is the current "ip:port" of the pod.
+	Addr  string
+	Ready bool
+}
+
+// kubernetesSynced is set after the first successful discovery round.
+var kubernetesSynced int32
+
+func kubernetesNamespace(cfg *conf.KubernetesDiscovery) string {
+	if cfg.Namespace != "" {
+		return cfg.Namespace
+	}
+	if ns, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/namespace"); err == nil {
+		if s := strings.TrimSpace(string(ns)); s != "" {
+			return s
+		}
+	}
+	return defaultKubernetesNamespace
+}
+
+func kubernetesServiceFQDN(cfg *conf.KubernetesDiscovery) string {
+	var domain = cfg.ClusterDomain
+	if domain == "" {
+		domain = defaultKubernetesDomain
+	}
+	return fmt.Sprintf("%s.%s.svc.%s", cfg.Service, kubernetesNamespace(cfg), domain)
+}
+
+// KubernetesAdvertiseAddr returns the stable address of this pod in the headless service,
+// which survives pod rescheduling while the pod ip does not.
+func KubernetesAdvertiseAddr(cfg *conf.KubernetesDiscovery, port int) (addr string, err error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return
+	}
+	hostname = strings.SplitN(hostname, ".", 2)[0]
+	return net.JoinHostPort(
+		hostname+"."+kubernetesServiceFQDN(cfg), strconv.Itoa(port)), nil
+}
+
+// LookupKubernetesPeersDNS discovers the peers from the SRV records of the headless service.
+func LookupKubernetesPeersDNS(
+	ctx context.Context, cfg *conf.KubernetesDiscovery) (peers []KubernetesPeer, err error,
+) {
+	var r = net.DefaultResolver
+	_, srvs, err := r.LookupSRV(ctx, "", "", kubernetesServiceFQDN(cfg))
+	if err != nil {
+		err = errors.Wrap(err, "lookup headless service failed")
+		return
+	}
+	for _, srv := range srvs {
+		var (
+			target = strings.TrimSuffix(srv.Target, ".")
+			port   = int(srv.Port)
+			ips    []string
+		)
+		if cfg.Port != 0 {
+			port = cfg.Port
+		}
+		if ips, err = r.LookupHost(ctx, target); err != nil || len(ips) == 0 {
+			log.WithField("target", target).WithError(err).Warning("lookup kubernetes peer failed")
+			err = nil
+			continue
+		}
+		peers = append(peers, KubernetesPeer{
+			Hostname: strings.SplitN(target, ".", 2)[0],
+			Addr:     net.JoinHostPort(ips[0], strconv.Itoa(port)),
+			// headless service only publishes ready pods by default
+			Ready: true,
+		})
+	}
+	return
+}
+
+type kubernetesEndpoints struct {
+	Subsets []struct {
+		Addresses         []kubernetesEndpointAddress `json:"addresses"`
+		NotReadyAddresses []kubernetesEndpointAddress `json:"notReadyAddresses"`
+		Ports             []struct {
+			Port int `json:"port"`
+		} `json:"ports"`
+	} `json:"subsets"`
+}
+
+type kubernetesEndpointAddress struct {
+	IP        string `json:"ip"`
+	Hostname  string `json:"hostname"`
+	TargetRef struct {
+		Name string `json:"name"`
+	} `json:"targetRef"`
+}
+
+// LookupKubernetesPeersAPI discovers the peers from the endpoints of the service via
+// Kubernetes API with the pod service account.
+func LookupKubernetesPeersAPI(
+	ctx context.Context, cfg *conf.KubernetesDiscovery) (peers []KubernetesPeer, err error,
+) {
+	var (
+		host = os.Getenv("KUBERNETES_SERVICE_HOST")
+		port = os.Getenv("KUBERNETES_SERVICE_PORT")
+	)
+	if host == "" || port == "" {
+		err = errors.New("not running in kubernetes cluster")
+		return
+	}
+	token, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/token")
+	if err != nil {
+		err = errors.Wrap(err, "read service account token failed")
+		return
+	}
+	ca, err := ioutil.ReadFile(kubernetesServiceAccountDir + "/ca.crt")
+	if err != nil {
+		err = errors.Wrap(err, "read service account ca failed")
+		return
+	}
+	var pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		err = errors.New("invalid service account ca")
+		return
+	}
+	var url = fmt.Sprintf("https://%s/api/v1/namespaces/%s/endpoints/%s",
+		net.JoinHostPort(host, port), kubernetesNamespace(cfg), cfg.Service)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	var client = &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		err = errors.Wrap(err, "request kubernetes api failed")
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err = errors.Errorf("unexpected kubernetes api response: %s", resp.Status)
+		return
+	}
+	var ep kubernetesEndpoints
+	if err = json.NewDecoder(
+		http.MaxBytesReader(nil, resp.Body, kubernetesAPIResponseMaxSize)).Decode(&ep); err != nil {
+		err = errors.Wrap(err, "decode kubernetes endpoints failed")
+		return
+	}
+	return ep.peers(cfg.Port), nil
+}
+
+func (ep *kubernetesEndpoints) peers(portOverride int) (peers []KubernetesPeer) {
+	for _, s := range ep.Subsets {
+		var port = portOverride
+		if port == 0 && len(s.Ports) > 0 {
+			port = s.Ports[0].Port
+		}
+		if port == 0 {
+			continue
+		}
+		var add = func(a kubernetesEndpointAddress, ready bool) {
+			var hostname = a.Hostname
+			if hostname == "" {
+				hostname = a.TargetRef.Name
+			}
+			peers = append(peers, KubernetesPeer{
+				Hostname: hostname,
+				Addr:     net.JoinHostPort(a.IP, strconv.Itoa(port)),
+				Ready:    ready,
+			})
+		}
+		for _, a := range s.Addresses {
+			add(a, true)
+		}
+		for _, a := range s.NotReadyAddresses {
+			add(a, false)
+		}
+	}
+	return
+}
+
+// hostLabel returns the first label of host in the address, e.g. "sqless-bp-0" of
+// "sqless-bp-0.sqless-bp.default.svc.cluster.local:4661".
+func hostLabel(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	return strings.SplitN(host, ".", 2)[0]
+}
+
+// applyKubernetesPeers feeds the discovered peer addresses into the route layer. A known node
+// is matched to a peer by the stable pod hostname in its configured address, so the node id
+// keeps resolving to the new pod ip after rescheduling.
+func applyKubernetesPeers(peers []KubernetesPeer) (updated int) {
+	var byHost = make(map[string]KubernetesPeer, len(peers))
+	for _, p := range peers {
+		if p.Ready && p.Hostname != "" {
+			byHost[p.Hostname] = p
+		}
+	}
+
+	initResolver()
+	for _, n := range conf.GConf.KnownNodes {
+		var rawID = n.ID.ToRawNodeID()
+		if rawID == nil || n.ID == conf.GConf.ThisNodeID {
+			continue
+		}
+		p, ok := byHost[hostLabel(n.Addr)]
+		if !ok {
+			continue
+		}
+		if cached, err := GetNodeAddrCache(rawID); err == nil && cached == p.Addr {
+			continue
+		}
+		_ = SetNodeAddrCache(rawID, p.Addr)
+		resolver.Lock()
+		if _, isBP := resolver.bpNodeIDs[*rawID]; isBP {
+			resolver.bpNodeIDs[*rawID] = p.Addr
+		}
+		resolver.Unlock()
+		if node, err := kms.GetNodeInfo(n.ID); err == nil && node.Addr != p.Addr {
+			var updatedNode = *node
+			updatedNode.Addr = p.Addr
+			if err = kms.SetNode(&updatedNode); err != nil {
+				log.WithField("node", n.ID).WithError(err).Warning("update node addr in kms failed")
+			}
+		}
+		log.WithFields(log.Fields{
+			"node": n.ID,
+			"host": p.Hostname,
+			"addr": p.Addr,
+		}).Info("kubernetes peer address updated")
+		updated++
+	}
+	return
+}
+
+func syncKubernetesPeers(cfg *conf.KubernetesDiscovery) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesLookupTimeout)
+	defer cancel()
+	var peers []KubernetesPeer
+	if cfg.UseAPI {
+		peers, err = LookupKubernetesPeersAPI(ctx, cfg)
+	} else {
+		peers, err = LookupKubernetesPeersDNS(ctx, cfg)
+	}
+	if err != nil {
+		return
+	}
+	applyKubernetesPeers(peers)
+	atomic.StoreInt32(&kubernetesSynced, 1)
+	return
+}
+
+// StartKubernetesDiscovery starts the peer discovery if conf.GConf.Kubernetes is set, the first
+// round is done synchronously. Call the returned stop func to stop refreshing.
+func StartKubernetesDiscovery() (stop func(), err error) {
+	stop = func() {}
+	if conf.GConf == nil || conf.GConf.Kubernetes == nil {
+		return
+	}
+	var cfg = conf.GConf.Kubernetes
+	if cfg.Service == "" {
+		err = errors.New("kubernetes service is not specified")
+		return
+	}
+	if errSync := syncKubernetesPeers(cfg); errSync != nil {
+		log.WithError(errSync).Warning("initial kubernetes peer discovery failed")
+	}
+	var (
+		interval = cfg.Interval
+		done     = make(chan struct{})
+	)
+	if interval <= 0 {
+		interval = defaultKubernetesInterval
+	}
+	go func() {
+		var ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := syncKubernetesPeers(cfg); err != nil {
+					log.WithError(err).Warning("kubernetes peer discovery failed")
+				}
+			}
+		}
+	}()
+	stop = func() { close(done) }
+	return
+}
+
+// ReadinessHandler returns a http handler for the Kubernetes readiness probe. The node is ready
+// once the block producers are resolvable and, in Kubernetes discovery mode, the peers are
+// discovered at least once.
+func ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conf.GConf == nil {
+			http.Error(w, "config not loaded", http.StatusServiceUnavailable)
+			return
+		}
+		if conf.GConf.Kubernetes != nil && atomic.LoadInt32(&kubernetesSynced) == 0 {
+			http.Error(w, "kubernetes peers not discovered", http.StatusServiceUnavailable)
+			return
+		}
+		initResolver()
+		var bps = GetBPs()
+		if len(bps) == 0 {
+			http.Error(w, "no block producer known", http.StatusServiceUnavailable)
+			return
+		}
+		for _, id := range bps {
+			if _, err := GetNodeAddrCache(id.ToRawNodeID()); err == nil {
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte("ok"))
+				return
+			}
+		}
+		http.Error(w, "no block producer resolvable", http.StatusServiceUnavailable)
+	})
+}
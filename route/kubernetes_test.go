@@ -0,0 +1,51 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKubernetesEndpoints(t *testing.T) {
+	Convey("test kubernetes endpoints parsing", t, func() {
+		var ep kubernetesEndpoints
+		So(json.Unmarshal([]byte(`{"subsets":[{
+			"addresses":[{"ip":"10.0.0.1","hostname":"sqless-bp-0"},
+				{"ip":"10.0.0.2","targetRef":{"name":"sqless-bp-1"}}],
+			"notReadyAddresses":[{"ip":"10.0.0.3","hostname":"sqless-bp-2"}],
+			"ports":[{"port":4661}]}]}`), &ep), ShouldBeNil)
+
+		peers := ep.peers(0)
+		So(peers, ShouldHaveLength, 3)
+		So(peers[0], ShouldResemble, KubernetesPeer{
+			Hostname: "sqless-bp-0", Addr: "10.0.0.1:4661", Ready: true})
+		So(peers[1].Hostname, ShouldEqual, "sqless-bp-1")
+		So(peers[2].Ready, ShouldBeFalse)
+
+		peers = ep.peers(7458)
+		So(peers[0].Addr, ShouldEqual, "10.0.0.1:7458")
+	})
+	Convey("test stable host label", t, func() {
+		So(hostLabel("sqless-bp-0.sqless-bp.default.svc.cluster.local:4661"), ShouldEqual, "sqless-bp-0")
+		So(hostLabel("sqless-bp-0:4661"), ShouldEqual, "sqless-bp-0")
+		So(hostLabel("10.0.0.1:4661"), ShouldEqual, "")
+		So(hostLabel("[::1]:4661"), ShouldEqual, "")
+	})
+}
@@ -0,0 +1,298 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+var (
+	// LivenessProbeInterval is the interval of probing a live node, the probing of a failing
+	// node backs off exponentially from it.
+	LivenessProbeInterval = 30 * time.Second
+	// LivenessMaxBackoff is the max probing interval of a failing node.
+	LivenessMaxBackoff = 10 * time.Minute
+	// LivenessProbeTimeout is the timeout of a single probe.
+	LivenessProbeTimeout = 5 * time.Second
+	// LivenessMaxFailures is the number of consecutive failed probes to evict a node.
+	LivenessMaxFailures = 5
+	// LivenessProbeConcurrency is the max number of concurrent probes.
+	LivenessProbeConcurrency = 8
+)
+
+// ProbeFunc probes the liveness of the node, a nil error indicates the node is alive.
+type ProbeFunc func(ctx context.Context, id proto.NodeID) error
+
+// nodeLiveness defines the probing state of a node.
+type nodeLiveness struct {
+	lastAlive time.Time
+	failures  int
+	nextProbe time.Time
+}
+
+// LivenessTable tracks the liveness of the known nodes, the nodes failing LivenessMaxFailures
+// consecutive probes are reported for eviction.
+type LivenessTable struct {
+	sync.Mutex
+	nodes map[proto.NodeID]*nodeLiveness
+	now   func() time.Time
+}
+
+// NewLivenessTable returns a new liveness table.
+func NewLivenessTable() *LivenessTable {
+	return &LivenessTable{
+		nodes: make(map[proto.NodeID]*nodeLiveness),
+		now:   time.Now,
+	}
+}
+
+// MarkAlive records the node is alive now and resets its failures.
+func (t *LivenessTable) MarkAlive(id proto.NodeID) {
+	t.Lock()
+	defer t.Unlock()
+	var now = t.now()
+	t.nodes[id] = &nodeLiveness{
+		lastAlive: now,
+		nextProbe: now.Add(LivenessProbeInterval),
+	}
+}
+
+// MarkFailed records a failed probe of the node and backs off its next probe, returns whether
+// the node should be evicted.
+func (t *LivenessTable) MarkFailed(id proto.NodeID) (evict bool) {
+	t.Lock()
+	defer t.Unlock()
+	l, ok := t.nodes[id]
+	if !ok {
+		l = &nodeLiveness{}
+		t.nodes[id] = l
+	}
+	l.failures++
+	var backoff = LivenessProbeInterval
+	for i := 1; i < l.failures && backoff < LivenessMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > LivenessMaxBackoff {
+		backoff = LivenessMaxBackoff
+	}
+	l.nextProbe = t.now().Add(backoff)
+	return l.failures >= LivenessMaxFailures
+}
+
+// Due returns the nodes should be probed now, the nodes never probed are always due.
+func (t *LivenessTable) Due(ids []proto.NodeID) (due []proto.NodeID) {
+	t.Lock()
+	defer t.Unlock()
+	var now = t.now()
+	for _, id := range ids {
+		if l, ok := t.nodes[id]; !ok || !now.Before(l.nextProbe) {
+			due = append(due, id)
+		}
+	}
+	return
+}
+
+// Freshness returns the last time the node is seen alive and its consecutive probe failures,
+// ok is false if the node is never probed.
+func (t *LivenessTable) Freshness(id proto.NodeID) (lastAlive time.Time, failures int, ok bool) {
+	t.Lock()
+	defer t.Unlock()
+	var l *nodeLiveness
+	if l, ok = t.nodes[id]; ok {
+		lastAlive, failures = l.lastAlive, l.failures
+	}
+	return
+}
+
+// Forget removes the node from the liveness table.
+func (t *LivenessTable) Forget(id proto.NodeID) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.nodes, id)
+}
+
+// SortByFreshness sorts the nodes in place, the alive nodes come first with the more recently
+// alive ones ahead, then the unknown nodes and the failing nodes at last. The order of the nodes
+// with the same freshness is kept.
+func (t *LivenessTable) SortByFreshness(ids []proto.NodeID) {
+	t.Lock()
+	defer t.Unlock()
+	rank := func(id proto.NodeID) (r int, l *nodeLiveness) {
+		var ok bool
+		if l, ok = t.nodes[id]; !ok {
+			return 1, nil
+		}
+		if l.failures > 0 {
+			return 2, l
+		}
+		return 0, l
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		ri, li := rank(ids[i])
+		rj, lj := rank(ids[j])
+		switch {
+		case ri != rj:
+			return ri < rj
+		case ri == 0:
+			return li.lastAlive.After(lj.lastAlive)
+		case ri == 2:
+			return li.failures < lj.failures
+		}
+		return false
+	})
+}
+
+// liveness is the liveness table of the running node.
+var liveness = NewLivenessTable()
+
+// MarkNodeAlive records the node is alive, it's called on any successful RPC with the node.
+func MarkNodeAlive(id proto.NodeID) {
+	liveness.MarkAlive(id)
+}
+
+// NodeFreshness returns the last time the node is seen alive, ok is false if the node is never
+// seen alive or is failing the probes.
+func NodeFreshness(id proto.NodeID) (lastAlive time.Time, ok bool) {
+	var failures int
+	if lastAlive, failures, ok = liveness.Freshness(id); ok {
+		ok = failures == 0 && !lastAlive.IsZero()
+	}
+	return
+}
+
+// PreferAliveNodes returns a copy of the nodes sorted by freshness, the recently alive nodes
+// come first and the failing nodes come last.
+func PreferAliveNodes(ids []proto.NodeID) (sorted []proto.NodeID) {
+	sorted = append([]proto.NodeID(nil), ids...)
+	liveness.SortByFreshness(sorted)
+	return
+}
+
+// knownNodes returns the nodes in the resolver cache except the local node.
+func knownNodes() (ids []proto.NodeID) {
+	initResolver()
+	localID, _ := kms.GetLocalNodeID()
+	resolver.RLock()
+	defer resolver.RUnlock()
+	for k := range resolver.cache {
+		if id := proto.NodeID(k.String()); id != localID {
+			ids = append(ids, id)
+		}
+	}
+	return
+}
+
+// evictNode removes the node from the resolver cache, address book and node table, the block
+// producers are never evicted.
+func evictNode(id proto.NodeID) (evicted bool) {
+	rawID := id.ToRawNodeID()
+	if rawID == nil || IsBPNodeID(rawID) {
+		return
+	}
+	resolver.Lock()
+	delete(resolver.cache, *rawID)
+	resolver.Unlock()
+	if ab := getAddressBook(); ab != nil {
+		ab.Remove(id)
+	}
+	if t := getNodeTable(); t != nil {
+		t.Remove(id)
+	}
+	liveness.Forget(id)
+	return true
+}
+
+// probeNodes probes the due nodes concurrently, returns the nodes evicted.
+func probeNodes(probe ProbeFunc, onEvict func(id proto.NodeID)) (evicted []proto.NodeID) {
+	var (
+		due = liveness.Due(knownNodes())
+		sem = make(chan struct{}, LivenessProbeConcurrency)
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+	)
+	for _, id := range due {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(id proto.NodeID) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			ctx, cancel := context.WithTimeout(context.Background(), LivenessProbeTimeout)
+			defer cancel()
+			err := probe(ctx, id)
+			if err == nil {
+				liveness.MarkAlive(id)
+				return
+			}
+			log.WithField("node", id).WithError(err).Debug("node liveness probe failed")
+			if !liveness.MarkFailed(id) || !evictNode(id) {
+				return
+			}
+			if onEvict != nil {
+				onEvict(id)
+			}
+			mu.Lock()
+			evicted = append(evicted, id)
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return
+}
+
+// StartLivenessProbe probes the nodes in the resolver cache periodically with the probe func,
+// the probing of a failing node backs off exponentially, and the node is evicted from the
+// resolver cache, address book and node table after LivenessMaxFailures consecutive failures.
+// onEvict is called with the evicted nodes if it's not nil. The block producers are probed but
+// never evicted. Call the returned stop func to stop probing.
+func StartLivenessProbe(probe ProbeFunc, onEvict func(id proto.NodeID)) (stop func()) {
+	var (
+		done    = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+	go func() {
+		defer close(stopped)
+		var ticker = time.NewTicker(LivenessProbeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if evicted := probeNodes(probe, onEvict); len(evicted) > 0 {
+					log.WithField("evicted", evicted).Info("evicted stale nodes from routing table")
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+		})
+	}
+	return
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestLivenessTable(t *testing.T) {
+	Convey("Given a liveness table", t, func() {
+		var (
+			now   = time.Now()
+			table = NewLivenessTable()
+			nodeA = proto.NodeID("00000000000000000000000000000000000000000000000000000000000000aa")
+			nodeB = proto.NodeID("00000000000000000000000000000000000000000000000000000000000000bb")
+			nodeC = proto.NodeID("00000000000000000000000000000000000000000000000000000000000000cc")
+		)
+		table.now = func() time.Time { return now }
+
+		Convey("The unknown nodes should be due", func() {
+			So(table.Due([]proto.NodeID{nodeA, nodeB}), ShouldResemble, []proto.NodeID{nodeA, nodeB})
+			_, _, ok := table.Freshness(nodeA)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("The alive node should be probed after the interval", func() {
+			table.MarkAlive(nodeA)
+			So(table.Due([]proto.NodeID{nodeA}), ShouldBeEmpty)
+			lastAlive, failures, ok := table.Freshness(nodeA)
+			So(ok, ShouldBeTrue)
+			So(lastAlive, ShouldEqual, now)
+			So(failures, ShouldEqual, 0)
+
+			now = now.Add(LivenessProbeInterval)
+			So(table.Due([]proto.NodeID{nodeA}), ShouldResemble, []proto.NodeID{nodeA})
+		})
+
+		Convey("The failing node should back off and be evicted", func() {
+			var start = now
+			for i := 1; i < LivenessMaxFailures; i++ {
+				So(table.MarkFailed(nodeA), ShouldBeFalse)
+			}
+			So(table.Due([]proto.NodeID{nodeA}), ShouldBeEmpty)
+			now = start.Add(LivenessProbeInterval << uint(LivenessMaxFailures-2))
+			So(table.Due([]proto.NodeID{nodeA}), ShouldResemble, []proto.NodeID{nodeA})
+			So(table.MarkFailed(nodeA), ShouldBeTrue)
+
+			table.MarkAlive(nodeA)
+			_, failures, _ := table.Freshness(nodeA)
+			So(failures, ShouldEqual, 0)
+		})
+
+		Convey("The backoff should be capped", func() {
+			for i := 0; i < 20; i++ {
+				table.MarkFailed(nodeA)
+			}
+			now = now.Add(LivenessMaxBackoff)
+			So(table.Due([]proto.NodeID{nodeA}), ShouldResemble, []proto.NodeID{nodeA})
+		})
+
+		Convey("The recently alive nodes should be preferred", func() {
+			table.MarkAlive(nodeA)
+			now = now.Add(time.Second)
+			table.MarkAlive(nodeB)
+			table.MarkFailed(nodeA)
+			var (
+				unknown = proto.NodeID("00000000000000000000000000000000000000000000000000000000000000dd")
+				ids     = []proto.NodeID{nodeA, unknown, nodeC, nodeB}
+			)
+			table.MarkAlive(nodeC)
+			now = now.Add(time.Second)
+			table.MarkAlive(nodeB)
+			table.SortByFreshness(ids)
+			So(ids, ShouldResemble, []proto.NodeID{nodeB, nodeC, unknown, nodeA})
+		})
+	})
+}
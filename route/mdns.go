@@ -0,0 +1,430 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/pow/cpuminer"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultMDNSService is the default mDNS service name of peers.
+	DefaultMDNSService = "_sqless._udp.local."
+
+	defaultMDNSInterval = 10 * time.Second
+	mdnsGroupAddr       = "224.0.0.251:5353"
+	mdnsTTL             = 120
+	mdnsMaxPacketSize   = 9000
+	dnsTypeANY          = 255
+	dnsFlagAA           = 1 << 10
+)
+
+// MDNSDiscovery announces this node and discovers the peers on the local network. Every node
+// answers the TXT query of the service name with a record carrying its node info, and the
+// answers of other nodes are validated against their node ID before use.
+type MDNSDiscovery struct {
+	service string
+	self    *proto.Node
+	onNode  func(node *proto.Node)
+	group   *net.UDPAddr
+	conn    *net.UDPConn
+	wg      sync.WaitGroup
+}
+
+// NewMDNSDiscovery joins the mDNS multicast group on the interface, the system default one is
+// used if ifi is nil. The self node is announced if it is not nil, and onNode is called with
+// every valid node announced by the peers.
+func NewMDNSDiscovery(
+	service string, ifi *net.Interface, self *proto.Node, onNode func(node *proto.Node),
+) (d *MDNSDiscovery, err error) {
+	var group *net.UDPAddr
+	if group, err = net.ResolveUDPAddr("udp4", mdnsGroupAddr); err != nil {
+		return
+	}
+	var conn *net.UDPConn
+	if conn, err = net.ListenMulticastUDP("udp4", ifi, group); err != nil {
+		err = errors.Wrap(err, "join mDNS multicast group failed")
+		return
+	}
+	d = &MDNSDiscovery{
+		service: fqdn(service),
+		self:    self,
+		onNode:  onNode,
+		group:   group,
+		conn:    conn,
+	}
+	d.wg.Add(1)
+	go d.serve()
+	return
+}
+
+// Announce multicasts the info of this node.
+func (d *MDNSDiscovery) Announce() (err error) {
+	if d.self == nil {
+		return
+	}
+	var msg []byte
+	if msg, err = buildMDNSResponse(d.service, d.self); err != nil {
+		return
+	}
+	_, err = d.conn.WriteToUDP(msg, d.group)
+	return
+}
+
+// Query asks the peers on the local network to announce themselves.
+func (d *MDNSDiscovery) Query() (err error) {
+	_, err = d.conn.WriteToUDP(buildDNSQuery(0, d.service, dnsTypeTXT, 0), d.group)
+	return
+}
+
+// Close leaves the multicast group and stops serving.
+func (d *MDNSDiscovery) Close() (err error) {
+	err = d.conn.Close()
+	d.wg.Wait()
+	return
+}
+
+func (d *MDNSDiscovery) serve() {
+	defer d.wg.Done()
+	var buf = make([]byte, mdnsMaxPacketSize)
+	for {
+		n, src, err := d.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		d.handle(buf[:n], src)
+	}
+}
+
+func (d *MDNSDiscovery) handle(msg []byte, src *net.UDPAddr) {
+	if len(msg) < dnsHeaderLen {
+		return
+	}
+	if binary.BigEndian.Uint16(msg[2:])&dnsFlagQR == 0 {
+		if mdnsAsks(msg, d.service) {
+			if err := d.Announce(); err != nil {
+				log.WithError(err).Debug("answer mDNS query failed")
+			}
+		}
+		return
+	}
+	m, err := parseDNSMsg(msg)
+	if err != nil {
+		return
+	}
+	for _, rr := range m.Answer {
+		if rr.Type != dnsTypeTXT || rr.Name != d.service {
+			continue
+		}
+		node, err := decodeMDNSNode(rr.Data, src.IP)
+		if err != nil {
+			log.WithField("src", src).WithError(err).Debug("invalid mDNS announcement")
+			continue
+		}
+		if d.self != nil && node.ID == d.self.ID {
+			continue
+		}
+		d.onNode(node)
+	}
+}
+
+// mdnsAsks reports whether the query asks for the TXT records of the service.
+func mdnsAsks(msg []byte, service string) bool {
+	var (
+		qd  = int(binary.BigEndian.Uint16(msg[4:]))
+		off = dnsHeaderLen
+	)
+	for i := 0; i < qd; i++ {
+		var (
+			name string
+			err  error
+		)
+		if name, off, err = readName(msg, off); err != nil || off+4 > len(msg) {
+			return false
+		}
+		qtype := binary.BigEndian.Uint16(msg[off:])
+		if name == service && (qtype == dnsTypeTXT || qtype == dnsTypeANY) {
+			return true
+		}
+		off += 4
+	}
+	return false
+}
+
+// encodeMDNSNode encodes the node info to the TXT record data of "key=value" strings.
+func encodeMDNSNode(node *proto.Node) (data []byte, err error) {
+	if node.PublicKey == nil {
+		return nil, errors.New("node has no public key")
+	}
+	var fields = []string{
+		"id=" + string(node.ID),
+		"role=" + node.Role.String(),
+		"addr=" + node.Addr,
+		"pub=" + hex.EncodeToString(node.PublicKey.Serialize()),
+		"nonce=" + hex.EncodeToString(node.Nonce.Bytes()),
+	}
+	for _, f := range fields {
+		if len(f) > 255 {
+			return nil, errors.Errorf("mDNS TXT field too long: %s", f)
+		}
+		data = append(data, byte(len(f)))
+		data = append(data, f...)
+	}
+	return
+}
+
+// decodeMDNSNode decodes the node info from the TXT record data, the unspecified host of the
+// address is replaced by the source ip of the announcement.
+func decodeMDNSNode(data []byte, src net.IP) (node *proto.Node, err error) {
+	var fields = make(map[string]string)
+	for len(data) > 0 {
+		l := int(data[0])
+		if 1+l > len(data) {
+			return nil, errDNSMsgTruncated
+		}
+		if kv := strings.SplitN(string(data[1:1+l]), "=", 2); len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+		data = data[1+l:]
+	}
+
+	var pubBuf, nonceBuf []byte
+	if pubBuf, err = hex.DecodeString(fields["pub"]); err != nil {
+		return nil, errors.Wrap(err, "decode public key failed")
+	}
+	var pubKey asymmetric.PublicKey
+	if err = pubKey.UnmarshalBinary(pubBuf); err != nil {
+		return nil, errors.Wrap(err, "decode public key failed")
+	}
+	if nonceBuf, err = hex.DecodeString(fields["nonce"]); err != nil {
+		return nil, errors.Wrap(err, "decode nonce failed")
+	}
+	var nonce *cpuminer.Uint256
+	if nonce, err = cpuminer.Uint256FromBytes(nonceBuf); err != nil {
+		return nil, errors.Wrap(err, "decode nonce failed")
+	}
+	var id *hash.Hash
+	if id, err = hash.NewHashFromStr(fields["id"]); err != nil {
+		return nil, errors.Wrap(err, "decode node id failed")
+	}
+	if keyHash := cpuminer.HashBlock(pubKey.Serialize(), *nonce); !keyHash.IsEqual(id) {
+		return nil, errors.Errorf("node id %s mismatches public key and nonce", fields["id"])
+	}
+
+	var role proto.ServerRole
+	switch strings.ToLower(fields["role"]) {
+	case "leader":
+		role = proto.Leader
+	case "follower":
+		role = proto.Follower
+	case "miner":
+		role = proto.Miner
+	default:
+		return nil, errors.Errorf("unsupported node role: %s", fields["role"])
+	}
+
+	host, port, err := net.SplitHostPort(fields["addr"])
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid node address")
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = src.String()
+	}
+
+	node = &proto.Node{
+		ID:        proto.NodeID(fields["id"]),
+		Role:      role,
+		Addr:      net.JoinHostPort(host, port),
+		PublicKey: &pubKey,
+		Nonce:     *nonce,
+	}
+	return
+}
+
+// buildMDNSResponse builds the unsolicited response announcing the node.
+func buildMDNSResponse(service string, node *proto.Node) (msg []byte, err error) {
+	var data []byte
+	if data, err = encodeMDNSNode(node); err != nil {
+		return
+	}
+	msg = make([]byte, dnsHeaderLen, 512)
+	binary.BigEndian.PutUint16(msg[2:], dnsFlagQR|dnsFlagAA)
+	binary.BigEndian.PutUint16(msg[6:], 1) // ancount
+	msg = appendName(msg, service)
+	var rr [10]byte
+	binary.BigEndian.PutUint16(rr[0:], dnsTypeTXT)
+	binary.BigEndian.PutUint16(rr[2:], dnsClassINET)
+	binary.BigEndian.PutUint32(rr[4:], mdnsTTL)
+	binary.BigEndian.PutUint16(rr[8:], uint16(len(data)))
+	msg = append(msg, rr[:]...)
+	msg = append(msg, data...)
+	return
+}
+
+// mdnsSelfNode returns the node info of this node to announce, nil if this node only discovers
+// the peers.
+func mdnsSelfNode(cfg *conf.MDNSDiscovery) (node *proto.Node, err error) {
+	var role = cfg.Role
+	if role == proto.Unknown {
+		for _, n := range conf.GConf.KnownNodes {
+			if n.ID == conf.GConf.ThisNodeID {
+				role = n.Role
+				break
+			}
+		}
+	}
+	if role == proto.Unknown && conf.GConf.Miner != nil {
+		role = proto.Miner
+	}
+	switch role {
+	case proto.Leader, proto.Follower, proto.Miner:
+	default:
+		return
+	}
+
+	node = &proto.Node{
+		Role: role,
+		Addr: conf.GConf.ExternalListenAddr,
+	}
+	if node.Addr == "" {
+		node.Addr = conf.GConf.ListenAddr
+	}
+	if node.ID, err = kms.GetLocalNodeID(); err != nil {
+		return nil, err
+	}
+	if node.PublicKey, err = kms.GetLocalPublicKey(); err != nil {
+		return nil, err
+	}
+	var nonce *cpuminer.Uint256
+	if nonce, err = kms.GetLocalNonce(); err != nil {
+		return nil, err
+	}
+	node.Nonce = *nonce
+	return
+}
+
+// applyMDNSNode feeds the discovered node into the route layer, the block producers are added
+// to the known BPs.
+func applyMDNSNode(node *proto.Node) {
+	var rawID = node.ID.ToRawNodeID()
+	if rawID == nil {
+		return
+	}
+	initResolver()
+	if cached, err := GetNodeAddrCache(rawID); err == nil && cached == node.Addr {
+		return
+	}
+	if err := kms.SetNode(node); err != nil {
+		log.WithField("node", node.ID).WithError(err).Warning("set mDNS peer in kms failed")
+		return
+	}
+	_ = SetNodeAddrCache(rawID, node.Addr)
+	RecordNode(node)
+	if node.Role == proto.Leader || node.Role == proto.Follower {
+		resolver.Lock()
+		resolver.bpNodes[*rawID] = *node
+		resolver.bpNodeIDs[*rawID] = node.Addr
+		resolver.Unlock()
+	}
+	log.WithFields(log.Fields{
+		"node": node.ID,
+		"role": node.Role,
+		"addr": node.Addr,
+	}).Info("mDNS peer discovered")
+}
+
+// StartMDNSDiscovery starts announcing and discovering peers on the local network if
+// conf.GConf.MDNS is set. Call the returned stop func to stop it.
+func StartMDNSDiscovery() (stop func(), err error) {
+	stop = func() {}
+	if conf.GConf == nil || conf.GConf.MDNS == nil {
+		return
+	}
+	var (
+		cfg      = conf.GConf.MDNS
+		service  = cfg.Service
+		interval = cfg.Interval
+		ifi      *net.Interface
+		self     *proto.Node
+	)
+	if service == "" {
+		service = DefaultMDNSService
+	}
+	if interval <= 0 {
+		interval = defaultMDNSInterval
+	}
+	if cfg.Interface != "" {
+		if ifi, err = net.InterfaceByName(cfg.Interface); err != nil {
+			err = errors.Wrapf(err, "invalid mDNS interface %s", cfg.Interface)
+			return
+		}
+	}
+	if self, err = mdnsSelfNode(cfg); err != nil {
+		err = errors.Wrap(err, "get local node info failed")
+		return
+	}
+	d, err := NewMDNSDiscovery(service, ifi, self, applyMDNSNode)
+	if err != nil {
+		return
+	}
+	var (
+		done  = make(chan struct{})
+		round = func() {
+			if err := d.Announce(); err != nil {
+				log.WithError(err).Warning("mDNS announce failed")
+			}
+			if err := d.Query(); err != nil {
+				log.WithError(err).Warning("mDNS query failed")
+			}
+		}
+	)
+	round()
+	go func() {
+		var ticker = time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				round()
+			}
+		}
+	}()
+	stop = func() {
+		close(done)
+		_ = d.Close()
+	}
+	return
+}
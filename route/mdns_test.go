@@ -0,0 +1,95 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/hex"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/pow/cpuminer"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestMDNSAnnouncement(t *testing.T) {
+	Convey("Given a node announced via mDNS", t, func() {
+		var pub asymmetric.PublicKey
+		pubKeyBytes, _ := hex.DecodeString("02c76216704d797c64c58bc11519fb68582e8e63de7e5b3b2dbbbe8733efe5fd24")
+		So(pub.UnmarshalBinary(pubKeyBytes), ShouldBeNil)
+		node := &proto.Node{
+			ID:        proto.NodeID("00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9"),
+			Role:      proto.Leader,
+			Addr:      "0.0.0.0:3122",
+			PublicKey: &pub,
+			Nonce:     cpuminer.Uint256{A: 313283},
+		}
+		src := net.ParseIP("192.168.1.10")
+		msg, err := buildMDNSResponse(DefaultMDNSService, node)
+		So(err, ShouldBeNil)
+
+		Convey("The peers should decode the node with the source address", func() {
+			var found []*proto.Node
+			d := &MDNSDiscovery{
+				service: DefaultMDNSService,
+				onNode:  func(n *proto.Node) { found = append(found, n) },
+			}
+			d.handle(msg, &net.UDPAddr{IP: src, Port: 5353})
+			So(found, ShouldHaveLength, 1)
+			So(found[0].ID, ShouldEqual, node.ID)
+			So(found[0].Role, ShouldEqual, proto.Leader)
+			So(found[0].Addr, ShouldEqual, "192.168.1.10:3122")
+			So(found[0].Nonce, ShouldResemble, node.Nonce)
+			So(found[0].PublicKey.IsEqual(&pub), ShouldBeTrue)
+
+			Convey("The node should not discover itself", func() {
+				found = nil
+				d.self = node
+				d.handle(msg, &net.UDPAddr{IP: src, Port: 5353})
+				So(found, ShouldBeEmpty)
+			})
+			Convey("The announcement of other services should be ignored", func() {
+				found = nil
+				d.service = fqdn("_other._udp.local")
+				d.handle(msg, &net.UDPAddr{IP: src, Port: 5353})
+				So(found, ShouldBeEmpty)
+			})
+		})
+		Convey("The announced address should be kept if specified", func() {
+			node.Addr = "10.0.0.2:3122"
+			data, err := encodeMDNSNode(node)
+			So(err, ShouldBeNil)
+			decoded, err := decodeMDNSNode(data, src)
+			So(err, ShouldBeNil)
+			So(decoded.Addr, ShouldEqual, "10.0.0.2:3122")
+		})
+		Convey("The node id not matching the key and nonce should be rejected", func() {
+			node.Nonce = cpuminer.Uint256{A: 313284}
+			data, err := encodeMDNSNode(node)
+			So(err, ShouldBeNil)
+			_, err = decodeMDNSNode(data, src)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("The query of the service should be answered", func() {
+			So(mdnsAsks(buildDNSQuery(0, DefaultMDNSService, dnsTypeTXT, 0), DefaultMDNSService), ShouldBeTrue)
+			So(mdnsAsks(buildDNSQuery(0, DefaultMDNSService, dnsTypeAAAA, 0), DefaultMDNSService), ShouldBeFalse)
+			So(mdnsAsks(buildDNSQuery(0, "_other._udp.local.", dnsTypeTXT, 0), DefaultMDNSService), ShouldBeFalse)
+		})
+	})
+}
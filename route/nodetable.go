@@ -0,0 +1,337 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/syndtr/goleveldb/leveldb"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/utils"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+var (
+	// NodeTableMaxAge is the max age of the nodes loaded from the node table, the nodes not seen
+	// for longer are pruned.
+	NodeTableMaxAge = 7 * 24 * time.Hour
+	// NodeTableCheckpointInterval is the interval of checkpointing the node table to disk.
+	NodeTableCheckpointInterval = time.Minute
+)
+
+// nodeTableEntry defines a learned node persisted in the node table.
+type nodeTableEntry struct {
+	Node     proto.Node
+	LastSeen time.Time
+}
+
+// NodeTable persists the nodes learned by the routing layer in a LevelDB, including the block
+// producers. The changes are kept in memory and checkpointed periodically, the table is loaded
+// on restart so that the node rejoins the network without looking up the DNS seed.
+type NodeTable struct {
+	sync.Mutex
+	db      *leveldb.DB
+	entries map[proto.NodeID]*nodeTableEntry
+	dirty   map[proto.NodeID]bool
+	now     func() time.Time
+}
+
+// OpenNodeTable opens the node table at path and loads all the nodes, an empty table is created
+// if it does not exist.
+func OpenNodeTable(path string) (t *NodeTable, err error) {
+	t = &NodeTable{
+		entries: make(map[proto.NodeID]*nodeTableEntry),
+		dirty:   make(map[proto.NodeID]bool),
+		now:     time.Now,
+	}
+	if t.db, err = leveldb.OpenFile(path, nil); err != nil {
+		return nil, errors.Wrapf(err, "open node table %s failed", path)
+	}
+	iter := t.db.NewIterator(nil, nil)
+	defer iter.Release()
+	for iter.Next() {
+		var e = &nodeTableEntry{}
+		if err := utils.DecodeMsgPack(iter.Value(), e); err != nil {
+			log.WithField("node", string(iter.Key())).WithError(err).Warning(
+				"decode node table entry failed")
+			continue
+		}
+		if e.Node.ID.IsEmpty() || e.Node.Addr == "" {
+			continue
+		}
+		t.entries[e.Node.ID] = e
+	}
+	if err = iter.Error(); err != nil {
+		_ = t.db.Close()
+		return nil, errors.Wrapf(err, "load node table %s failed", path)
+	}
+	return
+}
+
+// Record records the node and updates its last-seen time.
+func (t *NodeTable) Record(node *proto.Node) {
+	if node == nil || node.ID.IsEmpty() || node.Addr == "" {
+		return
+	}
+	t.Lock()
+	defer t.Unlock()
+	t.entries[node.ID] = &nodeTableEntry{
+		Node:     *node,
+		LastSeen: t.now().UTC(),
+	}
+	t.dirty[node.ID] = true
+}
+
+// SetAddr updates the address of a recorded node.
+func (t *NodeTable) SetAddr(id proto.NodeID, addr string) {
+	t.Lock()
+	defer t.Unlock()
+	if e, ok := t.entries[id]; ok && addr != "" {
+		e.Node.Addr = addr
+		e.LastSeen = t.now().UTC()
+		t.dirty[id] = true
+	}
+}
+
+// Remove removes the node from the node table.
+func (t *NodeTable) Remove(id proto.NodeID) {
+	t.Lock()
+	defer t.Unlock()
+	if _, ok := t.entries[id]; ok {
+		delete(t.entries, id)
+		t.dirty[id] = true
+	}
+}
+
+// Nodes returns the recorded nodes ordered by node id.
+func (t *NodeTable) Nodes() (nodes []proto.Node) {
+	t.Lock()
+	defer t.Unlock()
+	nodes = make([]proto.Node, 0, len(t.entries))
+	for _, e := range t.entries {
+		nodes = append(nodes, e.Node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return
+}
+
+// BPNodes returns the recorded block producers, the nodes with invalid id, public key and nonce
+// are skipped.
+func (t *NodeTable) BPNodes() (bpNodes IDNodeMap) {
+	bpNodes = make(IDNodeMap)
+	for _, n := range t.Nodes() {
+		if n.Role != proto.Leader && n.Role != proto.Follower {
+			continue
+		}
+		rawID := n.ID.ToRawNodeID()
+		if rawID == nil || !kms.IsIDPubNonceValid(rawID, &n.Nonce, n.PublicKey) {
+			log.WithField("node", n.ID).Warning("skip invalid BP in node table")
+			continue
+		}
+		bpNodes[*rawID] = n
+	}
+	return
+}
+
+// Prune removes the nodes not seen for longer than maxAge, returns the number of removed nodes.
+func (t *NodeTable) Prune(maxAge time.Duration) (pruned int) {
+	t.Lock()
+	defer t.Unlock()
+	var deadline = t.now().Add(-maxAge)
+	for id, e := range t.entries {
+		if e.LastSeen.Before(deadline) {
+			delete(t.entries, id)
+			t.dirty[id] = true
+			pruned++
+		}
+	}
+	return
+}
+
+// Checkpoint writes the changed nodes to disk in a single batch.
+func (t *NodeTable) Checkpoint() (err error) {
+	t.Lock()
+	defer t.Unlock()
+	if len(t.dirty) == 0 {
+		return
+	}
+	var batch = new(leveldb.Batch)
+	for id := range t.dirty {
+		e, ok := t.entries[id]
+		if !ok {
+			batch.Delete([]byte(id))
+			continue
+		}
+		buf, err := utils.EncodeMsgPack(e)
+		if err != nil {
+			return errors.Wrapf(err, "encode node table entry %s failed", id)
+		}
+		batch.Put([]byte(id), buf.Bytes())
+	}
+	if err = t.db.Write(batch, nil); err != nil {
+		return errors.Wrap(err, "checkpoint node table failed")
+	}
+	t.dirty = make(map[proto.NodeID]bool)
+	return
+}
+
+// Close checkpoints and closes the node table.
+func (t *NodeTable) Close() (err error) {
+	if err = t.Checkpoint(); err != nil {
+		log.WithError(err).Warning("checkpoint node table failed")
+	}
+	return t.db.Close()
+}
+
+// nodeTable is the node table of the running node.
+var nodeTable struct {
+	sync.RWMutex
+	table *NodeTable
+}
+
+func getNodeTable() *NodeTable {
+	nodeTable.RLock()
+	defer nodeTable.RUnlock()
+	return nodeTable.table
+}
+
+// openNodeTable opens the node table if conf.GConf.NodeTableFile is set, it's opened once and
+// kept until the node table is stopped.
+func openNodeTable() (t *NodeTable) {
+	if conf.GConf == nil || conf.GConf.NodeTableFile == "" {
+		return
+	}
+	nodeTable.Lock()
+	defer nodeTable.Unlock()
+	if nodeTable.table != nil {
+		return nodeTable.table
+	}
+	var err error
+	if t, err = OpenNodeTable(conf.GConf.NodeTableFile); err != nil {
+		log.WithError(err).Warning("open node table failed")
+		return nil
+	}
+	if pruned := t.Prune(NodeTableMaxAge); pruned > 0 {
+		log.WithField("pruned", pruned).Info("pruned stale nodes from node table")
+	}
+	nodeTable.table = t
+	return
+}
+
+// loadTableBPs returns the block producers warm-loaded from the node table.
+func loadTableBPs() (bpNodes IDNodeMap) {
+	if t := openNodeTable(); t != nil {
+		bpNodes = t.BPNodes()
+	}
+	return
+}
+
+// RecordNode records a learned node to the node table if it is opened.
+func RecordNode(node *proto.Node) {
+	if t := getNodeTable(); t != nil {
+		t.Record(node)
+	}
+}
+
+// recordNodeAddr records the resolved node address to the node table if it is opened.
+func recordNodeAddr(id *proto.RawNodeID, addr string) {
+	if t := getNodeTable(); t != nil {
+		t.SetAddr(proto.NodeID(id.String()), addr)
+	}
+}
+
+// StartNodeTable warm-loads the nodes of the node table if conf.GConf.NodeTableFile is set. The
+// block producers are loaded on resolver initialization instead of looking up the DNS seed,
+// the other nodes are added to the resolver cache and the public key store unless they are
+// known already. The learned nodes are checkpointed periodically, call the returned stop func
+// to stop, checkpoint and close the node table.
+func StartNodeTable() (stop func(), err error) {
+	stop = func() {}
+	if conf.GConf == nil || conf.GConf.NodeTableFile == "" {
+		return
+	}
+	initResolver()
+	var t = openNodeTable()
+	if t == nil {
+		err = errors.Errorf("open node table %s failed", conf.GConf.NodeTableFile)
+		return
+	}
+	var loaded int
+	for _, n := range t.Nodes() {
+		rawID := n.ID.ToRawNodeID()
+		if rawID == nil {
+			continue
+		}
+		if _, err := GetNodeAddrCache(rawID); err == nil {
+			continue
+		}
+		resolver.Lock()
+		resolver.cache[*rawID] = n.Addr
+		resolver.Unlock()
+		if _, err := kms.GetNodeInfo(n.ID); err != nil {
+			var node = n
+			if err = kms.SetNode(&node); err != nil {
+				log.WithField("node", n.ID).WithError(err).Debug("set node table node in kms failed")
+			}
+		}
+		loaded++
+	}
+	log.WithFields(log.Fields{
+		"file":   conf.GConf.NodeTableFile,
+		"loaded": loaded,
+	}).Info("loaded nodes from node table")
+
+	var (
+		done    = make(chan struct{})
+		stopped = make(chan struct{})
+	)
+	go func() {
+		defer close(stopped)
+		var ticker = time.NewTicker(NodeTableCheckpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := t.Checkpoint(); err != nil {
+					log.WithError(err).Warning("checkpoint node table failed")
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(done)
+			<-stopped
+			nodeTable.Lock()
+			nodeTable.table = nil
+			nodeTable.Unlock()
+			if err := t.Close(); err != nil {
+				log.WithError(err).Warning("close node table failed")
+			}
+		})
+	}
+	return
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestNodeTable(t *testing.T) {
+	Convey("Given a node table", t, func() {
+		dir, err := ioutil.TempDir("", "nodetable")
+		So(err, ShouldBeNil)
+		defer func() { _ = os.RemoveAll(dir) }()
+
+		var (
+			path  = filepath.Join(dir, "nodes.ldb")
+			now   = time.Now()
+			nodeA = proto.Node{
+				ID:   proto.NodeID("00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9"),
+				Role: proto.Miner,
+				Addr: "127.0.0.1:2120",
+			}
+			nodeB = proto.Node{
+				ID:   proto.NodeID("000000000013fd4b3180dd424d5a895bc57b798e5315087b7198c926d8893f98"),
+				Role: proto.Leader,
+				Addr: "127.0.0.1:2121",
+			}
+		)
+		nt, err := OpenNodeTable(path)
+		So(err, ShouldBeNil)
+		So(nt.Nodes(), ShouldBeEmpty)
+		nt.now = func() time.Time { return now }
+
+		Convey("The learned nodes should be checkpointed and reloaded", func() {
+			nt.Record(&nodeA)
+			nt.Record(&nodeB)
+			nt.Record(&proto.Node{Addr: "127.0.0.1:2122"})
+			nt.SetAddr(nodeA.ID, "127.0.0.1:3120")
+			So(nt.Close(), ShouldBeNil)
+
+			nt, err = OpenNodeTable(path)
+			So(err, ShouldBeNil)
+			nodes := nt.Nodes()
+			So(nodes, ShouldHaveLength, 2)
+			So(nodes[0].ID, ShouldEqual, nodeB.ID)
+			So(nodes[0].Role, ShouldEqual, proto.Leader)
+			So(nodes[1].ID, ShouldEqual, nodeA.ID)
+			So(nodes[1].Addr, ShouldEqual, "127.0.0.1:3120")
+
+			// the BP without valid public key and nonce is not trusted
+			So(nt.BPNodes(), ShouldBeEmpty)
+			So(nt.Close(), ShouldBeNil)
+		})
+		Convey("The stale nodes should be pruned on checkpoint", func() {
+			nt.Record(&nodeA)
+			So(nt.Checkpoint(), ShouldBeNil)
+			nt.now = func() time.Time { return now.Add(time.Hour) }
+			nt.Record(&nodeB)
+			So(nt.Prune(30*time.Minute), ShouldEqual, 1)
+			So(nt.Close(), ShouldBeNil)
+
+			nt, err = OpenNodeTable(path)
+			So(err, ShouldBeNil)
+			nodes := nt.Nodes()
+			So(nodes, ShouldHaveLength, 1)
+			So(nodes[0].ID, ShouldEqual, nodeB.ID)
+			So(nt.Close(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,321 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The authenticated denial of existence, see RFC 4035 Section 5.4 and RFC 5155 Section 8.
+
+const (
+	nsec3HashSHA1     = 1
+	nsec3FlagOptOut   = 1
+	nsec3FixedLen     = 5
+	maxNSEC3Iteration = 150
+)
+
+var nsec3Encoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// nsec defines a parsed NSEC record.
+type nsec struct {
+	Owner string
+	Next  string
+	Types []byte
+}
+
+func parseNSEC(owner string, rdata []byte) (n *nsec, err error) {
+	n = &nsec{Owner: owner}
+	var off int
+	// the next domain name is never compressed
+	if n.Next, off, err = readName(rdata, 0); err != nil {
+		return nil, err
+	}
+	if n.Types = rdata[off:]; !validTypeBitmap(n.Types) {
+		return nil, errors.Errorf("invalid NSEC type bitmap of %s", owner)
+	}
+	return
+}
+
+// covers reports whether the name falls strictly between the owner and the next name.
+func (n *nsec) covers(name string) bool {
+	return canonicalRange(canonicalCompare(n.Owner, name), canonicalCompare(name, n.Next),
+		canonicalCompare(n.Owner, n.Next))
+}
+
+// delegation reports whether the record is owned by a zone cut above the name, the denial of
+// the parent zone proves nothing about the names in the child zone.
+func (n *nsec) delegation(name string) bool {
+	return n.Owner != name && isSubdomain(name, n.Owner) &&
+		hasType(n.Types, dnsTypeNS) && !hasType(n.Types, dnsTypeSOA)
+}
+
+// nsec3 defines a parsed NSEC3 record.
+type nsec3 struct {
+	Zone       string
+	Hash       []byte
+	Flags      uint8
+	Iterations uint16
+	Salt       []byte
+	Next       []byte
+	Types      []byte
+}
+
+func parseNSEC3(owner string, rdata []byte) (n *nsec3, err error) {
+	var labels = nameLabels(owner)
+	if len(labels) < 2 {
+		return nil, errors.Errorf("invalid NSEC3 owner %s", owner)
+	}
+	n = &nsec3{Zone: fqdn(strings.Join(labels[1:], "."))}
+	if n.Hash, err = nsec3Encoding.DecodeString(strings.ToUpper(labels[0])); err != nil {
+		return nil, errors.Wrapf(err, "invalid NSEC3 owner %s", owner)
+	}
+	if len(rdata) < nsec3FixedLen || rdata[0] != nsec3HashSHA1 {
+		return nil, errors.Errorf("unsupported NSEC3 record of %s", owner)
+	}
+	n.Flags = rdata[1]
+	n.Iterations = binary.BigEndian.Uint16(rdata[2:])
+	var off = 5 + int(rdata[4])
+	if off >= len(rdata) || off+1+int(rdata[off]) > len(rdata) {
+		return nil, errDNSMsgTruncated
+	}
+	n.Salt = rdata[5:off]
+	n.Next = rdata[off+1 : off+1+int(rdata[off])]
+	if n.Types = rdata[off+1+int(rdata[off]):]; !validTypeBitmap(n.Types) {
+		return nil, errors.Errorf("invalid NSEC3 type bitmap of %s", owner)
+	}
+	if len(n.Hash) != sha1.Size || len(n.Next) != sha1.Size {
+		return nil, errors.Errorf("invalid NSEC3 hash of %s", owner)
+	}
+	return
+}
+
+// hash returns the hashed name with the parameters of the record.
+func (n *nsec3) hash(name string) []byte {
+	return nsec3Hash(name, n.Salt, n.Iterations)
+}
+
+func (n *nsec3) matches(name string) bool {
+	return isSubdomain(name, n.Zone) && bytes.Equal(n.hash(name), n.Hash)
+}
+
+func (n *nsec3) covers(name string) bool {
+	if !isSubdomain(name, n.Zone) {
+		return false
+	}
+	var h = n.hash(name)
+	return canonicalRange(bytes.Compare(n.Hash, h), bytes.Compare(h, n.Next), bytes.Compare(n.Hash, n.Next))
+}
+
+func nsec3Hash(name string, salt []byte, iterations uint16) []byte {
+	var h = sha1.Sum(append(appendName(nil, fqdn(name)), salt...))
+	for i := 0; i < int(iterations); i++ {
+		h = sha1.Sum(append(h[:], salt...))
+	}
+	return h[:]
+}
+
+// canonicalRange reports whether a name is strictly between the owner and the next name by the
+// comparison results, the last record of the chain wraps around to the first.
+func canonicalRange(ownerName, nameNext, ownerNext int) bool {
+	if ownerNext < 0 {
+		return ownerName < 0 && nameNext < 0
+	}
+	return ownerName < 0 || nameNext < 0
+}
+
+// canonicalCompare compares the names in the canonical DNS name order, see RFC 4034 Section 6.1.
+func canonicalCompare(a, b string) int {
+	var la, lb = nameLabels(a), nameLabels(b)
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(la[i], lb[j]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(la) < len(lb):
+		return -1
+	case len(la) > len(lb):
+		return 1
+	default:
+		return 0
+	}
+}
+
+// commonAncestor returns the longest common ancestor of the names.
+func commonAncestor(a, b string) string {
+	var (
+		la, lb = nameLabels(a), nameLabels(b)
+		n      int
+	)
+	for n < len(la) && n < len(lb) && la[len(la)-1-n] == lb[len(lb)-1-n] {
+		n++
+	}
+	return fqdn(strings.Join(la[len(la)-n:], "."))
+}
+
+// parentName returns the name without the leftmost label.
+func parentName(name string) string {
+	var labels = nameLabels(name)
+	if len(labels) == 0 {
+		return "."
+	}
+	return fqdn(strings.Join(labels[1:], "."))
+}
+
+// wildcardName returns the wildcard name of the closest encloser.
+func wildcardName(ce string) string {
+	return fqdn("*." + strings.TrimSuffix(fqdn(ce), "."))
+}
+
+func validTypeBitmap(b []byte) bool {
+	for len(b) > 0 {
+		if len(b) < 2 || b[1] == 0 || b[1] > 32 || len(b) < 2+int(b[1]) {
+			return false
+		}
+		b = b[2+int(b[1]):]
+	}
+	return true
+}
+
+// hasType reports whether the type is set in the NSEC/NSEC3 type bitmap.
+func hasType(b []byte, t uint16) bool {
+	var (
+		window = byte(t >> 8)
+		bit    = int(t & 0xff)
+	)
+	for len(b) >= 2 && len(b) >= 2+int(b[1]) {
+		if b[0] == window {
+			return bit/8 < int(b[1]) && b[2+bit/8]&(0x80>>uint(bit%8)) != 0
+		}
+		b = b[2+int(b[1]):]
+	}
+	return false
+}
+
+// denialRecords returns the validated NSEC and NSEC3 records of the authority section, the
+// records are signed by a zone enclosing the name.
+func (v *DNSSECValidator) denialRecords(name string, rrs []dnsRR) (nsecs []*nsec, nsec3s []*nsec3) {
+	var seen = make(map[string]bool)
+	for _, rr := range rrs {
+		if rr.Type != dnsTypeNSEC && rr.Type != dnsTypeNSEC3 || seen[rr.Name] {
+			continue
+		}
+		seen[rr.Name] = true
+		set, all := splitRRSet(rrs, rr.Name, rr.Type)
+		var sigs []*rrsig
+		for _, sig := range all {
+			if isSubdomain(name, sig.SignerName) {
+				sigs = append(sigs, sig)
+			}
+		}
+		if len(set) != 1 || len(sigs) == 0 || v.verifyRRSet(rr.Name, set, sigs, 0) != nil {
+			continue
+		}
+		if rr.Type == dnsTypeNSEC {
+			if n, err := parseNSEC(rr.Name, set[0].Data); err == nil {
+				nsecs = append(nsecs, n)
+			}
+		} else if n, err := parseNSEC3(rr.Name, set[0].Data); err == nil && n.Iterations <= maxNSEC3Iteration {
+			nsec3s = append(nsec3s, n)
+		}
+	}
+	return
+}
+
+// verifyDenial validates the denial of existence of the RRset in a negative response, an
+// unproven negative response of a name under the trust anchors is bogus.
+func (v *DNSSECValidator) verifyDenial(name string, t uint16, m *dnsMsg) (err error) {
+	name = fqdn(name)
+	var (
+		nx            = m.rcode() == dnsRcodeNXDomain
+		nsecs, nsec3s = v.denialRecords(name, m.Authority)
+	)
+	if deniedByNSEC(name, t, nx, nsecs) || deniedByNSEC3(name, t, nx, nsec3s) {
+		return errors.Wrapf(ErrDNSNotFound, "lookup %s", name)
+	}
+	return errors.Wrapf(ErrDNSSECBogus, "no authenticated denial of %s", name)
+}
+
+func deniedByNSEC(name string, t uint16, nx bool, nsecs []*nsec) bool {
+	if !nx {
+		for _, n := range nsecs {
+			if n.Owner == name {
+				return !hasType(n.Types, t) && !hasType(n.Types, dnsTypeCNAME)
+			}
+		}
+		return false
+	}
+	var cover = func(name string) *nsec {
+		for _, n := range nsecs {
+			if n.covers(name) && !n.delegation(name) {
+				return n
+			}
+		}
+		return nil
+	}
+	var n = cover(name)
+	if n == nil {
+		return false
+	}
+	// the wildcard of the closest encloser must not exist either
+	var ce = commonAncestor(name, n.Owner)
+	if next := commonAncestor(name, n.Next); len(next) > len(ce) {
+		ce = next
+	}
+	return cover(wildcardName(ce)) != nil
+}
+
+func deniedByNSEC3(name string, t uint16, nx bool, nsec3s []*nsec3) bool {
+	var match = func(name string) *nsec3 {
+		for _, n := range nsec3s {
+			if n.matches(name) {
+				return n
+			}
+		}
+		return nil
+	}
+	var cover = func(name string) bool {
+		for _, n := range nsec3s {
+			if n.Flags&nsec3FlagOptOut == 0 && n.covers(name) {
+				return true
+			}
+		}
+		return false
+	}
+	if !nx {
+		n := match(name)
+		return n != nil && !hasType(n.Types, t) && !hasType(n.Types, dnsTypeCNAME)
+	}
+	// the closest encloser proof, see RFC 5155 Section 8.3
+	for nextCloser, ce := name, parentName(name); nextCloser != "."; nextCloser, ce = ce, parentName(ce) {
+		if n := match(ce); n != nil {
+			if hasType(n.Types, dnsTypeNS) && !hasType(n.Types, dnsTypeSOA) {
+				// a zone cut of the parent zone
+				return false
+			}
+			return cover(nextCloser) && cover(wildcardName(ce))
+		}
+	}
+	return false
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/utils"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// MaxProvisionTokenTTL defines the max lifetime of a provisioning token.
+const MaxProvisionTokenTTL = 24 * time.Hour
+
+// ProvisionLedger defines the replicated record of used provisioning tokens, which is kept in the
+// block producer chain so that a token can not be used again on another block producer or after
+// restart.
+type ProvisionLedger interface {
+	// IsProvisionTokenUsed returns whether the token nonce is recorded or pending on chain.
+	IsProvisionTokenUsed(nonce uint64) bool
+	// RecordProvisionToken records the token used by the node on chain.
+	RecordProvisionToken(t *proto.ProvisionToken, node proto.NodeID) error
+}
+
+// provisionLedger holds the ledger set by the block producer chain, and the tokens being
+// provisioned locally which are not recorded yet.
+var provisionLedger = struct {
+	sync.Mutex
+	ledger  ProvisionLedger
+	pending map[uint64]struct{}
+}{
+	pending: make(map[uint64]struct{}),
+}
+
+// SetProvisionLedger sets the ledger recording the used provisioning tokens.
+func SetProvisionLedger(l ProvisionLedger) {
+	provisionLedger.Lock()
+	defer provisionLedger.Unlock()
+	provisionLedger.ledger = l
+}
+
+// reserveProvisionToken reserves the token for a provisioning in progress, the returned release
+// func must be called after the token is recorded or the provisioning failed.
+func reserveProvisionToken(t *proto.ProvisionToken) (ledger ProvisionLedger, release func(), err error) {
+	provisionLedger.Lock()
+	defer provisionLedger.Unlock()
+	if ledger = provisionLedger.ledger; ledger == nil {
+		err = fmt.Errorf("provisioning is not served by this node")
+		return
+	}
+	if _, ok := provisionLedger.pending[t.Nonce]; ok || ledger.IsProvisionTokenUsed(t.Nonce) {
+		err = fmt.Errorf("provisioning token is already used")
+		return
+	}
+	provisionLedger.pending[t.Nonce] = struct{}{}
+	release = func() {
+		provisionLedger.Lock()
+		defer provisionLedger.Unlock()
+		delete(provisionLedger.pending, t.Nonce)
+	}
+	return
+}
+
+// EncodeProvisionToken encodes the provisioning token to a printable string.
+func EncodeProvisionToken(t *proto.ProvisionToken) (s string, err error) {
+	buf, err := utils.EncodeMsgPack(t)
+	if err != nil {
+		return
+	}
+	s = base64.RawURLEncoding.EncodeToString(buf.Bytes())
+	return
+}
+
+// DecodeProvisionToken decodes the provisioning token from string.
+func DecodeProvisionToken(s string) (t *proto.ProvisionToken, err error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		err = errors.Wrap(err, "decode provisioning token failed")
+		return
+	}
+	t = &proto.ProvisionToken{}
+	if err = utils.DecodeMsgPack(data, t); err != nil {
+		t = nil
+		err = errors.Wrap(err, "decode provisioning token failed")
+	}
+	return
+}
+
+// checkProvisionToken checks if the token is valid for the node.
+func checkProvisionToken(t *proto.ProvisionToken, node *proto.Node) (err error) {
+	if err = t.Verify(); err != nil {
+		return
+	}
+	issuer, err := crypto.PubKeyHash(t.Signee)
+	if err != nil {
+		return
+	}
+	var permitted bool
+	for _, v := range conf.GConf.ProvisionIssuers {
+		permitted = permitted || v == issuer
+	}
+	if !permitted {
+		return fmt.Errorf("provisioning token issuer %s is not permitted", issuer)
+	}
+	if now := time.Now(); t.Expire.Before(now) || t.Expire.After(now.Add(MaxProvisionTokenTTL)) {
+		return fmt.Errorf("provisioning token expired or lifetime too long: %s", t.Expire)
+	}
+	if t.Role != node.Role {
+		return fmt.Errorf("provisioning token is for %s, not %s", t.Role, node.Role)
+	}
+	return
+}
+
+// checkProvisioned checks if the pinging node is provisioned. If provisioning is enforced by
+// ProvisionIssuers, ping could only refresh a node already provisioned and is called by the
+// node itself.
+func checkProvisioned(caller *proto.RawNodeID, node *proto.Node) (err error) {
+	if conf.GConf == nil || len(conf.GConf.ProvisionIssuers) == 0 {
+		return
+	}
+	if caller == nil || caller.IsEqual(&kms.AnonymousRawNodeID.Hash) || caller.ToNodeID() != node.ID {
+		err = fmt.Errorf("node: %s must be provisioned before ping", node.ID)
+		log.Error(err)
+		return
+	}
+	known, ierr := kms.GetNodeInfo(node.ID)
+	if ierr != nil || known.PublicKey == nil || node.PublicKey == nil || !known.PublicKey.IsEqual(node.PublicKey) {
+		err = fmt.Errorf("node: %s is not provisioned", node.ID)
+		log.Error(err)
+	}
+	return
+}
+
+// provisionConfig returns the network part of the local config for the provisioned node.
+func provisionConfig() *conf.Config {
+	var c = &conf.Config{
+		DNSSeed:             conf.GConf.DNSSeed,
+		BP:                  conf.GConf.BP,
+		QPS:                 conf.GConf.QPS,
+		ChainBusPeriod:      conf.GConf.ChainBusPeriod,
+		BillingBlockCount:   conf.GConf.BillingBlockCount,
+		BPPeriod:            conf.GConf.BPPeriod,
+		BPTick:              conf.GConf.BPTick,
+		SQLChainPeriod:      conf.GConf.SQLChainPeriod,
+		SQLChainTick:        conf.GConf.SQLChainTick,
+		SQLChainTTL:         conf.GConf.SQLChainTTL,
+		MinProviderDeposit:  conf.GConf.MinProviderDeposit,
+		MinNodeIDDifficulty: conf.GConf.MinNodeIDDifficulty,
+		DevMode:             conf.GConf.IsDevMode(),
+		MaxClockSkew:        conf.GConf.MaxClockSkew,
+	}
+	for _, n := range conf.GConf.KnownNodes {
+		if n.Role == proto.Leader || n.Role == proto.Follower {
+			c.KnownNodes = append(c.KnownNodes, n)
+		}
+	}
+	return c
+}
+
+// Provision RPC verifies the provisioning token, adds ProvisionReq.Node to DHT, records the token
+// on chain and returns the network config for the new node. The token is not burned if the
+// node is not added.
+func (DHT *DHTService) Provision(req *proto.ProvisionReq, resp *proto.ProvisionResp) (err error) {
+	if permissionCheckFunc != nil && !permissionCheckFunc(&req.Envelope, DHTProvision) {
+		err = fmt.Errorf("calling Provision from node %s is not permitted", req.GetNodeID())
+		log.Error(err)
+		return
+	}
+	if err = checkNode(&req.Node); err != nil {
+		return
+	}
+	if err = checkProvisionToken(&req.Token, &req.Node); err != nil {
+		err = errors.Wrapf(err, "provision node %s failed", req.Node.ID)
+		log.Error(err)
+		return
+	}
+	ledger, release, err := reserveProvisionToken(&req.Token)
+	if err != nil {
+		err = errors.Wrapf(err, "provision node %s failed", req.Node.ID)
+		log.Error(err)
+		return
+	}
+	defer release()
+	if resp.Config, err = yaml.Marshal(provisionConfig()); err != nil {
+		return
+	}
+	if err = DHT.Consistent.Add(req.Node); err != nil {
+		err = fmt.Errorf("DHT.Consistent.Add %v failed: %s", req.Node, err)
+		return
+	}
+	if err = ledger.RecordProvisionToken(&req.Token, req.Node.ID); err != nil {
+		if rerr := DHT.Consistent.Remove(req.Node.ID); rerr != nil {
+			log.WithError(rerr).WithField("node", req.Node.ID).Error("remove unrecorded node failed")
+		}
+		err = errors.Wrapf(err, "record provisioning of node %s failed", req.Node.ID)
+		log.Error(err)
+		return
+	}
+	RecordBuildInfo(req.Node.ID, req.Build)
+	log.WithFields(log.Fields{
+		"node": req.Node.ID,
+		"role": req.Node.Role,
+		"addr": req.Node.Addr,
+	}).Info("node provisioned")
+	return
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/consistent"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/utils"
+)
+
+type fakeProvisionLedger struct {
+	used      map[uint64]proto.NodeID
+	recordErr error
+}
+
+func (l *fakeProvisionLedger) IsProvisionTokenUsed(nonce uint64) bool {
+	_, ok := l.used[nonce]
+	return ok
+}
+
+func (l *fakeProvisionLedger) RecordProvisionToken(t *proto.ProvisionToken, node proto.NodeID) error {
+	if l.recordErr != nil {
+		return l.recordErr
+	}
+	l.used[t.Nonce] = node
+	return nil
+}
+
+func TestProvisionToken(t *testing.T) {
+	Convey("test provisioning token", t, func() {
+		priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		issuer, err := crypto.PubKeyHash(pub)
+		So(err, ShouldBeNil)
+
+		origConf := conf.GConf
+		defer func() { conf.GConf = origConf }()
+		conf.GConf = &conf.Config{}
+
+		token := &proto.ProvisionToken{
+			ProvisionTokenHeader: proto.ProvisionTokenHeader{
+				Role:   proto.Miner,
+				Expire: time.Now().Add(time.Hour).UTC(),
+				Nonce:  uint64(time.Now().UnixNano()),
+			},
+		}
+		So(token.Sign(priv), ShouldBeNil)
+
+		encoded, err := EncodeProvisionToken(token)
+		So(err, ShouldBeNil)
+		decoded, err := DecodeProvisionToken(encoded)
+		So(err, ShouldBeNil)
+		So(decoded.Nonce, ShouldEqual, token.Nonce)
+		_, err = DecodeProvisionToken("invalid token")
+		So(err, ShouldNotBeNil)
+
+		miner := &proto.Node{Role: proto.Miner}
+		client := &proto.Node{Role: proto.Client}
+
+		// issuer not permitted
+		So(checkProvisionToken(decoded, miner), ShouldNotBeNil)
+
+		conf.GConf.ProvisionIssuers = []proto.AccountAddress{issuer}
+		So(checkProvisionToken(decoded, client), ShouldNotBeNil)
+		So(checkProvisionToken(decoded, miner), ShouldBeNil)
+
+		// tampered token
+		decoded.Role = proto.Client
+		So(checkProvisionToken(decoded, client), ShouldNotBeNil)
+	})
+}
+
+func TestDHTService_Provision(t *testing.T) {
+	Convey("test provisioning node with token recorded by ledger", t, func() {
+		utils.RemoveAll(DHTStorePath + "provision*")
+		defer utils.RemoveAll(DHTStorePath + "provision*")
+		dht, err := NewDHTService(DHTStorePath+"provision", new(consistent.KMSStorage), false)
+		So(err, ShouldBeNil)
+
+		priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		issuer, err := crypto.PubKeyHash(pub)
+		So(err, ShouldBeNil)
+
+		origConf := conf.GConf
+		defer func() { conf.GConf = origConf }()
+		conf.GConf = &conf.Config{ProvisionIssuers: []proto.AccountAddress{issuer}}
+		defer SetProvisionLedger(nil)
+
+		proto.NewNodeIDDifficultyTimeout = 100 * time.Millisecond
+		node := proto.NewNode()
+		So(node.InitNodeCryptoInfo(100*time.Millisecond), ShouldBeNil)
+		node.Role = proto.Miner
+
+		req := &proto.ProvisionReq{Node: *node}
+		req.Token.Role = proto.Miner
+		req.Token.Expire = time.Now().Add(time.Hour).UTC()
+		req.Token.Nonce = uint64(time.Now().UnixNano())
+		So(req.Token.Sign(priv), ShouldBeNil)
+
+		// no ledger on this node
+		So(dht.Provision(req, &proto.ProvisionResp{}), ShouldNotBeNil)
+
+		ledger := &fakeProvisionLedger{used: make(map[uint64]proto.NodeID)}
+		SetProvisionLedger(ledger)
+
+		// token is not burned if recording failed, and the node is removed
+		ledger.recordErr = errors.New("record failed")
+		So(dht.Provision(req, &proto.ProvisionResp{}), ShouldNotBeNil)
+		So(ledger.used, ShouldBeEmpty)
+		_, err = dht.Consistent.GetNode(string(node.ID))
+		So(err, ShouldNotBeNil)
+
+		ledger.recordErr = nil
+		resp := &proto.ProvisionResp{}
+		So(dht.Provision(req, resp), ShouldBeNil)
+		So(resp.Config, ShouldNotBeEmpty)
+		So(ledger.used[req.Token.Nonce], ShouldEqual, node.ID)
+		_, err = dht.Consistent.GetNode(string(node.ID))
+		So(err, ShouldBeNil)
+
+		// single use across block producers sharing the ledger
+		err = dht.Provision(req, &proto.ProvisionResp{})
+		So(err, ShouldNotBeNil)
+		So(strings.Contains(err.Error(), "already used"), ShouldBeTrue)
+
+		// anonymous ping can not register nodes
+		other := proto.NewNode()
+		So(other.InitNodeCryptoInfo(100*time.Millisecond), ShouldBeNil)
+		other.Role = proto.Miner
+		ping := &proto.PingReq{Node: *other}
+		ping.Envelope.NodeID = kms.AnonymousRawNodeID
+		err = dht.Ping(ping, &proto.PingResp{})
+		So(err, ShouldNotBeNil)
+		So(strings.Contains(err.Error(), "must be provisioned"), ShouldBeTrue)
+
+		// provisioned node refreshes itself
+		ping = &proto.PingReq{Node: *node}
+		ping.Envelope.NodeID = node.ID.ToRawNodeID()
+		So(dht.Ping(ping, &proto.PingResp{}), ShouldBeNil)
+	})
+}
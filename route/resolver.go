@@ -0,0 +1,124 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// SeedResolver resolves the seed records, the lookups should respect the deadline of the context.
+type SeedResolver interface {
+	// LookupIP returns the IP addresses of the host.
+	LookupIP(ctx context.Context, host string) ([]net.IP, error)
+	// LookupTXT returns the TXT records of the host.
+	LookupTXT(ctx context.Context, host string) ([]string, error)
+}
+
+// NetResolver resolves the seed records with the Go resolver.
+type NetResolver struct {
+	resolver *net.Resolver
+}
+
+// NewNetResolver returns a resolver querying the name servers in order, the system resolver is
+// used if no name server is specified. The name servers are "host:port" or "host" with port 53.
+func NewNetResolver(servers []string) *NetResolver {
+	if len(servers) == 0 {
+		return &NetResolver{resolver: net.DefaultResolver}
+	}
+	var addrs = make([]string, 0, len(servers))
+	for _, s := range servers {
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			s = net.JoinHostPort(s, "53")
+		}
+		addrs = append(addrs, s)
+	}
+	return &NetResolver{
+		resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (conn net.Conn, err error) {
+				var d net.Dialer
+				for _, addr := range addrs {
+					if conn, err = d.DialContext(ctx, network, addr); err == nil {
+						return
+					}
+				}
+				return
+			},
+		},
+	}
+}
+
+// LookupIP implements SeedResolver.LookupIP.
+func (r *NetResolver) LookupIP(ctx context.Context, host string) (ips []net.IP, err error) {
+	var addrs []net.IPAddr
+	if addrs, err = r.resolver.LookupIPAddr(ctx, host); err != nil {
+		return
+	}
+	ips = make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	return
+}
+
+// LookupTXT implements SeedResolver.LookupTXT.
+func (r *NetResolver) LookupTXT(ctx context.Context, host string) ([]string, error) {
+	return r.resolver.LookupTXT(ctx, host)
+}
+
+// RetryResolver retries the failed lookups of the underlying resolver, the not found errors are
+// returned at once.
+type RetryResolver struct {
+	Resolver SeedResolver
+	// Retries is the max retries after the first lookup.
+	Retries int
+	// Interval is the wait time before each retry.
+	Interval time.Duration
+}
+
+// LookupIP implements SeedResolver.LookupIP.
+func (r *RetryResolver) LookupIP(ctx context.Context, host string) (ips []net.IP, err error) {
+	err = r.retry(ctx, func() (err error) {
+		ips, err = r.Resolver.LookupIP(ctx, host)
+		return
+	})
+	return
+}
+
+// LookupTXT implements SeedResolver.LookupTXT.
+func (r *RetryResolver) LookupTXT(ctx context.Context, host string) (txts []string, err error) {
+	err = r.retry(ctx, func() (err error) {
+		txts, err = r.Resolver.LookupTXT(ctx, host)
+		return
+	})
+	return
+}
+
+func (r *RetryResolver) retry(ctx context.Context, lookup func() error) (err error) {
+	for i := 0; ; i++ {
+		if err = lookup(); err == nil || isNotFound(err) || i >= r.Retries {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.Interval):
+		}
+	}
+}
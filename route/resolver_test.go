@@ -0,0 +1,113 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/pow/cpuminer"
+	"github.com/SQLess/SQLess/proto"
+)
+
+var errTestLookup = errors.New("temporary lookup failure")
+
+// testSeedResolver resolves the AAAA records from the zone, the first failures lookups of each
+// host fail with errTestLookup.
+type testSeedResolver struct {
+	sync.Mutex
+	zone     map[string][]net.IP
+	failures int
+	lookups  map[string]int
+}
+
+func (r *testSeedResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, errors.New("lookup without deadline")
+	}
+	r.Lock()
+	defer r.Unlock()
+	if r.lookups[host]++; r.lookups[host] <= r.failures {
+		return nil, errTestLookup
+	}
+	if ips, ok := r.zone[host]; ok {
+		return ips, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (r *testSeedResolver) LookupTXT(ctx context.Context, host string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestSeedResolver(t *testing.T) {
+	Convey("Given a seed zone served by a custom resolver", t, func() {
+		var pub asymmetric.PublicKey
+		pubKeyBytes, _ := hex.DecodeString("02c76216704d797c64c58bc11519fb68582e8e63de7e5b3b2dbbbe8733efe5fd24")
+		So(pub.UnmarshalBinary(pubKeyBytes), ShouldBeNil)
+		node := proto.Node{
+			ID:        proto.NodeID("00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9"),
+			Addr:      "127.0.0.1:3122",
+			PublicKey: &pub,
+			Nonce:     cpuminer.Uint256{A: 313283},
+		}
+		out, err := (&IPv6SeedClient{}).GenBPsIPv6([]proto.Node{node}, "seed.test")
+		So(err, ShouldBeNil)
+		resolver := &testSeedResolver{zone: make(map[string][]net.IP), lookups: make(map[string]int)}
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			fields := strings.Fields(line)
+			resolver.zone[fields[0]] = append(resolver.zone[fields[0]], net.ParseIP(fields[4]))
+		}
+
+		Convey("The BPs should be resolved by the custom resolver", func() {
+			isc := IPv6SeedClient{Resolver: resolver, Timeout: time.Second}
+			m, err := isc.GetBPsFromDNSSeed("seed.test")
+			So(err, ShouldBeNil)
+			So(m, ShouldHaveLength, 1)
+			So(m[*node.ID.ToRawNodeID()].Addr, ShouldEqual, node.Addr)
+		})
+		Convey("The temporary failures should be retried", func() {
+			resolver.failures = 2
+			host := "00.bp00.id.seed.test"
+			r := &RetryResolver{Resolver: resolver, Retries: 1}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			_, err := r.LookupIP(ctx, host)
+			So(errors.Cause(err), ShouldEqual, errTestLookup)
+
+			r.Retries = 2
+			ips, err := r.LookupIP(ctx, host)
+			So(err, ShouldBeNil)
+			So(ips, ShouldResemble, resolver.zone[host])
+
+			// not found is not retried
+			resolver.failures = 0
+			_, err = r.LookupIP(ctx, "05.bp00.id.seed.test")
+			So(isNotFound(err), ShouldBeTrue)
+			So(resolver.lookups["05.bp00.id.seed.test"], ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,50 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"sync"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+// revokedNodes caches the node identities revoked on chain.
+var revokedNodes = struct {
+	sync.RWMutex
+	nodes map[proto.NodeID]struct{}
+}{
+	nodes: make(map[proto.NodeID]struct{}),
+}
+
+// SetRevokedNodes replaces the cached revoked node identities with the chain published list.
+func SetRevokedNodes(nodes []proto.NodeID) {
+	m := make(map[proto.NodeID]struct{}, len(nodes))
+	for _, n := range nodes {
+		m[n] = struct{}{}
+	}
+	revokedNodes.Lock()
+	defer revokedNodes.Unlock()
+	revokedNodes.nodes = m
+}
+
+// IsRevoked returns whether the node identity is revoked on chain.
+func IsRevoked(id proto.NodeID) bool {
+	revokedNodes.RLock()
+	defer revokedNodes.RUnlock()
+	_, ok := revokedNodes.nodes[id]
+	return ok
+}
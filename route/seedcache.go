@@ -0,0 +1,173 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/utils"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+var (
+	// DefaultSeedCacheTTL is the TTL of the seed cache if not configured.
+	DefaultSeedCacheTTL = 24 * time.Hour
+)
+
+// SeedCache persists the last successfully decoded BPs of the seed domain, so that the node can
+// boot offline or during seed outages.
+type SeedCache struct {
+	// Path of the cache file.
+	Path string
+	// TTL is the duration the cached BPs are used without looking up the seed domain, the expired
+	// cache is still used if the lookup fails.
+	TTL time.Duration
+}
+
+type seedCacheFile struct {
+	Domain  string
+	Updated time.Time
+	Nodes   []proto.Node
+}
+
+// Load loads the cached BPs of the domain, the cache is expired if it is not updated within
+// the TTL. ErrDNSNotFound is returned if the domain is not cached.
+func (c *SeedCache) Load(domain string) (bpNodes IDNodeMap, expired bool, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(c.Path); err != nil {
+		if os.IsNotExist(err) {
+			err = errors.Wrapf(ErrDNSNotFound, "seed %s is not cached", domain)
+		}
+		return
+	}
+	var f seedCacheFile
+	if err = utils.DecodeMsgPack(data, &f); err != nil {
+		return nil, false, errors.Wrapf(err, "decode seed cache %s failed", c.Path)
+	}
+	if f.Domain != domain || len(f.Nodes) == 0 {
+		return nil, false, errors.Wrapf(ErrDNSNotFound, "seed %s is not cached", domain)
+	}
+	bpNodes = make(IDNodeMap, len(f.Nodes))
+	for _, n := range f.Nodes {
+		rawID := n.ID.ToRawNodeID()
+		if rawID == nil {
+			return nil, false, errors.Errorf("invalid node id %s in seed cache", n.ID)
+		}
+		bpNodes[*rawID] = n
+	}
+	var ttl = c.TTL
+	if ttl <= 0 {
+		ttl = DefaultSeedCacheTTL
+	}
+	expired = time.Since(f.Updated) > ttl
+	return
+}
+
+// Store replaces the cached BPs with the BPs of the domain.
+func (c *SeedCache) Store(domain string, bpNodes IDNodeMap) (err error) {
+	var f = seedCacheFile{
+		Domain:  domain,
+		Updated: time.Now().UTC(),
+		Nodes:   make([]proto.Node, 0, len(bpNodes)),
+	}
+	for _, n := range bpNodes {
+		f.Nodes = append(f.Nodes, n)
+	}
+	buf, err := utils.EncodeMsgPack(&f)
+	if err != nil {
+		return errors.Wrap(err, "encode seed cache failed")
+	}
+	var tmp = c.Path + ".tmp"
+	if err = os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
+		return errors.Wrap(err, "create seed cache dir failed")
+	}
+	if err = ioutil.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return errors.Wrapf(err, "write seed cache %s failed", tmp)
+	}
+	if err = os.Rename(tmp, c.Path); err != nil {
+		return errors.Wrapf(err, "replace seed cache %s failed", c.Path)
+	}
+	return
+}
+
+// loadSeedBPs gets the BPs of the seed domain through the seed cache if configured. The unexpired
+// cache is used directly and refreshed in the background, otherwise the seed domain is looked up
+// and the expired cache is only used if the lookup fails.
+func loadSeedBPs(cfg *conf.DNSSeed) (bpNodes IDNodeMap, err error) {
+	if cfg.CacheFile == "" {
+		return getBPsFromSeeds(cfg)
+	}
+	return getCachedSeedBPs(&SeedCache{Path: cfg.CacheFile, TTL: cfg.CacheTTL}, cfg, getBPsFromSeeds)
+}
+
+// seedCacheKey returns the key of the seed cache, which is the joined seed domains.
+func seedCacheKey(cfg *conf.DNSSeed) string {
+	return strings.Join(cfg.SeedDomains(), ",")
+}
+
+func getCachedSeedBPs(
+	cache *SeedCache, cfg *conf.DNSSeed, lookup func(*conf.DNSSeed) (IDNodeMap, error),
+) (bpNodes IDNodeMap, err error) {
+	var key = seedCacheKey(cfg)
+	cached, expired, cacheErr := cache.Load(key)
+	if cacheErr != nil && !isNotFound(cacheErr) {
+		log.WithError(cacheErr).Warning("load seed cache failed")
+	}
+	if cacheErr == nil && !expired {
+		log.WithField("seed", key).Info("use the cached BPs of seed")
+		go refreshSeedCache(cache, cfg, lookup)
+		return cached, nil
+	}
+	if bpNodes, err = lookup(cfg); err == nil && len(bpNodes) > 0 {
+		if err := cache.Store(key, bpNodes); err != nil {
+			log.WithError(err).Warning("store seed cache failed")
+		}
+		return
+	}
+	if cacheErr == nil {
+		log.WithField("seed", key).WithError(err).Warning(
+			"getting BP info from DNS failed, use the expired seed cache")
+		return cached, nil
+	}
+	return
+}
+
+// refreshSeedCache looks up the seed domain and updates the cache, the refreshed BP addresses
+// take effect at once while the refreshed BP set takes effect on the next boot.
+func refreshSeedCache(cache *SeedCache, cfg *conf.DNSSeed, lookup func(*conf.DNSSeed) (IDNodeMap, error)) {
+	var key = seedCacheKey(cfg)
+	bpNodes, err := lookup(cfg)
+	if err != nil || len(bpNodes) == 0 {
+		log.WithField("seed", key).WithError(err).Warning("refresh seed cache failed")
+		return
+	}
+	for id, n := range bpNodes {
+		id := id
+		_ = setNodeAddrCache(&id, n.Addr)
+	}
+	if err = cache.Store(key, bpNodes); err != nil {
+		log.WithError(err).Warning("store seed cache failed")
+	}
+}
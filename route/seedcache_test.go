@@ -0,0 +1,96 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestSeedCache(t *testing.T) {
+	Convey("Given a seed cache", t, func() {
+		dir, err := ioutil.TempDir("", "seedcache")
+		So(err, ShouldBeNil)
+		defer func() { _ = os.RemoveAll(dir) }()
+
+		var (
+			cache = &SeedCache{Path: filepath.Join(dir, "seed", "cache"), TTL: time.Hour}
+			cfg   = &conf.DNSSeed{Domain: "seed.test"}
+			node  = proto.Node{
+				ID:   proto.NodeID("00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9"),
+				Addr: "127.0.0.1:2120",
+				Role: proto.Leader,
+			}
+			bpNodes = IDNodeMap{*node.ID.ToRawNodeID(): node}
+			lookups = make(chan struct{}, 1)
+			outage  = func(*conf.DNSSeed) (IDNodeMap, error) {
+				lookups <- struct{}{}
+				return nil, errors.New("seed outage")
+			}
+		)
+		_, _, err = cache.Load(cfg.Domain)
+		So(isNotFound(err), ShouldBeTrue)
+		_, err = getCachedSeedBPs(cache, cfg, outage)
+		So(err, ShouldNotBeNil)
+		<-lookups
+
+		Convey("The looked up BPs should be cached", func() {
+			m, err := getCachedSeedBPs(cache, cfg, func(*conf.DNSSeed) (IDNodeMap, error) {
+				return bpNodes, nil
+			})
+			So(err, ShouldBeNil)
+			So(m, ShouldHaveLength, 1)
+
+			cached, expired, err := cache.Load(cfg.Domain)
+			So(err, ShouldBeNil)
+			So(expired, ShouldBeFalse)
+			So(cached[*node.ID.ToRawNodeID()].Addr, ShouldEqual, node.Addr)
+			_, _, err = cache.Load("other.test")
+			So(isNotFound(err), ShouldBeTrue)
+
+			// the unexpired cache is used and refreshed in the background
+			m, err = getCachedSeedBPs(cache, cfg, outage)
+			So(err, ShouldBeNil)
+			So(m, ShouldHaveLength, 1)
+			select {
+			case <-lookups:
+			case <-time.After(5 * time.Second):
+				So("background refresh", ShouldBeEmpty)
+			}
+
+			// the expired cache is used during the seed outage
+			cache.TTL = time.Nanosecond
+			time.Sleep(time.Millisecond)
+			_, expired, err = cache.Load(cfg.Domain)
+			So(err, ShouldBeNil)
+			So(expired, ShouldBeTrue)
+			m, err = getCachedSeedBPs(cache, cfg, outage)
+			So(err, ShouldBeNil)
+			So(m, ShouldHaveLength, 1)
+			<-lookups
+		})
+	})
+}
@@ -95,7 +95,8 @@ func (DHT *DHTService) FindNeighbor(req *proto.FindNeighborReq, resp *proto.Find
 	return
 }
 
-// Ping RPC adds PingReq.Node to DHT.
+// Ping RPC adds PingReq.Node to DHT, only provisioned nodes are refreshed if provisioning
+// is enforced.
 func (DHT *DHTService) Ping(req *proto.PingReq, resp *proto.PingResp) (err error) {
 	log.Debugf("got req: %#v", req)
 	if permissionCheckFunc != nil && !permissionCheckFunc(&req.Envelope, DHTPing) {
@@ -104,32 +105,64 @@ func (DHT *DHTService) Ping(req *proto.PingReq, resp *proto.PingResp) (err error
 		return
 	}
 
+	if err = checkNode(&req.Node); err != nil {
+		return
+	}
+	if err = checkProvisioned(req.GetNodeID(), &req.Node); err != nil {
+		return
+	}
+
+	err = DHT.Consistent.Add(req.Node)
+	if err != nil {
+		err = fmt.Errorf("DHT.Consistent.Add %v failed: %s", req.Node, err)
+	} else {
+		RecordBuildInfo(req.Node.ID, req.Build)
+		RecordNode(&req.Node)
+		resp.Msg = "Pong"
+		resp.Build = conf.GetBuildInfo()
+	}
+	return
+}
+
+// checkNode checks if the node is permitted to register to DHT.
+func checkNode(node *proto.Node) (err error) {
+	// revoked node is not permitted to register
+	if IsRevoked(node.ID) {
+		err = fmt.Errorf("node: %s is revoked", node.ID)
+		log.Error(err)
+		return
+	}
+
 	// BP node is not permitted to set by RPC
-	if req.Node.Role == proto.Leader || req.Node.Role == proto.Follower {
-		err = fmt.Errorf("setting %s node is not permitted", req.Node.Role.String())
+	if node.Role == proto.Leader || node.Role == proto.Follower {
+		err = fmt.Errorf("setting %s node is not permitted", node.Role.String())
 		log.Error(err)
 		return
 	}
 
+	// only the known nodes are permitted in the static topology, no PoW is required
+	if conf.GConf.StaticTopology {
+		known, ok := conf.GConf.StaticNode(node.ID)
+		if !ok || known.Role != node.Role || known.Addr != node.Addr ||
+			known.PublicKey == nil || node.PublicKey == nil || !known.PublicKey.IsEqual(node.PublicKey) {
+			err = fmt.Errorf("node: %s is not in the static topology", node.ID)
+			log.Error(err)
+		}
+		return
+	}
+
 	// Checking if ID Nonce Pubkey matched
-	if !kms.IsIDPubNonceValid(req.Node.ID.ToRawNodeID(), &req.Node.Nonce, req.Node.PublicKey) {
-		err = fmt.Errorf("node: %s nonce public key not match", req.Node.ID)
+	if !kms.IsIDPubNonceValid(node.ID.ToRawNodeID(), &node.Nonce, node.PublicKey) {
+		err = fmt.Errorf("node: %s nonce public key not match", node.ID)
 		log.Error(err)
 		return
 	}
 
 	// Checking MinNodeIDDifficulty
-	if req.Node.ID.Difficulty() < conf.GConf.MinNodeIDDifficulty {
-		err = fmt.Errorf("node: %s difficulty too low", req.Node.ID)
+	if node.ID.Difficulty() < conf.GConf.NodeIDDifficulty() {
+		err = fmt.Errorf("node: %s difficulty too low", node.ID)
 		log.Error(err)
 		return
 	}
-
-	err = DHT.Consistent.Add(req.Node)
-	if err != nil {
-		err = fmt.Errorf("DHT.Consistent.Add %v failed: %s", req.Node, err)
-	} else {
-		resp.Msg = "Pong"
-	}
 	return
 }
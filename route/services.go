@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// services tracks the routing services started by StartServices, they are shared by the chain
+// and database services running in the same process.
+var services struct {
+	sync.Mutex
+	refs int
+	stop func()
+}
+
+// StartServices starts the routing services enabled by conf.GConf, i.e. the node table, the
+// address book, the Kubernetes and the mDNS peer discovery. It should be called on node startup before the first DHT lookup, the services are
+// started once and stopped by the last call of the returned stop func.
+func StartServices() (stop func(), err error) {
+	services.Lock()
+	defer services.Unlock()
+	if services.refs == 0 {
+		if services.stop, err = startServices(); err != nil {
+			return
+		}
+	}
+	services.refs++
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			services.Lock()
+			defer services.Unlock()
+			if services.refs--; services.refs == 0 {
+				services.stop()
+				services.stop = nil
+			}
+		})
+	}
+	return
+}
+
+func startServices() (stop func(), err error) {
+	var (
+		stops []func()
+		start = func(name string, fn func() (func(), error)) (err error) {
+			var s func()
+			if s, err = fn(); err != nil {
+				return errors.Wrapf(err, "start %s failed", name)
+			}
+			stops = append(stops, s)
+			return
+		}
+	)
+	stop = func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+	defer func() {
+		if err != nil {
+			stop()
+		}
+	}()
+	// the node table is opened first, the block producers are loaded from it on resolver
+	// initialization instead of looking up the DNS seed
+	if err = start("node table", StartNodeTable); err != nil {
+		return
+	}
+	if err = start("address book", StartAddressBook); err != nil {
+		return
+	}
+	if err = start("kubernetes discovery", StartKubernetesDiscovery); err != nil {
+		return
+	}
+	err = start("mDNS discovery", StartMDNSDiscovery)
+	return
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestStartServices(t *testing.T) {
+	Convey("Given a config without routing services", t, func() {
+		origConf := conf.GConf
+		defer func() { conf.GConf = origConf }()
+		conf.GConf = &conf.Config{}
+
+		Convey("The services should be started once and stopped by the last user", func() {
+			stop1, err := StartServices()
+			So(err, ShouldBeNil)
+			stop2, err := StartServices()
+			So(err, ShouldBeNil)
+			So(services.refs, ShouldEqual, 2)
+			stop1()
+			stop1()
+			So(services.refs, ShouldEqual, 1)
+			So(services.stop, ShouldNotBeNil)
+			stop2()
+			So(services.refs, ShouldEqual, 0)
+			So(services.stop, ShouldBeNil)
+		})
+		Convey("The address book should be loaded and flushed", func() {
+			dir, err := ioutil.TempDir("", "services")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			conf.GConf.AddressBookFile = filepath.Join(dir, "addrbook.json")
+
+			stop, err := StartServices()
+			So(err, ShouldBeNil)
+			So(getAddressBook(), ShouldNotBeNil)
+			getAddressBook().Seen(proto.NodeID(
+				"00000000000000000000000000000000000000000000000000000000000000aa"), "127.0.0.1:1")
+			stop()
+			So(getAddressBook(), ShouldBeNil)
+			_, err = os.Stat(conf.GConf.AddressBookFile)
+			So(err, ShouldBeNil)
+		})
+		Convey("The node table should be opened and closed", func() {
+			dir, err := ioutil.TempDir("", "services")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			conf.GConf.NodeTableFile = filepath.Join(dir, "nodes.db")
+
+			stop, err := StartServices()
+			So(err, ShouldBeNil)
+			So(getNodeTable(), ShouldNotBeNil)
+			stop()
+			So(getNodeTable(), ShouldBeNil)
+			_, err = os.Stat(conf.GConf.NodeTableFile)
+			So(err, ShouldBeNil)
+		})
+		Convey("The failed services should not be counted", func() {
+			conf.GConf.Kubernetes = &conf.KubernetesDiscovery{}
+			_, err := StartServices()
+			So(err, ShouldNotBeNil)
+			So(services.refs, ShouldEqual, 0)
+
+			conf.GConf.Kubernetes = nil
+			conf.GConf.MDNS = &conf.MDNSDiscovery{Interface: "no-such-interface"}
+			_, err = StartServices()
+			So(err, ShouldNotBeNil)
+			So(services.refs, ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/proto"
+)
+
+const (
+	// txtChunkSize is the base64 chars in a TXT record, a character string holds at most 255
+	// bytes including the chunk index prefix.
+	txtChunkSize = 200
+	// maxTXTChunks is the max TXT records of a seed record field.
+	maxTXTChunks = 100
+)
+
+// ToTXT encodes the data to base64 chunks, each chunk is prefixed with its index as "00:" since
+// the TXT records of a name are unordered.
+func ToTXT(in []byte) (txts []string, err error) {
+	var encoded = base64.StdEncoding.EncodeToString(in)
+	for i := 0; len(encoded) > 0; i++ {
+		if i >= maxTXTChunks {
+			return nil, errors.Errorf("data too large for TXT records: %d bytes", len(in))
+		}
+		var n = txtChunkSize
+		if n > len(encoded) {
+			n = len(encoded)
+		}
+		txts = append(txts, fmt.Sprintf("%02d:%s", i, encoded[:n]))
+		encoded = encoded[n:]
+	}
+	return
+}
+
+// FromTXT decodes the data from the indexed base64 chunks in the TXT records of the domain, the
+// TXT records not in the chunk format are ignored.
+func FromTXT(domain string, f func(host string) ([]string, error)) (out []byte, err error) {
+	var txts []string
+	if txts, err = f(domain); err != nil {
+		return
+	}
+	var chunks = make(map[int]string)
+	for _, txt := range txts {
+		sep := strings.IndexByte(txt, ':')
+		if sep < 0 {
+			continue
+		}
+		i, perr := strconv.Atoi(txt[:sep])
+		if perr != nil || i < 0 || i >= maxTXTChunks {
+			continue
+		}
+		if _, ok := chunks[i]; ok {
+			return nil, errors.Errorf("duplicate TXT chunk %d of %s", i, domain)
+		}
+		chunks[i] = txt[sep+1:]
+	}
+	if len(chunks) == 0 {
+		return nil, errors.Wrapf(ErrDNSNotFound, "no seed TXT record of %s", domain)
+	}
+	var indexes = make([]int, 0, len(chunks))
+	for i := range chunks {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	var encoded strings.Builder
+	for j, i := range indexes {
+		if i != j {
+			return nil, errors.Errorf("missing TXT chunk %d of %s", j, domain)
+		}
+		encoded.WriteString(chunks[i])
+	}
+	if out, err = base64.StdEncoding.DecodeString(encoded.String()); err != nil {
+		err = errors.Wrapf(err, "decode TXT records of %s failed", domain)
+	}
+	return
+}
+
+// GenBPTXT generates the TXT records contain BP info
+func (isc *IPv6SeedClient) GenBPTXT(node *proto.Node, domain string) (out string, err error) {
+	var sig []byte
+	if sig, err = isc.signSeed(node); err != nil {
+		return
+	}
+	return genSeedTXTRecords(node, sig, func(field string) string { return field + domain })
+}
+
+// GenBPsTXT generates the TXT records contain the info of all BPs with the indexed scheme, see
+// GetBPsFromDNSSeed.
+func (isc *IPv6SeedClient) GenBPsTXT(nodes []proto.Node, domain string) (out string, err error) {
+	if len(nodes) > MaxSeedBPCount {
+		return "", errors.Errorf("too many BPs: %d, max %d", len(nodes), MaxSeedBPCount)
+	}
+	for i := range nodes {
+		var (
+			sig     []byte
+			records string
+		)
+		if sig, err = isc.signNodeSeed(&nodes[i]); err != nil {
+			return "", err
+		}
+		if records, err = genSeedTXTRecords(&nodes[i], sig, func(field string) string {
+			return IndexedSeedDomain(i, field, domain)
+		}); err != nil {
+			return "", err
+		}
+		out += records
+	}
+	return
+}
+
+// seedField defines the encoded field of the seed records.
+type seedField struct {
+	field string
+	data  []byte
+}
+
+// seedFields returns the encoded fields of the node and its signature if not nil, which are
+// decoded by decodeSeedNode.
+func seedFields(node *proto.Node, sig []byte) []seedField {
+	fields := []seedField{
+		{ID, node.ID.ToRawNodeID().AsBytes()},
+		{PUBKEY, crypto.AddPKCSPadding(node.PublicKey.Serialize())},
+		{NONCE, node.Nonce.Bytes()},
+		{ADDR, crypto.AddPKCSPadding([]byte(node.Addr))},
+	}
+	if sig != nil {
+		fields = append(fields, seedField{SIG, crypto.AddPKCSPadding(sig)})
+	}
+	return fields
+}
+
+// genSeedTXTRecords generates the TXT zone records of the node and its signature if not nil, the
+// fields are encoded the same as the AAAA records.
+func genSeedTXTRecords(node *proto.Node, sig []byte, name func(field string) string) (out string, err error) {
+	for _, f := range seedFields(node, sig) {
+		var txts []string
+		if txts, err = ToTXT(f.data); err != nil {
+			return "", err
+		}
+		for _, txt := range txts {
+			out += fmt.Sprintf("%s	1	IN	TXT	%q\n", name(f.field), txt)
+		}
+	}
+	return
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/pow/cpuminer"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestTXTSeed(t *testing.T) {
+	Convey("data should be encoded in indexed TXT chunks", t, func() {
+		var data = bytes.Repeat([]byte("0123456789"), 50)
+		txts, err := ToTXT(data)
+		So(err, ShouldBeNil)
+		So(len(txts), ShouldBeGreaterThan, 1)
+		for _, txt := range txts {
+			So(len(txt), ShouldBeLessThanOrEqualTo, 255)
+		}
+
+		// records are unordered and may be mixed with other TXT records
+		reversed := []string{"v=spf1 -all"}
+		for i := len(txts) - 1; i >= 0; i-- {
+			reversed = append(reversed, txts[i])
+		}
+		out, err := FromTXT("seed.test", func(string) ([]string, error) { return reversed, nil })
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, data)
+
+		_, err = FromTXT("seed.test", func(string) ([]string, error) { return txts[1:], nil })
+		So(err, ShouldNotBeNil)
+		_, err = FromTXT("seed.test", func(string) ([]string, error) { return []string{"v=spf1 -all"}, nil })
+		So(errors.Cause(err), ShouldEqual, ErrDNSNotFound)
+		_, err = ToTXT(make([]byte, maxTXTChunks*txtChunkSize))
+		So(err, ShouldNotBeNil)
+	})
+	Convey("BPs should be decoded from the TXT records", t, func() {
+		var (
+			isc = IPv6SeedClient{Encoding: SeedEncodingTXT}
+			pub asymmetric.PublicKey
+		)
+		pubKeyBytes, _ := hex.DecodeString("02c76216704d797c64c58bc11519fb68582e8e63de7e5b3b2dbbbe8733efe5fd24")
+		_ = pub.UnmarshalBinary(pubKeyBytes)
+		nodes := []proto.Node{{
+			ID:        proto.NodeID("00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9"),
+			Addr:      "a-rather-long-block-producer-host-name.seed.test:3122",
+			PublicKey: &pub,
+			Nonce:     cpuminer.Uint256{313283, 0, 0, 0},
+		}}
+		out, err := isc.GenBPsTXT(nodes, "seed.test")
+		So(err, ShouldBeNil)
+
+		zone := make(map[string][]string)
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			fields := strings.Fields(line)
+			So(fields, ShouldHaveLength, 5)
+			txt, err := strconv.Unquote(fields[4])
+			So(err, ShouldBeNil)
+			zone[fields[0]] = append(zone[fields[0]], txt)
+		}
+		lookup := func(host string) ([]string, error) {
+			if txts, ok := zone[host]; ok {
+				return txts, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		m, err := getSeedBPs("seed.test", func(domain string) ([]byte, error) {
+			return FromTXT(domain, lookup)
+		}, false)
+		So(err, ShouldBeNil)
+		So(m, ShouldHaveLength, 1)
+		node := m[*nodes[0].ID.ToRawNodeID()]
+		So(node.ID, ShouldEqual, nodes[0].ID)
+		So(node.Addr, ShouldEqual, nodes[0].Addr)
+		So(node.PublicKey.Serialize(), ShouldResemble, pub.Serialize())
+		So(fmt.Sprint(node.Nonce), ShouldEqual, fmt.Sprint(nodes[0].Nonce))
+
+		_, err = ParseSeedEncoding("srv")
+		So(err, ShouldNotBeNil)
+	})
+}
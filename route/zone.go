@@ -0,0 +1,250 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultZoneTTL is the default TTL of the generated seed records.
+	DefaultZoneTTL = 1
+)
+
+// ZoneFormat defines the output format of the generated seed records.
+type ZoneFormat int
+
+const (
+	// ZoneFormatBIND outputs the BIND style zone lines relative to the zone origin.
+	ZoneFormatBIND ZoneFormat = iota
+	// ZoneFormatCoreDNS outputs a complete zone file with SOA record for the CoreDNS file
+	// plugin.
+	ZoneFormatCoreDNS
+	// ZoneFormatRoute53 outputs an AWS Route53 JSON change batch, which could be applied with
+	// `aws route53 change-resource-record-sets --change-batch`.
+	ZoneFormatRoute53
+	// ZoneFormatTerraform outputs the Terraform HCL aws_route53_record resources.
+	ZoneFormatTerraform
+)
+
+// ParseZoneFormat parses the zone format name, empty name defaults to BIND.
+func ParseZoneFormat(s string) (f ZoneFormat, err error) {
+	switch strings.ToLower(s) {
+	case "", "bind":
+		return ZoneFormatBIND, nil
+	case "coredns":
+		return ZoneFormatCoreDNS, nil
+	case "route53":
+		return ZoneFormatRoute53, nil
+	case "terraform", "hcl":
+		return ZoneFormatTerraform, nil
+	default:
+		return 0, errors.Errorf("unknown zone format: %s", s)
+	}
+}
+
+// String implements fmt.Stringer.
+func (f ZoneFormat) String() string {
+	switch f {
+	case ZoneFormatBIND:
+		return "bind"
+	case ZoneFormatCoreDNS:
+		return "coredns"
+	case ZoneFormatRoute53:
+		return "route53"
+	case ZoneFormatTerraform:
+		return "terraform"
+	default:
+		return fmt.Sprintf("ZoneFormat(%d)", int(f))
+	}
+}
+
+// ZoneOptions defines the options of the generated seed records.
+type ZoneOptions struct {
+	Format ZoneFormat
+	// TTL is the TTL of the records, DefaultZoneTTL is used if not set.
+	TTL uint32
+	// Serial is the SOA serial of the CoreDNS zone file, the current unix time is used if not
+	// set.
+	Serial uint32
+	// ZoneIDVar is the Terraform expression of the hosted zone id, "var.zone_id" is used and
+	// declared if not set.
+	ZoneIDVar string
+	// IPv4 also generates the A records along with the AAAA records, for the clients behind the
+	// resolvers which strip the AAAA records.
+	IPv4 bool
+}
+
+// zoneRecord defines a single generated seed record.
+type zoneRecord struct {
+	name  string
+	typ   string
+	value string
+}
+
+// renderZone renders the seed records of the zone origin in the format of opts.
+func renderZone(records []zoneRecord, origin string, opts ZoneOptions) (out string, err error) {
+	var ttl = opts.TTL
+	if ttl == 0 {
+		ttl = DefaultZoneTTL
+	}
+	switch opts.Format {
+	case ZoneFormatBIND:
+		return renderBINDZone(records, ttl), nil
+	case ZoneFormatCoreDNS:
+		var serial = opts.Serial
+		if serial == 0 {
+			serial = uint32(time.Now().Unix())
+		}
+		return renderCoreDNSZone(records, origin, ttl, serial), nil
+	case ZoneFormatRoute53:
+		return renderRoute53Zone(records, ttl)
+	case ZoneFormatTerraform:
+		return renderTerraformZone(records, ttl, opts.ZoneIDVar), nil
+	default:
+		return "", errors.Errorf("unknown zone format: %d", int(opts.Format))
+	}
+}
+
+func renderBINDZone(records []zoneRecord, ttl uint32) (out string) {
+	var b strings.Builder
+	for _, r := range records {
+		fmt.Fprintf(&b, "%s	%d	IN	%s	%s\n", r.name, ttl, r.typ, r.value)
+	}
+	return b.String()
+}
+
+func renderCoreDNSZone(records []zoneRecord, origin string, ttl, serial uint32) (out string) {
+	var b strings.Builder
+	origin = fqdn(origin)
+	fmt.Fprintf(&b, "$ORIGIN %s\n", origin)
+	fmt.Fprintf(&b, "@	3600	IN	SOA	ns.%s hostmaster.%s %d 7200 3600 1209600 %d\n",
+		origin, origin, serial, ttl)
+	for _, r := range records {
+		fmt.Fprintf(&b, "%s	%d	IN	%s	%s\n", fqdn(r.name), ttl, r.typ, r.value)
+	}
+	return b.String()
+}
+
+// groupZoneRecords groups the record values by name and type in the order of first occurrence,
+// as a record set is managed as a whole by Route53.
+func groupZoneRecords(records []zoneRecord) (sets []zoneRecord, values [][]string) {
+	var index = make(map[[2]string]int)
+	for _, r := range records {
+		var key = [2]string{r.name, r.typ}
+		if i, ok := index[key]; ok {
+			values[i] = append(values[i], r.value)
+			continue
+		}
+		index[key] = len(sets)
+		sets = append(sets, r)
+		values = append(values, []string{r.value})
+	}
+	return
+}
+
+type route53ResourceRecord struct {
+	Value string `json:"Value"`
+}
+
+type route53ResourceRecordSet struct {
+	Name            string                  `json:"Name"`
+	Type            string                  `json:"Type"`
+	TTL             uint32                  `json:"TTL"`
+	ResourceRecords []route53ResourceRecord `json:"ResourceRecords"`
+}
+
+type route53Change struct {
+	Action            string                   `json:"Action"`
+	ResourceRecordSet route53ResourceRecordSet `json:"ResourceRecordSet"`
+}
+
+type route53ChangeBatch struct {
+	Comment string          `json:"Comment,omitempty"`
+	Changes []route53Change `json:"Changes"`
+}
+
+func renderRoute53Zone(records []zoneRecord, ttl uint32) (out string, err error) {
+	var (
+		sets, values = groupZoneRecords(records)
+		batch        = route53ChangeBatch{
+			Comment: "SQLess seed records",
+			Changes: make([]route53Change, len(sets)),
+		}
+	)
+	for i, s := range sets {
+		var rs = route53ResourceRecordSet{
+			Name:            fqdn(s.name),
+			Type:            s.typ,
+			TTL:             ttl,
+			ResourceRecords: make([]route53ResourceRecord, len(values[i])),
+		}
+		for j, v := range values[i] {
+			rs.ResourceRecords[j].Value = v
+		}
+		batch.Changes[i] = route53Change{Action: "UPSERT", ResourceRecordSet: rs}
+	}
+	var data []byte
+	if data, err = json.MarshalIndent(&batch, "", "  "); err != nil {
+		return
+	}
+	return string(data) + "\n", nil
+}
+
+// terraformIdentifier converts the record name and type to a valid Terraform resource name.
+func terraformIdentifier(name, typ string) string {
+	var b strings.Builder
+	b.WriteString("seed_")
+	for _, c := range strings.TrimSuffix(name, ".") + "_" + typ {
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' {
+			b.WriteRune(c)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func renderTerraformZone(records []zoneRecord, ttl uint32, zoneIDVar string) (out string) {
+	var (
+		b            strings.Builder
+		sets, values = groupZoneRecords(records)
+	)
+	if zoneIDVar == "" {
+		zoneIDVar = "var.zone_id"
+		b.WriteString("variable \"zone_id\" {\n  type = string\n}\n")
+	}
+	for i, s := range sets {
+		var quoted = make([]string, len(values[i]))
+		for j, v := range values[i] {
+			quoted[j] = fmt.Sprintf("%q", v)
+		}
+		fmt.Fprintf(&b, "\nresource \"aws_route53_record\" %q {\n", terraformIdentifier(s.name, s.typ))
+		fmt.Fprintf(&b, "  zone_id = %s\n", zoneIDVar)
+		fmt.Fprintf(&b, "  name    = %q\n", fqdn(s.name))
+		fmt.Fprintf(&b, "  type    = %q\n", s.typ)
+		fmt.Fprintf(&b, "  ttl     = %d\n", ttl)
+		fmt.Fprintf(&b, "  records = [%s]\n", strings.Join(quoted, ", "))
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package route
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/pow/cpuminer"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestGenBPIPv6Zone(t *testing.T) {
+	Convey("Given a BP node", t, func() {
+		var (
+			isc = &IPv6SeedClient{}
+			pub asymmetric.PublicKey
+		)
+		pubKeyBytes, err := hex.DecodeString(
+			"02c76216704d797c64c58bc11519fb68582e8e63de7e5b3b2dbbbe8733efe5fd24")
+		So(err, ShouldBeNil)
+		So(pub.UnmarshalBinary(pubKeyBytes), ShouldBeNil)
+		node := proto.Node{
+			ID:        proto.NodeID("00000bef611d346c0cbe1beaa76e7f0ed705a194fdf9ac3a248ec70e9c198bf9"),
+			Addr:      "127.0.0.1:3122",
+			PublicKey: &pub,
+			Nonce:     cpuminer.Uint256{313283, 0, 0, 0},
+		}
+		bind, err := isc.GenBPIPv6(&node, "seed.test")
+		So(err, ShouldBeNil)
+		lines := strings.Split(strings.TrimSpace(bind), "\n")
+		So(lines[0], ShouldStartWith, "00.id.seed.test\t1\tIN\tAAAA\t")
+
+		Convey("The format should be parsed by name", func() {
+			for name, expected := range map[string]ZoneFormat{
+				"":          ZoneFormatBIND,
+				"CoreDNS":   ZoneFormatCoreDNS,
+				"route53":   ZoneFormatRoute53,
+				"terraform": ZoneFormatTerraform,
+			} {
+				f, err := ParseZoneFormat(name)
+				So(err, ShouldBeNil)
+				So(f, ShouldEqual, expected)
+			}
+			_, err = ParseZoneFormat("djbdns")
+			So(err, ShouldNotBeNil)
+		})
+		Convey("The CoreDNS zone file should contain SOA and fully qualified records", func() {
+			out, err := isc.GenBPIPv6Zone(&node, "seed.test", ZoneOptions{
+				Format: ZoneFormatCoreDNS,
+				TTL:    60,
+				Serial: 2019120101,
+			})
+			So(err, ShouldBeNil)
+			zone := strings.Split(strings.TrimSpace(out), "\n")
+			So(len(zone), ShouldEqual, len(lines)+2)
+			So(zone[0], ShouldEqual, "$ORIGIN seed.test.")
+			So(zone[1], ShouldContainSubstring, "SOA\tns.seed.test. hostmaster.seed.test. 2019120101")
+			So(zone[2], ShouldStartWith, "00.id.seed.test.\t60\tIN\tAAAA\t")
+		})
+		Convey("The Route53 change batch should upsert each record", func() {
+			out, err := isc.GenBPIPv6Zone(&node, "seed.test", ZoneOptions{Format: ZoneFormatRoute53})
+			So(err, ShouldBeNil)
+			var batch route53ChangeBatch
+			So(json.Unmarshal([]byte(out), &batch), ShouldBeNil)
+			So(len(batch.Changes), ShouldEqual, len(lines))
+			change := batch.Changes[0]
+			So(change.Action, ShouldEqual, "UPSERT")
+			So(change.ResourceRecordSet.Name, ShouldEqual, "00.id.seed.test.")
+			So(change.ResourceRecordSet.Type, ShouldEqual, "AAAA")
+			So(change.ResourceRecordSet.TTL, ShouldEqual, uint32(DefaultZoneTTL))
+			So(lines[0], ShouldEndWith, change.ResourceRecordSet.ResourceRecords[0].Value)
+		})
+		Convey("The Terraform resources should reference the hosted zone", func() {
+			out, err := isc.GenBPIPv6Zone(&node, "seed.test", ZoneOptions{Format: ZoneFormatTerraform})
+			So(err, ShouldBeNil)
+			So(out, ShouldStartWith, "variable \"zone_id\" {")
+			So(strings.Count(out, "resource \"aws_route53_record\""), ShouldEqual, len(lines))
+			So(out, ShouldContainSubstring,
+				"resource \"aws_route53_record\" \"seed_00_id_seed_test_AAAA\" {\n"+
+					"  zone_id = var.zone_id\n"+
+					"  name    = \"00.id.seed.test.\"\n")
+
+			out, err = isc.GenBPIPv6Zone(&node, "seed.test", ZoneOptions{
+				Format:    ZoneFormatTerraform,
+				ZoneIDVar: "aws_route53_zone.seed.zone_id",
+			})
+			So(err, ShouldBeNil)
+			So(out, ShouldNotContainSubstring, "variable")
+			So(out, ShouldContainSubstring, "zone_id = aws_route53_zone.seed.zone_id\n")
+		})
+	})
+}
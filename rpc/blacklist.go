@@ -0,0 +1,285 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultBanThreshold defines the default failure count to ban a greylisted peer.
+	DefaultBanThreshold = 10
+	// DefaultFailureWindow defines the default window to count peer failures in.
+	DefaultFailureWindow = time.Minute
+	// DefaultBanDuration defines the default ban duration of automatic bans.
+	DefaultBanDuration = 30 * time.Minute
+)
+
+// BlacklistEntry defines a banned or greylisted peer, the key is a remote ip or a node id.
+type BlacklistEntry struct {
+	Key      string    `json:"key"`
+	Reason   string    `json:"reason"`
+	Failures int       `json:"failures,omitempty"`
+	Manual   bool      `json:"manual,omitempty"`
+	Since    time.Time `json:"since"`
+	Expire   time.Time `json:"expire,omitempty"` // zero for permanent ban
+}
+
+func (e *BlacklistEntry) expired(now time.Time) bool {
+	return !e.Expire.IsZero() && now.After(e.Expire)
+}
+
+// Blacklist defines the operator-managed and automatic peer blacklist. Peers with failures are
+// greylisted first and banned after reaching the threshold within the failure window.
+type Blacklist struct {
+	sync.RWMutex
+	threshold   int
+	window      time.Duration
+	banDuration time.Duration
+	banned      map[string]*BlacklistEntry
+	grey        map[string]*BlacklistEntry
+}
+
+// NewBlacklist returns a new peer blacklist.
+func NewBlacklist(threshold int, window, banDuration time.Duration) *Blacklist {
+	return &Blacklist{
+		threshold:   threshold,
+		window:      window,
+		banDuration: banDuration,
+		banned:      make(map[string]*BlacklistEntry),
+		grey:        make(map[string]*BlacklistEntry),
+	}
+}
+
+// DefaultBlacklist is the blacklist used by the rpc servers.
+var DefaultBlacklist = NewBlacklist(DefaultBanThreshold, DefaultFailureWindow, DefaultBanDuration)
+
+// Ban bans the peer manually, a zero ttl bans the peer permanently.
+func (b *Blacklist) Ban(key string, reason string, ttl time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+	e := &BlacklistEntry{
+		Key:    key,
+		Reason: reason,
+		Manual: true,
+		Since:  now,
+	}
+	if ttl > 0 {
+		e.Expire = now.Add(ttl)
+	}
+	b.banned[key] = e
+	delete(b.grey, key)
+}
+
+// Unban removes the peer from both blacklist and greylist.
+func (b *Blacklist) Unban(key string) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.banned, key)
+	delete(b.grey, key)
+}
+
+// Clear removes all the entries.
+func (b *Blacklist) Clear() {
+	b.Lock()
+	defer b.Unlock()
+	b.banned = make(map[string]*BlacklistEntry)
+	b.grey = make(map[string]*BlacklistEntry)
+}
+
+// ReportFailure records a failure (authentication failure, protocol violation, etc.) of the
+// peer and returns whether the peer is banned. Loopback addresses are never banned automatically.
+func (b *Blacklist) ReportFailure(key string, reason string) (banned bool) {
+	if key == "" {
+		return
+	}
+	if ip := net.ParseIP(key); ip != nil && ip.IsLoopback() {
+		return
+	}
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+	if e, ok := b.banned[key]; ok && !e.expired(now) {
+		return true
+	}
+
+	e, ok := b.grey[key]
+	if !ok || now.Sub(e.Since) > b.window {
+		e = &BlacklistEntry{
+			Key:   key,
+			Since: now,
+		}
+		b.grey[key] = e
+	}
+	e.Failures++
+	e.Reason = reason
+	if e.Failures < b.threshold {
+		return
+	}
+
+	// move to blacklist
+	delete(b.grey, key)
+	e.Since = now
+	e.Expire = now.Add(b.banDuration)
+	b.banned[key] = e
+	log.WithFields(log.Fields{
+		"peer":     key,
+		"reason":   reason,
+		"failures": e.Failures,
+		"expire":   e.Expire.Format(time.RFC3339),
+	}).Warning("peer banned for repeated failures")
+	return true
+}
+
+// IsBanned returns whether the peer is banned.
+func (b *Blacklist) IsBanned(key string) bool {
+	if key == "" {
+		return false
+	}
+	b.RLock()
+	e, ok := b.banned[key]
+	b.RUnlock()
+	if !ok {
+		return false
+	}
+	if e.expired(time.Now()) {
+		b.Lock()
+		if cur, ok := b.banned[key]; ok && cur == e {
+			delete(b.banned, key)
+		}
+		b.Unlock()
+		return false
+	}
+	return true
+}
+
+// Entries returns the unexpired banned and greylisted entries.
+func (b *Blacklist) Entries() (banned []BlacklistEntry, grey []BlacklistEntry) {
+	b.RLock()
+	defer b.RUnlock()
+	now := time.Now()
+	for _, e := range b.banned {
+		if !e.expired(now) {
+			banned = append(banned, *e)
+		}
+	}
+	for _, e := range b.grey {
+		if now.Sub(e.Since) <= b.window {
+			grey = append(grey, *e)
+		}
+	}
+	sort.Slice(banned, func(i, j int) bool { return banned[i].Key < banned[j].Key })
+	sort.Slice(grey, func(i, j int) bool { return grey[i].Key < grey[j].Key })
+	return
+}
+
+// remoteHost returns the host part of the remote address.
+func remoteHost(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+// ServeHTTP implements http.Handler as the read-only view of the blacklist, GET lists banned and
+// greylisted peers. The entries are managed by the AdminHandler.
+func (b *Blacklist) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	b.writeEntries(rw)
+}
+
+// AdminHandler returns the admin api of the blacklist authenticated by the bearer token in the
+// Authorization header, all requests are refused if the token is empty. GET lists banned and
+// greylisted peers, POST bans a peer with form values key, reason and ttl (e.g. 1h, empty for
+// permanent), DELETE removes a peer with form value key or clears all entries without key.
+//
+// The handler is not registered to any mux, it should only be mounted on an admin listener.
+func (b *Blacklist) AdminHandler(token string) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var auth = r.Header.Get("Authorization")
+		if token == "" || !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) != 1 {
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		b.serveAdmin(rw, r)
+	})
+}
+
+func (b *Blacklist) serveAdmin(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var (
+			key = r.FormValue("key")
+			ttl time.Duration
+			err error
+		)
+		if key == "" {
+			http.Error(rw, "missing key", http.StatusBadRequest)
+			return
+		}
+		if v := r.FormValue("ttl"); v != "" {
+			if ttl, err = time.ParseDuration(v); err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		b.Ban(key, r.FormValue("reason"), ttl)
+	case http.MethodDelete:
+		if key := r.FormValue("key"); key != "" {
+			b.Unban(key)
+		} else {
+			b.Clear()
+		}
+	default:
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	b.writeEntries(rw)
+}
+
+func (b *Blacklist) writeEntries(rw http.ResponseWriter) {
+	banned, grey := b.Entries()
+	rw.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(rw).Encode(map[string]interface{}{
+		"blacklist": banned,
+		"greylist":  grey,
+	})
+}
+
+func init() {
+	// register the read-only view beside the expvar handler
+	http.Handle("/debug/blacklist", DefaultBlacklist)
+}
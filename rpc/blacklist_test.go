@@ -0,0 +1,119 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rpc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBlacklist(t *testing.T) {
+	Convey("Given a blacklist with threshold 3", t, func() {
+		b := NewBlacklist(3, time.Minute, time.Hour)
+
+		Convey("Repeated failures should greylist then ban the peer", func() {
+			So(b.ReportFailure("10.0.0.1", "auth failed"), ShouldBeFalse)
+			So(b.ReportFailure("10.0.0.1", "auth failed"), ShouldBeFalse)
+			banned, grey := b.Entries()
+			So(banned, ShouldBeEmpty)
+			So(grey, ShouldHaveLength, 1)
+			So(grey[0].Failures, ShouldEqual, 2)
+			So(b.IsBanned("10.0.0.1"), ShouldBeFalse)
+
+			So(b.ReportFailure("10.0.0.1", "auth failed"), ShouldBeTrue)
+			So(b.IsBanned("10.0.0.1"), ShouldBeTrue)
+			banned, grey = b.Entries()
+			So(banned, ShouldHaveLength, 1)
+			So(grey, ShouldBeEmpty)
+
+			b.Unban("10.0.0.1")
+			So(b.IsBanned("10.0.0.1"), ShouldBeFalse)
+		})
+
+		Convey("Loopback addresses should never be banned automatically", func() {
+			for i := 0; i < 5; i++ {
+				So(b.ReportFailure("127.0.0.1", "auth failed"), ShouldBeFalse)
+			}
+			So(b.IsBanned("127.0.0.1"), ShouldBeFalse)
+		})
+
+		Convey("Manual bans should expire", func() {
+			b.Ban("node", "operator", time.Millisecond)
+			b.Ban("node2", "operator", 0)
+			So(b.IsBanned("node"), ShouldBeTrue)
+			time.Sleep(5 * time.Millisecond)
+			So(b.IsBanned("node"), ShouldBeFalse)
+			So(b.IsBanned("node2"), ShouldBeTrue)
+		})
+
+		Convey("The admin api should manage entries", func() {
+			var (
+				admin = b.AdminHandler("secret")
+				ban   = func(token string) *http.Request {
+					req := httptest.NewRequest(http.MethodPost, "/debug/blacklist",
+						strings.NewReader(url.Values{"key": {"node"}, "ttl": {"1h"}}.Encode()))
+					req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+					if token != "" {
+						req.Header.Set("Authorization", "Bearer "+token)
+					}
+					return req
+				}
+			)
+			rec := httptest.NewRecorder()
+			admin.ServeHTTP(rec, ban("secret"))
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(rec.Body.String(), ShouldContainSubstring, `"key":"node"`)
+			So(b.IsBanned("node"), ShouldBeTrue)
+
+			rec = httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodDelete, "/debug/blacklist", nil)
+			req.Header.Set("Authorization", "Bearer secret")
+			admin.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(b.IsBanned("node"), ShouldBeFalse)
+
+			// unauthenticated requests are refused
+			for _, token := range []string{"", "wrong"} {
+				rec = httptest.NewRecorder()
+				admin.ServeHTTP(rec, ban(token))
+				So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+			}
+			rec = httptest.NewRecorder()
+			b.AdminHandler("").ServeHTTP(rec, ban(""))
+			So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+			So(b.IsBanned("node"), ShouldBeFalse)
+		})
+		Convey("The debug view should be read-only", func() {
+			b.Ban("node", "operator", 0)
+			rec := httptest.NewRecorder()
+			b.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/blacklist", nil))
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(rec.Body.String(), ShouldContainSubstring, `"key":"node"`)
+
+			rec = httptest.NewRecorder()
+			b.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/debug/blacklist", nil))
+			So(rec.Code, ShouldEqual, http.StatusMethodNotAllowed)
+			So(b.IsBanned("node"), ShouldBeTrue)
+		})
+	})
+}
@@ -89,7 +89,7 @@ func (c *Caller) CallNodeWithContext(
 		recordRPCCost(startTime, method, err)
 	}()
 
-	client, err := DialToNodeWithPool(c.pool, node, method == route.DHTPing.String())
+	client, err := DialToNodeWithPool(c.pool, node, route.IsAnonymousMethod(method))
 	if err != nil {
 		err = errors.Wrapf(err, "dial to node %s failed", node)
 		return
@@ -104,6 +104,10 @@ func (c *Caller) CallNodeWithContext(
 		err = ctx.Err()
 	case call := <-ch.Done:
 		err = call.Error
+		if _, ok := err.(rpc.ServerError); ok || err == nil {
+			// the node responded, even with a service error
+			route.MarkNodeAlive(node)
+		}
 		// Set error state so that the associated will not reuse this client
 		if err != nil { // TODO(leventeliu): check recoverable errors
 			if setter, ok := client.(LastErrSetter); ok {
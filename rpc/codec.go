@@ -43,6 +43,10 @@ func NewNodeAwareServerCodec(ctx context.Context, codec rpc.ServerCodec, nodeID
 func (nc *NodeAwareServerCodec) ReadRequestBody(body interface{}) (err error) {
 	err = nc.ServerCodec.ReadRequestBody(body)
 	if err != nil {
+		// malformed request body is considered as protocol violation
+		if nc.NodeID != nil && body != nil {
+			DefaultBlacklist.ReportFailure(string(nc.NodeID.ToNodeID()), "invalid request: "+err.Error())
+		}
 		return
 	}
 
@@ -11,6 +11,7 @@ import (
 	"github.com/sourcegraph/jsonrpc2"
 	wsstream "github.com/sourcegraph/jsonrpc2/websocket"
 
+	"github.com/SQLess/SQLess/route"
 	"github.com/SQLess/SQLess/utils/log"
 )
 
@@ -32,6 +33,7 @@ func (ws *WebsocketServer) Serve() error {
 		handler = defaultHandler
 	}
 
+	mux.Handle("/ready", route.ReadinessHandler())
 	mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
 		conn, err := upgrader.Upgrade(rw, r, nil)
 		if err != nil {
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mux
+
+import (
+	"context"
+	nrpc "net/rpc"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+)
+
+// ProbeNode probes the liveness of the node by calling the DHT.Nil RPC, the node is alive if it
+// responds, even with an error that the DHT service is not served by the node.
+func ProbeNode(ctx context.Context, id proto.NodeID) (err error) {
+	err = NewCaller().CallNodeWithContext(ctx, id, route.DHTRPCName+".Nil", nil, nil)
+	if _, ok := err.(nrpc.ServerError); ok {
+		err = nil
+	}
+	return
+}
+
+// StartLivenessProbe probes the known nodes periodically and evicts the nodes failing the
+// probes consecutively from the routing table, the mux sessions to the evicted nodes are
+// closed. onEvict is called with the evicted nodes if it's not nil, e.g. to remove them from
+// the DHT ring on block producers. Call the returned stop func to stop probing.
+func StartLivenessProbe(onEvict func(id proto.NodeID)) (stop func()) {
+	return route.StartLivenessProbe(ProbeNode, func(id proto.NodeID) {
+		GetSessionPoolInstance().Remove(id)
+		if onEvict != nil {
+			onEvict(id)
+		}
+	})
+}
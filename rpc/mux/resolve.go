@@ -23,6 +23,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/SQLess/SQLess/conf"
 	"github.com/SQLess/SQLess/crypto/kms"
 	"github.com/SQLess/SQLess/naconn"
 	"github.com/SQLess/SQLess/proto"
@@ -95,6 +96,7 @@ func GetNodeAddr(id *proto.RawNodeID) (addr string, err error) {
 				return
 			}
 			_ = route.SetNodeAddrCache(id, node.Addr)
+			route.RecordNode(node)
 			addr = node.Addr
 		}
 	}
@@ -119,13 +121,26 @@ func GetNodeInfo(id *proto.RawNodeID) (nodeInfo *proto.Node, err error) {
 			if errSet != nil {
 				log.WithError(errSet).Warning("set node to kms failed")
 			}
+			route.RecordNode(nodeInfo)
 		}
 	}
 	return
 }
 
-// FindNodeInBP find node in block producer dht service.
+// FindNodeInBP find node in block producer dht service, or in the known nodes of the static
+// topology.
 func FindNodeInBP(id *proto.RawNodeID) (node *proto.Node, err error) {
+	if conf.GConf != nil && conf.GConf.StaticTopology {
+		// no discovery in the static topology
+		var ok bool
+		if node, ok = conf.GConf.StaticNode(proto.NodeID(id.String())); !ok {
+			err = errors.Wrapf(route.ErrUnknownNodeID, "node %s is not in the static topology", id)
+			return
+		}
+		cpy := *node
+		node = &cpy
+		return
+	}
 	bps := route.GetBPs()
 	if len(bps) == 0 {
 		err = errors.New("no available BP")
@@ -140,8 +155,12 @@ func FindNodeInBP(id *proto.RawNodeID) (node *proto.Node, err error) {
 	offset := rand.Intn(bpCount)
 	method := route.DHTFindNode.String()
 
+	// start from a random block producer, the recently alive ones are preferred
+	candidates := make([]proto.NodeID, 0, bpCount)
 	for i := 0; i != bpCount; i++ {
-		bp := bps[(offset+i)%bpCount]
+		candidates = append(candidates, bps[(offset+i)%bpCount])
+	}
+	for _, bp := range route.PreferAliveNodes(candidates) {
 		err = client.CallNode(bp, method, req, resp)
 		if err == nil {
 			node = resp.Node
@@ -163,7 +182,8 @@ func PingBP(node *proto.Node, BPNodeID proto.NodeID) (err error) {
 	client := NewCaller()
 
 	req := &proto.PingReq{
-		Node: *node,
+		Node:  *node,
+		Build: conf.GetBuildInfo(),
 	}
 
 	resp := new(proto.PingResp)
@@ -198,6 +218,16 @@ func GetCurrentBP() (bpNodeID proto.NodeID, err error) {
 		return
 	}
 
+	// pick a random block producer among the recently alive ones
+	var alive []proto.NodeID
+	for _, id := range bpList {
+		if _, ok := route.NodeFreshness(id); ok {
+			alive = append(alive, id)
+		}
+	}
+	if len(alive) > 0 {
+		bpList = alive
+	}
 	randomBP := bpList[rand.Intn(len(bpList))]
 
 	// call random block producer for nearest block producer node
@@ -298,3 +328,24 @@ func RegisterNodeToBP(timeout time.Duration) (err error) {
 
 	return
 }
+
+// Provision sends DHT.Provision request with anonymous ETLS session, returns the yaml encoded
+// network config for the new node.
+func Provision(token *proto.ProvisionToken, node *proto.Node, BPNodeID proto.NodeID) (config []byte, err error) {
+	client := NewCaller()
+
+	req := &proto.ProvisionReq{
+		Token: *token,
+		Node:  *node,
+		Build: conf.GetBuildInfo(),
+	}
+
+	resp := new(proto.ProvisionResp)
+	err = client.CallNode(BPNodeID, route.DHTProvision.String(), req, resp)
+	if err != nil {
+		err = errors.Wrap(err, "call DHT.Provision failed")
+		return
+	}
+	config = resp.Config
+	return
+}
@@ -69,7 +69,7 @@ func (c *PersistentCaller) Call(method string, args interface{}, reply interface
 		recordRPCCost(startTime, method, err)
 	}()
 
-	isAnonymous := (method == route.DHTPing.String())
+	isAnonymous := route.IsAnonymousMethod(method)
 	err = c.initClient(isAnonymous)
 	if err != nil {
 		err = errors.Wrap(err, "init PersistentCaller client failed")
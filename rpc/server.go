@@ -24,9 +24,11 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/SQLess/SQLess/conf"
 	"github.com/SQLess/SQLess/crypto/kms"
 	"github.com/SQLess/SQLess/naconn"
 	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
 	"github.com/SQLess/SQLess/utils/log"
 )
 
@@ -75,6 +77,9 @@ func (s *Server) InitRPCServer(
 ) (err error) {
 	//route.InitResolver()
 
+	if len(masterKey) == 0 && conf.GConf != nil {
+		masterKey = []byte(conf.GConf.MasterKey.Value())
+	}
 	err = kms.InitLocalKeyPair(privateKeyPath, masterKey)
 	if err != nil {
 		err = errors.Wrap(err, "init local key pair failed")
@@ -118,9 +123,16 @@ serverLoop:
 
 func (s *Server) serveConn(conn net.Conn) {
 	le := log.WithField("remote_addr", conn.RemoteAddr())
+	host := remoteHost(conn.RemoteAddr())
+	if DefaultBlacklist.IsBanned(host) {
+		le.Debug("reject conn from banned address")
+		_ = conn.Close()
+		return
+	}
 	stream, err := s.acceptConn(s.ctx, conn)
 	if err != nil {
 		le.WithError(err).Error("failed to accept conn")
+		DefaultBlacklist.ReportFailure(host, "accept failed: "+err.Error())
 		return
 	}
 	defer func() { _ = stream.Close() }()
@@ -130,6 +142,14 @@ func (s *Server) serveConn(conn net.Conn) {
 		id := remoter.Remote()
 		remote = &id
 		le = le.WithField("remote_node", id)
+		if DefaultBlacklist.IsBanned(string(id.ToNodeID())) {
+			le.Debug("reject conn from banned node")
+			return
+		}
+		if route.IsRevoked(id.ToNodeID()) {
+			le.Warning("reject conn from revoked node")
+			return
+		}
 	}
 	le.Debug("accept server conn")
 	// Serve data stream
@@ -0,0 +1,268 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sqlchain
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SQLess/SQLess/route"
+	rpc "github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// MaxBillingBatchSize defines the max count of billing statements submitted in a batch.
+	MaxBillingBatchSize = 64
+	// MaxBillingBatchDelay defines the max delay of a billing statement before it's submitted.
+	MaxBillingBatchDelay = 2 * time.Second
+	// MaxPendingBillingStatements defines the max count of billing statements queued for
+	// submission, the oldest statements are dropped beyond it.
+	MaxPendingBillingStatements = 4096
+	// MaxBillingSubmitAttempts defines the max submission attempts of a billing statement.
+	MaxBillingSubmitAttempts = 3
+	// MaxBillingSubmitParallel defines the max concurrent single submissions of a failed batch.
+	MaxBillingSubmitParallel = 8
+)
+
+// statementBatcher is shared by all the sqlchains of the miner.
+var statementBatcher = newBillingBatcher(
+	MaxBillingBatchSize, MaxPendingBillingStatements, MaxBillingBatchDelay, rpc.RequestBP)
+
+// pendingStatement is a billing statement queued for submission.
+type pendingStatement struct {
+	statement *types.SignedBillingStatement
+	attempts  int
+}
+
+// billingBatcher collects the billing statements of all the databases on the miner and submits
+// them to block producer in compressed batches. The batching delay adapts to the statement rate:
+// a lonely statement is submitted at once, while the delay grows up to the bound as the previous
+// batch gets larger. Adding a statement never blocks the caller, the queue is bounded and the
+// failed statements are queued again until they run out of attempts.
+type billingBatcher struct {
+	maxSize    int
+	maxPending int
+	maxDelay   time.Duration
+	submit     func(method string, req interface{}, resp interface{}) error
+
+	once    sync.Once
+	notify  chan struct{}
+	mu      sync.Mutex
+	pending []*pendingStatement
+}
+
+func newBillingBatcher(
+	maxSize, maxPending int, maxDelay time.Duration,
+	submit func(string, interface{}, interface{}) error,
+) *billingBatcher {
+	if maxSize < 1 {
+		maxSize = 1
+	}
+	if maxPending < maxSize {
+		maxPending = maxSize
+	}
+	return &billingBatcher{
+		maxSize:    maxSize,
+		maxPending: maxPending,
+		maxDelay:   maxDelay,
+		submit:     submit,
+		notify:     make(chan struct{}, 1),
+	}
+}
+
+// add enqueues the signed statement without blocking, the batching worker is started on the
+// first statement.
+func (b *billingBatcher) add(s *types.SignedBillingStatement) {
+	b.once.Do(func() { go b.run() })
+	b.enqueue(&pendingStatement{statement: s})
+}
+
+// enqueue appends the statements to the queue, the oldest statements are dropped if the queue
+// overflows.
+func (b *billingBatcher) enqueue(ps ...*pendingStatement) {
+	b.mu.Lock()
+	b.pending = append(b.pending, ps...)
+	var dropped []*pendingStatement
+	if over := len(b.pending) - b.maxPending; over > 0 {
+		dropped = b.pending[:over]
+		b.pending = append([]*pendingStatement(nil), b.pending[over:]...)
+	}
+	b.mu.Unlock()
+	for _, p := range dropped {
+		logStatement(p.statement).Warning("billing statement queue overflow, statement dropped")
+	}
+	b.signal()
+}
+
+func (b *billingBatcher) signal() {
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (b *billingBatcher) size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// take dequeues at most n statements.
+func (b *billingBatcher) take(n int) (batch []*pendingStatement) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > len(b.pending) {
+		n = len(b.pending)
+	}
+	batch = append(batch, b.pending[:n]...)
+	b.pending = b.pending[n:]
+	return
+}
+
+func (b *billingBatcher) run() {
+	var delay time.Duration
+	for range b.notify {
+		if delay > 0 && b.size() < b.maxSize {
+			var timer = time.NewTimer(delay)
+		collect:
+			for {
+				select {
+				case <-b.notify:
+					if b.size() >= b.maxSize {
+						break collect
+					}
+				case <-timer.C:
+					break collect
+				}
+			}
+			timer.Stop()
+		}
+		var batch = b.take(b.maxSize)
+		if len(batch) == 0 {
+			continue
+		}
+		if b.flush(batch) {
+			delay = b.nextDelay(len(batch))
+		} else {
+			// back off the failed submissions
+			delay = b.maxDelay
+		}
+		if b.size() > 0 {
+			b.signal()
+		}
+	}
+}
+
+// nextDelay returns the batching delay adapted to the size of the previous batch.
+func (b *billingBatcher) nextDelay(last int) time.Duration {
+	if b.maxSize <= 1 || last <= 1 {
+		return 0
+	}
+	if last >= b.maxSize {
+		return b.maxDelay
+	}
+	return time.Duration(last-1) * b.maxDelay / time.Duration(b.maxSize-1)
+}
+
+// flush submits the batch, ok reports whether all the statements reached the block producer.
+func (b *billingBatcher) flush(batch []*pendingStatement) (ok bool) {
+	if len(batch) == 1 {
+		return b.submitSingles(batch)
+	}
+	var (
+		req = &types.SubmitBillingStatementsReq{
+			Statements: make([]types.SignedBillingStatement, len(batch)),
+		}
+		resp = &types.SubmitBillingStatementsResp{}
+	)
+	for i, p := range batch {
+		req.Statements[i] = *p.statement
+	}
+	if err := req.Compress(types.CompressionDeflate); err != nil {
+		log.WithError(err).Warning("compress billing statements failed")
+	}
+	if err := b.submit(route.MCCSubmitBillingStatements.String(), req, resp); err != nil {
+		// the block producer may not support batching yet, the statements are idempotent
+		log.WithError(err).WithField("count", len(batch)).Warning(
+			"submit billing statements failed, fall back to single submissions")
+		return b.submitSingles(batch)
+	}
+	for i, e := range resp.Errors {
+		if e != "" && i < len(batch) {
+			logStatement(batch[i].statement).Warningf("billing statement refused: %s", e)
+		}
+	}
+	return true
+}
+
+// submitSingles submits the statements one by one concurrently, the failed statements are
+// queued again.
+func (b *billingBatcher) submitSingles(batch []*pendingStatement) (ok bool) {
+	var (
+		wg     sync.WaitGroup
+		sem    = make(chan struct{}, MaxBillingSubmitParallel)
+		failed = make([]bool, len(batch))
+		retry  []*pendingStatement
+	)
+	for i, p := range batch {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, p *pendingStatement) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			failed[i] = !b.submitOne(p.statement)
+		}(i, p)
+	}
+	wg.Wait()
+	for i, p := range batch {
+		if !failed[i] {
+			continue
+		}
+		if p.attempts++; p.attempts < MaxBillingSubmitAttempts {
+			retry = append(retry, p)
+		} else {
+			logStatement(p.statement).Warning("billing statement dropped after max attempts")
+		}
+	}
+	if len(retry) > 0 {
+		b.enqueue(retry...)
+	}
+	return len(retry) == 0
+}
+
+func (b *billingBatcher) submitOne(s *types.SignedBillingStatement) (ok bool) {
+	var (
+		req  = &types.SubmitBillingStatementReq{Statement: *s}
+		resp = &types.SubmitBillingStatementResp{}
+	)
+	if err := b.submit(route.MCCSubmitBillingStatement.String(), req, resp); err != nil {
+		logStatement(s).WithError(err).Warning("submit billing statement failed")
+		return false
+	}
+	return true
+}
+
+func logStatement(s *types.SignedBillingStatement) *log.Entry {
+	return log.WithFields(log.Fields{
+		"db":   s.DatabaseID,
+		"from": s.Range.From,
+		"to":   s.Range.To,
+	})
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sqlchain
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+)
+
+type fakeBillingBP struct {
+	sync.Mutex
+	batchErr  error
+	singleErr error
+	blocked   chan struct{}
+	calls     map[string]int
+	received  []proto.DatabaseID
+}
+
+func (bp *fakeBillingBP) submit(method string, req interface{}, resp interface{}) (err error) {
+	if bp.blocked != nil {
+		<-bp.blocked
+	}
+	bp.Lock()
+	defer bp.Unlock()
+	bp.calls[method]++
+	switch r := req.(type) {
+	case *types.SubmitBillingStatementReq:
+		if bp.singleErr != nil {
+			return bp.singleErr
+		}
+		bp.received = append(bp.received, r.Statement.DatabaseID)
+	case *types.SubmitBillingStatementsReq:
+		if bp.batchErr != nil {
+			return bp.batchErr
+		}
+		if err = r.Decompress(); err != nil {
+			return
+		}
+		for _, s := range r.Statements {
+			bp.received = append(bp.received, s.DatabaseID)
+		}
+		resp.(*types.SubmitBillingStatementsResp).Errors = make([]string, len(r.Statements))
+	}
+	return
+}
+
+func (bp *fakeBillingBP) count() int {
+	bp.Lock()
+	defer bp.Unlock()
+	return len(bp.received)
+}
+
+func TestBillingBatcher(t *testing.T) {
+	Convey("test billing statement batching", t, func() {
+		var (
+			bp = &fakeBillingBP{calls: make(map[string]int)}
+			b  = newBillingBatcher(4, 8, 100*time.Millisecond, bp.submit)
+		)
+		So(b.nextDelay(1), ShouldEqual, time.Duration(0))
+		So(b.nextDelay(4), ShouldEqual, 100*time.Millisecond)
+		So(b.nextDelay(3), ShouldBeBetween, time.Duration(0), 100*time.Millisecond)
+
+		Convey("full batches should be submitted at once", func() {
+			for i := 0; i < 8; i++ {
+				b.add(&types.SignedBillingStatement{
+					BillingStatementHeader: types.BillingStatementHeader{
+						DatabaseID: proto.DatabaseID("db"),
+					},
+				})
+			}
+			for i := 0; i < 50 && bp.count() < 8; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			So(bp.count(), ShouldEqual, 8)
+			bp.Lock()
+			defer bp.Unlock()
+			So(bp.calls[route.MCCSubmitBillingStatements.String()], ShouldBeGreaterThan, 0)
+		})
+		Convey("batches should fall back to single submissions", func() {
+			bp.batchErr = errors.New("can't find method")
+			So(b.flush([]*pendingStatement{
+				{statement: &types.SignedBillingStatement{}},
+				{statement: &types.SignedBillingStatement{}},
+				{statement: &types.SignedBillingStatement{}},
+			}), ShouldBeTrue)
+			So(bp.count(), ShouldEqual, 3)
+			So(bp.calls[route.MCCSubmitBillingStatement.String()], ShouldEqual, 3)
+			So(b.size(), ShouldEqual, 0)
+		})
+		Convey("failed statements should be queued again until they run out of attempts", func() {
+			bp.batchErr = errors.New("bp unavailable")
+			bp.singleErr = errors.New("bp unavailable")
+			var p = &pendingStatement{statement: &types.SignedBillingStatement{}}
+			for i := 1; i < MaxBillingSubmitAttempts; i++ {
+				So(b.flush([]*pendingStatement{p}), ShouldBeFalse)
+				So(p.attempts, ShouldEqual, i)
+				So(b.take(b.maxSize), ShouldResemble, []*pendingStatement{p})
+			}
+			So(b.flush([]*pendingStatement{p}), ShouldBeTrue)
+			So(b.size(), ShouldEqual, 0)
+			So(bp.count(), ShouldEqual, 0)
+		})
+		Convey("adding statements should not block on a stuck block producer", func() {
+			bp.blocked = make(chan struct{})
+			defer close(bp.blocked)
+			var done = make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 32; i++ {
+					b.add(&types.SignedBillingStatement{
+						BillingStatementHeader: types.BillingStatementHeader{
+							DatabaseID: proto.DatabaseID(fmt.Sprint("db", i)),
+						},
+					})
+				}
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("add blocked on a stuck block producer")
+			}
+			// the queue is bounded, the oldest statements are dropped
+			So(b.size(), ShouldBeLessThanOrEqualTo, b.maxPending)
+		})
+	})
+}
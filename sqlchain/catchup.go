@@ -0,0 +1,222 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+var (
+	// CatchUpBatchSize is the height count of a block batch fetched during catch-up, the
+	// catch-up is skipped if the chain is less than one batch behind.
+	CatchUpBatchSize int32 = 100
+	// CatchUpParallelism is the count of block batches fetched concurrently during catch-up.
+	CatchUpParallelism = 4
+	// MaxFetchBlocksCount is the max height count served by a single FetchBlocks call.
+	MaxFetchBlocksCount int32 = 1000
+)
+
+// blockBatch defines a block batch of the height range [from, to] fetched during catch-up.
+type blockBatch struct {
+	from, to int32
+	blocks   []*types.Block
+	err      error
+	done     chan struct{}
+}
+
+// catchUp fetches the missing blocks in batches from the peers in parallel, and pushes them in
+// height order. The blocks of each batch are verified as soon as the batch arrives, so a bad
+// batch is refetched from another peer. As the batches are fetched in parallel, a batch is only
+// known to extend the pushed blocks when it is pushed: the first block must link to the last
+// pushed block, otherwise a block is missing in between and the batch is refetched from the
+// peers with the parent checked. Any unrecoverable failure stops the catch-up, and the heights
+// after the last pushed block are synchronized one by one.
+func (c *Chain) catchUp() (err error) {
+	var (
+		head  = c.rt.getHead().Height
+		from  = c.rt.getNextTurn() - 1
+		to    = c.rt.getHeightFromTime(c.rt.now()) - 1
+		peers []proto.NodeID
+	)
+	if from <= head {
+		from = head + 1
+	}
+	if to-from+1 < CatchUpBatchSize {
+		return
+	}
+	for _, s := range c.rt.getPeers().Servers {
+		if s != c.rt.getServer() {
+			peers = append(peers, s)
+		}
+	}
+	if len(peers) == 0 {
+		return
+	}
+
+	var batches []*blockBatch
+	for h := from; h <= to; h += CatchUpBatchSize {
+		b := &blockBatch{from: h, to: h + CatchUpBatchSize - 1, done: make(chan struct{})}
+		if b.to > to {
+			b.to = to
+		}
+		batches = append(batches, b)
+	}
+
+	var (
+		le            = c.logEntryWithHeadState()
+		child, cancel = context.WithCancel(c.rt.ctx)
+		wg            = &sync.WaitGroup{}
+		// bounds the batches fetched but not pushed yet
+		window = make(chan struct{}, CatchUpParallelism)
+	)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	le.WithFields(log.Fields{
+		"from":    from,
+		"to":      to,
+		"batches": len(batches),
+	}).Info("catching up blocks in batches")
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i, b := range batches {
+			select {
+			case window <- struct{}{}:
+			case <-child.Done():
+				return
+			}
+			wg.Add(1)
+			go func(i int, b *blockBatch) {
+				defer wg.Done()
+				defer close(b.done)
+				b.blocks, b.err = c.fetchBlockBatch(child, peers, i, b.from, b.to, nil)
+			}(i, b)
+		}
+	}()
+
+	var parent = c.rt.getHead().Head
+	for i, b := range batches {
+		select {
+		case <-b.done:
+		case <-child.Done():
+			return child.Err()
+		}
+		if b.err != nil {
+			return b.err
+		}
+		if len(b.blocks) > 0 && !b.blocks[0].ParentHash().IsEqual(&parent) {
+			le.WithFields(log.Fields{
+				"from":   b.from,
+				"to":     b.to,
+				"parent": parent.String(),
+			}).Warning("block batch does not extend the pushed blocks, refetch it")
+			if b.blocks, err = c.fetchBlockBatch(child, peers, i+1, b.from, b.to, &parent); err != nil {
+				return
+			}
+		}
+		for _, block := range b.blocks {
+			// the expected producer is checked by the turn of the block height
+			var turn = c.rt.getNextTurn()
+			c.rt.SetNextTurn(c.rt.getHeightFromTime(block.Timestamp()) + 1)
+			if err = c.CheckAndPushNewBlock(block); err != nil {
+				// the block is synchronized again by height
+				c.rt.SetNextTurn(turn)
+				return errors.Wrapf(err, "push block %s", block.BlockHash())
+			}
+			parent = *block.BlockHash()
+		}
+		b.blocks = nil
+		<-window
+	}
+	le.WithField("height", to).Info("block batch catch-up finished")
+	return
+}
+
+// fetchBlockBatch fetches and verifies the block batch, the peers are tried in turn starting
+// from the one assigned by the batch index. The first block of the batch must extend the parent
+// if it is not nil.
+func (c *Chain) fetchBlockBatch(
+	ctx context.Context, peers []proto.NodeID, index int, from, to int32, parent *hash.Hash,
+) (blocks []*types.Block, err error) {
+	for i := range peers {
+		var (
+			node = peers[(index+i)%len(peers)]
+			req  = &MuxFetchBlocksReq{
+				DatabaseID:     c.databaseID,
+				FetchBlocksReq: FetchBlocksReq{From: from, To: to},
+			}
+			resp = &MuxFetchBlocksResp{}
+		)
+		if err = c.cl.CallNodeWithContext(
+			ctx, node, route.SQLCFetchBlocks.String(), req, resp,
+		); err == nil {
+			err = c.verifyBlockBatch(from, to, parent, &resp.FetchBlocksResp)
+		}
+		if err == nil {
+			return resp.Blocks, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		c.logEntry().WithError(err).WithFields(log.Fields{
+			"remote": node,
+			"from":   from,
+			"to":     to,
+		}).Warning("failed to fetch block batch from peer")
+	}
+	return nil, errors.Wrapf(err, "fetch blocks [%d, %d] from all peers failed", from, to)
+}
+
+// verifyBlockBatch checks the range, chaining and signatures of the blocks in the batch, and that
+// the first block extends the parent if it is not nil. A peer may still truncate the batch, which
+// is detected by the chaining of the next batch, so the catch-up never trusts the batch range.
+func (c *Chain) verifyBlockBatch(from, to int32, parent *hash.Hash, resp *FetchBlocksResp) (err error) {
+	if resp.Height < to {
+		return errors.Wrapf(ErrInvalidBlockBatch, "peer head %d is behind %d", resp.Height, to)
+	}
+	if parent != nil && (len(resp.Blocks) == 0 || !resp.Blocks[0].ParentHash().IsEqual(parent)) {
+		return errors.Wrapf(ErrInvalidBlockBatch, "batch does not extend %s", parent)
+	}
+	var last int32 = -1
+	for i, b := range resp.Blocks {
+		h := c.rt.getHeightFromTime(b.Timestamp())
+		if h < from || h > to || h <= last {
+			return errors.Wrapf(ErrInvalidBlockBatch, "unexpected block height %d", h)
+		}
+		if i > 0 && !b.ParentHash().IsEqual(resp.Blocks[i-1].BlockHash()) {
+			return errors.Wrapf(ErrInvalidBlockBatch, "block %s does not extend %s",
+				b.BlockHash(), resp.Blocks[i-1].BlockHash())
+		}
+		if err = b.Verify(); err != nil {
+			return errors.Wrapf(err, "verify block %s", b.BlockHash())
+		}
+		last = h
+	}
+	return
+}
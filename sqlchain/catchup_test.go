@@ -0,0 +1,68 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlchain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestVerifyBlockBatch(t *testing.T) {
+	Convey("Given a chain runtime with one hour period", t, func() {
+		var (
+			c = &Chain{rt: &runtime{
+				period:        time.Hour,
+				chainInitTime: testBlocks[0].Timestamp().Add(-time.Minute),
+			}}
+			batch = func(height int32, blocks ...*types.Block) *FetchBlocksResp {
+				return &FetchBlocksResp{
+					Height: height,
+					Blocks: blocks,
+				}
+			}
+		)
+		Convey("A valid batch should pass", func() {
+			So(c.verifyBlockBatch(0, 10, nil, batch(10, testBlocks[0])), ShouldBeNil)
+			So(c.verifyBlockBatch(0, 10, nil, batch(10)), ShouldBeNil)
+			So(c.verifyBlockBatch(0, 10, testBlocks[0].BlockHash(), batch(10, testBlocks[1])), ShouldBeNil)
+		})
+		Convey("A batch from a lagging peer should be rejected", func() {
+			err := c.verifyBlockBatch(0, 10, nil, batch(5, testBlocks[0]))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidBlockBatch)
+		})
+		Convey("A batch out of the height range should be rejected", func() {
+			err := c.verifyBlockBatch(5, 10, nil, batch(10, testBlocks[0]))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidBlockBatch)
+		})
+		Convey("A batch not chained should be rejected", func() {
+			err := c.verifyBlockBatch(0, 10, nil, batch(10, testBlocks[2], testBlocks[0]))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidBlockBatch)
+		})
+		Convey("A batch not extending the parent should be rejected", func() {
+			// the block in between is dropped
+			err := c.verifyBlockBatch(0, 10, testBlocks[0].BlockHash(), batch(10, testBlocks[2]))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidBlockBatch)
+			err = c.verifyBlockBatch(0, 10, testBlocks[0].BlockHash(), batch(10))
+			So(errors.Cause(err), ShouldEqual, ErrInvalidBlockBatch)
+		})
+	})
+}
@@ -23,6 +23,7 @@ import (
 	"encoding/binary"
 	"expvar"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -36,10 +37,12 @@ import (
 
 	"github.com/SQLess/SQLess/crypto"
 	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
 	"github.com/SQLess/SQLess/crypto/kms"
 	"github.com/SQLess/SQLess/proto"
 	"github.com/SQLess/SQLess/route"
 	rpc "github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/storage"
 	"github.com/SQLess/SQLess/types"
 	"github.com/SQLess/SQLess/utils"
 	"github.com/SQLess/SQLess/utils/log"
@@ -72,6 +75,70 @@ var (
 	chainVars = expvar.NewMap(mwMinerChain)
 )
 
+// openChainStorage opens the block and the ack/response storages shared by all the chains.
+func openChainStorage(prefix string) (err error) {
+	leveldbInit.Do(func() {
+		// Open LevelDB for block and state
+		bdbFile := prefix + "-block-state.ldb"
+		blkDB, err = leveldb.OpenFile(bdbFile, &leveldbConf)
+		if err != nil {
+			err = errors.Wrapf(err, "open leveldb %s", bdbFile)
+			return
+		}
+		log.Debugf("opened chain bdb %s", bdbFile)
+
+		// Open LevelDB for ack/request/response
+		tdbFile := prefix + "-ack-req-resp.ldb"
+		txDB, err = leveldb.OpenFile(tdbFile, &leveldbConf)
+		if err != nil {
+			err = errors.Wrapf(err, "open leveldb %s", tdbFile)
+			return
+		}
+		log.Debugf("opened chain tdb %s", tdbFile)
+	})
+	return
+}
+
+// TruncateChain removes the blocks and the acked queries above height of the database from the
+// chain storage, e.g. to rewind the chain to a snapshot the database state is restored from. The
+// chain of the database must be stopped.
+func TruncateChain(prefix string, dbID proto.DatabaseID, height int32) (err error) {
+	if err = openChainStorage(prefix); err != nil {
+		return
+	}
+	metaKeyPrefix, err := dbID.AccountAddress()
+	if err != nil {
+		return
+	}
+	for _, t := range []struct {
+		db    *leveldb.DB
+		index [4]byte
+	}{
+		{blkDB, metaBlockIndex},
+		{txDB, metaResponseIndex},
+		{txDB, metaAckIndex},
+	} {
+		var (
+			keyPrefix = utils.ConcatAll(metaKeyPrefix[:], t.index[:])
+			from      = utils.ConcatAll(keyPrefix, heightToKey(height+1))
+			iter      = t.db.NewIterator(
+				&util.Range{Start: from, Limit: util.BytesPrefix(keyPrefix).Limit}, nil)
+			batch = new(leveldb.Batch)
+		)
+		for iter.Next() {
+			batch.Delete(append([]byte(nil), iter.Key()...))
+		}
+		iter.Release()
+		if err = iter.Error(); err != nil {
+			return
+		}
+		if err = t.db.Write(batch, nil); err != nil {
+			return
+		}
+	}
+	return
+}
+
 // heightToKey converts a height in int32 to a key in bytes.
 func heightToKey(h int32) (key []byte) {
 	key = make([]byte, 4)
@@ -141,26 +208,7 @@ func NewChain(c *Config) (chain *Chain, err error) {
 func NewChainWithContext(ctx context.Context, c *Config) (chain *Chain, err error) {
 	le := log.WithField("db", c.DatabaseID)
 
-	leveldbInit.Do(func() {
-		// Open LevelDB for block and state
-		bdbFile := c.ChainFilePrefix + "-block-state.ldb"
-		blkDB, err = leveldb.OpenFile(bdbFile, &leveldbConf)
-		if err != nil {
-			err = errors.Wrapf(err, "open leveldb %s", bdbFile)
-			return
-		}
-		le.Debugf("opened chain bdb %s", bdbFile)
-
-		// Open LevelDB for ack/request/response
-		tdbFile := c.ChainFilePrefix + "-ack-req-resp.ldb"
-		txDB, err = leveldb.OpenFile(tdbFile, &leveldbConf)
-		if err != nil {
-			err = errors.Wrapf(err, "open leveldb %s", tdbFile)
-			return
-		}
-		le.Debugf("opened chain tdb %s", tdbFile)
-	})
-	if err != nil {
+	if err = openChainStorage(c.ChainFilePrefix); err != nil {
 		return
 	}
 
@@ -722,6 +770,10 @@ func (c *Chain) sync() (err error) {
 		c.pruneBlockCache()
 		c.ai.advance(c.rt.getMinValidHeight())
 	}()
+	if err = c.catchUp(); err != nil {
+		le.WithError(err).Warning("block batch catch-up stopped, synchronizing by height")
+		err = nil
+	}
 	for {
 		now := c.rt.now()
 		height := c.rt.getHeightFromTime(now)
@@ -784,10 +836,20 @@ func (c *Chain) processBlocks(ctx context.Context) {
 			period := int32(c.updatePeriod)
 			isBillingPeriod := (h%period == 0)
 			isMyTurnBilling := (h/period%total == index)
+			if isBillingPeriod && !isMyTurnBilling {
+				// every miner submits its own statement for auditing the billing
+				if ub, err := c.billing(h, c.rt.getHead().node); err != nil {
+					le.WithError(err).Error("billing statement failed")
+				} else {
+					go c.submitBillingStatement(ub)
+				}
+			}
 			if isBillingPeriod && isMyTurnBilling {
 				ub, err := c.billing(h, c.rt.getHead().node)
 				if err != nil {
 					le.WithError(err).Error("billing failed")
+				} else {
+					go c.submitBillingStatement(ub)
 				}
 				// allocate nonce
 				nonceReq := &types.NextAccountNonceReq{}
@@ -862,6 +924,94 @@ func (c *Chain) Start() (err error) {
 	return
 }
 
+// Head returns the current head block hash and height of the chain.
+func (c *Chain) Head() (h hash.Hash, height int32) {
+	head := c.rt.getHead()
+	return head.Head, head.Height
+}
+
+// Staleness returns how long the head block lags behind the current chain time, a replica
+// which is up to date always has zero staleness.
+func (c *Chain) Staleness() time.Duration {
+	return time.Duration(c.StaleBlocks()) * c.rt.period
+}
+
+// StaleBlocks returns how many blocks the head block lags behind the current chain time.
+func (c *Chain) StaleBlocks() int32 {
+	_, height := c.Head()
+	lag := c.rt.getHeightFromTime(c.rt.now()) - height - 1
+	if lag <= 0 {
+		return 0
+	}
+	return lag
+}
+
+// Export exports the current committed database state to a plain SQLite file, the head block
+// which the exported state is based on is also returned. The head block is read while the
+// snapshot of the export is pinned, so it's always included in the exported state.
+func (c *Chain) Export(ctx context.Context, filename string) (h hash.Hash, height int32, err error) {
+	err = c.st.Export(ctx, filename, func() { h, height = c.Head() })
+	return
+}
+
+// DryRun executes the queries on a shadow copy of the current committed database state created
+// under dir. The head block is read while the snapshot of the copy is pinned, so the returned
+// head is always included in the shadow copy.
+func (c *Chain) DryRun(ctx context.Context, dir string, queries []types.Query) (
+	h hash.Hash, height int32, estimates []types.MigrationEstimate, err error,
+) {
+	estimates, err = c.st.DryRun(ctx, dir, queries, func() { h, height = c.Head() })
+	return
+}
+
+// TableUsage returns the page size and the approximate storage usage of each table in the
+// current database state.
+func (c *Chain) TableUsage(ctx context.Context) (pageSize uint64, usage []types.TableUsage, err error) {
+	return c.st.TableUsage(ctx)
+}
+
+// FirewallOverrides returns the sql firewall rules allowed by the database owner in the current
+// database state.
+func (c *Chain) FirewallOverrides(ctx context.Context) (rules []string, err error) {
+	return c.st.FirewallOverrides(ctx)
+}
+
+// Maintenance returns the read-only maintenance mode switched by the database owner in the
+// current database state.
+func (c *Chain) Maintenance(ctx context.Context) (enabled bool, reason string, err error) {
+	return c.st.Maintenance(ctx)
+}
+
+// RowDigests returns the digests of the table rows in the rowid range [from, to] of the
+// current database state.
+func (c *Chain) RowDigests(ctx context.Context, table string, from, to int64, buckets uint32) (
+	ranges []types.RowRangeDigest, rows []types.RowDigest, err error,
+) {
+	return c.st.RowDigests(ctx, table, from, to, buckets)
+}
+
+// PrefixedValues returns the distinct values starting with prefix stored in the database.
+func (c *Chain) PrefixedValues(ctx context.Context, prefix string) (values []string, err error) {
+	return c.st.PrefixedValues(ctx, prefix)
+}
+
+// StateDigest returns the deterministic digest of the current database state.
+func (c *Chain) StateDigest() (d *types.StateDigest, err error) {
+	return c.st.Digest()
+}
+
+// PinStateDigest pins a read snapshot of the current database state, the digest of which can
+// be computed asynchronously.
+func (c *Chain) PinStateDigest(ctx context.Context) (snap *x.DigestSnapshot, err error) {
+	return c.st.PinDigest(ctx)
+}
+
+// Rekey rewrites the database storage to the target, e.g. with a new encryption key, in
+// background while the queries are still served.
+func (c *Chain) Rekey(ctx context.Context, target *storage.DSN, opts xs.CopyOptions) (err error) {
+	return c.st.Rekey(ctx, target, opts)
+}
+
 // Stop stops the main process of the sql-chain.
 func (c *Chain) Stop() (err error) {
 	// Stop main process
@@ -886,6 +1036,29 @@ func (c *Chain) FetchBlock(height int32) (b *types.Block, err error) {
 	return
 }
 
+// FetchBlocks fetches the blocks in the height range [from, to] from local cache in height order,
+// at most MaxFetchBlocksCount heights are fetched.
+func (c *Chain) FetchBlocks(from, to int32) (blocks []*types.Block, err error) {
+	if to-from >= MaxFetchBlocksCount {
+		to = from + MaxFetchBlocksCount - 1
+	}
+	var nodes []*blockNode
+	for n := c.rt.getHead().node; n != nil && n.height >= from; n = n.parent {
+		if n.height <= to {
+			nodes = append(nodes, n)
+		}
+	}
+	blocks = make([]*types.Block, 0, len(nodes))
+	for i := len(nodes) - 1; i >= 0; i-- {
+		var b *types.Block
+		if b, err = c.fetchBlockByIndexKey(nodes[i].indexKey()); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return
+}
+
 // FetchBlockByCount fetches the block at specified count from local cache.
 func (c *Chain) FetchBlockByCount(count int32) (b *types.Block, realCount int32, height int32, err error) {
 	var n *blockNode
@@ -1179,6 +1352,31 @@ func (c *Chain) billing(h int32, node *blockNode) (ub *types.UpdateBilling, err
 	return
 }
 
+// submitBillingStatement submits the usage statement of the billing period to block producer,
+// which is validated against the UpdateBilling transaction of the same period. The statements of
+// all databases on the miner are submitted in batches.
+func (c *Chain) submitBillingStatement(ub *types.UpdateBilling) {
+	var (
+		le        = c.logEntry().WithFields(log.Fields{"from": ub.Range.From, "to": ub.Range.To})
+		statement = &types.SignedBillingStatement{
+			BillingStatementHeader: types.BillingStatementHeader{
+				DatabaseID: c.databaseID,
+				Range:      ub.Range,
+				Users:      make([]*types.UserCost, len(ub.Users)),
+			},
+		}
+	)
+	copy(statement.Users, ub.Users)
+	sort.Slice(statement.Users, func(i, j int) bool {
+		return statement.Users[i].User.String() < statement.Users[j].User.String()
+	})
+	if err := statement.Sign(c.pk); err != nil {
+		le.WithError(err).Warning("sign billing statement failed")
+		return
+	}
+	statementBatcher.add(statement)
+}
+
 // SetLastBillingHeight sets the last billing height of this chain instance.
 func (c *Chain) SetLastBillingHeight(h int32) {
 	c.logEntryWithHeadState().WithFields(
@@ -34,6 +34,7 @@ import (
 	"github.com/SQLess/SQLess/route"
 	rpc "github.com/SQLess/SQLess/rpc/mux"
 	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
 )
 
 var (
@@ -87,6 +88,49 @@ func TestIndexKey(t *testing.T) {
 	}
 }
 
+func TestTruncateChain(t *testing.T) {
+	var (
+		dbID   = proto.DatabaseID(hash.THashH([]byte(t.Name())).String())
+		prefix = path.Join(testDataDir, t.Name())
+	)
+	if err := openChainStorage(prefix); err != nil {
+		t.Fatalf("error occurred: %v", err)
+	}
+	addr, err := dbID.AccountAddress()
+	if err != nil {
+		t.Fatalf("error occurred: %v", err)
+	}
+	var (
+		blockPrefix = utils.ConcatAll(addr[:], metaBlockIndex[:])
+		ackPrefix   = utils.ConcatAll(addr[:], metaAckIndex[:])
+	)
+	for h := int32(0); h < 5; h++ {
+		if err = blkDB.Put(utils.ConcatAll(blockPrefix, heightToKey(h), genesisHash[:]), nil, nil); err != nil {
+			t.Fatalf("error occurred: %v", err)
+		}
+		if err = txDB.Put(utils.ConcatAll(ackPrefix, heightToKey(h), genesisHash[:]), nil, nil); err != nil {
+			t.Fatalf("error occurred: %v", err)
+		}
+	}
+	if err = TruncateChain(prefix, dbID, 2); err != nil {
+		t.Fatalf("error occurred: %v", err)
+	}
+	for h := int32(0); h < 5; h++ {
+		hasBlock, err := blkDB.Has(utils.ConcatAll(blockPrefix, heightToKey(h), genesisHash[:]), nil)
+		if err != nil {
+			t.Fatalf("error occurred: %v", err)
+		}
+		hasAck, err := txDB.Has(utils.ConcatAll(ackPrefix, heightToKey(h), genesisHash[:]), nil)
+		if err != nil {
+			t.Fatalf("error occurred: %v", err)
+		}
+		if expected := h <= 2; hasBlock != expected || hasAck != expected {
+			t.Fatalf("unexpected truncate result at height %d: block=%v ack=%v",
+				h, hasBlock, hasAck)
+		}
+	}
+}
+
 func TestMultiChain(t *testing.T) {
 	//log.SetLevel(log.InfoLevel)
 	// Create genesis block
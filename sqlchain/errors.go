@@ -45,4 +45,7 @@ var (
 	// ErrInitiating indicates that a sqlchain is in initiate state and is not available for sync
 	// requests.
 	ErrInitiating = errors.New("sqlchain is in initiate")
+	// ErrInvalidBlockBatch indicates that a fetched block batch mismatches its checksum or does
+	// not extend the local chain.
+	ErrInvalidBlockBatch = errors.New("invalid block batch")
 )
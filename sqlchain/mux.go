@@ -75,6 +75,20 @@ type MuxFetchBlockResp struct {
 	FetchBlockResp
 }
 
+// MuxFetchBlocksReq defines a request of the FetchBlocks RPC method.
+type MuxFetchBlocksReq struct {
+	proto.Envelope
+	proto.DatabaseID
+	FetchBlocksReq
+}
+
+// MuxFetchBlocksResp defines a response of the FetchBlocks RPC method.
+type MuxFetchBlocksResp struct {
+	proto.Envelope
+	proto.DatabaseID
+	FetchBlocksResp
+}
+
 // AdviseNewBlock is the RPC method to advise a new produced block to the target server.
 func (s *MuxService) AdviseNewBlock(req *MuxAdviseNewBlockReq, resp *MuxAdviseNewBlockResp) error {
 	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
@@ -96,3 +110,14 @@ func (s *MuxService) FetchBlock(req *MuxFetchBlockReq, resp *MuxFetchBlockResp)
 
 	return ErrUnknownMuxRequest
 }
+
+// FetchBlocks is the RPC method to fetch a batch of known blocks from the target server.
+func (s *MuxService) FetchBlocks(req *MuxFetchBlocksReq, resp *MuxFetchBlocksResp) (err error) {
+	if v, ok := s.serviceMap.Load(req.DatabaseID); ok {
+		resp.Envelope = req.Envelope
+		resp.DatabaseID = req.DatabaseID
+		return v.(*ChainRPCService).FetchBlocks(&req.FetchBlocksReq, &resp.FetchBlocksResp)
+	}
+
+	return ErrUnknownMuxRequest
+}
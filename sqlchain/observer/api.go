@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -32,14 +33,19 @@ import (
 
 	"github.com/SQLess/SQLess/crypto/hash"
 	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
 	_ "github.com/SQLess/SQLess/sqlchain/observer/statik" // to embed the shardchain-explorer
 	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
 	"github.com/SQLess/SQLess/utils/log"
 )
 
 var (
 	apiTimeout     = time.Second * 10
 	apiProxyPrefix = "/apiproxy.cqlprotocol"
+
+	// maxQueryRequestSize limits the body size of the replica query requests.
+	maxQueryRequestSize int64 = 1 << 20
 )
 
 func sendResponse(code int, success bool, msg interface{}, data interface{}, rw http.ResponseWriter) {
@@ -95,6 +101,20 @@ func (a *explorerAPI) GetAllSubscriptions(rw http.ResponseWriter, r *http.Reques
 	sendResponse(200, true, "", subscriptions, rw)
 }
 
+func (a *explorerAPI) Search(rw http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	results, err := a.service.search(r.URL.Query().Get("q"), limit)
+	if err == ErrInvalidSearchQuery {
+		sendResponse(400, false, err, nil, rw)
+		return
+	} else if err != nil {
+		sendResponse(500, false, err, nil, rw)
+		return
+	}
+
+	sendResponse(200, true, "", results, rw)
+}
+
 func (a *explorerAPI) GetAck(rw http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
@@ -445,6 +465,44 @@ func (a *explorerAPI) GetHighestBlockV3(rw http.ResponseWriter, r *http.Request)
 	sendResponse(200, true, "", a.formatBlockV3(count, height, block, op), rw)
 }
 
+// Query runs the read queries on the materialized replica of the database, the request and the
+// response are encoded in msgpack to keep the value types, see types.ObserverQueryReq. The
+// request should be signed by a user with read permission on the database.
+func (a *explorerAPI) Query(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dbID, err := a.getDBID(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxQueryRequestSize))
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+	var req types.ObserverQueryReq
+	if err = utils.DecodeMsgPack(body, &req); err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	resp, err := a.service.queryReplica(r.Context(), dbID, &req)
+	if err != nil {
+		sendResponse(replicaErrorStatus(err), false, err, nil, rw)
+		return
+	}
+
+	buf, err := utils.EncodeMsgPack(resp)
+	if err != nil {
+		sendResponse(500, false, err, nil, rw)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/x-msgpack")
+	_, _ = rw.Write(buf.Bytes())
+}
+
 func (a *explorerAPI) formatBlock(height int32, b *types.Block) (res map[string]interface{}) {
 	queries := make([]string, 0, len(b.Acks))
 
@@ -684,6 +742,7 @@ func startAPI(service *Service, listenAddr string, version string) (server *http
 			"version": version,
 		}, rw)
 	}).Methods("GET")
+	router.Handle("/ready", route.ReadinessHandler()).Methods("GET")
 
 	api := &explorerAPI{
 		service: service,
@@ -710,6 +769,9 @@ func startAPI(service *Service, listenAddr string, version string) (server *http
 	v3Router.HandleFunc("/height/{db}/{height:[0-9]+}", api.GetBlockByHeightV3).Methods("GET")
 	v3Router.HandleFunc("/head/{db}", api.GetHighestBlockV3).Methods("GET")
 	v3Router.HandleFunc("/subscriptions", api.GetAllSubscriptions).Methods("GET")
+	v3Router.HandleFunc("/search", api.Search).Methods("GET")
+	v3Router.HandleFunc("/query/{db}", api.Query).Methods("POST")
+	v3Router.HandleFunc("/dataset/{db}/{version:[0-9]+}", api.GetDataset).Methods("GET")
 
 	server = &http.Server{
 		Addr:         listenAddr,
@@ -18,6 +18,7 @@ package observer
 
 import (
 	"io/ioutil"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 
@@ -28,18 +29,30 @@ import (
 type Database struct {
 	ID       string `yaml:"ID"`
 	Position string `yaml:"Position"`
+	// Retention defines how long the block history of the database is kept, 0 to keep forever.
+	Retention time.Duration `yaml:"Retention"`
+	// DiskBudget defines the max bytes of block history kept for the database, 0 for unlimited.
+	DiskBudget uint64 `yaml:"DiskBudget"`
+	// Materialize replays the writes of the database to a local replica to serve the analytical
+	// reads, the replica is materialized from the genesis block.
+	Materialize bool `yaml:"Materialize"`
 }
 
 // Config defines subscription settings for observer.
 type Config struct {
 	Databases []Database `yaml:"Databases"`
+	// DiskBudget defines the max bytes of block history kept for all databases, 0 for unlimited.
+	DiskBudget uint64 `yaml:"DiskBudget"`
+	// PruneInterval defines the interval of pruning history exceeding retention or disk budgets.
+	PruneInterval time.Duration `yaml:"PruneInterval"`
 }
 
 type configWrapper struct {
 	Observer *Config `yaml:"Observer"`
 }
 
-func loadConfig(path string) (config *Config, err error) {
+// LoadConfig loads the observer section of the config file.
+func LoadConfig(path string) (config *Config, err error) {
 	var (
 		content []byte
 		wrapper = &configWrapper{}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -41,14 +42,14 @@ func TestLoadConfig(t *testing.T) {
 		})
 		fl = path.Join(tmp, t.Name())
 		Convey("The LoadConfig func should report error at a nonexist file", func() {
-			cfg, err = loadConfig(fl)
+			cfg, err = LoadConfig(fl)
 			So(err, ShouldNotBeNil)
 		})
 		Convey("Given a empty config file", func() {
 			err = ioutil.WriteFile(fl, nil, 0644)
 			So(err, ShouldBeNil)
 			Convey("The LoadConfig func should return a nil config", func() {
-				cfg, err = loadConfig(fl)
+				cfg, err = LoadConfig(fl)
 				So(err, ShouldBeNil)
 				So(cfg, ShouldBeNil)
 			})
@@ -156,7 +157,7 @@ KnownNodes:
   Role: Miner`), 0644)
 			So(err, ShouldBeNil)
 			Convey("The LoadConfig func should return a nil config", func() {
-				cfg, err = loadConfig(fl)
+				cfg, err = LoadConfig(fl)
 				So(err, ShouldBeNil)
 				So(cfg, ShouldBeNil)
 			})
@@ -173,13 +174,39 @@ KnownNodes:
     Position: ""`), 0644)
 			So(err, ShouldBeNil)
 			Convey("The LoadConfig func should return a pre-defined config", func() {
-				cfg, err = loadConfig(fl)
+				cfg, err = LoadConfig(fl)
 				So(err, ShouldBeNil)
 				So(cfg, ShouldNotBeNil)
 				So(len(cfg.Databases), ShouldEqual, 3)
 				So(cfg.Databases[2].Position, ShouldEqual, "")
 			})
 		})
+		Convey("Given a config file with retention settings", func() {
+			err = ioutil.WriteFile(fl, []byte(
+				`Observer:
+  DiskBudget: 1073741824
+  PruneInterval: 5m
+  Databases:
+  - ID: xxxxx1
+    Position: oldest
+    Retention: 168h
+    DiskBudget: 104857600
+  - ID: xxxxx2
+    Position: newest`), 0644)
+			So(err, ShouldBeNil)
+			Convey("The LoadConfig func should return the retention settings", func() {
+				cfg, err = LoadConfig(fl)
+				So(err, ShouldBeNil)
+				So(cfg, ShouldNotBeNil)
+				So(cfg.DiskBudget, ShouldEqual, 1<<30)
+				So(cfg.PruneInterval, ShouldEqual, 5*time.Minute)
+				So(len(cfg.Databases), ShouldEqual, 2)
+				So(cfg.Databases[0].Retention, ShouldEqual, 7*24*time.Hour)
+				So(cfg.Databases[0].DiskBudget, ShouldEqual, 100<<20)
+				So(cfg.Databases[1].Retention, ShouldEqual, 0)
+				So(cfg.Databases[1].DiskBudget, ShouldEqual, 0)
+			})
+		})
 		Convey("Given a full config file", func() {
 			err = ioutil.WriteFile(fl, []byte(
 				`UseTestMasterKey: true
@@ -290,7 +317,7 @@ KnownNodes:
   Role: Miner`), 0644)
 			So(err, ShouldBeNil)
 			Convey("The LoadConfig func should return a pre-defined config", func() {
-				cfg, err = loadConfig(fl)
+				cfg, err = LoadConfig(fl)
 				So(err, ShouldBeNil)
 				So(cfg, ShouldNotBeNil)
 				So(len(cfg.Databases), ShouldEqual, 3)
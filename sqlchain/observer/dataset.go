@@ -0,0 +1,212 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package observer
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	rpc "github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	datasetDirName = "datasets"
+)
+
+var (
+	// ErrDatasetNotFound indicates the dataset version is not published or served by any miner.
+	ErrDatasetNotFound = errors.New("dataset not found")
+	// ErrDatasetHashMismatch indicates the downloaded dataset does not match the published hash.
+	ErrDatasetHashMismatch = errors.New("dataset hash mismatch")
+)
+
+// queryDataset queries the dataset versions published for the database from block producer.
+func (s *Service) queryDataset(dbID proto.DatabaseID) (profile *types.DatasetProfile, err error) {
+	curBP, err := rpc.GetCurrentBP()
+	if err != nil {
+		return
+	}
+	var (
+		req  = &types.QueryDatasetReq{DatabaseID: dbID}
+		resp = &types.QueryDatasetResp{}
+	)
+	if err = s.caller.CallNode(curBP, route.MCCQueryDataset.String(), req, resp); err != nil {
+		return
+	}
+	profile = &resp.Profile
+	return
+}
+
+// openDataset returns the cached file of the published dataset version, the latest version is
+// used if version is 0. The dataset is downloaded from the miners of the database on the first
+// request and verified against the content hash recorded on chain, the cached files are
+// immutable as they are named by the content hashes.
+func (s *Service) openDataset(
+	ctx context.Context, dbID proto.DatabaseID, version uint32,
+) (dv *types.DatasetVersion, f *os.File, err error) {
+	var profile *types.DatasetProfile
+	if profile, err = s.queryDataset(dbID); err != nil {
+		return
+	}
+	if dv = profile.Get(version); dv == nil {
+		err = errors.Wrapf(ErrDatasetNotFound, "version %d of database %s", version, dbID)
+		return
+	}
+	var (
+		dir      = filepath.Join(conf.GConf.WorkingRoot, datasetDirName)
+		filename = filepath.Join(dir, dv.ContentHash.String()+".db3")
+	)
+	if f, err = os.Open(filename); err == nil || !os.IsNotExist(err) {
+		return
+	}
+
+	// download the dataset once for the concurrent requests
+	l, _ := s.datasetLocks.LoadOrStore(dv.ContentHash, &sync.Mutex{})
+	l.(*sync.Mutex).Lock()
+	defer l.(*sync.Mutex).Unlock()
+	if f, err = os.Open(filename); err == nil || !os.IsNotExist(err) {
+		return
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	var sp *types.SQLChainProfile
+	if sp, err = s.querySQLProfile(dbID); err != nil {
+		return
+	}
+	err = errors.Wrapf(ErrDatasetNotFound, "no miner serves dataset %s", dv.ContentHash.String())
+	for _, m := range sp.Miners {
+		if ferr := s.downloadDataset(ctx, m.NodeID, dbID, dv, filename); ferr != nil {
+			log.WithFields(log.Fields{
+				"db":   dbID,
+				"node": m.NodeID,
+				"hash": dv.ContentHash.String(),
+			}).WithError(ferr).Debug("download dataset from miner failed")
+			continue
+		}
+		f, err = os.Open(filename)
+		return
+	}
+	return
+}
+
+func (s *Service) downloadDataset(
+	ctx context.Context, node proto.NodeID, dbID proto.DatabaseID, dv *types.DatasetVersion, filename string,
+) (err error) {
+	var (
+		req = &types.FetchDatasetChunkReq{
+			DatabaseID:  dbID,
+			ContentHash: dv.ContentHash,
+		}
+		tmpFile = filename + ".part"
+		f       *os.File
+		actual  hash.Hash
+	)
+	if f, err = os.OpenFile(tmpFile, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+		if err != nil {
+			_ = os.Remove(tmpFile)
+		}
+	}()
+	for req.Offset < dv.Size {
+		resp := &types.FetchDatasetChunkResp{}
+		if err = s.caller.CallNodeWithContext(
+			ctx, node, route.DBSFetchDatasetChunk.String(), req, resp,
+		); err != nil {
+			return
+		}
+		if len(resp.Data) == 0 {
+			err = errors.Errorf("unexpected end of dataset at offset %d", req.Offset)
+			return
+		}
+		if _, err = f.WriteAt(resp.Data, int64(req.Offset)); err != nil {
+			return
+		}
+		req.Offset += uint64(len(resp.Data))
+	}
+	if _, err = f.Seek(0, 0); err != nil {
+		return
+	}
+	if actual, _, err = hash.THashReader(f); err != nil {
+		return
+	}
+	if !actual.IsEqual(&dv.ContentHash) {
+		err = errors.Wrapf(ErrDatasetHashMismatch, "expected %s, actual %s",
+			dv.ContentHash.String(), actual.String())
+		return
+	}
+	if err = f.Sync(); err != nil {
+		return
+	}
+	return os.Rename(tmpFile, filename)
+}
+
+// GetDataset serves the published dataset of the database as a plain SQLite database file to
+// anyone over http, the latest version is served if version is 0.
+func (a *explorerAPI) GetDataset(rw http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	dbID, err := a.getDBID(vars)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+	version, err := strconv.ParseUint(vars["version"], 10, 32)
+	if err != nil {
+		sendResponse(400, false, err, nil, rw)
+		return
+	}
+
+	dv, f, err := a.service.openDataset(r.Context(), dbID, uint32(version))
+	if err != nil {
+		if errors.Cause(err) == ErrDatasetNotFound {
+			sendResponse(404, false, err, nil, rw)
+		} else {
+			sendResponse(502, false, err, nil, rw)
+		}
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		sendResponse(500, false, err, nil, rw)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/vnd.sqlite3")
+	rw.Header().Set("X-Dataset-Version", strconv.FormatUint(uint64(dv.Version), 10))
+	rw.Header().Set("X-Dataset-Hash", dv.ContentHash.String())
+	rw.Header().Set("X-Dataset-Height", strconv.FormatInt(int64(dv.Height), 10))
+	rw.Header().Set("ETag", strconv.Quote(dv.ContentHash.String()))
+	http.ServeContent(rw, r, string(dbID)+".db3", fi.ModTime(), f)
+}
@@ -43,9 +43,9 @@ func registerNode() (err error) {
 	return
 }
 
-func startService() (service *Service, err error) {
+func startService(cfg *Config) (service *Service, err error) {
 	// register observer service to rpc server
-	service, err = NewService()
+	service, err = NewService(cfg)
 	if err != nil {
 		return
 	}
@@ -61,10 +61,13 @@ func stopService(service *Service) (err error) {
 	return service.stop()
 }
 
-// StartObserver starts the observer service and http API server.
-func StartObserver(listenAddr string, version string) (service *Service, httpServer *http.Server, err error) {
+// StartObserver starts the observer service and http API server, cfg defines the subscribed
+// databases and their retention settings, which could be nil.
+func StartObserver(
+	listenAddr string, version string, cfg *Config,
+) (service *Service, httpServer *http.Server, err error) {
 	// start service
-	if service, err = startService(); err != nil {
+	if service, err = startService(cfg); err != nil {
 		log.WithError(err).Fatal("start observation failed")
 	}
 
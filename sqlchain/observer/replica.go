@@ -0,0 +1,315 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package observer
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+	x "github.com/SQLess/SQLess/xenomint"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+const (
+	replicaDirName = "replicas"
+
+	// replicaQueryTimeout defines the max duration of a read served by the replica.
+	replicaQueryTimeout = 30 * time.Second
+	// replicaProfileTTL defines how long the sqlchain profile is cached to authorize the reads,
+	// a revoked permission takes effect on the replica after it at most.
+	replicaProfileTTL = 10 * time.Second
+	// maxReplicaQueryTimeGap defines the max clock gap between the read request and observer.
+	maxReplicaQueryTimeGap = 5 * time.Minute
+)
+
+var (
+	// ErrReplicaNotFound indicates the database is not materialized by the observer.
+	ErrReplicaNotFound = errors.New("database not materialized")
+	// ErrReplicaBroken indicates the replica failed to replay the blocks and stops serving reads.
+	ErrReplicaBroken = errors.New("replica broken")
+	// ErrReplicaStale indicates the replica lags behind the sqlchain more than the reads accept.
+	ErrReplicaStale = errors.New("replica stale")
+	// ErrReplicaPermissionDenied indicates the signee of the read has no read permission.
+	ErrReplicaPermissionDenied = errors.New("replica read permission denied")
+
+	getReplicaSQL  = `SELECT "count", "seq", "height", "time", "clean" FROM "replica" WHERE "db" = ? LIMIT 1`
+	saveReplicaSQL = `INSERT OR REPLACE INTO "replica" ("db", "count", "seq", "height", "time", "clean")
+VALUES(?, ?, ?, ?, ?, ?)`
+)
+
+// replica materializes the database by replaying the write queries of the observed blocks, and
+// serves the analytical reads away from the miners.
+type replica struct {
+	sync.RWMutex
+	dbID      proto.DatabaseID
+	st        *x.State
+	count     int32 // count of the last applied block, -1 if none
+	seq       uint64
+	height    int32
+	timestamp time.Time
+	broken    error
+
+	profileLock sync.Mutex
+	profile     *types.SQLChainProfile // cached to authorize the reads
+	profileTime time.Time
+}
+
+// resumeReplica opens the replica of the database and returns the subscription position to
+// materialize it without missing blocks.
+func (s *Service) resumeReplica(dbID proto.DatabaseID, position string) (string, error) {
+	r, err := s.openReplica(dbID)
+	if err != nil {
+		return position, err
+	}
+	s.replicas.Store(dbID, r)
+	if r.count < 0 {
+		// materialize from the genesis block
+		return "oldest", nil
+	}
+	// continue from the next block of the replica
+	var next = r.count + 1
+	if w, ok := s.subscription.Load(dbID); !ok {
+		s.subscription.Store(dbID, newSubscribeWorker(dbID, next, s))
+	} else if head := unpackWorker(w).getHead(); head < 0 || head > next {
+		atomic.StoreInt32(&unpackWorker(w).head, next)
+	}
+	return "", nil
+}
+
+// openReplica opens the replica of the database, the replica interrupted in applying a block is
+// rebuilt from the genesis block.
+func (s *Service) openReplica(dbID proto.DatabaseID) (r *replica, err error) {
+	var (
+		dir      = filepath.Join(conf.GConf.WorkingRoot, replicaDirName)
+		filename = filepath.Join(dir, string(dbID)+".db3")
+		ts       int64
+		clean    = true
+		strg     *xs.SQLite3
+	)
+	r = &replica{dbID: dbID, count: -1}
+	err = s.db.Writer().QueryRow(getReplicaSQL, string(dbID)).Scan(
+		&r.count, &r.seq, &r.height, &ts, &clean)
+	switch err {
+	case nil:
+		r.timestamp = time.Unix(0, ts).UTC()
+	case sql.ErrNoRows:
+		err = nil
+	default:
+		err = errors.Wrap(err, "load replica state failed")
+		return
+	}
+	if !clean {
+		log.WithField("db", dbID).Warning("replica interrupted in applying block, rebuild from genesis")
+		r = &replica{dbID: dbID, count: -1}
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if err = os.Remove(filename + suffix); err != nil && !os.IsNotExist(err) {
+				err = errors.Wrap(err, "remove replica failed")
+				return
+			}
+		}
+		err = nil
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		err = errors.Wrap(err, "create replica dir failed")
+		return
+	}
+	if strg, err = xs.NewSqlite(filename); err != nil {
+		err = errors.Wrap(err, "open replica failed")
+		return
+	}
+	r.st = x.NewState(sql.LevelReadUncommitted, proto.NodeID(""), strg)
+	r.st.SetSeq(r.seq)
+	return
+}
+
+func (s *Service) saveReplicaState(r *replica, clean bool) (err error) {
+	_, err = s.db.Writer().Exec(saveReplicaSQL,
+		string(r.dbID), r.count, r.seq, r.height, r.timestamp.UnixNano(), clean)
+	return
+}
+
+// applyReplica replays the block of count to the replica, the blocks must be applied in count
+// order. The replay failures break the replica instead of failing the observation.
+func (s *Service) applyReplica(r *replica, count, height int32, b *types.Block) (err error) {
+	r.Lock()
+	defer r.Unlock()
+	if r.broken != nil || count <= r.count {
+		return
+	}
+	if count != r.count+1 {
+		r.broken = errors.Wrapf(ErrReplicaBroken, "missing blocks in (%d, %d)", r.count, count)
+		log.WithField("db", r.dbID).WithError(r.broken).Error("replica stops materializing")
+		return
+	}
+	// mark dirty, the replica is rebuilt if interrupted before the state is saved
+	if err = s.saveReplicaState(r, false); err != nil {
+		return
+	}
+	if err = r.st.ReplayBlock(b); err != nil {
+		r.broken = errors.Wrapf(ErrReplicaBroken, "replay block %d failed: %v", count, err)
+		log.WithField("db", r.dbID).WithError(r.broken).Error("replica stops materializing")
+		err = nil
+		return
+	}
+	for _, q := range b.QueryTxs {
+		if q.Request.Header.QueryType != types.WriteQuery {
+			continue
+		}
+		if next := q.Response.LogOffset + uint64(len(q.Request.Payload.Queries)); next > r.seq {
+			r.seq = next
+		}
+	}
+	r.count, r.height, r.timestamp = count, height, b.Timestamp()
+	return s.saveReplicaState(r, true)
+}
+
+// queryReplica runs the read queries on the replica of the database.
+func (s *Service) queryReplica(
+	ctx context.Context, dbID proto.DatabaseID, req *types.ObserverQueryReq) (
+	resp *types.ObserverQueryResp, err error,
+) {
+	v, ok := s.replicas.Load(dbID)
+	if !ok {
+		err = ErrReplicaNotFound
+		return
+	}
+	var r = v.(*replica)
+	if err = s.authorizeReplicaQuery(r, req); err != nil {
+		return
+	}
+	resp = &types.ObserverQueryResp{}
+	r.RLock()
+	err = r.broken
+	resp.Count, resp.Height, resp.Timestamp = r.count, r.height, r.timestamp
+	r.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if resp.Count < 0 {
+		return nil, errors.Wrap(ErrReplicaStale, "no block materialized yet")
+	}
+	if lag := time.Since(resp.Timestamp); req.Header.MaxStaleness > 0 && lag > req.Header.MaxStaleness {
+		return nil, errors.Wrapf(ErrReplicaStale, "last block materialized %s ago", lag)
+	}
+	var payload *types.ResponsePayload
+	ctx, cancel := context.WithTimeout(ctx, replicaQueryTimeout)
+	defer cancel()
+	if payload, err = r.st.QueryReadOnly(ctx, req.Header.Queries); err != nil {
+		return nil, err
+	}
+	resp.Payload = *payload
+	return
+}
+
+// authorizeReplicaQuery checks that the read request is signed by a user with read permission
+// on the database, as the miners do.
+func (s *Service) authorizeReplicaQuery(r *replica, req *types.ObserverQueryReq) (err error) {
+	var (
+		addr    proto.AccountAddress
+		profile *types.SQLChainProfile
+	)
+	if err = req.Header.Verify(); err != nil {
+		return errors.Wrap(ErrReplicaPermissionDenied, err.Error())
+	}
+	if req.Header.DatabaseID != r.dbID {
+		return errors.Wrapf(ErrReplicaPermissionDenied, "request signed for %s", req.Header.DatabaseID)
+	}
+	if gap := time.Since(req.Header.Timestamp); gap > maxReplicaQueryTimeGap ||
+		gap < -maxReplicaQueryTimeGap {
+		return errors.Wrap(ErrReplicaPermissionDenied, "invalid request time")
+	}
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		return
+	}
+	if profile, err = s.replicaProfile(r); err != nil {
+		return
+	}
+	for _, user := range profile.Users {
+		if user.Address != addr {
+			continue
+		}
+		if !user.Status.EnableQuery() {
+			return errors.Wrapf(ErrReplicaPermissionDenied, "cannot query, status: %d", user.Status)
+		}
+		if !user.Permission.HasReadPermission() {
+			return errors.Wrapf(ErrReplicaPermissionDenied, "cannot read, permission: %v", user.Permission)
+		}
+		if q, ok := user.Permission.HasDisallowedQueryPatterns(req.Header.Queries); ok {
+			return errors.Wrapf(ErrReplicaPermissionDenied, "disallowed query %s", q)
+		}
+		return
+	}
+	return errors.Wrapf(ErrReplicaPermissionDenied, "%s is not a user of database", addr.String())
+}
+
+// replicaProfile returns the cached sqlchain profile of the replica, the profile is refreshed
+// from block producer once it expires.
+func (s *Service) replicaProfile(r *replica) (profile *types.SQLChainProfile, err error) {
+	r.profileLock.Lock()
+	defer r.profileLock.Unlock()
+	if r.profile != nil && time.Since(r.profileTime) < replicaProfileTTL {
+		return r.profile, nil
+	}
+	if profile, err = s.querySQLProfile(r.dbID); err != nil {
+		err = errors.Wrap(err, "query sqlchain profile failed")
+		return
+	}
+	r.profile, r.profileTime = profile, time.Now()
+	return
+}
+
+// replicaErrorStatus returns the http status code of the replica query error.
+func replicaErrorStatus(err error) int {
+	switch errors.Cause(err) {
+	case ErrReplicaNotFound:
+		return http.StatusNotFound
+	case ErrReplicaStale:
+		return http.StatusPreconditionFailed
+	case ErrReplicaBroken:
+		return http.StatusServiceUnavailable
+	case ErrReplicaPermissionDenied:
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// closeReplicas commits and closes the replicas.
+func (s *Service) closeReplicas() {
+	s.replicas.Range(func(k, v interface{}) bool {
+		var r = v.(*replica)
+		r.Lock()
+		defer r.Unlock()
+		if err := r.st.Close(true); err != nil {
+			log.WithField("db", r.dbID).WithError(err).Warning("close replica failed")
+		}
+		return true
+	})
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package observer
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultPruneInterval defines the default interval of pruning history.
+	DefaultPruneInterval = 10 * time.Minute
+)
+
+var (
+	// historyRowsSQL lists the approximate size of each row of the block history, including the
+	// hash indexes of acks, requests and responses, the integer columns take 8 bytes each.
+	historyRowsSQL = `
+SELECT "db", "height", LENGTH("db") + LENGTH("hash") + LENGTH("block") + 16 AS "size" FROM "block"
+UNION ALL SELECT "db", "height", LENGTH("db") + LENGTH("hash") + 16 FROM "ack"
+UNION ALL SELECT "db", "height", LENGTH("db") + LENGTH("hash") + 16 FROM "request"
+UNION ALL SELECT "db", "height", LENGTH("db") + LENGTH("hash") + 16 FROM "response"`
+	getDatabaseSizeSQL = `SELECT "db", SUM("size") FROM (` + historyRowsSQL + `) GROUP BY "db"`
+	getHistorySizesSQL = `SELECT "height", SUM("size") FROM (` + historyRowsSQL + `)
+WHERE "db" = ? GROUP BY "height" ORDER BY "height" DESC`
+	// vacuumSQL rebuilds the observer database to return the pages freed by pruning to the file
+	// system, otherwise the file never shrinks.
+	vacuumSQL       = `VACUUM`
+	pruneHistorySQL = []string{
+		`DELETE FROM "block" WHERE "db" = ? AND "height" < ?`,
+		`DELETE FROM "ack" WHERE "db" = ? AND "height" < ?`,
+		`DELETE FROM "request" WHERE "db" = ? AND "height" < ?`,
+		`DELETE FROM "response" WHERE "db" = ? AND "height" < ?`,
+		`DELETE FROM "account" WHERE "db" = ? AND "height" < ?`,
+	}
+)
+
+// retentionPolicy defines the retention settings of a subscribed database.
+type retentionPolicy struct {
+	retention  time.Duration
+	diskBudget uint64
+}
+
+func (s *Service) retentionPolicy(dbID proto.DatabaseID) (p retentionPolicy) {
+	if s.cfg == nil {
+		return
+	}
+	for _, d := range s.cfg.Databases {
+		if proto.DatabaseID(d.ID) == dbID {
+			p.retention, p.diskBudget = d.Retention, d.DiskBudget
+			return
+		}
+	}
+	return
+}
+
+func (s *Service) runPruner() {
+	defer s.wg.Done()
+	var interval = DefaultPruneInterval
+	if s.cfg != nil && s.cfg.PruneInterval > 0 {
+		interval = s.cfg.PruneInterval
+	}
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-time.After(interval):
+			if err := s.prune(); err != nil {
+				log.WithError(err).Warning("prune observer history failed")
+			}
+		}
+	}
+}
+
+// prune removes the block history exceeding the retention period or the disk budgets. The
+// global disk budget is shared by the databases in proportion to their current sizes.
+func (s *Service) prune() (err error) {
+	var sizes map[proto.DatabaseID]uint64
+	if sizes, err = s.getDatabaseSizes(); err != nil {
+		return
+	}
+	var (
+		total uint64
+		dbs   []proto.DatabaseID
+	)
+	for dbID, size := range sizes {
+		total += size
+		dbs = append(dbs, dbID)
+	}
+	sort.Slice(dbs, func(i, j int) bool { return dbs[i] < dbs[j] })
+	var pruned bool
+	for _, dbID := range dbs {
+		var (
+			policy = s.retentionPolicy(dbID)
+			budget = policy.diskBudget
+		)
+		if s.cfg != nil && s.cfg.DiskBudget > 0 && total > s.cfg.DiskBudget {
+			share := uint64(float64(sizes[dbID]) * float64(s.cfg.DiskBudget) / float64(total))
+			if budget == 0 || share < budget {
+				budget = share
+			}
+		}
+		var ok bool
+		if ok, err = s.pruneDatabase(dbID, policy.retention, budget); err != nil {
+			err = errors.Wrapf(err, "prune database %s failed", dbID)
+			return
+		}
+		pruned = pruned || ok
+	}
+	if pruned {
+		if _, err = s.db.Writer().Exec(vacuumSQL); err != nil {
+			err = errors.Wrap(err, "vacuum observer database failed")
+		}
+	}
+	return
+}
+
+// pruneDatabase removes the blocks older than retention and the oldest blocks exceeding budget,
+// the highest block is always kept.
+func (s *Service) pruneDatabase(
+	dbID proto.DatabaseID, retention time.Duration, budget uint64,
+) (pruned bool, err error) {
+	var (
+		highest int32
+		cutoff  int32
+	)
+	if highest, _, err = s.getHighestBlock(dbID); err != nil {
+		if err == ErrNotFound {
+			err = nil
+		}
+		return
+	}
+	if retention > 0 && conf.GConf != nil && conf.GConf.SQLChainPeriod > 0 {
+		cutoff = highest - int32(retention/conf.GConf.SQLChainPeriod)
+	}
+	if budget > 0 {
+		var h int32
+		if h, err = s.getBudgetCutoff(dbID, budget); err != nil {
+			return
+		}
+		if h > cutoff {
+			cutoff = h
+		}
+	}
+	if cutoff > highest {
+		cutoff = highest
+	}
+	if cutoff <= 0 {
+		return
+	}
+	for _, q := range pruneHistorySQL {
+		var (
+			result   sql.Result
+			affected int64
+		)
+		if result, err = s.db.Writer().Exec(q, string(dbID), cutoff); err != nil {
+			return
+		}
+		if affected, err = result.RowsAffected(); err != nil {
+			return
+		}
+		pruned = pruned || affected > 0
+	}
+	log.WithFields(log.Fields{
+		"db":     dbID,
+		"cutoff": cutoff,
+	}).Debug("pruned observer history")
+	return
+}
+
+// getBudgetCutoff returns the lowest height of the newest history fitting in the budget.
+func (s *Service) getBudgetCutoff(dbID proto.DatabaseID, budget uint64) (cutoff int32, err error) {
+	rows, err := s.db.Writer().Query(getHistorySizesSQL, string(dbID))
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	var used uint64
+	for rows.Next() {
+		var (
+			height int32
+			size   uint64
+		)
+		if err = rows.Scan(&height, &size); err != nil {
+			return
+		}
+		if used += size; used > budget {
+			cutoff = height + 1
+			return
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+func (s *Service) getDatabaseSizes() (sizes map[proto.DatabaseID]uint64, err error) {
+	rows, err := s.db.Writer().Query(getDatabaseSizeSQL)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	sizes = make(map[proto.DatabaseID]uint64)
+	for rows.Next() {
+		var (
+			dbID string
+			size uint64
+		)
+		if err = rows.Scan(&dbID, &size); err != nil {
+			return
+		}
+		sizes[proto.DatabaseID(dbID)] = size
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package observer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+func TestPrune(t *testing.T) {
+	Convey("Given an observer with the history of two databases", t, func() {
+		dir, err := ioutil.TempDir("", "observer_prune_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		db, err := xs.NewSqlite(filepath.Join(dir, dbFileName))
+		So(err, ShouldBeNil)
+		defer db.Close()
+		for _, q := range initTableSQL {
+			_, err = db.Writer().Exec(q)
+			So(err, ShouldBeNil)
+		}
+
+		var origConf = conf.GConf
+		defer func() { conf.GConf = origConf }()
+		conf.GConf = &conf.Config{SQLChainPeriod: time.Second}
+
+		var (
+			s     = &Service{db: db, stopCh: make(chan struct{})}
+			dbIDs = []proto.DatabaseID{"db1", "db2"}
+		)
+		b, err := types.CreateRandomBlock(hash.Hash{}, true)
+		So(err, ShouldBeNil)
+		enc, err := utils.EncodeMsgPack(b)
+		So(err, ShouldBeNil)
+		for _, dbID := range dbIDs {
+			for h := int32(1); h <= 10; h++ {
+				_, err = db.Writer().Exec(saveBlockSQL,
+					string(dbID), h, h, fmt.Sprintf("block%02d", h), enc.Bytes())
+				So(err, ShouldBeNil)
+				for i := int32(0); i < 4; i++ {
+					_, err = db.Writer().Exec(saveAckSQL, string(dbID), fmt.Sprintf("ack%02d-%d", h, i), h, i)
+					So(err, ShouldBeNil)
+					_, err = db.Writer().Exec(saveRequestSQL, string(dbID), fmt.Sprintf("req%02d-%d", h, i), h, i)
+					So(err, ShouldBeNil)
+					_, err = db.Writer().Exec(saveResponseSQL, string(dbID), fmt.Sprintf("resp%02d-%d", h, i), h, i)
+					So(err, ShouldBeNil)
+				}
+			}
+		}
+
+		var (
+			heights = func(table string, dbID proto.DatabaseID) (min, max int32) {
+				err := db.Writer().QueryRow(fmt.Sprintf(
+					`SELECT MIN("height"), MAX("height") FROM "%s" WHERE "db" = ?`, table),
+					string(dbID)).Scan(&min, &max)
+				So(err, ShouldBeNil)
+				return
+			}
+			historySize = func(dbID proto.DatabaseID, newest int) (size uint64) {
+				rows, err := db.Writer().Query(getHistorySizesSQL, string(dbID))
+				So(err, ShouldBeNil)
+				defer rows.Close()
+				for i := 0; i < newest && rows.Next(); i++ {
+					var (
+						h int32
+						n uint64
+					)
+					So(rows.Scan(&h, &n), ShouldBeNil)
+					size += n
+				}
+				return
+			}
+			historyHeights = func(dbID proto.DatabaseID) (min, max int32) {
+				for _, table := range []string{"block", "ack", "request", "response"} {
+					tmin, tmax := heights(table, dbID)
+					if table != "block" {
+						So(tmin, ShouldEqual, min)
+						So(tmax, ShouldEqual, max)
+					}
+					min, max = tmin, tmax
+				}
+				return
+			}
+		)
+
+		Convey("The database sizes should count the blocks and the indexes", func() {
+			sizes, err := s.getDatabaseSizes()
+			So(err, ShouldBeNil)
+			So(sizes, ShouldHaveLength, 2)
+			So(sizes["db1"], ShouldEqual, historySize("db1", 10))
+			So(sizes["db1"], ShouldBeGreaterThan, 10*uint64(len(enc.Bytes())))
+		})
+		Convey("The history older than the retention should be pruned", func() {
+			pruned, err := s.pruneDatabase("db1", 3*time.Second, 0)
+			So(err, ShouldBeNil)
+			So(pruned, ShouldBeTrue)
+			min, max := historyHeights("db1")
+			So(min, ShouldEqual, 7)
+			So(max, ShouldEqual, 10)
+			min, _ = historyHeights("db2")
+			So(min, ShouldEqual, 1)
+
+			pruned, err = s.pruneDatabase("db1", 3*time.Second, 0)
+			So(err, ShouldBeNil)
+			So(pruned, ShouldBeFalse)
+		})
+		Convey("The oldest history exceeding the disk budget should be pruned", func() {
+			pruned, err := s.pruneDatabase("db1", 0, historySize("db1", 3))
+			So(err, ShouldBeNil)
+			So(pruned, ShouldBeTrue)
+			min, max := historyHeights("db1")
+			So(min, ShouldEqual, 8)
+			So(max, ShouldEqual, 10)
+		})
+		Convey("The highest block should always be kept", func() {
+			pruned, err := s.pruneDatabase("db1", 0, 1)
+			So(err, ShouldBeNil)
+			So(pruned, ShouldBeTrue)
+			min, max := historyHeights("db1")
+			So(min, ShouldEqual, 10)
+			So(max, ShouldEqual, 10)
+		})
+		Convey("The global disk budget should be shared and the file vacuumed", func() {
+			sizes, err := s.getDatabaseSizes()
+			So(err, ShouldBeNil)
+			s.cfg = &Config{
+				DiskBudget: (sizes["db1"] + sizes["db2"]) / 2,
+				Databases:  []Database{{ID: "db2", Retention: 2 * time.Second}},
+			}
+			So(s.prune(), ShouldBeNil)
+			min, _ := historyHeights("db1")
+			So(min, ShouldEqual, 6)
+			min, _ = historyHeights("db2")
+			So(min, ShouldEqual, 8)
+
+			var free int64
+			So(db.Writer().QueryRow(`PRAGMA freelist_count`).Scan(&free), ShouldBeNil)
+			So(free, ShouldEqual, 0)
+		})
+	})
+}
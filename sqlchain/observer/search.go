@@ -0,0 +1,204 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package observer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+const (
+	// MinSearchPrefixLength defines the min query length of hash prefix search.
+	MinSearchPrefixLength = 4
+	// MaxSearchResults defines the max count of search results.
+	MaxSearchResults = 50
+	// MaxFuzzyDistance defines the max edit distance of fuzzy matching.
+	MaxFuzzyDistance = 2
+)
+
+var (
+	// ErrInvalidSearchQuery defines error on search query too short.
+	ErrInvalidSearchQuery = errors.New("search query too short")
+
+	searchHashSQL = map[string]string{
+		"block":    `SELECT "db", "hash", "height" FROM "block" WHERE "hash" LIKE ? ESCAPE '\' LIMIT ?`,
+		"request":  `SELECT "db", "hash", "height" FROM "request" WHERE "hash" LIKE ? ESCAPE '\' LIMIT ?`,
+		"response": `SELECT "db", "hash", "height" FROM "response" WHERE "hash" LIKE ? ESCAPE '\' LIMIT ?`,
+		"ack":      `SELECT "db", "hash", "height" FROM "ack" WHERE "hash" LIKE ? ESCAPE '\' LIMIT ?`,
+	}
+	getAllAccountsSQL = `SELECT "db", "address", "height" FROM "account"`
+	saveAccountSQL    = `INSERT OR REPLACE INTO "account" ("db", "address", "height") VALUES(?, ?, ?)`
+)
+
+// SearchResult defines a single match of explorer search.
+type SearchResult struct {
+	Type     string `json:"type"` // database, account, block, request, response or ack
+	Database string `json:"db"`
+	Key      string `json:"key"`
+	Height   int32  `json:"height"` // block height, or block count of database
+
+	Distance int `json:"distance"` // edit distance of fuzzy match, 0 for prefix match
+}
+
+// search finds database ids and account addresses by prefix or fuzzy matching, and block,
+// request, response and ack hashes by prefix matching.
+func (s *Service) search(q string, limit int) (results []*SearchResult, err error) {
+	if q = strings.TrimSpace(q); len(q) == 0 {
+		err = ErrInvalidSearchQuery
+		return
+	}
+	if limit <= 0 || limit > MaxSearchResults {
+		limit = MaxSearchResults
+	}
+
+	// database ids
+	var dbs map[proto.DatabaseID]int32
+	if dbs, err = s.getAllSubscriptions(); err != nil {
+		return
+	}
+	for dbID, count := range dbs {
+		if d, ok := fuzzyMatch(q, string(dbID)); ok {
+			results = append(results, &SearchResult{
+				Type: "database", Database: string(dbID), Key: string(dbID), Height: count, Distance: d,
+			})
+		}
+	}
+
+	// accounts
+	rows, err := s.db.Writer().Query(getAllAccountsSQL)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var r = &SearchResult{Type: "account"}
+		if err = rows.Scan(&r.Database, &r.Key, &r.Height); err != nil {
+			_ = rows.Close()
+			return
+		}
+		var ok bool
+		if r.Distance, ok = fuzzyMatch(q, r.Key); ok {
+			results = append(results, r)
+		}
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	// hashes
+	if len(q) >= MinSearchPrefixLength {
+		var (
+			pattern = escapeLike(strings.ToLower(q)) + "%"
+			kinds   = []string{"block", "request", "response", "ack"}
+		)
+		for _, kind := range kinds {
+			if rows, err = s.db.Writer().Query(searchHashSQL[kind], pattern, limit); err != nil {
+				return
+			}
+			for rows.Next() {
+				var r = &SearchResult{Type: kind}
+				if err = rows.Scan(&r.Database, &r.Key, &r.Height); err != nil {
+					_ = rows.Close()
+					return
+				}
+				results = append(results, r)
+			}
+			_ = rows.Close()
+			if err = rows.Err(); err != nil {
+				return
+			}
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Distance != results[j].Distance {
+			return results[i].Distance < results[j].Distance
+		}
+		return results[i].Height > results[j].Height
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return
+}
+
+func (s *Service) saveAccount(dbID string, address string, height int32) (err error) {
+	if _, err = s.db.Writer().Exec(saveAccountSQL, dbID, address, height); err != nil {
+		err = errors.Wrapf(err, "save account failed: %s, %s, %d", dbID, address, height)
+	}
+	return
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// fuzzyMatch reports whether q matches key by case-insensitive prefix, or is within the max
+// edit distance of the key prefix of the same length, which tolerates typos in the query.
+func fuzzyMatch(q, key string) (distance int, ok bool) {
+	q, key = strings.ToLower(q), strings.ToLower(key)
+	if strings.HasPrefix(key, q) {
+		return 0, true
+	}
+	if len(q) < MinSearchPrefixLength {
+		return
+	}
+	var prefix = key
+	if len(prefix) > len(q) {
+		prefix = prefix[:len(q)]
+	}
+	distance = editDistance(q, prefix)
+	ok = distance <= MaxFuzzyDistance
+	return
+}
+
+// editDistance returns the levenshtein distance of the strings.
+func editDistance(a, b string) int {
+	var (
+		prev = make([]int, len(b)+1)
+		cur  = make([]int, len(b)+1)
+	)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package observer
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	Convey("Given a database id", t, func() {
+		var key = "4b2d6a5e9f0c1d2e3f405162738495a6b7c8d9e0f1a2b3c4d5e6f708192a3b4c"
+		Convey("A prefix should match with zero distance", func() {
+			d, ok := fuzzyMatch("4B2D6a", key)
+			So(ok, ShouldBeTrue)
+			So(d, ShouldEqual, 0)
+		})
+		Convey("A prefix with typos should match within max distance", func() {
+			d, ok := fuzzyMatch("4b2e6a5e", key)
+			So(ok, ShouldBeTrue)
+			So(d, ShouldEqual, 1)
+			d, ok = fuzzyMatch("4b2d65e9", key)
+			So(ok, ShouldBeTrue)
+			So(d, ShouldEqual, 2)
+		})
+		Convey("Short or unrelated queries should not match fuzzily", func() {
+			_, ok := fuzzyMatch("4c", key)
+			So(ok, ShouldBeFalse)
+			_, ok = fuzzyMatch("ffffffff", key)
+			So(ok, ShouldBeFalse)
+		})
+	})
+	Convey("The edit distance should be computed", t, func() {
+		So(editDistance("", "abc"), ShouldEqual, 3)
+		So(editDistance("kitten", "sitting"), ShouldEqual, 3)
+		So(editDistance("same", "same"), ShouldEqual, 0)
+	})
+}
@@ -25,6 +25,8 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
 	"github.com/SQLess/SQLess/crypto/hash"
 	"github.com/SQLess/SQLess/crypto/kms"
 	"github.com/SQLess/SQLess/proto"
@@ -82,10 +84,25 @@ var (
 			"offset"	INTEGER,
 			UNIQUE("db", "hash")
 		)`,
+		`CREATE TABLE IF NOT EXISTS "account" (
+			"db"		TEXT,
+			"address"	TEXT,
+			"height"	INTEGER,
+			UNIQUE("db", "address")
+		)`,
 		`CREATE TABLE IF NOT EXISTS "subscription" (
 			"db"		TEXT,
 			"count"	INTEGER
 		)`,
+		`CREATE TABLE IF NOT EXISTS "replica" (
+			"db"		TEXT,
+			"count"		INTEGER,
+			"seq"		INTEGER,
+			"height"	INTEGER,
+			"time"		INTEGER,
+			"clean"		INTEGER,
+			UNIQUE("db")
+		)`,
 	}
 	getAllSubscriptionsSQL = `SELECT "db", "count" FROM "subscription"`
 	saveSubscriptionSQL    = `INSERT OR REPLACE INTO "subscription" ("db", "count") VALUES(?, ?)`
@@ -106,14 +123,20 @@ var (
 type Service struct {
 	subscription    sync.Map // map[proto.DatabaseID]*subscribeWorker
 	upstreamServers sync.Map // map[proto.DatabaseID]*types.ServiceInstance
+	replicas        sync.Map // map[proto.DatabaseID]*replica
+	datasetLocks    sync.Map // map[hash.Hash]*sync.Mutex
 
 	db      *xs.SQLite3
 	caller  *rpc.Caller
+	cfg     *Config
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
 	stopped int32
 }
 
-// NewService creates new observer service and load previous subscription from the meta database.
-func NewService() (service *Service, err error) {
+// NewService creates new observer service and load previous subscription from the meta database,
+// the databases of cfg are subscribed with their retention settings. cfg could be nil.
+func NewService(cfg *Config) (service *Service, err error) {
 	// open observer database
 	dbFile := filepath.Join(conf.GConf.WorkingRoot, dbFileName)
 
@@ -139,6 +162,8 @@ func NewService() (service *Service, err error) {
 	service = &Service{
 		db:     db,
 		caller: rpc.NewCallerWithPool(mux.GetSessionPoolInstance()),
+		cfg:    cfg,
+		stopCh: make(chan struct{}),
 	}
 
 	// load previous subscriptions
@@ -167,6 +192,28 @@ func NewService() (service *Service, err error) {
 
 		service.subscription.Store(dbID, newSubscribeWorker(dbID, count, service))
 	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	// subscribe configured databases
+	if cfg != nil {
+		for _, d := range cfg.Databases {
+			var position = d.Position
+			if _, ok := service.subscription.Load(proto.DatabaseID(d.ID)); ok {
+				// keep the previous subscription position
+				position = ""
+			}
+			if d.Materialize {
+				if position, err = service.resumeReplica(proto.DatabaseID(d.ID), position); err != nil {
+					return
+				}
+			}
+			if err = service.subscribe(proto.DatabaseID(d.ID), position); err != nil {
+				return
+			}
+		}
+	}
 
 	return
 }
@@ -220,6 +267,9 @@ func (s *Service) start() (err error) {
 		return true
 	})
 
+	s.wg.Add(1)
+	go s.runPruner()
+
 	return nil
 }
 
@@ -258,8 +308,9 @@ func (s *Service) addAck(dbID proto.DatabaseID, height int32, offset int32, ack
 	_, err = s.db.Writer().Exec(saveAckSQL, string(dbID), ack.Hash().String(), height, offset)
 	if err != nil {
 		err = errors.Wrapf(err, "save ack failed: %s, %s, %d", dbID, ack.Hash().String(), height)
+		return
 	}
-	return
+	return s.saveSignee(dbID, height, ack.Signee)
 }
 
 func (s *Service) addQueryTracker(dbID proto.DatabaseID, height int32, offset int32, qt *types.QueryAsTx) (err error) {
@@ -288,8 +339,17 @@ func (s *Service) addQueryTracker(dbID proto.DatabaseID, height int32, offset in
 	_, err = s.db.Writer().Exec(saveResponseSQL, string(dbID), qt.Response.Hash().String(), height, offset)
 	if err != nil {
 		err = errors.Wrapf(err, "save response failed: %s, %s, %d", dbID, qt.Response.Hash().String(), height)
+		return
 	}
-	return
+	return s.saveSignee(dbID, height, qt.Request.Header.Signee)
+}
+
+func (s *Service) saveSignee(dbID proto.DatabaseID, height int32, signee *asymmetric.PublicKey) (err error) {
+	var addr proto.AccountAddress
+	if addr, err = crypto.PubKeyHash(signee); err != nil {
+		return
+	}
+	return s.saveAccount(string(dbID), addr.String(), height)
 }
 
 func (s *Service) addBlock(dbID proto.DatabaseID, count int32, b *types.Block) (err error) {
@@ -337,6 +397,14 @@ func (s *Service) addBlock(dbID proto.DatabaseID, count int32, b *types.Block) (
 		}
 	}
 
+	// materialize
+	if r, ok := s.replicas.Load(dbID); ok {
+		if err = s.applyReplica(r.(*replica), count, h, b); err != nil {
+			err = errors.Wrapf(err, "apply block to replica failed: %s, %d", dbID, count)
+			return
+		}
+	}
+
 	return
 }
 
@@ -354,7 +422,12 @@ func (s *Service) stop() (err error) {
 		return true
 	})
 
-	// close the subscription database
+	// stop history pruning
+	close(s.stopCh)
+	s.wg.Wait()
+
+	// close the materialized replicas and the subscription database
+	s.closeReplicas()
 	_ = s.db.Close()
 
 	return
@@ -377,32 +450,19 @@ func (s *Service) getUpstream(dbID proto.DatabaseID) (instance *types.ServiceIns
 		return
 	}
 
-	curBP, err := mux.GetCurrentBP()
-	if err != nil {
-		return
-	}
-
 	privateKey, err := kms.GetLocalPrivateKey()
 	if err != nil {
 		return
 	}
 
-	var (
-		req = &types.QuerySQLChainProfileReq{
-			DBID: dbID,
-		}
-		resp = &types.QuerySQLChainProfileResp{}
-	)
 	// get peers list from block producer
-	if err = s.caller.CallNode(
-		curBP, route.MCCQuerySQLChainProfile.String(), req, resp,
-	); err != nil {
+	profile, err := s.querySQLProfile(dbID)
+	if err != nil {
 		return
 	}
 
 	// Build server instance from sqlchain profile
 	var (
-		profile = resp.Profile
 		nodeids = make([]proto.NodeID, len(profile.Miners))
 		peers   *proto.Peers
 		genesis = &types.Block{}
@@ -433,6 +493,27 @@ func (s *Service) getUpstream(dbID proto.DatabaseID) (instance *types.ServiceIns
 	return
 }
 
+// querySQLProfile queries the sqlchain profile of the database from block producer.
+func (s *Service) querySQLProfile(dbID proto.DatabaseID) (profile *types.SQLChainProfile, err error) {
+	curBP, err := mux.GetCurrentBP()
+	if err != nil {
+		return
+	}
+	var (
+		req = &types.QuerySQLChainProfileReq{
+			DBID: dbID,
+		}
+		resp = &types.QuerySQLChainProfileResp{}
+	)
+	if err = s.caller.CallNode(
+		curBP, route.MCCQuerySQLChainProfile.String(), req, resp,
+	); err != nil {
+		return
+	}
+	profile = &resp.Profile
+	return
+}
+
 func (s *Service) getAck(dbID proto.DatabaseID, h *hash.Hash) (ack *types.SignedAckHeader, err error) {
 	var (
 		blockHeight int32
@@ -0,0 +1,30 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replay
+
+import "github.com/pkg/errors"
+
+var (
+	// ErrEndOfChain indicates there is no more block in the block source.
+	ErrEndOfChain = errors.New("end of chain")
+	// ErrBrokenChain indicates the parent hash of a block does not match the previous block.
+	ErrBrokenChain = errors.New("block does not extend the previous block")
+	// ErrNoCheckpoint indicates no local state digest is taken at the sequence.
+	ErrNoCheckpoint = errors.New("no checkpoint at sequence")
+	// ErrDigestMismatch indicates the replayed state digest does not match the expected one.
+	ErrDigestMismatch = errors.New("state digest mismatch")
+)
@@ -0,0 +1,250 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package replay replays the signed query stream of a database from its sqlchain blocks against
+// a fresh local SQLite instance, and verifies the replayed state against the state digests taken
+// by miners. It is useful to debug determinism bugs and to validate upgrades.
+package replay
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	x "github.com/SQLess/SQLess/xenomint"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+const (
+	// DefaultCheckpointInterval matches the default state digest interval of miners.
+	DefaultCheckpointInterval uint64 = 1024
+	// DefaultMaxGap is the default max pause between two replayed queries.
+	DefaultMaxGap = 10 * time.Second
+)
+
+// Config defines the replay options.
+type Config struct {
+	// Speed scales the original pace of the queries, e.g. 1 replays in real time and 2 replays
+	// twice as fast. 0 replays as fast as possible.
+	Speed float64
+	// MaxGap caps the pause between two queries, so idle periods are skipped.
+	MaxGap time.Duration
+	// To is the last block count to replay, negative for the whole chain.
+	To int32
+	// CheckpointInterval is the write sequence interval to take state digests, it should match
+	// the StateDigestInterval of miners to be verifiable.
+	CheckpointInterval uint64
+	// OnBlock is called after a block is replayed.
+	OnBlock func(count int32, b *types.Block)
+}
+
+// Result is the summary of a replay.
+type Result struct {
+	Blocks      int32
+	Queries     int
+	Digest      *types.StateDigest
+	Checkpoints []*types.StateDigest
+}
+
+// Checkpoint returns the state digest taken at seq.
+func (r *Result) Checkpoint(seq uint64) (d *types.StateDigest, ok bool) {
+	if r.Digest != nil && r.Digest.Seq == seq {
+		return r.Digest, true
+	}
+	i := sort.Search(len(r.Checkpoints), func(i int) bool { return r.Checkpoints[i].Seq >= seq })
+	if i < len(r.Checkpoints) && r.Checkpoints[i].Seq == seq {
+		return r.Checkpoints[i], true
+	}
+	return
+}
+
+// Verify compares the expected digest with the replayed digest at the same sequence, the
+// divergent tables are reported in the error.
+func (r *Result) Verify(expected *types.StateDigest) (err error) {
+	local, ok := r.Checkpoint(expected.Seq)
+	if !ok {
+		return errors.Wrapf(ErrNoCheckpoint, "seq %d", expected.Seq)
+	}
+	if local.Root.IsEqual(&expected.Root) {
+		return
+	}
+	var (
+		tables    = make(map[string]hash.Hash, len(local.Tables))
+		divergent []string
+	)
+	for _, t := range local.Tables {
+		tables[t.Table] = t.Hash
+	}
+	for _, t := range expected.Tables {
+		h, ok := tables[t.Table]
+		if !ok || !h.IsEqual(&t.Hash) {
+			divergent = append(divergent, t.Table)
+		}
+		delete(tables, t.Table)
+	}
+	for t := range tables {
+		divergent = append(divergent, t)
+	}
+	sort.Strings(divergent)
+	return errors.Wrapf(ErrDigestMismatch, "seq %d, root %s vs %s, divergent tables %v",
+		expected.Seq, local.Root.String(), expected.Root.String(), divergent)
+}
+
+// Replayer replays blocks from a BlockSource to a local database file.
+type Replayer struct {
+	src BlockSource
+	cfg Config
+	st  *x.State
+}
+
+// NewReplayer creates a replayer to the local database file, which should not exist before.
+func NewReplayer(src BlockSource, filename string, cfg Config) (r *Replayer, err error) {
+	var strg *xs.SQLite3
+	if strg, err = xs.NewSqlite(filename); err != nil {
+		return
+	}
+	if cfg.CheckpointInterval == 0 {
+		cfg.CheckpointInterval = DefaultCheckpointInterval
+	}
+	if cfg.MaxGap <= 0 {
+		cfg.MaxGap = DefaultMaxGap
+	}
+	r = &Replayer{
+		src: src,
+		cfg: cfg,
+		st:  x.NewState(sql.LevelReadUncommitted, proto.NodeID(""), strg),
+	}
+	return
+}
+
+// Replay replays the blocks from genesis, the signatures of blocks and queries are verified.
+func (r *Replayer) Replay(ctx context.Context) (res *Result, err error) {
+	var (
+		prev *types.Block
+		last time.Time
+	)
+	res = &Result{}
+	for count := int32(0); r.cfg.To < 0 || count <= r.cfg.To; count++ {
+		var b *types.Block
+		if b, err = r.src.FetchBlock(ctx, count); err != nil {
+			if errors.Cause(err) == ErrEndOfChain {
+				err = nil
+				break
+			}
+			return
+		}
+		if err = verifyBlock(prev, b); err != nil {
+			err = errors.Wrapf(err, "verify block %d", count)
+			return
+		}
+		for i, q := range b.QueryTxs {
+			if q.Request.Header.QueryType != types.WriteQuery {
+				continue
+			}
+			if err = q.Request.Verify(); err != nil {
+				err = errors.Wrapf(err, "verify query %d:%d", count, i)
+				return
+			}
+			if err = r.pace(ctx, &last, q.Request.Header.Timestamp); err != nil {
+				return
+			}
+			if err = r.replayQuery(ctx, res, q); err != nil {
+				err = errors.Wrapf(err, "replay query %d:%d", count, i)
+				return
+			}
+		}
+		res.Blocks++
+		prev = b
+		if r.cfg.OnBlock != nil {
+			r.cfg.OnBlock(count, b)
+		}
+	}
+	if res.Digest, err = r.st.Digest(); err != nil {
+		err = errors.Wrap(err, "digest replayed state")
+	}
+	return
+}
+
+// Close commits the replayed state and closes the local database file.
+func (r *Replayer) Close() error {
+	return r.st.Close(true)
+}
+
+func verifyBlock(prev, b *types.Block) (err error) {
+	if prev == nil {
+		return b.VerifyAsGenesis()
+	}
+	if !b.ParentHash().IsEqual(prev.BlockHash()) {
+		return ErrBrokenChain
+	}
+	return b.Verify()
+}
+
+// replayQuery replays a single write query, and takes a state digest when the write crosses a
+// checkpoint interval boundary, the same as miners do.
+func (r *Replayer) replayQuery(ctx context.Context, res *Result, q *types.QueryAsTx) (err error) {
+	var (
+		before = q.Response.LogOffset
+		after  = before + uint64(len(q.Request.Payload.Queries))
+	)
+	if err = r.st.ReplayBlockWithContext(ctx, &types.Block{
+		QueryTxs: []*types.QueryAsTx{q},
+	}); err != nil {
+		return
+	}
+	res.Queries++
+	if before/r.cfg.CheckpointInterval == after/r.cfg.CheckpointInterval {
+		return
+	}
+	var d *types.StateDigest
+	if d, err = r.st.Digest(); err != nil {
+		return
+	}
+	res.Checkpoints = append(res.Checkpoints, d)
+	return
+}
+
+// pace sleeps to keep the original interval between queries scaled by speed.
+func (r *Replayer) pace(ctx context.Context, last *time.Time, ts time.Time) (err error) {
+	if r.cfg.Speed <= 0 {
+		return
+	}
+	defer func() { *last = ts }()
+	if last.IsZero() {
+		return
+	}
+	var gap = time.Duration(float64(ts.Sub(*last)) / r.cfg.Speed)
+	if gap <= 0 {
+		return
+	}
+	if gap > r.cfg.MaxGap {
+		gap = r.cfg.MaxGap
+	}
+	var timer = time.NewTimer(gap)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	return
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replay
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/types"
+)
+
+type sliceSource []*types.Block
+
+func (s sliceSource) FetchBlock(ctx context.Context, count int32) (*types.Block, error) {
+	if int(count) >= len(s) {
+		return nil, ErrEndOfChain
+	}
+	return s[count], nil
+}
+
+func buildChain(priv *asymmetric.PrivateKey, writes [][]string) (blocks sliceSource, err error) {
+	var (
+		now     = time.Now().UTC()
+		seq     uint64
+		genesis = &types.Block{
+			SignedHeader: types.SignedHeader{Header: types.Header{Timestamp: now}},
+		}
+	)
+	if err = genesis.PackAsGenesis(); err != nil {
+		return
+	}
+	blocks = append(blocks, genesis)
+	for i, w := range writes {
+		var b = &types.Block{
+			SignedHeader: types.SignedHeader{Header: types.Header{
+				GenesisHash: *genesis.BlockHash(),
+				ParentHash:  *blocks[len(blocks)-1].BlockHash(),
+				Timestamp:   now.Add(time.Duration(i+1) * time.Second),
+			}},
+		}
+		for _, pattern := range w {
+			var req = &types.Request{
+				Header: types.SignedRequestHeader{RequestHeader: types.RequestHeader{
+					QueryType: types.WriteQuery,
+					Timestamp: b.SignedHeader.Timestamp,
+				}},
+				Payload: types.RequestPayload{Queries: []types.Query{{Pattern: pattern}}},
+			}
+			if err = req.Sign(priv); err != nil {
+				return
+			}
+			var resp = &types.SignedResponseHeader{ResponseHeader: types.ResponseHeader{
+				Request:   req.Header.RequestHeader,
+				LogOffset: seq,
+			}}
+			if err = resp.BuildHash(); err != nil {
+				return
+			}
+			seq++
+			b.QueryTxs = append(b.QueryTxs, &types.QueryAsTx{Request: req, Response: resp})
+		}
+		if err = b.PackAndSignBlock(priv); err != nil {
+			return
+		}
+		blocks = append(blocks, b)
+	}
+	return
+}
+
+func TestReplay(t *testing.T) {
+	Convey("test replay sqlchain blocks", t, func(c C) {
+		dir, err := ioutil.TempDir("", "replay")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		blocks, err := buildChain(priv, [][]string{
+			{"CREATE TABLE t (id INT PRIMARY KEY, v TEXT)", "INSERT INTO t VALUES (1, 'a')"},
+			{"INSERT INTO t VALUES (2, 'b')"},
+			{"UPDATE t SET v = 'c' WHERE id = 1", "INSERT INTO t VALUES (3, 'd')"},
+		})
+		So(err, ShouldBeNil)
+
+		replayTo := func(name string, cfg Config) (res *Result) {
+			r, err := NewReplayer(blocks, path.Join(dir, name), cfg)
+			c.So(err, ShouldBeNil)
+			defer r.Close()
+			res, err = r.Replay(context.Background())
+			c.So(err, ShouldBeNil)
+			return
+		}
+
+		var replayed []int32
+		res := replayTo("a.db", Config{
+			To:                 -1,
+			CheckpointInterval: 2,
+			OnBlock:            func(count int32, b *types.Block) { replayed = append(replayed, count) },
+		})
+		So(res.Blocks, ShouldEqual, 4)
+		So(res.Queries, ShouldEqual, 5)
+		So(replayed, ShouldResemble, []int32{0, 1, 2, 3})
+		So(res.Digest.Seq, ShouldEqual, 5)
+		So(res.Checkpoints, ShouldHaveLength, 2)
+		So(res.Checkpoints[0].Seq, ShouldEqual, 2)
+		So(res.Checkpoints[1].Seq, ShouldEqual, 4)
+
+		// replays are deterministic
+		another := replayTo("b.db", Config{To: -1, CheckpointInterval: 2})
+		So(res.Verify(another.Digest), ShouldBeNil)
+		So(res.Verify(another.Checkpoints[0]), ShouldBeNil)
+
+		partial := replayTo("c.db", Config{To: 2, CheckpointInterval: 2})
+		So(partial.Blocks, ShouldEqual, 3)
+		So(partial.Digest.Seq, ShouldEqual, 3)
+		err = res.Verify(partial.Digest)
+		So(errors.Cause(err), ShouldEqual, ErrNoCheckpoint)
+		So(res.Verify(partial.Checkpoints[0]), ShouldBeNil)
+
+		var tampered = *another.Digest
+		tampered.Tables = append([]types.TableDigest{}, tampered.Tables...)
+		tampered.Tables[0].Hash[0] ^= 0xff
+		tampered.Root[0] ^= 0xff
+		err = res.Verify(&tampered)
+		So(errors.Cause(err), ShouldEqual, ErrDigestMismatch)
+		So(err.Error(), ShouldContainSubstring, "[t]")
+	})
+	Convey("test replay broken chain", t, func() {
+		dir, err := ioutil.TempDir("", "replay")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		blocks, err := buildChain(priv, [][]string{
+			{"CREATE TABLE t (id INT PRIMARY KEY)"},
+			{"INSERT INTO t VALUES (1)"},
+		})
+		So(err, ShouldBeNil)
+		blocks = sliceSource{blocks[0], blocks[2]}
+		r, err := NewReplayer(blocks, path.Join(dir, "broken.db"), Config{To: -1})
+		So(err, ShouldBeNil)
+		defer r.Close()
+		_, err = r.Replay(context.Background())
+		So(errors.Cause(err), ShouldEqual, ErrBrokenChain)
+	})
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package replay
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	"github.com/SQLess/SQLess/rpc"
+	"github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/worker"
+)
+
+// BlockSource provides the blocks of a sqlchain by block count since genesis.
+type BlockSource interface {
+	// FetchBlock returns the block at count, or ErrEndOfChain if count is beyond the head.
+	FetchBlock(ctx context.Context, count int32) (*types.Block, error)
+}
+
+// MinerSource fetches the blocks and state digests of a database from its leader miner, the
+// local account should have read permission on the database.
+type MinerSource struct {
+	dbID   proto.DatabaseID
+	caller rpc.PCaller
+}
+
+// NewMinerSource returns a MinerSource of the database.
+func NewMinerSource(dbID proto.DatabaseID) (s *MinerSource, err error) {
+	var (
+		req  = &types.QuerySQLChainProfileReq{DBID: dbID}
+		resp = &types.QuerySQLChainProfileResp{}
+	)
+	if err = mux.RequestBP(route.MCCQuerySQLChainProfile.String(), req, resp); err != nil {
+		err = errors.Wrap(err, "get sqlchain profile failed")
+		return
+	}
+	if len(resp.Profile.Miners) == 0 {
+		err = errors.Errorf("no miner found for database %s", dbID)
+		return
+	}
+	s = &MinerSource{
+		dbID:   dbID,
+		caller: mux.NewPersistentCaller(resp.Profile.Miners[0].NodeID),
+	}
+	return
+}
+
+// FetchBlock implements BlockSource.FetchBlock.
+func (s *MinerSource) FetchBlock(ctx context.Context, count int32) (b *types.Block, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	var (
+		req = &worker.ObserverFetchBlockReq{
+			DatabaseID: s.dbID,
+			Count:      count,
+		}
+		resp = &worker.ObserverFetchBlockResp{}
+	)
+	if err = s.caller.Call(route.DBSObserverFetchBlock.String(), req, resp); err != nil {
+		err = errors.Wrapf(err, "fetch block %d failed", count)
+		return
+	}
+	if resp.Block == nil {
+		err = ErrEndOfChain
+		return
+	}
+	return resp.Block, nil
+}
+
+// StateDigest returns the state digest kept by the leader miner at seq, found is false if the
+// digest is no longer kept or not taken at seq.
+func (s *MinerSource) StateDigest(ctx context.Context, seq uint64) (
+	digest *types.StateDigest, found bool, err error,
+) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	var (
+		req  = &types.StateDigestReq{DatabaseID: s.dbID, Seq: seq}
+		resp = &types.StateDigestResp{}
+	)
+	if err = s.caller.Call(route.DBSStateDigest.String(), req, resp); err != nil {
+		err = errors.Wrap(err, "fetch state digest failed")
+		return
+	}
+	if found = resp.Found; found {
+		digest = &resp.Digest
+	}
+	return
+}
+
+// Close closes the connection to the miner.
+func (s *MinerSource) Close() {
+	s.caller.Close()
+}
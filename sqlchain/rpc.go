@@ -46,6 +46,21 @@ type FetchBlockResp struct {
 	Block  *types.Block
 }
 
+// FetchBlocksReq defines a request of the FetchBlocks RPC method, the blocks in the height range
+// [From, To] are fetched.
+type FetchBlocksReq struct {
+	From int32
+	To   int32
+}
+
+// FetchBlocksResp defines a response of the FetchBlocks RPC method.
+type FetchBlocksResp struct {
+	// Height is the head height of the remote peer.
+	Height int32
+	// Blocks are the blocks in height order, the heights without block are skipped.
+	Blocks []*types.Block
+}
+
 // AdviseNewBlock is the RPC method to advise a new produced block to the target server.
 func (s *ChainRPCService) AdviseNewBlock(req *AdviseNewBlockReq, resp *AdviseNewBlockResp) (
 	err error) {
@@ -62,3 +77,10 @@ func (s *ChainRPCService) FetchBlock(req *FetchBlockReq, resp *FetchBlockResp) (
 	}
 	return
 }
+
+// FetchBlocks is the RPC method to fetch a batch of known blocks from the target server.
+func (s *ChainRPCService) FetchBlocks(req *FetchBlocksReq, resp *FetchBlocksResp) (err error) {
+	resp.Height = s.chain.getCurrentHeight()
+	resp.Blocks, err = s.chain.FetchBlocks(req.From, req.To)
+	return
+}
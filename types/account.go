@@ -50,6 +50,8 @@ type UserPermission struct {
 	// SQL pattern regulations for user queries
 	// only a fully matched (case-sensitive) sql query is permitted to execute.
 	Patterns []string
+	// Statement pattern rules for user queries, checked by miners before execution.
+	Rules []QueryRule
 
 	// patterns map cache for matching
 	cachedPatternMapOnce sync.Once
@@ -221,6 +223,8 @@ const (
 	Arrears
 	// Arbitration defines the user/miner is in an arbitration.
 	Arbitration
+	// Decommissioning defines the miner is leaving the database, see DecommissionMiner.
+	Decommissioning
 	// NumberOfStatus defines the number of status.
 	NumberOfStatus
 )
@@ -263,6 +267,9 @@ type MinerInfo struct {
 	Deposit        uint64
 	Status         Status
 	EncryptionKey  string
+	// DecommissionBilling is the last billing height of the database when the miner announced
+	// its decommission, the departure is finalized after the billing advances past it.
+	DecommissionBilling uint32
 }
 
 // SQLChainProfile defines a SQLChainProfile related to an account.
@@ -297,6 +304,13 @@ type ProviderProfile struct {
 	GasPrice      uint64
 	TokenType     TokenType // default Particle
 	NodeID        proto.NodeID
+	// ReservationFee is the fee of reserving the capacity, it's not reservable if it's zero.
+	ReservationFee uint64
+	// ReservedBy is the owner holding the capacity reservation until ReservationExpiry.
+	ReservedBy        proto.AccountAddress
+	ReservationExpiry uint32
+	// Build is the build info announced by the latest ProvideService of the node.
+	Build proto.BuildInfo
 }
 
 // Account store its balance, and other mate data.
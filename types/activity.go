@@ -0,0 +1,88 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package types
+
+import (
+	"time"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+)
+
+// ActivityKind defines the kind of an account activity.
+type ActivityKind string
+
+const (
+	// ActivityTransferOut is a token transfer sent by the account.
+	ActivityTransferOut ActivityKind = "transfer_out"
+	// ActivityTransferIn is a token transfer received by the account.
+	ActivityTransferIn ActivityKind = "transfer_in"
+	// ActivityCreateDatabase is a database created by the account.
+	ActivityCreateDatabase ActivityKind = "create_database"
+	// ActivityPermissionGranted is a database permission granted by the account to another one.
+	ActivityPermissionGranted ActivityKind = "permission_granted"
+	// ActivityPermissionReceived is a database permission granted to the account.
+	ActivityPermissionReceived ActivityKind = "permission_received"
+	// ActivityBillingCharge is a database usage billed to the account.
+	ActivityBillingCharge ActivityKind = "billing_charge"
+	// ActivityBillingIncome is a database usage income of the account as a miner.
+	ActivityBillingIncome ActivityKind = "billing_income"
+	// ActivityBillingMismatch is a billed cost of a database owned by the account which differs
+	// from the billing statement of a miner, the counterparty is the miner and the amount is the
+	// billed cost, see the QueryBillingMismatches RPC method for the details.
+	ActivityBillingMismatch ActivityKind = "billing_mismatch"
+)
+
+// Activity defines an activity of an account in a confirmed transaction.
+type Activity struct {
+	// ID orders the activities of the block producer index, a newer activity has a larger id.
+	ID           uint64
+	Kind         ActivityKind
+	Account      proto.AccountAddress
+	Counterparty proto.AccountAddress
+	DatabaseID   proto.DatabaseID
+	// Amount is the token amount of the transfer and database creation activities, or the billed
+	// cost of the billing activities before applying the gas price of the database.
+	Amount uint64
+	// TokenType is the token of the transfer and database creation activities, the billing
+	// activities are settled in the token of the database.
+	TokenType TokenType
+	Role      UserPermissionRole
+	TxHash    hash.Hash
+	Height    uint32
+	Timestamp time.Time
+}
+
+// QueryAccountActivitiesReq defines a request of the QueryAccountActivities RPC method.
+type QueryAccountActivitiesReq struct {
+	proto.Envelope
+	Addr proto.AccountAddress
+	// Kinds filters the activities by kind, all kinds are returned if empty.
+	Kinds []ActivityKind
+	// Before pages the activities older than the activity id, the newest activities are returned
+	// if it is 0.
+	Before uint64
+	Limit  int
+}
+
+// QueryAccountActivitiesResp defines a response of the QueryAccountActivities RPC method.
+type QueryAccountActivitiesResp struct {
+	proto.Envelope
+	Addr       proto.AccountAddress
+	Activities []*Activity
+	// Next is the Before cursor of the next page, or 0 if there are no more activities.
+	Next uint64
+}
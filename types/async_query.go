@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package types
+
+import (
+	"time"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+// AsyncQueryState defines the state of an asynchronous query job on the miner.
+type AsyncQueryState int32
+
+const (
+	// AsyncQueryRunning indicates that the query is still running.
+	AsyncQueryRunning AsyncQueryState = iota
+	// AsyncQuerySucceeded indicates that the query is finished and the result is ready to fetch.
+	AsyncQuerySucceeded
+	// AsyncQueryFailed indicates that the query is finished with an error.
+	AsyncQueryFailed
+	// AsyncQueryCanceled indicates that the query is canceled by the client.
+	AsyncQueryCanceled
+)
+
+// String implements fmt.Stringer for logging purpose.
+func (s AsyncQueryState) String() string {
+	switch s {
+	case AsyncQueryRunning:
+		return "Running"
+	case AsyncQuerySucceeded:
+		return "Succeeded"
+	case AsyncQueryFailed:
+		return "Failed"
+	case AsyncQueryCanceled:
+		return "Canceled"
+	default:
+		return "Unknown"
+	}
+}
+
+// Finished returns whether the job is not running anymore.
+func (s AsyncQueryState) Finished() bool {
+	return s != AsyncQueryRunning
+}
+
+// AsyncQueryStatus defines the status of an asynchronous query job.
+type AsyncQueryStatus struct {
+	JobID     string
+	State     AsyncQueryState
+	Error     string
+	Rows      uint64
+	Submitted time.Time
+	Finished  time.Time
+}
+
+// SubmitAsyncQueryResp defines a response of the SubmitAsyncQuery RPC method, the request is a
+// signed read query Request.
+type SubmitAsyncQueryResp struct {
+	proto.Envelope
+	Status AsyncQueryStatus
+}
+
+// AsyncQueryReq defines a request of the AsyncQueryStatus, FetchAsyncQuery and CancelAsyncQuery
+// RPC methods, the job is only visible to the node submitting it, which is always taken from the
+// authenticated rpc session.
+type AsyncQueryReq struct {
+	proto.Envelope
+	DatabaseID     proto.DatabaseID
+	JobID          string
+	AcceptEncoding CompressionType
+}
+
+// AsyncQueryResp defines a response of the asynchronous query job RPC methods, the Response is
+// only set by FetchAsyncQuery once the query is succeeded.
+type AsyncQueryResp struct {
+	proto.Envelope
+	Status   AsyncQueryStatus
+	Response *Response
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// HeightHeader defines a sqlchain block header at the height.
+type HeightHeader struct {
+	Height int32
+	Header SignedHeader
+}
+
+// VerifyHeaderChain checks that the headers are signed by their producers and linked by the
+// parent hashes in height order, the first header is trusted by the caller.
+func VerifyHeaderChain(headers []*HeightHeader) (err error) {
+	for i, h := range headers {
+		if err = h.Header.Verify(); err != nil {
+			return errors.Wrapf(err, "verify header at height %d failed", h.Height)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := headers[i-1]
+		if h.Height <= prev.Height || !h.Header.ParentHash.IsEqual(&prev.Header.HSV.DataHash) {
+			return errors.Wrapf(ErrHeaderChainBroken, "header at height %d", h.Height)
+		}
+	}
+	return
+}
+
+// VerifyWithHeader checks that the query proof is included in the block of the trusted header,
+// auditors holding the verified header chain need no block body to check the proof.
+func (p *ReceiptProof) VerifyWithHeader(h *HeightHeader) (err error) {
+	if p.Height != h.Height || !p.Block.HSV.DataHash.IsEqual(&h.Header.HSV.DataHash) {
+		return errors.Wrapf(ErrReceiptNotMatch, "proof is not in block at height %d", h.Height)
+	}
+	return p.VerifyInclusion()
+}
+
+// QueryProofReq defines a request of the QueryProof RPC method, which proves the query at the
+// position of the sqlchain.
+type QueryProofReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+	Height     int32
+	Index      int // index of the query in the block
+}
+
+// QueryProofResp defines a response of the QueryProof RPC method.
+type QueryProofResp struct {
+	proto.Envelope
+	Proof ReceiptProof
+}
+
+// FetchBlockHeadersReq defines a request of the FetchBlockHeaders RPC method, the headers in
+// the height range [From, To] are fetched.
+type FetchBlockHeadersReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+	From       int32
+	To         int32
+}
+
+// FetchBlockHeadersResp defines a response of the FetchBlockHeaders RPC method, the heights
+// without block are skipped.
+type FetchBlockHeadersResp struct {
+	proto.Envelope
+	Headers []*HeightHeader
+	Head    int32 // head height of the sqlchain on the miner
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+)
+
+func TestQueryAudit(t *testing.T) {
+	Convey("Given a chain of blocks packing queries", t, func() {
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		var (
+			blocks  []*Block
+			headers []*HeightHeader
+			parent  = genesisHash
+		)
+		for h := int32(1); h <= 3; h++ {
+			block := &Block{
+				SignedHeader: SignedHeader{
+					Header: Header{
+						Version:     0x01000000,
+						GenesisHash: genesisHash,
+						ParentHash:  parent,
+					},
+				},
+			}
+			resp := &SignedResponseHeader{
+				ResponseHeader: ResponseHeader{
+					Request:     RequestHeader{DatabaseID: "db", SeqNo: uint64(h)},
+					RequestHash: hash.THashH([]byte{byte(h)}),
+				},
+			}
+			So(resp.BuildHash(), ShouldBeNil)
+			block.QueryTxs = append(block.QueryTxs, &QueryAsTx{Response: resp})
+			So(block.PackAndSignBlock(priv), ShouldBeNil)
+			parent = *block.BlockHash()
+			blocks = append(blocks, block)
+			headers = append(headers, &HeightHeader{Height: h, Header: block.SignedHeader})
+		}
+
+		Convey("The linked headers should be verified", func() {
+			So(VerifyHeaderChain(headers), ShouldBeNil)
+			headers[1], headers[2] = headers[2], headers[1]
+			So(errors.Cause(VerifyHeaderChain(headers)), ShouldEqual, ErrHeaderChainBroken)
+		})
+
+		Convey("The query should be proved with the block header only", func() {
+			proof, ok := blocks[1].QueryProof(2, 0)
+			So(ok, ShouldBeTrue)
+			So(proof.VerifyWithHeader(headers[1]), ShouldBeNil)
+			So(errors.Cause(proof.VerifyWithHeader(headers[2])), ShouldEqual, ErrReceiptNotMatch)
+			_, ok = blocks[1].QueryProof(2, 1)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
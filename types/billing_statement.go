@@ -0,0 +1,111 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// BillingStatementHeader defines the per-user usage of a database in a billing period, which is
+// computed by a single miner from its local sqlchain.
+type BillingStatementHeader struct {
+	DatabaseID proto.DatabaseID
+	Range      Range
+	Users      []*UserCost // ordered by user address
+}
+
+// SignedBillingStatement defines the miner signed billing statement.
+type SignedBillingStatement struct {
+	BillingStatementHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the billing statement.
+func (s *SignedBillingStatement) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return s.DefaultHashSignVerifierImpl.Sign(&s.BillingStatementHeader, signer)
+}
+
+// Verify checks hash and signature in the billing statement.
+func (s *SignedBillingStatement) Verify() (err error) {
+	return s.DefaultHashSignVerifierImpl.Verify(&s.BillingStatementHeader)
+}
+
+// SubmitBillingStatementReq defines a request of the SubmitBillingStatement RPC method.
+type SubmitBillingStatementReq struct {
+	proto.Envelope
+	Statement SignedBillingStatement
+}
+
+// SubmitBillingStatementResp defines a response of the SubmitBillingStatement RPC method.
+type SubmitBillingStatementResp struct {
+	proto.Envelope
+}
+
+var (
+	// MaxBillingBatchStatements defines the max count of billing statements accepted in a batch.
+	MaxBillingBatchStatements = 256
+	// MaxBillingBatchDecompressedSize defines the max size in bytes of a decompressed billing
+	// statement batch.
+	MaxBillingBatchDecompressedSize int64 = 16 << 20
+)
+
+// SubmitBillingStatementsReq defines a request of the SubmitBillingStatements RPC method, which
+// carries the statements of multiple databases batched by a miner.
+type SubmitBillingStatementsReq struct {
+	proto.Envelope
+	Statements []SignedBillingStatement
+	Encoding   CompressionType
+	Compressed []byte
+}
+
+// SubmitBillingStatementsResp defines a response of the SubmitBillingStatements RPC method, the
+// errors are in the same order of the statements, empty for the accepted ones.
+type SubmitBillingStatementsResp struct {
+	proto.Envelope
+	Errors []string
+}
+
+// BillingMismatch defines a user cost mismatch between a miner billing statement and the
+// submitted UpdateBilling transaction of the same billing period.
+type BillingMismatch struct {
+	DatabaseID    proto.DatabaseID
+	Range         Range
+	Miner         proto.AccountAddress // miner of the statement
+	Biller        proto.AccountAddress // miner of the UpdateBilling transaction
+	User          proto.AccountAddress
+	StatementCost uint64
+	BilledCost    uint64
+	Detected      time.Time
+}
+
+// QueryBillingMismatchesReq defines a request of the QueryBillingMismatches RPC method.
+type QueryBillingMismatchesReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+}
+
+// QueryBillingMismatchesResp defines a response of the QueryBillingMismatches RPC method.
+type QueryBillingMismatchesResp struct {
+	proto.Envelope
+	Mismatches []*BillingMismatch
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// BlobChunkHeader defines the header of a blob chunk request.
+type BlobChunkHeader struct {
+	DatabaseID proto.DatabaseID
+	Hash       hash.Hash // content hash of the chunk
+	Data       []byte    // chunk data, only used in upload requests
+}
+
+// SignedBlobChunkHeader defines the signed header of a blob chunk request.
+type SignedBlobChunkHeader struct {
+	BlobChunkHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the blob chunk header.
+func (sh *SignedBlobChunkHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.BlobChunkHeader, signer)
+}
+
+// Verify checks hash and signature in the blob chunk header.
+func (sh *SignedBlobChunkHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.BlobChunkHeader)
+}
+
+// BlobChunkReq defines a request of the PutBlobChunk/FetchBlobChunk RPC method.
+type BlobChunkReq struct {
+	proto.Envelope
+	Header SignedBlobChunkHeader
+	// Forwarded indicates the request is forwarded by a miner and should not be forwarded again.
+	Forwarded bool
+}
+
+// BlobChunkResp defines a response of the PutBlobChunk/FetchBlobChunk RPC method.
+type BlobChunkResp struct {
+	proto.Envelope
+	Hash hash.Hash
+	Data []byte
+}
@@ -172,6 +172,10 @@ func (b *Block) Signee() *ca.PublicKey {
 }
 
 func (b *Block) computeMerkleRoot() hash.Hash {
+	return *merkle.NewMerkle(b.merkleLeaves()).GetRoot()
+}
+
+func (b *Block) merkleLeaves() []*hash.Hash {
 	var hs = make([]*hash.Hash, 0, len(b.FailedReqs)+len(b.QueryTxs)+len(b.Acks))
 	for i := range b.FailedReqs {
 		h := b.FailedReqs[i].Header.Hash()
@@ -185,7 +189,36 @@ func (b *Block) computeMerkleRoot() hash.Hash {
 		h := b.Acks[i].Hash()
 		hs = append(hs, &h)
 	}
-	return *merkle.NewMerkle(hs).GetRoot()
+	return hs
+}
+
+// ReceiptProof returns the proof that the query response is packed in the block, ok is false if
+// the response is not found in the block.
+func (b *Block) ReceiptProof(height int32, responseHash hash.Hash) (proof *ReceiptProof, ok bool) {
+	for i, tx := range b.QueryTxs {
+		if h := tx.Response.Hash(); h.IsEqual(&responseHash) {
+			return b.QueryProof(height, i)
+		}
+	}
+	return
+}
+
+// QueryProof returns the proof that the i-th query of the block is packed in it, ok is false if
+// the position is out of range.
+func (b *Block) QueryProof(height int32, i int) (proof *ReceiptProof, ok bool) {
+	if i < 0 || i >= len(b.QueryTxs) {
+		return
+	}
+	proof = &ReceiptProof{
+		Height:   height,
+		Block:    b.SignedHeader,
+		Response: *b.QueryTxs[i].Response,
+		Index:    len(b.FailedReqs) + i,
+	}
+	if proof.MerkleProof, ok = merkle.NewMerkle(b.merkleLeaves()).GetProof(proof.Index); !ok {
+		proof = nil
+	}
+	return
 }
 
 // Blocks is Block (reference) array.
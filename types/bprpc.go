@@ -17,6 +17,8 @@
 package types
 
 import (
+	"time"
+
 	"github.com/SQLess/SQLess/blockproducer/interfaces"
 	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
 	"github.com/SQLess/SQLess/crypto/hash"
@@ -61,6 +63,8 @@ type FetchLastIrreversibleBlockResp struct {
 	Height    uint32
 	Block     *BPBlock
 	SQLChains []*SQLChainProfile
+	// RevokedNodes lists the node identities revoked on chain.
+	RevokedNodes []proto.NodeID
 }
 
 // FetchBlockByCountReq define a request of the FetchBlockByCount RPC method.
@@ -105,6 +109,67 @@ type AddTxResp struct {
 	proto.Envelope
 }
 
+// SimulateTxReq defines a request of the SimulateTx RPC method.
+type SimulateTxReq struct {
+	proto.Envelope
+	Tx interfaces.Transaction
+}
+
+// BalanceChange defines a token balance change of an account caused by a transaction.
+type BalanceChange struct {
+	Address   proto.AccountAddress
+	TokenType TokenType
+	Before    uint64
+	After     uint64
+}
+
+// SimulateTxResp defines a response of the SimulateTx RPC method.
+type SimulateTxResp struct {
+	proto.Envelope
+	OK bool
+	// Error is the reason of the failure if OK is false.
+	Error string
+	// Nonce is the next account nonce expected by the block producer, including the pending
+	// transactions of the account.
+	Nonce   interfaces.AccountNonce
+	Changes []BalanceChange
+}
+
+// PreviewCreateDatabaseReq defines a request of the PreviewCreateDatabase RPC method.
+type PreviewCreateDatabaseReq struct {
+	proto.Envelope
+	Header CreateDatabaseHeader
+}
+
+// MinerCandidate defines a provider evaluated for a database creation.
+type MinerCandidate struct {
+	Address       proto.AccountAddress
+	NodeID        proto.NodeID
+	NodeAddr      string
+	Space         uint64
+	Memory        uint64
+	LoadAvgPerCPU float64
+	GasPrice      uint64
+	Deposit       uint64
+	Rating        float64
+	// ReservationFee is the fee of reserving the capacity ahead, it's not reservable if zero.
+	ReservationFee uint64
+	// Selected indicates the provider would be matched for the database.
+	Selected bool
+	// Mismatch is the reason why the provider does not match the request.
+	Mismatch string
+}
+
+// PreviewCreateDatabaseResp defines a response of the PreviewCreateDatabase RPC method.
+type PreviewCreateDatabaseResp struct {
+	proto.Envelope
+	Candidates        []MinerCandidate
+	MinAdvancePayment uint64
+	Balance           uint64
+	// Error is the reason why the database creation would fail, empty if it would succeed.
+	Error string
+}
+
 // SubReq defines a request of the Sub RPC method.
 type SubReq struct {
 	proto.Envelope
@@ -173,6 +238,11 @@ type QueryTxStateResp struct {
 	proto.Envelope
 	Hash  hash.Hash
 	State pi.TransactionState
+	// Height is the height of the block packing the transaction, it is only set in the packed
+	// and confirmed states.
+	Height uint32
+	// HeadHeight is the height of the head block of the block producer.
+	HeadHeight uint32
 }
 
 // QueryAccountSQLChainProfilesReq defines a request of QueryAccountSQLChainProfiles RPC method.
@@ -187,3 +257,26 @@ type QueryAccountSQLChainProfilesResp struct {
 	Addr     proto.AccountAddress
 	Profiles []*SQLChainProfile
 }
+
+// QueryTimeReq defines a request of the QueryTime RPC method.
+type QueryTimeReq struct {
+	proto.Envelope
+}
+
+// QueryTimeResp defines a response of the QueryTime RPC method.
+type QueryTimeResp struct {
+	proto.Envelope
+	Time time.Time
+}
+
+// QueryBuildInfosReq defines a request of the QueryBuildInfos RPC method.
+type QueryBuildInfosReq struct {
+	proto.Envelope
+}
+
+// QueryBuildInfosResp defines a response of the QueryBuildInfos RPC method.
+type QueryBuildInfosResp struct {
+	proto.Envelope
+	Nodes    []*proto.NodeBuildInfo
+	Versions map[string]uint32 // node count by version and build hash
+}
@@ -0,0 +1,35 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package types
+
+import (
+	"github.com/SQLess/SQLess/proto"
+)
+
+// CancelQueryReq defines a request of the CancelQuery RPC method, the node id of the query key
+// is always taken from the authenticated rpc session.
+type CancelQueryReq struct {
+	proto.Envelope
+	DatabaseID   proto.DatabaseID
+	ConnectionID uint64
+	SeqNo        uint64
+}
+
+// CancelQueryResp defines a response of the CancelQuery RPC method.
+type CancelQueryResp struct {
+	proto.Envelope
+	Canceled bool
+}
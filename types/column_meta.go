@@ -0,0 +1,146 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+)
+
+// ValueKind defines the storage class of the values in a result column.
+type ValueKind uint8
+
+const (
+	// KindUnknown defines the kind of a column without type metadata.
+	KindUnknown ValueKind = iota
+	// KindNull defines the kind of a column with NULL values only.
+	KindNull
+	// KindInteger defines the kind of a column with int64 values.
+	KindInteger
+	// KindReal defines the kind of a column with float64 values.
+	KindReal
+	// KindText defines the kind of a column with string values.
+	KindText
+	// KindBlob defines the kind of a column with []byte values.
+	KindBlob
+	// KindBool defines the kind of a column with bool values.
+	KindBool
+	// KindTime defines the kind of a column with time.Time values.
+	KindTime
+	// KindMixed defines the kind of a column with values of different kinds.
+	KindMixed
+)
+
+// String implements fmt.Stringer.
+func (k ValueKind) String() string {
+	switch k {
+	case KindNull:
+		return "null"
+	case KindInteger:
+		return "integer"
+	case KindReal:
+		return "real"
+	case KindText:
+		return "text"
+	case KindBlob:
+		return "blob"
+	case KindBool:
+		return "bool"
+	case KindTime:
+		return "time"
+	case KindMixed:
+		return "mixed"
+	default:
+		return "unknown"
+	}
+}
+
+// ValueKindOf returns the kind of a value scanned from the storage.
+func ValueKindOf(v interface{}) ValueKind {
+	switch v.(type) {
+	case nil:
+		return KindNull
+	case int64, int, int32, uint64:
+		return KindInteger
+	case float64, float32:
+		return KindReal
+	case string:
+		return KindText
+	case []byte:
+		return KindBlob
+	case bool:
+		return KindBool
+	case time.Time:
+		return KindTime
+	default:
+		return KindMixed
+	}
+}
+
+// ColumnMeta defines the precise type metadata of a result column, it tells NULL values from
+// empty values and text values from blob values which are not distinguishable on the wire.
+type ColumnMeta struct {
+	Kind    ValueKind `json:"k"`
+	HasNull bool      `json:"n"`
+	// Kinds are the kinds of the values row by row, only present in a KindMixed column.
+	Kinds []ValueKind `json:"ks,omitempty"`
+}
+
+// KindAt returns the kind of the value in the row of the column.
+func (m *ColumnMeta) KindAt(row int) ValueKind {
+	if m.Kind == KindMixed && row < len(m.Kinds) {
+		return m.Kinds[row]
+	}
+	return m.Kind
+}
+
+// BuildColumnMeta builds the column metadata from the scanned values of the result set.
+func BuildColumnMeta(columns int, data [][]interface{}) (meta []ColumnMeta) {
+	meta = make([]ColumnMeta, columns)
+	for i := range meta {
+		meta[i].Kind = KindNull
+	}
+	for _, row := range data {
+		for i, v := range row {
+			if i >= columns {
+				break
+			}
+			var kind = ValueKindOf(v)
+			switch {
+			case kind == KindNull:
+				meta[i].HasNull = true
+			case meta[i].Kind == KindNull:
+				meta[i].Kind = kind
+			case meta[i].Kind != kind:
+				meta[i].Kind = KindMixed
+			}
+		}
+	}
+	// text and blob values are not distinguishable on the wire, so the kinds of the values in
+	// the mixed columns are kept row by row
+	for i := range meta {
+		if meta[i].Kind != KindMixed {
+			continue
+		}
+		meta[i].Kinds = make([]ValueKind, len(data))
+		for j, row := range data {
+			if i < len(row) {
+				meta[i].Kinds[j] = ValueKindOf(row[i])
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/utils"
+)
+
+// CompressionType defines the payload compression negotiated between client and miner.
+type CompressionType uint8
+
+const (
+	// CompressionNone defines the uncompressed payload.
+	CompressionNone CompressionType = iota
+	// CompressionDeflate defines the payload compressed by deflate.
+	CompressionDeflate
+)
+
+// CompressionThreshold defines the minimum encoded payload size in bytes to be compressed,
+// smaller payloads are sent as is since compression hardly pays off.
+var CompressionThreshold = 4096
+
+// MaxDecompressedSize defines the max size in bytes of a decompressed payload, larger payloads
+// are refused to bound the memory spent on a compressed payload sent by any peer.
+var MaxDecompressedSize int64 = 128 << 20
+
+var (
+	// ErrUnknownCompression indicates the payload is compressed by an unknown algorithm.
+	ErrUnknownCompression = errors.New("unknown payload compression")
+	// ErrPayloadTooLarge indicates the decompressed payload exceeds MaxDecompressedSize.
+	ErrPayloadTooLarge = errors.New("decompressed payload too large")
+)
+
+// String implements fmt.Stringer.
+func (t CompressionType) String() string {
+	switch t {
+	case CompressionNone:
+		return "none"
+	case CompressionDeflate:
+		return "deflate"
+	default:
+		return "unknown"
+	}
+}
+
+// compressPayload encodes the payload and compresses it if the encoded size reaches the
+// threshold, ok reports whether it is compressed.
+func compressPayload(t CompressionType, payload interface{}) (data []byte, ok bool, err error) {
+	if t != CompressionDeflate {
+		return
+	}
+	var enc *bytes.Buffer
+	if enc, err = utils.EncodeMsgPack(payload); err != nil {
+		return
+	}
+	if enc.Len() < CompressionThreshold {
+		return
+	}
+	var (
+		buf = bytes.NewBuffer(make([]byte, 0, enc.Len()/2))
+		w   *flate.Writer
+	)
+	if w, err = flate.NewWriter(buf, flate.BestSpeed); err != nil {
+		return
+	}
+	if _, err = w.Write(enc.Bytes()); err != nil {
+		return
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+	if buf.Len() >= enc.Len() {
+		// incompressible
+		return
+	}
+	return buf.Bytes(), true, nil
+}
+
+func decompressPayload(t CompressionType, data []byte, limit int64, payload interface{}) (err error) {
+	if t != CompressionDeflate {
+		return errors.Wrapf(ErrUnknownCompression, "compression type: %d", t)
+	}
+	var (
+		r   = flate.NewReader(bytes.NewReader(data))
+		raw []byte
+	)
+	defer func() { _ = r.Close() }()
+	if raw, err = ioutil.ReadAll(io.LimitReader(r, limit+1)); err != nil {
+		return errors.Wrap(err, "decompress payload failed")
+	}
+	if int64(len(raw)) > limit {
+		return errors.Wrapf(ErrPayloadTooLarge, "limit: %d", limit)
+	}
+	return utils.DecodeMsgPack(raw, payload)
+}
+
+// Compress moves the queries payload to the compressed form if it is large enough. It must be
+// called after signing, since the hash covers the uncompressed payload.
+func (r *Request) Compress(t CompressionType) (err error) {
+	var (
+		data []byte
+		ok   bool
+	)
+	if data, ok, err = compressPayload(t, &r.Payload); err != nil || !ok {
+		return
+	}
+	r.Encoding, r.Compressed = t, data
+	r.Payload = RequestPayload{}
+	return
+}
+
+// Decompress restores the queries payload from the compressed form if any. The signed header
+// should be verified before, so that only the signed payloads are decompressed.
+func (r *Request) Decompress() (err error) {
+	if r.Encoding == CompressionNone {
+		return
+	}
+	if err = decompressPayload(r.Encoding, r.Compressed, MaxDecompressedSize, &r.Payload); err != nil {
+		return
+	}
+	r.Encoding, r.Compressed = CompressionNone, nil
+	return
+}
+
+// Compress moves the rows payload to the compressed form if it is large enough. It must be
+// called after building the hash, since the hash covers the uncompressed payload.
+func (r *Response) Compress(t CompressionType) (err error) {
+	var (
+		data []byte
+		ok   bool
+	)
+	if data, ok, err = compressPayload(t, &r.Payload); err != nil || !ok {
+		return
+	}
+	r.Encoding, r.Compressed = t, data
+	r.Payload = ResponsePayload{}
+	return
+}
+
+// Decompress restores the rows payload from the compressed form if any.
+func (r *Response) Decompress() (err error) {
+	if r.Encoding == CompressionNone {
+		return
+	}
+	if err = decompressPayload(r.Encoding, r.Compressed, MaxDecompressedSize, &r.Payload); err != nil {
+		return
+	}
+	r.Encoding, r.Compressed = CompressionNone, nil
+	return
+}
+
+// Compress moves the statements to the compressed form if they are large enough. It must be
+// called after signing the statements.
+func (r *SubmitBillingStatementsReq) Compress(t CompressionType) (err error) {
+	var (
+		data []byte
+		ok   bool
+	)
+	if data, ok, err = compressPayload(t, &r.Statements); err != nil || !ok {
+		return
+	}
+	r.Encoding, r.Compressed = t, data
+	r.Statements = nil
+	return
+}
+
+// Decompress restores the statements from the compressed form if any, the batch is refused if
+// it exceeds the batch size limits.
+func (r *SubmitBillingStatementsReq) Decompress() (err error) {
+	if r.Encoding != CompressionNone {
+		if err = decompressPayload(
+			r.Encoding, r.Compressed, MaxBillingBatchDecompressedSize, &r.Statements,
+		); err != nil {
+			return
+		}
+		r.Encoding, r.Compressed = CompressionNone, nil
+	}
+	if len(r.Statements) > MaxBillingBatchStatements {
+		return errors.Wrapf(ErrBillingBatchTooLarge,
+			"%d statements, limit: %d", len(r.Statements), MaxBillingBatchStatements)
+	}
+	return
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+)
+
+func TestPayloadCompression(t *testing.T) {
+	Convey("Given a large request and response", t, func() {
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		var (
+			value = strings.Repeat("SQLess", 1024)
+			req   = &Request{
+				Payload: RequestPayload{Queries: []Query{
+					{Pattern: "INSERT INTO t VALUES(?)", Args: []NamedArg{{Value: value}}},
+				}},
+			}
+			resp = &Response{
+				Payload: ResponsePayload{
+					Columns:   []string{"v"},
+					DeclTypes: []string{"TEXT"},
+					Rows:      []ResponseRow{{Values: []interface{}{value}}},
+				},
+			}
+		)
+		So(req.Sign(priv), ShouldBeNil)
+		So(resp.BuildHash(), ShouldBeNil)
+
+		Convey("The payloads should survive the compression round trip", func() {
+			So(req.Compress(CompressionDeflate), ShouldBeNil)
+			So(req.Encoding, ShouldEqual, CompressionDeflate)
+			So(len(req.Compressed), ShouldBeLessThan, len(value))
+			So(req.Payload.Queries, ShouldBeEmpty)
+			So(req.Decompress(), ShouldBeNil)
+			So(req.Verify(), ShouldBeNil)
+			So(req.Payload.Queries[0].Args[0].Value, ShouldEqual, value)
+
+			So(resp.Compress(CompressionDeflate), ShouldBeNil)
+			So(resp.Encoding, ShouldEqual, CompressionDeflate)
+			So(resp.Decompress(), ShouldBeNil)
+			So(resp.VerifyHash(), ShouldBeNil)
+			So(resp.Payload.Rows[0].Values[0], ShouldResemble, value)
+		})
+		Convey("Oversized payloads should be refused", func() {
+			So(req.Compress(CompressionDeflate), ShouldBeNil)
+			defer func(limit int64) { MaxDecompressedSize = limit }(MaxDecompressedSize)
+			MaxDecompressedSize = int64(len(value)) / 2
+			So(errors.Cause(req.Decompress()), ShouldEqual, ErrPayloadTooLarge)
+		})
+		Convey("Oversized billing statement batches should be refused", func() {
+			var batch = &SubmitBillingStatementsReq{
+				Statements: make([]SignedBillingStatement, MaxBillingBatchStatements+1),
+			}
+			So(errors.Cause(batch.Decompress()), ShouldEqual, ErrBillingBatchTooLarge)
+			batch.Statements = batch.Statements[:MaxBillingBatchStatements]
+			So(batch.Compress(CompressionDeflate), ShouldBeNil)
+			So(batch.Encoding, ShouldEqual, CompressionDeflate)
+			var limit = MaxBillingBatchDecompressedSize
+			defer func() { MaxBillingBatchDecompressedSize = limit }()
+			MaxBillingBatchDecompressedSize = int64(len(batch.Compressed))
+			So(errors.Cause(batch.Decompress()), ShouldEqual, ErrPayloadTooLarge)
+			MaxBillingBatchDecompressedSize = limit
+			So(batch.Decompress(), ShouldBeNil)
+			So(batch.Statements, ShouldHaveLength, MaxBillingBatchStatements)
+		})
+		Convey("Small or unaccepted payloads should be sent as is", func() {
+			So(req.Compress(CompressionNone), ShouldBeNil)
+			So(req.Encoding, ShouldEqual, CompressionNone)
+			small := &Response{Payload: ResponsePayload{Columns: []string{"v"}}}
+			So(small.Compress(CompressionDeflate), ShouldBeNil)
+			So(small.Encoding, ShouldEqual, CompressionNone)
+			So(small.Payload.Columns, ShouldResemble, []string{"v"})
+		})
+	})
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ConsistencyPreset defines a named combination of the consistency related database settings.
+type ConsistencyPreset string
+
+const (
+	// ConsistencyStrong serves serializable reads on the leader only, writes are acknowledged
+	// by all replicas.
+	ConsistencyStrong ConsistencyPreset = "strong"
+	// ConsistencySession serves snapshot reads on followers within a bounded staleness, writes
+	// are acknowledged by the majority of replicas.
+	ConsistencySession ConsistencyPreset = "session"
+	// ConsistencyEventual serves reads on any replica regardless of staleness, writes are
+	// replicated asynchronously.
+	ConsistencyEventual ConsistencyPreset = "eventual"
+)
+
+// DefaultSessionReadStaleness defines the max head lag of followers serving reads in the
+// session consistency preset.
+const DefaultSessionReadStaleness = 10 * time.Second
+
+// ConsistencySettings defines the low-level database settings configured by a preset.
+type ConsistencySettings struct {
+	UseEventualConsistency bool
+	ConsistencyLevel       float64
+	IsolationLevel         int
+	LeaderReadsOnly        bool
+	MaxReadStaleness       time.Duration
+	WriteAck               WriteAck
+}
+
+// Settings returns the low-level settings of the consistency preset.
+func (p ConsistencyPreset) Settings() (s ConsistencySettings, err error) {
+	switch p {
+	case ConsistencyStrong:
+		s = ConsistencySettings{
+			ConsistencyLevel: 1.0,
+			IsolationLevel:   int(sql.LevelSerializable),
+			LeaderReadsOnly:  true,
+			WriteAck:         WriteAckAll,
+		}
+	case ConsistencySession:
+		s = ConsistencySettings{
+			ConsistencyLevel: 1.0,
+			IsolationLevel:   int(sql.LevelSnapshot),
+			MaxReadStaleness: DefaultSessionReadStaleness,
+			WriteAck:         WriteAckQuorum,
+		}
+	case ConsistencyEventual:
+		s = ConsistencySettings{
+			UseEventualConsistency: true,
+			IsolationLevel:         int(sql.LevelReadUncommitted),
+		}
+	default:
+		err = errors.Wrapf(ErrUnknownConsistencyPreset, "preset %q", string(p))
+	}
+	return
+}
+
+// ApplyConsistencyPreset overrides the consistency related settings with the named preset of
+// the resource meta, the resource meta is left untouched if no preset is set.
+func (m *ResourceMeta) ApplyConsistencyPreset() (err error) {
+	if m.ConsistencyPreset == "" {
+		return
+	}
+	var s ConsistencySettings
+	if s, err = ConsistencyPreset(m.ConsistencyPreset).Settings(); err != nil {
+		return
+	}
+	m.UseEventualConsistency = s.UseEventualConsistency
+	m.ConsistencyLevel = s.ConsistencyLevel
+	m.IsolationLevel = s.IsolationLevel
+	m.LeaderReadsOnly = s.LeaderReadsOnly
+	m.MaxReadStaleness = s.MaxReadStaleness
+	m.WriteAck = s.WriteAck
+	return
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestApplyConsistencyPreset(t *testing.T) {
+	Convey("test apply consistency preset", t, func() {
+		Convey("meta without preset should be untouched", func() {
+			meta := ResourceMeta{
+				UseEventualConsistency: true,
+				ConsistencyLevel:       0.5,
+				IsolationLevel:         int(sql.LevelReadCommitted),
+			}
+			expected := meta
+			So(meta.ApplyConsistencyPreset(), ShouldBeNil)
+			So(meta, ShouldResemble, expected)
+		})
+		Convey("strong preset should serve reads on leader only", func() {
+			meta := ResourceMeta{
+				ConsistencyPreset:      string(ConsistencyStrong),
+				UseEventualConsistency: true,
+				MaxReadStaleness:       time.Minute,
+			}
+			So(meta.ApplyConsistencyPreset(), ShouldBeNil)
+			So(meta.UseEventualConsistency, ShouldBeFalse)
+			So(meta.ConsistencyLevel, ShouldEqual, 1.0)
+			So(meta.IsolationLevel, ShouldEqual, int(sql.LevelSerializable))
+			So(meta.LeaderReadsOnly, ShouldBeTrue)
+			So(meta.WriteAck, ShouldEqual, WriteAckAll)
+			So(meta.MaxReadStaleness, ShouldEqual, time.Duration(0))
+		})
+		Convey("session preset should bound follower staleness", func() {
+			meta := ResourceMeta{ConsistencyPreset: string(ConsistencySession)}
+			So(meta.ApplyConsistencyPreset(), ShouldBeNil)
+			So(meta.UseEventualConsistency, ShouldBeFalse)
+			So(meta.IsolationLevel, ShouldEqual, int(sql.LevelSnapshot))
+			So(meta.LeaderReadsOnly, ShouldBeFalse)
+			So(meta.MaxReadStaleness, ShouldEqual, DefaultSessionReadStaleness)
+			So(meta.WriteAck, ShouldEqual, WriteAckQuorum)
+		})
+		Convey("eventual preset should replicate asynchronously", func() {
+			meta := ResourceMeta{
+				ConsistencyPreset: string(ConsistencyEventual),
+				LeaderReadsOnly:   true,
+			}
+			So(meta.ApplyConsistencyPreset(), ShouldBeNil)
+			So(meta.UseEventualConsistency, ShouldBeTrue)
+			So(meta.IsolationLevel, ShouldEqual, int(sql.LevelReadUncommitted))
+			So(meta.LeaderReadsOnly, ShouldBeFalse)
+			So(meta.MaxReadStaleness, ShouldEqual, time.Duration(0))
+		})
+		Convey("unknown preset should be rejected", func() {
+			meta := ResourceMeta{ConsistencyPreset: "linearizable"}
+			err := meta.ApplyConsistencyPreset()
+			So(errors.Cause(err), ShouldEqual, ErrUnknownConsistencyPreset)
+		})
+	})
+}
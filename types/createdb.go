@@ -61,6 +61,11 @@ func (cd *CreateDatabase) Sign(signer *asymmetric.PrivateKey) (err error) {
 	return cd.DefaultHashSignVerifierImpl.Sign(&cd.CreateDatabaseHeader, signer)
 }
 
+// SignWith signs the CreateDatabase with the signer backend.
+func (cd *CreateDatabase) SignWith(signer asymmetric.Signer) (err error) {
+	return cd.DefaultHashSignVerifierImpl.SignWith(&cd.CreateDatabaseHeader, signer)
+}
+
 // Verify implements interfaces/Transaction.Verify.
 func (cd *CreateDatabase) Verify() error {
 	return cd.DefaultHashSignVerifierImpl.Verify(&cd.CreateDatabaseHeader)
@@ -0,0 +1,182 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// DatasetVersion defines a read-only dataset version published on chain, third parties verify
+// the received dataset file against the content hash.
+type DatasetVersion struct {
+	Version     uint32
+	ContentHash hash.Hash // content hash of the dataset file
+	Size        uint64
+	BlockHash   hash.Hash // sqlchain head block hash the dataset is exported at
+	Height      int32     // sqlchain head height the dataset is exported at
+	Published   uint32    // block producer height the version is published at
+}
+
+// DatasetProfile defines all the dataset versions published for a database.
+type DatasetProfile struct {
+	DatabaseID proto.DatabaseID
+	Owner      proto.AccountAddress
+	Versions   []*DatasetVersion
+}
+
+// Latest returns the latest published version, or nil if none is published.
+func (p *DatasetProfile) Latest() *DatasetVersion {
+	if len(p.Versions) == 0 {
+		return nil
+	}
+	return p.Versions[len(p.Versions)-1]
+}
+
+// Get returns the published version, the latest version is returned if version is 0.
+func (p *DatasetProfile) Get(version uint32) *DatasetVersion {
+	if version == 0 {
+		return p.Latest()
+	}
+	for _, v := range p.Versions {
+		if v.Version == version {
+			return v
+		}
+	}
+	return nil
+}
+
+// PublishDatasetHeader defines the dataset publishing transaction header.
+type PublishDatasetHeader struct {
+	DatabaseID  proto.DatabaseID
+	ContentHash hash.Hash
+	Size        uint64
+	BlockHash   hash.Hash
+	Height      int32
+	Nonce       pi.AccountNonce
+}
+
+// PublishDataset defines the dataset publishing transaction, which records the content hash of
+// a database snapshot prepared by the miners on chain.
+type PublishDataset struct {
+	PublishDatasetHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewPublishDataset returns new instance.
+func NewPublishDataset(header *PublishDatasetHeader) *PublishDataset {
+	return &PublishDataset{
+		PublishDatasetHeader: *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypePublishDataset),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (pd *PublishDataset) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(pd.Signee)
+	return addr
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (pd *PublishDataset) GetAccountNonce() pi.AccountNonce {
+	return pd.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (pd *PublishDataset) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return pd.DefaultHashSignVerifierImpl.Sign(&pd.PublishDatasetHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (pd *PublishDataset) Verify() (err error) {
+	return pd.DefaultHashSignVerifierImpl.Verify(&pd.PublishDatasetHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypePublishDataset, (*PublishDataset)(nil))
+}
+
+// QueryDatasetReq defines a request of the QueryDataset RPC method.
+type QueryDatasetReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+}
+
+// QueryDatasetResp defines a response of the QueryDataset RPC method.
+type QueryDatasetResp struct {
+	proto.Envelope
+	Profile DatasetProfile
+}
+
+// PrepareDatasetHeader defines the header of a dataset preparing request.
+type PrepareDatasetHeader struct {
+	DatabaseID proto.DatabaseID
+	Timestamp  time.Time
+}
+
+// SignedPrepareDatasetHeader defines the owner signed header of a dataset preparing request.
+type SignedPrepareDatasetHeader struct {
+	PrepareDatasetHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the prepare dataset header.
+func (sh *SignedPrepareDatasetHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.PrepareDatasetHeader, signer)
+}
+
+// Verify checks hash and signature in the prepare dataset header.
+func (sh *SignedPrepareDatasetHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.PrepareDatasetHeader)
+}
+
+// PrepareDatasetReq defines a request of the PrepareDataset RPC method, the miner exports a
+// snapshot of the database and keeps serving it as a dataset.
+type PrepareDatasetReq struct {
+	proto.Envelope
+	Header SignedPrepareDatasetHeader
+}
+
+// PrepareDatasetResp defines a response of the PrepareDataset RPC method.
+type PrepareDatasetResp struct {
+	proto.Envelope
+	Info SnapshotInfo
+}
+
+// FetchDatasetChunkReq defines a request of the FetchDatasetChunk RPC method.
+type FetchDatasetChunkReq struct {
+	proto.Envelope
+	DatabaseID  proto.DatabaseID
+	ContentHash hash.Hash
+	Offset      uint64
+}
+
+// FetchDatasetChunkResp defines a response of the FetchDatasetChunk RPC method.
+type FetchDatasetChunkResp struct {
+	proto.Envelope
+	Size uint64
+	Data []byte
+}
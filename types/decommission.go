@@ -0,0 +1,82 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package types
+
+import (
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// DecommissionMinerHeader defines the miner decommission transaction header.
+type DecommissionMinerHeader struct {
+	// Finalize completes the decommission announced before, the miner leaves its databases and
+	// the deposits are returned.
+	Finalize bool
+	Nonce    pi.AccountNonce
+}
+
+// DecommissionMiner defines the miner decommission transaction. The miner announces its
+// departure first, the block producers stop matching it for new databases and add a replacement
+// miner to each database it serves, which restores a replica from the serving miners. The miner
+// finalizes the departure once the billing of the databases is settled.
+type DecommissionMiner struct {
+	DecommissionMinerHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewDecommissionMiner returns new instance.
+func NewDecommissionMiner(header *DecommissionMinerHeader) *DecommissionMiner {
+	return &DecommissionMiner{
+		DecommissionMinerHeader: *header,
+		TransactionTypeMixin:    *pi.NewTransactionTypeMixin(pi.TransactionTypeDecommissionMiner),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (dm *DecommissionMiner) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(dm.Signee)
+	return addr
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (dm *DecommissionMiner) GetAccountNonce() pi.AccountNonce {
+	return dm.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (dm *DecommissionMiner) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return dm.DefaultHashSignVerifierImpl.Sign(&dm.DecommissionMinerHeader, signer)
+}
+
+// SignWith signs the DecommissionMiner with the signer backend.
+func (dm *DecommissionMiner) SignWith(signer asymmetric.Signer) (err error) {
+	return dm.DefaultHashSignVerifierImpl.SignWith(&dm.DecommissionMinerHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (dm *DecommissionMiner) Verify() (err error) {
+	return dm.DefaultHashSignVerifierImpl.Verify(&dm.DecommissionMinerHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeDecommissionMiner, (*DecommissionMiner)(nil))
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// TableDigest defines the deterministic digest of a table.
+type TableDigest struct {
+	Table string
+	Rows  uint64
+	Hash  hash.Hash
+}
+
+// StateDigest defines the deterministic digest of a database state at a write sequence, which
+// is the same on all replicas applying the same writes.
+type StateDigest struct {
+	Seq    uint64
+	Tables []TableDigest
+	Root   hash.Hash
+}
+
+// StateDigestReq defines a request of the StateDigest RPC method.
+type StateDigestReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+	Seq        uint64 // 0 for the latest digest
+}
+
+// StateDigestResp defines a response of the StateDigest RPC method.
+type StateDigestResp struct {
+	proto.Envelope
+	Found     bool
+	Digest    StateDigest
+	Divergent []proto.NodeID // replicas known to be divergent by the responding miner
+}
@@ -34,4 +34,29 @@ var (
 	ErrHashVerification = errors.New("hash verification failed")
 	// ErrInvalidGenesis indicates a failed genesis block verification.
 	ErrInvalidGenesis = errors.New("invalid genesis block")
+	// ErrUnknownConsistencyPreset indicates that the database consistency preset is unknown.
+	ErrUnknownConsistencyPreset = errors.New("unknown consistency preset")
+	// ErrUnknownWriteAck indicates that the write ack level is unknown.
+	ErrUnknownWriteAck = errors.New("unknown write ack")
+	// ErrUnknownQueryRuleAction indicates that the action of the query rule is unknown.
+	ErrUnknownQueryRuleAction = errors.New("unknown query rule action")
+	// ErrReceiptNotMatch indicates that the receipt proof doesn't match the receipt.
+	ErrReceiptNotMatch = errors.New("receipt proof doesn't match")
+	// ErrHeaderChainBroken indicates that the block headers are not linked by the parent hashes.
+	ErrHeaderChainBroken = errors.New("block header chain broken")
+	// ErrInvalidName indicates that the name to register is malformed.
+	ErrInvalidName = errors.New("invalid name")
+	// ErrInvalidMultiSigPolicy indicates that the threshold or the members of the multi-signature
+	// policy are invalid.
+	ErrInvalidMultiSigPolicy = errors.New("invalid multi-signature policy")
+	// ErrMultiSigNotSupported indicates that the transaction can not be sent by a multi-signature
+	// account.
+	ErrMultiSigNotSupported = errors.New("transaction not supported by multi-signature account")
+	// ErrMultiSigSignerNotMember indicates that the signer is not a member of the multi-signature
+	// account.
+	ErrMultiSigSignerNotMember = errors.New("signer is not a member of multi-signature account")
+	// ErrMultiSigThreshold indicates that the multi-signature transaction has not enough signatures.
+	ErrMultiSigThreshold = errors.New("not enough signatures of multi-signature account")
+	// ErrBillingBatchTooLarge indicates that the billing statement batch exceeds the size limits.
+	ErrBillingBatchTooLarge = errors.New("billing statement batch too large")
 )
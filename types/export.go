@@ -0,0 +1,90 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// ExportDatabaseHeader defines the header of an export database request, the exported file is
+// transferred in chunks. A new export is prepared if the export id is empty.
+type ExportDatabaseHeader struct {
+	DatabaseID proto.DatabaseID
+	ExportID   hash.Hash // file hash of the export to continue
+	Offset     uint64
+}
+
+// SignedExportDatabaseHeader defines the signed header of an export database request.
+type SignedExportDatabaseHeader struct {
+	ExportDatabaseHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the export database header.
+func (sh *SignedExportDatabaseHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.ExportDatabaseHeader, signer)
+}
+
+// Verify checks hash and signature in the export database header.
+func (sh *SignedExportDatabaseHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.ExportDatabaseHeader)
+}
+
+// ExportDatabaseReq defines a request of the ExportDatabase RPC method.
+type ExportDatabaseReq struct {
+	proto.Envelope
+	Header SignedExportDatabaseHeader
+}
+
+// ExportHeader defines the header of an exported database file.
+type ExportHeader struct {
+	DatabaseID proto.DatabaseID
+	NodeID     proto.NodeID // miner which exported the file
+	BlockHash  hash.Hash    // head block hash the exported state is based on
+	Height     int32        // head block height the exported state is based on
+	FileHash   hash.Hash    // content hash of the exported file
+	Size       uint64
+}
+
+// SignedExportHeader defines the miner signed header of an exported database file.
+type SignedExportHeader struct {
+	ExportHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the export header.
+func (sh *SignedExportHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.ExportHeader, signer)
+}
+
+// Verify checks hash and signature in the export header.
+func (sh *SignedExportHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.ExportHeader)
+}
+
+// ExportDatabaseResp defines a response of the ExportDatabase RPC method, the data is the chunk
+// of the exported file at the requested offset.
+type ExportDatabaseResp struct {
+	proto.Envelope
+	Header SignedExportHeader
+	Data   []byte
+}
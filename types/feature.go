@@ -0,0 +1,72 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// MinerBuildInfoReq defines a request of the BuildInfo RPC method.
+type MinerBuildInfoReq struct {
+	proto.Envelope
+}
+
+// MinerBuildInfoResp defines a response of the BuildInfo RPC method.
+type MinerBuildInfoResp struct {
+	proto.Envelope
+	Build proto.BuildInfo
+}
+
+// CheckFeatureHeader defines the header of a feature readiness check request.
+type CheckFeatureHeader struct {
+	DatabaseID proto.DatabaseID
+	Feature    string
+}
+
+// SignedCheckFeatureHeader defines the signed header of a feature readiness check request.
+type SignedCheckFeatureHeader struct {
+	CheckFeatureHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the check feature header.
+func (sh *SignedCheckFeatureHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.CheckFeatureHeader, signer)
+}
+
+// Verify checks hash and signature in the check feature header.
+func (sh *SignedCheckFeatureHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.CheckFeatureHeader)
+}
+
+// CheckFeatureReq defines a request of the CheckFeature RPC method.
+type CheckFeatureReq struct {
+	proto.Envelope
+	Header SignedCheckFeatureHeader
+}
+
+// CheckFeatureResp defines a response of the CheckFeature RPC method.
+type CheckFeatureResp struct {
+	proto.Envelope
+	Ready      bool
+	MinVersion string         // minimum version running in the miner group
+	Missing    []proto.NodeID // miners not ready for the feature or unreachable
+}
@@ -17,6 +17,8 @@
 package types
 
 import (
+	"time"
+
 	"github.com/SQLess/SQLess/crypto/asymmetric"
 	"github.com/SQLess/SQLess/crypto/verifier"
 	"github.com/SQLess/SQLess/proto"
@@ -40,6 +42,14 @@ type ResourceMeta struct {
 	UseEventualConsistency bool                   // use eventual consistency replication if enabled
 	ConsistencyLevel       float64                // customized strong consistency level
 	IsolationLevel         int                    // customized isolation level
+	StatementTimeout       time.Duration          // default statement timeout, 0 for unlimited
+	ForeignKeys            bool                   // enforce foreign key constraints
+	ConsistencyPreset      string                 // named consistency preset, overrides the knobs above
+	LeaderReadsOnly        bool                   // serve read queries on leader only
+	MaxReadStaleness       time.Duration          // max head lag of followers serving reads, 0 for unlimited
+	WriteAck               WriteAck               // replica acknowledgements required by writes
+	StandbyNode            proto.NodeID           // standby miner outside the group receiving shipped snapshots
+	SnapshotShipInterval   time.Duration          // interval of snapshot shipping to the standby miner
 }
 
 // ServiceInstance defines single instance to be initialized.
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// MigrationDryRunHeader defines the header of a migration dry-run request.
+type MigrationDryRunHeader struct {
+	DatabaseID proto.DatabaseID
+	Queries    []Query
+	Timestamp  time.Time
+}
+
+// SignedMigrationDryRunHeader defines the signed header of a migration dry-run request.
+type SignedMigrationDryRunHeader struct {
+	MigrationDryRunHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the migration dry-run header.
+func (sh *SignedMigrationDryRunHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.MigrationDryRunHeader, signer)
+}
+
+// Verify checks hash and signature in the migration dry-run header.
+func (sh *SignedMigrationDryRunHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.MigrationDryRunHeader)
+}
+
+// MigrationDryRunReq defines a request of the MigrationDryRun RPC method.
+type MigrationDryRunReq struct {
+	proto.Envelope
+	Header SignedMigrationDryRunHeader
+}
+
+// MigrationEstimate defines the estimate of a single migration statement.
+type MigrationEstimate struct {
+	Query        string
+	Duration     time.Duration // execution time on the shadow copy
+	RowsScanned  uint64        // rows of the existing tables referenced by the statement
+	AffectedRows uint64
+	Rewrite      bool // whether the statement rewrites every row of the referenced tables
+	Cost         uint64
+}
+
+// MigrationDryRunResp defines a response of the MigrationDryRun RPC method.
+type MigrationDryRunResp struct {
+	proto.Envelope
+	BlockHash    hash.Hash // head block hash the shadow copy is based on
+	Height       int32     // head block height the shadow copy is based on
+	Estimates    []MigrationEstimate
+	LockDuration time.Duration // writes of the database are blocked during the whole migration
+	GasPrice     uint64
+	Cost         uint64 // projected token cost, billed as affected rows times gas price
+}
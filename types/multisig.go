@@ -0,0 +1,411 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// MaxMultiSigMembers is the max members of a multi-signature account.
+const MaxMultiSigMembers = 16
+
+// multiSigAddressPrefix separates the multi-signature account addresses from the addresses
+// hashed from single public keys.
+var multiSigAddressPrefix = []byte("multisig")
+
+// MultiSigPolicy defines the m-of-n policy of a multi-signature account, the transactions of the
+// account require the signatures of Threshold members out of PubKeys. The account address is
+// derived from the policy, see Address.
+type MultiSigPolicy struct {
+	Threshold uint32
+	PubKeys   []*asymmetric.PublicKey
+}
+
+// Validate checks the threshold and the members of the policy.
+func (p *MultiSigPolicy) Validate() (err error) {
+	if len(p.PubKeys) == 0 || len(p.PubKeys) > MaxMultiSigMembers {
+		return errors.Wrapf(ErrInvalidMultiSigPolicy, "%d members", len(p.PubKeys))
+	}
+	if p.Threshold == 0 || int(p.Threshold) > len(p.PubKeys) {
+		return errors.Wrapf(ErrInvalidMultiSigPolicy,
+			"threshold %d of %d members", p.Threshold, len(p.PubKeys))
+	}
+	for i, k := range p.PubKeys {
+		if k == nil {
+			return errors.Wrapf(ErrInvalidMultiSigPolicy, "empty member %d", i)
+		}
+		if p.member(k) != i {
+			return errors.Wrapf(ErrInvalidMultiSigPolicy, "duplicate member %d", i)
+		}
+	}
+	return
+}
+
+// Address returns the account address of the policy, it does not depend on the member order.
+func (p *MultiSigPolicy) Address() (addr proto.AccountAddress, err error) {
+	if err = p.Validate(); err != nil {
+		return
+	}
+	var keys = make([][]byte, len(p.PubKeys))
+	for i, k := range p.PubKeys {
+		keys[i] = k.Serialize()
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+
+	var buf = bytes.NewBuffer(append([]byte{}, multiSigAddressPrefix...))
+	_ = binary.Write(buf, binary.BigEndian, p.Threshold)
+	for _, k := range keys {
+		buf.Write(k)
+	}
+	addr = proto.AccountAddress(hash.THashH(buf.Bytes()))
+	return
+}
+
+// member returns the index of the public key in the policy, or -1 if it is not a member.
+func (p *MultiSigPolicy) member(pub *asymmetric.PublicKey) int {
+	for i, k := range p.PubKeys {
+		if k != nil && k.IsEqual(pub) {
+			return i
+		}
+	}
+	return -1
+}
+
+// multiSigPolicyJSON is the JSON form of MultiSigPolicy with hex encoded public keys.
+type multiSigPolicyJSON struct {
+	Threshold uint32
+	PubKeys   []string
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (p MultiSigPolicy) MarshalJSON() ([]byte, error) {
+	var v = multiSigPolicyJSON{
+		Threshold: p.Threshold,
+		PubKeys:   make([]string, len(p.PubKeys)),
+	}
+	for i, k := range p.PubKeys {
+		if k != nil {
+			v.PubKeys[i] = hex.EncodeToString(k.Serialize())
+		}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (p *MultiSigPolicy) UnmarshalJSON(data []byte) (err error) {
+	var v multiSigPolicyJSON
+	if err = json.Unmarshal(data, &v); err != nil {
+		return
+	}
+	p.Threshold, p.PubKeys = v.Threshold, make([]*asymmetric.PublicKey, len(v.PubKeys))
+	for i, s := range v.PubKeys {
+		if p.PubKeys[i], err = parseHexPubKey(s); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// MultiSigSignature defines a member signature of the multi-signature transaction.
+type MultiSigSignature struct {
+	Signee    *asymmetric.PublicKey
+	Signature *asymmetric.Signature
+}
+
+// multiSigSignatureJSON is the JSON form of MultiSigSignature with hex encoded fields.
+type multiSigSignatureJSON struct {
+	Signee    string
+	Signature string
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (s MultiSigSignature) MarshalJSON() ([]byte, error) {
+	var v multiSigSignatureJSON
+	if s.Signee != nil {
+		v.Signee = hex.EncodeToString(s.Signee.Serialize())
+	}
+	if s.Signature != nil {
+		v.Signature = hex.EncodeToString(s.Signature.Serialize())
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (s *MultiSigSignature) UnmarshalJSON(data []byte) (err error) {
+	var (
+		v   multiSigSignatureJSON
+		buf []byte
+	)
+	if err = json.Unmarshal(data, &v); err != nil {
+		return
+	}
+	if s.Signee, err = parseHexPubKey(v.Signee); err != nil {
+		return
+	}
+	if buf, err = hex.DecodeString(v.Signature); err != nil {
+		return
+	}
+	s.Signature, err = asymmetric.ParseSignature(buf)
+	return
+}
+
+// parseHexPubKey parses the hex encoded public key.
+func parseHexPubKey(s string) (pub *asymmetric.PublicKey, err error) {
+	var buf []byte
+	if buf, err = hex.DecodeString(s); err != nil {
+		return
+	}
+	return asymmetric.ParsePubKey(buf)
+}
+
+// MultiSigHeader defines the multi-signature transaction header.
+type MultiSigHeader struct {
+	Policy     MultiSigPolicy
+	Tx         pi.TransactionWrapper
+	Signatures []*MultiSigSignature
+}
+
+// MultiSig defines the multi-signature transaction, which sends the wrapped transaction on behalf
+// of the multi-signature account of the policy. The members sign the hash of the wrapped
+// transaction bound to the account, see SigningHash. Transfer, CreateDatabase and UpdatePermission are supported.
+type MultiSig struct {
+	MultiSigHeader
+	pi.TransactionTypeMixin
+	DataHash hash.Hash
+}
+
+// hashSetter is implemented by the transactions embedding DefaultHashSignVerifierImpl.
+type hashSetter interface {
+	SetHash(verifier.MarshalHasher) error
+	VerifyHash(verifier.MarshalHasher) error
+}
+
+// multiSigPayload returns the signed header of the transaction supported by the multi-signature
+// accounts, and checks the account declared by the transaction if any.
+func multiSigPayload(tx pi.Transaction, addr proto.AccountAddress) (mh verifier.MarshalHasher, err error) {
+	var declared = addr
+	switch t := tx.(type) {
+	case *Transfer:
+		mh, declared = &t.TransferHeader, t.Sender
+	case *TransferBatch:
+		mh, declared = &t.TransferBatchHeader, t.Sender
+	case *CreateDatabase:
+		mh, declared = &t.CreateDatabaseHeader, t.Owner
+	case *UpdatePermission:
+		mh = &t.UpdatePermissionHeader
+	default:
+		err = errors.Wrapf(ErrMultiSigNotSupported, "transaction type %s", tx.GetTransactionType())
+		return
+	}
+	if declared != addr {
+		err = errors.Wrapf(ErrMultiSigNotSupported,
+			"transaction of account %s sent by multi-signature account %s", declared, addr)
+	}
+	return
+}
+
+// NewMultiSig returns new instance wrapping the transaction of the multi-signature account, the
+// nonce of the transaction should be the next nonce of the account.
+func NewMultiSig(policy *MultiSigPolicy, tx pi.Transaction) (ms *MultiSig, err error) {
+	var (
+		addr proto.AccountAddress
+		mh   verifier.MarshalHasher
+	)
+	if addr, err = policy.Address(); err != nil {
+		return
+	}
+	if mh, err = multiSigPayload(tx, addr); err != nil {
+		return
+	}
+	if err = tx.(hashSetter).SetHash(mh); err != nil {
+		return
+	}
+	ms = &MultiSig{
+		MultiSigHeader: MultiSigHeader{
+			Policy: *policy,
+			Tx:     pi.TransactionWrapper{Transaction: tx},
+		},
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeMultiSig),
+	}
+	err = ms.setHash()
+	return
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (ms *MultiSig) GetAccountAddress() proto.AccountAddress {
+	addr, _ := ms.Policy.Address()
+	return addr
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (ms *MultiSig) GetAccountNonce() pi.AccountNonce {
+	if ms.Tx.Transaction == nil {
+		return 0
+	}
+	return ms.Tx.GetAccountNonce()
+}
+
+// Hash implements interfaces/Transaction.Hash.
+func (ms *MultiSig) Hash() hash.Hash {
+	return ms.DataHash
+}
+
+// SigningHash returns the hash signed by the members, which binds the hash of the wrapped
+// transaction to the account address of the policy, so that the signatures can not be replayed
+// with another policy sharing the members.
+func (ms *MultiSig) SigningHash() hash.Hash {
+	if ms.Tx.Transaction == nil {
+		return hash.Hash{}
+	}
+	addr, err := ms.Policy.Address()
+	if err != nil {
+		return hash.Hash{}
+	}
+	var (
+		txHash = ms.Tx.Hash()
+		buf    = make([]byte, 0, len(multiSigAddressPrefix)+2*hash.HashSize)
+	)
+	buf = append(buf, multiSigAddressPrefix...)
+	buf = append(buf, addr[:]...)
+	buf = append(buf, txHash[:]...)
+	return hash.THashH(buf)
+}
+
+// Sign implements interfaces/Transaction.Sign, it adds the signature of the member.
+func (ms *MultiSig) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return ms.SignWith(signer)
+}
+
+// SignWith adds the signature of the member with the signer backend.
+func (ms *MultiSig) SignWith(signer asymmetric.Signer) (err error) {
+	var (
+		h   = ms.SigningHash()
+		sig *asymmetric.Signature
+	)
+	if ms.Policy.member(signer.PubKey()) < 0 {
+		return errors.Wrap(ErrMultiSigSignerNotMember, "sign multi-signature transaction")
+	}
+	if sig, err = signer.Sign(h[:]); err != nil {
+		return
+	}
+	return ms.AttachSignature(signer.PubKey(), sig)
+}
+
+// AttachSignature adds the signature of the member produced elsewhere, e.g. by an offline
+// signer, the previous signature of the member is replaced.
+func (ms *MultiSig) AttachSignature(signee *asymmetric.PublicKey, sig *asymmetric.Signature) (err error) {
+	var h = ms.SigningHash()
+	if signee == nil || ms.Policy.member(signee) < 0 {
+		return errors.Wrap(ErrMultiSigSignerNotMember, "attach multi-signature signature")
+	}
+	if sig == nil || !sig.Verify(h[:], signee) {
+		return errors.Wrap(ErrSignVerification, "attach multi-signature signature")
+	}
+	var signature = &MultiSigSignature{Signee: signee, Signature: sig}
+	for i, s := range ms.Signatures {
+		if s != nil && s.Signee != nil && s.Signee.IsEqual(signee) {
+			ms.Signatures[i] = signature
+			return ms.setHash()
+		}
+	}
+	ms.Signatures = append(ms.Signatures, signature)
+	return ms.setHash()
+}
+
+// Verify implements interfaces/Transaction.Verify, it checks the wrapped transaction and the
+// signatures of at least Threshold distinct members.
+func (ms *MultiSig) Verify() (err error) {
+	var (
+		addr proto.AccountAddress
+		mh   verifier.MarshalHasher
+	)
+	if err = ms.verifyHash(); err != nil {
+		return
+	}
+	if addr, err = ms.Policy.Address(); err != nil {
+		return
+	}
+	if ms.Tx.Transaction == nil {
+		return errors.Wrap(ErrMultiSigNotSupported, "empty transaction")
+	}
+	if mh, err = multiSigPayload(ms.Tx.Transaction, addr); err != nil {
+		return
+	}
+	if err = ms.Tx.Transaction.(hashSetter).VerifyHash(mh); err != nil {
+		return
+	}
+
+	var (
+		h      = ms.SigningHash()
+		signed = make(map[int]bool)
+	)
+	for _, s := range ms.Signatures {
+		if s == nil || s.Signee == nil || s.Signature == nil {
+			return errors.Wrap(ErrSignVerification, "empty multi-signature signature")
+		}
+		var i = ms.Policy.member(s.Signee)
+		if i < 0 {
+			return errors.Wrapf(ErrMultiSigSignerNotMember, "multi-signature account %s", addr)
+		}
+		if !s.Signature.Verify(h[:], s.Signee) {
+			return errors.Wrapf(ErrSignVerification, "member %d of multi-signature account %s", i, addr)
+		}
+		signed[i] = true
+	}
+	if len(signed) < int(ms.Policy.Threshold) {
+		return errors.Wrapf(ErrMultiSigThreshold,
+			"%d of %d signatures of multi-signature account %s", len(signed), ms.Policy.Threshold, addr)
+	}
+	return
+}
+
+func (ms *MultiSig) setHash() (err error) {
+	var enc []byte
+	if enc, err = ms.MultiSigHeader.MarshalHash(); err != nil {
+		return
+	}
+	ms.DataHash = hash.THashH(enc)
+	return
+}
+
+func (ms *MultiSig) verifyHash() (err error) {
+	var enc []byte
+	if enc, err = ms.MultiSigHeader.MarshalHash(); err != nil {
+		return
+	}
+	if h := hash.THashH(enc); !ms.DataHash.IsEqual(&h) {
+		err = errors.WithStack(verifier.ErrHashValueNotMatch)
+	}
+	return
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeMultiSig, (*MultiSig)(nil))
+}
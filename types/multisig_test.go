@@ -0,0 +1,144 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestMultiSig(t *testing.T) {
+	Convey("Given a 2-of-3 multi-signature policy", t, func() {
+		var (
+			privs  = make([]*asymmetric.PrivateKey, 4)
+			policy = &MultiSigPolicy{Threshold: 2}
+		)
+		for i := range privs {
+			priv, pub, err := asymmetric.GenSecp256k1KeyPair()
+			So(err, ShouldBeNil)
+			privs[i] = priv
+			if i < 3 {
+				policy.PubKeys = append(policy.PubKeys, pub)
+			}
+		}
+		addr, err := policy.Address()
+		So(err, ShouldBeNil)
+
+		Convey("The address should not depend on the member order", func() {
+			reordered := &MultiSigPolicy{
+				Threshold: 2,
+				PubKeys:   []*asymmetric.PublicKey{policy.PubKeys[2], policy.PubKeys[0], policy.PubKeys[1]},
+			}
+			raddr, err := reordered.Address()
+			So(err, ShouldBeNil)
+			So(raddr, ShouldEqual, addr)
+			reordered.Threshold = 3
+			raddr, err = reordered.Address()
+			So(err, ShouldBeNil)
+			So(raddr, ShouldNotEqual, addr)
+		})
+
+		Convey("The invalid policies should be rejected", func() {
+			for _, p := range []*MultiSigPolicy{
+				{Threshold: 0, PubKeys: policy.PubKeys},
+				{Threshold: 4, PubKeys: policy.PubKeys},
+				{Threshold: 1},
+				{Threshold: 1, PubKeys: []*asymmetric.PublicKey{policy.PubKeys[0], policy.PubKeys[0]}},
+			} {
+				_, err = p.Address()
+				So(errors.Cause(err), ShouldEqual, ErrInvalidMultiSigPolicy)
+			}
+		})
+
+		Convey("The transfer should be verified with enough member signatures", func() {
+			ms, err := NewMultiSig(policy, NewTransfer(&TransferHeader{
+				Sender: addr,
+				Nonce:  1,
+				Amount: 100,
+			}))
+			So(err, ShouldBeNil)
+			So(ms.GetAccountAddress(), ShouldEqual, addr)
+			So(ms.GetAccountNonce(), ShouldEqual, 1)
+			So(ms.GetTransactionType(), ShouldEqual, pi.TransactionTypeMultiSig)
+
+			So(errors.Cause(ms.Sign(privs[3])), ShouldEqual, ErrMultiSigSignerNotMember)
+			So(ms.Sign(privs[0]), ShouldBeNil)
+			So(errors.Cause(ms.Verify()), ShouldEqual, ErrMultiSigThreshold)
+			// signing again should not count twice
+			So(ms.Sign(privs[0]), ShouldBeNil)
+			So(ms.Signatures, ShouldHaveLength, 1)
+			So(errors.Cause(ms.Verify()), ShouldEqual, ErrMultiSigThreshold)
+
+			h := ms.Hash()
+			So(ms.Sign(privs[2]), ShouldBeNil)
+			So(ms.Hash(), ShouldNotResemble, h)
+			So(ms.Verify(), ShouldBeNil)
+
+			Convey("The transaction should survive JSON encoding", func() {
+				data, err := json.Marshal(&pi.TransactionWrapper{Transaction: ms})
+				So(err, ShouldBeNil)
+				var w pi.TransactionWrapper
+				So(json.Unmarshal(data, &w), ShouldBeNil)
+				decoded, ok := w.Unwrap().(*MultiSig)
+				So(ok, ShouldBeTrue)
+				So(decoded.Verify(), ShouldBeNil)
+				So(decoded.Hash(), ShouldResemble, ms.Hash())
+			})
+
+			Convey("The tampered transaction should be rejected", func() {
+				ms.Tx.Transaction.(*Transfer).Amount = 1000
+				So(ms.Verify(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("The signatures should not be replayed with another policy", func() {
+			// the 1-of-3 policy shares the members, the permission update does not declare
+			// the account, so the wrapped transactions are identical
+			var (
+				other  = &MultiSigPolicy{Threshold: 1, PubKeys: policy.PubKeys}
+				header = UpdatePermissionHeader{Permission: &UserPermission{}, Nonce: 1}
+			)
+			ms, err := NewMultiSig(policy, NewUpdatePermission(&header))
+			So(err, ShouldBeNil)
+			oms, err := NewMultiSig(other, NewUpdatePermission(&header))
+			So(err, ShouldBeNil)
+			So(oms.Tx.Hash(), ShouldResemble, ms.Tx.Hash())
+			So(oms.SigningHash(), ShouldNotResemble, ms.SigningHash())
+
+			So(ms.Sign(privs[0]), ShouldBeNil)
+			So(errors.Cause(oms.AttachSignature(
+				ms.Signatures[0].Signee, ms.Signatures[0].Signature,
+			)), ShouldEqual, ErrSignVerification)
+			oms.Signatures = ms.Signatures
+			So(oms.setHash(), ShouldBeNil)
+			So(errors.Cause(oms.Verify()), ShouldEqual, ErrSignVerification)
+		})
+
+		Convey("The transactions of other accounts should be rejected", func() {
+			_, err = NewMultiSig(policy, NewTransfer(&TransferHeader{Sender: proto.AccountAddress{}}))
+			So(errors.Cause(err), ShouldEqual, ErrMultiSigNotSupported)
+			_, err = NewMultiSig(policy, NewRevokeNode(&RevokeNodeHeader{}))
+			So(errors.Cause(err), ShouldEqual, ErrMultiSigNotSupported)
+		})
+	})
+}
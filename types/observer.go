@@ -16,9 +16,61 @@
 
 package types
 
+import (
+	"time"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
 const (
 	// ReplicateFromBeginning is the replication offset observes from genesis block.
 	ReplicateFromBeginning = int32(0)
 	// ReplicateFromNewest is the replication offset observes from block head of current node.
 	ReplicateFromNewest = int32(-1)
 )
+
+// ObserverQueryHeader defines the header of a read request served by the materialized replica
+// of an observer.
+type ObserverQueryHeader struct {
+	DatabaseID proto.DatabaseID
+	Queries    []Query
+	// MaxStaleness rejects the request if the last materialized block is older than it, 0 to
+	// accept any staleness.
+	MaxStaleness time.Duration
+	Timestamp    time.Time
+}
+
+// SignedObserverQueryHeader defines the user signed header of an observer read request, the
+// signee should have read permission on the database.
+type SignedObserverQueryHeader struct {
+	ObserverQueryHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the observer query header.
+func (sh *SignedObserverQueryHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.ObserverQueryHeader, signer)
+}
+
+// Verify checks hash and signature in the observer query header.
+func (sh *SignedObserverQueryHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.ObserverQueryHeader)
+}
+
+// ObserverQueryReq defines a read request served by the materialized replica of an observer.
+type ObserverQueryReq struct {
+	Header SignedObserverQueryHeader
+}
+
+// ObserverQueryResp defines a response of ObserverQueryReq, the replica is materialized to the
+// block of Count at least when the queries run.
+type ObserverQueryResp struct {
+	Count     int32
+	Height    int32
+	Timestamp time.Time // timestamp of the last materialized block
+	Payload   ResponsePayload
+}
@@ -38,6 +38,11 @@ type ProvideServiceHeader struct {
 	TokenType     TokenType
 	NodeID        proto.NodeID
 	Nonce         interfaces.AccountNonce
+	// ReservationFee is the Particle fee of reserving the capacity ahead of a database creation,
+	// the capacity is not reservable if it's zero.
+	ReservationFee uint64
+	// Build is the build info of the miner binary, e.g. conf.GetBuildInfo().
+	Build proto.BuildInfo
 }
 
 // GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// ProvisionRecord defines a used provisioning token recorded on chain.
+type ProvisionRecord struct {
+	Nonce  uint64
+	NodeID proto.NodeID
+	Issuer proto.AccountAddress
+	Height uint32
+}
+
+// ProvisionNodeHeader defines the node provisioning transaction header.
+type ProvisionNodeHeader struct {
+	Token  proto.ProvisionToken
+	NodeID proto.NodeID
+	Nonce  pi.AccountNonce
+}
+
+// ProvisionNode defines the node provisioning transaction, which is issued by the block
+// producer accepting a provisioning token so that the token can not be used again on any
+// other block producer.
+type ProvisionNode struct {
+	ProvisionNodeHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewProvisionNode returns new instance.
+func NewProvisionNode(header *ProvisionNodeHeader) *ProvisionNode {
+	return &ProvisionNode{
+		ProvisionNodeHeader:  *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeProvisionNode),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (pn *ProvisionNode) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(pn.Signee)
+	return addr
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (pn *ProvisionNode) GetAccountNonce() pi.AccountNonce {
+	return pn.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (pn *ProvisionNode) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return pn.DefaultHashSignVerifierImpl.Sign(&pn.ProvisionNodeHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (pn *ProvisionNode) Verify() (err error) {
+	if err = pn.Token.Verify(); err != nil {
+		return
+	}
+	return pn.DefaultHashSignVerifierImpl.Verify(&pn.ProvisionNodeHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeProvisionNode, (*ProvisionNode)(nil))
+}
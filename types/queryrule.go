@@ -0,0 +1,78 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// QueryRuleAction defines the action of a query rule.
+type QueryRuleAction int32
+
+const (
+	// DenyQuery rejects the matched statements.
+	DenyQuery QueryRuleAction = iota
+	// AllowQuery permits the matched statements, once any allow rule is defined, statements
+	// not matching any allow rule are rejected.
+	AllowQuery
+)
+
+// String implements the fmt.Stringer interface.
+func (a QueryRuleAction) String() string {
+	if a == AllowQuery {
+		return "allow"
+	}
+	return "deny"
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (a QueryRuleAction) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// UnmarshalJSON implements the json.Unmarshler interface.
+func (a *QueryRuleAction) UnmarshalJSON(data []byte) (err error) {
+	var s string
+	if err = json.Unmarshal(data, &s); err != nil {
+		return
+	}
+	switch strings.ToLower(s) {
+	case "deny":
+		*a = DenyQuery
+	case "allow":
+		*a = AllowQuery
+	default:
+		err = errors.Wrapf(ErrUnknownQueryRuleAction, "action %q", s)
+	}
+	return
+}
+
+// QueryRule defines a statement pattern rule attached to the permission of a grantee, e.g. deny
+// DELETE without WHERE, allow only SELECT on specific tables or deny DROP.
+type QueryRule struct {
+	Action QueryRuleAction `json:"action"`
+	// Statements are the statement kinds the rule applies to, e.g. SELECT, INSERT, UPDATE,
+	// DELETE, CREATE, DROP, ALTER; empty matches all kinds.
+	Statements []string `json:"statements,omitempty"`
+	// Tables are the table names the rule applies to, empty matches all tables.
+	Tables []string `json:"tables,omitempty"`
+	// WithoutWhere makes the rule only match UPDATE/DELETE statements without WHERE clause.
+	WithoutWhere bool `json:"without-where,omitempty"`
+}
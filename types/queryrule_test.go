@@ -0,0 +1,48 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQueryRuleAction(t *testing.T) {
+	Convey("test query rule action json encoding", t, func() {
+		for _, a := range []QueryRuleAction{DenyQuery, AllowQuery} {
+			data, err := json.Marshal(a)
+			So(err, ShouldBeNil)
+			var decoded QueryRuleAction
+			So(json.Unmarshal(data, &decoded), ShouldBeNil)
+			So(decoded, ShouldEqual, a)
+		}
+
+		var rule QueryRule
+		So(json.Unmarshal([]byte(`{"action":"ALLOW","statements":["SELECT"]}`), &rule), ShouldBeNil)
+		So(rule.Action, ShouldEqual, AllowQuery)
+		So(rule.Statements, ShouldResemble, []string{"SELECT"})
+
+		for _, data := range []string{`{"action":"alow"}`, `{"action":""}`} {
+			err := json.Unmarshal([]byte(data), &rule)
+			So(errors.Cause(err), ShouldEqual, ErrUnknownQueryRuleAction)
+		}
+		So(json.Unmarshal([]byte(`{"action":1}`), &rule), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/merkle"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// ReceiptHeader defines the receipt of an accepted write query.
+type ReceiptHeader struct {
+	DatabaseID   proto.DatabaseID
+	RequestHash  hash.Hash
+	ResponseHash hash.Hash
+	NodeID       proto.NodeID // the node executed the write
+	LogOffset    uint64
+	Height       int32 // head height when the write is accepted, it's packed in a later block
+	Timestamp    time.Time
+}
+
+// SignedReceiptHeader defines the receipt signed by the node executed the write.
+type SignedReceiptHeader struct {
+	ReceiptHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the receipt header.
+func (sh *SignedReceiptHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.ReceiptHeader, signer)
+}
+
+// Verify checks hash and signature in the receipt header.
+func (sh *SignedReceiptHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.ReceiptHeader)
+}
+
+// ReceiptProof defines the proof that a write query response is packed in a sqlchain block.
+type ReceiptProof struct {
+	Height      int32
+	Block       SignedHeader
+	Response    SignedResponseHeader
+	Index       int // merkle leaf index of the response in the block
+	MerkleProof []*hash.Hash
+}
+
+// Verify checks that the proof matches the receipt, the response is included in the block and
+// the block header is signed by its producer. The caller should check the block producer is a
+// miner of the database and the block is on the sqlchain.
+func (p *ReceiptProof) Verify(receipt *ReceiptHeader) (err error) {
+	if err = p.VerifyInclusion(); err != nil {
+		return
+	}
+	if h := p.Response.Hash(); !h.IsEqual(&receipt.ResponseHash) ||
+		!p.Response.RequestHash.IsEqual(&receipt.RequestHash) ||
+		p.Response.Request.DatabaseID != receipt.DatabaseID ||
+		p.Height <= receipt.Height {
+		return ErrReceiptNotMatch
+	}
+	return
+}
+
+// VerifyInclusion checks that the response is included in the block and the block header is
+// signed by its producer, only the block header is needed to verify the proof.
+func (p *ReceiptProof) VerifyInclusion() (err error) {
+	if err = p.Response.VerifyHash(); err != nil {
+		return
+	}
+	var h = p.Response.Hash()
+	if !merkle.VerifyProof(&h, p.Index, p.MerkleProof, &p.Block.MerkleRoot) {
+		return ErrMerkleRootVerification
+	}
+	return p.Block.Verify()
+}
+
+// QueryReceiptProofReq defines a request of the QueryReceiptProof RPC method, the blocks after
+// the height are searched for the response.
+type QueryReceiptProofReq struct {
+	proto.Envelope
+	DatabaseID   proto.DatabaseID
+	ResponseHash hash.Hash
+	Height       int32
+}
+
+// QueryReceiptProofResp defines a response of the QueryReceiptProof RPC method.
+type QueryReceiptProofResp struct {
+	proto.Envelope
+	Proof ReceiptProof
+}
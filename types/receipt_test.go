@@ -0,0 +1,83 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+)
+
+func TestReceiptProof(t *testing.T) {
+	Convey("Given a block packing write responses", t, func() {
+		priv, _, err := asymmetric.GenSecp256k1KeyPair()
+		So(err, ShouldBeNil)
+		block := &Block{
+			SignedHeader: SignedHeader{
+				Header: Header{
+					Version:     0x01000000,
+					GenesisHash: genesisHash,
+				},
+			},
+			FailedReqs: []*Request{{}},
+		}
+		for i := 0; i < 3; i++ {
+			resp := &SignedResponseHeader{
+				ResponseHeader: ResponseHeader{
+					Request:     RequestHeader{DatabaseID: "db", SeqNo: uint64(i)},
+					RequestHash: hash.THashH([]byte{byte(i)}),
+					LogOffset:   uint64(i),
+				},
+			}
+			So(resp.BuildHash(), ShouldBeNil)
+			block.QueryTxs = append(block.QueryTxs, &QueryAsTx{Response: resp})
+		}
+		So(block.PackAndSignBlock(priv), ShouldBeNil)
+
+		target := block.QueryTxs[1].Response
+		receipt := &ReceiptHeader{
+			DatabaseID:   "db",
+			RequestHash:  target.RequestHash,
+			ResponseHash: target.Hash(),
+			Height:       9,
+		}
+
+		Convey("The packed response should be proved", func() {
+			proof, ok := block.ReceiptProof(10, target.Hash())
+			So(ok, ShouldBeTrue)
+			So(proof.Index, ShouldEqual, 2)
+			So(proof.Verify(receipt), ShouldBeNil)
+
+			Convey("The tampered proof should be rejected", func() {
+				proof.Index = 1
+				So(errors.Cause(proof.Verify(receipt)), ShouldEqual, ErrMerkleRootVerification)
+				proof.Index = 2
+				receipt.Height = 10
+				So(errors.Cause(proof.Verify(receipt)), ShouldEqual, ErrReceiptNotMatch)
+			})
+		})
+
+		Convey("The unknown response should not be proved", func() {
+			_, ok := block.ReceiptProof(10, hash.THashH([]byte("unknown")))
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,150 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package types
+
+import (
+	"github.com/pkg/errors"
+
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+const (
+	// NamePeriodBlocks is the block count of a name registration period, about 30 days with
+	// the default 10 seconds block producer period.
+	NamePeriodBlocks uint32 = 259200
+	// NameFeePerPeriod is the Particle fee of a name registration period.
+	NameFeePerPeriod uint64 = 1000
+	// MaxNamePeriods is the max periods a name is registered or renewed for in advance.
+	MaxNamePeriods uint32 = 24
+
+	minNameLength = 3
+	maxNameLength = 32
+)
+
+// NameRecord defines a human-readable name registered on chain for an account address.
+type NameRecord struct {
+	Name       string
+	Owner      proto.AccountAddress
+	Target     proto.AccountAddress
+	Registered uint32 // block producer height the name is registered at by the owner
+	Expiry     uint32 // block producer height the name expires at
+}
+
+// Expired returns if the name is expired at the block producer height, an expired name is free
+// for registration by anyone.
+func (r *NameRecord) Expired(height uint32) bool {
+	return height >= r.Expiry
+}
+
+// ValidateName checks the name to register, a name is 3 to 32 characters of lower case letters,
+// digits and hyphens, beginning with a letter and not ending with a hyphen.
+func ValidateName(name string) error {
+	if len(name) < minNameLength || len(name) > maxNameLength {
+		return errors.Wrapf(ErrInvalidName, "name %q should be %d to %d characters",
+			name, minNameLength, maxNameLength)
+	}
+	for i, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z':
+		case ('0' <= c && c <= '9') || c == '-':
+			if i == 0 {
+				return errors.Wrapf(ErrInvalidName, "name %q should begin with a letter", name)
+			}
+		default:
+			return errors.Wrapf(ErrInvalidName, "invalid character %q in name %q", c, name)
+		}
+	}
+	if name[len(name)-1] == '-' {
+		return errors.Wrapf(ErrInvalidName, "name %q should not end with a hyphen", name)
+	}
+	return nil
+}
+
+// RegisterNameHeader defines the name registration transaction header.
+type RegisterNameHeader struct {
+	Name   string
+	Target proto.AccountAddress
+	// Periods is the registration periods paid, the owner updates the target without renewing
+	// the name with 0 periods.
+	Periods uint32
+	// Fee is the max Particle fee paid for the periods, see NameFeePerPeriod.
+	Fee   uint64
+	Nonce pi.AccountNonce
+}
+
+// RegisterName defines the name registration transaction, which registers, renews or updates a
+// human-readable name of an account address.
+type RegisterName struct {
+	RegisterNameHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewRegisterName returns new instance.
+func NewRegisterName(header *RegisterNameHeader) *RegisterName {
+	return &RegisterName{
+		RegisterNameHeader:   *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeRegisterName),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (rn *RegisterName) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(rn.Signee)
+	return addr
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (rn *RegisterName) GetAccountNonce() pi.AccountNonce {
+	return rn.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (rn *RegisterName) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return rn.DefaultHashSignVerifierImpl.Sign(&rn.RegisterNameHeader, signer)
+}
+
+// SignWith signs the RegisterName with the signer backend.
+func (rn *RegisterName) SignWith(signer asymmetric.Signer) (err error) {
+	return rn.DefaultHashSignVerifierImpl.SignWith(&rn.RegisterNameHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (rn *RegisterName) Verify() (err error) {
+	return rn.DefaultHashSignVerifierImpl.Verify(&rn.RegisterNameHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeRegisterName, (*RegisterName)(nil))
+}
+
+// ResolveNameReq defines a request of the ResolveName RPC method.
+type ResolveNameReq struct {
+	proto.Envelope
+	Name string
+}
+
+// ResolveNameResp defines a response of the ResolveName RPC method.
+type ResolveNameResp struct {
+	proto.Envelope
+	Record NameRecord
+}
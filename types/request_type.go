@@ -96,12 +96,41 @@ type SignedRequestHeader struct {
 	verifier.DefaultHashSignVerifierImpl
 }
 
+// PageRequest defines the pagination parameters of a read request. The first page is requested
+// with an empty token, the following pages pass the token returned in Response.NextPage. Close
+// releases the cursor of the token before the result set is exhausted.
+type PageRequest struct {
+	Size  uint32 `json:"s"`
+	Token []byte `json:"t,omitempty"`
+	Close bool   `json:"c,omitempty"`
+}
+
 // Request defines a complete query request.
 type Request struct {
 	proto.Envelope
-	Header        SignedRequestHeader `json:"h"`
-	Payload       RequestPayload      `json:"p"`
-	_marshalCache []byte              `json:"-"`
+	Header  SignedRequestHeader `json:"h"`
+	Payload RequestPayload      `json:"p"`
+	// AcceptEncoding is the payload compression supported by the client, the miner compresses
+	// large responses with it.
+	AcceptEncoding CompressionType `json:"ae,omitempty"`
+	// Encoding and Compressed carry the compressed payload instead of Payload if set.
+	Encoding   CompressionType `json:"e,omitempty"`
+	Compressed []byte          `json:"z,omitempty"`
+	// Page requests a server-driven paginated read if Page.Size is set.
+	Page PageRequest `json:"pg,omitempty"`
+	// Timeout lowers the statement timeout of the database for this request if set.
+	Timeout time.Duration `json:"to,omitempty"`
+	// MaxStaleness and MaxStaleBlocks bound the lag of the follower serving the read request if
+	// set, in addition to the max read staleness of the database.
+	MaxStaleness   time.Duration `json:"ms,omitempty"`
+	MaxStaleBlocks int32         `json:"mb,omitempty"`
+	// WriteAck raises the replica acknowledgements required by the write query if set, it never
+	// lowers the write ack of the database.
+	WriteAck WriteAck `json:"wa,omitempty"`
+	// IdempotencyKey identifies the write query across the retries of the client, the miner
+	// applies the write only once and replays its response to the retries if set.
+	IdempotencyKey string `json:"ik,omitempty"`
+	_marshalCache  []byte `json:"-"`
 }
 
 // String implements fmt.Stringer for logging purpose.
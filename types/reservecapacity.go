@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package types
+
+import (
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+const (
+	// MaxReservationBlocks is the max block count a capacity is reserved for, about 7 days with
+	// the default 10 seconds block producer period.
+	MaxReservationBlocks uint32 = 60480
+)
+
+// Reservation returns the owner holding the capacity reservation at the block producer height,
+// ok is false if the capacity is not reserved or the reservation is expired.
+func (p *ProviderProfile) Reservation(height uint32) (owner proto.AccountAddress, ok bool) {
+	if p.ReservedBy == (proto.AccountAddress{}) || height >= p.ReservationExpiry {
+		return
+	}
+	return p.ReservedBy, true
+}
+
+// ReserveCapacityHeader defines the capacity reservation transaction header.
+type ReserveCapacityHeader struct {
+	Owner  proto.AccountAddress
+	Miners []proto.AccountAddress // providers to reserve
+	// Blocks is the block count the capacity is reserved for since the transaction is applied.
+	Blocks uint32
+	// Fee is the max Particle fee paid to each miner, see ProviderProfile.ReservationFee.
+	Fee   uint64
+	Nonce pi.AccountNonce
+}
+
+// ReserveCapacity defines the capacity reservation transaction, which reserves the capacity of
+// the providers for the owner ahead of a planned database creation. The reserved providers are
+// only matched for the databases created by the owner until the reservation expires.
+type ReserveCapacity struct {
+	ReserveCapacityHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewReserveCapacity returns new instance.
+func NewReserveCapacity(header *ReserveCapacityHeader) *ReserveCapacity {
+	return &ReserveCapacity{
+		ReserveCapacityHeader: *header,
+		TransactionTypeMixin:  *pi.NewTransactionTypeMixin(pi.TransactionTypeReserveCapacity),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (rc *ReserveCapacity) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(rc.Signee)
+	return addr
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (rc *ReserveCapacity) GetAccountNonce() pi.AccountNonce {
+	return rc.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (rc *ReserveCapacity) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return rc.DefaultHashSignVerifierImpl.Sign(&rc.ReserveCapacityHeader, signer)
+}
+
+// SignWith signs the ReserveCapacity with the signer backend.
+func (rc *ReserveCapacity) SignWith(signer asymmetric.Signer) (err error) {
+	return rc.DefaultHashSignVerifierImpl.SignWith(&rc.ReserveCapacityHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (rc *ReserveCapacity) Verify() (err error) {
+	return rc.DefaultHashSignVerifierImpl.Verify(&rc.ReserveCapacityHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeReserveCapacity, (*ReserveCapacity)(nil))
+}
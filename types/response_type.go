@@ -37,6 +37,8 @@ type ResponsePayload struct {
 	Columns   []string      `json:"c"`
 	DeclTypes []string      `json:"t"`
 	Rows      []ResponseRow `json:"r"`
+	// ColumnMeta is the precise type metadata of the columns, empty from the legacy miners.
+	ColumnMeta []ColumnMeta `json:"m,omitempty"`
 }
 
 // ResponseHeader defines a query response header.
@@ -90,6 +92,18 @@ func (sh *SignedResponseHeader) BuildHash() (err error) {
 type Response struct {
 	Header  SignedResponseHeader `json:"h"`
 	Payload ResponsePayload      `json:"p"`
+	// AcceptEncoding is the payload compression supported by the miner, the client compresses
+	// large requests with it.
+	AcceptEncoding CompressionType `json:"ae,omitempty"`
+	// Encoding and Compressed carry the compressed payload instead of Payload if set.
+	Encoding   CompressionType `json:"e,omitempty"`
+	Compressed []byte          `json:"z,omitempty"`
+	// NextPage is the continuation token of a paginated read, empty on the last page.
+	NextPage []byte `json:"np,omitempty"`
+	// Receipt is the signed receipt of an accepted write query.
+	Receipt *SignedReceiptHeader `json:"rc,omitempty"`
+	// BlockHeight is the sqlchain head height of the miner when the query is served.
+	BlockHeight int32 `json:"bh,omitempty"`
 }
 
 // BuildHash computes the hash of the response.
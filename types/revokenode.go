@@ -0,0 +1,84 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// NodeRevocation defines a revoked node identity published on chain.
+type NodeRevocation struct {
+	NodeID  proto.NodeID
+	Account proto.AccountAddress // the account owning the node, if known
+	Revoker proto.AccountAddress
+	Reason  string
+	Height  uint32
+}
+
+// RevokeNodeHeader defines the node revocation transaction header.
+type RevokeNodeHeader struct {
+	NodeID proto.NodeID
+	Reason string
+	Nonce  pi.AccountNonce
+}
+
+// RevokeNode defines the node revocation transaction, which cuts a compromised node out of
+// the network.
+type RevokeNode struct {
+	RevokeNodeHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewRevokeNode returns new instance.
+func NewRevokeNode(header *RevokeNodeHeader) *RevokeNode {
+	return &RevokeNode{
+		RevokeNodeHeader:     *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeRevokeNode),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (rn *RevokeNode) GetAccountAddress() proto.AccountAddress {
+	addr, _ := crypto.PubKeyHash(rn.Signee)
+	return addr
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (rn *RevokeNode) GetAccountNonce() pi.AccountNonce {
+	return rn.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (rn *RevokeNode) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return rn.DefaultHashSignVerifierImpl.Sign(&rn.RevokeNodeHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (rn *RevokeNode) Verify() (err error) {
+	return rn.DefaultHashSignVerifierImpl.Verify(&rn.RevokeNodeHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeRevokeNode, (*RevokeNode)(nil))
+}
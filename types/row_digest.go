@@ -0,0 +1,84 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// RowRangeDigest defines the digest of the rows of a table in the rowid range [From, To].
+type RowRangeDigest struct {
+	From int64
+	To   int64
+	Rows uint64
+	Hash hash.Hash
+}
+
+// RowDigest defines the digest of a single row of a table.
+type RowDigest struct {
+	RowID int64
+	Hash  hash.Hash
+}
+
+// RowDigestsHeader defines the header of a row digests request. The rowid range [From, To] is
+// split into Buckets ranges of the same width, or digested row by row if Buckets is 0.
+type RowDigestsHeader struct {
+	DatabaseID proto.DatabaseID
+	Table      string
+	From       int64
+	To         int64
+	Buckets    uint32
+	Timestamp  time.Time
+}
+
+// SignedRowDigestsHeader defines the signed header of a row digests request.
+type SignedRowDigestsHeader struct {
+	RowDigestsHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the row digests header.
+func (sh *SignedRowDigestsHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.RowDigestsHeader, signer)
+}
+
+// Verify checks hash and signature in the row digests header.
+func (sh *SignedRowDigestsHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.RowDigestsHeader)
+}
+
+// RowDigestsReq defines a request of the RowDigests RPC method.
+type RowDigestsReq struct {
+	proto.Envelope
+	Header SignedRowDigestsHeader
+}
+
+// RowDigestsResp defines a response of the RowDigests RPC method, only non-empty ranges are
+// returned in Ranges.
+type RowDigestsResp struct {
+	proto.Envelope
+	NodeID proto.NodeID
+	Ranges []RowRangeDigest
+	Rows   []RowDigest
+}
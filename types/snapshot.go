@@ -0,0 +1,49 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// SnapshotInfo defines a database state snapshot prepared by a healthy replica.
+type SnapshotInfo struct {
+	ID        hash.Hash // content hash of the snapshot file
+	Size      uint64
+	BlockHash hash.Hash // head block hash the snapshot is based on
+	Height    int32
+	LogIndex  uint64 // index of the last kayak commit log applied to the snapshot
+}
+
+// SnapshotChunkReq defines a request of the FetchSnapshotChunk RPC method, a new snapshot is
+// prepared if the snapshot id is empty.
+type SnapshotChunkReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+	SnapshotID hash.Hash
+	Offset     uint64
+}
+
+// SnapshotChunkResp defines a response of the FetchSnapshotChunk RPC method.
+type SnapshotChunkResp struct {
+	proto.Envelope
+	Info SnapshotInfo
+	Data []byte
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// ShipSnapshotChunkReq defines a request of the ShipSnapshotChunk RPC method, which pushes a
+// snapshot chunk of the database to its standby miner.
+type ShipSnapshotChunkReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+	Info       SnapshotInfo
+	Offset     uint64
+	Data       []byte
+}
+
+// ShipSnapshotChunkResp defines a response of the ShipSnapshotChunk RPC method, the offset is
+// the next offset expected by the standby miner, so that an interrupted shipping is resumed.
+type ShipSnapshotChunkResp struct {
+	proto.Envelope
+	Offset uint64
+}
+
+// PromoteStandbyHeader defines the header of a standby promotion request.
+type PromoteStandbyHeader struct {
+	DatabaseID proto.DatabaseID
+	Timestamp  time.Time
+}
+
+// SignedPromoteStandbyHeader defines the owner signed header of a standby promotion request.
+type SignedPromoteStandbyHeader struct {
+	PromoteStandbyHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the promote standby header.
+func (sh *SignedPromoteStandbyHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.PromoteStandbyHeader, signer)
+}
+
+// Verify checks hash and signature in the promote standby header.
+func (sh *SignedPromoteStandbyHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.PromoteStandbyHeader)
+}
+
+// PromoteStandbyReq defines a request of the PromoteStandby RPC method.
+type PromoteStandbyReq struct {
+	proto.Envelope
+	Header SignedPromoteStandbyHeader
+}
+
+// PromoteStandbyResp defines a response of the PromoteStandby RPC method, with the snapshot the
+// database is restored from.
+type PromoteStandbyResp struct {
+	proto.Envelope
+	Info SnapshotInfo
+}
@@ -0,0 +1,70 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"time"
+
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// TableUsage defines the approximate storage usage of a table, including its indexes.
+type TableUsage struct {
+	Table string
+	Pages uint64
+	Bytes uint64
+}
+
+// TableUsageHeader defines the header of a table usage request.
+type TableUsageHeader struct {
+	DatabaseID proto.DatabaseID
+	Timestamp  time.Time
+}
+
+// SignedTableUsageHeader defines the signed header of a table usage request.
+type SignedTableUsageHeader struct {
+	TableUsageHeader
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// Sign the table usage header.
+func (sh *SignedTableUsageHeader) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return sh.DefaultHashSignVerifierImpl.Sign(&sh.TableUsageHeader, signer)
+}
+
+// Verify checks hash and signature in the table usage header.
+func (sh *SignedTableUsageHeader) Verify() (err error) {
+	return sh.DefaultHashSignVerifierImpl.Verify(&sh.TableUsageHeader)
+}
+
+// TableUsageReq defines a request of the TableUsage RPC method.
+type TableUsageReq struct {
+	proto.Envelope
+	Header SignedTableUsageHeader
+}
+
+// TableUsageResp defines a response of the TableUsage RPC method.
+type TableUsageResp struct {
+	proto.Envelope
+	NodeID   proto.NodeID
+	PageSize uint64
+	Tables   []TableUsage
+}
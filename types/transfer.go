@@ -63,6 +63,11 @@ func (t *Transfer) Sign(signer *asymmetric.PrivateKey) (err error) {
 	return t.DefaultHashSignVerifierImpl.Sign(&t.TransferHeader, signer)
 }
 
+// SignWith signs the Transfer with the signer backend.
+func (t *Transfer) SignWith(signer asymmetric.Signer) (err error) {
+	return t.DefaultHashSignVerifierImpl.SignWith(&t.TransferHeader, signer)
+}
+
 // Verify implements interfaces/Transaction.Verify.
 func (t *Transfer) Verify() (err error) {
 	return t.DefaultHashSignVerifierImpl.Verify(&t.TransferHeader)
@@ -0,0 +1,99 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package types
+
+import (
+	pi "github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/crypto/asymmetric"
+	"github.com/SQLess/SQLess/crypto/verifier"
+	"github.com/SQLess/SQLess/proto"
+)
+
+//go:generate hsp
+
+// MaxTransferBatchSize is the max receivers of a batch transfer.
+const MaxTransferBatchSize = 1024
+
+// TransferReceiver defines a receiver of the batch transfer.
+type TransferReceiver struct {
+	Receiver proto.AccountAddress
+	Amount   uint64
+}
+
+// TransferBatchHeader defines the batch transfer transaction header.
+type TransferBatchHeader struct {
+	Sender    proto.AccountAddress
+	Receivers []TransferReceiver
+	Nonce     pi.AccountNonce
+	TokenType TokenType
+}
+
+// TotalAmount returns the total amount transferred to the receivers, ok is false on overflow.
+func (h *TransferBatchHeader) TotalAmount() (total uint64, ok bool) {
+	for _, r := range h.Receivers {
+		if total+r.Amount < total {
+			return 0, false
+		}
+		total += r.Amount
+	}
+	return total, true
+}
+
+// TransferBatch defines the batch transfer transaction, which moves the tokens of the sender to
+// many receivers under a single nonce and signature, such as airdrops and payouts. The batch is
+// applied as a whole, none of the receivers is paid if the balance of the sender is insufficient.
+type TransferBatch struct {
+	TransferBatchHeader
+	pi.TransactionTypeMixin
+	verifier.DefaultHashSignVerifierImpl
+}
+
+// NewTransferBatch returns new instance.
+func NewTransferBatch(header *TransferBatchHeader) *TransferBatch {
+	return &TransferBatch{
+		TransferBatchHeader:  *header,
+		TransactionTypeMixin: *pi.NewTransactionTypeMixin(pi.TransactionTypeTransferBatch),
+	}
+}
+
+// GetAccountAddress implements interfaces/Transaction.GetAccountAddress.
+func (t *TransferBatch) GetAccountAddress() proto.AccountAddress {
+	return t.Sender
+}
+
+// GetAccountNonce implements interfaces/Transaction.GetAccountNonce.
+func (t *TransferBatch) GetAccountNonce() pi.AccountNonce {
+	return t.Nonce
+}
+
+// Sign implements interfaces/Transaction.Sign.
+func (t *TransferBatch) Sign(signer *asymmetric.PrivateKey) (err error) {
+	return t.DefaultHashSignVerifierImpl.Sign(&t.TransferBatchHeader, signer)
+}
+
+// SignWith signs the TransferBatch with the signer backend.
+func (t *TransferBatch) SignWith(signer asymmetric.Signer) (err error) {
+	return t.DefaultHashSignVerifierImpl.SignWith(&t.TransferBatchHeader, signer)
+}
+
+// Verify implements interfaces/Transaction.Verify.
+func (t *TransferBatch) Verify() (err error) {
+	return t.DefaultHashSignVerifierImpl.Verify(&t.TransferBatchHeader)
+}
+
+func init() {
+	pi.RegisterTransaction(pi.TransactionTypeTransferBatch, (*TransferBatch)(nil))
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"github.com/SQLess/SQLess/proto"
+)
+
+// PutWALSegmentReq defines a request of the PutWALSegment RPC method, which archives a wal
+// segment containing logs [First, Last] of the database to the archive miner.
+type PutWALSegmentReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+	First      uint64
+	Last       uint64
+	Data       []byte
+}
+
+// PutWALSegmentResp defines a response of the PutWALSegment RPC method.
+type PutWALSegmentResp struct {
+	proto.Envelope
+}
+
+// FetchWALSegmentReq defines a request of the FetchWALSegment RPC method, which fetches the
+// archived wal segment containing the log at index From, or the first segment after it.
+type FetchWALSegmentReq struct {
+	proto.Envelope
+	DatabaseID proto.DatabaseID
+	From       uint64
+}
+
+// FetchWALSegmentResp defines a response of the FetchWALSegment RPC method, the data is empty
+// if no segment is archived at or after the index.
+type FetchWALSegmentResp struct {
+	proto.Envelope
+	Data []byte
+}
@@ -0,0 +1,85 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// WriteAck defines the number of replica acknowledgements a write query requires before it
+// succeeds.
+type WriteAck uint8
+
+const (
+	// WriteAckDefault uses the write ack setting of the database, which is WriteAckAll if the
+	// database does not set one either.
+	WriteAckDefault WriteAck = iota
+	// WriteAckOne requires the acknowledgement of the leader only.
+	WriteAckOne
+	// WriteAckQuorum requires the acknowledgements of the majority of replicas.
+	WriteAckQuorum
+	// WriteAckAll requires the acknowledgements of all replicas.
+	WriteAckAll
+)
+
+// ParseWriteAck parses the write ack from its name.
+func ParseWriteAck(s string) (a WriteAck, err error) {
+	switch strings.ToLower(s) {
+	case "", "default":
+		a = WriteAckDefault
+	case "one", "1":
+		a = WriteAckOne
+	case "quorum":
+		a = WriteAckQuorum
+	case "all":
+		a = WriteAckAll
+	default:
+		err = errors.Wrapf(ErrUnknownWriteAck, "write ack %q", s)
+	}
+	return
+}
+
+// String implements fmt.Stringer.
+func (a WriteAck) String() string {
+	switch a {
+	case WriteAckDefault:
+		return "default"
+	case WriteAckOne:
+		return "one"
+	case WriteAckQuorum:
+		return "quorum"
+	case WriteAckAll:
+		return "all"
+	default:
+		return "unknown"
+	}
+}
+
+// Replicas returns the replica count, including the leader, required by the write ack among the
+// total replicas.
+func (a WriteAck) Replicas(total int) int {
+	switch a {
+	case WriteAckOne:
+		return 1
+	case WriteAckQuorum:
+		return total/2 + 1
+	default:
+		return total
+	}
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriteAck(t *testing.T) {
+	Convey("test write ack", t, func() {
+		Convey("parse write ack from its name", func() {
+			for _, a := range []WriteAck{WriteAckDefault, WriteAckOne, WriteAckQuorum, WriteAckAll} {
+				parsed, err := ParseWriteAck(a.String())
+				So(err, ShouldBeNil)
+				So(parsed, ShouldEqual, a)
+			}
+			parsed, err := ParseWriteAck("QUORUM")
+			So(err, ShouldBeNil)
+			So(parsed, ShouldEqual, WriteAckQuorum)
+			_, err = ParseWriteAck("two")
+			So(errors.Cause(err), ShouldEqual, ErrUnknownWriteAck)
+		})
+		Convey("replicas required by write ack", func() {
+			So(WriteAckOne.Replicas(3) == 1, ShouldBeTrue)
+			So(WriteAckQuorum.Replicas(1) == 1, ShouldBeTrue)
+			So(WriteAckQuorum.Replicas(3) == 2, ShouldBeTrue)
+			So(WriteAckQuorum.Replicas(4) == 3, ShouldBeTrue)
+			So(WriteAckAll.Replicas(3) == 3, ShouldBeTrue)
+			So(WriteAckDefault.Replicas(5) == 5, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package clock provides clock skew detection against peer reported times.
+package clock
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultMaxSkew defines the default max tolerable clock skew.
+	DefaultMaxSkew = 500 * time.Millisecond
+
+	// maxSamplesPerPeer defines the max samples kept for a single peer.
+	maxSamplesPerPeer = 8
+
+	mwClockSkew = "clock:skew:ns"
+)
+
+var (
+	skewMetric = new(expvar.Int)
+)
+
+func init() {
+	expvar.Publish(mwClockSkew, skewMetric)
+}
+
+// SkewDetector estimates the local clock skew from peer reported times. A positive skew means
+// the local clock is behind the peers.
+type SkewDetector struct {
+	sync.RWMutex
+	maxSkew  time.Duration
+	samples  map[proto.NodeID][]time.Duration
+	skew     time.Duration
+	exceeded bool
+}
+
+// MaxSkew returns the max tolerable clock skew of the loaded config, zero if the config is not
+// loaded.
+func MaxSkew() time.Duration {
+	if conf.GConf == nil {
+		return 0
+	}
+	return conf.GConf.MaxClockSkew
+}
+
+// NewSkewDetector returns a new clock skew detector with the max tolerable skew.
+func NewSkewDetector(maxSkew time.Duration) *SkewDetector {
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxSkew
+	}
+	return &SkewDetector{
+		maxSkew: maxSkew,
+		samples: make(map[proto.NodeID][]time.Duration),
+	}
+}
+
+// AddSample adds a time sample of the peer. The request is sent at local time sent, replied by
+// peer at peer time remote, and received at local time recv. The offset is corrected by half
+// of the round trip time.
+func (d *SkewDetector) AddSample(peer proto.NodeID, sent, remote, recv time.Time) {
+	if remote.IsZero() || recv.Before(sent) {
+		return
+	}
+	offset := remote.Sub(sent.Add(recv.Sub(sent) / 2))
+
+	d.Lock()
+	defer d.Unlock()
+	samples := append(d.samples[peer], offset)
+	if len(samples) > maxSamplesPerPeer {
+		samples = samples[len(samples)-maxSamplesPerPeer:]
+	}
+	d.samples[peer] = samples
+	d.update()
+}
+
+// update recalculates the skew as the median of the per-peer median offsets, which is robust
+// against a minority of peers with broken clocks.
+func (d *SkewDetector) update() {
+	var peers = make([]time.Duration, 0, len(d.samples))
+	for _, s := range d.samples {
+		peers = append(peers, median(s))
+	}
+	d.skew = median(peers)
+	skewMetric.Set(int64(d.skew))
+
+	exceeded := d.skew > d.maxSkew || d.skew < -d.maxSkew
+	if exceeded != d.exceeded {
+		le := log.WithFields(log.Fields{
+			"skew":     d.skew.String(),
+			"max_skew": d.maxSkew.String(),
+			"peers":    len(peers),
+		})
+		if exceeded {
+			le.Error("local clock skew exceeds the threshold, please check NTP synchronization")
+		} else {
+			le.Info("local clock skew is corrected")
+		}
+	}
+	d.exceeded = exceeded
+}
+
+// Skew returns the estimated local clock skew.
+func (d *SkewDetector) Skew() time.Duration {
+	d.RLock()
+	defer d.RUnlock()
+	return d.skew
+}
+
+// Exceeded returns whether the estimated local clock skew exceeds the max tolerable skew.
+func (d *SkewDetector) Exceeded() bool {
+	d.RLock()
+	defer d.RUnlock()
+	return d.exceeded
+}
+
+func median(s []time.Duration) time.Duration {
+	if len(s) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), s...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	if n := len(sorted); n%2 == 0 {
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return sorted[len(sorted)/2]
+}
@@ -0,0 +1,86 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clock
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestSkewDetector(t *testing.T) {
+	Convey("Given a skew detector with 100ms max skew", t, func() {
+		var (
+			d    = NewSkewDetector(100 * time.Millisecond)
+			base = time.Now()
+			rtt  = 20 * time.Millisecond
+		)
+		So(d.Skew(), ShouldEqual, 0)
+		So(d.Exceeded(), ShouldBeFalse)
+
+		addSample := func(peer proto.NodeID, offset time.Duration) {
+			d.AddSample(peer, base, base.Add(rtt/2+offset), base.Add(rtt))
+		}
+
+		Convey("Small offsets should not exceed the threshold", func() {
+			addSample("node1", 10*time.Millisecond)
+			addSample("node2", -10*time.Millisecond)
+			addSample("node3", 20*time.Millisecond)
+			So(d.Skew(), ShouldEqual, 10*time.Millisecond)
+			So(d.Exceeded(), ShouldBeFalse)
+		})
+
+		Convey("A minority of broken peers should not affect the skew", func() {
+			addSample("node1", 0)
+			addSample("node2", 0)
+			addSample("node3", time.Hour)
+			So(d.Skew(), ShouldEqual, 0)
+			So(d.Exceeded(), ShouldBeFalse)
+		})
+
+		Convey("Large skew should be detected and recovered", func() {
+			addSample("node1", -time.Second)
+			addSample("node2", -time.Second)
+			So(d.Skew(), ShouldEqual, -time.Second)
+			So(d.Exceeded(), ShouldBeTrue)
+
+			for i := 0; i < maxSamplesPerPeer; i++ {
+				addSample("node1", 0)
+				addSample("node2", 0)
+			}
+			So(d.Skew(), ShouldEqual, 0)
+			So(d.Exceeded(), ShouldBeFalse)
+		})
+	})
+}
+
+func TestMaxSkew(t *testing.T) {
+	Convey("The max skew should be read from the loaded config", t, func() {
+		var orig = conf.GConf
+		defer func() { conf.GConf = orig }()
+
+		conf.GConf = nil
+		So(MaxSkew(), ShouldEqual, 0)
+		So(NewSkewDetector(MaxSkew()).maxSkew, ShouldEqual, DefaultMaxSkew)
+		conf.GConf = &conf.Config{MaxClockSkew: time.Second}
+		So(MaxSkew(), ShouldEqual, time.Second)
+	})
+}
@@ -0,0 +1,143 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"errors"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxDecimalDigits is the maximum number of digits of a decimal, which prevents huge
+	// numbers like 1e1000000000 from exhausting the memory.
+	MaxDecimalDigits = 1000
+)
+
+var (
+	// ErrInvalidDecimal indicates the value is not a valid decimal number.
+	ErrInvalidDecimal = errors.New("invalid decimal")
+	// ErrNonTerminatingDecimal indicates the rational number has no finite decimal form.
+	ErrNonTerminatingDecimal = errors.New("non-terminating decimal")
+
+	decimalPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?$`)
+
+	bigTen = big.NewInt(10)
+	bigTwo = big.NewInt(2)
+	bigFiv = big.NewInt(5)
+)
+
+// ParseDecimal parses the decimal number in plain or exponent notation, the fraction notation
+// like 1/3 and the special values like Inf are rejected.
+func ParseDecimal(s string) (r *big.Rat, err error) {
+	s = strings.TrimSpace(s)
+	if !decimalPattern.MatchString(s) {
+		err = ErrInvalidDecimal
+		return
+	}
+	var mantissa, exp = s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mantissa = s[:i]
+		if exp, err = strconv.Atoi(s[i+1:]); err != nil {
+			err = ErrInvalidDecimal
+			return
+		}
+	}
+	if exp > MaxDecimalDigits || exp < -MaxDecimalDigits || len(mantissa) > MaxDecimalDigits {
+		err = ErrInvalidDecimal
+		return
+	}
+	var ok bool
+	if r, ok = new(big.Rat).SetString(s); !ok {
+		r = nil
+		err = ErrInvalidDecimal
+	}
+	return
+}
+
+// DecimalFromValue converts the integer, float and text values to decimal, floats are converted
+// by their shortest representation.
+func DecimalFromValue(v interface{}) (r *big.Rat, err error) {
+	switch d := v.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(d), nil
+	case int:
+		return new(big.Rat).SetInt64(int64(d)), nil
+	case float64:
+		return ParseDecimal(strconv.FormatFloat(d, 'g', -1, 64))
+	case string:
+		return ParseDecimal(d)
+	case []byte:
+		return ParseDecimal(string(d))
+	case *big.Rat:
+		return new(big.Rat).Set(d), nil
+	case *big.Int:
+		return new(big.Rat).SetInt(d), nil
+	default:
+		return nil, ErrInvalidDecimal
+	}
+}
+
+// FormatDecimal formats the rational number in the canonical decimal form, which has neither
+// exponent nor trailing zeros in the fraction, e.g. -12.5, 0 and 100.
+func FormatDecimal(r *big.Rat) (s string, err error) {
+	// the denominator of a terminating decimal is 2^a*5^b, and the scale is max(a, b)
+	var (
+		denom = new(big.Int).Set(r.Denom())
+		mod   = new(big.Int)
+		scale int
+	)
+	for _, p := range []*big.Int{bigTwo, bigFiv} {
+		var n int
+		for {
+			q, m := new(big.Int).QuoRem(denom, p, mod)
+			if m.Sign() != 0 {
+				break
+			}
+			denom = q
+			n++
+		}
+		if n > scale {
+			scale = n
+		}
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		err = ErrNonTerminatingDecimal
+		return
+	}
+	return r.FloatString(scale), nil
+}
+
+// RoundDecimal rounds the rational number to the scale of fraction digits, half away from zero.
+func RoundDecimal(r *big.Rat, scale int) *big.Rat {
+	var (
+		factor = new(big.Int).Exp(bigTen, big.NewInt(int64(scale)), nil)
+		num    = new(big.Int).Mul(r.Num(), factor)
+		q, m   = new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	)
+	// compare 2*|remainder| with the denominator
+	if m.Abs(m).Lsh(m, 1).Cmp(r.Denom()) >= 0 {
+		if r.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return new(big.Rat).SetFrac(q, factor)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"math/big"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDecimal(t *testing.T) {
+	Convey("parse and format decimals canonically", t, func() {
+		for in, out := range map[string]string{
+			"0":         "0",
+			"-0.000":    "0",
+			"+1.10":     "1.1",
+			"001.2500":  "1.25",
+			".5":        "0.5",
+			"1.5e3":     "1500",
+			"-12345e-4": "-1.2345",
+			"123456789012345678901234567890.123456789": "123456789012345678901234567890.123456789",
+		} {
+			r, err := ParseDecimal(in)
+			So(err, ShouldBeNil)
+			s, err := FormatDecimal(r)
+			So(err, ShouldBeNil)
+			So(s, ShouldEqual, out)
+		}
+		for _, in := range []string{"", "abc", "1/3", "Inf", "NaN", "0x10", "1e100000"} {
+			_, err := ParseDecimal(in)
+			So(err, ShouldEqual, ErrInvalidDecimal)
+		}
+		_, err := FormatDecimal(big.NewRat(1, 3))
+		So(err, ShouldEqual, ErrNonTerminatingDecimal)
+	})
+	Convey("convert values to decimals", t, func() {
+		r, err := DecimalFromValue(0.1)
+		So(err, ShouldBeNil)
+		So(r.Cmp(big.NewRat(1, 10)), ShouldEqual, 0)
+		r, err = DecimalFromValue(int64(-3))
+		So(err, ShouldBeNil)
+		So(r.Cmp(big.NewRat(-3, 1)), ShouldEqual, 0)
+		_, err = DecimalFromValue(nil)
+		So(err, ShouldEqual, ErrInvalidDecimal)
+	})
+	Convey("round decimals half away from zero", t, func() {
+		for in, out := range map[string]string{
+			"1.005":  "1.01",
+			"-1.005": "-1.01",
+			"1.004":  "1",
+			"2.5":    "2.5",
+		} {
+			r, err := ParseDecimal(in)
+			So(err, ShouldBeNil)
+			s, err := FormatDecimal(RoundDecimal(r, 2))
+			So(err, ShouldBeNil)
+			So(s, ShouldEqual, out)
+		}
+		r, _ := ParseDecimal("2.5")
+		s, _ := FormatDecimal(RoundDecimal(r, 0))
+		So(s, ShouldEqual, "3")
+		s, _ = FormatDecimal(RoundDecimal(big.NewRat(2, 3), 4))
+		So(s, ShouldEqual, "0.6667")
+	})
+}
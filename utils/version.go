@@ -0,0 +1,66 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersion compares two dotted release versions like "0.5.1" or "v0.6.0-beta", the
+// pre-release suffix is ignored. It returns -1, 0 or 1 if a is less than, equal to or greater
+// than b, unknown versions are considered as the lowest version.
+func CompareVersion(a, b string) int {
+	pa, pb := parseVersion(a), parseVersion(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var va, vb = -1, -1
+		if i < len(pa) {
+			va = pa[i]
+		} else if len(pa) > 0 {
+			va = 0
+		}
+		if i < len(pb) {
+			vb = pb[i]
+		} else if len(pb) > 0 {
+			vb = 0
+		}
+		if va < vb {
+			return -1
+		} else if va > vb {
+			return 1
+		}
+	}
+	return 0
+}
+
+func parseVersion(v string) (parts []int) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	if v == "" {
+		return
+	}
+	for _, s := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil
+		}
+		parts = append(parts, n)
+	}
+	return
+}
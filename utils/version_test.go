@@ -0,0 +1,35 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompareVersion(t *testing.T) {
+	Convey("test version comparison", t, func() {
+		So(CompareVersion("0.1", "0.1.0"), ShouldEqual, 0)
+		So(CompareVersion("v0.5.1", "0.5.0"), ShouldEqual, 1)
+		So(CompareVersion("0.5.0-beta", "0.6"), ShouldEqual, -1)
+		So(CompareVersion("0.1-alpha", "0.1"), ShouldEqual, 0)
+		So(CompareVersion("unknown", "0.0.1"), ShouldEqual, -1)
+		So(CompareVersion("unknown", "unknown"), ShouldEqual, 0)
+		So(CompareVersion("1.0", "unknown"), ShouldEqual, 1)
+	})
+}
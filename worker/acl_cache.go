@@ -0,0 +1,164 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"expvar"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+const (
+	mwMinerACLCacheHit  = "service:miner:acl:cache:hit"
+	mwMinerACLCacheMiss = "service:miner:acl:cache:miss"
+)
+
+var (
+	aclCacheHit  = new(expvar.Int)
+	aclCacheMiss = new(expvar.Int)
+)
+
+func init() {
+	expvar.Publish(mwMinerACLCacheHit, aclCacheHit)
+	expvar.Publish(mwMinerACLCacheMiss, aclCacheMiss)
+}
+
+// aclDecision defines a cached permission decision of an account on a database.
+type aclDecision struct {
+	permStat *types.PermStat
+	readErr  error
+	writeErr error
+}
+
+// newACLDecision evaluates the read/write decisions of the permission state. An owner in
+// arrears could still read the database, which is read-only until the budget is refilled.
+func newACLDecision(permStat *types.PermStat, isOwner bool) (d *aclDecision) {
+	d = &aclDecision{
+		permStat: permStat,
+	}
+
+	// check if query is enabled
+	if isOwner && permStat.Status == types.Arrears {
+		if !permStat.Permission.HasReadPermission() {
+			d.readErr = errors.Wrapf(ErrPermissionDeny, "cannot read, permission: %v", permStat.Permission)
+		}
+		d.writeErr = errors.Wrapf(ErrReadOnlyMaintenance, "reason: %s", maintenanceReasonArrears)
+		return
+	}
+	if !permStat.Status.EnableQuery() {
+		d.readErr = errors.Wrapf(ErrPermissionDeny, "cannot query, status: %d", permStat.Status)
+		d.writeErr = d.readErr
+		return
+	}
+	if !permStat.Permission.HasReadPermission() {
+		d.readErr = errors.Wrapf(ErrPermissionDeny, "cannot read, permission: %v", permStat.Permission)
+	}
+	if !permStat.Permission.HasWritePermission() {
+		d.writeErr = errors.Wrapf(ErrPermissionDeny, "cannot write, permission: %v", permStat.Permission)
+	}
+	return
+}
+
+// check returns the cached decision of the query type.
+func (d *aclDecision) check(queryType types.QueryType) (err error) {
+	switch queryType {
+	case types.ReadQuery:
+		return d.readErr
+	case types.WriteQuery:
+		return d.writeErr
+	default:
+		return errors.Wrapf(ErrInvalidPermission,
+			"invalid permission, permission: %v", d.permStat.Permission)
+	}
+}
+
+// aclCache caches permission decisions per (database, account) on the miner. The decisions are
+// keyed on the version of the profiles fetched from block producers, all entries are dropped once
+// the profiles are refreshed, whatever transaction changed the permission or status.
+type aclCache struct {
+	sync.RWMutex
+	version   uint64
+	decisions map[proto.DatabaseID]map[proto.AccountAddress]*aclDecision
+}
+
+func newACLCache() *aclCache {
+	return &aclCache{
+		decisions: make(map[proto.DatabaseID]map[proto.AccountAddress]*aclDecision),
+	}
+}
+
+// get returns the cached decision evaluated on the profile version.
+func (c *aclCache) get(
+	dbID proto.DatabaseID, addr proto.AccountAddress, version uint64) (d *aclDecision, ok bool,
+) {
+	c.RLock()
+	defer c.RUnlock()
+	var users map[proto.AccountAddress]*aclDecision
+	if users, ok = c.decisions[dbID]; ok && c.version == version {
+		d, ok = users[addr]
+	} else {
+		ok = false
+	}
+	if ok {
+		aclCacheHit.Add(1)
+	} else {
+		aclCacheMiss.Add(1)
+	}
+	return
+}
+
+// set caches the decision evaluated on the profile version, the decisions of older versions are
+// dropped and a decision of an outdated version is ignored.
+func (c *aclCache) set(
+	dbID proto.DatabaseID, addr proto.AccountAddress, version uint64, d *aclDecision,
+) {
+	c.Lock()
+	defer c.Unlock()
+	if version < c.version {
+		return
+	}
+	if version > c.version {
+		c.version = version
+		c.decisions = make(map[proto.DatabaseID]map[proto.AccountAddress]*aclDecision)
+	}
+	users, ok := c.decisions[dbID]
+	if !ok {
+		users = make(map[proto.AccountAddress]*aclDecision)
+		c.decisions[dbID] = users
+	}
+	users[addr] = d
+}
+
+// invalidate removes the cached decision of the account on the database.
+func (c *aclCache) invalidate(dbID proto.DatabaseID, addr proto.AccountAddress) {
+	c.Lock()
+	defer c.Unlock()
+	if users, ok := c.decisions[dbID]; ok {
+		delete(users, addr)
+	}
+}
+
+// invalidateDatabase removes all the cached decisions on the database.
+func (c *aclCache) invalidateDatabase(dbID proto.DatabaseID) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.decisions, dbID)
+}
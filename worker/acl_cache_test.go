@@ -0,0 +1,102 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestACLCache(t *testing.T) {
+	Convey("Given an empty acl cache", t, func() {
+		var (
+			c     = newACLCache()
+			dbID  = proto.DatabaseID("db")
+			user1 = proto.AccountAddress{0x01}
+			user2 = proto.AccountAddress{0x02}
+		)
+		_, ok := c.get(dbID, user1, 1)
+		So(ok, ShouldBeFalse)
+
+		Convey("The decision of a read only user should be cached", func() {
+			c.set(dbID, user1, 1, newACLDecision(&types.PermStat{
+				Permission: types.UserPermissionFromRole(types.Read),
+				Status:     types.Normal,
+			}, false))
+			c.set(dbID, user2, 1, newACLDecision(&types.PermStat{
+				Permission: types.UserPermissionFromRole(types.Admin),
+				Status:     types.Arrears,
+			}, false))
+			d, ok := c.get(dbID, user1, 1)
+			So(ok, ShouldBeTrue)
+			So(d.check(types.ReadQuery), ShouldBeNil)
+			So(errors.Cause(d.check(types.WriteQuery)), ShouldEqual, ErrPermissionDeny)
+			So(errors.Cause(d.check(types.NumberOfQueryType)), ShouldEqual, ErrInvalidPermission)
+			d, ok = c.get(dbID, user2, 1)
+			So(ok, ShouldBeTrue)
+			So(errors.Cause(d.check(types.ReadQuery)), ShouldEqual, ErrPermissionDeny)
+			So(errors.Cause(d.check(types.WriteQuery)), ShouldEqual, ErrPermissionDeny)
+			// the owner in arrears could still read the read-only database
+			d = newACLDecision(&types.PermStat{
+				Permission: types.UserPermissionFromRole(types.Admin),
+				Status:     types.Arrears,
+			}, true)
+			So(d.check(types.ReadQuery), ShouldBeNil)
+			So(errors.Cause(d.check(types.WriteQuery)), ShouldEqual, ErrReadOnlyMaintenance)
+
+			Convey("Invalidation should only affect the target user", func() {
+				c.invalidate(dbID, user1)
+				_, ok = c.get(dbID, user1, 1)
+				So(ok, ShouldBeFalse)
+				_, ok = c.get(dbID, user2, 1)
+				So(ok, ShouldBeTrue)
+			})
+			Convey("Refreshed profiles should drop all decisions", func() {
+				_, ok = c.get(dbID, user1, 2)
+				So(ok, ShouldBeFalse)
+				c.set(dbID, user1, 2, newACLDecision(&types.PermStat{
+					Permission: types.UserPermissionFromRole(types.Void),
+					Status:     types.Normal,
+				}, false))
+				_, ok = c.get(dbID, user2, 2)
+				So(ok, ShouldBeFalse)
+				d, ok = c.get(dbID, user1, 2)
+				So(ok, ShouldBeTrue)
+				So(errors.Cause(d.check(types.ReadQuery)), ShouldEqual, ErrPermissionDeny)
+				// decision of outdated profiles should be ignored
+				c.set(dbID, user2, 1, newACLDecision(&types.PermStat{
+					Permission: types.UserPermissionFromRole(types.Admin),
+					Status:     types.Normal,
+				}, false))
+				_, ok = c.get(dbID, user2, 2)
+				So(ok, ShouldBeFalse)
+			})
+			Convey("Invalidation of database should affect all users", func() {
+				c.invalidateDatabase(dbID)
+				_, ok = c.get(dbID, user1, 1)
+				So(ok, ShouldBeFalse)
+				_, ok = c.get(dbID, user2, 1)
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
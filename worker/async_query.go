@@ -0,0 +1,430 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package worker
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultMaxAsyncQueries defines the default running asynchronous query limit of each client
+	// node.
+	DefaultMaxAsyncQueries = 4
+	// DefaultAsyncQueryTTL defines the default retention of the finished asynchronous queries.
+	DefaultAsyncQueryTTL = 30 * time.Minute
+	// DefaultMaxAsyncResults defines the default limit of the retained asynchronous queries of
+	// each client node, including the running ones.
+	DefaultMaxAsyncResults = 16
+	// DefaultMaxAsyncResultBytes defines the default limit of the retained result size of each
+	// client node.
+	DefaultMaxAsyncResultBytes = 256 << 20
+	// AsyncResultSpillSize defines the encoded size beyond which a result is kept on disk instead
+	// of in memory.
+	AsyncResultSpillSize = 1 << 20
+	// AsyncResultDirName defines the directory under the miner root keeping the spilled results.
+	AsyncResultDirName = "async"
+)
+
+// asyncQuery is a read query running in background on behalf of the owner node, the response is
+// set once the query is succeeded.
+type asyncQuery struct {
+	owner    proto.NodeID
+	dbID     proto.DatabaseID
+	status   types.AsyncQueryStatus
+	cancel   context.CancelFunc
+	canceled bool
+	response *types.Response
+	// size is the encoded size of the response, and spill is the file keeping the encoded
+	// response if it's too large to keep in memory
+	size  int64
+	spill string
+}
+
+// asyncQueries tracks the asynchronous queries of the miner. The finished queries are kept until
+// they expire, so that the client could fetch the result after a disconnection. The retained
+// jobs and result bytes are limited per client node, the large results are spilled to disk.
+type asyncQueries struct {
+	sync.Mutex
+	limit     int
+	retain    int
+	maxBytes  int64
+	ttl       time.Duration
+	spillDir  string
+	spillSize int64
+	jobs      map[string]*asyncQuery
+	running   map[proto.NodeID]int
+	retained  map[proto.NodeID]int
+	bytes     map[proto.NodeID]int64
+}
+
+// newAsyncQueries returns the asynchronous query tracker, the large results are spilled to
+// spillDir, or kept in memory if it's empty. The spilled results of the last run are removed.
+func newAsyncQueries(
+	limit, retain int, maxBytes int64, ttl time.Duration, spillDir string,
+) *asyncQueries {
+	if limit <= 0 {
+		limit = DefaultMaxAsyncQueries
+	}
+	if retain <= 0 {
+		retain = DefaultMaxAsyncResults
+	}
+	if retain < limit {
+		retain = limit
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxAsyncResultBytes
+	}
+	if ttl <= 0 {
+		ttl = DefaultAsyncQueryTTL
+	}
+	if spillDir != "" {
+		if err := os.RemoveAll(spillDir); err != nil {
+			log.WithError(err).Warning("remove spilled async query results failed")
+		}
+	}
+	return &asyncQueries{
+		limit:     limit,
+		retain:    retain,
+		maxBytes:  maxBytes,
+		ttl:       ttl,
+		spillDir:  spillDir,
+		spillSize: AsyncResultSpillSize,
+		jobs:      make(map[string]*asyncQuery),
+		running:   make(map[proto.NodeID]int),
+		retained:  make(map[proto.NodeID]int),
+		bytes:     make(map[proto.NodeID]int64),
+	}
+}
+
+// asyncSpillDir returns the directory of the spilled results under the miner root, the results
+// are kept in memory if there is no root directory.
+func asyncSpillDir(rootDir string) string {
+	if rootDir == "" {
+		return ""
+	}
+	return filepath.Join(rootDir, AsyncResultDirName)
+}
+
+// newAsyncQueryID returns a random job id which could not be guessed by the other nodes.
+func newAsyncQueryID() (id string, err error) {
+	var b [16]byte
+	if _, err = rand.Read(b[:]); err != nil {
+		return
+	}
+	id = hex.EncodeToString(b[:])
+	return
+}
+
+// submit executes the read request with exec in background, the job is owned by the given node.
+func (a *asyncQueries) submit(
+	owner proto.NodeID, request *types.Request, exec func(*types.Request) (*types.Response, error),
+) (status types.AsyncQueryStatus, err error) {
+	var id string
+	if id, err = newAsyncQueryID(); err != nil {
+		return
+	}
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		job         = &asyncQuery{
+			owner: owner,
+			dbID:  request.Header.DatabaseID,
+			status: types.AsyncQueryStatus{
+				JobID:     id,
+				State:     types.AsyncQueryRunning,
+				Submitted: time.Now(),
+			},
+			cancel: cancel,
+		}
+	)
+
+	a.Lock()
+	a.sweep(time.Now())
+	if a.running[owner] >= a.limit {
+		a.Unlock()
+		cancel()
+		err = errors.Wrapf(ErrTooManyAsyncQueries, "limit: %d", a.limit)
+		return
+	}
+	if a.retained[owner] >= a.retain {
+		a.Unlock()
+		cancel()
+		err = errors.Wrapf(ErrTooManyAsyncQueries,
+			"retained limit: %d, fetch and discard the finished queries", a.retain)
+		return
+	}
+	a.running[owner]++
+	a.retained[owner]++
+	a.jobs[id] = job
+	status = job.status
+	a.Unlock()
+
+	// the query outlives the rpc call, it's only interrupted by cancellation or shutdown
+	request.SetContext(ctx)
+	go func() {
+		response, err := exec(request)
+		a.finish(job, response, err)
+	}()
+	return
+}
+
+// store encodes the response to measure its size, and spills it to disk if it's large. The
+// response is returned as nil if it's spilled.
+func (a *asyncQueries) store(response *types.Response) (
+	kept *types.Response, size int64, spill string, err error,
+) {
+	buf, err := utils.EncodeMsgPack(response)
+	if err != nil {
+		return
+	}
+	if size = int64(buf.Len()); size <= a.spillSize || a.spillDir == "" {
+		kept = response
+		return
+	}
+	if err = os.MkdirAll(a.spillDir, 0700); err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(a.spillDir, "result-")
+	if err != nil {
+		return
+	}
+	spill = f.Name()
+	if _, err = f.Write(buf.Bytes()); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(spill)
+		spill = ""
+	}
+	return
+}
+
+func (a *asyncQueries) finish(job *asyncQuery, response *types.Response, err error) {
+	var (
+		rows  uint64
+		size  int64
+		spill string
+	)
+	if err == nil {
+		rows = uint64(len(response.Payload.Rows))
+		if response, size, spill, err = a.store(response); err != nil {
+			err = errors.Wrap(err, "store result failed")
+		}
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	job.cancel()
+	if a.running[job.owner]--; a.running[job.owner] <= 0 {
+		delete(a.running, job.owner)
+	}
+	if err == nil && !job.canceled && a.bytes[job.owner]+size > a.maxBytes {
+		err = errors.Errorf("result of %d bytes exceeds the retained limit of %d bytes, "+
+			"fetch and discard the finished queries", size, a.maxBytes)
+	}
+	job.status.Finished = time.Now()
+	switch {
+	case job.canceled:
+		job.status.State = types.AsyncQueryCanceled
+	case err != nil:
+		job.status.State = types.AsyncQueryFailed
+		job.status.Error = err.Error()
+	default:
+		job.status.State = types.AsyncQuerySucceeded
+		job.status.Rows = rows
+		job.response, job.size, job.spill = response, size, spill
+		a.bytes[job.owner] += size
+	}
+	if job.status.State != types.AsyncQuerySucceeded && spill != "" {
+		_ = os.Remove(spill)
+	}
+	log.WithFields(log.Fields{
+		"db":    job.dbID,
+		"node":  job.owner,
+		"job":   job.status.JobID,
+		"state": job.status.State.String(),
+		"cost":  job.status.Finished.Sub(job.status.Submitted).String(),
+	}).WithError(err).Debug("async query finished")
+}
+
+// release removes the finished job and its retained result, the lock must be held by the caller.
+func (a *asyncQueries) release(job *asyncQuery) {
+	delete(a.jobs, job.status.JobID)
+	if a.retained[job.owner]--; a.retained[job.owner] <= 0 {
+		delete(a.retained, job.owner)
+	}
+	if a.bytes[job.owner] -= job.size; a.bytes[job.owner] <= 0 {
+		delete(a.bytes, job.owner)
+	}
+	if job.spill != "" {
+		if err := os.Remove(job.spill); err != nil && !os.IsNotExist(err) {
+			log.WithError(err).WithField("job", job.status.JobID).Warning(
+				"remove spilled async query result failed")
+		}
+	}
+	job.response, job.size, job.spill = nil, 0, ""
+}
+
+// sweep removes the expired jobs, the lock must be held by the caller.
+func (a *asyncQueries) sweep(now time.Time) {
+	for _, job := range a.jobs {
+		if job.status.State.Finished() && now.Sub(job.status.Finished) > a.ttl {
+			a.release(job)
+		}
+	}
+}
+
+// lookup returns the job of the owner, the lock must be held by the caller. Jobs of the other
+// nodes are reported as not found.
+func (a *asyncQueries) lookup(owner proto.NodeID, dbID proto.DatabaseID, id string) (
+	job *asyncQuery, err error,
+) {
+	a.sweep(time.Now())
+	job, ok := a.jobs[id]
+	if !ok || job.owner != owner || job.dbID != dbID {
+		job = nil
+		err = errors.Wrapf(ErrAsyncQueryNotFound, "job: %s", id)
+	}
+	return
+}
+
+// get returns the status of the job, and the response if it's succeeded.
+func (a *asyncQueries) get(owner proto.NodeID, dbID proto.DatabaseID, id string) (
+	status types.AsyncQueryStatus, response *types.Response, err error,
+) {
+	var (
+		job   *asyncQuery
+		spill string
+	)
+	a.Lock()
+	if job, err = a.lookup(owner, dbID, id); err == nil {
+		status, response, spill = job.status, job.response, job.spill
+	}
+	a.Unlock()
+	if err != nil || spill == "" {
+		return
+	}
+
+	// read the spilled result without holding the lock, it may be discarded in the meantime
+	data, err := ioutil.ReadFile(spill)
+	if os.IsNotExist(err) {
+		err = errors.Wrapf(ErrAsyncQueryNotFound, "job: %s", id)
+		return
+	} else if err != nil {
+		return
+	}
+	response = &types.Response{}
+	if err = utils.DecodeMsgPack(data, response); err != nil {
+		response = nil
+	}
+	return
+}
+
+// cancel interrupts the running job, or discards the result of the finished job.
+func (a *asyncQueries) cancel(owner proto.NodeID, dbID proto.DatabaseID, id string) (
+	status types.AsyncQueryStatus, err error,
+) {
+	a.Lock()
+	defer a.Unlock()
+	var job *asyncQuery
+	if job, err = a.lookup(owner, dbID, id); err != nil {
+		return
+	}
+	if job.status.State.Finished() {
+		a.release(job)
+	} else {
+		job.canceled = true
+		job.cancel()
+	}
+	status = job.status
+	return
+}
+
+// stop interrupts all the running jobs, and discards the finished ones.
+func (a *asyncQueries) stop() {
+	a.Lock()
+	defer a.Unlock()
+	for _, job := range a.jobs {
+		if job.status.State.Finished() {
+			a.release(job)
+		} else {
+			job.canceled = true
+			job.cancel()
+		}
+	}
+}
+
+// SubmitAsyncQuery runs the read query in background for long-running analytical queries, the
+// client polls the returned job for the result.
+func (dbms *DBMS) SubmitAsyncQuery(req *types.Request) (status types.AsyncQueryStatus, err error) {
+	if req.Header.QueryType != types.ReadQuery {
+		err = errors.Wrap(ErrInvalidRequest, "only read query could run asynchronously")
+		return
+	}
+	if _, ok := dbms.getMeta(req.Header.DatabaseID); !ok {
+		err = ErrNotExists
+		return
+	}
+	// fail fast instead of failing the job, it's checked again by Query
+	addr, err := crypto.PubKeyHash(req.Header.Signee)
+	if err != nil {
+		return
+	}
+	err = dbms.checkPermission(addr, req.Header.DatabaseID, types.ReadQuery, req.Payload.Queries)
+	if err != nil {
+		return
+	}
+	// the job is owned by the node authenticated by the rpc layer, as its later lookups are
+	return dbms.async.submit(req.GetNodeID().ToNodeID(), req, dbms.Query)
+}
+
+// AsyncQueryStatus returns the status of an asynchronous query submitted by the requesting node.
+func (dbms *DBMS) AsyncQueryStatus(req *types.AsyncQueryReq) (status types.AsyncQueryStatus, err error) {
+	status, _, err = dbms.async.get(req.GetNodeID().ToNodeID(), req.DatabaseID, req.JobID)
+	return
+}
+
+// FetchAsyncQuery returns the status of an asynchronous query submitted by the requesting node,
+// and the response once the query is succeeded. The result could be fetched repeatedly until it
+// expires or is discarded.
+func (dbms *DBMS) FetchAsyncQuery(req *types.AsyncQueryReq) (
+	status types.AsyncQueryStatus, response *types.Response, err error,
+) {
+	return dbms.async.get(req.GetNodeID().ToNodeID(), req.DatabaseID, req.JobID)
+}
+
+// CancelAsyncQuery cancels a running asynchronous query submitted by the requesting node, or
+// discards its result if it's finished.
+func (dbms *DBMS) CancelAsyncQuery(req *types.AsyncQueryReq) (status types.AsyncQueryStatus, err error) {
+	return dbms.async.cancel(req.GetNodeID().ToNodeID(), req.DatabaseID, req.JobID)
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestAsyncQueries(t *testing.T) {
+	Convey("test async queries", t, func() {
+		var (
+			a       = newAsyncQueries(1, 2, 0, time.Minute, "")
+			release = make(chan struct{})
+			newReq  = func(node proto.NodeID) *types.Request {
+				req := &types.Request{}
+				req.Header.NodeID = node
+				req.Header.DatabaseID = "db"
+				req.Header.QueryType = types.ReadQuery
+				return req
+			}
+			exec = func(req *types.Request) (*types.Response, error) {
+				select {
+				case <-release:
+				case <-req.GetContext().Done():
+					return nil, req.GetContext().Err()
+				}
+				resp := &types.Response{}
+				resp.Payload.Rows = make([]types.ResponseRow, 3)
+				return resp, nil
+			}
+			waitFinished = func(node proto.NodeID, id string) (status types.AsyncQueryStatus) {
+				for i := 0; i < 100; i++ {
+					if status, _, _ = a.get(node, "db", id); status.State.Finished() {
+						break
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+				return
+			}
+		)
+		status, err := a.submit("node", newReq("node"), exec)
+		So(err, ShouldBeNil)
+		So(status.JobID, ShouldNotBeEmpty)
+		So(status.State, ShouldEqual, types.AsyncQueryRunning)
+
+		Convey("running queries of each node should be limited", func() {
+			_, err := a.submit("node", newReq("node"), exec)
+			So(errors.Cause(err), ShouldEqual, ErrTooManyAsyncQueries)
+			_, err = a.submit("other", newReq("other"), exec)
+			So(err, ShouldBeNil)
+			close(release)
+		})
+		Convey("job should only be visible to its owner", func() {
+			_, _, err := a.get("other", "db", status.JobID)
+			So(errors.Cause(err), ShouldEqual, ErrAsyncQueryNotFound)
+			_, err = a.cancel("other", "db", status.JobID)
+			So(errors.Cause(err), ShouldEqual, ErrAsyncQueryNotFound)
+			_, _, err = a.get("node", "other-db", status.JobID)
+			So(errors.Cause(err), ShouldEqual, ErrAsyncQueryNotFound)
+			close(release)
+		})
+		Convey("result should be fetched repeatedly until discarded", func() {
+			close(release)
+			So(waitFinished("node", status.JobID).State, ShouldEqual, types.AsyncQuerySucceeded)
+			for i := 0; i < 2; i++ {
+				s, resp, err := a.get("node", "db", status.JobID)
+				So(err, ShouldBeNil)
+				So(s.Rows, ShouldEqual, 3)
+				So(resp, ShouldNotBeNil)
+			}
+			_, err := a.cancel("node", "db", status.JobID)
+			So(err, ShouldBeNil)
+			_, _, err = a.get("node", "db", status.JobID)
+			So(errors.Cause(err), ShouldEqual, ErrAsyncQueryNotFound)
+		})
+		Convey("running query should be canceled", func() {
+			_, err := a.cancel("node", "db", status.JobID)
+			So(err, ShouldBeNil)
+			s := waitFinished("node", status.JobID)
+			So(s.State, ShouldEqual, types.AsyncQueryCanceled)
+			_, resp, err := a.get("node", "db", status.JobID)
+			So(err, ShouldBeNil)
+			So(resp, ShouldBeNil)
+			// the slot of the node is released
+			_, err = a.submit("node", newReq("node"), exec)
+			So(err, ShouldBeNil)
+			close(release)
+		})
+		Convey("retained queries of each node should be limited", func() {
+			close(release)
+			waitFinished("node", status.JobID)
+			next, err := a.submit("node", newReq("node"), exec)
+			So(err, ShouldBeNil)
+			waitFinished("node", next.JobID)
+			_, err = a.submit("node", newReq("node"), exec)
+			So(errors.Cause(err), ShouldEqual, ErrTooManyAsyncQueries)
+			// the slot is released by discarding the result
+			_, err = a.cancel("node", "db", next.JobID)
+			So(err, ShouldBeNil)
+			_, err = a.submit("node", newReq("node"), exec)
+			So(err, ShouldBeNil)
+		})
+		Convey("retained result bytes of each node should be limited", func() {
+			close(release)
+			size := waitFinished("node", status.JobID)
+			So(size.State, ShouldEqual, types.AsyncQuerySucceeded)
+			a.maxBytes = a.bytes["node"] + 1
+			next, err := a.submit("node", newReq("node"), exec)
+			So(err, ShouldBeNil)
+			s := waitFinished("node", next.JobID)
+			So(s.State, ShouldEqual, types.AsyncQueryFailed)
+			So(s.Error, ShouldContainSubstring, "exceeds the retained limit")
+			_, err = a.cancel("node", "db", status.JobID)
+			So(err, ShouldBeNil)
+			So(a.bytes, ShouldBeEmpty)
+		})
+		Convey("large result should be spilled to disk", func() {
+			dir, err := ioutil.TempDir("", "async-query-")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			a.spillDir, a.spillSize = dir, 0
+			close(release)
+			So(waitFinished("node", status.JobID).State, ShouldEqual, types.AsyncQuerySucceeded)
+			files, err := ioutil.ReadDir(dir)
+			So(err, ShouldBeNil)
+			So(files, ShouldHaveLength, 1)
+			s, resp, err := a.get("node", "db", status.JobID)
+			So(err, ShouldBeNil)
+			So(s.Rows, ShouldEqual, 3)
+			So(resp, ShouldNotBeNil)
+			So(resp.Payload.Rows, ShouldHaveLength, 3)
+			_, err = a.cancel("node", "db", status.JobID)
+			So(err, ShouldBeNil)
+			files, err = ioutil.ReadDir(dir)
+			So(err, ShouldBeNil)
+			So(files, ShouldBeEmpty)
+		})
+		Convey("finished query should expire", func() {
+			close(release)
+			waitFinished("node", status.JobID)
+			a.ttl = 0
+			time.Sleep(time.Millisecond)
+			_, _, err := a.get("node", "db", status.JobID)
+			So(errors.Cause(err), ShouldEqual, ErrAsyncQueryNotFound)
+		})
+	})
+}
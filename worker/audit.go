@@ -0,0 +1,81 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+// MaxFetchBlockHeaders defines the max number of block headers fetched in one request.
+const MaxFetchBlockHeaders = 1000
+
+// QueryProof returns the inclusion proof of the query at the position of the sqlchain, the proof
+// carries the signed block header and response header only, so auditors are allowed to query.
+func (dbms *DBMS) QueryProof(req *types.QueryProofReq) (proof *types.ReceiptProof, err error) {
+	db, ok := dbms.getMeta(req.DatabaseID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	var b *types.Block
+	if b, err = db.chain.FetchBlock(req.Height); err != nil {
+		return
+	}
+	if b == nil {
+		err = errors.Wrapf(ErrNotExists, "block at height %d", req.Height)
+		return
+	}
+	if proof, ok = b.QueryProof(req.Height, req.Index); !ok {
+		err = errors.Wrapf(ErrNotExists, "query %d in block at height %d", req.Index, req.Height)
+	}
+	return
+}
+
+// FetchBlockHeaders returns the signed block headers in the height range and the head height of
+// the sqlchain.
+func (dbms *DBMS) FetchBlockHeaders(req *types.FetchBlockHeadersReq) (
+	headers []*types.HeightHeader, head int32, err error) {
+	db, ok := dbms.getMeta(req.DatabaseID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	if req.From < 0 || req.To < req.From {
+		err = errors.Wrapf(ErrInvalidRequest, "invalid height range [%d, %d]", req.From, req.To)
+		return
+	}
+	to := req.To
+	if to-req.From >= MaxFetchBlockHeaders {
+		to = req.From + MaxFetchBlockHeaders - 1
+	}
+	if _, head = db.chain.Head(); to > head {
+		to = head
+	}
+	for h := req.From; h <= to; h++ {
+		var b *types.Block
+		if b, err = db.chain.FetchBlock(h); err != nil {
+			return
+		}
+		if b == nil {
+			continue
+		}
+		headers = append(headers, &types.HeightHeader{Height: h, Header: b.SignedHeader})
+	}
+	return
+}
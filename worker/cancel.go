@@ -0,0 +1,58 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package worker
+
+import (
+	"context"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+// trackQuery registers the cancel function of a running read query, the returned function
+// deregisters the query and releases its context.
+func (db *Database) trackQuery(key types.QueryKey, cancel context.CancelFunc) (untrack func()) {
+	db.running.Store(key, cancel)
+	return func() {
+		db.running.Delete(key)
+		cancel()
+	}
+}
+
+// CancelQuery interrupts the running read query, it reports whether the query is found.
+func (db *Database) CancelQuery(key types.QueryKey) (canceled bool) {
+	rawCancel, ok := db.running.Load(key)
+	if !ok {
+		return false
+	}
+	rawCancel.(context.CancelFunc)()
+	return true
+}
+
+// CancelQuery cancels a running read query issued by the requesting node, queries of other nodes
+// are never touched.
+func (dbms *DBMS) CancelQuery(req *types.CancelQueryReq) (canceled bool, err error) {
+	db, ok := dbms.getMeta(req.DatabaseID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	canceled = db.CancelQuery(types.QueryKey{
+		NodeID:       req.GetNodeID().ToNodeID(),
+		ConnectionID: req.ConnectionID,
+		SeqNo:        req.SeqNo,
+	})
+	return
+}
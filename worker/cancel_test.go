@@ -0,0 +1,50 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package worker
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestCancelQuery(t *testing.T) {
+	Convey("test cancel running query", t, func() {
+		var (
+			db  = &Database{}
+			key = types.QueryKey{
+				NodeID:       proto.NodeID("0000000000000000000000000000000000000000000000000000000000000001"),
+				ConnectionID: 1,
+				SeqNo:        2,
+			}
+			other = types.QueryKey{NodeID: key.NodeID, ConnectionID: 1, SeqNo: 3}
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		untrack := db.trackQuery(key, cancel)
+
+		So(db.CancelQuery(other), ShouldBeFalse)
+		So(ctx.Err(), ShouldBeNil)
+		So(db.CancelQuery(key), ShouldBeTrue)
+		So(ctx.Err(), ShouldEqual, context.Canceled)
+
+		untrack()
+		So(db.CancelQuery(key), ShouldBeFalse)
+	})
+}
@@ -23,15 +23,21 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/SQLess/SQLess/blockproducer/interfaces"
 	"github.com/SQLess/SQLess/chainbus"
 	"github.com/SQLess/SQLess/proto"
 	"github.com/SQLess/SQLess/route"
 	rpc "github.com/SQLess/SQLess/rpc/mux"
 	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/clock"
 	"github.com/SQLess/SQLess/utils/log"
 )
 
+// ClockSkewCheckInterval defines the interval of clock skew checking against block producer.
+const ClockSkewCheckInterval = time.Minute
+
 // BusService defines the man chain bus service type.
 type BusService struct {
 	chainbus.Bus
@@ -47,8 +53,12 @@ type BusService struct {
 
 	lock             sync.RWMutex // a lock for the map
 	blockCount       uint32
+	stateVersion     uint64 // increased on every change of the profiles
 	sqlChainProfiles map[proto.DatabaseID]*types.SQLChainProfile
 	sqlChainState    map[proto.DatabaseID]map[proto.AccountAddress]*types.PermStat
+	pinnedProfiles   map[proto.DatabaseID]*types.SQLChainProfile
+
+	clockSkew *clock.SkewDetector
 }
 
 // NewBusService creates a new chain bus instance.
@@ -64,6 +74,7 @@ func NewBusService(
 		cancel:        ccl,
 		checkInterval: checkInterval,
 		localAddress:  addr,
+		clockSkew:     clock.NewSkewDetector(clock.MaxSkew()),
 	}
 	// State initialization: fetch last block and update fields `blockCount` and `sqlChainProfiles`
 	var _, profiles, count = bs.requestLastBlock()
@@ -91,6 +102,13 @@ func (bs *BusService) updateState(count uint32, profiles []*types.SQLChainProfil
 	)
 	for _, v := range profiles {
 		rebuilt[v.ID] = v
+		// the chain catches up with the pinned profile
+		delete(bs.pinnedProfiles, v.ID)
+	}
+	for _, v := range bs.pinnedProfiles {
+		rebuilt[v.ID] = v
+	}
+	for _, v := range rebuilt {
 		sqlchainState[v.ID] = make(map[proto.AccountAddress]*types.PermStat)
 		for _, user := range v.Users {
 			sqlchainState[v.ID][user.Address] = &types.PermStat{
@@ -102,6 +120,7 @@ func (bs *BusService) updateState(count uint32, profiles []*types.SQLChainProfil
 	atomic.StoreUint32(&bs.blockCount, count)
 	bs.sqlChainProfiles = rebuilt
 	bs.sqlChainState = sqlchainState
+	bs.stateVersion++
 }
 
 func (bs *BusService) subscribeBlock(ctx context.Context) {
@@ -186,6 +205,9 @@ func (bs *BusService) requestLastBlock() (
 	block = resp.Block
 	profiles = resp.SQLChains
 	count = resp.Count
+
+	// Refresh revoked node identities
+	route.SetRevokedNodes(resp.RevokedNodes)
 	return
 }
 
@@ -197,6 +219,61 @@ func (bs *BusService) RequestSQLProfile(dbID proto.DatabaseID) (p *types.SQLChai
 	return
 }
 
+// pinSQLProfile keeps the profile of a database served by the local miner but not assigned to it
+// on chain yet, e.g. a promoted standby, until the profile is returned by block producers.
+func (bs *BusService) pinSQLProfile(p *types.SQLChainProfile) {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	if bs.pinnedProfiles == nil {
+		bs.pinnedProfiles = make(map[proto.DatabaseID]*types.SQLChainProfile)
+	}
+	bs.pinnedProfiles[p.ID] = p
+	if bs.sqlChainProfiles == nil {
+		bs.sqlChainProfiles = make(map[proto.DatabaseID]*types.SQLChainProfile)
+	}
+	if bs.sqlChainState == nil {
+		bs.sqlChainState = make(map[proto.DatabaseID]map[proto.AccountAddress]*types.PermStat)
+	}
+	bs.sqlChainProfiles[p.ID] = p
+	bs.sqlChainState[p.ID] = make(map[proto.AccountAddress]*types.PermStat)
+	for _, user := range p.Users {
+		bs.sqlChainState[p.ID][user.Address] = &types.PermStat{
+			Permission: user.Permission,
+			Status:     user.Status,
+		}
+	}
+	bs.stateVersion++
+}
+
+// querySQLProfile queries the profile of any database from block producers, unlike
+// RequestSQLProfile the database is not required to be served by the local miner.
+func (bs *BusService) querySQLProfile(dbID proto.DatabaseID) (p *types.SQLChainProfile, err error) {
+	var (
+		req  = &types.QuerySQLChainProfileReq{DBID: dbID}
+		resp = &types.QuerySQLChainProfileResp{}
+	)
+	if err = bs.requestBP(route.MCCQuerySQLChainProfile.String(), req, resp); err != nil {
+		err = errors.Wrap(err, "query sqlchain profile failed")
+		return
+	}
+	p = &resp.Profile
+	return
+}
+
+// queryDatasetProfile queries the dataset versions published for the database from block producers.
+func (bs *BusService) queryDatasetProfile(dbID proto.DatabaseID) (p *types.DatasetProfile, err error) {
+	var (
+		req  = &types.QueryDatasetReq{DatabaseID: dbID}
+		resp = &types.QueryDatasetResp{}
+	)
+	if err = bs.requestBP(route.MCCQueryDataset.String(), req, resp); err != nil {
+		err = errors.Wrap(err, "query dataset profile failed")
+		return
+	}
+	p = &resp.Profile
+	return
+}
+
 // RequestPermStat fetches permission state from bus service.
 func (bs *BusService) RequestPermStat(
 	dbID proto.DatabaseID, user proto.AccountAddress) (permStat *types.PermStat, ok bool,
@@ -210,6 +287,28 @@ func (bs *BusService) RequestPermStat(
 	return
 }
 
+// requestVersionedPermStat returns the permission state of the user with the version of the
+// profiles it is read from.
+func (bs *BusService) requestVersionedPermStat(
+	dbID proto.DatabaseID, user proto.AccountAddress) (permStat *types.PermStat, version uint64, ok bool,
+) {
+	bs.lock.RLock()
+	defer bs.lock.RUnlock()
+	version = bs.stateVersion
+	userState, ok := bs.sqlChainState[dbID]
+	if ok {
+		permStat, ok = userState[user]
+	}
+	return
+}
+
+// currentStateVersion returns the version of the profiles.
+func (bs *BusService) currentStateVersion() uint64 {
+	bs.lock.RLock()
+	defer bs.lock.RUnlock()
+	return bs.stateVersion
+}
+
 func (bs *BusService) requestBP(method string, request interface{}, response interface{}) (err error) {
 	var bpNodeID proto.NodeID
 	if bpNodeID, err = rpc.GetCurrentBP(); err != nil {
@@ -235,10 +334,49 @@ func (bs *BusService) unwrapTx(tx interfaces.Transaction) interfaces.Transaction
 	}
 }
 
+// checkClockSkew periodically samples the local time of block producer to detect the local
+// clock skew.
+func (bs *BusService) checkClockSkew(ctx context.Context) {
+	defer bs.wg.Done()
+
+	ticker := time.NewTicker(ClockSkewCheckInterval)
+	defer ticker.Stop()
+	for {
+		var (
+			bpNodeID proto.NodeID
+			req      = &types.QueryTimeReq{}
+			resp     = &types.QueryTimeResp{}
+			sent     = time.Now()
+			err      error
+		)
+		if bpNodeID, err = rpc.GetCurrentBP(); err == nil {
+			err = bs.caller.CallNode(bpNodeID, route.MCCQueryTime.String(), req, resp)
+		}
+		if err != nil {
+			log.WithError(err).Debug("query block producer time failed")
+		} else {
+			bs.clockSkew.AddSample(bpNodeID, sent, resp.Time, time.Now())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ClockSkewExceeded returns whether the local clock skew against block producer exceeds the
+// max tolerable skew.
+func (bs *BusService) ClockSkewExceeded() bool {
+	return bs.clockSkew.Exceeded()
+}
+
 // Start starts a chain bus service.
 func (bs *BusService) Start() {
-	bs.wg.Add(1)
+	bs.wg.Add(2)
 	go bs.subscribeBlock(bs.ctx)
+	go bs.checkClockSkew(bs.ctx)
 }
 
 // Stop stops the chain bus service.
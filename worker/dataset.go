@@ -0,0 +1,424 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	rpc "github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DatasetDirName defines the directory name of the read-only datasets published by the owner.
+	DatasetDirName = "datasets"
+	// DatasetSyncInterval defines the interval of syncing the datasets published on chain.
+	DatasetSyncInterval = 10 * time.Minute
+	// DatasetGrace defines how long a prepared dataset is kept for the owner to publish it.
+	DatasetGrace = 24 * time.Hour
+	// DatasetRefreshInterval defines the min interval of refreshing the published datasets on
+	// the requests of unknown content hashes.
+	DatasetRefreshInterval = 10 * time.Second
+)
+
+func datasetFile(dataDir string, contentHash hash.Hash) string {
+	return filepath.Join(dataDir, DatasetDirName, contentHash.String()+snapshotFileSuffix)
+}
+
+// prepareDataset pins the latest snapshot of the database as a dataset, the pinned dataset
+// file is removed if it's not published on chain within the grace period.
+func (db *Database) prepareDataset(ctx context.Context) (info *types.SnapshotInfo, err error) {
+	var s *preparedSnapshot
+	if s, err = db.prepareSnapshot(ctx); err != nil {
+		return
+	}
+	filename := datasetFile(db.cfg.DataDir, s.info.ID)
+	if _, err = os.Stat(filename); err == nil {
+		// restart the grace period of the pinned dataset
+		now := time.Now()
+		err = os.Chtimes(filename, now, now)
+		info = &s.info
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return
+	}
+	tmpFile := filename + ".tmp"
+	if _, err = utils.CopyFile(s.filename, tmpFile); err != nil {
+		return
+	}
+	if err = os.Rename(tmpFile, filename); err != nil {
+		return
+	}
+	log.WithFields(log.Fields{
+		"db":     db.dbID,
+		"hash":   s.info.ID.String(),
+		"size":   s.info.Size,
+		"height": s.info.Height,
+	}).Info("pinned dataset snapshot")
+	info = &s.info
+	return
+}
+
+// readDatasetChunk reads a chunk of the pinned dataset.
+func (db *Database) readDatasetChunk(contentHash hash.Hash, offset uint64) (size uint64, data []byte, err error) {
+	var (
+		f  *os.File
+		fi os.FileInfo
+	)
+	if f, err = os.Open(datasetFile(db.cfg.DataDir, contentHash)); err != nil {
+		if os.IsNotExist(err) {
+			err = errors.Wrapf(ErrNotExists, "dataset %s not found", contentHash.String())
+		}
+		return
+	}
+	defer f.Close()
+	if fi, err = f.Stat(); err != nil {
+		return
+	}
+	if size = uint64(fi.Size()); offset > size {
+		err = errors.Wrapf(ErrInvalidRequest, "invalid dataset offset %d", offset)
+		return
+	}
+	n := size - offset
+	if n > SnapshotChunkSize {
+		n = SnapshotChunkSize
+	}
+	data = make([]byte, n)
+	_, err = f.ReadAt(data, int64(offset))
+	return
+}
+
+// datasetKeeper keeps the datasets of a database in line with the versions published on chain:
+// the published versions missing locally are fetched from the other miners, the prepared
+// datasets not published within the grace period are removed, and only the published datasets
+// are served.
+type datasetKeeper struct {
+	db       *Database
+	interval time.Duration
+	grace    time.Duration
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+
+	mu        sync.Mutex
+	published map[hash.Hash]*types.DatasetVersion
+	refreshed time.Time
+}
+
+func newDatasetKeeper(db *Database) *datasetKeeper {
+	return &datasetKeeper{
+		db:        db,
+		interval:  DatasetSyncInterval,
+		grace:     DatasetGrace,
+		stopCh:    make(chan struct{}),
+		published: make(map[hash.Hash]*types.DatasetVersion),
+	}
+}
+
+func (k *datasetKeeper) start() {
+	k.wg.Add(1)
+	go func() {
+		defer k.wg.Done()
+		ticker := time.NewTicker(k.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-k.stopCh:
+				return
+			case <-ticker.C:
+				if err := k.sync(); err != nil {
+					log.WithField("db", k.db.dbID).WithError(err).Warning(
+						"sync published datasets failed")
+				}
+			}
+		}
+	}()
+}
+
+func (k *datasetKeeper) stop() {
+	select {
+	case <-k.stopCh:
+	default:
+		close(k.stopCh)
+	}
+	k.wg.Wait()
+}
+
+// refresh reloads the dataset versions published on chain.
+func (k *datasetKeeper) refresh() (versions []*types.DatasetVersion, err error) {
+	if k.db.cfg.QueryDataset == nil {
+		err = errors.Wrap(ErrNotExists, "no dataset source")
+		return
+	}
+	var profile *types.DatasetProfile
+	if profile, err = k.db.cfg.QueryDataset(k.db.dbID); err != nil {
+		return
+	}
+	var published = make(map[hash.Hash]*types.DatasetVersion, len(profile.Versions))
+	for _, v := range profile.Versions {
+		published[v.ContentHash] = v
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.published = published
+	k.refreshed = time.Now()
+	return profile.Versions, nil
+}
+
+// isPublished reports whether the content hash is published on chain, the published versions
+// are refreshed on unknown hashes at most once per DatasetRefreshInterval.
+func (k *datasetKeeper) isPublished(h hash.Hash) bool {
+	k.mu.Lock()
+	_, ok := k.published[h]
+	stale := time.Since(k.refreshed) > DatasetRefreshInterval
+	if !ok && stale {
+		// claim the refresh, so that concurrent requests do not flood the block producers
+		k.refreshed = time.Now()
+	}
+	k.mu.Unlock()
+	if ok || !stale {
+		return ok
+	}
+	if _, err := k.refresh(); err != nil {
+		log.WithField("db", k.db.dbID).WithError(err).Debug("refresh published datasets failed")
+		return false
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	_, ok = k.published[h]
+	return ok
+}
+
+// sync fetches the published datasets missing locally and removes the expired unpublished ones.
+func (k *datasetKeeper) sync() (err error) {
+	var versions []*types.DatasetVersion
+	if versions, err = k.refresh(); err != nil {
+		return
+	}
+	for _, v := range versions {
+		filename := datasetFile(k.db.cfg.DataDir, v.ContentHash)
+		if _, serr := os.Stat(filename); serr == nil {
+			continue
+		}
+		if k.db.cfg.FetchDataset == nil {
+			break
+		}
+		if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return
+		}
+		if err = k.db.cfg.FetchDataset(k.db.dbID, v, filename); err != nil {
+			return
+		}
+		log.WithFields(log.Fields{
+			"db":      k.db.dbID,
+			"version": v.Version,
+			"hash":    v.ContentHash.String(),
+		}).Info("fetched published dataset from peers")
+	}
+	var removed int
+	if removed, err = k.collect(time.Now()); err != nil {
+		return
+	}
+	if removed > 0 {
+		log.WithFields(log.Fields{
+			"db":      k.db.dbID,
+			"removed": removed,
+		}).Info("removed unpublished datasets")
+	}
+	return
+}
+
+// collect removes the dataset files which are not published on chain and older than the grace
+// period, including the leftovers of the interrupted transfers.
+func (k *datasetKeeper) collect(now time.Time) (removed int, err error) {
+	var (
+		dir   = filepath.Join(k.db.cfg.DataDir, DatasetDirName)
+		files []os.FileInfo
+	)
+	if files, err = ioutil.ReadDir(dir); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, fi := range files {
+		if fi.IsDir() || now.Sub(fi.ModTime()) < k.grace {
+			continue
+		}
+		if strings.HasSuffix(fi.Name(), snapshotFileSuffix) {
+			h, herr := hash.NewHashFromStr(strings.TrimSuffix(fi.Name(), snapshotFileSuffix))
+			if herr == nil && k.published[*h] != nil {
+				continue
+			}
+		}
+		if err = os.Remove(filepath.Join(dir, fi.Name())); err != nil {
+			return
+		}
+		removed++
+	}
+	return
+}
+
+// PrepareDataset exports and pins a snapshot of the database for the owner to publish, the
+// content hash of the snapshot is recorded on chain by the owner afterwards.
+func (dbms *DBMS) PrepareDataset(req *types.PrepareDatasetReq) (info *types.SnapshotInfo, err error) {
+	var (
+		dbID    = req.Header.DatabaseID
+		addr    proto.AccountAddress
+		profile *types.SQLChainProfile
+	)
+	if err = req.Header.Verify(); err != nil {
+		return
+	}
+	if gap := time.Since(req.Header.Timestamp); gap > dbms.cfg.MaxReqTimeGap ||
+		gap < -dbms.cfg.MaxReqTimeGap {
+		err = errors.Wrap(ErrInvalidRequest, "invalid request time")
+		return
+	}
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		return
+	}
+	if profile, err = dbms.busService.querySQLProfile(dbID); err != nil {
+		return
+	}
+	if profile.Owner != addr {
+		err = errors.Wrapf(ErrPermissionDeny, "%s is not owner of database %s",
+			addr.String(), dbID)
+		return
+	}
+	db, ok := dbms.getMeta(dbID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	return db.prepareDataset(context.Background())
+}
+
+// FetchDatasetChunk serves chunks of the published datasets to anyone, the receiver verifies
+// the content hash against the one recorded on chain. The datasets prepared but not published
+// yet are not served.
+func (dbms *DBMS) FetchDatasetChunk(req *types.FetchDatasetChunkReq) (resp *types.FetchDatasetChunkResp, err error) {
+	db, ok := dbms.getMeta(req.DatabaseID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	if !db.datasets.isPublished(req.ContentHash) {
+		err = errors.Wrapf(ErrNotExists, "dataset %s not published", req.ContentHash.String())
+		return
+	}
+	resp = &types.FetchDatasetChunkResp{}
+	resp.Size, resp.Data, err = db.readDatasetChunk(req.ContentHash, req.Offset)
+	return
+}
+
+// fetchDatasetFromPeers downloads the published dataset from the other miners of the database
+// to filename, the downloaded file is verified against the content hash recorded on chain.
+func (dbms *DBMS) fetchDatasetFromPeers(
+	dbID proto.DatabaseID, dv *types.DatasetVersion, filename string,
+) (err error) {
+	profile, ok := dbms.busService.RequestSQLProfile(dbID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	err = errors.Wrapf(ErrNotExists, "no peer has dataset %s", dv.ContentHash.String())
+	for _, mi := range profile.Miners {
+		if mi.Address == dbms.address {
+			continue
+		}
+		if ferr := fetchDatasetFrom(mi.NodeID, dbID, dv, filename); ferr != nil {
+			log.WithFields(log.Fields{
+				"db":   dbID,
+				"node": mi.NodeID,
+				"hash": dv.ContentHash.String(),
+			}).WithError(ferr).Debug("fetch dataset from peer failed")
+			continue
+		}
+		return nil
+	}
+	return
+}
+
+func fetchDatasetFrom(
+	node proto.NodeID, dbID proto.DatabaseID, dv *types.DatasetVersion, filename string,
+) (err error) {
+	var (
+		caller = rpc.NewCaller()
+		req    = &types.FetchDatasetChunkReq{
+			DatabaseID:  dbID,
+			ContentHash: dv.ContentHash,
+		}
+		tmpFile = filename + ".part"
+		f       *os.File
+		actual  hash.Hash
+	)
+	if f, err = os.OpenFile(tmpFile, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644); err != nil {
+		return
+	}
+	defer func() {
+		_ = f.Close()
+		if err != nil {
+			_ = os.Remove(tmpFile)
+		}
+	}()
+	for req.Offset < dv.Size {
+		resp := &types.FetchDatasetChunkResp{}
+		if err = caller.CallNode(node, route.DBSFetchDatasetChunk.String(), req, resp); err != nil {
+			return
+		}
+		if len(resp.Data) == 0 {
+			err = errors.Errorf("unexpected end of dataset at offset %d", req.Offset)
+			return
+		}
+		if _, err = f.WriteAt(resp.Data, int64(req.Offset)); err != nil {
+			return
+		}
+		req.Offset += uint64(len(resp.Data))
+	}
+	if _, err = f.Seek(0, 0); err != nil {
+		return
+	}
+	if actual, _, err = hash.THashReader(f); err != nil {
+		return
+	}
+	if !actual.IsEqual(&dv.ContentHash) {
+		err = errors.Errorf("dataset hash not match, expected %s, actual %s",
+			dv.ContentHash.String(), actual.String())
+		return
+	}
+	if err = f.Sync(); err != nil {
+		return
+	}
+	return os.Rename(tmpFile, filename)
+}
@@ -0,0 +1,120 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestDatasetKeeper(t *testing.T) {
+	Convey("Given a dataset keeper with some prepared datasets", t, func() {
+		dataDir, err := ioutil.TempDir("", "dataset_test_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dataDir)
+		So(os.MkdirAll(filepath.Join(dataDir, DatasetDirName), 0755), ShouldBeNil)
+
+		var (
+			published = hash.THashH([]byte("published"))
+			missing   = hash.THashH([]byte("missing"))
+			fresh     = hash.THashH([]byte("fresh"))
+			expired   = hash.THashH([]byte("expired"))
+			queries   int
+			fetched   []hash.Hash
+			profile   = &types.DatasetProfile{
+				Versions: []*types.DatasetVersion{
+					{Version: 1, ContentHash: published},
+					{Version: 2, ContentHash: missing},
+				},
+			}
+			db = &Database{
+				dbID: proto.DatabaseID("db"),
+				cfg: &DBConfig{
+					DataDir: dataDir,
+					QueryDataset: func(proto.DatabaseID) (*types.DatasetProfile, error) {
+						queries++
+						return profile, nil
+					},
+					FetchDataset: func(
+						_ proto.DatabaseID, dv *types.DatasetVersion, filename string,
+					) error {
+						fetched = append(fetched, dv.ContentHash)
+						return ioutil.WriteFile(filename, []byte("fetched"), 0644)
+					},
+				},
+			}
+			k   = newDatasetKeeper(db)
+			old = time.Now().Add(-2 * DatasetGrace)
+		)
+		for _, h := range []hash.Hash{published, fresh, expired} {
+			So(ioutil.WriteFile(datasetFile(dataDir, h), []byte("dataset"), 0644), ShouldBeNil)
+		}
+		So(os.Chtimes(datasetFile(dataDir, published), old, old), ShouldBeNil)
+		So(os.Chtimes(datasetFile(dataDir, expired), old, old), ShouldBeNil)
+		leftover := datasetFile(dataDir, missing) + ".part"
+		So(ioutil.WriteFile(leftover, []byte("part"), 0644), ShouldBeNil)
+		So(os.Chtimes(leftover, old, old), ShouldBeNil)
+
+		Convey("Only the published datasets should be served", func() {
+			So(k.isPublished(published), ShouldBeTrue)
+			So(k.isPublished(missing), ShouldBeTrue)
+			So(queries, ShouldEqual, 1)
+			So(k.isPublished(fresh), ShouldBeFalse)
+			So(k.isPublished(expired), ShouldBeFalse)
+			// refreshing on unknown hashes is rate limited
+			So(queries, ShouldEqual, 1)
+			k.refreshed = time.Now().Add(-2 * DatasetRefreshInterval)
+			profile.Versions = append(profile.Versions,
+				&types.DatasetVersion{Version: 3, ContentHash: fresh})
+			So(k.isPublished(fresh), ShouldBeTrue)
+			So(queries, ShouldEqual, 2)
+		})
+		Convey("The missing datasets should be fetched and the expired ones removed", func() {
+			So(k.sync(), ShouldBeNil)
+			So(fetched, ShouldResemble, []hash.Hash{missing})
+			for _, h := range []hash.Hash{published, missing, fresh} {
+				_, err = os.Stat(datasetFile(dataDir, h))
+				So(err, ShouldBeNil)
+			}
+			_, err = os.Stat(datasetFile(dataDir, expired))
+			So(os.IsNotExist(err), ShouldBeTrue)
+			_, err = os.Stat(leftover)
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			// nothing else to fetch or remove
+			So(k.sync(), ShouldBeNil)
+			So(fetched, ShouldHaveLength, 1)
+		})
+		Convey("Nothing should be removed if the published datasets are unknown", func() {
+			db.cfg.QueryDataset = func(proto.DatabaseID) (*types.DatasetProfile, error) {
+				return nil, ErrNotExists
+			}
+			So(k.sync(), ShouldNotBeNil)
+			_, err = os.Stat(datasetFile(dataDir, expired))
+			So(err, ShouldBeNil)
+		})
+	})
+}
@@ -26,6 +26,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/SQLess/SQLess/blob"
 	"github.com/SQLess/SQLess/conf"
 	"github.com/SQLess/SQLess/crypto"
 	"github.com/SQLess/SQLess/crypto/asymmetric"
@@ -48,6 +49,10 @@ const (
 	// KayakWalFileName defines log pool name of database instance.
 	KayakWalFileName = "kayak.ldb"
 
+	// KayakAppliedFileName defines the file of the kayak log index applied to the storage
+	// restored from a snapshot.
+	KayakAppliedFileName = "kayak.applied"
+
 	// SQLChainFileName defines sqlchain storage file name.
 	SQLChainFileName = "chain.db"
 
@@ -78,9 +83,22 @@ type Database struct {
 	cfg            *DBConfig
 	dbID           proto.DatabaseID
 	kayakWal       *kl.LevelDBWal
+	blobs          *blob.Store
+	blobGC         *blobCollector
+	datasets       *datasetKeeper
+	walArchiver    *walArchiver
+	digester       *stateDigester
+	snapshots      snapshots
+	maintenance    func() (enabled bool, reason string, err error)
+	rekey          *rekeyJob
+	shipper        *snapshotShipper
+	firewall       *sqlFirewall
+	throttle       *ioThrottle
+	writes         *idempotencyCache
 	kayakRuntime   *kayak.Runtime
 	kayakConfig    *kt.RuntimeConfig
 	connSeqs       sync.Map
+	running        sync.Map // types.QueryKey -> context.CancelFunc
 	connSeqEvictCh chan uint64
 	chain          *sqlchain.Chain
 	nodeID         proto.NodeID
@@ -119,6 +137,8 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers,
 		dbID:           cfg.DatabaseID,
 		mux:            cfg.KayakMux,
 		connSeqEvictCh: make(chan uint64, 1),
+		throttle:       newIOThrottle(cfg.IOLimit),
+		writes:         newIdempotencyCache(),
 		privateKey:     privateKey,
 		accountAddr:    accountAddr,
 	}
@@ -131,6 +151,27 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers,
 				db.kayakRuntime.Shutdown()
 			}
 
+			// stop state digest comparison
+			if db.digester != nil {
+				db.digester.stop()
+			}
+
+			// stop wal archiving
+			if db.walArchiver != nil {
+				db.walArchiver.stop()
+			}
+
+			// stop blob collection and close blob store
+			if db.blobGC != nil {
+				db.blobGC.stop()
+			}
+			if db.datasets != nil {
+				db.datasets.stop()
+			}
+			if db.blobs != nil {
+				db.blobs.Close()
+			}
+
 			// close chain
 			if db.chain != nil {
 				db.chain.Stop()
@@ -138,15 +179,26 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers,
 		}
 	}()
 
-	// init storage
-	storageFile := filepath.Join(cfg.DataDir, StorageFileName)
-	storageDSN, err := storage.NewDSN(storageFile)
-	if err != nil {
+	// the maintenance mode is read from the replicated database state
+	db.maintenance = func() (bool, string, error) {
+		return db.chain.Maintenance(context.Background())
+	}
+
+	// init sql firewall, the owner overrides are read from the replicated database state
+	db.firewall = newSQLFirewall(cfg.FirewallRules, func() ([]string, error) {
+		return db.chain.FirewallOverrides(context.Background())
+	})
+
+	// load re-encryption state, the storage may still be encrypted with the previous key
+	if db.rekey, err = newRekeyJob(cfg); err != nil {
+		err = errors.Wrap(err, "load rekey state failed")
 		return
 	}
 
-	if cfg.EncryptionKey != "" {
-		storageDSN.AddParam("_crypto_key", cfg.EncryptionKey)
+	// init storage
+	storageDSN, err := newStorageDSN(cfg, db.rekey.storageKey())
+	if err != nil {
+		return
 	}
 
 	// init chain
@@ -180,13 +232,61 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers,
 		return
 	}
 
+	// init blob chunk store
+	if db.blobs, err = blob.NewStore(filepath.Join(cfg.DataDir, BlobDirName)); err != nil {
+		err = errors.Wrap(err, "init blob store failed")
+		return
+	}
+	db.blobGC = newBlobCollector(db)
+	db.blobGC.start()
+
+	// keep datasets in line with the published versions
+	db.datasets = newDatasetKeeper(db)
+	db.datasets.start()
+
 	// init kayak config
 	kayakWalPath := filepath.Join(cfg.DataDir, KayakWalFileName)
+	_, statErr := os.Stat(kayakWalPath)
 	if db.kayakWal, err = kl.NewLevelDBWal(kayakWalPath); err != nil {
 		err = errors.Wrap(err, "init kayak log pool failed")
 		return
 	}
 
+	// init replica state digest comparison
+	db.digester = newStateDigester(db, peers)
+	db.digester.start()
+
+	// commits before the applied index are already in the storage restored from a snapshot
+	var appliedIndex uint64
+	if appliedIndex, err = readAppliedIndex(cfg.DataDir); err != nil {
+		err = errors.Wrap(err, "load applied log index failed")
+		return
+	}
+
+	// init wal archiving, a new wal is restored from the archive first, so that the database
+	// is recovered even if the disks of all the replicas are lost
+	if cfg.WALArchiveTarget != nil {
+		var archived uint64
+		if os.IsNotExist(statErr) {
+			if archived, appliedIndex, err = db.restoreWALArchive(appliedIndex); err != nil {
+				err = errors.Wrap(err, "restore wal archive failed")
+				return
+			}
+		}
+		if db.walArchiver, err = newWALArchiver(db.dbID, db.kayakWal,
+			cfg.WALArchiveTarget, cfg.WALArchiveInterval, cfg.DataDir); err != nil {
+			err = errors.Wrap(err, "init wal archiver failed")
+			return
+		}
+		if archived > db.walArchiver.next {
+			if err = db.walArchiver.setNext(archived); err != nil {
+				err = errors.Wrap(err, "init wal archiver failed")
+				return
+			}
+		}
+		db.walArchiver.start()
+	}
+
 	db.kayakConfig = &kt.RuntimeConfig{
 		Handler:          db,
 		PrepareThreshold: PrepareThreshold,
@@ -201,6 +301,7 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers,
 		ServiceName:      DBKayakRPCName,
 		ApplyMethodName:  DBKayakApplyMethodName,
 		FetchMethodName:  DBKayakFetchMethodName,
+		AppliedIndex:     appliedIndex,
 	}
 
 	// create kayak runtime
@@ -214,23 +315,87 @@ func NewDatabase(cfg *DBConfig, peers *proto.Peers,
 	// start kayak runtime
 	db.kayakRuntime.Start()
 
+	// resume the interrupted re-encryption if any
+	db.rekey.start(db.chain.Rekey)
+
+	// ship snapshots to the standby miner outside the replication group
+	if cfg.StandbyNode != "" && cfg.StandbyNode != db.nodeID {
+		db.shipper = newSnapshotShipper(db, cfg.StandbyNode, cfg.SnapshotShipInterval)
+		db.shipper.start()
+	}
+
 	// init sequence eviction processor
 	go db.evictSequences()
 
 	return
 }
 
+// newStorageDSN returns the storage dsn of the database encrypted with key.
+func newStorageDSN(cfg *DBConfig, key string) (dsn *storage.DSN, err error) {
+	if dsn, err = storage.NewDSN(filepath.Join(cfg.DataDir, StorageFileName)); err != nil {
+		return
+	}
+	if key != "" {
+		dsn.AddParam("_crypto_key", key)
+	}
+	if cfg.ForeignKeys {
+		// applied on every connection, the mode comes from the database meta so that all
+		// replicas enforce the same constraints
+		dsn.AddParam("_foreign_keys", "1")
+	}
+	return
+}
+
+// checkReadConsistency checks whether the read query could be served on current replica with
+// the leader read and staleness requirements of the database and the request, the request may
+// only tighten the max staleness of the database.
+func (db *Database) checkReadConsistency(request *types.Request) (err error) {
+	var maxStaleness = db.cfg.MaxReadStaleness
+	if request.MaxStaleness > 0 && (maxStaleness <= 0 || request.MaxStaleness < maxStaleness) {
+		maxStaleness = request.MaxStaleness
+	}
+	if !db.cfg.LeaderReadsOnly && maxStaleness <= 0 && request.MaxStaleBlocks <= 0 {
+		return
+	}
+	if db.kayakRuntime.IsLeader() {
+		return
+	}
+	if db.cfg.LeaderReadsOnly {
+		return errors.Wrap(ErrNotLeader, "database serves read queries on leader only")
+	}
+	if staleness := db.chain.Staleness(); maxStaleness > 0 && staleness > maxStaleness {
+		return errors.Wrapf(ErrReplicaTooStale,
+			"replica lags %v behind, max staleness is %v", staleness, maxStaleness)
+	}
+	if lag := db.chain.StaleBlocks(); request.MaxStaleBlocks > 0 && lag > request.MaxStaleBlocks {
+		return errors.Wrapf(ErrReplicaTooStale,
+			"replica lags %d blocks behind, max stale blocks is %d", lag, request.MaxStaleBlocks)
+	}
+	return
+}
+
 // UpdatePeers defines peers update query interface.
 func (db *Database) UpdatePeers(peers *proto.Peers) (err error) {
 	if err = db.kayakRuntime.UpdatePeers(peers); err != nil {
 		return
 	}
+	if db.digester != nil {
+		db.digester.updatePeers(peers)
+	}
 
 	return db.chain.UpdatePeers(peers)
 }
 
 // Query defines database query interface.
 func (db *Database) Query(request *types.Request) (response *types.Response, err error) {
+	// the retried write is applied only once, see idempotency.go
+	if request.Header.QueryType == types.WriteQuery && request.IdempotencyKey != "" && db.writes != nil {
+		return db.writes.do(request, db.query)
+	}
+	return db.query(request)
+}
+
+func (db *Database) query(request *types.Request) (response *types.Response, err error) {
 	// Just need to verify signature in db.saveAck
 	//if err = request.Verify(); err != nil {
 	//	return
@@ -258,11 +423,40 @@ func (db *Database) Query(request *types.Request) (response *types.Response, err
 
 	switch request.Header.QueryType {
 	case types.ReadQuery:
+		if err = db.checkReadConsistency(request); err != nil {
+			return
+		}
+		// the sqlite statement is interrupted on context cancellation
+		ctx, cancel := context.WithCancel(request.GetContext())
+		defer db.trackQuery(request.Header.GetQueryKey(), cancel)()
+		request.SetContext(ctx)
+		if timeout := db.statementTimeout(request); timeout > 0 {
+			ctx, cancel := context.WithTimeout(request.GetContext(), timeout)
+			defer cancel()
+			request.SetContext(ctx)
+		}
 		if tracker, response, err = db.chain.Query(request, false); err != nil {
+			switch request.GetContext().Err() {
+			case context.DeadlineExceeded:
+				err = errors.Wrapf(ErrStatementTimeout, "query interrupted: %v", err)
+				return
+			case context.Canceled:
+				err = errors.Wrapf(ErrQueryCanceled, "query interrupted: %v", err)
+				return
+			}
 			err = errors.Wrap(err, "failed to query read query")
 			return
 		}
 	case types.WriteQuery:
+		// schedule the write within the i/o limit of the database
+		var (
+			ioOps   = len(request.Payload.Queries)
+			ioBytes = estimateWriteBytes(request.Payload.Queries)
+		)
+		if err = db.throttle.wait(request.GetContext(), ioOps, ioBytes); err != nil {
+			return
+		}
+		defer func() { db.throttle.settle(ioOps, ioBytes, tracker) }()
 		if db.cfg.UseEventualConsistency {
 			// reset context
 			request.SetContext(context.Background())
@@ -282,12 +476,19 @@ func (db *Database) Query(request *types.Request) (response *types.Response, err
 	}
 
 	response.Header.ResponseAccount = db.accountAddr
+	_, response.BlockHeight = db.chain.Head()
 
 	// build hash
 	if err = response.BuildHash(); err != nil {
 		err = errors.Wrap(err, "failed to build response hash")
 		return
 	}
+	if request.Header.QueryType == types.WriteQuery {
+		if err = db.signReceipt(request, response); err != nil {
+			err = errors.Wrap(err, "failed to sign write receipt")
+			return
+		}
+	}
 
 	if err = db.chain.AddResponse(&response.Header); err != nil {
 		log.WithError(err).Debug("failed to add response to index")
@@ -298,6 +499,16 @@ func (db *Database) Query(request *types.Request) (response *types.Response, err
 	return
 }
 
+// statementTimeout returns the effective statement timeout of the read request, the request may
+// only lower the default timeout of the database.
+func (db *Database) statementTimeout(request *types.Request) (timeout time.Duration) {
+	timeout = db.cfg.StatementTimeout
+	if request.Timeout > 0 && (timeout == 0 || request.Timeout < timeout) {
+		timeout = request.Timeout
+	}
+	return
+}
+
 func (db *Database) logSlow(request *types.Request, isFinished bool, tmStart time.Time) {
 	if request == nil {
 		return
@@ -345,6 +556,21 @@ func (db *Database) Ack(ack *types.Ack) (err error) {
 
 // Shutdown stop database handles and stop service the database.
 func (db *Database) Shutdown() (err error) {
+	if db.shipper != nil {
+		// stop snapshot shipping
+		db.shipper.stop()
+	}
+
+	if db.rekey != nil {
+		// interrupt re-encryption, it's resumed on next start
+		db.rekey.stop()
+	}
+
+	if db.digester != nil {
+		// stop state digest comparison
+		db.digester.stop()
+	}
+
 	if db.kayakRuntime != nil {
 		// shutdown, stop kayak
 		if err = db.kayakRuntime.Shutdown(); err != nil {
@@ -355,11 +581,31 @@ func (db *Database) Shutdown() (err error) {
 		db.mux.unregister(db.dbID)
 	}
 
+	if db.walArchiver != nil {
+		// ship remaining logs and stop archiving
+		db.walArchiver.stop()
+	}
+
 	if db.kayakWal != nil {
 		// shutdown, stop kayak
 		db.kayakWal.Close()
 	}
 
+	if db.blobGC != nil {
+		// stop collecting blob chunks
+		db.blobGC.stop()
+	}
+
+	if db.datasets != nil {
+		// stop syncing datasets
+		db.datasets.stop()
+	}
+
+	if db.blobs != nil {
+		// close blob chunk store
+		db.blobs.Close()
+	}
+
 	if db.chain != nil {
 		// stop chain
 		if err = db.chain.Stop(); err != nil {
@@ -405,16 +651,22 @@ func (db *Database) writeQuery(request *types.Request) (tracker *x.QueryTracker,
 			}
 		} else {
 			if uint64(statInfo.Size()) > db.cfg.SpaceLimit {
-				// rejected
-				err = ErrSpaceLimitExceeded
+				// rejected, read queries are still served
+				err = errors.Wrapf(ErrSpaceLimitExceeded,
+					"database size %d exceeds quota %d, writes are refused",
+					statInfo.Size(), db.cfg.SpaceLimit)
 				return
 			}
 		}
 	}
 
 	// call kayak runtime Process
-	var result interface{}
-	if result, _, err = db.kayakRuntime.Apply(request.GetContext(), request); err != nil {
+	var (
+		result   interface{}
+		replicas = db.writeAck(request).Replicas(len(db.kayakConfig.Peers.Servers))
+		ctx      = kayak.WithAckReplicas(request.GetContext(), replicas)
+	)
+	if result, _, err = db.kayakRuntime.Apply(ctx, request); err != nil {
 		err = errors.Wrap(err, "apply failed")
 		return
 	}
@@ -432,6 +684,22 @@ func (db *Database) writeQuery(request *types.Request) (tracker *x.QueryTracker,
 	return
 }
 
+// writeAck returns the write ack of the request, the request could only raise the write ack of
+// the database.
+func (db *Database) writeAck(request *types.Request) types.WriteAck {
+	ack := db.cfg.WriteAck
+	if ack == types.WriteAckDefault {
+		ack = types.WriteAckAll
+	}
+	if request.WriteAck > ack {
+		ack = request.WriteAck
+	}
+	if ack > types.WriteAckAll {
+		ack = types.WriteAckAll
+	}
+	return ack
+}
+
 func (db *Database) saveAck(ackHeader *types.SignedAckHeader) (err error) {
 	return db.chain.VerifyAndPushAckedQuery(ackHeader)
 }
@@ -0,0 +1,326 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/blob"
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	rpc "github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// Following contains blob chunk related logic extracted from main database instance definition.
+
+const (
+	// BlobDirName defines the blob chunk store directory name of database instance.
+	BlobDirName = "blob"
+	// BlobGCInterval defines the interval to collect the blob chunks no longer referenced.
+	BlobGCInterval = time.Hour
+	// BlobGCGrace defines how long an unreferenced chunk is kept after it's written, so that the
+	// chunks uploaded before the write referring to them is committed are not collected.
+	BlobGCGrace = 24 * time.Hour
+)
+
+func init() {
+	conf.RegisterCapability("blob")
+}
+
+// PutBlobChunk stores a verified blob chunk to the database blob store.
+func (db *Database) PutBlobChunk(h hash.Hash, data []byte) (err error) {
+	return db.blobs.PutChunkWithHash(h, data)
+}
+
+// GetBlobChunk reads a blob chunk from the database blob store.
+func (db *Database) GetBlobChunk(h hash.Hash) (data []byte, err error) {
+	return db.blobs.GetChunk(h)
+}
+
+// syncBlobs fetches the missing chunks of the blob values referenced by a committed write
+// request from peers in background.
+func (db *Database) syncBlobs(req *types.Request) {
+	if req.Header.QueryType != types.WriteQuery {
+		return
+	}
+	for _, q := range req.Payload.Queries {
+		for _, arg := range q.Args {
+			if !blob.IsRef(arg.Value) {
+				continue
+			}
+			var (
+				ref string
+				h   hash.Hash
+				err error
+			)
+			switch v := arg.Value.(type) {
+			case string:
+				ref = v
+			case []byte:
+				ref = string(v)
+			}
+			if h, err = blob.ParseRef(ref); err != nil {
+				continue
+			}
+			go func() {
+				if err := db.syncBlob(h); err != nil {
+					log.WithFields(log.Fields{
+						"db":   db.dbID,
+						"blob": h.String(),
+					}).WithError(err).Warning("failed to sync blob chunks from peers")
+				}
+			}()
+		}
+	}
+}
+
+// syncBlob fetches missing chunks of a blob value from peers.
+func (db *Database) syncBlob(h hash.Hash) (err error) {
+	// fetch manifest first, then the chunks listed in it
+	for i := 0; i < 2; i++ {
+		var missing []hash.Hash
+		if missing, err = db.blobs.Missing(h); err != nil {
+			return
+		}
+		if len(missing) == 0 {
+			return
+		}
+		if db.cfg.FetchBlobChunk == nil {
+			return errors.Wrapf(blob.ErrChunkNotFound, "%d chunks missing", len(missing))
+		}
+		for _, c := range missing {
+			var data []byte
+			if data, err = db.cfg.FetchBlobChunk(db.dbID, c); err != nil {
+				return
+			}
+			if err = db.blobs.PutChunkWithHash(c, data); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// blobCollector removes the blob chunks which are no longer reachable from the values stored in
+// the database, e.g. after the rows referring to them are updated or deleted.
+type blobCollector struct {
+	db       *Database
+	interval time.Duration
+	grace    time.Duration
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newBlobCollector(db *Database) *blobCollector {
+	return &blobCollector{
+		db:       db,
+		interval: BlobGCInterval,
+		grace:    BlobGCGrace,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+func (c *blobCollector) start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stopCh:
+				return
+			case <-ticker.C:
+				if err := c.collect(); err != nil {
+					log.WithField("db", c.db.dbID).WithError(err).Warning(
+						"collect unreferenced blob chunks failed")
+				}
+			}
+		}
+	}()
+}
+
+func (c *blobCollector) stop() {
+	select {
+	case <-c.stopCh:
+	default:
+		close(c.stopCh)
+	}
+	c.wg.Wait()
+}
+
+// collect scans the blob references stored in the database and removes the chunks not
+// reachable from them, the referenced values are synced first so their manifests are present.
+func (c *blobCollector) collect() (err error) {
+	var (
+		refs []string
+		live []hash.Hash
+	)
+	if refs, err = c.db.chain.PrefixedValues(context.Background(), blob.RefPrefix); err != nil {
+		return
+	}
+	for _, ref := range refs {
+		var h hash.Hash
+		if h, err = blob.ParseRef(ref); err != nil {
+			// not a blob reference, e.g. user text with the same prefix
+			err = nil
+			continue
+		}
+		if err = c.db.syncBlob(h); err != nil {
+			return
+		}
+		live = append(live, h)
+	}
+	var removed int
+	if removed, err = c.db.blobs.Collect(live, c.grace); err != nil {
+		return
+	}
+	if removed > 0 {
+		log.WithFields(log.Fields{
+			"db":      c.db.dbID,
+			"removed": removed,
+		}).Info("collected unreferenced blob chunks")
+	}
+	return
+}
+
+// PutBlobChunk stores a blob chunk uploaded by a database user with write permission.
+func (dbms *DBMS) PutBlobChunk(req *types.BlobChunkReq) (err error) {
+	var (
+		addr proto.AccountAddress
+		db   *Database
+		ok   bool
+	)
+	if err = req.Header.Verify(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		return
+	}
+	if err = dbms.checkPermission(addr, req.Header.DatabaseID, types.WriteQuery, nil); err != nil {
+		return
+	}
+	if db, ok = dbms.getMeta(req.Header.DatabaseID); !ok {
+		return ErrNotExists
+	}
+	// chunks are only replicated between miners supporting blobs
+	if err = dbms.requireFeature(req.Header.DatabaseID, FeatureBlob); err != nil {
+		return
+	}
+	return db.PutBlobChunk(req.Header.Hash, req.Header.Data)
+}
+
+// FetchBlobChunk returns a blob chunk to a database user with read permission or to a peer
+// miner of the database, missing chunks are fetched from peers unless the request is forwarded.
+func (dbms *DBMS) FetchBlobChunk(req *types.BlobChunkReq) (data []byte, err error) {
+	var (
+		addr proto.AccountAddress
+		db   *Database
+		ok   bool
+	)
+	if err = req.Header.Verify(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		return
+	}
+	if !dbms.isDatabaseMiner(req.Header.DatabaseID, addr) {
+		if err = dbms.checkPermission(addr, req.Header.DatabaseID, types.ReadQuery, nil); err != nil {
+			return
+		}
+	}
+	if db, ok = dbms.getMeta(req.Header.DatabaseID); !ok {
+		err = ErrNotExists
+		return
+	}
+	if data, err = db.GetBlobChunk(req.Header.Hash); errors.Cause(err) != blob.ErrChunkNotFound || req.Forwarded {
+		return
+	}
+	if data, err = dbms.fetchBlobChunkFromPeers(req.Header.DatabaseID, req.Header.Hash); err != nil {
+		return
+	}
+	err = db.PutBlobChunk(req.Header.Hash, data)
+	return
+}
+
+func (dbms *DBMS) isDatabaseMiner(dbID proto.DatabaseID, addr proto.AccountAddress) bool {
+	profile, ok := dbms.busService.RequestSQLProfile(dbID)
+	if !ok {
+		return false
+	}
+	for _, mi := range profile.Miners {
+		if mi.Address == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchBlobChunkFromPeers tries to fetch a blob chunk from the other miners of the database.
+func (dbms *DBMS) fetchBlobChunkFromPeers(dbID proto.DatabaseID, h hash.Hash) (data []byte, err error) {
+	profile, ok := dbms.busService.RequestSQLProfile(dbID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+
+	req := &types.BlobChunkReq{
+		Header: types.SignedBlobChunkHeader{
+			BlobChunkHeader: types.BlobChunkHeader{
+				DatabaseID: dbID,
+				Hash:       h,
+			},
+		},
+		Forwarded: true,
+	}
+	if err = req.Header.Sign(dbms.privKey); err != nil {
+		return
+	}
+
+	caller := rpc.NewCaller()
+	err = errors.Wrap(blob.ErrChunkNotFound, "no peer has the chunk")
+	for _, mi := range profile.Miners {
+		if mi.Address == dbms.address {
+			continue
+		}
+		resp := &types.BlobChunkResp{}
+		if callErr := caller.CallNode(
+			mi.NodeID, route.DBSFetchBlobChunk.String(), req, resp,
+		); callErr != nil {
+			log.WithFields(log.Fields{
+				"db":   dbID,
+				"node": mi.NodeID,
+				"hash": h.String(),
+			}).WithError(callErr).Debug("fetch blob chunk from peer failed")
+			continue
+		}
+		if actual := hash.THashH(resp.Data); !actual.IsEqual(&h) {
+			continue
+		}
+		return resp.Data, nil
+	}
+	return
+}
@@ -19,8 +19,10 @@ package worker
 import (
 	"time"
 
+	"github.com/SQLess/SQLess/crypto/hash"
 	"github.com/SQLess/SQLess/proto"
 	"github.com/SQLess/SQLess/sqlchain"
+	"github.com/SQLess/SQLess/types"
 )
 
 // DBConfig defines the database config.
@@ -39,4 +41,33 @@ type DBConfig struct {
 	ConsistencyLevel       float64
 	IsolationLevel         int
 	SlowQueryTime          time.Duration
+	StatementTimeout       time.Duration
+	ForeignKeys            bool
+	LeaderReadsOnly        bool
+	MaxReadStaleness       time.Duration
+	WriteAck               types.WriteAck
+	FetchBlobChunk         func(dbID proto.DatabaseID, h hash.Hash) ([]byte, error)
+	WALArchiveTarget       WALArchiveTarget
+	WALArchiveInterval     time.Duration
+	StandbyNode            proto.NodeID
+	SnapshotShipInterval   time.Duration
+
+	// StateDigestInterval is the write count between two state digests compared with peers.
+	StateDigestInterval      uint64
+	StateDigestCheckInterval time.Duration
+	// OnStateDivergence is called when a replica is found divergent from the majority.
+	OnStateDivergence func(dbID proto.DatabaseID, nodeID proto.NodeID, seq uint64)
+	// ResyncFromPeer is called to resync the local replica from a healthy peer.
+	ResyncFromPeer func(dbID proto.DatabaseID, peer proto.NodeID) error
+
+	// QueryDataset returns the dataset versions published on chain for the database.
+	QueryDataset func(dbID proto.DatabaseID) (*types.DatasetProfile, error)
+	// FetchDataset downloads a published dataset missing locally from the peers to filename.
+	FetchDataset func(dbID proto.DatabaseID, dv *types.DatasetVersion, filename string) error
+
+	// FirewallRules are the enabled sql firewall rules, all rules are enabled if empty.
+	FirewallRules []string
+
+	// IOLimit limits the write rate of the database on the shared miner.
+	IOLimit IOLimit
 }
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+// Export reads a chunk of the exported plain SQLite file of the database state, a new export is
+// prepared if the export id is empty. The exports share the prepared snapshots of the replica
+// repair, so that the database is not copied again by each export. The returned header is signed
+// by this miner and bound to the chain head the state is based on.
+func (db *Database) Export(ctx context.Context, id hash.Hash, offset uint64) (
+	header *types.SignedExportHeader, data []byte, err error,
+) {
+	var s *preparedSnapshot
+	if id.IsEqual(&hash.Hash{}) {
+		if s, err = db.prepareSnapshot(ctx); err != nil {
+			return
+		}
+		id = s.info.ID
+	}
+	if s, data, err = db.readSnapshotChunk(id, offset); err != nil {
+		return
+	}
+	header = &types.SignedExportHeader{
+		ExportHeader: types.ExportHeader{
+			DatabaseID: db.dbID,
+			NodeID:     db.nodeID,
+			BlockHash:  s.info.BlockHash,
+			Height:     s.info.Height,
+			FileHash:   s.info.ID,
+			Size:       s.info.Size,
+		},
+	}
+	if err = header.Sign(db.privateKey); err != nil {
+		return
+	}
+	return
+}
+
+// ExportDatabase exports the database to a user with read permission.
+func (dbms *DBMS) ExportDatabase(
+	ctx context.Context, req *types.ExportDatabaseReq,
+) (header *types.SignedExportHeader, data []byte, err error) {
+	var (
+		addr proto.AccountAddress
+		db   *Database
+		ok   bool
+	)
+	if err = req.Header.Verify(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		return
+	}
+	if err = dbms.checkPermission(addr, req.Header.DatabaseID, types.ReadQuery, nil); err != nil {
+		return
+	}
+	if db, ok = dbms.getMeta(req.Header.DatabaseID); !ok {
+		err = ErrNotExists
+		return
+	}
+	return db.Export(ctx, req.Header.ExportID, req.Header.Offset)
+}
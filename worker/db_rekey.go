@@ -0,0 +1,284 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/storage"
+	"github.com/SQLess/SQLess/utils/log"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+const (
+	// RekeyFileName defines the file name to persist a running re-encryption of the storage,
+	// so that the storage is opened with the right key and the re-encryption is resumed on
+	// restart.
+	RekeyFileName = "rekey.json"
+
+	// DefaultRekeyChunkRows defines the row count re-encrypted in a single chunk.
+	DefaultRekeyChunkRows = 10000
+
+	// DefaultRekeyChunkInterval defines the pause between two re-encrypted chunks.
+	DefaultRekeyChunkInterval = 10 * time.Millisecond
+
+	mwMinerRekeyProgress = "service:miner:rekey:progress"
+)
+
+var (
+	rekeyProgress = new(expvar.Map).Init()
+)
+
+func init() {
+	expvar.Publish(mwMinerRekeyProgress, rekeyProgress)
+}
+
+// RekeyProgress defines the progress of the background re-encryption of a database storage.
+type RekeyProgress struct {
+	Running  bool      `json:"running"`
+	Copied   uint64    `json:"copied"`
+	Total    uint64    `json:"total"`
+	Started  time.Time `json:"started,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// rekeyState is the persisted state of a running re-encryption.
+type rekeyState struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// rekeyFunc rewrites the storage to the target in background.
+type rekeyFunc func(ctx context.Context, target *storage.DSN, opts xs.CopyOptions) error
+
+// rekeyJob re-encrypts the storage of a database in background when the encryption key is
+// rotated, the queries are served during the re-encryption.
+type rekeyJob struct {
+	sync.Mutex
+	dbID     proto.DatabaseID
+	cfg      *DBConfig
+	filename string
+	current  string // current is the key the storage is encrypted with
+	target   string // target is the rotated key
+	progress RekeyProgress
+	rekey    rekeyFunc
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func newRekeyJob(cfg *DBConfig) (j *rekeyJob, err error) {
+	j = &rekeyJob{
+		dbID:     cfg.DatabaseID,
+		cfg:      cfg,
+		filename: filepath.Join(cfg.DataDir, RekeyFileName),
+		current:  cfg.EncryptionKey,
+		target:   cfg.EncryptionKey,
+	}
+	j.ctx, j.cancel = context.WithCancel(context.Background())
+	var (
+		data  []byte
+		state rekeyState
+	)
+	if data, err = ioutil.ReadFile(j.filename); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return
+	}
+	// the job may be interrupted either before or after the storage is swapped, the old key is
+	// dropped from the disk once the storage is known to be swapped
+	if j.current, err = probeStorageKey(cfg, state.To, state.From); err != nil {
+		return
+	}
+	if j.current == state.To {
+		err = os.Remove(j.filename)
+	}
+	return
+}
+
+// probeStorageKey returns the first key in keys which the storage could be opened with.
+func probeStorageKey(cfg *DBConfig, keys ...string) (key string, err error) {
+	for _, key = range keys {
+		var (
+			dsn   *storage.DSN
+			strg  *xs.SQLite3
+			count int
+		)
+		if dsn, err = newStorageDSN(cfg, key); err != nil {
+			return
+		}
+		if strg, err = xs.NewSqlite(dsn.Format()); err != nil {
+			continue
+		}
+		err = strg.Reader().QueryRow(`SELECT COUNT(*) FROM "sqlite_master"`).Scan(&count)
+		_ = strg.Close()
+		if err == nil {
+			return
+		}
+	}
+	err = errors.Wrap(err, "storage could not be opened with any of the rekey keys")
+	return
+}
+
+// storageKey returns the key the storage is currently encrypted with.
+func (j *rekeyJob) storageKey() string {
+	j.Lock()
+	defer j.Unlock()
+	return j.current
+}
+
+// start binds the job to the storage and resumes the interrupted re-encryption if any.
+func (j *rekeyJob) start(rekey rekeyFunc) {
+	j.Lock()
+	defer j.Unlock()
+	j.rekey = rekey
+	rekeyProgress.Set(string(j.dbID), j)
+	j.trigger()
+}
+
+// setTarget rotates the encryption key of the storage to key.
+func (j *rekeyJob) setTarget(key string) {
+	j.Lock()
+	defer j.Unlock()
+	j.target = key
+	j.cfg.EncryptionKey = key
+	if j.rekey != nil {
+		j.trigger()
+	}
+}
+
+func (j *rekeyJob) trigger() {
+	if j.progress.Running || j.current == j.target || j.ctx.Err() != nil {
+		return
+	}
+	j.progress = RekeyProgress{Running: true, Started: time.Now().UTC()}
+	j.wg.Add(1)
+	go j.run()
+}
+
+func (j *rekeyJob) run() {
+	defer j.wg.Done()
+	var err error
+	for {
+		j.Lock()
+		var from, to = j.current, j.target
+		if err != nil || from == to {
+			j.progress.Running = false
+			j.progress.Finished = time.Now().UTC()
+			if err != nil {
+				j.progress.Error = err.Error()
+			}
+			j.Unlock()
+			break
+		}
+		j.Unlock()
+
+		// the key may be rotated again during the re-encryption, loop until it's settled
+		var le = log.WithField("db", j.dbID)
+		le.Info("start re-encrypting storage with the rotated key")
+		if err = j.runOnce(from, to); err != nil {
+			le.WithError(err).Error("failed to re-encrypt storage")
+		} else {
+			le.Info("storage re-encrypted with the rotated key")
+		}
+	}
+}
+
+func (j *rekeyJob) runOnce(from, to string) (err error) {
+	var (
+		data   []byte
+		target *storage.DSN
+	)
+	if data, err = json.Marshal(&rekeyState{From: from, To: to}); err != nil {
+		return
+	}
+	tmpFile := j.filename + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		return
+	}
+	if err = os.Rename(tmpFile, j.filename); err != nil {
+		return
+	}
+	if target, err = newStorageDSN(j.cfg, to); err != nil {
+		return
+	}
+	if err = j.rekey(j.ctx, target, xs.CopyOptions{
+		ChunkRows:     DefaultRekeyChunkRows,
+		ChunkInterval: DefaultRekeyChunkInterval,
+		Progress: func(copied, total uint64) {
+			j.Lock()
+			defer j.Unlock()
+			j.progress.Copied, j.progress.Total = copied, total
+		},
+	}); err != nil {
+		return
+	}
+	j.Lock()
+	j.current = to
+	j.Unlock()
+	// the old key must not outlive the swap on the disk
+	if err = os.Remove(j.filename); err != nil {
+		log.WithField("db", j.dbID).WithError(err).Error(
+			"failed to remove rekey state, the old key is kept on disk")
+	}
+	return
+}
+
+// get returns the progress of the re-encryption.
+func (j *rekeyJob) get() (p RekeyProgress) {
+	j.Lock()
+	defer j.Unlock()
+	return j.progress
+}
+
+// String implements expvar.Var.String.
+func (j *rekeyJob) String() string {
+	data, _ := json.Marshal(j.get())
+	return string(data)
+}
+
+func (j *rekeyJob) stop() {
+	j.cancel()
+	j.wg.Wait()
+	rekeyProgress.Delete(string(j.dbID))
+}
+
+// Rekey re-encrypts the database storage with the rotated encryption key in background, an
+// interrupted re-encryption is resumed when the database is reopened.
+func (db *Database) Rekey(key string) {
+	db.rekey.setTarget(key)
+}
+
+// RekeyProgress returns the progress of the storage re-encryption of the database.
+func (db *Database) RekeyProgress() RekeyProgress {
+	return db.rekey.get()
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+func TestRekeyJobResume(t *testing.T) {
+	Convey("Given a storage interrupted during re-encryption", t, func() {
+		dir, err := ioutil.TempDir("", "db_rekey")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		var (
+			cfg = &DBConfig{DatabaseID: "db", DataDir: dir}
+			// create the storage with key and the rekey state from old to new
+			prepare = func(key string) {
+				dsn, err := newStorageDSN(cfg, key)
+				So(err, ShouldBeNil)
+				strg, err := xs.NewSqlite(dsn.Format())
+				So(err, ShouldBeNil)
+				_, err = strg.Writer().Exec(`CREATE TABLE "t" ("k" INTEGER)`)
+				So(err, ShouldBeNil)
+				So(strg.Close(), ShouldBeNil)
+				data, err := json.Marshal(&rekeyState{From: "old", To: "new"})
+				So(err, ShouldBeNil)
+				So(ioutil.WriteFile(filepath.Join(dir, RekeyFileName), data, 0600), ShouldBeNil)
+			}
+		)
+		Convey("The old key should be dropped if the storage is swapped", func() {
+			prepare("new")
+			// the profile may still carry the key set on creation
+			cfg.EncryptionKey = "old"
+			j, err := newRekeyJob(cfg)
+			So(err, ShouldBeNil)
+			So(j.storageKey(), ShouldEqual, "new")
+			_, err = os.Stat(filepath.Join(dir, RekeyFileName))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+		Convey("The re-encryption should be resumed if the storage is not swapped", func() {
+			prepare("old")
+			cfg.EncryptionKey = "new"
+			j, err := newRekeyJob(cfg)
+			So(err, ShouldBeNil)
+			So(j.storageKey(), ShouldEqual, "old")
+			_, err = os.Stat(filepath.Join(dir, RekeyFileName))
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+func TestLocalEncryptionKey(t *testing.T) {
+	Convey("The storage key should be the key issued to the local miner", t, func() {
+		var (
+			dbms    = &DBMS{address: proto.AccountAddress{0x01}}
+			profile = &types.SQLChainProfile{
+				Meta: types.ResourceMeta{EncryptionKey: "created"},
+				Miners: []*types.MinerInfo{
+					{Address: proto.AccountAddress{0x02}, EncryptionKey: "other"},
+					{Address: proto.AccountAddress{0x01}},
+				},
+			}
+		)
+		So(dbms.localEncryptionKey(profile), ShouldEqual, "created")
+		profile.Miners[1].EncryptionKey = "issued"
+		So(dbms.localEncryptionKey(profile), ShouldEqual, "issued")
+	})
+}
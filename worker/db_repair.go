@@ -0,0 +1,441 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"expvar"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	rpc "github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/sqlchain"
+	"github.com/SQLess/SQLess/storage"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+const (
+	// SnapshotDirName defines the directory name of prepared snapshots for replica repair.
+	SnapshotDirName = "snapshots"
+	// SnapshotChunkSize defines the max chunk size of snapshot transfer.
+	SnapshotChunkSize = 1 << 20
+	// SnapshotTTL defines how long a prepared snapshot is reused, a repairing replica could
+	// resume the transfer within this period.
+	SnapshotTTL = 10 * time.Minute
+	// MaxSnapshotFetchRetries defines the max retry count of a failed snapshot chunk transfer.
+	MaxSnapshotFetchRetries = 5
+
+	snapshotFileSuffix = ".snapshot"
+	repairDirSuffix    = ".repair"
+
+	mwMinerRepairCount = "service:miner:repair:count"
+)
+
+var (
+	repairCount = new(expvar.Int)
+)
+
+func init() {
+	expvar.Publish(mwMinerRepairCount, repairCount)
+}
+
+// preparedSnapshot defines a snapshot file prepared by a healthy replica.
+type preparedSnapshot struct {
+	info     types.SnapshotInfo
+	filename string
+	created  time.Time
+}
+
+// snapshots caches the latest prepared snapshot of a database.
+type snapshots struct {
+	sync.Mutex
+	latest *preparedSnapshot
+}
+
+// prepareSnapshot returns the latest snapshot of the database, a new one is exported if the
+// latest snapshot is expired.
+func (db *Database) prepareSnapshot(ctx context.Context) (s *preparedSnapshot, err error) {
+	db.snapshots.Lock()
+	defer db.snapshots.Unlock()
+	if s = db.snapshots.latest; s != nil && time.Since(s.created) < SnapshotTTL {
+		return
+	}
+
+	var (
+		dir     = filepath.Join(db.cfg.DataDir, SnapshotDirName)
+		tmpFile = filepath.Join(dir, "export"+snapshotFileSuffix)
+		size    int64
+	)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	s = &preparedSnapshot{created: time.Now()}
+	// export with the commits paused, so that the snapshot is consistent with the kayak logs
+	// and the replica restoring it continues from the next commit
+	if err = db.kayakRuntime.Barrier(func(lastCommit uint64) (err error) {
+		s.info.LogIndex = lastCommit
+		s.info.BlockHash, s.info.Height, err = db.chain.Export(ctx, tmpFile)
+		return
+	}); err != nil {
+		return
+	}
+	if s.info.ID, size, err = hashFile(tmpFile); err != nil {
+		return
+	}
+	s.info.Size = uint64(size)
+	s.filename = filepath.Join(dir, s.info.ID.String()+snapshotFileSuffix)
+	if err = os.Rename(tmpFile, s.filename); err != nil {
+		return
+	}
+	if prev := db.snapshots.latest; prev != nil && prev.filename != s.filename {
+		_ = os.Remove(prev.filename)
+	}
+	db.snapshots.latest = s
+	return
+}
+
+// readSnapshotChunk reads a chunk of the prepared snapshot.
+func (db *Database) readSnapshotChunk(id hash.Hash, offset uint64) (s *preparedSnapshot, data []byte, err error) {
+	db.snapshots.Lock()
+	s = db.snapshots.latest
+	db.snapshots.Unlock()
+	if s == nil || !s.info.ID.IsEqual(&id) {
+		err = errors.Wrapf(ErrNotExists, "snapshot %s not found", id.String())
+		return
+	}
+	if offset > s.info.Size {
+		err = errors.Wrapf(ErrInvalidRequest, "invalid snapshot offset %d", offset)
+		return
+	}
+	var f *os.File
+	if f, err = os.Open(s.filename); err != nil {
+		return
+	}
+	defer f.Close()
+	size := s.info.Size - offset
+	if size > SnapshotChunkSize {
+		size = SnapshotChunkSize
+	}
+	data = make([]byte, size)
+	_, err = f.ReadAt(data, int64(offset))
+	return
+}
+
+// FetchSnapshotChunk serves snapshot chunks to the other miners of the database.
+func (dbms *DBMS) FetchSnapshotChunk(req *types.SnapshotChunkReq) (resp *types.SnapshotChunkResp, err error) {
+	if !dbms.isDatabaseMinerNode(req.DatabaseID, req.GetNodeID().ToNodeID()) {
+		err = errors.Wrap(ErrPermissionDeny, "not a miner of the database")
+		return
+	}
+	db, ok := dbms.getMeta(req.DatabaseID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	var s *preparedSnapshot
+	if req.SnapshotID.IsEqual(&hash.Hash{}) {
+		if s, err = db.prepareSnapshot(context.Background()); err != nil {
+			return
+		}
+		req.SnapshotID = s.info.ID
+	}
+	resp = &types.SnapshotChunkResp{}
+	if s, resp.Data, err = db.readSnapshotChunk(req.SnapshotID, req.Offset); err != nil {
+		return
+	}
+	resp.Info = s.info
+	return
+}
+
+// hashFile returns the content hash and the size of the file.
+func hashFile(filename string) (h hash.Hash, size int64, err error) {
+	var f *os.File
+	if f, err = os.Open(filename); err != nil {
+		return
+	}
+	defer f.Close()
+	return hash.THashReader(f)
+}
+
+func (dbms *DBMS) isDatabaseMinerNode(dbID proto.DatabaseID, nodeID proto.NodeID) bool {
+	profile, ok := dbms.busService.RequestSQLProfile(dbID)
+	if !ok {
+		return false
+	}
+	for _, mi := range profile.Miners {
+		if mi.NodeID == nodeID {
+			return true
+		}
+	}
+	return false
+}
+
+// resyncDatabase starts an asynchronous repair of the local divergent replica from a healthy
+// peer, at most one repair runs for a database at the same time.
+func (dbms *DBMS) resyncDatabase(dbID proto.DatabaseID, peer proto.NodeID) (err error) {
+	if _, running := dbms.repairing.LoadOrStore(dbID, peer); running {
+		return
+	}
+	go func() {
+		defer dbms.repairing.Delete(dbID)
+		le := log.WithFields(log.Fields{
+			"db":     dbID,
+			"source": peer,
+		})
+		le.Warning("local replica diverged, start repairing")
+		if err := dbms.repairDatabase(dbID, peer); err != nil {
+			le.WithError(err).Error("repair database failed")
+			return
+		}
+		repairCount.Add(1)
+		le.Info("database repaired")
+	}()
+	return
+}
+
+// repairDatabase replaces the local state of the database with a snapshot of a healthy peer,
+// and rejoins the replica to the kayak group by restarting the database instance.
+func (dbms *DBMS) repairDatabase(dbID proto.DatabaseID, peer proto.NodeID) (err error) {
+	var (
+		repairDir = filepath.Join(dbms.cfg.RootDir, string(dbID)+repairDirSuffix)
+		info      *types.SnapshotInfo
+		snapshot  string
+		instance  *types.ServiceInstance
+	)
+	if err = os.MkdirAll(repairDir, 0755); err != nil {
+		return
+	}
+	if info, snapshot, err = fetchSnapshot(dbID, peer, repairDir); err != nil {
+		return
+	}
+
+	profile, ok := dbms.busService.RequestSQLProfile(dbID)
+	if !ok {
+		return ErrNotExists
+	}
+	if instance, err = dbms.buildSQLChainServiceInstance(profile); err != nil {
+		return
+	}
+	db, ok := dbms.getMeta(dbID)
+	if !ok {
+		return ErrNotExists
+	}
+	cfg := db.cfg
+	// the stopped instance is kept in the database map during the swap, so that the database
+	// is not created again from scratch meanwhile
+	if err = db.Shutdown(); err != nil {
+		return
+	}
+
+	// replace storage with the snapshot, re-encrypted with the database key, the failed restore
+	// leaves the previous state in place
+	restoreErr := restoreSnapshot(cfg, snapshot, info)
+	if db, err = dbms.openDatabase(instance); err != nil {
+		return
+	}
+	dbms.dbMap.Store(dbID, db)
+	if err = restoreErr; err != nil {
+		return
+	}
+	log.WithFields(log.Fields{
+		"db":     dbID,
+		"height": info.Height,
+		"block":  info.BlockHash.String(),
+		"log":    info.LogIndex,
+	}).Info("replica restored from snapshot")
+	return os.RemoveAll(repairDir)
+}
+
+// fetchSnapshot downloads the snapshot from the peer, partially downloaded snapshot in the
+// repair directory is resumed if the peer still holds it.
+func fetchSnapshot(
+	dbID proto.DatabaseID, peer proto.NodeID, dir string,
+) (info *types.SnapshotInfo, filename string, err error) {
+	var (
+		caller = rpc.NewCaller()
+		req    = &types.SnapshotChunkReq{DatabaseID: dbID}
+		resp   *types.SnapshotChunkResp
+		f      *os.File
+	)
+	defer func() {
+		if f != nil {
+			_ = f.Close()
+		}
+	}()
+
+	// resume partial download
+	if parts, _ := filepath.Glob(filepath.Join(dir, "*"+snapshotFileSuffix)); len(parts) > 0 {
+		var (
+			id     = strings.TrimSuffix(filepath.Base(parts[0]), snapshotFileSuffix)
+			h      *hash.Hash
+			st     os.FileInfo
+			decErr error
+		)
+		if h, decErr = hash.NewHashFromStr(id); decErr == nil {
+			if st, decErr = os.Stat(parts[0]); decErr == nil {
+				req.SnapshotID = *h
+				req.Offset = uint64(st.Size())
+				filename = parts[0]
+			}
+		}
+	}
+
+	for retry := 0; ; {
+		resp = &types.SnapshotChunkResp{}
+		if err = caller.CallNode(peer, route.DBSFetchSnapshotChunk.String(), req, resp); err != nil {
+			if strings.Contains(err.Error(), ErrNotExists.Error()) && !req.SnapshotID.IsEqual(&hash.Hash{}) {
+				// snapshot expired on peer, restart with a new snapshot
+				if f != nil {
+					_ = f.Close()
+					f = nil
+				}
+				if filename != "" {
+					_ = os.Remove(filename)
+				}
+				info, filename = nil, ""
+				req.SnapshotID, req.Offset = hash.Hash{}, 0
+				continue
+			}
+			if retry++; retry > MaxSnapshotFetchRetries {
+				return
+			}
+			time.Sleep(time.Duration(retry) * time.Second)
+			continue
+		}
+		if info == nil {
+			info = &resp.Info
+			req.SnapshotID = info.ID
+			filename = filepath.Join(dir, info.ID.String()+snapshotFileSuffix)
+			if f, err = os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+				return
+			}
+		}
+		if _, err = f.WriteAt(resp.Data, int64(req.Offset)); err != nil {
+			return
+		}
+		req.Offset += uint64(len(resp.Data))
+		retry = 0
+		if req.Offset >= info.Size || len(resp.Data) == 0 {
+			break
+		}
+	}
+	if err = f.Truncate(int64(info.Size)); err != nil {
+		return
+	}
+	if err = f.Sync(); err != nil {
+		return
+	}
+
+	// verify snapshot content
+	var actual hash.Hash
+	if actual, _, err = hashFile(filename); err != nil {
+		return
+	}
+	if !actual.IsEqual(&info.ID) {
+		_ = os.Remove(filename)
+		err = errors.Errorf("snapshot hash not match, expected %s, actual %s",
+			info.ID.String(), actual.String())
+	}
+	return
+}
+
+// restoreSnapshot replaces the storage of the database with the snapshot file. The kayak logs
+// are dropped and the snapshot log index is recorded as applied, and the sqlchain blocks above
+// the snapshot height are removed, so that the commits in the snapshot are not replayed again.
+func restoreSnapshot(cfg *DBConfig, snapshot string, info *types.SnapshotInfo) (err error) {
+	var (
+		src         *xs.SQLite3
+		storageFile = filepath.Join(cfg.DataDir, StorageFileName)
+		restoreFile = storageFile + ".restore"
+		dst         *storage.DSN
+	)
+	if src, err = xs.NewSqlite(snapshot); err != nil {
+		return
+	}
+	defer src.Close()
+	if dst, err = storage.NewDSN(restoreFile); err != nil {
+		return
+	}
+	if cfg.EncryptionKey != "" {
+		dst.AddParam("_crypto_key", cfg.EncryptionKey)
+	}
+	// copy to a temporary file first, the current storage is kept if the copy fails
+	for _, f := range []string{restoreFile, restoreFile + "-wal", restoreFile + "-shm"} {
+		if err = os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+	if err = xs.Copy(context.Background(), src.Reader(), dst); err != nil {
+		return
+	}
+	// the snapshot is restored with the current key, any interrupted re-encryption is dropped
+	for _, f := range []string{
+		storageFile + "-wal", storageFile + "-shm",
+		filepath.Join(cfg.DataDir, RekeyFileName),
+	} {
+		if err = os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+	if err = os.Rename(restoreFile, storageFile); err != nil {
+		return
+	}
+	if err = os.RemoveAll(filepath.Join(cfg.DataDir, KayakWalFileName)); err != nil {
+		return
+	}
+	if err = writeAppliedIndex(cfg.DataDir, info.LogIndex); err != nil {
+		return
+	}
+	return sqlchain.TruncateChain(
+		filepath.Join(cfg.RootDir, SQLChainFileName), cfg.DatabaseID, info.Height)
+}
+
+// readAppliedIndex returns the kayak log index applied to the storage restored from a snapshot,
+// it's 0 if the storage is not restored.
+func readAppliedIndex(dataDir string) (index uint64, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(filepath.Join(dataDir, KayakAppliedFileName)); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func writeAppliedIndex(dataDir string, index uint64) (err error) {
+	var (
+		filename = filepath.Join(dataDir, KayakAppliedFileName)
+		tmp      = filename + ".tmp"
+	)
+	if err = ioutil.WriteFile(tmp, []byte(strconv.FormatUint(index, 10)), 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, filename)
+}
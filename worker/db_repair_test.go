@@ -0,0 +1,90 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+func TestRestoreSnapshot(t *testing.T) {
+	Convey("Given a snapshot of a healthy replica", t, func() {
+		dir, err := ioutil.TempDir("", "db_repair")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		var (
+			dbID     = proto.DatabaseID(hash.THashH([]byte(t.Name())).String())
+			cfg      = &DBConfig{DatabaseID: dbID, RootDir: dir, DataDir: filepath.Join(dir, "db")}
+			snapshot = filepath.Join(dir, "peer"+snapshotFileSuffix)
+		)
+		strg, err := xs.NewSqlite(snapshot)
+		So(err, ShouldBeNil)
+		_, err = strg.Writer().Exec(`CREATE TABLE "t" ("k" INTEGER)`)
+		So(err, ShouldBeNil)
+		_, err = strg.Writer().Exec(`INSERT INTO "t" VALUES (1), (2)`)
+		So(err, ShouldBeNil)
+		So(strg.Close(), ShouldBeNil)
+
+		// the divergent local replica with its kayak logs
+		So(os.MkdirAll(filepath.Join(cfg.DataDir, KayakWalFileName), 0755), ShouldBeNil)
+		dsn, err := newStorageDSN(cfg, "")
+		So(err, ShouldBeNil)
+		strg, err = xs.NewSqlite(dsn.Format())
+		So(err, ShouldBeNil)
+		_, err = strg.Writer().Exec(`CREATE TABLE "t" ("k" INTEGER)`)
+		So(err, ShouldBeNil)
+		So(strg.Close(), ShouldBeNil)
+
+		Convey("The snapshot file should be hashed as a whole", func() {
+			data, err := ioutil.ReadFile(snapshot)
+			So(err, ShouldBeNil)
+			h, size, err := hashFile(snapshot)
+			So(err, ShouldBeNil)
+			So(size, ShouldEqual, len(data))
+			So(h, ShouldResemble, hash.THashH(data))
+		})
+		Convey("The storage should be replaced and the applied logs should be recorded", func() {
+			index, err := readAppliedIndex(cfg.DataDir)
+			So(err, ShouldBeNil)
+			So(index, ShouldEqual, 0)
+
+			err = restoreSnapshot(cfg, snapshot, &types.SnapshotInfo{Height: 3, LogIndex: 42})
+			So(err, ShouldBeNil)
+			strg, err = xs.NewSqlite(dsn.Format())
+			So(err, ShouldBeNil)
+			var count int
+			So(strg.Reader().QueryRow(`SELECT COUNT(*) FROM "t"`).Scan(&count), ShouldBeNil)
+			So(count, ShouldEqual, 2)
+			So(strg.Close(), ShouldBeNil)
+
+			_, err = os.Stat(filepath.Join(cfg.DataDir, KayakWalFileName))
+			So(os.IsNotExist(err), ShouldBeTrue)
+			index, err = readAppliedIndex(cfg.DataDir)
+			So(err, ShouldBeNil)
+			So(index, ShouldEqual, 42)
+		})
+	})
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	rpc "github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultSnapshotShipInterval defines the default interval of snapshot shipping to the
+	// standby miner.
+	DefaultSnapshotShipInterval = time.Hour
+
+	mwMinerSnapshotShipCount = "service:miner:standby:ship:count"
+)
+
+var (
+	snapshotShipCount = new(expvar.Int)
+)
+
+func init() {
+	expvar.Publish(mwMinerSnapshotShipCount, snapshotShipCount)
+}
+
+// snapshotShipper ships the database snapshots to the standby miner periodically, so that the
+// database could be recovered in another region if the whole replication group is lost. Only
+// the leader ships, an unchanged snapshot is not shipped again.
+type snapshotShipper struct {
+	db       *Database
+	standby  proto.NodeID
+	interval time.Duration
+	caller   *rpc.Caller
+	shipped  hash.Hash
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newSnapshotShipper(db *Database, standby proto.NodeID, interval time.Duration) *snapshotShipper {
+	if interval <= 0 {
+		interval = DefaultSnapshotShipInterval
+	}
+	return &snapshotShipper{
+		db:       db,
+		standby:  standby,
+		interval: interval,
+		caller:   rpc.NewCaller(),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+func (s *snapshotShipper) start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				if !s.db.kayakRuntime.IsLeader() {
+					continue
+				}
+				if err := s.ship(); err != nil {
+					log.WithFields(log.Fields{
+						"db":      s.db.dbID,
+						"standby": s.standby,
+					}).WithError(err).Warning("ship snapshot to standby failed")
+				}
+			}
+		}
+	}()
+}
+
+func (s *snapshotShipper) stop() {
+	select {
+	case <-s.stopCh:
+		return
+	default:
+		close(s.stopCh)
+	}
+	s.wg.Wait()
+}
+
+// ship pushes the latest snapshot to the standby miner, the transfer is resumed from the offset
+// the standby miner already holds.
+func (s *snapshotShipper) ship() (err error) {
+	var ps *preparedSnapshot
+	if ps, err = s.db.prepareSnapshot(context.Background()); err != nil {
+		return
+	}
+	if ps.info.ID.IsEqual(&s.shipped) {
+		return
+	}
+
+	// probe the offset to resume from with an empty chunk
+	var (
+		req = &types.ShipSnapshotChunkReq{
+			DatabaseID: s.db.dbID,
+			Info:       ps.info,
+		}
+		resp = &types.ShipSnapshotChunkResp{}
+	)
+	if err = s.caller.CallNode(s.standby, route.DBSShipSnapshotChunk.String(), req, resp); err != nil {
+		return
+	}
+	for resp.Offset < ps.info.Size {
+		select {
+		case <-s.stopCh:
+			return
+		default:
+		}
+		req.Offset = resp.Offset
+		if _, req.Data, err = s.db.readSnapshotChunk(ps.info.ID, req.Offset); err != nil {
+			return
+		}
+		resp = &types.ShipSnapshotChunkResp{}
+		if err = s.caller.CallNode(s.standby, route.DBSShipSnapshotChunk.String(), req, resp); err != nil {
+			return
+		}
+		if resp.Offset <= req.Offset {
+			err = errors.Errorf("standby stuck at offset %d", resp.Offset)
+			return
+		}
+	}
+	s.shipped = ps.info.ID
+	snapshotShipCount.Add(1)
+	log.WithFields(log.Fields{
+		"db":       s.db.dbID,
+		"standby":  s.standby,
+		"snapshot": ps.info.ID.String(),
+		"height":   ps.info.Height,
+	}).Info("snapshot shipped to standby")
+	return
+}
@@ -127,6 +127,16 @@ func (db *Database) Commit(rawReq interface{}, isLeader bool) (result interface{
 	if tracker, response, err = db.chain.Query(req, isLeader); err != nil {
 		return
 	}
+
+	// fetch the blob values referenced by the committed request
+	db.syncBlobs(req)
+
+	// digest state at deterministic write sequences
+	if db.digester != nil && req.Header.QueryType == types.WriteQuery {
+		before := response.Header.LogOffset
+		db.digester.afterWrite(before, before+uint64(len(req.Payload.Queries)))
+	}
+
 	result = &TrackerAndResponse{
 		Tracker:  tracker,
 		Response: response,
@@ -18,6 +18,7 @@ package worker
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"reflect"
@@ -26,6 +27,7 @@ import (
 	"time"
 
 	"github.com/fortytw2/leaktest"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 
 	"github.com/SQLess/SQLess/crypto/asymmetric"
@@ -228,6 +230,54 @@ func TestSingleDatabase(t *testing.T) {
 			So(err, ShouldBeNil)
 		})
 
+		Convey("test statement timeout", func() {
+			var (
+				queries    = []string{"create table test (test int)"}
+				writeQuery *types.Request
+				readQuery  *types.Request
+				start      time.Time
+			)
+			for i := 0; i < 30; i++ {
+				queries = append(queries, fmt.Sprintf("insert into test values(%d)", i))
+			}
+			writeQuery, err = buildQuery(types.WriteQuery, 1, 1, queries)
+			So(err, ShouldBeNil)
+			_, err = db.Query(writeQuery)
+			So(err, ShouldBeNil)
+
+			// the recursive cte is rejected by the sql parser, a large cross join runs for minutes
+			// without producing a row as well
+			db.cfg.StatementTimeout = 100 * time.Millisecond
+			var longQuery = "select count(*) from test a, test b, test c, test d, test e, test f"
+
+			readQuery, err = buildQuery(types.ReadQuery, 1, 2, []string{longQuery})
+			So(err, ShouldBeNil)
+			start = time.Now()
+			_, err = db.Query(readQuery)
+			So(errors.Cause(err), ShouldEqual, ErrStatementTimeout)
+			So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+
+			// the paginated read is interrupted by the statement timeout of its page as well
+			readQuery, err = buildQuery(types.ReadQuery, 1, 3, []string{longQuery})
+			So(err, ShouldBeNil)
+			readQuery.Page = types.PageRequest{Size: 10}
+			start = time.Now()
+			_, err = db.Query(readQuery)
+			So(errors.Cause(err), ShouldEqual, ErrStatementTimeout)
+			So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+
+			// the request may only lower the statement timeout
+			db.cfg.StatementTimeout = 0
+			readQuery, err = buildQuery(types.ReadQuery, 1, 4, []string{longQuery})
+			So(err, ShouldBeNil)
+			readQuery.Timeout = 100 * time.Millisecond
+			_, err = db.Query(readQuery)
+			So(errors.Cause(err), ShouldEqual, ErrStatementTimeout)
+
+			err = db.Shutdown()
+			So(err, ShouldBeNil)
+		})
+
 		Convey("test invalid request", func() {
 			var writeQuery *types.Request
 			var res *types.Response
@@ -566,6 +616,22 @@ func TestDatabase_EncodePayload(t *testing.T) {
 	})
 }
 
+func TestDatabase_StatementTimeout(t *testing.T) {
+	Convey("statement timeout of read requests", t, func() {
+		db := &Database{cfg: &DBConfig{}}
+		req := &types.Request{}
+		So(db.statementTimeout(req), ShouldEqual, 0)
+		req.Timeout = time.Second
+		So(db.statementTimeout(req), ShouldEqual, time.Second)
+		db.cfg.StatementTimeout = 500 * time.Millisecond
+		So(db.statementTimeout(req), ShouldEqual, 500*time.Millisecond)
+		req.Timeout = 100 * time.Millisecond
+		So(db.statementTimeout(req), ShouldEqual, 100*time.Millisecond)
+		req.Timeout = 0
+		So(db.statementTimeout(req), ShouldEqual, 500*time.Millisecond)
+	})
+}
+
 func buildAck(res *types.Response) (ack *types.Ack, err error) {
 	// get node id
 	var nodeID proto.NodeID
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+// RowDigests returns the digests of the table rows in the requested rowid range.
+func (db *Database) RowDigests(ctx context.Context, h *types.RowDigestsHeader) (
+	resp *types.RowDigestsResp, err error,
+) {
+	resp = &types.RowDigestsResp{
+		NodeID: db.nodeID,
+	}
+	if resp.Ranges, resp.Rows, err = db.chain.RowDigests(
+		ctx, h.Table, h.From, h.To, h.Buckets); err != nil {
+		resp = nil
+	}
+	return
+}
+
+// RowDigests returns the digests of the table rows to the database owner.
+func (dbms *DBMS) RowDigests(ctx context.Context, req *types.RowDigestsReq) (resp *types.RowDigestsResp, err error) {
+	var (
+		addr proto.AccountAddress
+		db   *Database
+		ok   bool
+	)
+	if err = req.Header.Verify(); err != nil {
+		return
+	}
+	if gap := time.Since(req.Header.Timestamp); gap > dbms.cfg.MaxReqTimeGap ||
+		gap < -dbms.cfg.MaxReqTimeGap {
+		err = errors.Wrap(ErrInvalidRequest, "invalid request time")
+		return
+	}
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		return
+	}
+	profile, ok := dbms.busService.RequestSQLProfile(req.Header.DatabaseID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	if profile.Owner != addr {
+		err = errors.Wrapf(ErrPermissionDeny, "%s is not owner of database %s",
+			addr.String(), req.Header.DatabaseID)
+		return
+	}
+	if db, ok = dbms.getMeta(req.Header.DatabaseID); !ok {
+		err = ErrNotExists
+		return
+	}
+	return db.RowDigests(ctx, &req.Header.RowDigestsHeader)
+}
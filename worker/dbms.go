@@ -35,10 +35,12 @@ import (
 	"github.com/SQLess/SQLess/crypto/kms"
 	"github.com/SQLess/SQLess/proto"
 	"github.com/SQLess/SQLess/route"
+	rpc "github.com/SQLess/SQLess/rpc/mux"
 	"github.com/SQLess/SQLess/sqlchain"
 	"github.com/SQLess/SQLess/types"
 	"github.com/SQLess/SQLess/utils"
 	"github.com/SQLess/SQLess/utils/log"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
 )
 
 const (
@@ -70,14 +72,41 @@ type DBMS struct {
 	chainMux   *sqlchain.MuxService
 	rpc        *DBMSRPCService
 	busService *BusService
+	aclCache   *aclCache
+	disk       *diskMonitor
+	shedder    *loadShedder
+	async      *asyncQueries
+	dryRuns    chan struct{}
+	features   *featureGate
+	repairing  sync.Map // map[proto.DatabaseID]proto.NodeID
+	standbys   sync.Map // map[proto.DatabaseID]*standbyTransfer
 	address    proto.AccountAddress
 	privKey    *asymmetric.PrivateKey
+	stopRoute  func()
+	stopProbe  func()
 }
 
 // NewDBMS returns new database management instance.
 func NewDBMS(cfg *DBMSConfig) (dbms *DBMS, err error) {
 	dbms = &DBMS{
-		cfg: cfg,
+		cfg:      cfg,
+		aclCache: newACLCache(),
+		features: newFeatureGate(localNodeID()),
+		shedder:  newLoadShedder(cfg.MaxInflightRequests, cfg.ShedRetryAfter),
+		async: newAsyncQueries(cfg.MaxAsyncQueries, cfg.MaxAsyncResults, cfg.MaxAsyncResultBytes,
+			cfg.AsyncQueryTTL, asyncSpillDir(cfg.RootDir)),
+		dryRuns: newDryRunLimiter(cfg.MaxConcurrentDryRuns),
+	}
+	dbms.disk = newDiskMonitor(
+		cfg.RootDir, cfg.MinFreeDiskSpace, cfg.DiskUsageInterval, dbms.onDiskStateChange)
+
+	// bound the memory of each query, so that a single analytical query spills to disk instead of
+	// exhausting the memory shared by all the hosted databases
+	if cfg.QueryMemoryBudget > 0 || cfg.StorageMemoryLimit > 0 {
+		xs.SetMemoryBudget(xs.MemoryBudget{
+			QueryBytes: cfg.QueryMemoryBudget,
+			HeapBytes:  cfg.StorageMemoryLimit,
+		})
 	}
 
 	// init kayak rpc mux
@@ -85,6 +114,7 @@ func NewDBMS(cfg *DBMSConfig) (dbms *DBMS, err error) {
 		err = errors.Wrap(err, "register kayak mux service failed")
 		return
 	}
+	dbms.kayakMux.shedder = dbms.shedder
 
 	// init sql-chain rpc mux
 	if dbms.chainMux, err = sqlchain.NewMuxService(route.SQLChainRPCName, cfg.Server); err != nil {
@@ -107,6 +137,12 @@ func NewDBMS(cfg *DBMSConfig) (dbms *DBMS, err error) {
 	}
 	dbms.address = addr
 
+	// start routing services before the block producers are looked up by chain bus
+	if dbms.stopRoute, err = route.StartServices(); err != nil {
+		err = errors.Wrap(err, "start routing services failed")
+		return
+	}
+
 	// init chain bus service
 	ctx := context.Background()
 	bs := NewBusService(ctx, addr, conf.GConf.ChainBusPeriod)
@@ -116,6 +152,8 @@ func NewDBMS(cfg *DBMSConfig) (dbms *DBMS, err error) {
 	dbms.privKey, err = kms.GetLocalPrivateKey()
 	if err != nil {
 		log.WithError(err).Warning("get private key failed")
+		dbms.busService.Stop()
+		dbms.stopRoute()
 		return
 	}
 
@@ -180,6 +218,9 @@ func (dbms *DBMS) Init() (err error) {
 		return
 	}
 
+	// start disk usage monitor
+	dbms.disk.start()
+
 	// load current peers info from block producer
 	var dbMapping = dbms.busService.GetCurrentDBMapping()
 
@@ -197,8 +238,19 @@ func (dbms *DBMS) Init() (err error) {
 		err = errors.Wrap(err, "init chain bus failed")
 		return
 	}
+	if err = dbms.busService.Subscribe("/DecommissionMiner/", dbms.decommissionMiner); err != nil {
+		err = errors.Wrap(err, "init chain bus failed")
+		return
+	}
+	if err = dbms.busService.Subscribe("/IssueKeys/", dbms.issueKeys); err != nil {
+		err = errors.Wrap(err, "init chain bus failed")
+		return
+	}
 	dbms.busService.Start()
 
+	// probe the known nodes and evict the stale ones from routing table
+	dbms.stopProbe = rpc.StartLivenessProbe(nil)
+
 	return
 }
 
@@ -233,6 +285,43 @@ func (dbms *DBMS) updateBilling(itx interfaces.Transaction, count uint32) {
 	database.chain.SetLastBillingHeight(int32(profile.LastUpdatedHeight))
 }
 
+// issueKeys re-encrypts the storage in background with the key issued to the local miner.
+func (dbms *DBMS) issueKeys(itx interfaces.Transaction, count uint32) {
+	tx, ok := itx.(*types.IssueKeys)
+	if !ok {
+		log.WithFields(log.Fields{
+			"type": itx.GetTransactionType(),
+		}).WithError(ErrInvalidTransactionType).Warn("invalid tx type in issue keys")
+		return
+	}
+	var (
+		id       = tx.TargetSQLChain.DatabaseID()
+		database *Database
+	)
+	if database, ok = dbms.getMeta(id); !ok {
+		return
+	}
+	for _, k := range tx.MinerKeys {
+		if k.Miner == dbms.address {
+			log.WithField("id", id).Info("encryption key issued, re-encrypting storage")
+			database.Rekey(k.EncryptionKey)
+			return
+		}
+	}
+}
+
+// localEncryptionKey returns the storage encryption key of the local miner in the profile, the
+// key is issued to each miner by the IssueKeys transaction, and the key set on creation is used
+// until then.
+func (dbms *DBMS) localEncryptionKey(profile *types.SQLChainProfile) string {
+	for _, m := range profile.Miners {
+		if m.Address == dbms.address && m.EncryptionKey != "" {
+			return m.EncryptionKey
+		}
+	}
+	return profile.Meta.EncryptionKey
+}
+
 func (dbms *DBMS) createDatabase(tx interfaces.Transaction, count uint32) {
 	cd, ok := tx.(*types.CreateDatabase)
 	if !ok {
@@ -319,6 +408,7 @@ func (dbms *DBMS) buildSQLChainServiceInstance(
 		ResourceMeta: profile.Meta,
 		GenesisBlock: genesis,
 	}
+	instance.ResourceMeta.EncryptionKey = dbms.localEncryptionKey(profile)
 	return
 }
 
@@ -363,6 +453,7 @@ func (dbms *DBMS) UpdatePermission(dbID proto.DatabaseID, user proto.AccountAddr
 		dbms.busService.sqlChainState[dbID] = make(map[proto.AccountAddress]*types.PermStat)
 	}
 	dbms.busService.sqlChainState[dbID][user] = permStat
+	dbms.busService.stateVersion++
 
 	return
 }
@@ -416,6 +507,11 @@ func (dbms *DBMS) Create(instance *types.ServiceInstance, cleanup bool) (err err
 		return ErrAlreadyExists
 	}
 
+	// refuse new databases in degraded mode
+	if cleanup && dbms.disk.isDegraded() {
+		return errors.Wrapf(ErrDiskFull, "free space: %d", dbms.disk.freeSpace())
+	}
+
 	// set database root dir
 	rootDir := filepath.Join(dbms.cfg.RootDir, string(instance.DatabaseID))
 
@@ -439,6 +535,30 @@ func (dbms *DBMS) Create(instance *types.ServiceInstance, cleanup bool) (err err
 		}
 	}()
 
+	if db, err = dbms.openDatabase(instance); err != nil {
+		return
+	}
+
+	// add to meta
+	err = dbms.addMeta(instance.DatabaseID, db)
+
+	// update metrics
+	dbCount.Add(1)
+
+	return
+}
+
+// openDatabase opens the database instance in its data directory.
+func (dbms *DBMS) openDatabase(instance *types.ServiceInstance) (db *Database, err error) {
+	rootDir := filepath.Join(dbms.cfg.RootDir, string(instance.DatabaseID))
+
+	// apply the consistency preset on a copy, so that the meta is kept as it is on chain
+	meta := instance.ResourceMeta
+	if err = meta.ApplyConsistencyPreset(); err != nil {
+		err = errors.Wrapf(ErrInvalidDBConfig, "apply consistency preset failed: %v", err)
+		return
+	}
+
 	// new db
 	dbCfg := &DBConfig{
 		DatabaseID:             instance.DatabaseID,
@@ -447,13 +567,30 @@ func (dbms *DBMS) Create(instance *types.ServiceInstance, cleanup bool) (err err
 		KayakMux:               dbms.kayakMux,
 		ChainMux:               dbms.chainMux,
 		MaxWriteTimeGap:        dbms.cfg.MaxReqTimeGap,
-		EncryptionKey:          instance.ResourceMeta.EncryptionKey,
-		SpaceLimit:             instance.ResourceMeta.Space,
+		EncryptionKey:          meta.EncryptionKey,
+		SpaceLimit:             meta.Space,
 		UpdateBlockCount:       conf.GConf.BillingBlockCount,
-		UseEventualConsistency: instance.ResourceMeta.UseEventualConsistency,
-		ConsistencyLevel:       instance.ResourceMeta.ConsistencyLevel,
-		IsolationLevel:         instance.ResourceMeta.IsolationLevel,
+		UseEventualConsistency: meta.UseEventualConsistency,
+		ConsistencyLevel:       meta.ConsistencyLevel,
+		IsolationLevel:         meta.IsolationLevel,
 		SlowQueryTime:          DefaultSlowQueryTime,
+		StatementTimeout:       meta.StatementTimeout,
+		ForeignKeys:            meta.ForeignKeys,
+		LeaderReadsOnly:        meta.LeaderReadsOnly,
+		MaxReadStaleness:       meta.MaxReadStaleness,
+		WriteAck:               meta.WriteAck,
+		FetchBlobChunk:         dbms.fetchBlobChunkFromPeers,
+		WALArchiveTarget:       dbms.cfg.WALArchiveTarget,
+		WALArchiveInterval:     dbms.cfg.WALArchiveInterval,
+		StandbyNode:            meta.StandbyNode,
+		SnapshotShipInterval:   meta.SnapshotShipInterval,
+		StateDigestInterval:    dbms.cfg.StateDigestInterval,
+		OnStateDivergence:      dbms.onStateDivergence,
+		ResyncFromPeer:         dbms.resyncDatabase,
+		QueryDataset:           dbms.busService.queryDatasetProfile,
+		FetchDataset:           dbms.fetchDatasetFromPeers,
+		FirewallRules:          dbms.cfg.FirewallRules,
+		IOLimit:                dbms.cfg.DatabaseIOLimit,
 	}
 
 	// set last billing height
@@ -461,17 +598,7 @@ func (dbms *DBMS) Create(instance *types.ServiceInstance, cleanup bool) (err err
 		dbCfg.LastBillingHeight = int32(profile.LastUpdatedHeight)
 	}
 
-	if db, err = NewDatabase(dbCfg, instance.Peers, instance.GenesisBlock); err != nil {
-		return
-	}
-
-	// add to meta
-	err = dbms.addMeta(instance.DatabaseID, db)
-
-	// update metrics
-	dbCount.Add(1)
-
-	return
+	return NewDatabase(dbCfg, instance.Peers, instance.GenesisBlock)
 }
 
 // Drop remove database from the miner dbms.
@@ -491,11 +618,14 @@ func (dbms *DBMS) Drop(dbID proto.DatabaseID) (err error) {
 	// update metrics
 	dbCount.Add(-1)
 
+	// drop cached permission decisions
+	dbms.aclCache.invalidateDatabase(dbID)
+
 	// remove meta
 	return dbms.removeMeta(dbID)
 }
 
-// Update apply the new peers config to dbms.
+// Update apply the new peers config and the rotated encryption key to dbms.
 func (dbms *DBMS) Update(instance *types.ServiceInstance) (err error) {
 	var db *Database
 	var exists bool
@@ -505,7 +635,13 @@ func (dbms *DBMS) Update(instance *types.ServiceInstance) (err error) {
 	}
 
 	// update peers
-	return db.UpdatePeers(instance.Peers)
+	if err = db.UpdatePeers(instance.Peers); err != nil {
+		return
+	}
+
+	// re-encrypt the storage in background if the key is rotated
+	db.Rekey(instance.ResourceMeta.EncryptionKey)
+	return
 }
 
 // Query handles query request in dbms.
@@ -513,6 +649,13 @@ func (dbms *DBMS) Query(req *types.Request) (res *types.Response, err error) {
 	var db *Database
 	var exists bool
 
+	// shed lower priority queries first under overload
+	release, err := dbms.shedder.admit(requestPriority(req))
+	if err != nil {
+		return
+	}
+	defer release()
+
 	// check permission
 	addr, err := crypto.PubKeyHash(req.Header.Signee)
 	if err != nil {
@@ -523,12 +666,40 @@ func (dbms *DBMS) Query(req *types.Request) (res *types.Response, err error) {
 		return
 	}
 
+	// refuse writes in degraded mode, reads are still served
+	if req.Header.QueryType == types.WriteQuery && dbms.disk.isDegraded() {
+		err = errors.Wrapf(ErrDiskFull, "free space: %d", dbms.disk.freeSpace())
+		return
+	}
+
+	// refuse to lead writes if local clock is not trustworthy
+	if req.Header.QueryType == types.WriteQuery && conf.GConf != nil &&
+		conf.GConf.RefuseLeadOnClockSkew && dbms.busService.ClockSkewExceeded() {
+		err = ErrClockSkew
+		return
+	}
+
 	// find database
 	if db, exists = dbms.getMeta(req.Header.DatabaseID); !exists {
 		err = ErrNotExists
 		return
 	}
 
+	// block dangerous statement constructs
+	if err = db.firewall.check(req.Payload.Queries); err != nil {
+		return
+	}
+
+	// refuse writes in read-only maintenance mode
+	if req.Header.QueryType == types.WriteQuery {
+		if err = dbms.checkWritable(db, req.Payload.Queries); err != nil {
+			return
+		}
+		if err = dbms.checkOwnerTables(addr, req.Header.DatabaseID, req.Payload.Queries); err != nil {
+			return
+		}
+	}
+
 	return db.Query(req)
 }
 
@@ -586,42 +757,32 @@ func (dbms *DBMS) checkPermission(addr proto.AccountAddress,
 	log.Debugf("in checkPermission, database id: %s, user addr: %s", dbID, addr.String())
 
 	var (
+		decision *aclDecision
 		permStat *types.PermStat
+		version  = dbms.busService.currentStateVersion()
 		ok       bool
 	)
 
-	// get database perm stat
-	permStat, ok = dbms.busService.RequestPermStat(dbID, addr)
+	if decision, ok = dbms.aclCache.get(dbID, addr, version); !ok {
+		// get database perm stat
+		permStat, version, ok = dbms.busService.requestVersionedPermStat(dbID, addr)
 
-	// perm stat not exists
-	if !ok {
-		err = errors.Wrap(ErrPermissionDeny, "database not exists")
-		return
-	}
+		// perm stat not exists
+		if !ok {
+			err = errors.Wrap(ErrPermissionDeny, "database not exists")
+			return
+		}
 
-	// check if query is enabled
-	if !permStat.Status.EnableQuery() {
-		err = errors.Wrapf(ErrPermissionDeny, "cannot query, status: %d", permStat.Status)
-		return
+		profile, exists := dbms.busService.RequestSQLProfile(dbID)
+		decision = newACLDecision(permStat, exists && profile.Owner == addr)
+		dbms.aclCache.set(dbID, addr, version, decision)
 	}
 
 	// check query type permission
-	switch queryType {
-	case types.ReadQuery:
-		if !permStat.Permission.HasReadPermission() {
-			err = errors.Wrapf(ErrPermissionDeny, "cannot read, permission: %v", permStat.Permission)
-			return
-		}
-	case types.WriteQuery:
-		if !permStat.Permission.HasWritePermission() {
-			err = errors.Wrapf(ErrPermissionDeny, "cannot write, permission: %v", permStat.Permission)
-			return
-		}
-	default:
-		err = errors.Wrapf(ErrInvalidPermission,
-			"invalid permission, permission: %v", permStat.Permission)
+	if err = decision.check(queryType); err != nil {
 		return
 	}
+	permStat = decision.permStat
 
 	// check for query pattern
 	var (
@@ -638,11 +799,22 @@ func (dbms *DBMS) checkPermission(addr proto.AccountAddress,
 		return
 	}
 
+	// check for query rules
+	if disallowedQuery, err = checkQueryRules(permStat.Permission.Rules, queries); err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"permission": permStat.Permission,
+			"query":      disallowedQuery,
+		}).Debug("can not query")
+		return
+	}
+
 	return
 }
 
 // Shutdown defines dbms shutdown logic.
 func (dbms *DBMS) Shutdown() (err error) {
+	dbms.async.stop()
+
 	dbms.dbMap.Range(func(_, rawDB interface{}) bool {
 		db := rawDB.(*Database)
 
@@ -656,7 +828,16 @@ func (dbms *DBMS) Shutdown() (err error) {
 	// persist meta
 	err = dbms.writeMeta()
 
+	dbms.disk.stop()
+
 	dbms.busService.Stop()
 
+	if dbms.stopProbe != nil {
+		dbms.stopProbe()
+	}
+	if dbms.stopRoute != nil {
+		dbms.stopRoute()
+	}
+
 	return
 }
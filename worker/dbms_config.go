@@ -19,8 +19,10 @@ package worker
 import (
 	"time"
 
+	"github.com/SQLess/SQLess/proto"
 	"github.com/SQLess/SQLess/rpc"
 	"github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
 )
 
 var (
@@ -35,4 +37,69 @@ type DBMSConfig struct {
 	DirectServer     *rpc.Server // optional server to provide DBMS service
 	MaxReqTimeGap    time.Duration
 	OnCreateDatabase func()
+
+	// WALArchiveTarget is the optional remote storage to continuously archive database wal to,
+	// e.g. a DirWALArchiveTarget on a mounted remote file system or a MinerWALArchiveTarget.
+	// The new wal of a database is restored from the archive.
+	WALArchiveTarget   WALArchiveTarget
+	WALArchiveInterval time.Duration
+
+	// MinFreeDiskSpace is the free disk space threshold to enter degraded mode, in which
+	// new databases and writes are refused.
+	MinFreeDiskSpace  uint64
+	DiskUsageInterval time.Duration
+	// OnDiskStateChange is called when the miner enters or leaves degraded mode, after the
+	// provided space is re-announced to the block producer.
+	OnDiskStateChange func(degraded bool, free uint64)
+	// ProvideService is the service announcement of the miner, it's re-announced to the block
+	// producer with zero space in degraded mode, so that no new database is allocated to the
+	// miner until the disk space is recovered.
+	ProvideService *types.ProvideServiceHeader
+
+	// StateDigestInterval is the write count between two state digests compared among replicas.
+	StateDigestInterval uint64
+	// OnStateDivergence is called when a replica of a database is found divergent, it's used
+	// to alert the database owner.
+	OnStateDivergence func(dbID proto.DatabaseID, nodeID proto.NodeID, seq uint64)
+	// DivergenceWebhooks are the urls which the replica divergences are posted to as JSON.
+	DivergenceWebhooks []string
+
+	// FirewallRules are the enabled sql firewall rules, all rules are enabled if empty.
+	FirewallRules []string
+
+	// MaxInflightRequests is the in-flight request limit of the miner, the reads and then the
+	// writes are shed with retry-after errors as the limit is approached. Load shedding is
+	// disabled if it's zero.
+	MaxInflightRequests int64
+	// ShedRetryAfter is the retry interval suggested to the shed requests.
+	ShedRetryAfter time.Duration
+	// MaxAsyncQueries is the running asynchronous query limit of each client node, the default
+	// limit is used if it's zero.
+	MaxAsyncQueries int
+	// AsyncQueryTTL is how long the result of a finished asynchronous query is kept for the client
+	// to fetch.
+	AsyncQueryTTL time.Duration
+	// MaxAsyncResults is the retained asynchronous query limit of each client node, including the
+	// running and the finished ones, the default limit is used if it's zero.
+	MaxAsyncResults int
+	// MaxAsyncResultBytes is the retained result size limit of each client node in bytes, the
+	// default limit is used if it's zero.
+	MaxAsyncResultBytes int64
+	// MaxConcurrentDryRuns is the concurrent migration dry-run limit of the miner, each of which
+	// copies a whole database, the default limit is used if it's zero.
+	MaxConcurrentDryRuns int
+	// MigrationDryRunTimeout is the time limit of a single migration dry-run, the default timeout
+	// is used if it's zero.
+	MigrationDryRunTimeout time.Duration
+
+	// QueryMemoryBudget is the working memory of a single storage connection in bytes, the
+	// large sorts and aggregations spill to temp files beyond it, and the queries building a
+	// longer string or blob fail. The sqlite default is kept if it's zero.
+	QueryMemoryBudget int64
+	// DatabaseIOLimit is the write rate limit applied to each hosted database, so that the
+	// co-located databases get predictable performance.
+	DatabaseIOLimit IOLimit
+	// StorageMemoryLimit is the soft heap limit of all the storages hosted by the miner in
+	// bytes, no limit is set if it's zero.
+	StorageMemoryLimit int64
 }
@@ -0,0 +1,139 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	divergenceWebhookTimeout = 10 * time.Second
+)
+
+// StateDivergence defines a replica divergence alert of a database, posted as JSON to the
+// divergence webhooks.
+type StateDivergence struct {
+	DatabaseID proto.DatabaseID
+	NodeID     proto.NodeID
+	Seq        uint64
+	Detected   time.Time
+}
+
+// StateDigest returns the state digest of the database at the sequence with the replicas known
+// to be divergent, only the miners and the owner of the database are allowed.
+func (dbms *DBMS) StateDigest(req *types.StateDigestReq) (resp *types.StateDigestResp, err error) {
+	if err = dbms.checkDigestPermission(req.DatabaseID, req.GetNodeID().ToNodeID()); err != nil {
+		return
+	}
+	db, ok := dbms.getMeta(req.DatabaseID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	resp = &types.StateDigestResp{}
+	if db.digester == nil {
+		return
+	}
+	var digest *types.StateDigest
+	if digest, resp.Found = db.digester.get(req.Seq); resp.Found {
+		resp.Digest = *digest
+	}
+	resp.Divergent = db.digester.divergentNodes()
+	return
+}
+
+func (dbms *DBMS) checkDigestPermission(dbID proto.DatabaseID, nodeID proto.NodeID) (err error) {
+	profile, ok := dbms.busService.RequestSQLProfile(dbID)
+	if !ok {
+		return ErrNotExists
+	}
+	for _, mi := range profile.Miners {
+		if mi.NodeID == nodeID {
+			return
+		}
+	}
+	pubKey, err := kms.GetPublicKey(nodeID)
+	if err != nil {
+		return errors.Wrap(ErrPermissionDeny, "unknown node")
+	}
+	addr, err := crypto.PubKeyHash(pubKey)
+	if err != nil {
+		return
+	}
+	if profile.Owner != addr {
+		return errors.Wrapf(ErrPermissionDeny, "%s is neither a miner nor the owner of database %s",
+			nodeID, dbID)
+	}
+	return
+}
+
+// onStateDivergence alerts the divergent replica of a database to the configured handler and
+// the divergence webhooks.
+func (dbms *DBMS) onStateDivergence(dbID proto.DatabaseID, nodeID proto.NodeID, seq uint64) {
+	if dbms.cfg.OnStateDivergence != nil {
+		dbms.cfg.OnStateDivergence(dbID, nodeID, seq)
+	}
+	if len(dbms.cfg.DivergenceWebhooks) == 0 {
+		return
+	}
+	data, err := json.Marshal(&StateDivergence{
+		DatabaseID: dbID,
+		NodeID:     nodeID,
+		Seq:        seq,
+		Detected:   time.Now().UTC(),
+	})
+	if err != nil {
+		log.WithError(err).Error("marshal state divergence failed")
+		return
+	}
+	for _, url := range dbms.cfg.DivergenceWebhooks {
+		go postStateDivergence(url, data)
+	}
+}
+
+func postStateDivergence(url string, data []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), divergenceWebhookTimeout)
+	defer cancel()
+	le := log.WithField("webhook", url)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		le.WithError(err).Error("build state divergence webhook request failed")
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		le.WithError(err).Error("post state divergence webhook failed")
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		le.WithField("status", resp.StatusCode).Error("state divergence webhook rejected")
+	}
+}
@@ -38,6 +38,7 @@ const (
 type DBKayakMuxService struct {
 	serviceName string
 	serviceMap  sync.Map
+	shedder     *loadShedder
 }
 
 // NewDBKayakMuxService returns a new kayak mux service.
@@ -64,6 +65,10 @@ func (s *DBKayakMuxService) Apply(req *kt.ApplyRequest, _ *interface{}) (err err
 	// treat req.Instance as DatabaseID
 	id := proto.DatabaseID(req.Instance)
 
+	// replication is always admitted but counted as in-flight load
+	release, _ := s.shedder.admit(PrioritySystem)
+	defer release()
+
 	if v, ok := s.serviceMap.Load(id); ok {
 		return v.(*kayak.Runtime).FollowerApply(req.Log)
 	}
@@ -75,6 +80,9 @@ func (s *DBKayakMuxService) Apply(req *kt.ApplyRequest, _ *interface{}) (err err
 func (s *DBKayakMuxService) Fetch(req *kt.FetchRequest, resp *kt.FetchResponse) (err error) {
 	id := proto.DatabaseID(req.Instance)
 
+	release, _ := s.shedder.admit(PrioritySystem)
+	defer release()
+
 	if v, ok := s.serviceMap.Load(id); ok {
 		var l *kt.Log
 		if l, err = v.(*kayak.Runtime).Fetch(req.GetContext(), req.Index); err == nil {
@@ -17,9 +17,12 @@
 package worker
 
 import (
+	"context"
+
 	"github.com/pkg/errors"
 	metrics "github.com/rcrowley/go-metrics"
 
+	"github.com/SQLess/SQLess/conf"
 	"github.com/SQLess/SQLess/proto"
 	"github.com/SQLess/SQLess/route"
 	"github.com/SQLess/SQLess/rpc"
@@ -74,11 +77,6 @@ func NewDBMSRPCService(
 
 // Query rpc, called by client to issue read/write query.
 func (rpc *DBMSRPCService) Query(req *types.Request, res *types.Response) (err error) {
-	// Just need to verify signature in db.saveAck
-	//if err = req.Verify(); err != nil {
-	//	dbQueryFailCounter.Mark(1)
-	//	return
-	//}
 	// verify query is sent from the request node
 	if req.Envelope.NodeID.String() != string(req.Header.NodeID) {
 		// node id mismatch
@@ -87,6 +85,19 @@ func (rpc *DBMSRPCService) Query(req *types.Request, res *types.Response) (err e
 		return
 	}
 
+	// only decompress the payload of a request signed by the declared signee
+	if req.Encoding != types.CompressionNone {
+		if err = req.Header.Verify(); err != nil {
+			dbQueryFailCounter.Mark(1)
+			return
+		}
+		if err = req.Decompress(); err != nil {
+			err = errors.Wrap(ErrInvalidRequest, err.Error())
+			dbQueryFailCounter.Mark(1)
+			return
+		}
+	}
+
 	var r *types.Response
 	if r, err = rpc.dbms.Query(req); err != nil {
 		dbQueryFailCounter.Mark(1)
@@ -94,6 +105,14 @@ func (rpc *DBMSRPCService) Query(req *types.Request, res *types.Response) (err e
 	}
 
 	*res = *r
+	// compress large responses for the clients accepting it
+	if req.AcceptEncoding != types.CompressionNone {
+		if err = res.Compress(req.AcceptEncoding); err != nil {
+			dbQueryFailCounter.Mark(1)
+			return
+		}
+	}
+	res.AcceptEncoding = types.CompressionDeflate
 	dbQuerySuccCounter.Mark(1)
 
 	return
@@ -142,3 +161,228 @@ func (rpc *DBMSRPCService) Deploy(req *types.UpdateService, _ *types.UpdateServi
 
 	return
 }
+
+// PutBlobChunk rpc, called by client to upload a blob chunk.
+func (rpc *DBMSRPCService) PutBlobChunk(req *types.BlobChunkReq, resp *types.BlobChunkResp) (err error) {
+	if err = rpc.dbms.PutBlobChunk(req); err != nil {
+		return
+	}
+
+	resp.Hash = req.Header.Hash
+	return
+}
+
+// FetchBlobChunk rpc, called by client or peer miners to download a blob chunk.
+func (rpc *DBMSRPCService) FetchBlobChunk(req *types.BlobChunkReq, resp *types.BlobChunkResp) (err error) {
+	var data []byte
+	if data, err = rpc.dbms.FetchBlobChunk(req); err != nil {
+		return
+	}
+
+	resp.Hash = req.Header.Hash
+	resp.Data = data
+	return
+}
+
+// PutWALSegment rpc, called by peer miners to archive a wal segment of their database.
+func (rpc *DBMSRPCService) PutWALSegment(req *types.PutWALSegmentReq, _ *types.PutWALSegmentResp) (err error) {
+	return rpc.dbms.PutWALSegment(req)
+}
+
+// FetchWALSegment rpc, called by peer miners to restore their database from the wal archive.
+func (rpc *DBMSRPCService) FetchWALSegment(req *types.FetchWALSegmentReq, resp *types.FetchWALSegmentResp) (err error) {
+	resp.Data, err = rpc.dbms.FetchWALSegment(req)
+	return
+}
+
+// BuildInfo rpc, called by peer miners to check the build of this miner.
+func (rpc *DBMSRPCService) BuildInfo(_ *types.MinerBuildInfoReq, resp *types.MinerBuildInfoResp) (err error) {
+	resp.Build = conf.GetBuildInfo()
+	return
+}
+
+// CheckFeature rpc, called by database owner to check feature readiness of the miner group.
+func (rpc *DBMSRPCService) CheckFeature(req *types.CheckFeatureReq, resp *types.CheckFeatureResp) (err error) {
+	resp.Ready, resp.MinVersion, resp.Missing, err = rpc.dbms.CheckFeature(req)
+	return
+}
+
+// ExportDatabase rpc, called by client to export the database as a plain SQLite file.
+func (rpc *DBMSRPCService) ExportDatabase(req *types.ExportDatabaseReq, resp *types.ExportDatabaseResp) (err error) {
+	var header *types.SignedExportHeader
+	if header, resp.Data, err = rpc.dbms.ExportDatabase(context.Background(), req); err != nil {
+		return
+	}
+	resp.Header = *header
+	return
+}
+
+// StateDigest rpc, called by peer miners and database owner to compare replica state digests.
+func (rpc *DBMSRPCService) StateDigest(req *types.StateDigestReq, resp *types.StateDigestResp) (err error) {
+	var r *types.StateDigestResp
+	if r, err = rpc.dbms.StateDigest(req); err != nil {
+		return
+	}
+	*resp = *r
+	return
+}
+
+// FetchSnapshotChunk rpc, called by peer miners to repair a divergent replica.
+func (rpc *DBMSRPCService) FetchSnapshotChunk(req *types.SnapshotChunkReq, resp *types.SnapshotChunkResp) (err error) {
+	var r *types.SnapshotChunkResp
+	if r, err = rpc.dbms.FetchSnapshotChunk(req); err != nil {
+		return
+	}
+	*resp = *r
+	return
+}
+
+// ShipSnapshotChunk rpc, called by miners of the database to ship snapshots to the standby miner.
+func (rpc *DBMSRPCService) ShipSnapshotChunk(req *types.ShipSnapshotChunkReq, resp *types.ShipSnapshotChunkResp) (err error) {
+	resp.Offset, err = rpc.dbms.ShipSnapshotChunk(req)
+	return
+}
+
+// PromoteStandby rpc, called by database owner to promote the standby miner if the primary
+// region is lost.
+func (rpc *DBMSRPCService) PromoteStandby(req *types.PromoteStandbyReq, resp *types.PromoteStandbyResp) (err error) {
+	var info *types.SnapshotInfo
+	if info, err = rpc.dbms.PromoteStandby(req); err != nil {
+		return
+	}
+	resp.Info = *info
+	return
+}
+
+// PrepareDataset rpc, called by database owner to prepare a snapshot for dataset publishing.
+func (rpc *DBMSRPCService) PrepareDataset(req *types.PrepareDatasetReq, resp *types.PrepareDatasetResp) (err error) {
+	var info *types.SnapshotInfo
+	if info, err = rpc.dbms.PrepareDataset(req); err != nil {
+		return
+	}
+	resp.Info = *info
+	return
+}
+
+// FetchDatasetChunk rpc, called by anyone to fetch the published datasets of the database.
+func (rpc *DBMSRPCService) FetchDatasetChunk(req *types.FetchDatasetChunkReq, resp *types.FetchDatasetChunkResp) (err error) {
+	var r *types.FetchDatasetChunkResp
+	if r, err = rpc.dbms.FetchDatasetChunk(req); err != nil {
+		return
+	}
+	*resp = *r
+	return
+}
+
+// QueryReceiptProof rpc, called by anyone to verify the write receipt against the sqlchain.
+func (rpc *DBMSRPCService) QueryReceiptProof(req *types.QueryReceiptProofReq, resp *types.QueryReceiptProofResp) (err error) {
+	var proof *types.ReceiptProof
+	if proof, err = rpc.dbms.QueryReceiptProof(req); err != nil {
+		return
+	}
+	resp.Proof = *proof
+	return
+}
+
+// QueryProof rpc, called by auditors to prove the query at the position of the sqlchain.
+func (rpc *DBMSRPCService) QueryProof(req *types.QueryProofReq, resp *types.QueryProofResp) (err error) {
+	var proof *types.ReceiptProof
+	if proof, err = rpc.dbms.QueryProof(req); err != nil {
+		return
+	}
+	resp.Proof = *proof
+	return
+}
+
+// FetchBlockHeaders rpc, called by auditors to fetch the sqlchain block headers.
+func (rpc *DBMSRPCService) FetchBlockHeaders(req *types.FetchBlockHeadersReq, resp *types.FetchBlockHeadersResp) (err error) {
+	resp.Headers, resp.Head, err = rpc.dbms.FetchBlockHeaders(req)
+	return
+}
+
+// CancelQuery rpc, called by client to cancel its running read query.
+func (rpc *DBMSRPCService) CancelQuery(req *types.CancelQueryReq, resp *types.CancelQueryResp) (err error) {
+	resp.Canceled, err = rpc.dbms.CancelQuery(req)
+	return
+}
+
+// SubmitAsyncQuery rpc, called by client to run a long read query asynchronously.
+func (rpc *DBMSRPCService) SubmitAsyncQuery(req *types.Request, resp *types.SubmitAsyncQueryResp) (err error) {
+	// verify query is sent from the request node
+	if req.Envelope.NodeID.String() != string(req.Header.NodeID) {
+		err = errors.Wrap(ErrInvalidRequest, "request node id mismatch in async query")
+		return
+	}
+	// only decompress the payload of a request signed by the declared signee
+	if req.Encoding != types.CompressionNone {
+		if err = req.Header.Verify(); err != nil {
+			return
+		}
+		if err = req.Decompress(); err != nil {
+			err = errors.Wrap(ErrInvalidRequest, err.Error())
+			return
+		}
+	}
+	resp.Status, err = rpc.dbms.SubmitAsyncQuery(req)
+	return
+}
+
+// AsyncQueryStatus rpc, called by client to poll the status of its asynchronous query.
+func (rpc *DBMSRPCService) AsyncQueryStatus(req *types.AsyncQueryReq, resp *types.AsyncQueryResp) (err error) {
+	resp.Status, err = rpc.dbms.AsyncQueryStatus(req)
+	return
+}
+
+// FetchAsyncQuery rpc, called by client to fetch the result of its asynchronous query.
+func (rpc *DBMSRPCService) FetchAsyncQuery(req *types.AsyncQueryReq, resp *types.AsyncQueryResp) (err error) {
+	var r *types.Response
+	if resp.Status, r, err = rpc.dbms.FetchAsyncQuery(req); err != nil || r == nil {
+		return
+	}
+	// the result is kept for repeated fetches, compress a copy of it
+	var res = *r
+	if req.AcceptEncoding != types.CompressionNone {
+		if err = res.Compress(req.AcceptEncoding); err != nil {
+			return
+		}
+	}
+	res.AcceptEncoding = types.CompressionDeflate
+	resp.Response = &res
+	return
+}
+
+// CancelAsyncQuery rpc, called by client to cancel or discard its asynchronous query.
+func (rpc *DBMSRPCService) CancelAsyncQuery(req *types.AsyncQueryReq, resp *types.AsyncQueryResp) (err error) {
+	resp.Status, err = rpc.dbms.CancelAsyncQuery(req)
+	return
+}
+
+// MigrationDryRun rpc, called by client to estimate a migration before applying it.
+func (rpc *DBMSRPCService) MigrationDryRun(req *types.MigrationDryRunReq, resp *types.MigrationDryRunResp) (err error) {
+	var r *types.MigrationDryRunResp
+	if r, err = rpc.dbms.MigrationDryRun(context.Background(), req); err != nil {
+		return
+	}
+	*resp = *r
+	return
+}
+
+// TableUsage rpc, called by database owner to get the storage usage of each table.
+func (rpc *DBMSRPCService) TableUsage(req *types.TableUsageReq, resp *types.TableUsageResp) (err error) {
+	var r *types.TableUsageResp
+	if r, err = rpc.dbms.TableUsage(context.Background(), req); err != nil {
+		return
+	}
+	*resp = *r
+	return
+}
+
+// RowDigests rpc, called by database owner to compare table rows between replicas.
+func (rpc *DBMSRPCService) RowDigests(req *types.RowDigestsReq, resp *types.RowDigestsResp) (err error) {
+	var r *types.RowDigestsResp
+	if r, err = rpc.dbms.RowDigests(context.Background(), req); err != nil {
+		return
+	}
+	*resp = *r
+	return
+}
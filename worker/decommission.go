@@ -0,0 +1,133 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/blockproducer/interfaces"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// decommissionMiner applies the miner decommission on chain to the local databases, see
+// types.DecommissionMiner. A replacement miner restores its replica from a snapshot of the
+// serving miners and joins the replication group, the other miners update the peers, and the
+// departed miner drops the databases it is removed from.
+func (dbms *DBMS) decommissionMiner(itx interfaces.Transaction, count uint32) {
+	tx, ok := itx.(*types.DecommissionMiner)
+	if !ok {
+		log.WithFields(log.Fields{
+			"type": itx.GetTransactionType(),
+		}).WithError(ErrInvalidTransactionType).Warn("invalid tx type in decommission miner")
+		return
+	}
+
+	var mapping = dbms.busService.GetCurrentDBMapping()
+	for id, profile := range mapping {
+		le := log.WithFields(log.Fields{
+			"db":     id,
+			"leaver": tx.GetAccountAddress(),
+		})
+		instance, err := dbms.buildSQLChainServiceInstance(profile)
+		if err != nil {
+			le.WithError(err).Warn("failed to build sqlchain service instance from profile")
+			continue
+		}
+		if db, exists := dbms.getMeta(id); exists {
+			if err = db.UpdatePeers(instance.Peers); err != nil {
+				le.WithError(err).Warn("failed to update database peers")
+			}
+			continue
+		}
+		// only join the databases being migrated, the others are recovered by initDatabases
+		if !isMigrating(profile) {
+			continue
+		}
+		if err = dbms.joinDatabase(instance, profile); err != nil {
+			le.WithError(err).Error("failed to join database as replacement miner")
+		}
+	}
+
+	if !tx.Finalize || tx.GetAccountAddress() != dbms.address {
+		return
+	}
+	var missing []proto.DatabaseID
+	dbms.dbMap.Range(func(key, _ interface{}) bool {
+		if _, ok := mapping[key.(proto.DatabaseID)]; !ok {
+			missing = append(missing, key.(proto.DatabaseID))
+		}
+		return true
+	})
+	for _, id := range missing {
+		le := log.WithField("db", id)
+		if !dbms.isRemovedMiner(id) {
+			le.Warn("database missing from mapping is not left by decommission, keep it")
+			continue
+		}
+		if err := dbms.Drop(id); err != nil {
+			le.WithError(err).Error("failed to drop the database left")
+		}
+	}
+}
+
+// isRemovedMiner reports whether the local miner is removed from the database by the finalized
+// decommission, i.e. it is decommissioning or no longer a miner of the database on chain. The
+// profile is queried from block producers instead of the cached mapping, so that a database
+// missing from the mapping because of lag or a failed fetch is not mistaken for a left one.
+func (dbms *DBMS) isRemovedMiner(dbID proto.DatabaseID) bool {
+	profile, err := dbms.busService.querySQLProfile(dbID)
+	if err != nil || profile.ID != dbID {
+		return false
+	}
+	for _, mi := range profile.Miners {
+		if mi.Address == dbms.address {
+			return mi.Status == types.Decommissioning
+		}
+	}
+	return true
+}
+
+// joinDatabase creates the database on the replacement miner, the replica is restored from a
+// snapshot of the leader or another serving miner in background.
+func (dbms *DBMS) joinDatabase(instance *types.ServiceInstance, profile *types.SQLChainProfile) (err error) {
+	var source proto.NodeID
+	for _, mi := range profile.Miners {
+		if mi.Address != dbms.address {
+			source = mi.NodeID
+			break
+		}
+	}
+	if source.IsEmpty() {
+		return errors.Wrap(ErrNotExists, "no serving miner to restore from")
+	}
+	if err = dbms.Create(instance, true); err != nil {
+		return
+	}
+	return dbms.resyncDatabase(instance.DatabaseID, source)
+}
+
+// isMigrating reports whether a miner of the database is decommissioning.
+func isMigrating(profile *types.SQLChainProfile) bool {
+	for _, mi := range profile.Miners {
+		if mi.Status == types.Decommissioning {
+			return true
+		}
+	}
+	return false
+}
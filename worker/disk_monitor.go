@@ -0,0 +1,210 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	rpc "github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultDiskUsageInterval defines the default interval of miner disk usage checking.
+	DefaultDiskUsageInterval = 10 * time.Second
+
+	// DefaultMinFreeDiskSpace defines the default free disk space threshold of degraded mode.
+	DefaultMinFreeDiskSpace = 256 << 20
+
+	mwMinerDiskFree     = "service:miner:disk:free"
+	mwMinerDiskDegraded = "service:miner:disk:degraded"
+)
+
+var (
+	diskFree     = new(expvar.Int)
+	diskDegraded = new(expvar.Int)
+)
+
+func init() {
+	expvar.Publish(mwMinerDiskFree, diskFree)
+	expvar.Publish(mwMinerDiskDegraded, diskDegraded)
+}
+
+// diskMonitor watches the free disk space of the miner data directory and switches the miner
+// into degraded mode when the free space drops below the threshold. In degraded mode, new
+// databases and write queries are refused while read queries are still served.
+type diskMonitor struct {
+	path     string
+	minFree  uint64
+	interval time.Duration
+	onChange func(degraded bool, free uint64)
+
+	degraded uint32
+	free     uint64
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newDiskMonitor(path string, minFree uint64, interval time.Duration,
+	onChange func(degraded bool, free uint64)) *diskMonitor {
+	if minFree == 0 {
+		minFree = DefaultMinFreeDiskSpace
+	}
+	if interval <= 0 {
+		interval = DefaultDiskUsageInterval
+	}
+	return &diskMonitor{
+		path:     path,
+		minFree:  minFree,
+		interval: interval,
+		onChange: onChange,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+func (m *diskMonitor) start() {
+	m.check()
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stopCh:
+				return
+			case <-ticker.C:
+				m.check()
+			}
+		}
+	}()
+}
+
+func (m *diskMonitor) stop() {
+	select {
+	case <-m.stopCh:
+		return
+	default:
+		close(m.stopCh)
+	}
+	m.wg.Wait()
+}
+
+func (m *diskMonitor) check() {
+	free, _, err := utils.DiskUsage(m.path)
+	if err != nil {
+		log.WithField("path", m.path).WithError(err).Warning("check disk usage failed")
+		return
+	}
+	m.update(free)
+}
+
+func (m *diskMonitor) update(free uint64) {
+	atomic.StoreUint64(&m.free, free)
+	diskFree.Set(int64(free))
+
+	var degraded uint32
+	if free < m.minFree {
+		degraded = 1
+	}
+	if atomic.SwapUint32(&m.degraded, degraded) == degraded {
+		return
+	}
+	diskDegraded.Set(int64(degraded))
+
+	le := log.WithFields(log.Fields{
+		"path":     m.path,
+		"free":     free,
+		"min_free": m.minFree,
+	})
+	if degraded == 1 {
+		le.Error("miner disk is almost full, enter degraded mode")
+	} else {
+		le.Info("miner disk space recovered, leave degraded mode")
+	}
+	if m.onChange != nil {
+		go m.onChange(degraded == 1, free)
+	}
+}
+
+// isDegraded returns whether the miner is running in degraded mode.
+func (m *diskMonitor) isDegraded() bool {
+	return atomic.LoadUint32(&m.degraded) == 1
+}
+
+// freeSpace returns the latest free disk space.
+func (m *diskMonitor) freeSpace() uint64 {
+	return atomic.LoadUint64(&m.free)
+}
+
+// onDiskStateChange signals the block producer when the miner enters or leaves degraded mode.
+func (dbms *DBMS) onDiskStateChange(degraded bool, free uint64) {
+	if dbms.cfg.ProvideService != nil {
+		if err := dbms.announceSpace(degraded); err != nil {
+			log.WithFields(log.Fields{
+				"degraded": degraded,
+				"free":     free,
+			}).WithError(err).Error("announce provided space to block producer failed")
+		}
+	}
+	if dbms.cfg.OnDiskStateChange != nil {
+		dbms.cfg.OnDiskStateChange(degraded, free)
+	}
+}
+
+// announceSpace re-sends the provide service transaction of the miner, with zero space in
+// degraded mode and the configured space otherwise.
+func (dbms *DBMS) announceSpace(degraded bool) (err error) {
+	var (
+		header   = *dbms.cfg.ProvideService
+		caller   = rpc.NewCaller()
+		bpNodeID proto.NodeID
+		nonceReq = &types.NextAccountNonceReq{Addr: dbms.address}
+		nonceRes = &types.NextAccountNonceResp{}
+	)
+	if degraded {
+		header.Space = 0
+	}
+	if header.NodeID == "" {
+		header.NodeID = localNodeID()
+	}
+	if bpNodeID, err = rpc.GetCurrentBP(); err != nil {
+		return
+	}
+	if err = caller.CallNode(
+		bpNodeID, route.MCCNextAccountNonce.String(), nonceReq, nonceRes,
+	); err != nil {
+		return errors.Wrap(err, "get account nonce failed")
+	}
+	header.Nonce = nonceRes.Nonce
+
+	var tx = types.NewProvideService(&header)
+	if err = tx.Sign(dbms.privKey); err != nil {
+		return
+	}
+	return caller.CallNode(
+		bpNodeID, route.MCCAddTx.String(), &types.AddTxReq{Tx: tx}, &types.AddTxResp{})
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDiskMonitor(t *testing.T) {
+	Convey("Given a disk monitor with 1KB free space threshold", t, func() {
+		var changes = make(chan bool, 4)
+		m := newDiskMonitor("", 1024, 0, func(degraded bool, free uint64) {
+			changes <- degraded
+		})
+		So(m.interval, ShouldEqual, DefaultDiskUsageInterval)
+		So(m.isDegraded(), ShouldBeFalse)
+
+		Convey("The monitor should enter and leave degraded mode by free space", func() {
+			m.update(2048)
+			So(m.isDegraded(), ShouldBeFalse)
+			So(m.freeSpace(), ShouldEqual, 2048)
+
+			m.update(512)
+			So(m.isDegraded(), ShouldBeTrue)
+			select {
+			case degraded := <-changes:
+				So(degraded, ShouldBeTrue)
+			case <-time.After(time.Second):
+				So("state change not signaled", ShouldBeEmpty)
+			}
+
+			m.update(4096)
+			So(m.isDegraded(), ShouldBeFalse)
+			select {
+			case degraded := <-changes:
+				So(degraded, ShouldBeFalse)
+			case <-time.After(time.Second):
+				So("state change not signaled", ShouldBeEmpty)
+			}
+		})
+	})
+	Convey("Given a DBMS without service announcement", t, func() {
+		var (
+			changes = make(chan uint64, 1)
+			dbms    = &DBMS{cfg: &DBMSConfig{
+				OnDiskStateChange: func(degraded bool, free uint64) { changes <- free },
+			}}
+		)
+		dbms.disk = newDiskMonitor("", 1024, 0, dbms.onDiskStateChange)
+		Convey("The disk state change should still be signaled to the callback", func() {
+			dbms.disk.update(512)
+			select {
+			case free := <-changes:
+				So(free, ShouldEqual, 512)
+			case <-time.After(time.Second):
+				So("state change not signaled", ShouldBeEmpty)
+			}
+		})
+	})
+}
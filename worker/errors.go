@@ -31,12 +31,46 @@ var (
 	ErrInvalidDBConfig = errors.New("invalid database configuration")
 	// ErrSpaceLimitExceeded defines errors on disk space exceeding limit.
 	ErrSpaceLimitExceeded = errors.New("space limit exceeded")
+	// ErrDiskFull defines errors on miner running out of disk space.
+	ErrDiskFull = errors.New("miner disk is full, running in read-only degraded mode")
+	// ErrClockSkew defines errors on local clock skew exceeding the max tolerable skew.
+	ErrClockSkew = errors.New("local clock skew exceeds threshold, refuse to lead writes")
+	// ErrReadOnlyMaintenance defines errors on writing a database in read-only maintenance mode.
+	ErrReadOnlyMaintenance = errors.New("database is in read-only maintenance mode")
+	// ErrStatementBlocked defines errors on queries containing constructs blocked by sql firewall.
+	ErrStatementBlocked = errors.New("statement blocked by sql firewall")
+	// ErrNotLeader defines errors on sending a leader only request to a follower miner.
+	ErrNotLeader = errors.New("miner is not leader of the database")
 	// ErrUnknownMuxRequest indicates that the a multiplexing request endpoint is not found.
 	ErrUnknownMuxRequest = errors.New("unknown multiplexing request")
 	// ErrPermissionDeny indicates that the requester has no permission to send read or write query.
 	ErrPermissionDeny = errors.New("permission deny")
 	// ErrInvalidPermission indicates that the requester sends a unrecognized permission.
 	ErrInvalidPermission = errors.New("invalid permission")
+	// ErrUnknownFeature indicates that the requested protocol feature is unknown.
+	ErrUnknownFeature = errors.New("unknown feature")
+	// ErrFeatureNotReady indicates that some miners of the database do not support the feature yet.
+	ErrFeatureNotReady = errors.New("feature not ready on all miners")
 	// ErrInvalidTransactionType indicates that the transaction type is invalid.
 	ErrInvalidTransactionType = errors.New("invalid transaction type")
+	// ErrStatementTimeout indicates that the query is interrupted by the statement timeout.
+	ErrStatementTimeout = errors.New("statement timeout")
+	// ErrOverloaded indicates that the request is shed by the overloaded miner, it should be
+	// retried after the suggested interval.
+	ErrOverloaded = errors.New("miner overloaded")
+	// ErrIOThrottled indicates that the write could not be scheduled within the i/o limit of the
+	// database before its deadline.
+	ErrIOThrottled = errors.New("database write i/o throttled")
+	// ErrQueryCanceled indicates that the query is interrupted by the cancellation of the client.
+	ErrQueryCanceled = errors.New("query canceled")
+	// ErrReplicaTooStale indicates that the follower lags too far behind to serve the read query.
+	ErrReplicaTooStale = errors.New("replica is too stale to serve read query")
+	// ErrNotStandby indicates that the miner is not the designated standby of the database.
+	ErrNotStandby = errors.New("miner is not the standby of the database")
+	// ErrAsyncQueryNotFound indicates that the asynchronous query job does not exist or is expired.
+	ErrAsyncQueryNotFound = errors.New("async query not found")
+	// ErrTooManyAsyncQueries indicates that the client node runs too many asynchronous queries.
+	ErrTooManyAsyncQueries = errors.New("too many running async queries")
+	// ErrTooManyDryRuns indicates that the miner runs too many migration dry-runs concurrently.
+	ErrTooManyDryRuns = errors.New("too many running migration dry-runs")
 )
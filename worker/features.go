@@ -0,0 +1,227 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/conf"
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	rpc "github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// Feature defines a protocol feature which requires all miners of a database to support.
+type Feature string
+
+const (
+	// FeatureBlob defines the content-addressed blob storage feature.
+	FeatureBlob Feature = "blob"
+
+	// PeerBuildInfoTTL defines the cache ttl of peer miner build info.
+	PeerBuildInfoTTL = time.Minute
+)
+
+// featureRequirement defines the minimum version and capability a miner needs to serve a feature,
+// the version is not checked if MinVersion is empty.
+type featureRequirement struct {
+	MinVersion string
+	Capability string
+}
+
+var featureRequirements = map[Feature]featureRequirement{
+	// the blob storage is announced by capability, which is registered by the builds serving it
+	FeatureBlob: {Capability: "blob"},
+}
+
+// satisfies checks if the build satisfies the requirement, builds without a release version
+// (e.g. development builds) are accepted by capability only.
+func (r featureRequirement) satisfies(build *proto.BuildInfo) bool {
+	if build == nil {
+		return false
+	}
+	if r.Capability != "" {
+		var found bool
+		for _, c := range build.Capabilities {
+			if c == r.Capability {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.MinVersion == "" || build.Version == "" || build.Version == "unknown" {
+		return true
+	}
+	return utils.CompareVersion(build.Version, r.MinVersion) >= 0
+}
+
+type cachedBuildInfo struct {
+	build    *proto.BuildInfo
+	cachedAt time.Time
+}
+
+// featureGate decides if a feature can be enabled on a miner group by the minimum version of
+// the group, so mixed-version groups keep working during rolling upgrades.
+type featureGate struct {
+	sync.Mutex
+	self   proto.NodeID
+	ttl    time.Duration
+	builds map[proto.NodeID]*cachedBuildInfo
+	fetch  func(proto.NodeID) (*proto.BuildInfo, error)
+}
+
+func newFeatureGate(self proto.NodeID) *featureGate {
+	return &featureGate{
+		self:   self,
+		ttl:    PeerBuildInfoTTL,
+		builds: make(map[proto.NodeID]*cachedBuildInfo),
+		fetch:  fetchPeerBuildInfo,
+	}
+}
+
+// localNodeID returns the node id of the local miner, which is empty if the config is not loaded.
+func localNodeID() proto.NodeID {
+	if conf.GConf == nil {
+		return ""
+	}
+	return conf.GConf.ThisNodeID
+}
+
+func fetchPeerBuildInfo(nodeID proto.NodeID) (build *proto.BuildInfo, err error) {
+	resp := &types.MinerBuildInfoResp{}
+	if err = rpc.NewCaller().CallNode(
+		nodeID, route.DBSBuildInfo.String(), &types.MinerBuildInfoReq{}, resp,
+	); err != nil {
+		return
+	}
+	build = &resp.Build
+	return
+}
+
+func (g *featureGate) buildInfo(nodeID proto.NodeID) (build *proto.BuildInfo, err error) {
+	if nodeID == g.self {
+		local := conf.GetBuildInfo()
+		return &local, nil
+	}
+
+	g.Lock()
+	cached, ok := g.builds[nodeID]
+	g.Unlock()
+	if ok && time.Since(cached.cachedAt) < g.ttl {
+		return cached.build, nil
+	}
+
+	if build, err = g.fetch(nodeID); err != nil {
+		return
+	}
+	g.Lock()
+	defer g.Unlock()
+	g.builds[nodeID] = &cachedBuildInfo{build: build, cachedAt: time.Now()}
+	return
+}
+
+// check returns the feature readiness of the miner group, unreachable miners are considered
+// as not ready.
+func (g *featureGate) check(
+	feature Feature, miners []proto.NodeID,
+) (ready bool, minVersion string, missing []proto.NodeID, err error) {
+	req, ok := featureRequirements[feature]
+	if !ok {
+		err = errors.Wrapf(ErrUnknownFeature, "feature: %s", feature)
+		return
+	}
+	for _, nodeID := range miners {
+		build, fetchErr := g.buildInfo(nodeID)
+		if fetchErr != nil {
+			log.WithField("node", nodeID).WithError(fetchErr).Debug("query peer build info failed")
+			missing = append(missing, nodeID)
+			continue
+		}
+		if minVersion == "" || utils.CompareVersion(build.Version, minVersion) < 0 {
+			minVersion = build.Version
+		}
+		if !req.satisfies(build) {
+			missing = append(missing, nodeID)
+		}
+	}
+	ready = len(missing) == 0
+	return
+}
+
+// checkFeature returns the feature readiness of the miner group of the database.
+func (dbms *DBMS) checkFeature(
+	dbID proto.DatabaseID, feature Feature,
+) (ready bool, minVersion string, missing []proto.NodeID, err error) {
+	profile, ok := dbms.busService.RequestSQLProfile(dbID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	var miners = make([]proto.NodeID, 0, len(profile.Miners))
+	for _, mi := range profile.Miners {
+		miners = append(miners, mi.NodeID)
+	}
+	return dbms.features.check(feature, miners)
+}
+
+// requireFeature returns an error if the feature is not ready on the miner group of the database.
+func (dbms *DBMS) requireFeature(dbID proto.DatabaseID, feature Feature) (err error) {
+	ready, minVersion, missing, err := dbms.checkFeature(dbID, feature)
+	if err != nil {
+		return
+	}
+	if !ready {
+		err = errors.Wrapf(ErrFeatureNotReady,
+			"feature: %s, min version: %s, missing: %v", feature, minVersion, missing)
+	}
+	return
+}
+
+// CheckFeature checks whether the miner group of the database is ready for the feature, only
+// the database owner is allowed to check before enabling the feature.
+func (dbms *DBMS) CheckFeature(req *types.CheckFeatureReq) (
+	ready bool, minVersion string, missing []proto.NodeID, err error,
+) {
+	var addr proto.AccountAddress
+	if err = req.Header.Verify(); err != nil {
+		return
+	}
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		return
+	}
+	profile, ok := dbms.busService.RequestSQLProfile(req.Header.DatabaseID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	if profile.Owner != addr {
+		err = errors.Wrapf(ErrPermissionDeny, "%s is not owner of database %s",
+			addr.String(), req.Header.DatabaseID)
+		return
+	}
+	return dbms.checkFeature(req.Header.DatabaseID, Feature(req.Header.Feature))
+}
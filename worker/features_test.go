@@ -0,0 +1,76 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestFeatureGate(t *testing.T) {
+	Convey("test feature gate on mixed-version miner group", t, func() {
+		var (
+			builds = map[proto.NodeID]*proto.BuildInfo{
+				"node1": {Version: "0.6.1", Capabilities: []string{"blob"}},
+				"node2": {Version: "0.5.0"},
+				"node3": {Version: "unknown", Capabilities: []string{"blob"}},
+				"node5": {Version: "0.1-alpha", Capabilities: []string{"blob"}},
+			}
+			fetched int
+			g       = newFeatureGate("self")
+		)
+		g.fetch = func(nodeID proto.NodeID) (*proto.BuildInfo, error) {
+			fetched++
+			if b, ok := builds[nodeID]; ok {
+				return b, nil
+			}
+			return nil, errors.New("unreachable")
+		}
+
+		ready, minVersion, missing, err := g.check(FeatureBlob, []proto.NodeID{"node1", "node3"})
+		So(err, ShouldBeNil)
+		So(ready, ShouldBeTrue)
+		So(missing, ShouldBeEmpty)
+		So(minVersion, ShouldEqual, "unknown")
+
+		ready, minVersion, missing, err = g.check(FeatureBlob, []proto.NodeID{"node1", "node2", "node4"})
+		So(err, ShouldBeNil)
+		So(ready, ShouldBeFalse)
+		So(minVersion, ShouldEqual, "0.5.0")
+		So(missing, ShouldResemble, []proto.NodeID{"node2", "node4"})
+
+		// the blob storage is gated by capability only
+		ready, minVersion, missing, err = g.check(FeatureBlob, []proto.NodeID{"node1", "node5"})
+		So(err, ShouldBeNil)
+		So(ready, ShouldBeTrue)
+		So(missing, ShouldBeEmpty)
+		So(minVersion, ShouldEqual, "0.1-alpha")
+
+		// cached build info should be reused
+		So(fetched, ShouldEqual, 6)
+		_, _, _, err = g.check(FeatureBlob, []proto.NodeID{"node1", "node2"})
+		So(err, ShouldBeNil)
+		So(fetched, ShouldEqual, 6)
+
+		_, _, _, err = g.check(Feature("unknown"), nil)
+		So(errors.Cause(err), ShouldEqual, ErrUnknownFeature)
+	})
+}
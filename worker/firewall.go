@@ -0,0 +1,277 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/types"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+// firewallRule defines a statement construct blocked by the sql firewall.
+type firewallRule struct {
+	Name string
+	// Overridable indicates whether the database owner could allow the construct, constructs
+	// escaping the per-database sandbox or corrupting the database are never overridable.
+	Overridable bool
+	match       func(statement string) bool
+}
+
+func matchRegexp(expr string) func(string) bool {
+	return regexp.MustCompile(expr).MatchString
+}
+
+// matchPragmaWrite matches pragma assignments and pragma function calls except the read-only
+// schema inspection ones.
+func matchPragmaWrite(statement string) bool {
+	m := pragmaRe.FindStringSubmatch(statement)
+	if m == nil {
+		return false
+	}
+	if m[2] == "=" {
+		return true
+	}
+	name := m[1]
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	return !readOnlyPragmas[strings.Trim(name, `"`)]
+}
+
+// sqlTokens splits the normalized statement into tokens, quoted identifiers are unquoted.
+func sqlTokens(statement string) (tokens []string) {
+	for _, t := range sqlTokenRe.FindAllString(statement, -1) {
+		if len(t) >= 2 && (t[0] == '"' || t[0] == '\x60') {
+			t = strings.Replace(t[1:len(t)-1], t[:1]+t[:1], t[:1], -1)
+		} else if len(t) >= 2 && t[0] == '[' {
+			t = t[1 : len(t)-1]
+		}
+		tokens = append(tokens, t)
+	}
+	return
+}
+
+// qualifiedName returns the object name at the token position, skipping the schema qualifier.
+func qualifiedName(tokens []string, i int) string {
+	if i+2 < len(tokens) && tokens[i+1] == "." {
+		i += 2
+	}
+	if i < len(tokens) {
+		return tokens[i]
+	}
+	return ""
+}
+
+// writeTargets returns the tables written by the statement, including the statements prefixed
+// by common table expressions, and the objects created, dropped or altered by the statement.
+func writeTargets(tokens []string) (targets []string) {
+	var skip = map[string]bool{
+		"temp": true, "temporary": true, "unique": true, "virtual": true,
+		"if": true, "not": true, "exists": true,
+	}
+	for i, t := range tokens {
+		var next = i + 1
+		switch t {
+		case "into":
+			// INSERT/REPLACE INTO t
+		case "update":
+			// UPDATE OR ROLLBACK t
+			if next+1 < len(tokens) && tokens[next] == "or" {
+				next += 2
+			}
+		case "from":
+			// DELETE FROM t, but not SELECT ... FROM t
+			if i == 0 || tokens[i-1] != "delete" {
+				continue
+			}
+		case "table", "index", "view", "trigger":
+			// CREATE/DROP/ALTER TABLE t
+			if i == 0 {
+				continue
+			}
+			var verb = i - 1
+			for verb > 0 && skip[tokens[verb]] {
+				verb--
+			}
+			if tokens[verb] != "create" && tokens[verb] != "drop" && tokens[verb] != "alter" {
+				continue
+			}
+			for next < len(tokens) && skip[tokens[next]] {
+				next++
+			}
+		case "on":
+			// CREATE INDEX i ON t, CREATE TRIGGER tr AFTER INSERT ON t
+			if len(tokens) == 0 || tokens[0] != "create" {
+				continue
+			}
+		default:
+			continue
+		}
+		targets = append(targets, qualifiedName(tokens, next))
+	}
+	return
+}
+
+// matchSchemaWrite matches statements writing sqlite internal tables.
+func matchSchemaWrite(statement string) bool {
+	for _, t := range writeTargets(sqlTokens(statement)) {
+		if internalTableRe.MatchString(t) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	firewallRules = []*firewallRule{
+		{Name: "attach", match: matchRegexp(`^\s*(attach|detach)\b`)},
+		{Name: "load-extension", match: matchRegexp(`\bload_extension\s*\(`)},
+		{Name: "schema-write", match: matchSchemaWrite},
+		{Name: "pragma-write", match: matchPragmaWrite},
+		{Name: "vacuum", match: matchRegexp(`^\s*vacuum\b`)},
+	}
+
+	internalTableRe = regexp.MustCompile(`^sqlite_(master|schema|temp_master|temp_schema|sequence|stat\d)$`)
+	sqlTokenRe      = regexp.MustCompile(`"(?:[^"]|"")*"|\x60(?:[^\x60]|\x60\x60)*\x60|\[[^\]]*\]|''|[\w$]+|\S`)
+
+	pragmaRe        = regexp.MustCompile(`^\s*pragma\s+([\w."]+)\s*(=|\()`)
+	readOnlyPragmas = map[string]bool{
+		"table_info":        true,
+		"table_xinfo":       true,
+		"index_info":        true,
+		"index_xinfo":       true,
+		"index_list":        true,
+		"foreign_key_list":  true,
+		"foreign_key_check": true,
+		"integrity_check":   true,
+		"quick_check":       true,
+	}
+
+	// single-quoted collation names are stripped as string literals, they are only allowed if
+	// all the vetted collations are allowed
+	collateLiteralRe = regexp.MustCompile(`\bcollate\s*''`)
+
+	sqlCommentRe = regexp.MustCompile(`(?s)--[^\n]*|/\*.*?\*/`)
+	sqlStringRe  = regexp.MustCompile(`'(?:[^']|'')*'`)
+)
+
+func init() {
+	firewallRules = append(firewallRules, collationRules()...)
+}
+
+// collationRules returns the rules of the vetted custom collations, which are registered on all
+// the replicas but only usable once the database owner allows them, e.g. collation-unicode_ci.
+func collationRules() (rules []*firewallRule) {
+	for _, name := range xs.Collations() {
+		re := regexp.MustCompile(`\bcollate\s*["\x60\[]?` + regexp.QuoteMeta(name) + `\b`)
+		rules = append(rules, &firewallRule{
+			Name:        "collation-" + name,
+			Overridable: true,
+			match: func(statement string) bool {
+				return re.MatchString(statement) || collateLiteralRe.MatchString(statement)
+			},
+		})
+	}
+	return
+}
+
+// normalizeStatements strips comments and string literals from the query and splits it into
+// lower-cased statements.
+func normalizeStatements(query string) (statements []string) {
+	query = sqlStringRe.ReplaceAllString(query, "''")
+	query = sqlCommentRe.ReplaceAllString(query, " ")
+	for _, s := range strings.Split(strings.ToLower(query), ";") {
+		if s = strings.TrimSpace(s); s != "" {
+			statements = append(statements, s)
+		}
+	}
+	return
+}
+
+// sqlFirewall blocks dangerous statement constructs which could break replication determinism or
+// escape the per-database sandbox.
+type sqlFirewall struct {
+	enabled map[string]*firewallRule
+	// overrides loads the rules allowed by the database owner from the replicated state
+	overrides func() ([]string, error)
+}
+
+// newSQLFirewall returns a firewall with the named rules enabled, all rules are enabled if the
+// list is empty. Owner overrides are loaded with the overrides function when required.
+func newSQLFirewall(rules []string, overrides func() ([]string, error)) (f *sqlFirewall) {
+	f = &sqlFirewall{
+		enabled:   make(map[string]*firewallRule),
+		overrides: overrides,
+	}
+	for _, r := range firewallRules {
+		if len(rules) == 0 {
+			f.enabled[r.Name] = r
+			continue
+		}
+		for _, name := range rules {
+			if name == r.Name {
+				f.enabled[r.Name] = r
+			}
+		}
+	}
+	return
+}
+
+// check returns ErrStatementBlocked if any query contains blocked constructs.
+func (f *sqlFirewall) check(queries []types.Query) (err error) {
+	var allowed map[string]bool
+	for _, q := range queries {
+		for _, s := range normalizeStatements(q.Pattern) {
+			for _, r := range f.enabled {
+				if !r.match(s) {
+					continue
+				}
+				if r.Overridable {
+					if allowed == nil {
+						if allowed, err = f.loadOverrides(); err != nil {
+							return
+						}
+					}
+					if allowed[r.Name] {
+						continue
+					}
+				}
+				return errors.Wrapf(ErrStatementBlocked, "rule: %s, query: %s", r.Name, q.Pattern)
+			}
+		}
+	}
+	return
+}
+
+func (f *sqlFirewall) loadOverrides() (allowed map[string]bool, err error) {
+	var overrides []string
+	if f.overrides != nil {
+		if overrides, err = f.overrides(); err != nil {
+			err = errors.Wrap(err, "load firewall overrides failed")
+			return
+		}
+	}
+	allowed = make(map[string]bool, len(overrides))
+	for _, o := range overrides {
+		allowed[o] = true
+	}
+	return
+}
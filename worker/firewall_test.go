@@ -0,0 +1,80 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestSQLFirewall(t *testing.T) {
+	Convey("test sql firewall", t, func() {
+		var (
+			overrides []string
+			f         = newSQLFirewall(nil, func() ([]string, error) { return overrides, nil })
+		)
+		var check = func(patterns ...string) error {
+			var queries []types.Query
+			for _, p := range patterns {
+				queries = append(queries, types.Query{Pattern: p})
+			}
+			return errors.Cause(f.check(queries))
+		}
+
+		So(check("SELECT * FROM t1 WHERE v = 'attach database'"), ShouldBeNil)
+		So(check("PRAGMA table_info(t1)"), ShouldBeNil)
+		So(check("PRAGMA user_version"), ShouldBeNil)
+		So(check("SELECT * FROM sqlite_master"), ShouldBeNil)
+		So(check("INSERT INTO t1 SELECT name FROM sqlite_master"), ShouldBeNil)
+		So(check("/* x */ ATTACH DATABASE '/tmp/x.db' AS x"), ShouldEqual, ErrStatementBlocked)
+		So(check("SELECT 1; UPDATE sqlite_master SET sql = ''"), ShouldEqual, ErrStatementBlocked)
+		So(check("WITH x AS (SELECT 1) DELETE FROM main.sqlite_master"), ShouldEqual, ErrStatementBlocked)
+		So(check(`UPDATE OR REPLACE "sqlite_sequence" SET seq = 0`), ShouldEqual, ErrStatementBlocked)
+		So(check("CREATE TRIGGER tr AFTER INSERT ON t1 BEGIN DELETE FROM [sqlite_stat1]; END"),
+			ShouldEqual, ErrStatementBlocked)
+		So(check("SELECT load_extension('x')"), ShouldEqual, ErrStatementBlocked)
+		So(check("PRAGMA writable_schema = 1"), ShouldEqual, ErrStatementBlocked)
+		So(check("VACUUM INTO '/tmp/x.db'"), ShouldEqual, ErrStatementBlocked)
+
+		Convey("owner overrides should be limited to overridable rules", func() {
+			overrides = []string{"attach", "pragma-write", "vacuum"}
+			So(check("ATTACH DATABASE 'x' AS x"), ShouldEqual, ErrStatementBlocked)
+			So(check("PRAGMA writable_schema = 1"), ShouldEqual, ErrStatementBlocked)
+			So(check("VACUUM INTO '/tmp/x.db'"), ShouldEqual, ErrStatementBlocked)
+		})
+
+		Convey("rules should be selected by config", func() {
+			f = newSQLFirewall([]string{"pragma-write", "vacuum"}, nil)
+			So(check("VACUUM"), ShouldEqual, ErrStatementBlocked)
+			So(check("ATTACH DATABASE 'x' AS x"), ShouldBeNil)
+		})
+
+		Convey("vetted collations should be usable once allowed by owner", func() {
+			So(check("SELECT * FROM t1 ORDER BY v COLLATE NOCASE"), ShouldBeNil)
+			So(check("CREATE TABLE t2 (v TEXT COLLATE unicode_ci)"), ShouldEqual, ErrStatementBlocked)
+			So(check(`SELECT * FROM t1 ORDER BY v COLLATE "natural"`), ShouldEqual, ErrStatementBlocked)
+			overrides = []string{"collation-unicode_ci"}
+			So(check("CREATE TABLE t2 (v TEXT COLLATE unicode_ci)"), ShouldBeNil)
+			So(check(`SELECT * FROM t1 ORDER BY v COLLATE "natural"`), ShouldEqual, ErrStatementBlocked)
+			So(check("SELECT * FROM t1 ORDER BY v COLLATE 'unicode_ci'"), ShouldEqual, ErrStatementBlocked)
+		})
+	})
+}
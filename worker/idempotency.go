@@ -0,0 +1,133 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package worker
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/SQLess/SQLess/types"
+	x "github.com/SQLess/SQLess/xenomint"
+)
+
+const (
+	mwMinerIdempotentReplay = "service:miner:idempotent:replay"
+)
+
+var (
+	idempotentReplay = new(expvar.Int)
+)
+
+func init() {
+	expvar.Publish(mwMinerIdempotentReplay, idempotentReplay)
+}
+
+// idempotentWrite is a write query identified by its idempotency key, done is closed once the
+// query finishes and resp is set if it succeeded.
+type idempotentWrite struct {
+	done    chan struct{}
+	resp    *types.Response
+	expires time.Time
+}
+
+// idempotencyCache coalesces the write queries retried by the clients on this node, a retry waits
+// for the running query of the same key and shares its response instead of proposing the write
+// again. The cache is only a shortcut, the keys are recorded in the replicated state with the
+// writes, so the retries are deduplicated by every replica even if the cache forgets the failed
+// writes or the leader changes, see xenomint/idempotency.go.
+type idempotencyCache struct {
+	sync.Mutex
+	writes    map[string]*idempotentWrite
+	lastSweep time.Time
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{
+		writes:    make(map[string]*idempotentWrite),
+		lastSweep: time.Now(),
+	}
+}
+
+// do executes the write request with exec once per idempotency key of the request node.
+func (c *idempotencyCache) do(
+	request *types.Request, exec func(*types.Request) (*types.Response, error),
+) (response *types.Response, err error) {
+	var key = string(request.Header.NodeID) + "/" + request.IdempotencyKey
+	for {
+		w, owner := c.begin(key)
+		if owner {
+			response, err = exec(request)
+			c.finish(key, w, response, err)
+			return
+		}
+		select {
+		case <-w.done:
+		case <-request.GetContext().Done():
+			err = request.GetContext().Err()
+			return
+		}
+		if w.resp != nil {
+			idempotentReplay.Add(1)
+			response = w.resp
+			return
+		}
+		// the running query failed without applying, execute the retry instead
+	}
+}
+
+// begin returns the write of the key, the caller owns the write and has to finish it if it is
+// newly created.
+func (c *idempotencyCache) begin(key string) (w *idempotentWrite, owner bool) {
+	c.Lock()
+	defer c.Unlock()
+	var now = time.Now()
+	if now.Sub(c.lastSweep) > x.IdempotencyTTL/10 {
+		for k, v := range c.writes {
+			if v.expired(now) {
+				delete(c.writes, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	if w = c.writes[key]; w != nil && !w.expired(now) {
+		return
+	}
+	w = &idempotentWrite{done: make(chan struct{})}
+	c.writes[key] = w
+	owner = true
+	return
+}
+
+// finish records the result of the write, the failed write is forgotten and its retry is proposed
+// again, which is answered by the recorded result if the write was committed in fact.
+func (c *idempotencyCache) finish(key string, w *idempotentWrite, resp *types.Response, err error) {
+	c.Lock()
+	defer c.Unlock()
+	if err != nil {
+		if c.writes[key] == w {
+			delete(c.writes, key)
+		}
+	} else {
+		w.resp = resp
+		w.expires = time.Now().Add(x.IdempotencyTTL)
+	}
+	close(w.done)
+}
+
+func (w *idempotentWrite) expired(now time.Time) bool {
+	return !w.expires.IsZero() && now.After(w.expires)
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package worker
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestIdempotencyCache(t *testing.T) {
+	Convey("test idempotency cache", t, func() {
+		var (
+			c       = newIdempotencyCache()
+			applied int32
+			release = make(chan struct{})
+			newReq  = func(node proto.NodeID, key string) *types.Request {
+				req := &types.Request{IdempotencyKey: key}
+				req.Header.NodeID = node
+				req.Header.QueryType = types.WriteQuery
+				return req
+			}
+			exec = func(req *types.Request) (*types.Response, error) {
+				<-release
+				atomic.AddInt32(&applied, 1)
+				return &types.Response{}, nil
+			}
+		)
+		Convey("concurrent retries should be applied once", func() {
+			var (
+				wg    sync.WaitGroup
+				resps = make([]*types.Response, 4)
+			)
+			for i := range resps {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					resps[i], _ = c.do(newReq("node", "k1"), exec)
+				}(i)
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+			wg.Wait()
+			So(atomic.LoadInt32(&applied), ShouldEqual, 1)
+			for _, resp := range resps {
+				So(resp, ShouldNotBeNil)
+				So(resp, ShouldEqual, resps[0])
+			}
+
+			resp, err := c.do(newReq("node", "k1"), exec)
+			So(err, ShouldBeNil)
+			So(resp, ShouldEqual, resps[0])
+			So(atomic.LoadInt32(&applied), ShouldEqual, 1)
+
+			_, err = c.do(newReq("other", "k1"), exec)
+			So(err, ShouldBeNil)
+			So(atomic.LoadInt32(&applied), ShouldEqual, 2)
+		})
+		Convey("failed write should be applied by the retry", func() {
+			close(release)
+			var failure = errors.New("failed")
+			_, err := c.do(newReq("node", "k2"), func(*types.Request) (*types.Response, error) {
+				return nil, failure
+			})
+			So(err, ShouldEqual, failure)
+			resp, err := c.do(newReq("node", "k2"), exec)
+			So(err, ShouldBeNil)
+			So(resp, ShouldNotBeNil)
+			So(atomic.LoadInt32(&applied), ShouldEqual, 1)
+		})
+		Convey("expired response should not be replayed", func() {
+			close(release)
+			_, err := c.do(newReq("node", "k3"), exec)
+			So(err, ShouldBeNil)
+			c.writes["node/k3"].expires = time.Now().Add(-time.Second)
+			_, err = c.do(newReq("node", "k3"), exec)
+			So(err, ShouldBeNil)
+			So(atomic.LoadInt32(&applied), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/types"
+	x "github.com/SQLess/SQLess/xenomint"
+)
+
+// IOLimit defines the write rate limits of a database, the limits are disabled if not positive.
+type IOLimit struct {
+	WriteIOPS  float64 // write operations per second, each query and each row it changes counts
+	WriteBytes float64 // written bytes per second, the growth of the database or the payload
+	// Burst is the duration of the traffic which could be absorbed at once, one second if not
+	// positive.
+	Burst time.Duration
+}
+
+// ioBucket is a token bucket which allows reservations beyond the available tokens, so that the
+// waiting writes are scheduled in order.
+type ioBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newIOBucket(rate float64, burst time.Duration) ioBucket {
+	return ioBucket{
+		rate:   rate,
+		burst:  rate * burst.Seconds(),
+		tokens: rate * burst.Seconds(),
+	}
+}
+
+// reserve takes n tokens and returns the wait before they are available.
+func (b *ioBucket) reserve(now time.Time, n float64) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+func (b *ioBucket) cancel(n float64) {
+	if b.rate > 0 {
+		if b.tokens += n; b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+}
+
+// ioThrottle schedules the writes of a database within its I/O limit. It's applied on the leader
+// before the write is replicated, so the followers are throttled alike without stalling the
+// replication of other databases.
+//
+// A write reserves its estimated i/o before it's executed, and is charged the i/o measured by the
+// storage beyond the estimate after, the debt delays the following writes.
+type ioThrottle struct {
+	sync.Mutex
+	ops   ioBucket
+	bytes ioBucket
+}
+
+func newIOThrottle(limit IOLimit) *ioThrottle {
+	if limit.WriteIOPS <= 0 && limit.WriteBytes <= 0 {
+		return nil
+	}
+	if limit.Burst <= 0 {
+		limit.Burst = time.Second
+	}
+	return &ioThrottle{
+		ops:   newIOBucket(limit.WriteIOPS, limit.Burst),
+		bytes: newIOBucket(limit.WriteBytes, limit.Burst),
+	}
+}
+
+// wait blocks until the write is allowed by the limit. The write is refused at once if it could
+// not be scheduled before the context deadline.
+func (t *ioThrottle) wait(ctx context.Context, ops, bytes int) (err error) {
+	if t == nil {
+		return
+	}
+	var now = time.Now()
+	t.Lock()
+	wait := t.ops.reserve(now, float64(ops))
+	if w := t.bytes.reserve(now, float64(bytes)); w > wait {
+		wait = w
+	}
+	if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+		t.ops.cancel(float64(ops))
+		t.bytes.cancel(float64(bytes))
+		t.Unlock()
+		return errors.Wrapf(ErrIOThrottled, "write delayed by %s", wait)
+	}
+	t.Unlock()
+	if wait <= 0 {
+		return
+	}
+	var timer = time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		// the write is given up, return its reservation to the following writes
+		t.Lock()
+		t.ops.cancel(float64(ops))
+		t.bytes.cancel(float64(bytes))
+		t.Unlock()
+		err = errors.Wrapf(ErrIOThrottled, "write delayed by %s: %v", wait, ctx.Err())
+	}
+	return
+}
+
+// settle charges the i/o measured by the storage beyond the reserved ops and bytes of a write.
+func (t *ioThrottle) settle(ops, bytes int, tracker *x.QueryTracker) {
+	if t == nil || tracker == nil {
+		return
+	}
+	var now = time.Now()
+	t.Lock()
+	defer t.Unlock()
+	if n := float64(tracker.IOOps) - float64(ops); n > 0 {
+		t.ops.reserve(now, n)
+	}
+	if n := float64(tracker.IOBytes) - float64(bytes); n > 0 {
+		t.bytes.reserve(now, n)
+	}
+}
+
+// estimateWriteBytes estimates the payload bytes written by the queries, which are reserved before
+// the write is executed.
+func estimateWriteBytes(queries []types.Query) (n int) {
+	for _, q := range queries {
+		n += len(q.Pattern)
+		for _, arg := range q.Args {
+			switch v := arg.Value.(type) {
+			case string:
+				n += len(v)
+			case []byte:
+				n += len(v)
+			default:
+				n += 8
+			}
+		}
+	}
+	return
+}
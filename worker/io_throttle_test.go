@@ -0,0 +1,97 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+	x "github.com/SQLess/SQLess/xenomint"
+)
+
+func TestIOThrottle(t *testing.T) {
+	Convey("test database write i/o throttling", t, func() {
+		Convey("unlimited throttle should never block", func() {
+			var th = newIOThrottle(IOLimit{})
+			So(th, ShouldBeNil)
+			So(th.wait(context.Background(), 1000, 1<<30), ShouldBeNil)
+		})
+		Convey("bucket should schedule reservations beyond the burst in order", func() {
+			var (
+				b   = newIOBucket(10, time.Second)
+				now = time.Now()
+			)
+			So(b.reserve(now, 10), ShouldEqual, time.Duration(0))
+			So(b.reserve(now, 5), ShouldEqual, 500*time.Millisecond)
+			So(b.reserve(now, 5), ShouldEqual, time.Second)
+			So(b.reserve(now.Add(time.Second), 0), ShouldEqual, time.Duration(0))
+		})
+		Convey("writes exceeding the deadline should be refused at once", func() {
+			var th = newIOThrottle(IOLimit{WriteBytes: 1000})
+			So(th.wait(context.Background(), 1, 1000), ShouldBeNil)
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			var start = time.Now()
+			err := th.wait(ctx, 1, 1000)
+			So(errors.Cause(err), ShouldEqual, ErrIOThrottled)
+			So(time.Since(start), ShouldBeLessThan, 100*time.Millisecond)
+			// the refused write takes no tokens
+			So(th.wait(context.Background(), 1, 50), ShouldBeNil)
+		})
+		Convey("canceled writes should return their reservations", func() {
+			var th = newIOThrottle(IOLimit{WriteBytes: 1000})
+			So(th.wait(context.Background(), 1, 1000), ShouldBeNil)
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				cancel()
+			}()
+			err := th.wait(ctx, 1, 500)
+			So(errors.Cause(err), ShouldEqual, ErrIOThrottled)
+			th.Lock()
+			var wait = th.bytes.reserve(time.Now(), 0)
+			th.Unlock()
+			So(wait, ShouldBeLessThan, 10*time.Millisecond)
+		})
+		Convey("the i/o measured beyond the reservation should delay the following writes", func() {
+			var th = newIOThrottle(IOLimit{WriteIOPS: 100, WriteBytes: 1000})
+			So(th.wait(context.Background(), 1, 10), ShouldBeNil)
+			// e.g. INSERT INTO t SELECT randomblob(1000) FROM t
+			th.settle(1, 10, &x.QueryTracker{IOOps: 1, IOBytes: 1510})
+			th.Lock()
+			var wait = th.bytes.reserve(time.Now(), 0)
+			th.Unlock()
+			So(wait, ShouldBeGreaterThan, 400*time.Millisecond)
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			So(errors.Cause(th.wait(ctx, 1, 1)), ShouldEqual, ErrIOThrottled)
+			// the estimate beyond the measured i/o is not refunded
+			th.settle(1, 1<<20, &x.QueryTracker{IOOps: 1})
+			th.settle(1, 1, nil)
+		})
+		Convey("write bytes should be estimated from the queries", func() {
+			So(estimateWriteBytes([]types.Query{{
+				Pattern: "INSERT INTO t VALUES (?, ?)",
+				Args:    []types.NamedArg{{Value: "abc"}, {Value: int64(1)}},
+			}}), ShouldEqual, 27+3+8)
+		})
+	})
+}
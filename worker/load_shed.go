@@ -0,0 +1,126 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package worker
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+const (
+	// DefaultShedRetryAfter defines the default retry interval suggested to the shed requests.
+	DefaultShedRetryAfter = 200 * time.Millisecond
+
+	mwMinerLoadInflight = "service:miner:load:inflight"
+	mwMinerLoadShed     = "service:miner:load:shed"
+)
+
+var (
+	loadInflight = new(expvar.Int)
+	loadShed     = new(expvar.Map).Init()
+)
+
+func init() {
+	expvar.Publish(mwMinerLoadInflight, loadInflight)
+	expvar.Publish(mwMinerLoadShed, loadShed)
+}
+
+// Priority defines the priority class of the requests served by the miner, the requests of lower
+// priority are shed first under overload.
+type Priority int
+
+const (
+	// PriorityRead is the priority of the read queries sent by the granted users.
+	PriorityRead Priority = iota
+	// PriorityWrite is the priority of the write queries.
+	PriorityWrite
+	// PrioritySystem is the priority of the replication between miners, which is never shed.
+	PrioritySystem
+)
+
+// String implements fmt.Stringer for logging purpose.
+func (p Priority) String() string {
+	switch p {
+	case PriorityRead:
+		return "read"
+	case PriorityWrite:
+		return "write"
+	case PrioritySystem:
+		return "system"
+	default:
+		return "unknown"
+	}
+}
+
+// requestPriority returns the priority class of the query request.
+func requestPriority(req *types.Request) Priority {
+	if req.Header.QueryType == types.WriteQuery {
+		return PriorityWrite
+	}
+	return PriorityRead
+}
+
+// shedShares are the shares of the in-flight limit each priority class may occupy, the system
+// requests are always admitted.
+var shedShares = [...]float64{
+	PriorityRead:  0.6,
+	PriorityWrite: 0.9,
+}
+
+// loadShedder bounds the in-flight requests of the miner. Requests are admitted by priority: the
+// reads are refused first once the in-flight requests exceed their share of the limit, then the
+// writes, so that the replication is never stalled by a tenant hammering reads.
+type loadShedder struct {
+	limit      int64
+	retryAfter time.Duration
+	inflight   int64
+}
+
+func newLoadShedder(limit int64, retryAfter time.Duration) *loadShedder {
+	if retryAfter <= 0 {
+		retryAfter = DefaultShedRetryAfter
+	}
+	return &loadShedder{
+		limit:      limit,
+		retryAfter: retryAfter,
+	}
+}
+
+// admit accounts the request as in-flight, the returned function must be called once the request
+// is finished. The shedder is disabled if it's nil or the limit is not positive.
+func (s *loadShedder) admit(p Priority) (release func(), err error) {
+	if s == nil || s.limit <= 0 {
+		return func() {}, nil
+	}
+	inflight := atomic.AddInt64(&s.inflight, 1)
+	if p < PrioritySystem && float64(inflight) > float64(s.limit)*shedShares[p] {
+		atomic.AddInt64(&s.inflight, -1)
+		loadShed.Add(p.String(), 1)
+		err = errors.Wrapf(ErrOverloaded, "%s request shed at %d in-flight, retry after %s",
+			p, inflight-1, s.retryAfter)
+		return
+	}
+	loadInflight.Add(1)
+	return func() {
+		atomic.AddInt64(&s.inflight, -1)
+		loadInflight.Add(-1)
+	}, nil
+}
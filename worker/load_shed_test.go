@@ -0,0 +1,74 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package worker
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLoadShedder(t *testing.T) {
+	Convey("test load shedding by priority", t, func() {
+		Convey("nil or zero limit shedder should admit all requests", func() {
+			var s *loadShedder
+			release, err := s.admit(PriorityRead)
+			So(err, ShouldBeNil)
+			release()
+			release, err = newLoadShedder(0, 0).admit(PriorityRead)
+			So(err, ShouldBeNil)
+			release()
+		})
+		Convey("reads should be shed before writes and system requests", func() {
+			var (
+				s        = newLoadShedder(10, 0)
+				releases []func()
+			)
+			for i := 0; i < 6; i++ {
+				release, err := s.admit(PriorityRead)
+				So(err, ShouldBeNil)
+				releases = append(releases, release)
+			}
+			_, err := s.admit(PriorityRead)
+			So(errors.Cause(err), ShouldEqual, ErrOverloaded)
+			So(err.Error(), ShouldContainSubstring, "retry after 200ms")
+
+			for i := 0; i < 3; i++ {
+				release, err := s.admit(PriorityWrite)
+				So(err, ShouldBeNil)
+				releases = append(releases, release)
+			}
+			_, err = s.admit(PriorityWrite)
+			So(errors.Cause(err), ShouldEqual, ErrOverloaded)
+
+			for i := 0; i < 5; i++ {
+				release, err := s.admit(PrioritySystem)
+				So(err, ShouldBeNil)
+				releases = append(releases, release)
+			}
+			So(s.inflight, ShouldEqual, 14)
+
+			for _, release := range releases {
+				release()
+			}
+			So(s.inflight, ShouldEqual, 0)
+			release, err := s.admit(PriorityRead)
+			So(err, ShouldBeNil)
+			release()
+		})
+	})
+}
@@ -0,0 +1,56 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/types"
+	x "github.com/SQLess/SQLess/xenomint"
+)
+
+const (
+	// maintenanceReasonArrears is the reason of maintenance mode if the owner is in arrears.
+	maintenanceReasonArrears = "owner budget exhausted"
+)
+
+// checkWritable returns ErrReadOnlyMaintenance if the database is in maintenance mode, either
+// switched by the owner in the replicated database state, see xenomint.MaintenanceTable, or
+// automatically when the owner's budget is exhausted. The writes which only switch the
+// maintenance mode are accepted, so that the owner could leave the mode.
+func (dbms *DBMS) checkWritable(db *Database, queries []types.Query) (err error) {
+	if profile, ok := dbms.busService.RequestSQLProfile(db.dbID); ok {
+		if permStat, ok := dbms.busService.RequestPermStat(db.dbID, profile.Owner); ok &&
+			permStat.Status == types.Arrears {
+			return errors.Wrapf(ErrReadOnlyMaintenance, "reason: %s", maintenanceReasonArrears)
+		}
+	}
+	if db.maintenance == nil || writesOnly(queries, x.MaintenanceTable) {
+		return
+	}
+	var (
+		enabled bool
+		reason  string
+	)
+	if enabled, reason, err = db.maintenance(); err != nil {
+		return errors.Wrap(err, "load maintenance mode failed")
+	}
+	if enabled {
+		return errors.Wrapf(ErrReadOnlyMaintenance, "reason: %s", reason)
+	}
+	return
+}
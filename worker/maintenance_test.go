@@ -0,0 +1,84 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	Convey("Given a database switched by its owner in the replicated state", t, func() {
+		var (
+			dbID    = proto.DatabaseID("db")
+			owner   = proto.AccountAddress{0x1}
+			enabled = true
+			bs      = &BusService{
+				sqlChainProfiles: map[proto.DatabaseID]*types.SQLChainProfile{
+					dbID: {ID: dbID, Owner: owner},
+				},
+				sqlChainState: map[proto.DatabaseID]map[proto.AccountAddress]*types.PermStat{
+					dbID: {owner: {Permission: types.UserPermissionFromRole(types.Admin), Status: types.Normal}},
+				},
+			}
+			dbms = &DBMS{busService: bs}
+			db   = &Database{
+				dbID: dbID,
+				maintenance: func() (bool, string, error) {
+					return enabled, "schema migration", nil
+				},
+			}
+			queries = func(patterns ...string) (qs []types.Query) {
+				for _, p := range patterns {
+					qs = append(qs, types.Query{Pattern: p})
+				}
+				return
+			}
+		)
+		Convey("The writes should be rejected while the mode is on", func() {
+			err := dbms.checkWritable(db, queries(`INSERT INTO t1 VALUES (1)`))
+			So(errors.Cause(err), ShouldEqual, ErrReadOnlyMaintenance)
+			So(err.Error(), ShouldContainSubstring, "schema migration")
+			// a write sneaking in with the switch is still rejected
+			err = dbms.checkWritable(db, queries(
+				`DELETE FROM __sqless_maintenance`, `INSERT INTO t1 VALUES (1)`))
+			So(errors.Cause(err), ShouldEqual, ErrReadOnlyMaintenance)
+
+			enabled = false
+			So(dbms.checkWritable(db, queries(`INSERT INTO t1 VALUES (1)`)), ShouldBeNil)
+		})
+		Convey("The writes which only switch the mode should be accepted", func() {
+			So(dbms.checkWritable(db, queries(
+				`CREATE TABLE IF NOT EXISTS "__sqless_maintenance" ("enabled" BOOLEAN, "reason" TEXT, "since" TEXT);`+
+					`DELETE FROM "__sqless_maintenance";`+
+					`INSERT INTO "__sqless_maintenance" VALUES (0, '', '')`,
+			)), ShouldBeNil)
+		})
+		Convey("The database should be read-only if the owner is in arrears", func() {
+			enabled = false
+			bs.sqlChainState[dbID][owner].Status = types.Arrears
+			err := dbms.checkWritable(db, queries(`DELETE FROM __sqless_maintenance`))
+			So(errors.Cause(err), ShouldEqual, ErrReadOnlyMaintenance)
+			So(err.Error(), ShouldContainSubstring, maintenanceReasonArrears)
+		})
+	})
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// DefaultMaxConcurrentDryRuns defines the default concurrent migration dry-run limit of the
+	// miner.
+	DefaultMaxConcurrentDryRuns = 2
+	// DefaultMigrationDryRunTimeout defines the default time limit of a migration dry-run.
+	DefaultMigrationDryRunTimeout = 5 * time.Minute
+)
+
+func newDryRunLimiter(limit int) chan struct{} {
+	if limit <= 0 {
+		limit = DefaultMaxConcurrentDryRuns
+	}
+	return make(chan struct{}, limit)
+}
+
+// acquireDryRun reserves a migration dry-run slot of the miner without waiting, the returned
+// release function must be called once the dry-run finishes.
+func (dbms *DBMS) acquireDryRun() (release func(), err error) {
+	select {
+	case dbms.dryRuns <- struct{}{}:
+		release = func() { <-dbms.dryRuns }
+	default:
+		err = errors.Wrapf(ErrTooManyDryRuns, "limit: %d", cap(dbms.dryRuns))
+	}
+	return
+}
+
+// MigrationDryRun estimates the execution time, table rewrites and token cost of the migration
+// queries by executing them on a shadow copy of the leader state. Only users with write
+// permission are allowed to dry-run a migration.
+func (dbms *DBMS) MigrationDryRun(
+	ctx context.Context, req *types.MigrationDryRunReq,
+) (resp *types.MigrationDryRunResp, err error) {
+	var (
+		addr proto.AccountAddress
+		db   *Database
+		ok   bool
+	)
+	if err = req.Header.Verify(); err != nil {
+		return
+	}
+	if gap := time.Since(req.Header.Timestamp); gap > dbms.cfg.MaxReqTimeGap ||
+		gap < -dbms.cfg.MaxReqTimeGap {
+		err = errors.Wrap(ErrInvalidRequest, "invalid request time")
+		return
+	}
+	if len(req.Header.Queries) == 0 {
+		err = errors.Wrap(ErrInvalidRequest, "empty migration")
+		return
+	}
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		return
+	}
+	profile, ok := dbms.busService.RequestSQLProfile(req.Header.DatabaseID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	if db, ok = dbms.getMeta(req.Header.DatabaseID); !ok {
+		err = ErrNotExists
+		return
+	}
+	if len(profile.Miners) == 0 || profile.Miners[0].NodeID != db.nodeID {
+		err = ErrNotLeader
+		return
+	}
+	if err = dbms.checkPermission(addr, req.Header.DatabaseID, types.WriteQuery, req.Header.Queries); err != nil {
+		return
+	}
+	if err = db.firewall.check(req.Header.Queries); err != nil {
+		return
+	}
+
+	var release func()
+	if release, err = dbms.acquireDryRun(); err != nil {
+		return
+	}
+	defer release()
+	var timeout = dbms.cfg.MigrationDryRunTimeout
+	if timeout <= 0 {
+		timeout = DefaultMigrationDryRunTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resp = &types.MigrationDryRunResp{GasPrice: profile.GasPrice}
+	if resp.BlockHash, resp.Height, resp.Estimates, err = db.dryRun(ctx, req.Header.Queries); err != nil {
+		return
+	}
+	for i := range resp.Estimates {
+		e := &resp.Estimates[i]
+		e.Cost = e.AffectedRows * profile.GasPrice
+		resp.Cost += e.Cost
+		resp.LockDuration += e.Duration
+	}
+	log.WithFields(log.Fields{
+		"db":       req.Header.DatabaseID,
+		"user":     addr.String(),
+		"queries":  len(req.Header.Queries),
+		"duration": resp.LockDuration,
+		"cost":     resp.Cost,
+	}).Info("migration dry-run finished")
+	return
+}
+
+// dryRun executes the queries on a fresh shadow copy of the database state.
+func (db *Database) dryRun(ctx context.Context, queries []types.Query) (
+	h hash.Hash, height int32, estimates []types.MigrationEstimate, err error,
+) {
+	return db.chain.DryRun(ctx, db.cfg.DataDir, queries)
+}
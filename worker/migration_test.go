@@ -0,0 +1,44 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAcquireDryRun(t *testing.T) {
+	Convey("Given a dbms limited to one concurrent dry-run", t, func() {
+		var dbms = &DBMS{dryRuns: newDryRunLimiter(1)}
+		release, err := dbms.acquireDryRun()
+		So(err, ShouldBeNil)
+
+		Convey("The next dry-run should be rejected until the slot is released", func() {
+			_, err = dbms.acquireDryRun()
+			So(errors.Cause(err), ShouldEqual, ErrTooManyDryRuns)
+			release()
+			release, err = dbms.acquireDryRun()
+			So(err, ShouldBeNil)
+			release()
+		})
+	})
+	Convey("The default limit should be used if it's not configured", t, func() {
+		So(cap(newDryRunLimiter(0)), ShouldEqual, DefaultMaxConcurrentDryRuns)
+	})
+}
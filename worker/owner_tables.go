@@ -0,0 +1,145 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"strings"
+
+	"github.com/SQLess/sqlparser"
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	x "github.com/SQLess/SQLess/xenomint"
+)
+
+// ownerTables are the name prefixes of the system objects only written by the database owner,
+// e.g. the materialized view definitions, the firewall overrides and the maintenance mode.
+var ownerTables = []string{
+	x.MaterializedViewsTable,
+	x.MaterializedViewObjectPrefix,
+	x.FirewallOverridesTable,
+	x.MaintenanceTable,
+}
+
+// reservedTables are the name prefixes of the system objects only written by the miners, e.g.
+// the idempotency keys.
+var reservedTables = []string{
+	x.IdempotencyTable,
+}
+
+// writtenTables returns the lower cased names of the tables written or altered by the query,
+// reading a table is not counted. ok is false if the parser does not fully understand the
+// query, e.g. triggers.
+func writtenTables(pattern string) (tables []string, ok bool) {
+	_, statements, err := sqlparser.ParseMultiple(sqlparser.NewStringTokenizer(pattern))
+	if err != nil {
+		return
+	}
+	var visit = func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if t, ok := node.(sqlparser.TableName); ok && !t.IsEmpty() {
+			tables = append(tables, strings.ToLower(t.Name.String()))
+		}
+		return true, nil
+	}
+	for _, stmt := range statements {
+		switch s := stmt.(type) {
+		case *sqlparser.Select, *sqlparser.Union, *sqlparser.ParenSelect:
+		case *sqlparser.Insert:
+			_ = sqlparser.Walk(visit, s.Table)
+		case *sqlparser.Update:
+			_ = sqlparser.Walk(visit, s.TableExprs)
+		case *sqlparser.Delete:
+			_ = sqlparser.Walk(visit, s.Targets, s.TableExprs)
+		case *sqlparser.DDL:
+			if s.Table.IsEmpty() && s.NewName.IsEmpty() {
+				return
+			}
+			_ = sqlparser.Walk(visit, s.Table, s.NewName)
+		default:
+			return
+		}
+	}
+	return tables, true
+}
+
+// touchesTable returns whether the query writes or alters a table whose name starts with prefix.
+// The statements the parser does not fully understand are matched by text to fail closed.
+func touchesTable(pattern string, prefix string) bool {
+	// sqlite only folds ascii letters of the identifiers, any reference contains the name
+	if !strings.Contains(strings.ToLower(pattern), prefix) {
+		return false
+	}
+	tables, ok := writtenTables(pattern)
+	if !ok {
+		return true
+	}
+	for _, t := range tables {
+		if strings.HasPrefix(t, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// writesOnly returns whether the queries write the table and nothing else.
+func writesOnly(queries []types.Query, table string) bool {
+	for _, q := range queries {
+		tables, ok := writtenTables(q.Pattern)
+		if !ok || len(tables) == 0 {
+			return false
+		}
+		for _, t := range tables {
+			if t != table {
+				return false
+			}
+		}
+	}
+	return len(queries) > 0
+}
+
+// checkOwnerTables ensures that only the database owner writes the owner system tables, and that
+// nobody writes the reserved system tables.
+func (dbms *DBMS) checkOwnerTables(
+	addr proto.AccountAddress, dbID proto.DatabaseID, queries []types.Query,
+) (err error) {
+	var touched string
+	for _, q := range queries {
+		for _, t := range reservedTables {
+			if touchesTable(q.Pattern, t) {
+				return errors.Wrapf(ErrPermissionDeny, "%s of database %s is read-only", t, dbID)
+			}
+		}
+		for _, t := range ownerTables {
+			if touched == "" && touchesTable(q.Pattern, t) {
+				touched = t
+			}
+		}
+	}
+	if touched == "" {
+		return
+	}
+	profile, ok := dbms.busService.RequestSQLProfile(dbID)
+	if !ok {
+		return ErrNotExists
+	}
+	if profile.Owner != addr {
+		return errors.Wrapf(ErrPermissionDeny,
+			"only owner could write %s of database %s", touched, dbID)
+	}
+	return
+}
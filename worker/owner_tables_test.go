@@ -0,0 +1,53 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	x "github.com/SQLess/SQLess/xenomint"
+)
+
+func TestTouchesTable(t *testing.T) {
+	Convey("Only the writes to the system tables should be matched", t, func() {
+		for _, c := range []struct {
+			query   string
+			touched bool
+		}{
+			{`INSERT INTO t1 SELECT * FROM __sqless_idempotency`, false},
+			{`INSERT INTO t1 VALUES ('__sqless_idempotency')`, false},
+			{`UPDATE t1 SET v=(SELECT COUNT(*) FROM __sqless_idempotency)`, false},
+			{`INSERT INTO __sqless_idempotency VALUES (1)`, true},
+			{`REPLACE INTO "__SQLESS_IDEMPOTENCY" VALUES (1)`, true},
+			{`UPDATE __sqless_idempotency SET v=1`, true},
+			{`DELETE FROM main.__sqless_idempotency`, true},
+			{`CREATE TABLE t3 (v INT);DELETE FROM __sqless_idempotency`, true},
+			{`CREATE INDEX i ON __sqless_idempotency (v)`, true},
+			{`ALTER TABLE t1 RENAME TO __sqless_idempotency`, true},
+			{`DROP INDEX __sqless_idempotency_expires`, true},
+			{`CREATE TRIGGER tr AFTER INSERT ON t1 BEGIN DELETE FROM __sqless_idempotency; END`, true},
+		} {
+			So(touchesTable(c.query, x.IdempotencyTable), ShouldEqual, c.touched)
+		}
+		So(touchesTable(`DROP TRIGGER "__sqless_matview_sums_0123_insert"`,
+			x.MaterializedViewObjectPrefix), ShouldBeTrue)
+		So(touchesTable(`INSERT INTO "__sqless_matviews" VALUES ('v', 'SELECT k FROM t GROUP BY k')`,
+			x.MaterializedViewsTable), ShouldBeTrue)
+	})
+}
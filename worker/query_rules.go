@@ -0,0 +1,150 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"strings"
+
+	"github.com/SQLess/sqlparser"
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/types"
+	x "github.com/SQLess/SQLess/xenomint"
+)
+
+// statementInfo defines the properties of a statement checked by query rules.
+type statementInfo struct {
+	kind     string
+	tables   []string
+	hasWhere bool
+}
+
+func parseStatements(pattern string) (infos []*statementInfo, err error) {
+	if x.IsAnalyzeStatement(pattern) {
+		return []*statementInfo{{kind: "ANALYZE"}}, nil
+	}
+	var statements []sqlparser.Statement
+	if _, statements, err = sqlparser.ParseMultiple(sqlparser.NewStringTokenizer(pattern)); err != nil {
+		err = errors.Wrap(err, "parse sql failed")
+		return
+	}
+	for _, stmt := range statements {
+		info := &statementInfo{}
+		switch s := stmt.(type) {
+		case *sqlparser.Select:
+			info.kind, info.hasWhere = "SELECT", s.Where != nil
+		case *sqlparser.Union:
+			info.kind = "SELECT"
+		case *sqlparser.Insert:
+			info.kind = "INSERT"
+		case *sqlparser.Update:
+			info.kind, info.hasWhere = "UPDATE", s.Where != nil
+		case *sqlparser.Delete:
+			info.kind, info.hasWhere = "DELETE", s.Where != nil
+		case *sqlparser.DDL:
+			info.kind = strings.ToUpper(s.Action)
+		case *sqlparser.Show:
+			info.kind = "SHOW"
+		default:
+			info.kind = "OTHER"
+		}
+		_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+			if t, ok := node.(sqlparser.TableName); ok && !t.IsEmpty() {
+				info.tables = append(info.tables, t.Name.String())
+			}
+			return true, nil
+		}, stmt)
+		infos = append(infos, info)
+	}
+	return
+}
+
+func matchRule(rule *types.QueryRule, info *statementInfo) bool {
+	if len(rule.Statements) > 0 {
+		var matched bool
+		for _, k := range rule.Statements {
+			if strings.EqualFold(k, info.kind) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if rule.WithoutWhere && (info.hasWhere || (info.kind != "UPDATE" && info.kind != "DELETE")) {
+		return false
+	}
+	if len(rule.Tables) > 0 {
+		// all tables referenced by the statement should be covered by the rule
+		if len(info.tables) == 0 {
+			return false
+		}
+		for _, t := range info.tables {
+			var matched bool
+			for _, rt := range rule.Tables {
+				if strings.EqualFold(rt, t) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkQueryRules checks the queries against the query rules of the grantee, a statement is
+// rejected if it matches any deny rule, or if allow rules exist and it matches none of them.
+func checkQueryRules(rules []types.QueryRule, queries []types.Query) (query string, err error) {
+	if len(rules) == 0 {
+		return
+	}
+	var hasAllowRules bool
+	for i := range rules {
+		if rules[i].Action == types.AllowQuery {
+			hasAllowRules = true
+			break
+		}
+	}
+	for _, q := range queries {
+		var infos []*statementInfo
+		if infos, err = parseStatements(q.Pattern); err != nil {
+			return q.Pattern, err
+		}
+		for _, info := range infos {
+			var allowed = !hasAllowRules
+			for i := range rules {
+				if !matchRule(&rules[i], info) {
+					continue
+				}
+				if rules[i].Action == types.DenyQuery {
+					return q.Pattern, errors.Wrapf(ErrPermissionDeny,
+						"%s statement denied by query rule #%d", info.kind, i)
+				}
+				allowed = true
+			}
+			if !allowed {
+				return q.Pattern, errors.Wrapf(ErrPermissionDeny,
+					"%s statement not allowed by any query rule", info.kind)
+			}
+		}
+	}
+	return
+}
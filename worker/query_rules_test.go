@@ -0,0 +1,57 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestCheckQueryRules(t *testing.T) {
+	Convey("test query rules of grantee", t, func() {
+		var check = func(rules []types.QueryRule, patterns ...string) error {
+			var queries []types.Query
+			for _, p := range patterns {
+				queries = append(queries, types.Query{Pattern: p})
+			}
+			_, err := checkQueryRules(rules, queries)
+			return errors.Cause(err)
+		}
+
+		So(check(nil, "DROP TABLE t1"), ShouldBeNil)
+
+		denyRules := []types.QueryRule{
+			{Action: types.DenyQuery, Statements: []string{"DELETE"}, WithoutWhere: true},
+			{Action: types.DenyQuery, Statements: []string{"drop"}},
+		}
+		So(check(denyRules, "DELETE FROM t1 WHERE k = 1"), ShouldBeNil)
+		So(check(denyRules, "DELETE FROM t1"), ShouldEqual, ErrPermissionDeny)
+		So(check(denyRules, "SELECT * FROM t1", "DROP TABLE t1"), ShouldEqual, ErrPermissionDeny)
+		So(check(denyRules, "UPDATE t1 SET v = 1"), ShouldBeNil)
+
+		allowRules := []types.QueryRule{
+			{Action: types.AllowQuery, Statements: []string{"SELECT"}, Tables: []string{"t1", "t2"}},
+		}
+		So(check(allowRules, "SELECT * FROM t1 JOIN t2 ON t1.k = t2.k"), ShouldBeNil)
+		So(check(allowRules, "SELECT * FROM t3"), ShouldEqual, ErrPermissionDeny)
+		So(check(allowRules, "INSERT INTO t1 VALUES (1)"), ShouldEqual, ErrPermissionDeny)
+	})
+}
@@ -0,0 +1,88 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/types"
+)
+
+// MaxReceiptSearchBlocks defines the max number of blocks searched for the write of a receipt,
+// starting from the head height the write is accepted at.
+const MaxReceiptSearchBlocks = 64
+
+// signReceipt signs the receipt of the accepted write query, the response hash must be built.
+func (db *Database) signReceipt(request *types.Request, response *types.Response) (err error) {
+	_, height := db.chain.Head()
+	receipt := &types.SignedReceiptHeader{
+		ReceiptHeader: types.ReceiptHeader{
+			DatabaseID:   db.dbID,
+			RequestHash:  request.Header.Hash(),
+			ResponseHash: response.Header.Hash(),
+			NodeID:       db.nodeID,
+			LogOffset:    response.Header.LogOffset,
+			Height:       height,
+			Timestamp:    time.Now().UTC(),
+		},
+	}
+	if err = receipt.Sign(db.privateKey); err != nil {
+		return
+	}
+	response.Receipt = receipt
+	return
+}
+
+// receiptProof searches the blocks after height for the response and returns the proof that it
+// is packed.
+func (db *Database) receiptProof(responseHash hash.Hash, height int32) (proof *types.ReceiptProof, err error) {
+	_, head := db.chain.Head()
+	to := height + MaxReceiptSearchBlocks
+	if to > head {
+		to = head
+	}
+	for h := height + 1; h <= to; h++ {
+		var b *types.Block
+		if b, err = db.chain.FetchBlock(h); err != nil {
+			return
+		}
+		if b == nil {
+			continue
+		}
+		var ok bool
+		if proof, ok = b.ReceiptProof(h, responseHash); ok {
+			return
+		}
+	}
+	err = errors.Wrapf(ErrNotExists, "response %s not packed in blocks (%d, %d]",
+		responseHash.String(), height, to)
+	return
+}
+
+// QueryReceiptProof returns the proof that the write of a receipt is packed in a block, the
+// proof carries no query payload so anyone holding the receipt is allowed to query.
+func (dbms *DBMS) QueryReceiptProof(req *types.QueryReceiptProofReq) (proof *types.ReceiptProof, err error) {
+	db, ok := dbms.getMeta(req.DatabaseID)
+	if !ok {
+		err = ErrNotExists
+		return
+	}
+	return db.receiptProof(req.ResponseHash, req.Height)
+}
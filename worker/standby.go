@@ -0,0 +1,319 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto"
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/crypto/kms"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// StandbyInfoFileName defines the file name of the latest snapshot received by the standby
+	// miner.
+	StandbyInfoFileName = "standby.json"
+
+	standbyDirSuffix      = ".standby"
+	standbySnapshotPrefix = "latest"
+)
+
+// standbyInfo defines the latest complete snapshot received by the standby miner.
+type standbyInfo struct {
+	Snapshot types.SnapshotInfo `json:"snapshot"`
+	Source   proto.NodeID       `json:"source"`
+	Received time.Time          `json:"received"`
+}
+
+// standbyTransfer defines a snapshot shipping in progress to the local standby miner.
+type standbyTransfer struct {
+	sync.Mutex
+	dir      string
+	info     types.SnapshotInfo
+	source   proto.NodeID
+	filename string
+	done     bool
+}
+
+func standbyDir(rootDir string, dbID proto.DatabaseID) string {
+	return filepath.Join(rootDir, string(dbID)+standbyDirSuffix)
+}
+
+func loadStandbyInfo(dir string) (info *standbyInfo, err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(filepath.Join(dir, StandbyInfoFileName)); err != nil {
+		return
+	}
+	info = &standbyInfo{}
+	err = json.Unmarshal(data, info)
+	return
+}
+
+func newStandbyTransfer(dir string, source proto.NodeID, info *types.SnapshotInfo) (t *standbyTransfer, err error) {
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	t = &standbyTransfer{
+		dir:      dir,
+		info:     *info,
+		source:   source,
+		filename: filepath.Join(dir, info.ID.String()+snapshotFileSuffix),
+	}
+	if latest, loadErr := loadStandbyInfo(dir); loadErr == nil && latest.Snapshot.ID.IsEqual(&info.ID) {
+		// already received
+		t.done = true
+		return
+	}
+	// drop the other partial transfers
+	parts, _ := filepath.Glob(filepath.Join(dir, "*"+snapshotFileSuffix))
+	for _, part := range parts {
+		if part != t.filename && part != t.latestFile() {
+			_ = os.Remove(part)
+		}
+	}
+	return
+}
+
+func (t *standbyTransfer) latestFile() string {
+	return filepath.Join(t.dir, standbySnapshotPrefix+snapshotFileSuffix)
+}
+
+// write writes the chunk at offset and returns the next offset expected, a chunk beyond the
+// received data is ignored, so that the sender resumes from the returned offset.
+func (t *standbyTransfer) write(offset uint64, data []byte) (next uint64, err error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.done {
+		return t.info.Size, nil
+	}
+	var (
+		f  *os.File
+		st os.FileInfo
+	)
+	if f, err = os.OpenFile(t.filename, os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+		return
+	}
+	defer f.Close()
+	if st, err = f.Stat(); err != nil {
+		return
+	}
+	if next = uint64(st.Size()); offset > next || len(data) == 0 {
+		return
+	}
+	if offset+uint64(len(data)) > t.info.Size {
+		err = errors.Wrapf(ErrInvalidRequest, "chunk exceeds snapshot size %d", t.info.Size)
+		return
+	}
+	if _, err = f.WriteAt(data, int64(offset)); err != nil {
+		return
+	}
+	if end := offset + uint64(len(data)); end > next {
+		next = end
+	}
+	if next < t.info.Size {
+		return
+	}
+	if err = t.complete(); err != nil {
+		return 0, err
+	}
+	return
+}
+
+// complete verifies the received snapshot and keeps it as the latest one.
+func (t *standbyTransfer) complete() (err error) {
+	var data []byte
+	if data, err = ioutil.ReadFile(t.filename); err != nil {
+		return
+	}
+	if actual := hash.THashH(data); !actual.IsEqual(&t.info.ID) {
+		_ = os.Remove(t.filename)
+		return errors.Errorf("snapshot hash not match, expected %s, actual %s",
+			t.info.ID.String(), actual.String())
+	}
+	if err = os.Rename(t.filename, t.latestFile()); err != nil {
+		return
+	}
+	if data, err = json.Marshal(&standbyInfo{
+		Snapshot: t.info,
+		Source:   t.source,
+		Received: time.Now().UTC(),
+	}); err != nil {
+		return
+	}
+	tmpFile := filepath.Join(t.dir, StandbyInfoFileName+".tmp")
+	if err = ioutil.WriteFile(tmpFile, data, 0644); err != nil {
+		return
+	}
+	if err = os.Rename(tmpFile, filepath.Join(t.dir, StandbyInfoFileName)); err != nil {
+		return
+	}
+	t.done = true
+	return
+}
+
+// ShipSnapshotChunk receives the snapshot chunks shipped by the miners of a database, which
+// designates the local miner as its standby.
+func (dbms *DBMS) ShipSnapshotChunk(req *types.ShipSnapshotChunkReq) (offset uint64, err error) {
+	var (
+		source = req.GetNodeID().ToNodeID()
+		t      *standbyTransfer
+	)
+	if v, ok := dbms.standbys.Load(req.DatabaseID); ok {
+		if t = v.(*standbyTransfer); t.source != source || !t.info.ID.IsEqual(&req.Info.ID) {
+			t = nil
+		}
+	}
+	if t == nil {
+		// authorize the new transfer with the database profile on chain
+		if err = dbms.checkStandbySource(req.DatabaseID, source); err != nil {
+			return
+		}
+		if t, err = newStandbyTransfer(
+			standbyDir(dbms.cfg.RootDir, req.DatabaseID), source, &req.Info,
+		); err != nil {
+			return
+		}
+		dbms.standbys.Store(req.DatabaseID, t)
+	}
+	return t.write(req.Offset, req.Data)
+}
+
+// checkStandbySource checks that the local miner is the standby of the database and the source
+// is one of its miners.
+func (dbms *DBMS) checkStandbySource(dbID proto.DatabaseID, source proto.NodeID) (err error) {
+	var (
+		profile *types.SQLChainProfile
+		local   proto.NodeID
+	)
+	if _, ok := dbms.getMeta(dbID); ok {
+		return errors.Wrap(ErrNotStandby, "database is served by the local miner")
+	}
+	if local, err = kms.GetLocalNodeID(); err != nil {
+		return
+	}
+	if profile, err = dbms.busService.querySQLProfile(dbID); err != nil {
+		return
+	}
+	if profile.Meta.StandbyNode != local {
+		return ErrNotStandby
+	}
+	for _, mi := range profile.Miners {
+		if mi.NodeID == source {
+			return
+		}
+	}
+	return errors.Wrap(ErrPermissionDeny, "not a miner of the database")
+}
+
+// PromoteStandby promotes the local standby miner to serve the database alone, from the latest
+// snapshot shipped to it, only the database owner is allowed. It's used to recover the database
+// if the whole replication group is lost, writes committed after the snapshot are lost. The
+// promotion is not recorded on chain, the owner should update the miners of the database on
+// chain to include the standby miner afterwards, until then the database profile is kept by
+// the standby miner locally.
+func (dbms *DBMS) PromoteStandby(req *types.PromoteStandbyReq) (info *types.SnapshotInfo, err error) {
+	var (
+		dbID     = req.Header.DatabaseID
+		dir      = standbyDir(dbms.cfg.RootDir, dbID)
+		addr     proto.AccountAddress
+		local    proto.NodeID
+		profile  *types.SQLChainProfile
+		latest   *standbyInfo
+		instance *types.ServiceInstance
+	)
+	if err = req.Header.Verify(); err != nil {
+		return
+	}
+	if gap := time.Since(req.Header.Timestamp); gap > dbms.cfg.MaxReqTimeGap ||
+		gap < -dbms.cfg.MaxReqTimeGap {
+		err = errors.Wrap(ErrInvalidRequest, "invalid request time")
+		return
+	}
+	if addr, err = crypto.PubKeyHash(req.Header.Signee); err != nil {
+		return
+	}
+	if local, err = kms.GetLocalNodeID(); err != nil {
+		return
+	}
+	if profile, err = dbms.busService.querySQLProfile(dbID); err != nil {
+		return
+	}
+	if profile.Owner != addr {
+		err = errors.Wrapf(ErrPermissionDeny, "%s is not owner of database %s",
+			addr.String(), dbID)
+		return
+	}
+	if profile.Meta.StandbyNode != local {
+		err = ErrNotStandby
+		return
+	}
+	if _, ok := dbms.getMeta(dbID); ok {
+		err = ErrAlreadyExists
+		return
+	}
+	if latest, err = loadStandbyInfo(dir); err != nil {
+		err = errors.Wrapf(ErrNotExists, "no snapshot shipped to standby: %v", err)
+		return
+	}
+
+	// serve the database alone, the promoted database has no standby
+	promoted := *profile
+	promoted.Miners = []*types.MinerInfo{{Address: dbms.address, NodeID: local}}
+	promoted.Meta.StandbyNode = ""
+	if instance, err = dbms.buildSQLChainServiceInstance(&promoted); err != nil {
+		return
+	}
+	cfg := &DBConfig{
+		DatabaseID:    dbID,
+		RootDir:       dbms.cfg.RootDir,
+		DataDir:       filepath.Join(dbms.cfg.RootDir, string(dbID)),
+		EncryptionKey: promoted.Meta.EncryptionKey,
+	}
+	if err = os.MkdirAll(cfg.DataDir, 0755); err != nil {
+		return
+	}
+	if err = restoreSnapshot(
+		cfg, filepath.Join(dir, standbySnapshotPrefix+snapshotFileSuffix), &latest.Snapshot,
+	); err != nil {
+		return
+	}
+	dbms.busService.pinSQLProfile(&promoted)
+	if err = dbms.Create(instance, false); err != nil {
+		return
+	}
+	dbms.standbys.Delete(dbID)
+	info = &latest.Snapshot
+	log.WithFields(log.Fields{
+		"db":       dbID,
+		"source":   latest.Source,
+		"received": latest.Received,
+		"height":   info.Height,
+		"block":    info.BlockHash.String(),
+	}).Warning("standby promoted to serve the database")
+	return
+}
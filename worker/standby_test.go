@@ -0,0 +1,97 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+)
+
+func TestStandbyTransfer(t *testing.T) {
+	Convey("test snapshot shipping to standby", t, func() {
+		dir, err := ioutil.TempDir("", "standby")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		var (
+			data   = []byte("snapshot content shipped in chunks")
+			source = proto.NodeID("00000000000000000000000000000000000000000000000000000000000000aa")
+			info   = &types.SnapshotInfo{ID: hash.THashH(data), Size: uint64(len(data)), Height: 10}
+		)
+		tr, err := newStandbyTransfer(dir, source, info)
+		So(err, ShouldBeNil)
+
+		// probe on empty transfer
+		next, err := tr.write(0, nil)
+		So(err, ShouldBeNil)
+		So(next, ShouldEqual, uint64(0))
+
+		next, err = tr.write(0, data[:10])
+		So(err, ShouldBeNil)
+		So(next, ShouldEqual, uint64(10))
+
+		// chunk beyond the received data is ignored
+		next, err = tr.write(20, data[20:])
+		So(err, ShouldBeNil)
+		So(next, ShouldEqual, uint64(10))
+
+		// resume with a new transfer of the same snapshot
+		tr, err = newStandbyTransfer(dir, source, info)
+		So(err, ShouldBeNil)
+		next, err = tr.write(0, nil)
+		So(err, ShouldBeNil)
+		So(next, ShouldEqual, uint64(10))
+		next, err = tr.write(10, data[10:])
+		So(err, ShouldBeNil)
+		So(next, ShouldEqual, info.Size)
+
+		latest, err := loadStandbyInfo(dir)
+		So(err, ShouldBeNil)
+		So(latest.Source, ShouldEqual, source)
+		So(latest.Snapshot, ShouldResemble, *info)
+		content, err := ioutil.ReadFile(filepath.Join(dir, standbySnapshotPrefix+snapshotFileSuffix))
+		So(err, ShouldBeNil)
+		So(content, ShouldResemble, data)
+
+		// the received snapshot is not shipped again
+		tr, err = newStandbyTransfer(dir, source, info)
+		So(err, ShouldBeNil)
+		next, err = tr.write(0, nil)
+		So(err, ShouldBeNil)
+		So(next, ShouldEqual, info.Size)
+
+		// corrupted snapshot is dropped
+		corrupted := &types.SnapshotInfo{ID: hash.THashH([]byte("other")), Size: uint64(len(data))}
+		tr, err = newStandbyTransfer(dir, source, corrupted)
+		So(err, ShouldBeNil)
+		_, err = tr.write(0, data)
+		So(err, ShouldNotBeNil)
+		_, err = os.Stat(tr.filename)
+		So(os.IsNotExist(err), ShouldBeTrue)
+		latest, err = loadStandbyInfo(dir)
+		So(err, ShouldBeNil)
+		So(latest.Snapshot.ID, ShouldResemble, info.ID)
+	})
+}
@@ -0,0 +1,292 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"context"
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	rpc "github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+	x "github.com/SQLess/SQLess/xenomint"
+)
+
+const (
+	// DefaultStateDigestInterval defines the default write count between two state digests.
+	DefaultStateDigestInterval uint64 = 1024
+	// DefaultStateDigestCheckInterval defines the default interval to compare digests with peers.
+	DefaultStateDigestCheckInterval = time.Minute
+	// MaxStateDigestHistory defines the max count of recent digests kept for peer comparison.
+	MaxStateDigestHistory = 16
+
+	mwMinerStateDivergence = "service:miner:digest:divergence"
+)
+
+var (
+	stateDivergence = new(expvar.Int)
+)
+
+func init() {
+	expvar.Publish(mwMinerStateDivergence, stateDivergence)
+}
+
+// stateDigester computes state digests at deterministic write sequences and compares them with
+// the other replicas, divergent replicas are flagged and a local divergence triggers resync.
+type stateDigester struct {
+	sync.RWMutex
+	db            *Database
+	interval      uint64
+	checkInterval time.Duration
+	history       map[uint64]*types.StateDigest
+	seqs          []uint64
+	peers         *proto.Peers
+	divergent     map[proto.NodeID]uint64
+	computing     bool
+	stopped       bool
+	stopCh        chan struct{}
+	wg            sync.WaitGroup
+}
+
+func newStateDigester(db *Database, peers *proto.Peers) *stateDigester {
+	d := &stateDigester{
+		db:            db,
+		interval:      db.cfg.StateDigestInterval,
+		checkInterval: db.cfg.StateDigestCheckInterval,
+		history:       make(map[uint64]*types.StateDigest),
+		peers:         peers,
+		divergent:     make(map[proto.NodeID]uint64),
+		stopCh:        make(chan struct{}),
+	}
+	if d.interval == 0 {
+		d.interval = DefaultStateDigestInterval
+	}
+	if d.checkInterval <= 0 {
+		d.checkInterval = DefaultStateDigestCheckInterval
+	}
+	return d
+}
+
+func (d *stateDigester) start() {
+	d.wg.Add(1)
+	go d.run()
+}
+
+func (d *stateDigester) stop() {
+	d.Lock()
+	if !d.stopped {
+		d.stopped = true
+		close(d.stopCh)
+	}
+	d.Unlock()
+	d.wg.Wait()
+}
+
+func (d *stateDigester) run() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(d.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+			d.check()
+		}
+	}
+}
+
+func (d *stateDigester) updatePeers(peers *proto.Peers) {
+	d.Lock()
+	defer d.Unlock()
+	d.peers = peers
+}
+
+// afterWrite is called in kayak commit with the state sequences before and after the write,
+// a digest is taken when the write crosses a digest interval boundary. Since all replicas
+// apply the same writes in the same order, the digests are taken at the same sequences.
+//
+// Only a read snapshot is pinned in the commit path, the digest is computed from the snapshot
+// in background. The boundary is skipped if the previous digest is still being computed.
+func (d *stateDigester) afterWrite(before, after uint64) {
+	if before/d.interval == after/d.interval {
+		return
+	}
+	d.Lock()
+	if d.stopped || d.computing {
+		d.Unlock()
+		log.WithFields(log.Fields{
+			"db":  d.db.dbID,
+			"seq": after,
+		}).Debug("skip state digest, previous digest is still being computed")
+		return
+	}
+	d.computing = true
+	d.wg.Add(1)
+	d.Unlock()
+
+	snap, err := d.db.chain.PinStateDigest(context.Background())
+	if err != nil {
+		d.Lock()
+		d.computing = false
+		d.Unlock()
+		d.wg.Done()
+		log.WithField("db", d.db.dbID).WithError(err).Warning("pin state digest snapshot failed")
+		return
+	}
+	go d.compute(snap)
+}
+
+func (d *stateDigester) compute(snap *x.DigestSnapshot) {
+	defer d.wg.Done()
+	digest, err := snap.Digest()
+	d.Lock()
+	defer d.Unlock()
+	d.computing = false
+	if err != nil {
+		log.WithFields(log.Fields{
+			"db":  d.db.dbID,
+			"seq": snap.Seq,
+		}).WithError(err).Warning("compute state digest failed")
+		return
+	}
+	d.history[digest.Seq] = digest
+	d.seqs = append(d.seqs, digest.Seq)
+	if len(d.seqs) > MaxStateDigestHistory {
+		delete(d.history, d.seqs[0])
+		d.seqs = d.seqs[1:]
+	}
+}
+
+// get returns the digest at the sequence, or the latest digest if seq is 0.
+func (d *stateDigester) get(seq uint64) (digest *types.StateDigest, ok bool) {
+	d.RLock()
+	defer d.RUnlock()
+	if seq == 0 {
+		if len(d.seqs) == 0 {
+			return
+		}
+		seq = d.seqs[len(d.seqs)-1]
+	}
+	digest, ok = d.history[seq]
+	return
+}
+
+// divergentNodes returns the replicas flagged as divergent.
+func (d *stateDigester) divergentNodes() (nodes []proto.NodeID) {
+	d.RLock()
+	defer d.RUnlock()
+	for n := range d.divergent {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	return
+}
+
+func (d *stateDigester) flag(nodeID proto.NodeID, seq uint64) {
+	d.Lock()
+	_, flagged := d.divergent[nodeID]
+	d.divergent[nodeID] = seq
+	d.Unlock()
+	if flagged {
+		return
+	}
+	stateDivergence.Add(1)
+	log.WithFields(log.Fields{
+		"db":   d.db.dbID,
+		"node": nodeID,
+		"seq":  seq,
+	}).Error("replica state divergence detected")
+	if d.db.cfg.OnStateDivergence != nil {
+		d.db.cfg.OnStateDivergence(d.db.dbID, nodeID, seq)
+	}
+}
+
+// check compares the latest local digest with the peers, the digest held by the majority of
+// replicas is considered as healthy.
+func (d *stateDigester) check() {
+	local, ok := d.get(0)
+	if !ok {
+		return
+	}
+	d.RLock()
+	peers := d.peers
+	d.RUnlock()
+	if peers == nil {
+		return
+	}
+
+	var (
+		caller = rpc.NewCaller()
+		groups = map[string][]proto.NodeID{
+			local.Root.String(): {d.db.nodeID},
+		}
+	)
+	for _, nodeID := range peers.Servers {
+		if nodeID == d.db.nodeID {
+			continue
+		}
+		req := &types.StateDigestReq{DatabaseID: d.db.dbID, Seq: local.Seq}
+		resp := &types.StateDigestResp{}
+		if err := caller.CallNode(nodeID, route.DBSStateDigest.String(), req, resp); err != nil {
+			log.WithFields(log.Fields{
+				"db":   d.db.dbID,
+				"node": nodeID,
+			}).WithError(err).Debug("query peer state digest failed")
+			continue
+		}
+		if !resp.Found {
+			// peer is lagging behind or has rotated the digest out of history
+			continue
+		}
+		root := resp.Digest.Root.String()
+		groups[root] = append(groups[root], nodeID)
+	}
+	if len(groups) == 1 {
+		return
+	}
+
+	var healthy string
+	for root, nodes := range groups {
+		if healthy == "" || len(nodes) > len(groups[healthy]) ||
+			(len(nodes) == len(groups[healthy]) && root == local.Root.String()) {
+			healthy = root
+		}
+	}
+	for root, nodes := range groups {
+		if root == healthy {
+			continue
+		}
+		for _, nodeID := range nodes {
+			d.flag(nodeID, local.Seq)
+		}
+	}
+	if healthy != local.Root.String() && d.db.cfg.ResyncFromPeer != nil {
+		source := groups[healthy][0]
+		if err := d.db.cfg.ResyncFromPeer(d.db.dbID, source); err != nil {
+			log.WithFields(log.Fields{
+				"db":     d.db.dbID,
+				"source": source,
+			}).WithError(err).Error("resync divergent replica failed")
+		}
+	}
+}
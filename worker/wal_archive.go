@@ -0,0 +1,407 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	kt "github.com/SQLess/SQLess/kayak/types"
+	kl "github.com/SQLess/SQLess/kayak/wal"
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/route"
+	rpc "github.com/SQLess/SQLess/rpc/mux"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	// WALArchiveProgressFileName defines the archive progress file name of database instance.
+	WALArchiveProgressFileName = "wal-archive.progress"
+
+	// WALArchiveDirName defines the directory name of the wal segments archived by peer miners.
+	WALArchiveDirName = "wal-archive"
+
+	// DefaultWALArchiveInterval defines the default interval of shipping wal segments.
+	DefaultWALArchiveInterval = time.Second
+
+	// MaxWALArchiveSegmentLogs defines the max number of logs in a single wal segment.
+	MaxWALArchiveSegmentLogs = 1024
+
+	walArchiveSegmentExt = ".seg"
+)
+
+// WALArchiveTarget defines the remote storage to ship wal segments to.
+type WALArchiveTarget interface {
+	// PutSegment stores the segment containing logs [first, last] of the database.
+	PutSegment(dbID proto.DatabaseID, first, last uint64, data []byte) error
+	// GetSegment returns the archived segment containing the log at index from, or the first
+	// segment after it, the data is empty if there is no such segment.
+	GetSegment(dbID proto.DatabaseID, from uint64) (data []byte, err error)
+}
+
+// DirWALArchiveTarget archives wal segments to a directory, which is usually a mounted remote
+// file system (NFS, S3 fuse mount, etc.).
+type DirWALArchiveTarget struct {
+	Root string
+}
+
+func (t *DirWALArchiveTarget) segmentPath(dbID proto.DatabaseID, first, last uint64) string {
+	return filepath.Join(t.Root, string(dbID), fmt.Sprintf("%020d-%020d%s", first, last, walArchiveSegmentExt))
+}
+
+// PutSegment implements WALArchiveTarget.PutSegment.
+func (t *DirWALArchiveTarget) PutSegment(dbID proto.DatabaseID, first, last uint64, data []byte) (err error) {
+	path := t.segmentPath(dbID, first, last)
+	if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return
+	}
+	return os.Rename(tmp, path)
+}
+
+// GetSegment implements WALArchiveTarget.GetSegment.
+func (t *DirWALArchiveTarget) GetSegment(dbID proto.DatabaseID, from uint64) (data []byte, err error) {
+	var files []string
+	if files, err = filepath.Glob(filepath.Join(t.Root, string(dbID), "*"+walArchiveSegmentExt)); err != nil {
+		return
+	}
+	// the file names are zero padded, so they are sorted by the first log index
+	sort.Strings(files)
+	for _, f := range files {
+		var first, last uint64
+		if _, serr := fmt.Sscanf(filepath.Base(f), "%d-%d", &first, &last); serr != nil {
+			continue
+		}
+		if last >= from {
+			return ioutil.ReadFile(f)
+		}
+	}
+	return
+}
+
+// MinerWALArchiveTarget archives wal segments to a peer miner, which stores them in the
+// WALArchiveDirName directory under its root directory.
+type MinerWALArchiveTarget struct {
+	NodeID proto.NodeID
+}
+
+// PutSegment implements WALArchiveTarget.PutSegment.
+func (t *MinerWALArchiveTarget) PutSegment(dbID proto.DatabaseID, first, last uint64, data []byte) (err error) {
+	var req = &types.PutWALSegmentReq{
+		DatabaseID: dbID,
+		First:      first,
+		Last:       last,
+		Data:       data,
+	}
+	return rpc.NewCaller().CallNode(
+		t.NodeID, route.DBSPutWALSegment.String(), req, &types.PutWALSegmentResp{})
+}
+
+// GetSegment implements WALArchiveTarget.GetSegment.
+func (t *MinerWALArchiveTarget) GetSegment(dbID proto.DatabaseID, from uint64) (data []byte, err error) {
+	var (
+		req  = &types.FetchWALSegmentReq{DatabaseID: dbID, From: from}
+		resp = &types.FetchWALSegmentResp{}
+	)
+	if err = rpc.NewCaller().CallNode(t.NodeID, route.DBSFetchWALSegment.String(), req, resp); err != nil {
+		return
+	}
+	data = resp.Data
+	return
+}
+
+// LoadWALArchive reads all the archived logs of the database from the index in index order, it's
+// used to recover a database after all the replicas are lost.
+func LoadWALArchive(target WALArchiveTarget, dbID proto.DatabaseID, from uint64) (logs []*kt.Log, err error) {
+	for {
+		var (
+			data    []byte
+			segment []*kt.Log
+		)
+		if data, err = target.GetSegment(dbID, from); err != nil {
+			err = errors.Wrapf(err, "get segment from %d failed", from)
+			return
+		}
+		if len(data) == 0 {
+			return
+		}
+		if segment, err = DecodeWALSegment(data); err != nil {
+			err = errors.Wrapf(err, "decode segment from %d failed", from)
+			return
+		}
+		var next = from
+		for _, l := range segment {
+			// segments may overlap if the archiving is restarted without progress
+			if l.Index >= from {
+				logs = append(logs, l)
+				next = l.Index + 1
+			}
+		}
+		if next == from {
+			return
+		}
+		from = next
+	}
+}
+
+// EncodeWALSegment encodes logs to a wal segment.
+func EncodeWALSegment(logs []*kt.Log) (data []byte, err error) {
+	buf, err := utils.EncodeMsgPack(logs)
+	if err != nil {
+		return
+	}
+	data = buf.Bytes()
+	return
+}
+
+// DecodeWALSegment decodes logs from a wal segment.
+func DecodeWALSegment(data []byte) (logs []*kt.Log, err error) {
+	err = utils.DecodeMsgPack(data, &logs)
+	return
+}
+
+// replayWALLogs writes the logs to the empty wal and commits the prepared payloads of the commit
+// logs after the applied index to the handler, the index of the last commit applied is returned.
+func replayWALLogs(wal kt.Wal, logs []*kt.Log, applied uint64, h kt.Handler) (last uint64, err error) {
+	var prepares = make(map[uint64]*kt.Log)
+	last = applied
+	for _, l := range logs {
+		if err = wal.Write(l); err != nil {
+			return
+		}
+		switch l.Type {
+		case kt.LogPrepare:
+			prepares[l.Index] = l
+		case kt.LogCommit:
+			if l.Index <= applied {
+				continue
+			}
+			if len(l.Data) < 8 {
+				err = errors.Wrapf(kt.ErrInvalidLog, "commit log %d without prepare index", l.Index)
+				return
+			}
+			var (
+				pl, ok = prepares[binary.BigEndian.Uint64(l.Data)]
+				req    interface{}
+			)
+			if !ok {
+				err = errors.Wrapf(kt.ErrInvalidLog, "prepare log of commit log %d not found", l.Index)
+				return
+			}
+			if req, err = h.DecodePayload(pl.Data); err != nil {
+				return
+			}
+			// a failed commit fails on all the replicas as well, just like in kayak
+			if _, cerr := h.Commit(req, false); cerr != nil {
+				log.WithField("index", l.Index).WithError(cerr).Warning("replay archived commit failed")
+			}
+			last = l.Index
+		}
+	}
+	return
+}
+
+// restoreWALArchive restores the archived logs to the empty local wal and replays the commits
+// after the applied index to the storage, the applied index is updated to the last replayed
+// commit and the next index to archive is returned.
+func (db *Database) restoreWALArchive(applied uint64) (next, last uint64, err error) {
+	var logs []*kt.Log
+	if logs, err = LoadWALArchive(db.cfg.WALArchiveTarget, db.dbID, 0); err != nil {
+		return
+	}
+	if len(logs) == 0 {
+		return 0, applied, nil
+	}
+	if last, err = replayWALLogs(db.kayakWal, logs, applied, db); err != nil {
+		return
+	}
+	// reopen the wal, which is marked as read by the writes, so that kayak loads the logs
+	db.kayakWal.Close()
+	if db.kayakWal, err = kl.NewLevelDBWal(filepath.Join(db.cfg.DataDir, KayakWalFileName)); err != nil {
+		return
+	}
+	if last != applied {
+		if err = writeAppliedIndex(db.cfg.DataDir, last); err != nil {
+			return
+		}
+	}
+	next = logs[len(logs)-1].Index + 1
+	log.WithFields(log.Fields{
+		"db":      db.dbID,
+		"logs":    len(logs),
+		"applied": last,
+	}).Info("database restored from wal archive")
+	return
+}
+
+// walArchiveStore returns the local store of the wal segments archived by peer miners.
+func (dbms *DBMS) walArchiveStore() *DirWALArchiveTarget {
+	return &DirWALArchiveTarget{Root: filepath.Join(dbms.cfg.RootDir, WALArchiveDirName)}
+}
+
+// PutWALSegment stores a wal segment archived by a miner of the database.
+func (dbms *DBMS) PutWALSegment(req *types.PutWALSegmentReq) (err error) {
+	if !dbms.isDatabaseMinerNode(req.DatabaseID, req.GetNodeID().ToNodeID()) {
+		return errors.Wrap(ErrPermissionDeny, "not a miner of the database")
+	}
+	if req.Last < req.First || len(req.Data) == 0 {
+		return errors.Wrap(ErrInvalidRequest, "invalid wal segment")
+	}
+	return dbms.walArchiveStore().PutSegment(req.DatabaseID, req.First, req.Last, req.Data)
+}
+
+// FetchWALSegment returns a wal segment archived locally to a miner of the database.
+func (dbms *DBMS) FetchWALSegment(req *types.FetchWALSegmentReq) (data []byte, err error) {
+	if !dbms.isDatabaseMinerNode(req.DatabaseID, req.GetNodeID().ToNodeID()) {
+		err = errors.Wrap(ErrPermissionDeny, "not a miner of the database")
+		return
+	}
+	return dbms.walArchiveStore().GetSegment(req.DatabaseID, req.From)
+}
+
+// walArchiver continuously ships new kayak logs of a database to the archive target.
+type walArchiver struct {
+	dbID         proto.DatabaseID
+	wal          *kl.LevelDBWal
+	target       WALArchiveTarget
+	interval     time.Duration
+	progressFile string
+	next         uint64
+	stopCh       chan struct{}
+	wg           sync.WaitGroup
+}
+
+func newWALArchiver(dbID proto.DatabaseID, wal *kl.LevelDBWal, target WALArchiveTarget,
+	interval time.Duration, dataDir string) (a *walArchiver, err error) {
+	if interval <= 0 {
+		interval = DefaultWALArchiveInterval
+	}
+	a = &walArchiver{
+		dbID:         dbID,
+		wal:          wal,
+		target:       target,
+		interval:     interval,
+		progressFile: filepath.Join(dataDir, WALArchiveProgressFileName),
+		stopCh:       make(chan struct{}),
+	}
+	var data []byte
+	if data, err = ioutil.ReadFile(a.progressFile); err == nil && len(data) == 8 {
+		a.next = binary.BigEndian.Uint64(data)
+	} else if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	err = nil
+	return
+}
+
+func (a *walArchiver) start() {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ticker := time.NewTicker(a.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.stopCh:
+				// ship remaining logs before exit
+				a.archive()
+				return
+			case <-ticker.C:
+				a.archive()
+			}
+		}
+	}()
+}
+
+func (a *walArchiver) stop() {
+	select {
+	case <-a.stopCh:
+		return
+	default:
+		close(a.stopCh)
+	}
+	a.wg.Wait()
+}
+
+// archive ships all the logs not archived yet.
+func (a *walArchiver) archive() {
+	for {
+		n, err := a.archiveSegment()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"db":   a.dbID,
+				"next": a.next,
+			}).WithError(err).Warning("archive wal segment failed")
+			return
+		}
+		if n < MaxWALArchiveSegmentLogs {
+			return
+		}
+	}
+}
+
+func (a *walArchiver) archiveSegment() (n int, err error) {
+	var logs []*kt.Log
+	for i := a.next; len(logs) < MaxWALArchiveSegmentLogs; i++ {
+		var l *kt.Log
+		if l, err = a.wal.Get(i); errors.Cause(err) == kl.ErrNotExists {
+			err = nil
+			break
+		} else if err != nil {
+			return
+		}
+		logs = append(logs, l)
+	}
+	if n = len(logs); n == 0 {
+		return
+	}
+
+	var data []byte
+	if data, err = EncodeWALSegment(logs); err != nil {
+		return
+	}
+	last := logs[n-1].Index
+	if err = a.target.PutSegment(a.dbID, a.next, last, data); err != nil {
+		return
+	}
+	err = a.setNext(last + 1)
+	return
+}
+
+// setNext saves the archive progress, logs before next are archived.
+func (a *walArchiver) setNext(next uint64) (err error) {
+	progress := make([]byte, 8)
+	binary.BigEndian.PutUint64(progress, next)
+	if err = ioutil.WriteFile(a.progressFile, progress, 0644); err != nil {
+		return
+	}
+	a.next = next
+	return
+}
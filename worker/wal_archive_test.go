@@ -0,0 +1,175 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	kt "github.com/SQLess/SQLess/kayak/types"
+	kl "github.com/SQLess/SQLess/kayak/wal"
+	"github.com/SQLess/SQLess/proto"
+)
+
+func TestWALArchiver(t *testing.T) {
+	Convey("Given a kayak wal with some logs", t, func() {
+		var (
+			dbID   = proto.DatabaseID("db")
+			target *DirWALArchiveTarget
+			wal    *kl.LevelDBWal
+			a      *walArchiver
+		)
+		rootDir, err := ioutil.TempDir("", "wal_archive_test_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(rootDir)
+
+		wal, err = kl.NewLevelDBWal(filepath.Join(rootDir, KayakWalFileName))
+		So(err, ShouldBeNil)
+		defer wal.Close()
+
+		writeLogs := func(from, to uint64) {
+			for i := from; i < to; i++ {
+				err := wal.Write(&kt.Log{
+					LogHeader: kt.LogHeader{
+						Index: i,
+						Type:  kt.LogPrepare,
+					},
+					Data: []byte{byte(i)},
+				})
+				So(err, ShouldBeNil)
+			}
+		}
+		writeLogs(0, 10)
+
+		target = &DirWALArchiveTarget{Root: filepath.Join(rootDir, "archive")}
+		a, err = newWALArchiver(dbID, wal, target, 0, rootDir)
+		So(err, ShouldBeNil)
+		So(a.interval, ShouldEqual, DefaultWALArchiveInterval)
+
+		Convey("The logs should be shipped incrementally", func() {
+			a.archive()
+			So(a.next, ShouldEqual, 10)
+			logs, err := LoadWALArchive(target, dbID, 0)
+			So(err, ShouldBeNil)
+			So(logs, ShouldHaveLength, 10)
+
+			writeLogs(10, 15)
+			a.archive()
+			So(a.next, ShouldEqual, 15)
+			logs, err = LoadWALArchive(target, dbID, 0)
+			So(err, ShouldBeNil)
+			So(logs, ShouldHaveLength, 15)
+			for i, l := range logs {
+				So(l.Index, ShouldEqual, i)
+				So(l.Data, ShouldResemble, []byte{byte(i)})
+			}
+
+			Convey("The progress should be restored by a new archiver", func() {
+				a, err = newWALArchiver(dbID, wal, target, 0, rootDir)
+				So(err, ShouldBeNil)
+				So(a.next, ShouldEqual, 15)
+			})
+			Convey("The overlapping segments should be loaded once", func() {
+				So(a.setNext(5), ShouldBeNil)
+				a.archive()
+				So(a.next, ShouldEqual, 15)
+				logs, err = LoadWALArchive(target, dbID, 0)
+				So(err, ShouldBeNil)
+				So(logs, ShouldHaveLength, 15)
+				logs, err = LoadWALArchive(target, dbID, 12)
+				So(err, ShouldBeNil)
+				So(logs, ShouldHaveLength, 3)
+				So(logs[0].Index, ShouldEqual, 12)
+			})
+		})
+	})
+}
+
+// testReplayHandler records the committed payloads.
+type testReplayHandler struct {
+	committed []string
+}
+
+func (h *testReplayHandler) EncodePayload(req interface{}) ([]byte, error) {
+	return []byte(req.(string)), nil
+}
+
+func (h *testReplayHandler) DecodePayload(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+func (h *testReplayHandler) Check(req interface{}) error {
+	return nil
+}
+
+func (h *testReplayHandler) Commit(req interface{}, isLeader bool) (interface{}, error) {
+	h.committed = append(h.committed, req.(string))
+	if req.(string) == "fail" {
+		return nil, ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+func TestReplayWALLogs(t *testing.T) {
+	Convey("Given the archived logs of prepares and commits", t, func() {
+		var (
+			logs   []*kt.Log
+			commit = func(index, prepare uint64) *kt.Log {
+				data := make([]byte, 16)
+				binary.BigEndian.PutUint64(data, prepare)
+				return &kt.Log{LogHeader: kt.LogHeader{Index: index, Type: kt.LogCommit}, Data: data}
+			}
+			prepare = func(index uint64, payload string) *kt.Log {
+				return &kt.Log{LogHeader: kt.LogHeader{Index: index, Type: kt.LogPrepare}, Data: []byte(payload)}
+			}
+		)
+		logs = append(logs,
+			prepare(0, "a"), commit(1, 0),
+			prepare(2, "b"), prepare(3, "fail"), commit(4, 3), commit(5, 2),
+			prepare(6, "c"), &kt.Log{LogHeader: kt.LogHeader{Index: 7, Type: kt.LogRollback}, Data: commit(0, 6).Data},
+		)
+		rootDir, err := ioutil.TempDir("", "wal_replay_test_")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(rootDir)
+		wal, err := kl.NewLevelDBWal(filepath.Join(rootDir, KayakWalFileName))
+		So(err, ShouldBeNil)
+		defer wal.Close()
+
+		Convey("The commits after the applied index should be replayed in order", func() {
+			h := &testReplayHandler{}
+			last, err := replayWALLogs(wal, logs, 1, h)
+			So(err, ShouldBeNil)
+			So(last, ShouldEqual, 5)
+			So(h.committed, ShouldResemble, []string{"fail", "b"})
+			for _, l := range logs {
+				stored, err := wal.Get(l.Index)
+				So(err, ShouldBeNil)
+				So(stored.Data, ShouldResemble, l.Data)
+			}
+		})
+		Convey("The commit without archived prepare should fail the replay", func() {
+			_, err := replayWALLogs(wal, []*kt.Log{commit(1, 0)}, 0, &testReplayHandler{})
+			So(errors.Cause(err), ShouldEqual, kt.ErrInvalidLog)
+		})
+	})
+}
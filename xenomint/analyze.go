@@ -0,0 +1,70 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+)
+
+// The query planner statistics are replicated as ordinary writes: an ANALYZE statement sent in a
+// write request is executed by every replica at the same log position, e.g.:
+//
+//	ANALYZE;
+//	ANALYZE "orders";
+//
+// As all replicas hold the same data at that position, the resulting sqlite_stat tables are
+// identical and the query plans of the replicas stay the same. The statistics are included in the
+// state digest, so a replica with divergent statistics is detected like any other divergence.
+
+var analyzeRe = regexp.MustCompile(`(?i)^\s*analyze(\s+("[^"]*"|[\w.]+))?\s*;?\s*$`)
+
+// IsAnalyzeStatement reports whether the query pattern is a single ANALYZE statement.
+func IsAnalyzeStatement(pattern string) bool {
+	return analyzeRe.MatchString(pattern)
+}
+
+// analyze executes the ANALYZE statement and makes the new statistics visible to all readers.
+func (s *State) analyze(pattern string) (res sql.Result, err error) {
+	if res, err = s.handler.Exec(pattern); err != nil {
+		return
+	}
+	// Statistics are loaded with the schema, bump the schema version so that the reader
+	// connections reload the schema and plan with the new statistics.
+	var (
+		rows    *sql.Rows
+		version int64
+	)
+	if rows, err = s.handler.Query(`PRAGMA schema_version`); err != nil {
+		return
+	}
+	if rows.Next() {
+		err = rows.Scan(&version)
+	}
+	_ = rows.Close()
+	if err != nil {
+		return
+	}
+	if _, err = s.handler.Exec(fmt.Sprintf(`PRAGMA schema_version=%d`, version+1)); err != nil {
+		return
+	}
+	// commit at the end of the write like a schema change
+	atomic.StoreUint32(&s.hasSchemaChange, 1)
+	return
+}
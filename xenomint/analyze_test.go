@@ -0,0 +1,96 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+func TestAnalyze(t *testing.T) {
+	Convey("Given a leader state and a follower state", t, func() {
+		var (
+			fl1 = path.Join(testingDataDir, t.Name()+"-leader")
+			fl2 = path.Join(testingDataDir, t.Name()+"-follower")
+		)
+		strg1, err := xs.NewSqlite(fmt.Sprint("file:", fl1))
+		So(err, ShouldBeNil)
+		strg2, err := xs.NewSqlite(fmt.Sprint("file:", fl2))
+		So(err, ShouldBeNil)
+		leader := NewState(sql.LevelReadUncommitted, nodeID, strg1)
+		follower := NewState(sql.LevelReadUncommitted, nodeID, strg2)
+		Reset(func() {
+			So(leader.Close(true), ShouldBeNil)
+			So(follower.Close(true), ShouldBeNil)
+			for _, f := range []string{fl1, fl1 + "-shm", fl1 + "-wal", fl2, fl2 + "-shm", fl2 + "-wal"} {
+				err = os.Remove(f)
+				So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			}
+		})
+		var write = func(queries ...string) {
+			var qs []types.Query
+			for _, q := range queries {
+				qs = append(qs, buildQuery(q))
+			}
+			req := buildRequest(types.WriteQuery, qs)
+			_, resp, err := leader.Query(req, true)
+			So(err, ShouldBeNil)
+			So(follower.Replay(req, resp), ShouldBeNil)
+		}
+		write(`CREATE TABLE t1 (id INT, k TEXT, PRIMARY KEY(id))`, `CREATE INDEX t1_k ON t1 (k)`)
+		for i := 0; i < 10; i++ {
+			write(fmt.Sprintf(`INSERT INTO t1 VALUES (%d, '%c')`, i, 'a'+i%3))
+		}
+		Convey("The ANALYZE statement should produce the same statistics on all replicas", func() {
+			write(`ANALYZE`)
+			d1, err := leader.Digest()
+			So(err, ShouldBeNil)
+			d2, err := follower.Digest()
+			So(err, ShouldBeNil)
+			So(d1.Root, ShouldEqual, d2.Root)
+			var hasStats bool
+			for _, td := range d1.Tables {
+				if td.Table == "sqlite_stat1" {
+					hasStats = td.Rows > 0
+				}
+			}
+			So(hasStats, ShouldBeTrue)
+
+			// the statistics are visible to the readers
+			var stat string
+			err = follower.reader().QueryRow(
+				`SELECT stat FROM sqlite_stat1 WHERE idx = 't1_k'`).Scan(&stat)
+			So(err, ShouldBeNil)
+			So(stat, ShouldEqual, "10 4")
+		})
+		Convey("The ANALYZE statement should be recognized", func() {
+			So(IsAnalyzeStatement(`ANALYZE`), ShouldBeTrue)
+			So(IsAnalyzeStatement(` analyze "t1";`), ShouldBeTrue)
+			So(IsAnalyzeStatement(`ANALYZE main.t1`), ShouldBeTrue)
+			So(IsAnalyzeStatement(`ANALYZE t1; DROP TABLE t1`), ShouldBeFalse)
+			So(IsAnalyzeStatement(`SELECT 'analyze'`), ShouldBeFalse)
+		})
+	})
+}
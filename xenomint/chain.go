@@ -93,6 +93,12 @@ func (c *Chain) Query(req *types.Request) (resp *types.Response, err error) {
 	return
 }
 
+// Commit commits the pending writes of the local chain state to storage.
+func (c *Chain) Commit() (err error) {
+	_, _, err = c.state.CommitEx()
+	return
+}
+
 // Stop stops chain workers and RPC service.
 func (c *Chain) Stop() (err error) {
 	// Close all opened resources
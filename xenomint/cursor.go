@@ -0,0 +1,405 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+const (
+	cursorIDLen    = 16
+	pageTokenLen   = cursorIDLen + 8 + 8
+	maxPageRowSize = 10000
+)
+
+var (
+	// MaxCursors is the maximum number of open paginated reads of a state.
+	MaxCursors = 64
+	// MaxCursorsPerNode is the maximum number of open paginated reads of a single requester, so
+	// that a client streaming many result sets can not starve the others.
+	MaxCursorsPerNode = 16
+	// CursorIdleTimeout is the idle duration after which an open paginated read is released.
+	CursorIdleTimeout = time.Minute
+)
+
+type cursorID [cursorIDLen]byte
+
+// cursor holds an open read transaction and its result set, the following pages are read from
+// the same snapshot.
+type cursor struct {
+	sync.Mutex
+	id       cursorID
+	owner    proto.NodeID
+	height   uint64
+	seq      uint64
+	cancel   context.CancelFunc
+	tx       *sql.Tx
+	rows     *sql.Rows
+	names    []string
+	types    []string
+	pending  []interface{}
+	lastUsed time.Time
+	closed   bool
+}
+
+func (c *cursor) token() []byte {
+	var buf = make([]byte, pageTokenLen)
+	copy(buf, c.id[:])
+	binary.BigEndian.PutUint64(buf[cursorIDLen:], c.seq)
+	binary.BigEndian.PutUint64(buf[cursorIDLen+8:], c.height)
+	return buf
+}
+
+func parsePageToken(token []byte) (id cursorID, seq, height uint64, err error) {
+	if len(token) != pageTokenLen {
+		err = errors.Wrapf(ErrInvalidPageToken, "unexpected token length %d", len(token))
+		return
+	}
+	copy(id[:], token)
+	seq = binary.BigEndian.Uint64(token[cursorIDLen:])
+	height = binary.BigEndian.Uint64(token[cursorIDLen+8:])
+	return
+}
+
+// fetch reads at most n rows from the cursor, more reports whether there are rows left. The
+// result set outlives the request, so the running statement is interrupted by cancelling the
+// cursor if the request context is done before the page is read.
+func (c *cursor) fetch(ctx context.Context, n int) (data [][]interface{}, more bool, err error) {
+	var (
+		done        = make(chan struct{})
+		exited      = make(chan struct{})
+		interrupted bool
+	)
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			interrupted = true
+			c.cancel()
+		case <-done:
+		}
+	}()
+	defer func() {
+		close(done)
+		<-exited
+		if interrupted && err == nil {
+			err = ctx.Err()
+		}
+	}()
+
+	data = make([][]interface{}, 0, n)
+	if c.pending != nil {
+		data = append(data, c.pending)
+		c.pending = nil
+	}
+	for {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		if !c.rows.Next() {
+			err = c.rows.Err()
+			return
+		}
+		var (
+			row  = make([]interface{}, len(c.names))
+			dest = make([]interface{}, len(c.names))
+		)
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err = c.rows.Scan(dest...); err != nil {
+			return
+		}
+		if len(data) == n {
+			// keep the peeked row for the next page
+			c.pending = row
+			more = true
+			return
+		}
+		data = append(data, row)
+	}
+}
+
+func (c *cursor) close() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	_ = c.rows.Close()
+	_ = c.tx.Rollback()
+	c.cancel()
+}
+
+// cursorSet tracks the open paginated reads of a state.
+type cursorSet struct {
+	sync.Mutex
+	cursors map[cursorID]*cursor
+}
+
+func newCursorSet() *cursorSet {
+	return &cursorSet{
+		cursors: make(map[cursorID]*cursor),
+	}
+}
+
+// sweep releases the idle cursors, must be called within locking scope.
+func (s *cursorSet) sweep(now time.Time) {
+	for k, v := range s.cursors {
+		if now.Sub(v.lastUsed) > CursorIdleTimeout {
+			delete(s.cursors, k)
+			go func(c *cursor) {
+				c.Lock()
+				defer c.Unlock()
+				c.close()
+			}(v)
+		}
+	}
+}
+
+func (s *cursorSet) add(c *cursor) (err error) {
+	s.Lock()
+	defer s.Unlock()
+	s.sweep(c.lastUsed)
+	if len(s.cursors) >= MaxCursors {
+		return ErrTooManyCursors
+	}
+	var owned int
+	for _, v := range s.cursors {
+		if v.owner == c.owner {
+			owned++
+		}
+	}
+	if owned >= MaxCursorsPerNode {
+		return errors.Wrapf(ErrTooManyCursors, "%d cursors opened by %s", owned, c.owner)
+	}
+	for {
+		if _, err = rand.Read(c.id[:]); err != nil {
+			return
+		}
+		if _, ok := s.cursors[c.id]; !ok {
+			break
+		}
+	}
+	s.cursors[c.id] = c
+	return
+}
+
+func (s *cursorSet) get(id cursorID) (c *cursor, ok bool) {
+	s.Lock()
+	defer s.Unlock()
+	c, ok = s.cursors[id]
+	return
+}
+
+func (s *cursorSet) touch(c *cursor) {
+	s.Lock()
+	defer s.Unlock()
+	c.lastUsed = time.Now()
+}
+
+func (s *cursorSet) remove(id cursorID) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.cursors, id)
+}
+
+func (s *cursorSet) closeAll() {
+	s.Lock()
+	defer s.Unlock()
+	for k, v := range s.cursors {
+		delete(s.cursors, k)
+		v.Lock()
+		v.close()
+		v.Unlock()
+	}
+}
+
+// openCursor starts a paginated read of the query on a new read transaction. The transaction
+// and the result set are bound to the cursor context, which is cancelled as the cursor is closed
+// or its page read is interrupted by the request context.
+func (s *State) openCursor(ctx context.Context, req *types.Request) (c *cursor, err error) {
+	var (
+		q       = &req.Payload.Queries[0]
+		pattern string
+		args    []interface{}
+		cols    []*sql.ColumnType
+		cctx    context.Context
+	)
+	if _, pattern, args, err = convertQueryAndBuildArgs(q.Pattern, q.Args); err != nil {
+		return
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	c = &cursor{
+		owner:    req.Header.NodeID,
+		height:   s.getLastCommitPoint(),
+		lastUsed: time.Now(),
+	}
+	cctx, c.cancel = context.WithCancel(context.Background())
+	if c.tx, err = s.reader().BeginTx(cctx, nil); err != nil {
+		c.cancel()
+		err = errors.Wrap(err, "open tx failed")
+		return
+	}
+	if c.rows, err = c.tx.QueryContext(cctx, pattern, args...); err != nil {
+		_ = c.tx.Rollback()
+		c.cancel()
+		return
+	}
+	if c.names, err = c.rows.Columns(); err != nil {
+		c.close()
+		return
+	}
+	if cols, err = c.rows.ColumnTypes(); err != nil {
+		c.close()
+		return
+	}
+	c.types = buildTypeNamesFromSQLColumnTypes(cols)
+	if err = s.cursors.add(c); err != nil {
+		c.close()
+	}
+	return
+}
+
+// resumeCursor finds the cursor of the page token and checks that it belongs to the requester.
+func (s *State) resumeCursor(req *types.Request) (c *cursor, err error) {
+	var (
+		id          cursorID
+		seq, height uint64
+		ok          bool
+	)
+	if id, seq, height, err = parsePageToken(req.Page.Token); err != nil {
+		return
+	}
+	if c, ok = s.cursors.get(id); !ok {
+		err = errors.Wrap(ErrInvalidPageToken, "cursor not found or expired")
+		return
+	}
+	if c.owner != req.Header.NodeID || c.height != height {
+		err = errors.Wrap(ErrInvalidPageToken, "cursor not owned by requester")
+		c = nil
+		return
+	}
+	c.Lock()
+	if c.closed || c.seq != seq {
+		c.Unlock()
+		err = errors.Wrap(ErrInvalidPageToken, "page already consumed")
+		c = nil
+	}
+	return
+}
+
+// readPage serves a page of a paginated read. The first page opens a cursor on a read snapshot,
+// the following pages continue from the same snapshot until the result set is exhausted or the
+// cursor is closed by the requester.
+func (s *State) readPage(
+	ctx context.Context, req *types.Request) (ref *QueryTracker, resp *types.Response, err error,
+) {
+	var (
+		c    *cursor
+		data [][]interface{}
+		more bool
+		size = int(req.Page.Size)
+	)
+	if len(req.Payload.Queries) != 1 {
+		err = errors.Wrap(ErrInvalidRequest, "paginated read requires exactly one query")
+		return
+	}
+	if size > maxPageRowSize {
+		size = maxPageRowSize
+	}
+	if req.Page.Close && len(req.Page.Token) == 0 {
+		err = errors.Wrap(ErrInvalidPageToken, "no cursor to close")
+		return
+	}
+	if len(req.Page.Token) == 0 {
+		if c, err = s.openCursor(ctx, req); err != nil {
+			err = errors.Wrap(err, "open cursor failed")
+			s.Lock()
+			s.pool.setFailed(req)
+			s.Unlock()
+			return
+		}
+		c.Lock()
+	} else if c, err = s.resumeCursor(req); err != nil {
+		return
+	}
+	defer c.Unlock()
+
+	// a closing request reads no rows, the cursor is released below
+	if !req.Page.Close {
+		if data, more, err = c.fetch(ctx, size); err != nil {
+			s.cursors.remove(c.id)
+			c.close()
+			err = errors.Wrap(err, "fetch page failed")
+			s.Lock()
+			s.pool.setFailed(req)
+			s.Unlock()
+			return
+		}
+	}
+	resp = &types.Response{
+		Header: types.SignedResponseHeader{
+			ResponseHeader: types.ResponseHeader{
+				Request:     req.Header.RequestHeader,
+				RequestHash: req.Header.Hash(),
+				NodeID:      s.nodeID,
+				Timestamp:   s.getLocalTime(),
+				RowCount:    uint64(len(data)),
+				LogOffset:   c.height,
+			},
+		},
+		Payload: types.ResponsePayload{
+			Columns:    c.names,
+			DeclTypes:  c.types,
+			Rows:       buildRowsFromNativeData(data),
+			ColumnMeta: types.BuildColumnMeta(len(c.names), data),
+		},
+	}
+	if more {
+		c.seq++
+		s.cursors.touch(c)
+		resp.NextPage = c.token()
+	} else {
+		s.cursors.remove(c.id)
+		c.close()
+	}
+	log.WithFields(log.Fields{
+		"height": c.height,
+		"seq":    c.seq,
+		"rows":   len(data),
+		"more":   more,
+	}).Debug("served read page")
+
+	ref = &QueryTracker{Req: req}
+	s.Lock()
+	s.pool.enqueueRead(ref)
+	s.Unlock()
+	return
+}
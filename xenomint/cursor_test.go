@@ -0,0 +1,167 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+	xi "github.com/SQLess/SQLess/xenomint/interfaces"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+func TestReadPage(t *testing.T) {
+	Convey("Given a state with a table of 25 rows", t, func() {
+		var (
+			filePath = path.Join(testingDataDir, t.Name())
+			state    *State
+			storage  xi.Storage
+			resp     *types.Response
+			err      error
+			queries  = []types.Query{
+				buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+			}
+		)
+		storage, err = xs.NewSqlite(fmt.Sprint("file:", filePath))
+		So(err, ShouldBeNil)
+		state = NewState(sql.LevelSerializable, nodeID, storage)
+		Reset(func() {
+			err = state.Close(true)
+			So(err, ShouldBeNil)
+			err = os.Remove(filePath)
+			So(err, ShouldBeNil)
+			err = os.Remove(fmt.Sprint(filePath, "-shm"))
+			So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			err = os.Remove(fmt.Sprint(filePath, "-wal"))
+			So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+		})
+		for i := 0; i < 25; i++ {
+			queries = append(queries, buildQuery(
+				`INSERT INTO t1(k, v) VALUES (?, ?)`, i, fmt.Sprintf("v%d", i)))
+		}
+		_, _, err = state.Query(buildRequest(types.WriteQuery, queries), true)
+		So(err, ShouldBeNil)
+
+		var pageReq = func(token []byte) (req *types.Request) {
+			req = buildRequest(types.ReadQuery, []types.Query{
+				buildQuery(`SELECT k, v FROM t1 ORDER BY k`),
+			})
+			req.Page = types.PageRequest{Size: 10, Token: token}
+			return
+		}
+
+		Convey("The pages should be served from the snapshot of the first page", func() {
+			_, resp, err = state.Query(pageReq(nil), false)
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows, ShouldHaveLength, 10)
+			So(resp.Payload.Columns, ShouldResemble, []string{"k", "v"})
+			So(resp.NextPage, ShouldNotBeEmpty)
+			var token = resp.NextPage
+
+			// writes after the first page are not visible to the following pages
+			_, _, err = state.Query(buildRequest(types.WriteQuery, []types.Query{
+				buildQuery(`INSERT INTO t1(k, v) VALUES (?, ?)`, 100, "v100"),
+			}), true)
+			So(err, ShouldBeNil)
+
+			_, resp, err = state.Query(pageReq(token), false)
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows, ShouldHaveLength, 10)
+			So(resp.Payload.Rows[0].Values[0], ShouldEqual, int64(10))
+			So(resp.NextPage, ShouldNotBeEmpty)
+
+			// a consumed token can not be replayed
+			_, _, err = state.Query(pageReq(token), false)
+			So(err, ShouldNotBeNil)
+
+			_, resp, err = state.Query(pageReq(resp.NextPage), false)
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows, ShouldHaveLength, 5)
+			So(resp.NextPage, ShouldBeEmpty)
+			So(state.cursors.cursors, ShouldBeEmpty)
+		})
+		Convey("The cursor should be released by the closing request", func() {
+			_, resp, err = state.Query(pageReq(nil), false)
+			So(err, ShouldBeNil)
+			So(state.cursors.cursors, ShouldHaveLength, 1)
+			var req = pageReq(resp.NextPage)
+			req.Page.Close = true
+			_, resp, err = state.Query(req, false)
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows, ShouldBeEmpty)
+			So(resp.NextPage, ShouldBeEmpty)
+			So(state.cursors.cursors, ShouldBeEmpty)
+
+			req = pageReq(nil)
+			req.Page.Close = true
+			_, _, err = state.Query(req, false)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("The open cursors of a single requester should be limited", func() {
+			for i := 0; i < MaxCursorsPerNode; i++ {
+				_, _, err = state.Query(pageReq(nil), false)
+				So(err, ShouldBeNil)
+			}
+			_, _, err = state.Query(pageReq(nil), false)
+			So(errors.Cause(err), ShouldEqual, ErrTooManyCursors)
+			state.cursors.closeAll()
+		})
+		Convey("The cursor should outlive the request context of its page", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			_, resp, err = state.QueryWithContext(ctx, pageReq(nil), false)
+			cancel()
+			So(err, ShouldBeNil)
+			So(resp.NextPage, ShouldNotBeEmpty)
+			_, resp, err = state.Query(pageReq(resp.NextPage), false)
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows, ShouldHaveLength, 10)
+
+			Convey("The cursor should be released if the page request is cancelled", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				_, _, err = state.QueryWithContext(ctx, pageReq(resp.NextPage), false)
+				So(err, ShouldNotBeNil)
+				So(state.cursors.cursors, ShouldBeEmpty)
+				_, _, err = state.QueryWithContext(ctx, pageReq(nil), false)
+				So(err, ShouldNotBeNil)
+				So(state.cursors.cursors, ShouldBeEmpty)
+			})
+		})
+		Convey("The malformed or unknown tokens should be rejected", func() {
+			_, _, err = state.Query(pageReq([]byte("bad")), false)
+			So(err, ShouldNotBeNil)
+			_, _, err = state.Query(pageReq(make([]byte, pageTokenLen)), false)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("The open cursors should be released by the state closing", func() {
+			_, resp, err = state.Query(pageReq(nil), false)
+			So(err, ShouldBeNil)
+			So(state.cursors.cursors, ShouldHaveLength, 1)
+			state.cursors.closeAll()
+			_, _, err = state.Query(pageReq(resp.NextPage), false)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
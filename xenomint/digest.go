@@ -0,0 +1,200 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+)
+
+type digestQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// DigestSnapshot is a read snapshot of the state pinned at a write sequence, the digest of
+// which can be computed without blocking the writes.
+type DigestSnapshot struct {
+	Seq uint64
+	tx  *sql.Tx
+}
+
+// Digest computes the digest of the pinned snapshot and releases it.
+func (snap *DigestSnapshot) Digest() (d *types.StateDigest, err error) {
+	defer snap.Release()
+	return computeDigest(snap.tx, snap.Seq)
+}
+
+// Release releases the pinned snapshot.
+func (snap *DigestSnapshot) Release() {
+	_ = snap.tx.Rollback()
+}
+
+// PinDigest commits the ongoing transaction and pins a read snapshot of the current state, the
+// caller should compute its digest or release it.
+func (s *State) PinDigest(ctx context.Context) (snap *DigestSnapshot, err error) {
+	var (
+		tx  *sql.Tx
+		seq uint64
+	)
+	if tx, seq, err = s.pinSnapshot(ctx, nil); err != nil {
+		return
+	}
+	snap = &DigestSnapshot{Seq: seq, tx: tx}
+	return
+}
+
+// pinSnapshot commits the ongoing transaction and begins a read transaction pinned at the
+// current write sequence. The onPin callback, if any, is called while the writes are blocked, so
+// that the caller can read its own state consistently with the snapshot.
+func (s *State) pinSnapshot(ctx context.Context, onPin func()) (
+	tx *sql.Tx, seq uint64, err error,
+) {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		err = ErrStateClosed
+		return
+	}
+	s.commitHandler()
+	defer s.openHandler()
+	if tx, err = s.strg.Reader().BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err != nil {
+		return
+	}
+	// sqlite starts the read transaction lazily, read once to pin the snapshot
+	var count int
+	if err = tx.QueryRowContext(
+		ctx, `SELECT COUNT(*) FROM "sqlite_master"`).Scan(&count); err != nil {
+		_ = tx.Rollback()
+		tx = nil
+		return
+	}
+	seq = s.getSeq()
+	if onPin != nil {
+		onPin()
+	}
+	return
+}
+
+// Digest computes the deterministic digest of the current state including uncommitted writes,
+// tables are hashed row by row in full column order. The sqlite_stat tables of the query planner
+// statistics are included, other sqlite internal tables are not.
+func (s *State) Digest() (d *types.StateDigest, err error) {
+	s.Lock()
+	defer s.Unlock()
+	return computeDigest(s.handler, s.getSeq())
+}
+
+func computeDigest(q digestQuerier, seq uint64) (d *types.StateDigest, err error) {
+	var (
+		tables []string
+		rows   *sql.Rows
+	)
+	if rows, err = q.Query(`SELECT "name" FROM "sqlite_master" ` +
+		`WHERE "type"='table' AND ("name" NOT LIKE 'sqlite\_%' ESCAPE '\' ` +
+		`OR "name" LIKE 'sqlite\_stat%' ESCAPE '\') ` +
+		`ORDER BY "name"`); err != nil {
+		return
+	}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return
+		}
+		tables = append(tables, name)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	d = &types.StateDigest{
+		Seq:    seq,
+		Tables: make([]types.TableDigest, 0, len(tables)),
+	}
+	var root bytes.Buffer
+	for _, t := range tables {
+		var td *types.TableDigest
+		if td, err = digestTable(q, t); err != nil {
+			err = errors.Wrapf(err, "digest table %s", t)
+			return
+		}
+		d.Tables = append(d.Tables, *td)
+		root.WriteString(t)
+		root.Write(td.Hash[:])
+	}
+	d.Root = hash.THashH(root.Bytes())
+	return
+}
+
+func digestTable(q digestQuerier, table string) (td *types.TableDigest, err error) {
+	var (
+		quoted  = `"` + strings.Replace(table, `"`, `""`, -1) + `"`
+		rows    *sql.Rows
+		columns []string
+	)
+	if rows, err = q.Query("SELECT * FROM " + quoted + " LIMIT 0"); err != nil {
+		return
+	}
+	columns, err = rows.Columns()
+	_ = rows.Close()
+	if err != nil {
+		return
+	}
+	var order = make([]string, len(columns))
+	for i := range order {
+		order[i] = fmt.Sprint(i + 1)
+	}
+	if rows, err = q.Query(
+		"SELECT * FROM " + quoted + " ORDER BY " + strings.Join(order, ","),
+	); err != nil {
+		return
+	}
+	defer rows.Close()
+
+	var (
+		values = make([]interface{}, len(columns))
+		dests  = make([]interface{}, len(columns))
+		buf    *bytes.Buffer
+	)
+	for i := range values {
+		dests[i] = &values[i]
+	}
+	td = &types.TableDigest{Table: table}
+	for rows.Next() {
+		if err = rows.Scan(dests...); err != nil {
+			return
+		}
+		if buf, err = utils.EncodeMsgPack(values); err != nil {
+			return
+		}
+		// chain row hashes so the digest depends on both content and order
+		td.Hash = hash.THashH(append(td.Hash[:], buf.Bytes()...))
+		td.Rows++
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+	xi "github.com/SQLess/SQLess/xenomint/interfaces"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+func TestStateDigest(t *testing.T) {
+	Convey("Given two replica states", t, func() {
+		var (
+			states = make([]*State, 2)
+			err    error
+		)
+		for i := range states {
+			var (
+				fl   = path.Join(testingDataDir, fmt.Sprint(t.Name(), i))
+				strg xi.Storage
+			)
+			strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+			So(err, ShouldBeNil)
+			st := NewState(sql.LevelReadUncommitted, nodeID, strg)
+			states[i] = st
+			Reset(func() {
+				So(st.Close(true), ShouldBeNil)
+				for _, f := range []string{fl, fl + "-shm", fl + "-wal"} {
+					err = os.Remove(f)
+					So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+				}
+			})
+		}
+		var write = func(st *State, queries ...string) {
+			var qs []types.Query
+			for _, q := range queries {
+				qs = append(qs, buildQuery(q))
+			}
+			_, _, err := st.Query(buildRequest(types.WriteQuery, qs), true)
+			So(err, ShouldBeNil)
+		}
+		for _, st := range states {
+			write(st, `CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`)
+			write(st, `INSERT INTO t1 VALUES (1, 'a')`, `INSERT INTO t1 VALUES (2, 'b')`)
+		}
+		Convey("The digests should be equal after the same writes", func() {
+			d1, err := states[0].Digest()
+			So(err, ShouldBeNil)
+			d2, err := states[1].Digest()
+			So(err, ShouldBeNil)
+			So(d1.Seq, ShouldEqual, 3)
+			So(d1, ShouldResemble, d2)
+			So(d1.Tables, ShouldHaveLength, 1)
+			So(d1.Tables[0].Rows, ShouldEqual, 2)
+		})
+		Convey("The digests should differ if a replica diverges", func() {
+			write(states[0], `UPDATE t1 SET v='x' WHERE k=2`)
+			write(states[1], `UPDATE t1 SET v='y' WHERE k=2`)
+			d1, err := states[0].Digest()
+			So(err, ShouldBeNil)
+			d2, err := states[1].Digest()
+			So(err, ShouldBeNil)
+			So(d1.Seq, ShouldEqual, d2.Seq)
+			So(d1.Root, ShouldNotResemble, d2.Root)
+			So(d1.Tables[0].Hash, ShouldNotResemble, d2.Tables[0].Hash)
+		})
+		Convey("The pinned snapshot digest should not see the later writes", func() {
+			expected, err := states[0].Digest()
+			So(err, ShouldBeNil)
+			snap, err := states[0].PinDigest(context.Background())
+			So(err, ShouldBeNil)
+			So(snap.Seq, ShouldEqual, expected.Seq)
+			write(states[0], `INSERT INTO t1 VALUES (3, 'c')`)
+			d, err := snap.Digest()
+			So(err, ShouldBeNil)
+			So(d, ShouldResemble, expected)
+			latest, err := states[0].Digest()
+			So(err, ShouldBeNil)
+			So(latest.Seq, ShouldEqual, expected.Seq+1)
+			So(latest.Tables[0].Rows, ShouldEqual, 3)
+		})
+	})
+}
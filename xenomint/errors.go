@@ -33,4 +33,16 @@ var (
 	ErrStatefulQueryParts = errors.New("query contains stateful query parts")
 	// ErrInvalidTableName indicates query contains invalid table name in ddl statement.
 	ErrInvalidTableName = errors.New("invalid table name in ddl")
+	// ErrTooManyRows indicates too many rows are requested to be digested row by row.
+	ErrTooManyRows = errors.New("too many rows to digest")
+	// ErrInvalidPageToken indicates the page token is malformed, expired or not owned by the requester.
+	ErrInvalidPageToken = errors.New("invalid page token")
+	// ErrTooManyCursors indicates the open paginated reads reach the limit of the state.
+	ErrTooManyCursors = errors.New("too many open cursors")
+	// ErrStateClosed indicates the state is already closed.
+	ErrStateClosed = errors.New("state is closed")
+	// ErrRekeyInProgress indicates there is already a rekey running on the state.
+	ErrRekeyInProgress = errors.New("rekey already in progress")
+	// ErrInvalidMaterializedView indicates the view query could not be maintained incrementally.
+	ErrInvalidMaterializedView = errors.New("invalid materialized view")
 )
@@ -0,0 +1,58 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+)
+
+// FirewallOverridesTable defines the table of the sql firewall rules allowed by the database
+// owner. Overrides are written as ordinary replicated writes, e.g.:
+//
+//	CREATE TABLE IF NOT EXISTS "__sqless_firewall" ("rule" TEXT PRIMARY KEY);
+//	INSERT INTO "__sqless_firewall" VALUES ('collation-unicode_ci');
+//
+// As all replicas apply the same writes in the same order, every replica checks the statements
+// against the same overrides.
+const FirewallOverridesTable = "__sqless_firewall"
+
+// FirewallOverrides returns the firewall rules allowed by the database owner in the committed
+// state, sorted by name.
+func (s *State) FirewallOverrides(ctx context.Context) (rules []string, err error) {
+	return firewallOverrides(ctx, s.storage().Reader())
+}
+
+func firewallOverrides(ctx context.Context, db *sql.DB) (rules []string, err error) {
+	var rows *sql.Rows
+	if rows, err = db.QueryContext(ctx, `SELECT "rule" FROM `+
+		quoteIdentifier(FirewallOverridesTable)+` ORDER BY "rule"`); err != nil {
+		// overrides table is not created yet
+		err = nil
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var rule string
+		if err = rows.Scan(&rule); err != nil {
+			return
+		}
+		rules = append(rules, rule)
+	}
+	err = rows.Err()
+	return
+}
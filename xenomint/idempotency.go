@@ -0,0 +1,100 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+// IdempotencyTable defines the system table of the idempotency keys of the applied write
+// requests. The key is recorded in the same transaction as the write, and all replicas apply
+// the same writes in the same order, so a retry is deduplicated on every replica even after a
+// leader failover.
+const IdempotencyTable = "__sqless_idempotency"
+
+// IdempotencyTTL is how long the idempotency key of a write request is kept, counted from the
+// timestamp of the request so that all replicas expire the same keys.
+var IdempotencyTTL = 10 * time.Minute
+
+// appliedWrite defines the recorded result of a write request with an idempotency key.
+type appliedWrite struct {
+	logOffset    uint64
+	affectedRows int64
+	lastInsertID int64
+}
+
+func idempotencyKey(req *types.Request) string {
+	return string(req.Header.NodeID) + "/" + req.IdempotencyKey
+}
+
+// ensureIdempotencyTable creates the idempotency table if not exists.
+func (s *State) ensureIdempotencyTable() (err error) {
+	if _, err = s.handler.Exec(`CREATE TABLE IF NOT EXISTS ` + quoteIdentifier(IdempotencyTable) +
+		` ("key" TEXT PRIMARY KEY, "expires" INTEGER NOT NULL, "log_offset" INTEGER NOT NULL,` +
+		` "affected_rows" INTEGER NOT NULL, "last_insert_id" INTEGER NOT NULL)`); err != nil {
+		return errors.Wrap(err, "create idempotency table failed")
+	}
+	if _, err = s.handler.Exec(`CREATE INDEX IF NOT EXISTS ` +
+		quoteIdentifier(IdempotencyTable+"_expires") + ` ON ` + quoteIdentifier(IdempotencyTable) +
+		` ("expires")`); err != nil {
+		return errors.Wrap(err, "create idempotency index failed")
+	}
+	return
+}
+
+// loadAppliedWrite returns the result of the applied write with the idempotency key of the
+// request, the expired keys are ignored.
+func (s *State) loadAppliedWrite(req *types.Request) (w *appliedWrite, err error) {
+	rows, err := s.handler.Query(`SELECT "log_offset", "affected_rows", "last_insert_id" FROM `+
+		quoteIdentifier(IdempotencyTable)+` WHERE "key"=? AND "expires">=?`,
+		idempotencyKey(req), req.Header.Timestamp.UnixNano())
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	if rows.Next() {
+		w = &appliedWrite{}
+		if err = rows.Scan(&w.logOffset, &w.affectedRows, &w.lastInsertID); err != nil {
+			return nil, err
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// recordAppliedWrite records the idempotency key of the applied write and drops the keys
+// expired before the request.
+func (s *State) recordAppliedWrite(req *types.Request, w *appliedWrite) (err error) {
+	var (
+		table = quoteIdentifier(IdempotencyTable)
+		ts    = req.Header.Timestamp
+	)
+	if _, err = s.handler.Exec(`DELETE FROM `+table+` WHERE "expires"<?`, ts.UnixNano()); err != nil {
+		return errors.Wrap(err, "expire idempotency keys failed")
+	}
+	if _, err = s.handler.Exec(`INSERT OR REPLACE INTO `+table+` VALUES (?, ?, ?, ?, ?)`,
+		idempotencyKey(req), ts.Add(IdempotencyTTL).UnixNano(),
+		w.logOffset, w.affectedRows, w.lastInsertID,
+	); err != nil {
+		return errors.Wrap(err, "record idempotency key failed")
+	}
+	return
+}
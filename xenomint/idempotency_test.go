@@ -0,0 +1,125 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/types"
+	xi "github.com/SQLess/SQLess/xenomint/interfaces"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+func TestIdempotentWrites(t *testing.T) {
+	Convey("Given a leader state and a replica state", t, func() {
+		var (
+			fl1 = path.Join(testingDataDir, t.Name()+"-1")
+			fl2 = path.Join(testingDataDir, t.Name()+"-2")
+			st  = make([]*State, 2)
+			err error
+		)
+		for i, fl := range []string{fl1, fl2} {
+			var strg xi.Storage
+			strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+			So(err, ShouldBeNil)
+			st[i] = NewState(sql.LevelReadUncommitted, nodeID, strg)
+		}
+		Reset(func() {
+			for i, fl := range []string{fl1, fl2} {
+				So(st[i].Close(true), ShouldBeNil)
+				for _, f := range []string{fl, fl + "-shm", fl + "-wal"} {
+					err = os.Remove(f)
+					So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+				}
+			}
+		})
+		var (
+			newReq = func(node proto.NodeID, key string, ts time.Time) *types.Request {
+				req := buildRequest(types.WriteQuery, []types.Query{
+					buildQuery(`INSERT INTO t1 (v) VALUES (1)`),
+				})
+				req.Header.NodeID = node
+				req.Header.Timestamp = ts
+				req.IdempotencyKey = key
+				return req
+			}
+			count = func(s *State) (n int) {
+				rows, err := s.handler.Query(`SELECT COUNT(*) FROM t1`)
+				So(err, ShouldBeNil)
+				defer rows.Close()
+				So(rows.Next(), ShouldBeTrue)
+				So(rows.Scan(&n), ShouldBeNil)
+				return
+			}
+			now = time.Now()
+		)
+		for _, s := range st {
+			_, _, err = s.Query(buildRequest(types.WriteQuery, []types.Query{
+				buildQuery(`CREATE TABLE t1 (id INTEGER PRIMARY KEY, v INT)`),
+			}), true)
+			So(err, ShouldBeNil)
+		}
+
+		Convey("The retried write should be applied once on every replica", func() {
+			_, resp, err := st[0].Query(newReq("node", "k1", now), true)
+			So(err, ShouldBeNil)
+			So(resp.Header.AffectedRows, ShouldEqual, 1)
+			// the replica applies the committed write and the retry
+			So(st[1].Replay(newReq("node", "k1", now), resp), ShouldBeNil)
+
+			for _, s := range st {
+				_, retry, err := s.Query(newReq("node", "k1", now.Add(time.Second)), true)
+				So(err, ShouldBeNil)
+				So(retry.Header.LogOffset, ShouldEqual, resp.Header.LogOffset)
+				So(retry.Header.AffectedRows, ShouldEqual, 1)
+				So(retry.Header.LastInsertID, ShouldEqual, resp.Header.LastInsertID)
+				So(count(s), ShouldEqual, 1)
+			}
+		})
+		Convey("The same key of other nodes should be applied", func() {
+			_, _, err := st[0].Query(newReq("node", "k2", now), true)
+			So(err, ShouldBeNil)
+			_, _, err = st[0].Query(newReq("other", "k2", now), true)
+			So(err, ShouldBeNil)
+			So(count(st[0]), ShouldEqual, 2)
+		})
+		Convey("The expired key should be applied again", func() {
+			_, _, err := st[0].Query(newReq("node", "k3", now), true)
+			So(err, ShouldBeNil)
+			_, _, err = st[0].Query(newReq("node", "k3", now.Add(IdempotencyTTL+time.Second)), true)
+			So(err, ShouldBeNil)
+			So(count(st[0]), ShouldEqual, 2)
+		})
+		Convey("The failed write should not record the key", func() {
+			req := newReq("node", "k4", now)
+			req.Payload.Queries = append(req.Payload.Queries, buildQuery(`INSERT INTO t2 VALUES (1)`))
+			_, _, err := st[0].Query(req, true)
+			So(err, ShouldNotBeNil)
+			_, _, err = st[0].Query(newReq("node", "k4", now), true)
+			So(err, ShouldBeNil)
+			So(count(st[0]), ShouldEqual, 1)
+		})
+	})
+}
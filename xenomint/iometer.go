@@ -0,0 +1,69 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"database/sql"
+
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// ioCounter is a snapshot of the storage counters which the i/o of a write is measured by.
+type ioCounter struct {
+	changes uint64 // rows changed by the handler connection, including those changed by triggers
+	bytes   uint64 // size of the database seen by the handler, including uncommitted pages
+}
+
+func (s *State) readIOCounter() (c ioCounter, err error) {
+	rows, err := s.handler.Query(`SELECT total_changes(), ` +
+		`(SELECT "page_count" FROM pragma_page_count()) * (SELECT "page_size" FROM pragma_page_size())`)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	if rows.Next() {
+		err = rows.Scan(&c.changes, &c.bytes)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	return
+}
+
+// meterWrite records the i/o done by the queries since the before counter in the tracker: each
+// query and each row it changed at the storage is counted as one write operation, and the bytes
+// written are measured by the growth of the database, so that a small payload which writes much,
+// e.g. INSERT ... SELECT or randomblob(), is metered by what it actually writes.
+//
+// The rows changed by triggers are only counted if the handler is a single transaction, otherwise
+// the counter may be read from another connection of the pool and the affected rows are used.
+func (s *State) meterWrite(query *QueryTracker, qcnt int, affected int64, before ioCounter) {
+	after, err := s.readIOCounter()
+	if err != nil {
+		log.WithError(err).Debug("failed to meter write i/o")
+		return
+	}
+	query.IOOps = uint64(qcnt)
+	if s.level == sql.LevelReadUncommitted && after.changes > before.changes {
+		query.IOOps += after.changes - before.changes
+	} else if affected > 0 {
+		query.IOOps += uint64(affected)
+	}
+	if after.bytes > before.bytes {
+		query.IOBytes = after.bytes - before.bytes
+	}
+}
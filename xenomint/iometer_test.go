@@ -0,0 +1,73 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+	xi "github.com/SQLess/SQLess/xenomint/interfaces"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+func TestMeterWrite(t *testing.T) {
+	Convey("Given a state with a table", t, func() {
+		var (
+			fl   = path.Join(testingDataDir, t.Name())
+			strg xi.Storage
+			err  error
+		)
+		strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st := NewState(sql.LevelReadUncommitted, nodeID, strg)
+		Reset(func() {
+			So(st.Close(true), ShouldBeNil)
+			for _, f := range []string{fl, fl + "-shm", fl + "-wal"} {
+				err = os.Remove(f)
+				So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			}
+		})
+		_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+			buildQuery(`CREATE TABLE t (v BLOB)`),
+			buildQuery(`INSERT INTO t VALUES (x'00')`),
+		}), true)
+		So(err, ShouldBeNil)
+
+		Convey("A small payload should be metered by what it writes", func() {
+			tracker, _, err := st.Query(buildRequest(types.WriteQuery, []types.Query{
+				buildQuery(`INSERT INTO t SELECT randomblob(1000000) FROM t`),
+			}), true)
+			So(err, ShouldBeNil)
+			So(tracker.IOOps, ShouldEqual, 2)
+			So(tracker.IOBytes, ShouldBeGreaterThanOrEqualTo, 1000000)
+
+			tracker, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+				buildQuery(`INSERT INTO t SELECT v FROM t`),
+				buildQuery(`INSERT INTO t SELECT v FROM t`),
+			}), true)
+			So(err, ShouldBeNil)
+			So(tracker.IOOps, ShouldEqual, 2+2+4)
+			So(tracker.IOBytes, ShouldBeGreaterThanOrEqualTo, 3000000)
+		})
+	})
+}
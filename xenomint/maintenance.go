@@ -0,0 +1,51 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+)
+
+// MaintenanceTable defines the table of the read-only maintenance mode switched by the database
+// owner. The mode is written as an ordinary replicated write, e.g.:
+//
+//	CREATE TABLE IF NOT EXISTS "__sqless_maintenance" ("enabled" BOOLEAN, "reason" TEXT, "since" TEXT);
+//	DELETE FROM "__sqless_maintenance";
+//	INSERT INTO "__sqless_maintenance" VALUES (1, 'schema migration', '2019-01-01T00:00:00Z');
+//
+// As all replicas apply the same writes in the same order, every replica agrees on the mode.
+const MaintenanceTable = "__sqless_maintenance"
+
+// Maintenance returns the read-only maintenance mode switched by the database owner in the
+// committed state.
+func (s *State) Maintenance(ctx context.Context) (enabled bool, reason string, err error) {
+	return maintenance(ctx, s.storage().Reader())
+}
+
+func maintenance(ctx context.Context, db *sql.DB) (enabled bool, reason string, err error) {
+	var nullReason sql.NullString
+	err = db.QueryRowContext(ctx, `SELECT "enabled", "reason" FROM `+
+		quoteIdentifier(MaintenanceTable)+` LIMIT 1`).Scan(&enabled, &nullReason)
+	if err != nil {
+		// maintenance table is not created yet or is empty
+		err = nil
+		return
+	}
+	reason = nullReason.String
+	return
+}
@@ -0,0 +1,410 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/SQLess/sqlparser"
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/utils/log"
+)
+
+// MaterializedViewsTable defines the table of materialized view definitions. Definitions are
+// written as ordinary replicated writes, e.g.:
+//
+//	CREATE TABLE IF NOT EXISTS "__sqless_matviews" ("name" TEXT PRIMARY KEY, "query" TEXT);
+//	INSERT INTO "__sqless_matviews" VALUES ('daily_sales',
+//	    'SELECT day, SUM(amount) AS total FROM sales GROUP BY day');
+//
+// The view query is an aggregate over a single source table grouped by plain columns, which
+// are selected as view columns. The view table is built from the query once the definition is
+// written, and then maintained incrementally by triggers on the source table: a write only
+// recomputes the groups of the rows it changes. As the triggers run in the replicated writes,
+// the view contents are deterministic across replicas.
+const MaterializedViewsTable = "__sqless_matviews"
+
+// MaterializedViewObjectPrefix prefixes the names of the triggers and indexes which maintain
+// the materialized views.
+const MaterializedViewObjectPrefix = "__sqless_matview_"
+
+// materializedView defines a materialized view and the source table it depends on.
+type materializedView struct {
+	name    string
+	query   string
+	source  string
+	groups  []string // group columns of the source table
+	columns []string // view columns of the groups
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// ValidateMaterializedView returns an error if the view query could not be maintained
+// incrementally.
+func ValidateMaterializedView(query string) (err error) {
+	_, err = parseMaterializedView("", query)
+	return
+}
+
+func parseMaterializedView(name, query string) (v *materializedView, err error) {
+	var statements []sqlparser.Statement
+	if _, statements, err = sqlparser.ParseMultiple(sqlparser.NewStringTokenizer(query)); err != nil {
+		err = errors.Wrap(ErrInvalidMaterializedView, err.Error())
+		return
+	}
+	if len(statements) != 1 {
+		err = errors.Wrap(ErrInvalidMaterializedView, "expect a single select query")
+		return
+	}
+	sel, ok := statements[0].(*sqlparser.Select)
+	if !ok {
+		err = errors.Wrap(ErrInvalidMaterializedView, "expect a single select query")
+		return
+	}
+	if sel.Distinct != "" || sel.Limit != nil {
+		err = errors.Wrap(ErrInvalidMaterializedView, "distinct and limit are not supported")
+		return
+	}
+	var table sqlparser.TableName
+	if len(sel.From) == 1 {
+		if t, ok := sel.From[0].(*sqlparser.AliasedTableExpr); ok {
+			table, _ = t.Expr.(sqlparser.TableName)
+		}
+	}
+	if table.IsEmpty() {
+		err = errors.Wrap(ErrInvalidMaterializedView, "expect a single source table")
+		return
+	}
+	// the tables read by subqueries are not tracked
+	if err = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+		if _, ok := node.(*sqlparser.Subquery); ok {
+			return false, errors.Wrap(ErrInvalidMaterializedView, "subqueries are not supported")
+		}
+		return true, nil
+	}, sel); err != nil {
+		return
+	}
+	if len(sel.GroupBy) == 0 {
+		err = errors.Wrap(ErrInvalidMaterializedView, "expect group by columns")
+		return
+	}
+	v = &materializedView{name: name, query: query, source: table.Name.String()}
+	for _, g := range sel.GroupBy {
+		col, ok := g.(*sqlparser.ColName)
+		if !ok {
+			err = errors.Wrapf(ErrInvalidMaterializedView, "group by %s is not a column",
+				sqlparser.String(g))
+			return
+		}
+		var column string
+		for _, e := range sel.SelectExprs {
+			if ae, ok := e.(*sqlparser.AliasedExpr); ok {
+				if c, ok := ae.Expr.(*sqlparser.ColName); ok && c.Name.Equal(col.Name) {
+					if column = c.Name.String(); !ae.As.IsEmpty() {
+						column = ae.As.String()
+					}
+					break
+				}
+			}
+		}
+		if column == "" {
+			err = errors.Wrapf(ErrInvalidMaterializedView, "group column %s is not selected",
+				col.Name.String())
+			return
+		}
+		v.groups = append(v.groups, col.Name.String())
+		v.columns = append(v.columns, column)
+	}
+	return
+}
+
+// objectName returns the name of a maintaining object, which is bound to the view definition.
+func (v *materializedView) objectName(kind string) string {
+	var h = hash.THashH([]byte(v.name + "\x00" + v.query))
+	return MaterializedViewObjectPrefix + v.name + "_" + h.String()[:16] + "_" + kind
+}
+
+// objects returns the maintaining objects of the view, mapping the names to the types.
+func (v *materializedView) objects() map[string]string {
+	return map[string]string{
+		v.objectName("key"):    "index",
+		v.objectName("source"): "index",
+		v.objectName("insert"): "trigger",
+		v.objectName("delete"): "trigger",
+		v.objectName("update"): "trigger",
+		v.objectName("move"):   "trigger",
+	}
+}
+
+// recompute returns the statements which recompute the group of the row, row is either NEW or
+// OLD in the triggers. The condition on the group columns is pushed down into the aggregate
+// query by sqlite, so only the rows of the group are scanned through the source index.
+func (v *materializedView) recompute(row string) string {
+	var conds = make([]string, len(v.groups))
+	for i := range v.groups {
+		conds[i] = quoteIdentifier(v.columns[i]) + ` IS ` + row + `.` + quoteIdentifier(v.groups[i])
+	}
+	var where = strings.Join(conds, ` AND `)
+	return `DELETE FROM ` + quoteIdentifier(v.name) + ` WHERE ` + where + `;` +
+		`INSERT INTO ` + quoteIdentifier(v.name) + ` SELECT * FROM (` + v.query + `) WHERE ` +
+		where + `;`
+}
+
+// buildView creates or refills the view table and creates the indexes of the view.
+func (s *State) buildView(v *materializedView) (err error) {
+	var atomicBuild = s.level == sql.LevelReadUncommitted
+	if atomicBuild {
+		if _, err = s.handler.Exec(`SAVEPOINT "matview"`); err != nil {
+			return
+		}
+		defer func() {
+			if err != nil {
+				_, _ = s.handler.Exec(`ROLLBACK TO "matview"`)
+			}
+			_, _ = s.handler.Exec(`RELEASE SAVEPOINT "matview"`)
+		}()
+	}
+	var (
+		table  = quoteIdentifier(v.name)
+		exists bool
+	)
+	if exists, err = s.hasSchemaObject("table", v.name); err != nil {
+		return
+	}
+	if exists {
+		if _, err = s.handler.Exec(`DELETE FROM ` + table); err != nil {
+			return
+		}
+		_, err = s.handler.Exec(`INSERT INTO ` + table + ` SELECT * FROM (` + v.query + `)`)
+	} else {
+		_, err = s.handler.Exec(`CREATE TABLE ` + table + ` AS ` + v.query)
+	}
+	if err != nil {
+		return
+	}
+	var columns, groups = make([]string, len(v.groups)), make([]string, len(v.groups))
+	for i := range v.groups {
+		columns[i] = quoteIdentifier(v.columns[i])
+		groups[i] = quoteIdentifier(v.groups[i])
+	}
+	if _, err = s.handler.Exec(`CREATE INDEX IF NOT EXISTS ` + quoteIdentifier(v.objectName("key")) +
+		` ON ` + table + ` (` + strings.Join(columns, `, `) + `)`); err != nil {
+		return
+	}
+	_, err = s.handler.Exec(`CREATE INDEX IF NOT EXISTS ` + quoteIdentifier(v.objectName("source")) +
+		` ON ` + quoteIdentifier(v.source) + ` (` + strings.Join(groups, `, `) + `)`)
+	return
+}
+
+// installTriggers creates the triggers which maintain the view on the writes of its source.
+func (s *State) installTriggers(v *materializedView) (err error) {
+	var (
+		source = quoteIdentifier(v.source)
+		moved  = make([]string, len(v.groups))
+	)
+	for i, g := range v.groups {
+		moved[i] = `NEW.` + quoteIdentifier(g) + ` IS NOT OLD.` + quoteIdentifier(g)
+	}
+	for _, q := range []string{
+		`CREATE TRIGGER IF NOT EXISTS ` + quoteIdentifier(v.objectName("insert")) +
+			` AFTER INSERT ON ` + source + ` BEGIN ` + v.recompute("NEW") + ` END`,
+		`CREATE TRIGGER IF NOT EXISTS ` + quoteIdentifier(v.objectName("delete")) +
+			` AFTER DELETE ON ` + source + ` BEGIN ` + v.recompute("OLD") + ` END`,
+		`CREATE TRIGGER IF NOT EXISTS ` + quoteIdentifier(v.objectName("update")) +
+			` AFTER UPDATE ON ` + source + ` BEGIN ` + v.recompute("OLD") + ` END`,
+		// the new group is recomputed only if the row is moved to another group
+		`CREATE TRIGGER IF NOT EXISTS ` + quoteIdentifier(v.objectName("move")) +
+			` AFTER UPDATE ON ` + source + ` WHEN ` + strings.Join(moved, ` OR `) +
+			` BEGIN ` + v.recompute("NEW") + ` END`,
+	} {
+		if _, err = s.handler.Exec(q); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *State) hasSchemaObject(typ, name string) (exists bool, err error) {
+	var rows *sql.Rows
+	if rows, err = s.handler.Query(`SELECT 1 FROM "sqlite_master" WHERE "type"=? AND "name"=?`,
+		typ, name); err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	exists = rows.Next()
+	err = rows.Err()
+	return
+}
+
+// loadViewObjects returns the existing maintaining objects, mapping the names to the types.
+func (s *State) loadViewObjects() (objects map[string]string, err error) {
+	var rows *sql.Rows
+	if rows, err = s.handler.Query(`SELECT "name", "type" FROM "sqlite_master" WHERE ` +
+		`"type" IN ('index', 'trigger') AND "name" LIKE '` +
+		strings.Replace(MaterializedViewObjectPrefix, "_", `\_`, -1) + `%' ESCAPE '\'`); err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	objects = make(map[string]string)
+	for rows.Next() {
+		var name, typ string
+		if err = rows.Scan(&name, &typ); err != nil {
+			return
+		}
+		objects[name] = typ
+	}
+	err = rows.Err()
+	return
+}
+
+// loadViews loads the valid materialized view definitions, ordered by name.
+func (s *State) loadViews() (views []*materializedView, err error) {
+	var rows *sql.Rows
+	if rows, err = s.handler.Query(`SELECT "name", "query" FROM ` +
+		quoteIdentifier(MaterializedViewsTable) + ` ORDER BY "name"`); err != nil {
+		// definitions table is not created yet
+		err = nil
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var (
+			name, query string
+			v           *materializedView
+		)
+		if err = rows.Scan(&name, &query); err != nil {
+			return
+		}
+		if v, err = parseMaterializedView(name, query); err != nil {
+			log.WithError(err).WithField("view", name).Warning("skip invalid materialized view")
+			err = nil
+			continue
+		}
+		views = append(views, v)
+	}
+	err = rows.Err()
+	return
+}
+
+// touchesViews returns whether the write query changes the materialized view definitions.
+func touchesViews(pattern string) bool {
+	if !strings.Contains(strings.ToLower(pattern), MaterializedViewsTable) {
+		return false
+	}
+	for _, t := range referencedTables(pattern) {
+		if strings.ToLower(t) == MaterializedViewsTable {
+			return true
+		}
+	}
+	return false
+}
+
+// syncViews reconciles the view tables and the maintaining objects with the view definitions,
+// it's called on the writes which change the definitions or the schema. If anything is
+// changed, e.g. a view is defined or a source table is recreated, all the views are rebuilt in
+// dependency order and the triggers are reinstalled; otherwise it's a no-op.
+func (s *State) syncViews() (err error) {
+	var (
+		views    []*materializedView
+		existing map[string]string
+		wanted   = make(map[string]string)
+		changed  bool
+	)
+	if views, err = s.loadViews(); err != nil {
+		return
+	}
+	if existing, err = s.loadViewObjects(); err != nil {
+		return
+	}
+	for _, v := range views {
+		for name, typ := range v.objects() {
+			wanted[name] = typ
+		}
+		var exists bool
+		if exists, err = s.hasSchemaObject("table", v.name); err != nil {
+			return
+		}
+		changed = changed || !exists
+	}
+	for name, typ := range wanted {
+		changed = changed || existing[name] != typ
+	}
+	for name := range existing {
+		changed = changed || wanted[name] == ""
+	}
+	if !changed {
+		return
+	}
+
+	// drop the triggers before rebuilding, and the indexes of the dropped definitions
+	var names = make([]string, 0, len(existing))
+	for name := range existing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if typ := existing[name]; typ == "trigger" || wanted[name] == "" {
+			if _, err = s.handler.Exec(`DROP ` + strings.ToUpper(typ) + ` IF EXISTS ` +
+				quoteIdentifier(name)); err != nil {
+				return
+			}
+		}
+	}
+	atomic.StoreUint32(&s.hasSchemaChange, 1)
+
+	// a view is built after the view it depends on
+	var (
+		pending = make(map[string]bool)
+		built   []*materializedView
+	)
+	for _, v := range views {
+		pending[strings.ToLower(v.name)] = true
+	}
+	for progress := true; progress && len(pending) > 0; {
+		progress = false
+		for _, v := range views {
+			if !pending[strings.ToLower(v.name)] || pending[strings.ToLower(v.source)] {
+				continue
+			}
+			delete(pending, strings.ToLower(v.name))
+			progress = true
+			if berr := s.buildView(v); berr != nil {
+				log.WithError(berr).WithField("view", v.name).Warning(
+					"build materialized view failed")
+				continue
+			}
+			built = append(built, v)
+		}
+	}
+	for name := range pending {
+		log.WithField("view", name).Warning("materialized view depends on itself")
+	}
+	for _, v := range built {
+		if err = s.installTriggers(v); err != nil {
+			err = errors.Wrapf(err, "install triggers of materialized view %s failed", v.name)
+			return
+		}
+	}
+	return
+}
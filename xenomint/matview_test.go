@@ -0,0 +1,164 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+	xi "github.com/SQLess/SQLess/xenomint/interfaces"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+func TestMaterializedViews(t *testing.T) {
+	Convey("Given a state with a materialized view", t, func() {
+		var (
+			fl   = path.Join(testingDataDir, t.Name())
+			strg xi.Storage
+			err  error
+		)
+		strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st := NewState(sql.LevelReadUncommitted, nodeID, strg)
+		Reset(func() {
+			So(st.Close(true), ShouldBeNil)
+			for _, f := range []string{fl, fl + "-shm", fl + "-wal"} {
+				err = os.Remove(f)
+				So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			}
+		})
+		var (
+			write = func(queries ...string) {
+				var qs []types.Query
+				for _, q := range queries {
+					qs = append(qs, buildQuery(q))
+				}
+				_, _, err := st.Query(buildRequest(types.WriteQuery, qs), true)
+				So(err, ShouldBeNil)
+			}
+			totals = func() (m map[string]int64) {
+				m = make(map[string]int64)
+				rows, err := st.handler.Query(`SELECT k, total FROM sums`)
+				So(err, ShouldBeNil)
+				defer rows.Close()
+				for rows.Next() {
+					var (
+						k string
+						v int64
+					)
+					So(rows.Scan(&k, &v), ShouldBeNil)
+					m[k] = v
+				}
+				return
+			}
+		)
+		write(`CREATE TABLE t1 (id INT, k TEXT, v INT, PRIMARY KEY(id))`,
+			`CREATE TABLE t2 (id INT, PRIMARY KEY(id))`)
+		write(`INSERT INTO t1 VALUES (1, 'a', 1)`, `INSERT INTO t1 VALUES (2, 'b', 2)`)
+		write(`CREATE TABLE IF NOT EXISTS __sqless_matviews (name TEXT PRIMARY KEY, query TEXT)`,
+			`INSERT INTO __sqless_matviews VALUES ('sums', 'SELECT k, SUM(v) AS total FROM t1 GROUP BY k')`)
+		Convey("The view should be created with the current contents", func() {
+			So(totals(), ShouldResemble, map[string]int64{"a": 1, "b": 2})
+		})
+		Convey("The view should be refreshed by writes on its source tables", func() {
+			write(`INSERT INTO t1 VALUES (3, 'a', 10)`)
+			So(totals(), ShouldResemble, map[string]int64{"a": 11, "b": 2})
+			write(`DELETE FROM t1 WHERE k='b'`)
+			So(totals(), ShouldResemble, map[string]int64{"a": 11})
+			write(`UPDATE t1 SET k='c' WHERE id=3`)
+			So(totals(), ShouldResemble, map[string]int64{"a": 1, "c": 10})
+		})
+		Convey("The view should be maintained by triggers on its source table", func() {
+			objects, err := st.loadViewObjects()
+			So(err, ShouldBeNil)
+			So(objects, ShouldHaveLength, 6)
+			// only the group of the changed row is looked up through the source index
+			rows, err := st.handler.Query(`EXPLAIN QUERY PLAN SELECT * FROM `+
+				`(SELECT k, SUM(v) AS total FROM t1 GROUP BY k) WHERE k IS ?`, "a")
+			So(err, ShouldBeNil)
+			var plan []string
+			for rows.Next() {
+				var (
+					id, parent, notused int
+					detail              string
+				)
+				So(rows.Scan(&id, &parent, &notused, &detail), ShouldBeNil)
+				plan = append(plan, detail)
+			}
+			So(rows.Close(), ShouldBeNil)
+			So(strings.Join(plan, "\n"), ShouldContainSubstring, "USING INDEX "+MaterializedViewObjectPrefix)
+		})
+		Convey("The view should be rebuilt on definition change and dropped with its definition", func() {
+			write(`UPDATE __sqless_matviews SET query='SELECT k, COUNT(*) AS total FROM t1 GROUP BY k'`)
+			So(totals(), ShouldResemble, map[string]int64{"a": 1, "b": 1})
+			write(`INSERT INTO t1 VALUES (3, 'a', 10)`)
+			So(totals(), ShouldResemble, map[string]int64{"a": 2, "b": 1})
+			objects, err := st.loadViewObjects()
+			So(err, ShouldBeNil)
+			So(objects, ShouldHaveLength, 6)
+			write(`DELETE FROM __sqless_matviews WHERE name='sums'`, `DROP TABLE sums`)
+			objects, err = st.loadViewObjects()
+			So(err, ShouldBeNil)
+			So(objects, ShouldBeEmpty)
+			write(`INSERT INTO t1 VALUES (4, 'a', 10)`)
+		})
+		Convey("The view should be maintained again after its source table is recreated", func() {
+			write(`DROP TABLE t1`, `CREATE TABLE t1 (id INT, k TEXT, v INT, PRIMARY KEY(id))`)
+			So(totals(), ShouldBeEmpty)
+			write(`INSERT INTO t1 VALUES (1, 'z', 1)`)
+			So(totals(), ShouldResemble, map[string]int64{"z": 1})
+		})
+		Convey("The views which could not be maintained incrementally should be rejected", func() {
+			for _, q := range []string{
+				`SELECT k, v FROM t1`,
+				`SELECT SUM(v) AS total FROM t1 GROUP BY k`,
+				`SELECT t1.k, SUM(t2.id) FROM t1 JOIN t2 GROUP BY t1.k`,
+				`SELECT k, (SELECT COUNT(*) FROM t2) AS n FROM t1 GROUP BY k`,
+				`SELECT k, SUM(v) AS total FROM t1 GROUP BY k LIMIT 1`,
+			} {
+				So(errors.Cause(ValidateMaterializedView(q)), ShouldEqual, ErrInvalidMaterializedView)
+			}
+			So(ValidateMaterializedView(
+				`SELECT t.k AS kk, COUNT(*) AS n FROM t1 AS t WHERE v > 1 GROUP BY t.k`), ShouldBeNil)
+			write(`INSERT INTO __sqless_matviews VALUES ('bad', 'SELECT k, v FROM t1')`)
+			write(`INSERT INTO t1 VALUES (3, 'a', 10)`)
+			So(totals(), ShouldResemble, map[string]int64{"a": 11, "b": 2})
+		})
+		Convey("The view should not be refreshed by unrelated writes", func() {
+			_, err = st.handler.Exec(`DELETE FROM sums`)
+			So(err, ShouldBeNil)
+			write(`INSERT INTO t2 VALUES (1)`)
+			So(totals(), ShouldBeEmpty)
+		})
+		Convey("The view should be reloaded on a fresh state", func() {
+			So(st.Close(true), ShouldBeNil)
+			strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+			So(err, ShouldBeNil)
+			st = NewState(sql.LevelReadUncommitted, nodeID, strg)
+			write(`UPDATE t1 SET v=5 WHERE id=1`)
+			So(totals(), ShouldResemble, map[string]int64{"a": 5, "b": 2})
+		})
+	})
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SQLess/sqlparser"
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/storage"
+	"github.com/SQLess/SQLess/types"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+// DryRun copies the committed state to a shadow database file in a private temporary directory
+// under dir and executes the queries on it one by one. The estimates are measured on the shadow
+// copy, the state itself is left untouched. The onPin callback, if any, is called while the
+// snapshot of the copy is pinned and the writes are blocked.
+func (s *State) DryRun(
+	ctx context.Context, dir string, queries []types.Query, onPin func(),
+) (estimates []types.MigrationEstimate, err error) {
+	var (
+		tmpDir string
+		dsn    *storage.DSN
+		stx    *sql.Tx
+		shadow *xs.SQLite3
+		conn   *sql.Conn
+	)
+	if tmpDir, err = ioutil.TempDir(dir, "migration-"); err != nil {
+		return
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	var filename = filepath.Join(tmpDir, "shadow.db")
+	if dsn, err = storage.NewDSN(filename); err != nil {
+		return
+	}
+	if stx, _, err = s.pinSnapshot(ctx, onPin); err != nil {
+		return
+	}
+	err = xs.CopyTx(ctx, stx, dsn, xs.CopyOptions{})
+	_ = stx.Rollback()
+	if err != nil {
+		return
+	}
+	if shadow, err = xs.NewSqlite(filename); err != nil {
+		return
+	}
+	defer func() { _ = shadow.Close() }()
+	// stick to a single connection, the change counters of sqlite are per connection
+	if conn, err = shadow.Writer().Conn(ctx); err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	estimates = make([]types.MigrationEstimate, len(queries))
+	for i, q := range queries {
+		var (
+			e       = &estimates[i]
+			pattern string
+			args    []interface{}
+		)
+		e.Query = q.Pattern
+		if _, pattern, args, err = convertQueryAndBuildArgs(q.Pattern, q.Args); err != nil {
+			err = errors.Wrapf(err, "convert query %d failed", i)
+			return
+		}
+		for _, table := range referencedTables(pattern) {
+			var count uint64
+			// tables created by the statement itself do not exist on the shadow copy yet
+			if conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+
+				`"`+strings.Replace(table, `"`, `""`, -1)+`"`).Scan(&count) == nil {
+				e.RowsScanned += count
+			}
+		}
+		// sqlite keeps the changes() of the last dml for ddl statements, diff the total changes
+		// counter instead so that a ddl reports no affected rows
+		var before, after uint64
+		if err = conn.QueryRowContext(ctx, `SELECT total_changes()`).Scan(&before); err != nil {
+			return
+		}
+		var start = time.Now()
+		_, ierr := conn.ExecContext(ctx, pattern, args...)
+		e.Duration = time.Since(start)
+		if ierr != nil {
+			err = errors.Wrapf(ierr, "dry-run query %d failed", i)
+			return
+		}
+		if err = conn.QueryRowContext(ctx, `SELECT total_changes()`).Scan(&after); err != nil {
+			return
+		}
+		e.AffectedRows = after - before
+		e.Rewrite = e.RowsScanned > 0 && e.AffectedRows >= e.RowsScanned
+	}
+	return
+}
+
+// referencedTables returns the distinct table names referenced by the query.
+func referencedTables(pattern string) (tables []string) {
+	_, statements, err := sqlparser.ParseMultiple(sqlparser.NewStringTokenizer(pattern))
+	if err != nil {
+		return
+	}
+	var seen = make(map[string]bool)
+	for _, stmt := range statements {
+		_ = sqlparser.Walk(func(node sqlparser.SQLNode) (kontinue bool, err error) {
+			if t, ok := node.(sqlparser.TableName); ok && !t.IsEmpty() && !seen[t.Name.String()] {
+				seen[t.Name.String()] = true
+				tables = append(tables, t.Name.String())
+			}
+			return true, nil
+		}, stmt)
+	}
+	return
+}
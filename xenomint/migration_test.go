@@ -0,0 +1,100 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+	xi "github.com/SQLess/SQLess/xenomint/interfaces"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+func TestDryRun(t *testing.T) {
+	Convey("Given a state with some committed rows", t, func() {
+		var (
+			fl   = path.Join(testingDataDir, t.Name())
+			dir  = path.Join(testingDataDir, t.Name()+"-shadow")
+			strg xi.Storage
+			err  error
+		)
+		So(os.MkdirAll(dir, 0755), ShouldBeNil)
+		strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st := NewState(sql.LevelReadUncommitted, nodeID, strg)
+		Reset(func() {
+			So(st.Close(true), ShouldBeNil)
+			for _, f := range []string{fl, fl + "-shm", fl + "-wal"} {
+				err = os.Remove(f)
+				So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			}
+			So(os.RemoveAll(dir), ShouldBeNil)
+		})
+		_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+			buildQuery(`CREATE TABLE t1 (k INT, v TEXT, PRIMARY KEY(k))`),
+			buildQuery(`INSERT INTO t1 VALUES (1, 'a')`),
+			buildQuery(`INSERT INTO t1 VALUES (2, 'b')`),
+			buildQuery(`INSERT INTO t1 VALUES (3, 'c')`),
+		}), true)
+		So(err, ShouldBeNil)
+
+		Convey("The ddl should not report the affected rows of the previous dml", func() {
+			var pinned bool
+			estimates, err := st.DryRun(context.Background(), dir, []types.Query{
+				buildQuery(`UPDATE t1 SET v='x'`),
+				buildQuery(`CREATE INDEX i1 ON t1 (v)`),
+				buildQuery(`ALTER TABLE t1 ADD COLUMN w TEXT`),
+			}, func() { pinned = true })
+			So(err, ShouldBeNil)
+			So(pinned, ShouldBeTrue)
+			So(estimates, ShouldHaveLength, 3)
+			So(estimates[0].AffectedRows, ShouldEqual, 3)
+			So(estimates[0].RowsScanned, ShouldEqual, 3)
+			So(estimates[0].Rewrite, ShouldBeTrue)
+			So(estimates[1].AffectedRows, ShouldEqual, 0)
+			So(estimates[2].AffectedRows, ShouldEqual, 0)
+			So(estimates[2].Rewrite, ShouldBeFalse)
+
+			Convey("The state and the shadow directory should be left untouched", func() {
+				var v string
+				err = st.strg.Reader().QueryRow(`SELECT v FROM t1 WHERE k=1`).Scan(&v)
+				So(err, ShouldBeNil)
+				So(v, ShouldEqual, "a")
+				files, err := ioutil.ReadDir(dir)
+				So(err, ShouldBeNil)
+				So(files, ShouldBeEmpty)
+			})
+		})
+		Convey("A failed query should abort the dry-run and clean up the shadow copy", func() {
+			_, err := st.DryRun(context.Background(), dir, []types.Query{
+				buildQuery(`UPDATE t2 SET v='x'`),
+			}, nil)
+			So(err, ShouldNotBeNil)
+			files, err := ioutil.ReadDir(dir)
+			So(err, ShouldBeNil)
+			So(files, ShouldBeEmpty)
+		})
+	})
+}
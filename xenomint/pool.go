@@ -29,6 +29,10 @@ type QueryTracker struct {
 	sync.RWMutex
 	Req  *types.Request
 	Resp *types.Response
+
+	// IOOps and IOBytes are the i/o of the write measured by the storage, see meterWrite.
+	IOOps   uint64
+	IOBytes uint64
 }
 
 // UpdateResp updates response of the QueryTracker within locking scope.
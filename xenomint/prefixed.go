@@ -0,0 +1,90 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// PrefixedValues returns the distinct text or blob values starting with prefix stored in any
+// column of the user tables, e.g. the blob references still reachable from the database.
+func (s *State) PrefixedValues(ctx context.Context, prefix string) (values []string, err error) {
+	var tx *sql.Tx
+	if tx, err = s.storage().Reader().BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var tables []string
+	if tables, err = queryStrings(ctx, tx, `SELECT "name" FROM "sqlite_master" `+
+		`WHERE "type"='table' AND "name" NOT LIKE 'sqlite\_%' ESCAPE '\'`); err != nil {
+		return
+	}
+	var seen = make(map[string]struct{})
+	for _, t := range tables {
+		var (
+			quoted  = quoteIdentifier(t)
+			columns []string
+		)
+		if columns, err = queryStrings(ctx, tx,
+			`SELECT "name" FROM pragma_table_info(?)`, t); err != nil {
+			err = errors.Wrapf(err, "list columns of table %s", t)
+			return
+		}
+		for _, c := range columns {
+			var (
+				col = quoteIdentifier(c)
+				vs  []string
+			)
+			if vs, err = queryStrings(ctx, tx, `SELECT DISTINCT CAST(`+col+` AS TEXT) FROM `+
+				quoted+` WHERE typeof(`+col+`) IN ('text', 'blob') AND `+
+				`CAST(substr(`+col+`, 1, ?) AS TEXT) = ?`, len(prefix), prefix); err != nil {
+				err = errors.Wrapf(err, "scan column %s of table %s", c, t)
+				return
+			}
+			for _, v := range vs {
+				if _, ok := seen[v]; !ok {
+					seen[v] = struct{}{}
+					values = append(values, v)
+				}
+			}
+		}
+	}
+	return
+}
+
+func queryStrings(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (
+	values []string, err error,
+) {
+	var rows *sql.Rows
+	if rows, err = tx.QueryContext(ctx, query, args...); err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v string
+		if err = rows.Scan(&v); err != nil {
+			return
+		}
+		values = append(values, v)
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+	xi "github.com/SQLess/SQLess/xenomint/interfaces"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+func TestPrefixedValues(t *testing.T) {
+	Convey("Given a state with prefixed values in several columns", t, func() {
+		var (
+			fl   = path.Join(testingDataDir, t.Name())
+			strg xi.Storage
+			err  error
+		)
+		strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st := NewState(sql.LevelReadUncommitted, nodeID, strg)
+		Reset(func() {
+			So(st.Close(true), ShouldBeNil)
+			for _, f := range []string{fl, fl + "-shm", fl + "-wal"} {
+				err = os.Remove(f)
+				So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			}
+		})
+		_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+			buildQuery(`CREATE TABLE t1 (id INT, a TEXT, b BLOB, PRIMARY KEY(id))`),
+			buildQuery(`CREATE TABLE "t""2" ("c""1" TEXT)`),
+			buildQuery(`INSERT INTO t1 VALUES (1, 'ref:a', CAST('ref:b' AS BLOB))`),
+			buildQuery(`INSERT INTO t1 VALUES (2, 'ref:a', 'plain')`),
+			buildQuery(`INSERT INTO t1 VALUES (3, 'xref:c', NULL)`),
+			buildQuery(`INSERT INTO "t""2" VALUES ('ref:d')`),
+		}), true)
+		So(err, ShouldBeNil)
+		_, _, err = st.CommitEx()
+		So(err, ShouldBeNil)
+
+		Convey("The distinct prefixed values of all tables should be returned", func() {
+			values, err := st.PrefixedValues(context.Background(), "ref:")
+			So(err, ShouldBeNil)
+			sort.Strings(values)
+			So(values, ShouldResemble, []string{"ref:a", "ref:b", "ref:d"})
+		})
+	})
+}
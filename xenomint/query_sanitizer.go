@@ -144,6 +144,11 @@ WHERE type = "index" AND tbl_name = "%s"
 				err = errors.Wrapf(ErrInvalidTableName, "%s", stmt.NewName.Name.String())
 				return
 			}
+			// the table usage system table is reserved
+			if strings.ToLower(stmt.NewName.Name.String()) == TableUsageTable {
+				err = errors.Wrapf(ErrInvalidTableName, "%s", stmt.NewName.Name.String())
+				return
+			}
 			// for alter table/alter index
 			if strings.HasPrefix(strings.ToLower(stmt.Table.Name.String()), "sqlite") {
 				// invalid table name
@@ -0,0 +1,273 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/storage"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+const (
+	rekeyFileSuffix = ".rekey"
+	// rekeySwapThreshold is the recorded write count below which the storage is swapped, the
+	// remaining writes are replayed while holding the state lock.
+	rekeySwapThreshold = 1000
+	// maxRekeyCatchUpRounds is the maximum rounds to replay the recorded writes before the
+	// storage is swapped regardless of the write count.
+	maxRekeyCatchUpRounds = 16
+)
+
+type rekeyStatement struct {
+	query string
+	args  []interface{}
+}
+
+// rekeyRecorder wraps the state handler and records the successful writes, so that the writes
+// done while the storage snapshot is being copied can be replayed on the rekeyed copy.
+type rekeyRecorder struct {
+	sqlHandler
+	inTx      bool
+	pending   []rekeyStatement
+	committed []rekeyStatement
+}
+
+func (r *rekeyRecorder) wrap(h sqlHandler) {
+	r.sqlHandler = h
+	_, r.inTx = h.(sqlTransaction)
+	r.pending = nil
+}
+
+func (r *rekeyRecorder) record(query string, args []interface{}) {
+	var stmt = rekeyStatement{query: query, args: args}
+	if r.inTx {
+		r.pending = append(r.pending, stmt)
+	} else {
+		r.committed = append(r.committed, stmt)
+	}
+}
+
+func (r *rekeyRecorder) Exec(query string, args ...interface{}) (res sql.Result, err error) {
+	if res, err = r.sqlHandler.Exec(query, args...); err == nil {
+		r.record(query, args)
+	}
+	return
+}
+
+func (r *rekeyRecorder) ExecContext(
+	ctx context.Context, query string, args ...interface{}) (res sql.Result, err error,
+) {
+	if res, err = r.sqlHandler.ExecContext(ctx, query, args...); err == nil {
+		r.record(query, args)
+	}
+	return
+}
+
+func (r *rekeyRecorder) Commit() (err error) {
+	if tx, ok := r.sqlHandler.(sqlTransaction); ok {
+		if err = tx.Commit(); err != nil {
+			return
+		}
+	}
+	if len(r.pending) > 0 {
+		r.committed = append(r.committed, rekeyStatement{query: "BEGIN"})
+		r.committed = append(r.committed, r.pending...)
+		r.committed = append(r.committed, rekeyStatement{query: "COMMIT"})
+	}
+	r.pending = nil
+	return
+}
+
+func (r *rekeyRecorder) Rollback() (err error) {
+	if tx, ok := r.sqlHandler.(sqlTransaction); ok {
+		err = tx.Rollback()
+	}
+	r.pending = nil
+	return
+}
+
+func (r *rekeyRecorder) take() (stmts []rekeyStatement) {
+	stmts, r.committed = r.committed, nil
+	return
+}
+
+// Rekey rewrites the storage to the target, e.g. the same file with a new encryption key,
+// without blocking the queries. A consistent snapshot is copied to the target in chunks while
+// the new writes are recorded, the recorded writes are then replayed on the copy and the
+// storage is swapped with it in a short critical section. Open paginated reads are closed on
+// swap.
+func (s *State) Rekey(ctx context.Context, target *storage.DSN, opts xs.CopyOptions) (err error) {
+	var (
+		filename = target.GetFileName()
+		tmpDSN   = target.Clone()
+		rekey    = &rekeyRecorder{}
+		stx      *sql.Tx
+		copied   *xs.SQLite3
+	)
+	tmpDSN.SetFileName(filename + rekeyFileSuffix)
+	if stx, err = s.beginRekey(ctx, rekey); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			s.abortRekey()
+			for _, suffix := range []string{"", "-wal", "-shm"} {
+				_ = os.Remove(tmpDSN.GetFileName() + suffix)
+			}
+		}
+	}()
+	err = xs.CopyTx(ctx, stx, tmpDSN, opts)
+	_ = stx.Rollback()
+	if err != nil {
+		err = errors.Wrap(err, "copy storage snapshot failed")
+		return
+	}
+	if copied, err = xs.NewSqlite(tmpDSN.Format()); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = copied.Close()
+		}
+	}()
+
+	// catch up with the writes done while copying
+	for i := 0; i < maxRekeyCatchUpRounds; i++ {
+		var stmts []rekeyStatement
+		s.Lock()
+		stmts = rekey.take()
+		s.Unlock()
+		if err = replayRekeyStatements(ctx, copied.Writer(), stmts); err != nil {
+			return
+		}
+		if len(stmts) < rekeySwapThreshold {
+			break
+		}
+	}
+	return s.swapRekeyed(ctx, target, tmpDSN, copied)
+}
+
+func (s *State) beginRekey(ctx context.Context, rekey *rekeyRecorder) (stx *sql.Tx, err error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		err = ErrStateClosed
+		return
+	}
+	if s.rekey != nil {
+		err = ErrRekeyInProgress
+		return
+	}
+	// commit the ongoing transaction, so that the snapshot contains all the writes before the
+	// recording starts
+	s.commitHandler()
+	defer s.openHandler()
+	if stx, err = s.strg.Reader().BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err != nil {
+		return
+	}
+	// sqlite starts the read transaction lazily, read once to pin the snapshot
+	var count int
+	if err = stx.QueryRowContext(
+		ctx, `SELECT COUNT(*) FROM "sqlite_master"`).Scan(&count); err != nil {
+		_ = stx.Rollback()
+		return
+	}
+	s.rekey = rekey
+	return
+}
+
+func (s *State) abortRekey() {
+	s.Lock()
+	defer s.Unlock()
+	if s.rekey != nil {
+		s.handler = s.rekey.sqlHandler
+		s.rekey = nil
+	}
+}
+
+func (s *State) swapRekeyed(
+	ctx context.Context, target, tmpDSN *storage.DSN, copied *xs.SQLite3) (err error,
+) {
+	// cursors are closed outside the state locking scope, a page being served may wait for it
+	s.cursors.closeAll()
+	s.Lock()
+	defer s.Unlock()
+	if s.closed {
+		err = ErrStateClosed
+		return
+	}
+	s.commitHandler()
+	if err = replayRekeyStatements(ctx, copied.Writer(), s.rekey.take()); err != nil {
+		s.openHandler()
+		return
+	}
+	if err = copied.Close(); err != nil {
+		s.openHandler()
+		return
+	}
+
+	s.strgLock.Lock()
+	defer s.strgLock.Unlock()
+	var filename = target.GetFileName()
+	if err = s.strg.Close(); err != nil {
+		s.closed = true
+		err = errors.Wrap(err, "close storage failed")
+		return
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err = os.Remove(filename + suffix); err != nil && !os.IsNotExist(err) {
+			s.closed = true
+			return
+		}
+	}
+	if err = os.Rename(tmpDSN.GetFileName(), filename); err != nil {
+		s.closed = true
+		return
+	}
+	if s.strg, err = xs.NewSqlite(target.Format()); err != nil {
+		s.closed = true
+		err = errors.Wrap(err, "reopen storage failed")
+		return
+	}
+	s.rekey = nil
+	s.openHandler()
+	return
+}
+
+// replayRekeyStatements executes the recorded statements in order on a single connection.
+func replayRekeyStatements(ctx context.Context, db *sql.DB, stmts []rekeyStatement) (err error) {
+	if len(stmts) == 0 {
+		return
+	}
+	var conn *sql.Conn
+	if conn, err = db.Conn(ctx); err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	for i, v := range stmts {
+		if _, err = conn.ExecContext(ctx, v.query, v.args...); err != nil {
+			err = errors.Wrapf(err, "replay recorded write #%d failed", i)
+			return
+		}
+	}
+	return
+}
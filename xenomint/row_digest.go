@@ -0,0 +1,140 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/crypto/hash"
+	"github.com/SQLess/SQLess/types"
+	"github.com/SQLess/SQLess/utils"
+)
+
+// MaxRowDigests defines the max rows to be digested row by row in a single request.
+const MaxRowDigests = 4096
+
+// RowDigests returns the digests of the table rows in the rowid range [from, to] of the
+// committed state, see DigestRows.
+func (s *State) RowDigests(ctx context.Context, table string, from, to int64, buckets uint32) (
+	ranges []types.RowRangeDigest, rows []types.RowDigest, err error,
+) {
+	return DigestRows(ctx, s.storage().Reader(), table, from, to, buckets)
+}
+
+// DigestRows returns the digests of the table rows in the rowid range [from, to]. The range is
+// split into buckets ranges of the same width and only the non-empty ranges are returned, so
+// replicas of the same table can be compared range by range and narrowed down to the divergent
+// rows. If buckets is 0, the rows are digested one by one instead.
+func DigestRows(ctx context.Context, db *sql.DB, table string, from, to int64, buckets uint32) (
+	ranges []types.RowRangeDigest, rows []types.RowDigest, err error,
+) {
+	if from > to {
+		err = errors.Errorf("invalid rowid range [%d, %d]", from, to)
+		return
+	}
+	var (
+		quoted = `"` + strings.Replace(table, `"`, `""`, -1) + `"`
+		rs     *sql.Rows
+		cols   []string
+	)
+	if rs, err = db.QueryContext(ctx,
+		`SELECT "_rowid_", * FROM `+quoted+` WHERE "_rowid_" BETWEEN ? AND ? ORDER BY "_rowid_"`,
+		from, to,
+	); err != nil {
+		err = errors.Wrapf(err, "digest table %s", table)
+		return
+	}
+	defer rs.Close()
+	if cols, err = rs.Columns(); err != nil {
+		return
+	}
+
+	var (
+		rowID  int64
+		values = make([]interface{}, len(cols)-1)
+		dests  = make([]interface{}, len(cols))
+		width  = bucketWidth(from, to, buckets)
+		cur    *types.RowRangeDigest
+	)
+	dests[0] = &rowID
+	for i := range values {
+		dests[i+1] = &values[i]
+	}
+	for rs.Next() {
+		if err = rs.Scan(dests...); err != nil {
+			return
+		}
+		var h hash.Hash
+		if h, err = rowHash(values); err != nil {
+			return
+		}
+		if buckets == 0 {
+			if len(rows) >= MaxRowDigests {
+				err = errors.Wrapf(ErrTooManyRows, "more than %d rows in [%d, %d]", MaxRowDigests, from, to)
+				return
+			}
+			rows = append(rows, types.RowDigest{RowID: rowID, Hash: h})
+			continue
+		}
+		var idx = (uint64(rowID) - uint64(from)) / width
+		if cur == nil || idx != (uint64(cur.From)-uint64(from))/width {
+			lo := int64(uint64(from) + idx*width)
+			hi := int64(uint64(lo) + width - 1)
+			if hi > to || hi < lo {
+				hi = to
+			}
+			ranges = append(ranges, types.RowRangeDigest{From: lo, To: hi})
+			cur = &ranges[len(ranges)-1]
+		}
+		// chain row hashes so the digest depends on both row ids and contents
+		var buf = make([]byte, 0, len(cur.Hash)+len(h)+8)
+		buf = append(append(buf, cur.Hash[:]...), h[:]...)
+		buf = append(buf, byte(rowID>>56), byte(rowID>>48), byte(rowID>>40), byte(rowID>>32),
+			byte(rowID>>24), byte(rowID>>16), byte(rowID>>8), byte(rowID))
+		cur.Hash = hash.THashH(buf)
+		cur.Rows++
+	}
+	err = rs.Err()
+	return
+}
+
+// bucketWidth returns the width of each bucket splitting [from, to], the arithmetic is done in
+// uint64 so that the full int64 range does not overflow.
+func bucketWidth(from, to int64, buckets uint32) uint64 {
+	if buckets == 0 {
+		return 1
+	}
+	var span = uint64(to) - uint64(from) // span + 1 is the range size
+	var width = span/uint64(buckets) + 1
+	if width == 0 {
+		// only if span is max uint64 and buckets is 1
+		width = span
+	}
+	return width
+}
+
+func rowHash(values []interface{}) (h hash.Hash, err error) {
+	buf, err := utils.EncodeMsgPack(values)
+	if err != nil {
+		return
+	}
+	return hash.THashH(buf.Bytes()), nil
+}
@@ -0,0 +1,152 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+
+	sqlite3 "github.com/SQLess/go-sqlite3-cipher"
+)
+
+// The vetted collations are registered on every storage connection, so that they behave
+// identically on all the replicas of a database. They are implemented in pure Go without
+// locale data: case folding follows the Unicode simple case folding, which is stable for the
+// assigned code points.
+var collations = map[string]func(a, b string) int{
+	"unicode_ci": func(a, b string) int { return compareFolded(a, b, foldRune) },
+	"natural":    func(a, b string) int { return compareNatural(a, b, identityRune) },
+	"natural_ci": func(a, b string) int { return compareNatural(a, b, foldRune) },
+}
+
+// Collations returns the sorted names of the vetted collations.
+func Collations() (names []string) {
+	for name := range collations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+func registerCollations(c *sqlite3.SQLiteConn) (err error) {
+	for name, cmp := range collations {
+		if err = c.RegisterCollation(name, cmp); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func identityRune(r rune) rune {
+	return r
+}
+
+// foldRune returns the smallest rune of the case folding orbit of r, so that all the case
+// variants of a letter fold to the same rune.
+func foldRune(r rune) rune {
+	var min = r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+	return min
+}
+
+func compareRune(a, b rune) int {
+	return compareInt(int(a), int(b))
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareFolded(a, b string, fold func(rune) rune) int {
+	for len(a) > 0 && len(b) > 0 {
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if c := compareRune(fold(ra), fold(rb)); c != 0 {
+			return c
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return compareInt(len(a), len(b))
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// compareNatural compares the digit runs by their numeric values and the rest by the folded
+// runes, e.g. file2 < file10. Runs of the same value with different leading zeros only decide
+// the order if the strings are otherwise equal.
+func compareNatural(a, b string, fold func(rune) rune) int {
+	var tie int
+	for len(a) > 0 && len(b) > 0 {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			var i, j int
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			var (
+				da, db = a[:i], b[:j]
+				za, zb int
+			)
+			for za < len(da)-1 && da[za] == '0' {
+				za++
+			}
+			for zb < len(db)-1 && db[zb] == '0' {
+				zb++
+			}
+			// compare the values by length first then digit by digit
+			if c := compareInt(len(da)-za, len(db)-zb); c != 0 {
+				return c
+			}
+			for k := 0; k < len(da)-za; k++ {
+				if c := compareInt(int(da[za+k]), int(db[zb+k])); c != 0 {
+					return c
+				}
+			}
+			if tie == 0 {
+				tie = compareInt(za, zb)
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		ra, na := utf8.DecodeRuneInString(a)
+		rb, nb := utf8.DecodeRuneInString(b)
+		if c := compareRune(fold(ra), fold(rb)); c != 0 {
+			return c
+		}
+		a, b = a[na:], b[nb:]
+	}
+	if c := compareInt(len(a), len(b)); c != 0 {
+		return c
+	}
+	return tie
+}
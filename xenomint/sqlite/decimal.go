@@ -0,0 +1,182 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"math"
+	"math/big"
+
+	sqlite3 "github.com/SQLess/go-sqlite3-cipher"
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/utils"
+)
+
+// The decimal functions emulate the exact DECIMAL type on top of sqlite. Decimals are stored as
+// canonical text, so the columns should be declared with TEXT affinity such as DECIMAL_TEXT, a
+// DECIMAL or NUMERIC column converts the text to a lossy REAL. The values are validated on write
+// with a check constraint, e.g.
+//
+//     CREATE TABLE t (amount DECIMAL_TEXT CHECK (amount = decimal(amount)))
+//
+// All the functions are computed by math/big and yield the same result on every miner. The
+// results are bounded by utils.MaxDecimalDigits like the arguments, so repeated operations can't
+// build huge numbers. NULL arguments are skipped by decimal_sum, but rejected by the scalar
+// functions: the driver can only return NULL as a BLOB function result, which would break the
+// TEXT comparison of the check constraint, so use e.g. CASE WHEN x IS NULL THEN NULL ELSE
+// decimal(x) END for nullable columns.
+
+var (
+	errDivisionByZero   = errors.New("decimal division by zero")
+	errDecimalOverflow  = errors.New("decimal result exceeds the maximum digits")
+	errNullDecimalValue = errors.New("NULL decimal value")
+
+	// maxDecimalBits bounds the numerator and denominator of a result before it's formatted
+	maxDecimalBits = int(float64(utils.MaxDecimalDigits)*math.Log2(10)) + 1
+)
+
+func decimalArg(v interface{}) (r *big.Rat, err error) {
+	if b, ok := v.([]byte); ok && b == nil {
+		err = errNullDecimalValue
+		return
+	}
+	if r, err = utils.DecimalFromValue(v); err != nil {
+		err = errors.Wrapf(err, "%v", v)
+	}
+	return
+}
+
+func decimalBinary(
+	op func(z, x, y *big.Rat) *big.Rat) func(a, b interface{}) (string, error,
+) {
+	return func(a, b interface{}) (s string, err error) {
+		var x, y *big.Rat
+		if x, err = decimalArg(a); err != nil {
+			return
+		}
+		if y, err = decimalArg(b); err != nil {
+			return
+		}
+		return formatDecimal(op(new(big.Rat), x, y))
+	}
+}
+
+// formatDecimal formats the result in the canonical form, which is refused if it has more digits
+// than a decimal argument could have.
+func formatDecimal(r *big.Rat) (s string, err error) {
+	if r.Num().BitLen() > 2*maxDecimalBits || r.Denom().BitLen() > 2*maxDecimalBits {
+		err = errors.Wrapf(errDecimalOverflow, "%d bits", r.Num().BitLen()+r.Denom().BitLen())
+		return
+	}
+	if s, err = utils.FormatDecimal(r); err != nil {
+		return
+	}
+	if len(s) > utils.MaxDecimalDigits {
+		err = errors.Wrapf(errDecimalOverflow, "%d digits", len(s))
+		s = ""
+	}
+	return
+}
+
+func decimalFunc(v interface{}) (s string, err error) {
+	var r *big.Rat
+	if r, err = decimalArg(v); err != nil {
+		return
+	}
+	return formatDecimal(r)
+}
+
+func decimalRoundFunc(v interface{}, scale int64) (s string, err error) {
+	var r *big.Rat
+	if r, err = decimalArg(v); err != nil {
+		return
+	}
+	if scale < 0 || scale > utils.MaxDecimalDigits {
+		err = errors.Wrapf(utils.ErrInvalidDecimal, "scale %d", scale)
+		return
+	}
+	return formatDecimal(utils.RoundDecimal(r, int(scale)))
+}
+
+func decimalDivFunc(a, b interface{}, scale int64) (s string, err error) {
+	var x, y *big.Rat
+	if x, err = decimalArg(a); err != nil {
+		return
+	}
+	if y, err = decimalArg(b); err != nil {
+		return
+	}
+	if y.Sign() == 0 {
+		err = errDivisionByZero
+		return
+	}
+	return decimalRoundFunc(new(big.Rat).Quo(x, y), scale)
+}
+
+func decimalCmpFunc(a, b interface{}) (c int64, err error) {
+	var x, y *big.Rat
+	if x, err = decimalArg(a); err != nil {
+		return
+	}
+	if y, err = decimalArg(b); err != nil {
+		return
+	}
+	return int64(x.Cmp(y)), nil
+}
+
+// decimalSum implements the decimal_sum aggregation.
+type decimalSum struct {
+	sum big.Rat
+}
+
+func (s *decimalSum) Step(v interface{}) (err error) {
+	if b, ok := v.([]byte); ok && b == nil {
+		// NULL values are skipped like sum
+		return
+	}
+	var r *big.Rat
+	if r, err = decimalArg(v); err != nil {
+		return
+	}
+	s.sum.Add(&s.sum, r)
+	return
+}
+
+func (s *decimalSum) Done() (string, error) {
+	return formatDecimal(&s.sum)
+}
+
+func registerDecimalFuncs(c *sqlite3.SQLiteConn) (err error) {
+	var funcs = []struct {
+		name string
+		impl interface{}
+	}{
+		{"decimal", decimalFunc},
+		{"decimal_round", decimalRoundFunc},
+		{"decimal_add", decimalBinary((*big.Rat).Add)},
+		{"decimal_sub", decimalBinary((*big.Rat).Sub)},
+		{"decimal_mul", decimalBinary((*big.Rat).Mul)},
+		{"decimal_div", decimalDivFunc},
+		{"decimal_cmp", decimalCmpFunc},
+	}
+	for _, v := range funcs {
+		if err = c.RegisterFunc(v.name, v.impl, true); err != nil {
+			return
+		}
+	}
+	return c.RegisterAggregator("decimal_sum", func() *decimalSum { return &decimalSum{} }, true)
+}
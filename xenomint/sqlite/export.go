@@ -0,0 +1,294 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/storage"
+)
+
+// Export copies the schema and data of the committed state of src into a new plain SQLite file,
+// which can be opened by any SQLite tool. The copy is taken in a single read transaction so
+// the exported file is a consistent snapshot.
+func Export(ctx context.Context, src *sql.DB, filename string) (err error) {
+	var dsn *storage.DSN
+	if dsn, err = storage.NewDSN(filename); err != nil {
+		return
+	}
+	return Copy(ctx, src, dsn)
+}
+
+// CopyOptions defines the options of a chunked copy.
+type CopyOptions struct {
+	// ChunkRows is the row count committed to the destination in a single transaction,
+	// the whole copy is committed at once if it's zero.
+	ChunkRows uint64
+	// ChunkInterval is the pause between two chunks to throttle the copy.
+	ChunkInterval time.Duration
+	// Progress is called with the copied and total row count after each committed chunk.
+	Progress func(copied, total uint64)
+}
+
+// Copy copies the schema and data of the committed state of src into a new SQLite file
+// described by dst, e.g. with an encryption key. The file is written to a temporary file first
+// and renamed to the target on success.
+func Copy(ctx context.Context, src *sql.DB, dst *storage.DSN) (err error) {
+	var stx *sql.Tx
+	if stx, err = src.BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); err != nil {
+		return
+	}
+	defer func() { _ = stx.Rollback() }()
+	return CopyTx(ctx, stx, dst, CopyOptions{})
+}
+
+// CopyTx copies the snapshot seen by the read transaction stx into a new SQLite file described
+// by dst in chunks, so that a large database can be copied in background without holding a
+// single huge write transaction on the destination.
+func CopyTx(ctx context.Context, stx *sql.Tx, dst *storage.DSN, opts CopyOptions) (err error) {
+	var (
+		filename = dst.GetFileName()
+		tmpFile  = filename + ".tmp"
+		tmpDSN   = dst.Clone()
+		dstDB    *sql.DB
+		c        *copier
+	)
+	tmpDSN.SetFileName(tmpFile)
+	if err = os.Remove(tmpFile); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if dstDB, err = sql.Open(serializableDriver, tmpDSN.Format()); err != nil {
+		return
+	}
+	defer func() {
+		_ = dstDB.Close()
+		if err != nil {
+			_ = os.Remove(tmpFile)
+		}
+	}()
+	if c, err = newCopier(ctx, dstDB, opts); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			c.rollback()
+		}
+	}()
+
+	type schemaObject struct {
+		typ, name, sql string
+	}
+	var (
+		tables []schemaObject
+		others []schemaObject
+		rows   *sql.Rows
+	)
+	if rows, err = stx.QueryContext(ctx, `SELECT "type", "name", "sql" FROM "sqlite_master" `+
+		`WHERE "sql" IS NOT NULL AND "name" NOT LIKE 'sqlite\_%' ESCAPE '\' ORDER BY "rowid"`); err != nil {
+		return
+	}
+	for rows.Next() {
+		var o schemaObject
+		if err = rows.Scan(&o.typ, &o.name, &o.sql); err != nil {
+			_ = rows.Close()
+			return
+		}
+		if o.typ == "table" {
+			tables = append(tables, o)
+		} else {
+			others = append(others, o)
+		}
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+	if opts.Progress != nil {
+		for _, t := range tables {
+			var count uint64
+			if err = stx.QueryRowContext(ctx,
+				"SELECT COUNT(*) FROM "+quoteIdentifier(t.name)).Scan(&count); err != nil {
+				return
+			}
+			c.total += count
+		}
+	}
+
+	for _, t := range tables {
+		if _, err = c.tx.ExecContext(ctx, t.sql); err != nil {
+			err = errors.Wrapf(err, "create table %s", t.name)
+			return
+		}
+		if err = copyTable(ctx, stx, c, t.name); err != nil {
+			err = errors.Wrapf(err, "copy table %s", t.name)
+			return
+		}
+	}
+	// create indexes, views and triggers after data is copied, so triggers are not fired
+	for _, o := range others {
+		if _, err = c.tx.ExecContext(ctx, o.sql); err != nil {
+			err = errors.Wrapf(err, "create %s %s", o.typ, o.name)
+			return
+		}
+	}
+	if err = c.commit(); err != nil {
+		return
+	}
+	if err = dstDB.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmpFile, filename)
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+func copyTable(ctx context.Context, src *sql.Tx, dst *copier, table string) (err error) {
+	var (
+		rows    *sql.Rows
+		columns []string
+	)
+	if rows, err = src.QueryContext(ctx, "SELECT * FROM "+quoteIdentifier(table)); err != nil {
+		return
+	}
+	defer rows.Close()
+	if columns, err = rows.Columns(); err != nil {
+		return
+	}
+	var placeholders = make([]string, len(columns))
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+	var (
+		query = fmt.Sprintf("INSERT INTO %s VALUES (%s)",
+			quoteIdentifier(table), strings.Join(placeholders, ","))
+		values = make([]interface{}, len(columns))
+		dests  = make([]interface{}, len(columns))
+	)
+	for i := range values {
+		dests[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(dests...); err != nil {
+			return
+		}
+		if err = dst.insert(query, values...); err != nil {
+			return
+		}
+	}
+	return rows.Err()
+}
+
+// copier writes the copied rows to the destination database and commits them in chunks.
+type copier struct {
+	ctx       context.Context
+	db        *sql.DB
+	tx        *sql.Tx
+	stmts     map[string]*sql.Stmt
+	opts      CopyOptions
+	chunk     uint64
+	copied    uint64
+	total     uint64
+	committed bool
+}
+
+func newCopier(ctx context.Context, db *sql.DB, opts CopyOptions) (c *copier, err error) {
+	c = &copier{
+		ctx:   ctx,
+		db:    db,
+		stmts: make(map[string]*sql.Stmt),
+		opts:  opts,
+	}
+	c.tx, err = db.BeginTx(ctx, nil)
+	return
+}
+
+func (c *copier) insert(query string, values ...interface{}) (err error) {
+	var stmt, ok = c.stmts[query]
+	if !ok {
+		if stmt, err = c.tx.PrepareContext(c.ctx, query); err != nil {
+			return
+		}
+		c.stmts[query] = stmt
+	}
+	if _, err = stmt.ExecContext(c.ctx, values...); err != nil {
+		return
+	}
+	c.copied++
+	c.chunk++
+	if c.opts.ChunkRows > 0 && c.chunk >= c.opts.ChunkRows {
+		return c.next()
+	}
+	return
+}
+
+func (c *copier) closeStmts() {
+	for k, v := range c.stmts {
+		_ = v.Close()
+		delete(c.stmts, k)
+	}
+}
+
+func (c *copier) commit() (err error) {
+	c.closeStmts()
+	c.committed = true
+	if err = c.tx.Commit(); err != nil {
+		return
+	}
+	// skip the empty tail chunk, but always report an empty copy once
+	if c.opts.Progress != nil && (c.chunk > 0 || c.copied == 0) {
+		c.opts.Progress(c.copied, c.total)
+	}
+	c.chunk = 0
+	return
+}
+
+// next commits the current chunk and starts a new one after the throttling interval.
+func (c *copier) next() (err error) {
+	if err = c.commit(); err != nil {
+		return
+	}
+	if c.opts.ChunkInterval > 0 {
+		var timer = time.NewTimer(c.opts.ChunkInterval)
+		select {
+		case <-c.ctx.Done():
+			timer.Stop()
+			return c.ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if c.tx, err = c.db.BeginTx(c.ctx, nil); err != nil {
+		return
+	}
+	c.committed = false
+	return
+}
+
+func (c *copier) rollback() {
+	c.closeStmts()
+	if !c.committed {
+		_ = c.tx.Rollback()
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/storage"
+)
+
+func TestExport(t *testing.T) {
+	Convey("Given a sqlite storage with data", t, func() {
+		var (
+			fl  = path.Join(testingDataDir, t.Name())
+			out = path.Join(testingDataDir, t.Name()+"-export.db")
+			st  *SQLite3
+			err error
+		)
+		st, err = NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		Reset(func() {
+			So(st.Close(), ShouldBeNil)
+			for _, f := range []string{fl, fl + "-shm", fl + "-wal", out} {
+				err = os.Remove(f)
+				So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			}
+		})
+		for _, q := range []string{
+			`CREATE TABLE "t1" ("k" INT, "v" TEXT, PRIMARY KEY("k"))`,
+			`CREATE INDEX "t1_v" ON "t1" ("v")`,
+			`CREATE TABLE "t2" ("a" BLOB)`,
+			`CREATE TABLE "sqlitex" ("a" INT)`,
+			`CREATE TRIGGER "t1_trigger" AFTER INSERT ON "t1" BEGIN INSERT INTO "t2" VALUES (NEW."v"); END`,
+			`INSERT INTO "t1" VALUES (1, 'a'), (2, 'b'), (3, NULL)`,
+		} {
+			_, err = st.Writer().Exec(q)
+			So(err, ShouldBeNil)
+		}
+		Convey("The exported file should be a consistent plain sqlite copy", func() {
+			err = Export(context.Background(), st.Reader(), out)
+			So(err, ShouldBeNil)
+
+			var db *sql.DB
+			db, err = sql.Open(serializableDriver, "file:"+out)
+			So(err, ShouldBeNil)
+			defer db.Close()
+			var count int
+			err = db.QueryRow(`SELECT COUNT(*) FROM "t1"`).Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+			err = db.QueryRow(`SELECT COUNT(*) FROM "t2"`).Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+			err = db.QueryRow(
+				`SELECT COUNT(*) FROM "sqlite_master" WHERE "name" IN ('t1_v', 't1_trigger', 'sqlitex')`,
+			).Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+		})
+		Convey("The chunked copy should report the progress of each chunk", func() {
+			var (
+				stx      *sql.Tx
+				dsn      *storage.DSN
+				progress [][2]uint64
+			)
+			stx, err = st.Reader().BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+			So(err, ShouldBeNil)
+			defer stx.Rollback()
+			dsn, err = storage.NewDSN(out)
+			So(err, ShouldBeNil)
+			err = CopyTx(context.Background(), stx, dsn, CopyOptions{
+				ChunkRows:     2,
+				ChunkInterval: time.Millisecond,
+				Progress: func(copied, total uint64) {
+					progress = append(progress, [2]uint64{copied, total})
+				},
+			})
+			So(err, ShouldBeNil)
+			So(progress, ShouldResemble, [][2]uint64{{2, 6}, {4, 6}, {6, 6}})
+
+			var db *sql.DB
+			db, err = sql.Open(serializableDriver, "file:"+out)
+			So(err, ShouldBeNil)
+			defer db.Close()
+			var count int
+			err = db.QueryRow(`SELECT COUNT(*) FROM "t2"`).Scan(&count)
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+		})
+		Convey("The chunked copy should be canceled with the context", func() {
+			var (
+				stx         *sql.Tx
+				dsn         *storage.DSN
+				ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+			)
+			defer cancel()
+			stx, err = st.Reader().BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+			So(err, ShouldBeNil)
+			defer stx.Rollback()
+			dsn, err = storage.NewDSN(out)
+			So(err, ShouldBeNil)
+			err = CopyTx(ctx, stx, dsn, CopyOptions{ChunkRows: 1, ChunkInterval: time.Second})
+			So(errors.Cause(err), ShouldEqual, context.DeadlineExceeded)
+			_, err = os.Stat(out)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+	})
+}
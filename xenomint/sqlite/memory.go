@@ -0,0 +1,85 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sqlite
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+
+	sqlite3 "github.com/SQLess/go-sqlite3-cipher"
+)
+
+// MemoryBudget defines the memory limits of the sqlite storage connections.
+type MemoryBudget struct {
+	// QueryBytes bounds the page cache of a single connection, which is also the working memory
+	// of the sorter: big ORDER BY, GROUP BY and DISTINCT spill to temp files once it's exceeded.
+	// It also bounds the length of any string or blob built by a query, e.g. by group_concat or
+	// a recursive CTE, so the query fails with "string or blob too big" instead of growing the
+	// heap. The sqlite defaults are kept if it's not positive.
+	QueryBytes int64
+	// HeapBytes is the soft heap limit of the whole process, sqlite releases its cache memory as
+	// the limit is approached. It's advisory only: the hard heap limit is not available in the
+	// bundled sqlite (3.30), the memory of a single query is bounded by QueryBytes instead. No
+	// limit is set if it's not positive.
+	HeapBytes int64
+}
+
+var memoryBudget atomic.Value
+
+func init() {
+	memoryBudget.Store(MemoryBudget{})
+}
+
+// SetMemoryBudget sets the memory budget of the storage connections opened afterwards.
+func SetMemoryBudget(b MemoryBudget) {
+	memoryBudget.Store(b)
+}
+
+// GetMemoryBudget returns the current memory budget of the storage connections.
+func GetMemoryBudget() MemoryBudget {
+	return memoryBudget.Load().(MemoryBudget)
+}
+
+// applyMemoryBudget keeps the temporary tables and indices of the connection on disk and bounds
+// its memory usage by the current budget.
+func applyMemoryBudget(c *sqlite3.SQLiteConn) (err error) {
+	var b = GetMemoryBudget()
+	if _, err = c.Exec("PRAGMA temp_store=FILE", nil); err != nil {
+		return
+	}
+	if b.QueryBytes > 0 {
+		// negative cache size is in KiB instead of pages
+		var kib = b.QueryBytes >> 10
+		if kib < 1 {
+			kib = 1
+		}
+		if _, err = c.Exec(fmt.Sprintf("PRAGMA cache_size=-%d", kib), nil); err != nil {
+			return
+		}
+		var length = b.QueryBytes
+		if length > math.MaxInt32 {
+			length = math.MaxInt32
+		}
+		c.SetLimit(sqlite3.SQLITE_LIMIT_LENGTH, int(length))
+	}
+	if b.HeapBytes > 0 {
+		if _, err = c.Exec(fmt.Sprintf("PRAGMA soft_heap_limit=%d", b.HeapBytes), nil); err != nil {
+			return
+		}
+	}
+	return
+}
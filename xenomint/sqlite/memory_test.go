@@ -0,0 +1,86 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package sqlite
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	Convey("Given a sqlite storage with a small memory budget", t, func() {
+		var (
+			fl     = path.Join(testingDataDir, t.Name())
+			origin = GetMemoryBudget()
+		)
+		SetMemoryBudget(MemoryBudget{QueryBytes: 64 << 10})
+		st, err := NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		Reset(func() {
+			SetMemoryBudget(origin)
+			So(st.Close(), ShouldBeNil)
+			So(os.Remove(fl), ShouldBeNil)
+			err = os.Remove(fmt.Sprint(fl, "-shm"))
+			So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			err = os.Remove(fmt.Sprint(fl, "-wal"))
+			So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+		})
+		Convey("The connections should keep temp store on disk with bounded cache", func() {
+			var cacheSize, tempStore int64
+			So(st.Reader().QueryRow("PRAGMA cache_size").Scan(&cacheSize), ShouldBeNil)
+			So(cacheSize, ShouldEqual, -64)
+			So(st.Writer().QueryRow("PRAGMA temp_store").Scan(&tempStore), ShouldBeNil)
+			So(tempStore, ShouldEqual, 1)
+		})
+		Convey("The large sorts should spill to disk instead of failing", func() {
+			_, err = st.Writer().Exec(`CREATE TABLE t1 (k INT, v TEXT)`)
+			So(err, ShouldBeNil)
+			_, err = st.Writer().Exec(`WITH RECURSIVE s(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM s
+				WHERE i < 20000) INSERT INTO t1 SELECT i, hex(randomblob(64)) FROM s`)
+			So(err, ShouldBeNil)
+			var first string
+			So(st.Reader().QueryRow(`SELECT v FROM t1 ORDER BY v LIMIT 1 OFFSET 19999`).Scan(&first),
+				ShouldBeNil)
+			So(first, ShouldNotBeEmpty)
+		})
+		Convey("The queries building values over the budget should fail", func() {
+			var (
+				n     int64
+				limit = GetMemoryBudget().QueryBytes
+			)
+			_, err = st.Writer().Exec(`CREATE TABLE t2 (v TEXT)`)
+			So(err, ShouldBeNil)
+			_, err = st.Writer().Exec(`WITH RECURSIVE s(i) AS (SELECT 1 UNION ALL SELECT i+1 FROM s
+				WHERE i < 2000) INSERT INTO t2 SELECT hex(randomblob(64)) FROM s`)
+			So(err, ShouldBeNil)
+			err = st.Reader().QueryRow(`SELECT length(group_concat(v)) FROM t2`).Scan(&n)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "too big")
+			err = st.Reader().QueryRow(`WITH RECURSIVE s(i, x) AS (SELECT 1, '' UNION ALL
+				SELECT i+1, x || hex(randomblob(64)) FROM s WHERE i < 2000)
+				SELECT max(length(x)) FROM s`).Scan(&n)
+			So(err, ShouldNotBeNil)
+			// the values within the budget are still readable
+			So(st.Reader().QueryRow(`SELECT length(group_concat(v)) FROM t2 WHERE rowid <= 100`).
+				Scan(&n), ShouldBeNil)
+			So(n, ShouldBeLessThan, limit)
+		})
+	})
+}
@@ -51,6 +51,9 @@ func init() {
 	}
 
 	regCustomFunc := func(c *sqlite3.SQLiteConn) (err error) {
+		if err = applyMemoryBudget(c); err != nil {
+			return
+		}
 		if err = c.RegisterFunc("sleep", sleepFunc, true); err != nil {
 			return
 		}
@@ -60,6 +63,12 @@ func init() {
 		if err = c.RegisterFunc("decrypt", decryptFunc, true); err != nil {
 			return
 		}
+		if err = registerDecimalFuncs(c); err != nil {
+			return
+		}
+		if err = registerCollations(c); err != nil {
+			return
+		}
 		return
 	}
 
@@ -90,6 +90,76 @@ func TestStorage(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(destStr, ShouldEqual, largeText)
 			})
+			Convey("Test custom decimal funcs", func() {
+				_, err = st.Writer().Exec(`CREATE TABLE "d1" (
+					"k" INT, "amount" DECIMAL_TEXT CHECK ("amount" = decimal("amount")), PRIMARY KEY("k"))`)
+				So(err, ShouldBeNil)
+				_, err = st.Writer().Exec(`INSERT INTO "d1" ("k", "amount") VALUES (?, decimal(?))`, 0, "0.10")
+				So(err, ShouldBeNil)
+				_, err = st.Writer().Exec(`INSERT INTO "d1" ("k", "amount") VALUES (?, decimal(?))`, 1, "0.2")
+				So(err, ShouldBeNil)
+				_, err = st.Writer().Exec(`INSERT INTO "d1" ("k", "amount") VALUES (?, ?)`, 2, "1.50")
+				So(err, ShouldNotBeNil)
+				_, err = st.Writer().Exec(`INSERT INTO "d1" ("k", "amount") VALUES (?, decimal(?))`, 2, "x")
+				So(err, ShouldNotBeNil)
+
+				var dest string
+				err = st.Reader().QueryRow(`SELECT decimal_sum("amount") FROM "d1"`).Scan(&dest)
+				So(err, ShouldBeNil)
+				So(dest, ShouldEqual, "0.3")
+				err = st.Reader().QueryRow(`SELECT decimal_div(?, ?, 4)`, "2", "3").Scan(&dest)
+				So(err, ShouldBeNil)
+				So(dest, ShouldEqual, "0.6667")
+				err = st.Reader().QueryRow(`SELECT decimal_mul(?, ?)`, "1.1", 3).Scan(&dest)
+				So(err, ShouldBeNil)
+				So(dest, ShouldEqual, "3.3")
+				err = st.Reader().QueryRow(`SELECT decimal_div(1, 0, 2)`).Scan(&dest)
+				So(err, ShouldNotBeNil)
+				var cmp int64
+				err = st.Reader().QueryRow(`SELECT decimal_cmp(?, ?)`, "10", "9.99").Scan(&cmp)
+				So(err, ShouldBeNil)
+				So(cmp, ShouldEqual, 1)
+				// the results are bounded like the arguments
+				var large = strings.Repeat("9", 600)
+				err = st.Reader().QueryRow(`SELECT decimal_mul(?, ?)`, large, large).Scan(&dest)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "maximum digits")
+				err = st.Reader().QueryRow(`SELECT decimal_add(?, ?)`, large, large).Scan(&dest)
+				So(err, ShouldBeNil)
+				So(len(dest), ShouldEqual, 601)
+				err = st.Reader().QueryRow(`SELECT decimal(?)`, "1e1000").Scan(&dest)
+				So(err, ShouldNotBeNil)
+				err = st.Reader().QueryRow(`SELECT decimal_add(NULL, 1)`).Scan(&dest)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "NULL")
+			})
+			Convey("Test custom collations", func() {
+				_, err = st.Writer().Exec(`CREATE TABLE "c1" ("v" TEXT COLLATE natural_ci)`)
+				So(err, ShouldBeNil)
+				for _, v := range []string{"File10", "file2", "FILE1"} {
+					_, err = st.Writer().Exec(`INSERT INTO "c1" ("v") VALUES (?)`, v)
+					So(err, ShouldBeNil)
+				}
+				var (
+					rows   *sql.Rows
+					sorted []string
+				)
+				rows, err = st.Reader().Query(`SELECT "v" FROM "c1" ORDER BY "v"`)
+				So(err, ShouldBeNil)
+				for rows.Next() {
+					var v string
+					So(rows.Scan(&v), ShouldBeNil)
+					sorted = append(sorted, v)
+				}
+				_ = rows.Close()
+				So(sorted, ShouldResemble, []string{"FILE1", "file2", "File10"})
+
+				var count int
+				err = st.Reader().QueryRow(
+					`SELECT COUNT(1) FROM "c1" WHERE "v" = ? COLLATE unicode_ci`, "FILE2").Scan(&count)
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+			})
 			Convey("When storage is closed", func() {
 				err = st.Close()
 				So(err, ShouldBeNil)
@@ -258,6 +328,46 @@ func TestStorage(t *testing.T) {
 	})
 }
 
+func TestForeignKeys(t *testing.T) {
+	Convey("Given a sqlite storage with foreign key enforcement", t, func() {
+		var (
+			fl  = path.Join(testingDataDir, t.Name())
+			st  xi.Storage
+			err error
+		)
+		st, err = NewSqlite(fmt.Sprint("file:", fl, "?_foreign_keys=1"))
+		So(err, ShouldBeNil)
+		Reset(func() {
+			err = st.Close()
+			So(err, ShouldBeNil)
+			for _, f := range []string{fl, fl + "-shm", fl + "-wal"} {
+				err = os.Remove(f)
+				So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			}
+		})
+		_, err = st.Writer().Exec(`CREATE TABLE "p" ("id" INT PRIMARY KEY)`)
+		So(err, ShouldBeNil)
+		_, err = st.Writer().Exec(`CREATE TABLE "c" ("id" INT PRIMARY KEY, "pid" INT REFERENCES "p"("id"))`)
+		So(err, ShouldBeNil)
+		_, err = st.Writer().Exec(`INSERT INTO "p" VALUES (1)`)
+		So(err, ShouldBeNil)
+		Convey("The constraints should be enforced on writes", func() {
+			_, err = st.Writer().Exec(`INSERT INTO "c" VALUES (1, 1)`)
+			So(err, ShouldBeNil)
+			_, err = st.Writer().Exec(`INSERT INTO "c" VALUES (2, 2)`)
+			So(err, ShouldNotBeNil)
+			_, err = st.Writer().Exec(`DELETE FROM "p" WHERE "id" = 1`)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("The mode should be visible from the readers", func() {
+			var on int
+			err = st.Reader().QueryRow(`PRAGMA foreign_keys`).Scan(&on)
+			So(err, ShouldBeNil)
+			So(on, ShouldEqual, 1)
+		})
+	})
+}
+
 const (
 	benchmarkQueriesPerTx      = 100
 	benchmarkVNum              = 3
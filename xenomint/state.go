@@ -26,9 +26,11 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/SQLess/SQLess/proto"
+	"github.com/SQLess/SQLess/storage"
 	"github.com/SQLess/SQLess/types"
 	"github.com/SQLess/SQLess/utils/log"
 	xi "github.com/SQLess/SQLess/xenomint/interfaces"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
 )
 
 type sqlQuerier interface {
@@ -56,26 +58,31 @@ type State struct {
 	level sql.IsolationLevel
 
 	sync.RWMutex
-	strg   xi.Storage
-	pool   *pool
-	closed bool
-	nodeID proto.NodeID
+	strg     xi.Storage
+	strgLock sync.RWMutex // protects strg from being swapped by a rekey while read without lock
+	pool     *pool
+	closed   bool
+	nodeID   proto.NodeID
 
 	handler         sqlHandler
 	maxTx           uint64
 	lastCommitPoint uint64
 	current         uint64 // current is the current lastSeq of the current transaction
 	hasSchemaChange uint32 // indicates schema change happens in this uncommitted transaction
+	cursors         *cursorSet
+	rekey           *rekeyRecorder // records the writes while the storage is being rekeyed
+	usage           usageCache
 }
 
 // NewState returns a new State bound to strg.
 func NewState(level sql.IsolationLevel, nodeID proto.NodeID, strg xi.Storage) (s *State) {
 	s = &State{
-		level:  level,
-		nodeID: nodeID,
-		strg:   strg,
-		pool:   newPool(),
-		maxTx:  100,
+		level:   level,
+		nodeID:  nodeID,
+		strg:    strg,
+		pool:    newPool(),
+		maxTx:   100,
+		cursors: newCursorSet(),
 	}
 	s.openHandler()
 	return
@@ -90,13 +97,23 @@ func (s *State) openHandler() {
 	} else {
 		s.handler = s.strg.Writer()
 	}
+	if s.rekey != nil {
+		s.rekey.wrap(s.handler)
+		s.handler = s.rekey
+	}
+}
+
+func (s *State) storage() xi.Storage {
+	s.strgLock.RLock()
+	defer s.strgLock.RUnlock()
+	return s.strg
 }
 
 func (s *State) reader() *sql.DB {
 	if s.level == sql.LevelReadUncommitted {
-		return s.strg.DirtyReader()
+		return s.storage().DirtyReader()
 	}
-	return s.strg.Reader()
+	return s.storage().Reader()
 }
 
 func (s *State) incSeq() {
@@ -118,6 +135,8 @@ func (s *State) getLastCommitPoint() uint64 {
 
 // Close commits any ongoing transaction if needed and closes the underlying storage.
 func (s *State) Close(commit bool) (err error) {
+	// cursors are closed outside the state locking scope, a page being served may wait for it
+	s.cursors.closeAll()
 	s.Lock()
 	defer s.Unlock()
 	if s.closed {
@@ -214,7 +233,18 @@ func (s *State) readWithContext(
 	)
 	// TODO(leventeliu): no need to run every read query here.
 	for i, v := range req.Payload.Queries {
-		if cnames, ctypes, data, ierr = readSingle(ctx, s.reader(), &v); ierr != nil {
+		var qer sqlQuerier = s.reader()
+		if isTableUsageQuery(v.Pattern) {
+			var usageDB *sql.DB
+			if usageDB, ierr = s.tableUsageQuerier(ctx); ierr != nil {
+				err = errors.Wrapf(ierr, "query at #%d failed", i)
+				s.pool.setFailed(req)
+				return
+			}
+			defer func() { _ = usageDB.Close() }()
+			qer = usageDB
+		}
+		if cnames, ctypes, data, ierr = readSingle(ctx, qer, &v); ierr != nil {
 			err = errors.Wrapf(ierr, "query at #%d failed", i)
 			// Add to failed pool list
 			s.pool.setFailed(req)
@@ -238,9 +268,10 @@ func (s *State) readWithContext(
 			},
 		},
 		Payload: types.ResponsePayload{
-			Columns:   cnames,
-			DeclTypes: ctypes,
-			Rows:      buildRowsFromNativeData(data),
+			Columns:    cnames,
+			DeclTypes:  ctypes,
+			Rows:       buildRowsFromNativeData(data),
+			ColumnMeta: types.BuildColumnMeta(len(cnames), data),
 		},
 	}
 	return
@@ -310,9 +341,10 @@ func (s *State) readTx(
 			},
 		},
 		Payload: types.ResponsePayload{
-			Columns:   cnames,
-			DeclTypes: ctypes,
-			Rows:      buildRowsFromNativeData(data),
+			Columns:    cnames,
+			DeclTypes:  ctypes,
+			Rows:       buildRowsFromNativeData(data),
+			ColumnMeta: types.BuildColumnMeta(len(cnames), data),
 		},
 	}
 	return
@@ -341,6 +373,12 @@ func (s *State) writeSingle(
 	//	}
 	//	log.WithFields(fields).Debug("writeSingle duration stat (us)")
 	//}()
+	if IsAnalyzeStatement(q.Pattern) {
+		if res, err = s.analyze(q.Pattern); err == nil {
+			s.incSeq()
+		}
+		return
+	}
 	if containsDDL, pattern, args, err = convertQueryAndBuildArgs(q.Pattern, q.Args); err != nil {
 		return
 	}
@@ -349,6 +387,11 @@ func (s *State) writeSingle(
 		if containsDDL {
 			atomic.StoreUint32(&s.hasSchemaChange, 1)
 		}
+		if containsDDL || touchesViews(pattern) {
+			if verr := s.syncViews(); verr != nil {
+				log.WithError(verr).Warning("sync materialized views failed")
+			}
+		}
 		s.incSeq()
 	}
 	//executed = time.Since(start)
@@ -364,6 +407,7 @@ func (s *State) write(
 		totalAffectedRows int64
 		curAffectedRows   int64
 		lastInsertID      int64
+		applied           *appliedWrite
 		start             = time.Now()
 
 		lockAcquired, writeDone, enqueued, lockReleased, respBuilt time.Duration
@@ -393,8 +437,9 @@ func (s *State) write(
 
 	if err = func() (err error) {
 		var (
-			ierr error
-			qcnt = len(req.Payload.Queries)
+			ierr  error
+			qcnt  = len(req.Payload.Queries)
+			keyed = req.IdempotencyKey != ""
 		)
 		s.Lock()
 		lockAcquired = time.Since(start)
@@ -403,7 +448,16 @@ func (s *State) write(
 			lockReleased = time.Since(start)
 		}()
 		lastSeq = s.getSeq()
-		if qcnt > 1 && s.level == sql.LevelReadUncommitted {
+		if keyed {
+			// the retry of an applied write is answered by the recorded result, see idempotency.go
+			if err = s.ensureIdempotencyTable(); err != nil {
+				return
+			}
+			if applied, err = s.loadAppliedWrite(req); err != nil || applied != nil {
+				return
+			}
+		}
+		if (qcnt > 1 || keyed) && s.level == sql.LevelReadUncommitted {
 			// Set savepoint
 			if _, ierr = s.handler.Exec(`SAVEPOINT "?"`, lastSeq); ierr != nil {
 				err = errors.Wrapf(ierr, "failed to create savepoint %d", lastSeq)
@@ -420,6 +474,7 @@ func (s *State) write(
 				_, _ = s.handler.Exec(`ROLLBACK`)
 			}()
 		}
+		ioBefore, ioErr := s.readIOCounter()
 		for i, v := range req.Payload.Queries {
 			var res sql.Result
 			if res, ierr = s.writeSingle(ctx, &v); ierr != nil {
@@ -434,8 +489,22 @@ func (s *State) write(
 			lastInsertID, _ = res.LastInsertId()
 			totalAffectedRows += curAffectedRows
 		}
+		if keyed {
+			// recorded in the same transaction as the write
+			if err = s.recordAppliedWrite(req, &appliedWrite{
+				logOffset:    lastSeq,
+				affectedRows: totalAffectedRows,
+				lastInsertID: lastInsertID,
+			}); err != nil {
+				s.pool.setFailed(req)
+				return
+			}
+		}
+		if ioErr == nil {
+			s.meterWrite(query, qcnt, totalAffectedRows, ioBefore)
+		}
 		if s.level == sql.LevelReadUncommitted {
-			if qcnt > 1 {
+			if qcnt > 1 || keyed {
 				// Release savepoint
 				if _, ierr = s.handler.Exec(`RELEASE SAVEPOINT "?"`, lastSeq); ierr != nil {
 					err = errors.Wrapf(ierr, "failed to release savepoint %d", lastSeq)
@@ -457,6 +526,10 @@ func (s *State) write(
 	}(); err != nil {
 		return
 	}
+	if applied != nil {
+		// the write is not applied again and never added to the pool
+		lastSeq, totalAffectedRows, lastInsertID = applied.logOffset, applied.affectedRows, applied.lastInsertID
+	}
 	// Build query response
 	ref = query
 	resp = &types.Response{
@@ -493,12 +566,26 @@ func (s *State) replay(ctx context.Context, req *types.Request, resp *types.Resp
 		)
 		return
 	}
+	if req.IdempotencyKey != "" {
+		if err = s.ensureIdempotencyTable(); err != nil {
+			return
+		}
+	}
 	for i, v := range req.Payload.Queries {
 		if _, ierr = s.writeSingle(ctx, &v); ierr != nil {
 			err = errors.Wrapf(ierr, "execute at #%d failed", i)
 			return
 		}
 	}
+	if req.IdempotencyKey != "" {
+		if err = s.recordAppliedWrite(req, &appliedWrite{
+			logOffset:    resp.Header.LogOffset,
+			affectedRows: resp.Header.AffectedRows,
+			lastInsertID: resp.Header.LastInsertID,
+		}); err != nil {
+			return
+		}
+	}
 	// Try to commit if the ongoing tx is too large or schema is changed
 	if s.getSeq()-s.getLastCommitPoint() > s.maxTx ||
 		atomic.LoadUint32(&s.hasSchemaChange) != 0 {
@@ -692,6 +779,9 @@ func (s *State) QueryWithContext(
 ) {
 	switch req.Header.QueryType {
 	case types.ReadQuery:
+		if req.Page.Size > 0 {
+			return s.readPage(ctx, req)
+		}
 		return s.readTx(ctx, req)
 	case types.WriteQuery:
 		return s.write(ctx, req, isLeader)
@@ -701,6 +791,39 @@ func (s *State) QueryWithContext(
 	return
 }
 
+// QueryReadOnly runs the read queries on a snapshot of the committed state, the request is not
+// pooled nor tracked, so it's used to serve the reads of the replicas outside of the sqlchain,
+// e.g. the materialized replicas of observers. The results of the last query are returned.
+func (s *State) QueryReadOnly(ctx context.Context, queries []types.Query) (
+	payload *types.ResponsePayload, err error,
+) {
+	var (
+		tx             *sql.Tx
+		cnames, ctypes []string
+		data           [][]interface{}
+	)
+	if tx, err = s.storage().Reader().BeginTx(ctx, nil); err != nil {
+		err = errors.Wrap(err, "open tx failed")
+		return
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	for i := range queries {
+		if cnames, ctypes, data, err = readSingle(ctx, tx, &queries[i]); err != nil {
+			err = errors.Wrapf(err, "query at #%d failed", i)
+			return
+		}
+	}
+	payload = &types.ResponsePayload{
+		Columns:    cnames,
+		DeclTypes:  ctypes,
+		Rows:       buildRowsFromNativeData(data),
+		ColumnMeta: types.BuildColumnMeta(len(cnames), data),
+	}
+	return
+}
+
 // Replay replays a write log from other peer to replicate storage state.
 func (s *State) Replay(req *types.Request, resp *types.Response) (err error) {
 	return s.ReplayWithContext(context.Background(), req, resp)
@@ -727,6 +850,23 @@ func (s *State) ReplayWithContext(
 	return
 }
 
+// Export exports the committed state to a plain SQLite file. The onPin callback, if any, is
+// called while the snapshot of the export is pinned and the writes are blocked.
+func (s *State) Export(ctx context.Context, filename string, onPin func()) (err error) {
+	var (
+		dsn *storage.DSN
+		stx *sql.Tx
+	)
+	if dsn, err = storage.NewDSN(filename); err != nil {
+		return
+	}
+	if stx, _, err = s.pinSnapshot(ctx, onPin); err != nil {
+		return
+	}
+	defer func() { _ = stx.Rollback() }()
+	return xs.CopyTx(ctx, stx, dsn, xs.CopyOptions{})
+}
+
 // Stat prints the statistic message of the State object.
 func (s *State) Stat(id proto.DatabaseID) {
 	var (
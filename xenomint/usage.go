@@ -0,0 +1,268 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/SQLess/SQLess/types"
+)
+
+// TableUsageTable defines the read-only system table of per-table storage usage, e.g.:
+//
+//	SELECT "name", "bytes" FROM "__sqless_table_usage" ORDER BY "bytes" DESC;
+//
+// The table is not stored in the database, it is computed from the committed state and can not
+// be joined with user tables. The usage is cached, see TableUsageCacheTTL.
+const TableUsageTable = "__sqless_table_usage"
+
+// TableUsageCacheTTL is the max age of the cached table usage served after new commits, so that
+// the usage estimation, which scans all the tables unless dbstat is compiled in, runs at most
+// once in the period however often the usage is read.
+var TableUsageCacheTTL = time.Minute
+
+// usageCache caches the table usage of the committed state.
+type usageCache struct {
+	sync.Mutex
+	valid    bool
+	commit   uint64 // the last commit point of the cached usage
+	at       time.Time
+	pageSize uint64
+	usage    []types.TableUsage
+}
+
+// isTableUsageQuery returns whether the query reads the table usage system table.
+func isTableUsageQuery(pattern string) bool {
+	if !strings.Contains(strings.ToLower(pattern), TableUsageTable) {
+		return false
+	}
+	for _, t := range referencedTables(pattern) {
+		if strings.ToLower(t) == TableUsageTable {
+			return true
+		}
+	}
+	return false
+}
+
+// TableUsage returns the page size and the approximate storage usage of each table in the
+// committed state, sorted by table name. Index pages are accounted to the indexed table.
+func (s *State) TableUsage(ctx context.Context) (pageSize uint64, usage []types.TableUsage, err error) {
+	var (
+		c      = &s.usage
+		commit = s.getLastCommitPoint()
+	)
+	c.Lock()
+	defer c.Unlock()
+	if !c.valid || (c.commit != commit && time.Since(c.at) >= TableUsageCacheTTL) {
+		if pageSize, usage, err = tableUsage(ctx, s.storage().Reader()); err != nil {
+			return
+		}
+		c.valid, c.commit, c.at, c.pageSize, c.usage = true, commit, time.Now(), pageSize, usage
+	}
+	return c.pageSize, append([]types.TableUsage(nil), c.usage...), nil
+}
+
+func tableUsage(ctx context.Context, db *sql.DB) (pageSize uint64, usage []types.TableUsage, err error) {
+	var (
+		pageCount, freeCount uint64
+		owners               = make(map[string]string) // table or index name -> table name
+		pages                map[string]uint64
+	)
+	if err = db.QueryRowContext(ctx, `PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return
+	}
+	if err = db.QueryRowContext(ctx, `PRAGMA page_count`).Scan(&pageCount); err != nil {
+		return
+	}
+	if err = db.QueryRowContext(ctx, `PRAGMA freelist_count`).Scan(&freeCount); err != nil {
+		return
+	}
+	rows, err := db.QueryContext(ctx, `SELECT "type", "name", "tbl_name" FROM "sqlite_master" `+
+		`WHERE "type" IN ('table', 'index')`)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var typ, name, table string
+		if err = rows.Scan(&typ, &name, &table); err != nil {
+			_ = rows.Close()
+			return
+		}
+		owners[name] = table
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	// prefer the exact page counts from the dbstat virtual table if compiled in
+	if pages, err = dbstatPages(ctx, db, owners); err != nil {
+		if pages, err = estimatePages(ctx, db, owners, pageCount-freeCount); err != nil {
+			return
+		}
+	}
+	usage = make([]types.TableUsage, 0, len(pages))
+	for table, n := range pages {
+		usage = append(usage, types.TableUsage{
+			Table: table,
+			Pages: n,
+			Bytes: n * pageSize,
+		})
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Table < usage[j].Table })
+	return
+}
+
+// dbstatPages counts the pages of each table from the dbstat virtual table.
+func dbstatPages(
+	ctx context.Context, db *sql.DB, owners map[string]string,
+) (pages map[string]uint64, err error) {
+	rows, err := db.QueryContext(ctx, `SELECT "name", COUNT(*) FROM "dbstat" GROUP BY "name"`)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+	pages = make(map[string]uint64)
+	for rows.Next() {
+		var (
+			name string
+			n    uint64
+		)
+		if err = rows.Scan(&name, &n); err != nil {
+			return
+		}
+		if table, ok := owners[name]; ok {
+			name = table
+		}
+		pages[name] += n
+	}
+	err = rows.Err()
+	return
+}
+
+// estimatePages distributes the used pages of the database to the tables in proportion to the
+// payload size of their rows, each table takes at least its root page.
+func estimatePages(
+	ctx context.Context, db *sql.DB, owners map[string]string, used uint64,
+) (pages map[string]uint64, err error) {
+	var (
+		payloads = make(map[string]uint64)
+		total    uint64
+	)
+	for name, table := range owners {
+		if name != table {
+			// index
+			continue
+		}
+		var payload uint64
+		if payload, err = tablePayload(ctx, db, table); err != nil {
+			err = errors.Wrapf(err, "estimate usage of table %s failed", table)
+			return
+		}
+		payloads[table] = payload
+		total += payload
+	}
+	pages = make(map[string]uint64, len(payloads))
+	var base = uint64(len(payloads)) + 1 // root pages and the schema page
+	for table, payload := range payloads {
+		pages[table] = 1
+		if total > 0 && used > base {
+			pages[table] += (used - base) * payload / total
+		}
+	}
+	return
+}
+
+// tablePayload returns the total size of all values stored in the table.
+func tablePayload(ctx context.Context, db *sql.DB, table string) (payload uint64, err error) {
+	var (
+		rows    *sql.Rows
+		columns []string
+	)
+	if rows, err = db.QueryContext(ctx, `PRAGMA table_info(`+quoteIdentifier(table)+`)`); err != nil {
+		return
+	}
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notnull int
+			dflt    interface{}
+			pk      int
+		)
+		if err = rows.Scan(&cid, &name, &typ, &notnull, &dflt, &pk); err != nil {
+			_ = rows.Close()
+			return
+		}
+		columns = append(columns, `IFNULL(LENGTH(CAST(`+quoteIdentifier(name)+` AS BLOB)), 0)`)
+	}
+	_ = rows.Close()
+	if err = rows.Err(); err != nil || len(columns) == 0 {
+		return
+	}
+	var sum float64
+	if err = db.QueryRowContext(ctx, `SELECT TOTAL(`+strings.Join(columns, " + ")+`) FROM `+
+		quoteIdentifier(table)).Scan(&sum); err != nil {
+		return
+	}
+	payload = uint64(sum)
+	return
+}
+
+// tableUsageQuerier returns an in-memory database holding the table usage system table, the
+// database must be closed by the caller.
+func (s *State) tableUsageQuerier(ctx context.Context) (db *sql.DB, err error) {
+	var (
+		pageSize uint64
+		usage    []types.TableUsage
+	)
+	if pageSize, usage, err = s.TableUsage(ctx); err != nil {
+		return
+	}
+	if db, err = sql.Open("sqlite3", ":memory:"); err != nil {
+		return
+	}
+	// each connection has its own in-memory database
+	db.SetMaxOpenConns(1)
+	defer func() {
+		if err != nil {
+			_ = db.Close()
+			db = nil
+		}
+	}()
+	if _, err = db.ExecContext(ctx, `CREATE TABLE `+quoteIdentifier(TableUsageTable)+
+		` ("name" TEXT PRIMARY KEY, "pages" INTEGER, "bytes" INTEGER, "page_size" INTEGER)`,
+	); err != nil {
+		return
+	}
+	for _, u := range usage {
+		if _, err = db.ExecContext(ctx, `INSERT INTO `+quoteIdentifier(TableUsageTable)+
+			` VALUES (?, ?, ?, ?)`, u.Table, u.Pages, u.Bytes, pageSize,
+		); err != nil {
+			return
+		}
+	}
+	return
+}
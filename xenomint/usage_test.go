@@ -0,0 +1,124 @@
+/*
+ * Copyright 2019 The CovenantSQL Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package xenomint
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/SQLess/SQLess/types"
+	xi "github.com/SQLess/SQLess/xenomint/interfaces"
+	xs "github.com/SQLess/SQLess/xenomint/sqlite"
+)
+
+func TestTableUsage(t *testing.T) {
+	Convey("Given a state with a large and a small table", t, func() {
+		var (
+			fl   = path.Join(testingDataDir, t.Name())
+			strg xi.Storage
+			err  error
+		)
+		strg, err = xs.NewSqlite(fmt.Sprint("file:", fl))
+		So(err, ShouldBeNil)
+		st := NewState(sql.LevelReadUncommitted, nodeID, strg)
+		Reset(func() {
+			So(st.Close(true), ShouldBeNil)
+			for _, f := range []string{fl, fl + "-shm", fl + "-wal"} {
+				err = os.Remove(f)
+				So(err == nil || os.IsNotExist(err), ShouldBeTrue)
+			}
+		})
+		var qs = []types.Query{
+			buildQuery(`CREATE TABLE large (id INT, v TEXT, PRIMARY KEY(id))`),
+			buildQuery(`CREATE TABLE small (id INT, PRIMARY KEY(id))`),
+			buildQuery(`INSERT INTO small VALUES (1)`),
+		}
+		for i := 0; i < 100; i++ {
+			qs = append(qs, buildQuery(
+				fmt.Sprintf(`INSERT INTO large VALUES (%d, '%s')`, i, strings.Repeat("x", 1000))))
+		}
+		_, _, err = st.Query(buildRequest(types.WriteQuery, qs), true)
+		So(err, ShouldBeNil)
+		_, _, err = st.CommitEx()
+		So(err, ShouldBeNil)
+
+		Convey("The large table should take more pages", func() {
+			pageSize, usage, err := st.TableUsage(context.Background())
+			So(err, ShouldBeNil)
+			So(pageSize, ShouldBeGreaterThan, 0)
+			var pages = make(map[string]uint64)
+			for _, u := range usage {
+				So(u.Bytes, ShouldEqual, u.Pages*pageSize)
+				pages[u.Table] = u.Pages
+			}
+			So(pages["small"], ShouldBeGreaterThan, 0)
+			So(pages["large"], ShouldBeGreaterThan, pages["small"])
+		})
+		Convey("The usage should be readable from the system table", func() {
+			_, resp, err := st.Query(buildRequest(types.ReadQuery, []types.Query{
+				buildQuery(`SELECT name FROM __sqless_table_usage ORDER BY bytes DESC LIMIT 1`),
+			}), true)
+			So(err, ShouldBeNil)
+			So(resp.Payload.Rows, ShouldHaveLength, 1)
+			So(resp.Payload.Rows[0].Values[0], ShouldEqual, "large")
+		})
+		Convey("The usage should be cached until the ttl expires after new commits", func() {
+			_, usage, err := st.TableUsage(context.Background())
+			So(err, ShouldBeNil)
+			var qs []types.Query
+			for i := 100; i < 200; i++ {
+				qs = append(qs, buildQuery(
+					fmt.Sprintf(`INSERT INTO large VALUES (%d, '%s')`, i, strings.Repeat("x", 1000))))
+			}
+			_, _, err = st.Query(buildRequest(types.WriteQuery, qs), true)
+			So(err, ShouldBeNil)
+			_, _, err = st.CommitEx()
+			So(err, ShouldBeNil)
+			_, cached, err := st.TableUsage(context.Background())
+			So(err, ShouldBeNil)
+			So(cached, ShouldResemble, usage)
+
+			var origin = TableUsageCacheTTL
+			TableUsageCacheTTL = 0
+			defer func() { TableUsageCacheTTL = origin }()
+			_, refreshed, err := st.TableUsage(context.Background())
+			So(err, ShouldBeNil)
+			var pages = make(map[string]uint64)
+			for _, u := range usage {
+				pages[u.Table] = u.Pages
+			}
+			for _, u := range refreshed {
+				if u.Table == "large" {
+					So(u.Pages, ShouldBeGreaterThan, pages["large"])
+				}
+			}
+		})
+		Convey("The system table name should be reserved", func() {
+			_, _, err = st.Query(buildRequest(types.WriteQuery, []types.Query{
+				buildQuery(`CREATE TABLE __sqless_table_usage (id INT)`),
+			}), true)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}